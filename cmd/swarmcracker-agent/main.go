@@ -13,17 +13,17 @@ import (
 	"syscall"
 
 	"github.com/moby/swarmkit/v2/api"
+	"github.com/restuhaqza/swarmcracker/pkg/config"
 	"github.com/restuhaqza/swarmcracker/pkg/swarmkit"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
-	"gopkg.in/yaml.v3"
 )
 
 // Version is set by build flags (-X main.Version=...)
 var Version = "0.0.0-dev"
 
 var (
-	configPath = flag.String("config", "/etc/swarmcracker/config.yaml", "Path to configuration file")
+	configPath = flag.String("config", config.GetDefaultConfigPath(), "Path to configuration file")
 	debug      = flag.Bool("debug", false, "Enable debug logging")
 	version    = flag.Bool("version", false, "Show version information")
 )
@@ -48,13 +48,13 @@ func main() {
 	log.Info().Msg("This is a demo agent showing executor functionality")
 
 	// Load configuration
-	config, err := loadConfig(*configPath)
+	executorConfig, err := loadConfig(*configPath)
 	if err != nil {
 		log.Fatal().Err(err).Msg("Failed to load configuration")
 	}
 
 	// Create executor
-	executor, err := swarmkit.NewExecutor(config)
+	executor, err := swarmkit.NewExecutor(executorConfig)
 	if err != nil {
 		log.Fatal().Err(err).Msg("Failed to create executor")
 	}
@@ -72,87 +72,26 @@ func main() {
 	log.Info().Msg("Shutting down")
 }
 
-// loadConfig loads the configuration from a YAML file.
-// If the file doesn't exist, returns default configuration.
+// loadConfig loads the configuration through the shared loader (defaults,
+// then the YAML file if it exists, then SWARMCRACKER_* env vars) and
+// converts it to the executor configuration.
 func loadConfig(path string) (*swarmkit.Config, error) {
-	// Start with default configuration
-	config := defaultConfig()
-
-	// Check if config file exists
-	if _, err := os.Stat(path); os.IsNotExist(err) {
-		log.Info().Str("path", path).Msg("Config file not found, using defaults")
-		return config, nil
-	}
-
-	// Read config file
-	data, err := os.ReadFile(path)
+	cfg, err := config.Load(path)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read config file: %w", err)
-	}
-
-	// Parse YAML into config struct
-	if err := yaml.Unmarshal(data, config); err != nil {
-		return nil, fmt.Errorf("failed to parse config YAML: %w", err)
+		return nil, err
 	}
 
 	// Apply overrides from flags
 	if *debug {
-		config.Debug = true
+		cfg.Logging.Level = "debug"
 	}
 
-	// Validate required fields
-	if err := validateConfig(config); err != nil {
+	if err := cfg.Validate(); err != nil {
 		return nil, fmt.Errorf("config validation failed: %w", err)
 	}
 
 	log.Info().Str("path", path).Msg("Configuration loaded successfully")
-	return config, nil
-}
-
-// defaultConfig returns the default configuration.
-func defaultConfig() *swarmkit.Config {
-	natEnabled := true
-	return &swarmkit.Config{
-		FirecrackerPath:  "firecracker",
-		KernelPath:       "/usr/share/firecracker/vmlinux",
-		RootfsDir:        "/var/lib/firecracker/rootfs",
-		SocketDir:        "/var/run/firecracker",
-		DefaultVCPUs:     1,
-		DefaultMemoryMB:  512,
-		BridgeName:       "swarm-br0",
-		NATEnabled:       &natEnabled,
-		IPMode:           "dhcp",
-		EnableJailer:     false,
-		EnableCgroups:    false,
-		ReservedCPUs:     0,
-		ReservedMemoryMB: 0,
-		MaxImageAgeDays:  30,
-		StateDir:         "/var/lib/swarmcracker",
-	}
-}
-
-// validateConfig validates the configuration.
-func validateConfig(config *swarmkit.Config) error {
-	// Check required paths (can be empty if using defaults)
-	if config.FirecrackerPath == "" {
-		return fmt.Errorf("firecracker_path is required")
-	}
-	if config.KernelPath == "" {
-		return fmt.Errorf("kernel_path is required")
-	}
-	if config.RootfsDir == "" {
-		return fmt.Errorf("rootfs_dir is required")
-	}
-
-	// Validate resource limits
-	if config.DefaultVCPUs < 1 {
-		return fmt.Errorf("default_vcpus must be at least 1")
-	}
-	if config.DefaultMemoryMB < 64 {
-		return fmt.Errorf("default_memory_mb must be at least 64")
-	}
-
-	return nil
+	return swarmkit.ConfigFrom(cfg, ""), nil
 }
 
 // testExecutor tests the executor functionality.
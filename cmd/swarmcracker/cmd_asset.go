@@ -1,10 +1,16 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
+	"text/tabwriter"
+	"time"
 
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/restuhaqza/swarmcracker/pkg/kernel"
 	"github.com/spf13/cobra"
 )
 
@@ -27,41 +33,168 @@ Provides commands for downloading, verifying, and managing VM assets.`,
 
 // newAssetKernelCommand creates the kernel subcommand
 func newAssetKernelCommand() *cobra.Command {
+	var catalogPath string
+
 	cmd := &cobra.Command{
 		Use:   "kernel",
 		Short: "Manage Firecracker kernels",
-		Long:  `Manage Firecracker kernel images for VMs.`,
+		Long: `Manage Firecracker kernel images for VMs.
+
+Besides the default kernel, each node keeps a catalog of kernels that
+services pick with the swarmcracker.kernel label. Catalog kernels are
+verified against their SHA-256 before every boot.`,
 	}
+	cmd.PersistentFlags().StringVar(&catalogPath, "catalog", kernel.DefaultCatalogPath, "Kernel catalog file")
 
-	cmd.AddCommand(newKernelListCommand())
-	cmd.AddCommand(newKernelVerifyCommand())
+	cmd.AddCommand(newKernelListCommand(&catalogPath))
+	cmd.AddCommand(newKernelVerifyCommand(&catalogPath))
+	cmd.AddCommand(newKernelAddCommand(&catalogPath))
+	cmd.AddCommand(newKernelPullCommand(&catalogPath))
+	cmd.AddCommand(newKernelRemoveCommand(&catalogPath))
 
 	return cmd
 }
 
 // newKernelListCommand lists available kernels
-func newKernelListCommand() *cobra.Command {
+func newKernelListCommand(catalogPath *string) *cobra.Command {
 	return &cobra.Command{
 		Use:   "ls",
 		Short: "List available kernels",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return listKernels()
+			if err := listKernels(); err != nil {
+				return err
+			}
+			return listCatalogKernels(*catalogPath)
 		},
 	}
 }
 
 // newKernelVerifyCommand verifies a kernel
-func newKernelVerifyCommand() *cobra.Command {
+func newKernelVerifyCommand(catalogPath *string) *cobra.Command {
 	return &cobra.Command{
-		Use:   "verify <kernel-path>",
+		Use:   "verify <name|kernel-path>",
 		Short: "Verify kernel integrity",
-		Args:  cobra.ExactArgs(1),
+		Long: `Verify a catalog kernel against its checksums, or sanity check a
+kernel file that is not in the catalog.`,
+		Args: cobra.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
+			catalog, err := kernel.Load(*catalogPath)
+			if err != nil {
+				return err
+			}
+			if k, ok := catalog.Get(args[0]); ok {
+				if err := k.Verify(); err != nil {
+					return err
+				}
+				fmt.Printf("✅ Kernel %s verified: %s\n", k.Name, k.Path)
+				return nil
+			}
 			return verifyKernel(args[0])
 		},
 	}
 }
 
+// newKernelAddCommand adds a kernel file to the catalog
+func newKernelAddCommand(catalogPath *string) *cobra.Command {
+	var version, arch, initrd string
+
+	cmd := &cobra.Command{
+		Use:   "add <name> <kernel-path>",
+		Short: "Add a kernel file to the catalog",
+		Long: `Add a kernel on this node to the catalog, recording its checksum.
+
+Examples:
+  swarmcracker asset kernel add 5.10-lts /var/lib/firecracker/kernels/vmlinux-5.10.223 --version 5.10.223
+  swarmcracker asset kernel add 6.1-initrd /boot/vmlinux-6.1 --initrd /boot/initrd-6.1`,
+		Args: cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			k := kernel.Kernel{Name: args[0], Version: version, Arch: arch}
+			var err error
+			if k.Path, err = filepath.Abs(args[1]); err != nil {
+				return err
+			}
+			if k.SHA256, err = kernel.Checksum(k.Path); err != nil {
+				return fmt.Errorf("failed to checksum kernel: %w", err)
+			}
+			if initrd != "" {
+				if k.Initrd, err = filepath.Abs(initrd); err != nil {
+					return err
+				}
+				if k.InitrdSHA256, err = kernel.Checksum(k.Initrd); err != nil {
+					return fmt.Errorf("failed to checksum initrd: %w", err)
+				}
+			}
+			return addCatalogKernel(*catalogPath, k)
+		},
+	}
+
+	cmd.Flags().StringVar(&version, "version", "", "Kernel version")
+	cmd.Flags().StringVar(&arch, "arch", kernel.HostArch(), "Kernel architecture (x86_64, aarch64)")
+	cmd.Flags().StringVar(&initrd, "initrd", "", "Initrd to boot with the kernel")
+
+	return cmd
+}
+
+// newKernelPullCommand pulls a kernel artifact into the catalog
+func newKernelPullCommand(catalogPath *string) *cobra.Command {
+	var name string
+
+	cmd := &cobra.Command{
+		Use:   "pull <reference>",
+		Short: "Pull a kernel from an OCI registry into the catalog",
+		Long: `Pull a kernel OCI artifact and add it to the catalog. The kernel is
+stored next to the catalog file.
+
+Examples:
+  swarmcracker asset kernel pull ghcr.io/example/kernels:5.10-lts
+  swarmcracker asset kernel pull registry.local/kernels/lts:5.10 --name 5.10-lts`,
+		Args: cobra.ExactArgs(1),
+		PreRun: func(cmd *cobra.Command, args []string) {
+			setupLogging(logLevel)
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+			defer cancel()
+
+			k, err := kernel.Pull(ctx, args[0], filepath.Dir(*catalogPath), name,
+				remote.WithAuthFromKeychain(authn.DefaultKeychain))
+			if err != nil {
+				return err
+			}
+			return addCatalogKernel(*catalogPath, k)
+		},
+	}
+
+	cmd.Flags().StringVar(&name, "name", "", "Catalog name (default: from the artifact)")
+
+	return cmd
+}
+
+// newKernelRemoveCommand removes a kernel from the catalog
+func newKernelRemoveCommand(catalogPath *string) *cobra.Command {
+	return &cobra.Command{
+		Use:     "rm <name>",
+		Aliases: []string{"remove"},
+		Short:   "Remove a kernel from the catalog",
+		Long:    `Remove a kernel from the catalog. Its files are left in place.`,
+		Args:    cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			catalog, err := kernel.Load(*catalogPath)
+			if err != nil {
+				return err
+			}
+			if !catalog.Remove(args[0]) {
+				return fmt.Errorf("kernel %q is not in the catalog", args[0])
+			}
+			if err := catalog.Save(); err != nil {
+				return err
+			}
+			fmt.Printf("Kernel %s removed from %s\n", args[0], catalog.Path())
+			return nil
+		},
+	}
+}
+
 // newAssetRootfsCommand creates the rootfs subcommand
 func newAssetRootfsCommand() *cobra.Command {
 	cmd := &cobra.Command{
@@ -136,6 +269,41 @@ func verifyKernel(kernelPath string) error {
 	return nil
 }
 
+func listCatalogKernels(catalogPath string) error {
+	catalog, err := kernel.Load(catalogPath)
+	if err != nil {
+		return err
+	}
+	if len(catalog.Kernels) == 0 {
+		fmt.Printf("\nNo kernels in catalog %s\n", catalogPath)
+		return nil
+	}
+
+	fmt.Printf("\nCatalog: %s\n", catalogPath)
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tVERSION\tARCH\tSHA256\tPATH")
+	for _, k := range catalog.Kernels {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", k.Name, k.Version, k.Arch, k.SHA256[:min(12, len(k.SHA256))], k.Path)
+	}
+	return w.Flush()
+}
+
+func addCatalogKernel(catalogPath string, k kernel.Kernel) error {
+	catalog, err := kernel.Load(catalogPath)
+	if err != nil {
+		return err
+	}
+	if err := catalog.Add(k); err != nil {
+		return err
+	}
+	if err := catalog.Save(); err != nil {
+		return err
+	}
+	fmt.Printf("Kernel %s added to %s\n", k.Name, catalog.Path())
+	fmt.Printf("Services use it with: --label %s=%s\n", kernel.Label, k.Name)
+	return nil
+}
+
 func listRootfs() error {
 	rootfsDir := "/var/lib/firecracker/rootfs"
 	if envRootfs := os.Getenv("ROOTFS_DIR"); envRootfs != "" {
@@ -1,9 +1,12 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"os"
 
+	"github.com/moby/swarmkit/v2/api"
 	"github.com/restuhaqza/swarmcracker/pkg/config"
 	"github.com/spf13/cobra"
 )
@@ -12,26 +15,126 @@ import (
 func newConfigCommand() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "config",
-		Short: "Manage SwarmCracker configuration",
-		Long: `Manage SwarmCracker configuration files and settings.
+		Short: "Manage cluster configs and SwarmCracker configuration",
+		Long: `Manage configs stored in the SwarmKit cluster, and this node's
+SwarmCracker configuration files.
 
-Provides commands for viewing, validating, and managing configuration.`,
+Cluster configs are like secrets but unencrypted: use them for files such
+as nginx.conf that services mount. The files, validate and migrate
+subcommands work on the local configuration in /etc/swarmcracker.`,
 	}
 
-	// Add subcommands
+	// Cluster configs
+	cmd.AddCommand(newConfigCreateCommand())
 	cmd.AddCommand(newConfigListCommand())
+	cmd.AddCommand(newConfigInspectCommand())
+	cmd.AddCommand(newConfigRemoveCommand())
+
+	// Local configuration
+	cmd.AddCommand(newConfigFilesCommand())
 	cmd.AddCommand(newConfigValidateCommand())
 	cmd.AddCommand(newConfigMigrateCommand())
 
 	return cmd
 }
 
-// newConfigListCommand lists configuration
+// newConfigCreateCommand creates a cluster config
+func newConfigCreateCommand() *cobra.Command {
+	var labels []string
+
+	cmd := &cobra.Command{
+		Use:   "create <name> <file|->",
+		Short: "Create a config from a file or stdin",
+		Example: `  swarmcracker config create nginx_conf ./nginx.conf
+  cat nginx.conf | swarmcracker config create nginx_conf -`,
+		Args: cobra.ExactArgs(2),
+		PreRun: func(cmd *cobra.Command, args []string) {
+			setupLogging(logLevel)
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			data, err := readObjectData(args[1], cmd.InOrStdin())
+			if err != nil {
+				return err
+			}
+			return withSwarmClient(func(ctx context.Context, client api.ControlClient) error {
+				return createConfig(ctx, client, cmd.OutOrStdout(), args[0], data, parseLabels(labels))
+			})
+		},
+	}
+
+	cmd.Flags().StringArrayVarP(&labels, "label", "l", nil, "Config labels (e.g., key=value)")
+
+	return cmd
+}
+
+// newConfigListCommand lists cluster configs
 func newConfigListCommand() *cobra.Command {
-	return &cobra.Command{
+	var (
+		format string
+		quiet  bool
+	)
+
+	cmd := &cobra.Command{
 		Use:     "ls",
-		Short:   "List configuration files",
+		Short:   "List configs",
 		Aliases: []string{"list"},
+		PreRun: func(cmd *cobra.Command, args []string) {
+			setupLogging(logLevel)
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return withSwarmClient(func(ctx context.Context, client api.ControlClient) error {
+				return listConfigs(ctx, client, cmd.OutOrStdout(), format, quiet)
+			})
+		},
+	}
+
+	cmd.Flags().StringVar(&format, "format", "table", "Output format (table, json)")
+	cmd.Flags().BoolVarP(&quiet, "quiet", "q", false, "Only display IDs")
+
+	return cmd
+}
+
+// newConfigInspectCommand shows cluster configs
+func newConfigInspectCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "inspect <config>...",
+		Short: "Show config details and contents",
+		Args:  cobra.MinimumNArgs(1),
+		PreRun: func(cmd *cobra.Command, args []string) {
+			setupLogging(logLevel)
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return withSwarmClient(func(ctx context.Context, client api.ControlClient) error {
+				return inspectConfigs(ctx, client, cmd.OutOrStdout(), args)
+			})
+		},
+	}
+}
+
+// newConfigRemoveCommand removes cluster configs
+func newConfigRemoveCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:     "rm <config>...",
+		Aliases: []string{"remove"},
+		Short:   "Remove configs",
+		Long:    `Remove one or more configs, by name or ID. Configs in use by a service cannot be removed.`,
+		Args:    cobra.MinimumNArgs(1),
+		PreRun: func(cmd *cobra.Command, args []string) {
+			setupLogging(logLevel)
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return withSwarmClient(func(ctx context.Context, client api.ControlClient) error {
+				return removeConfigs(ctx, client, cmd.OutOrStdout(), args)
+			})
+		},
+	}
+}
+
+// newConfigFilesCommand lists the local configuration files
+func newConfigFilesCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "files",
+		Short: "List local configuration files",
 		RunE: func(cmd *cobra.Command, args []string) error {
 			return listConfig()
 		},
@@ -65,7 +168,87 @@ up before migration.`,
 	}
 }
 
-// Config helper functions
+// Cluster config helper functions
+
+func configInfo(c *api.Config) objectInfo {
+	info := newObjectInfo(c.ID, c.Meta, c.Spec.Annotations)
+	info.Data = string(c.Spec.Data)
+	return info
+}
+
+// createConfig creates a cluster config and prints its ID
+func createConfig(ctx context.Context, client api.ControlClient, out io.Writer, name string, data []byte, labels map[string]string) error {
+	resp, err := client.CreateConfig(ctx, &api.CreateConfigRequest{Spec: &api.ConfigSpec{
+		Annotations: api.Annotations{Name: name, Labels: labels},
+		Data:        data,
+	}})
+	if err != nil {
+		return fmt.Errorf("failed to create config: %w", err)
+	}
+	fmt.Fprintln(out, resp.Config.ID)
+	return nil
+}
+
+func listConfigs(ctx context.Context, client api.ControlClient, out io.Writer, format string, quiet bool) error {
+	resp, err := client.ListConfigs(ctx, &api.ListConfigsRequest{})
+	if err != nil {
+		return fmt.Errorf("failed to list configs: %w", err)
+	}
+	objects := make([]objectInfo, 0, len(resp.Configs))
+	for _, c := range resp.Configs {
+		info := configInfo(c)
+		info.Data = ""
+		objects = append(objects, info)
+	}
+	return printObjects(out, "config", objects, format, quiet)
+}
+
+func inspectConfigs(ctx context.Context, client api.ControlClient, out io.Writer, refs []string) error {
+	objects := make([]objectInfo, 0, len(refs))
+	for _, ref := range refs {
+		c, err := resolveConfig(ctx, client, ref)
+		if err != nil {
+			return err
+		}
+		objects = append(objects, configInfo(c))
+	}
+	return printInspected(out, objects)
+}
+
+func removeConfigs(ctx context.Context, client api.ControlClient, out io.Writer, refs []string) error {
+	for _, ref := range refs {
+		c, err := resolveConfig(ctx, client, ref)
+		if err != nil {
+			return err
+		}
+		if _, err := client.RemoveConfig(ctx, &api.RemoveConfigRequest{ConfigID: c.ID}); err != nil {
+			return fmt.Errorf("failed to remove config %s: %w", ref, err)
+		}
+		fmt.Fprintf(out, "Config %s removed\n", c.Spec.Annotations.Name)
+	}
+	return nil
+}
+
+// resolveConfig finds a cluster config by name or ID
+func resolveConfig(ctx context.Context, client api.ControlClient, ref string) (*api.Config, error) {
+	resp, err := client.ListConfigs(ctx, &api.ListConfigsRequest{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list configs: %w", err)
+	}
+	for _, c := range resp.Configs {
+		if c.Spec.Annotations.Name == ref {
+			return c, nil
+		}
+	}
+	for _, c := range resp.Configs {
+		if c.ID == ref {
+			return c, nil
+		}
+	}
+	return nil, fmt.Errorf("config %s not found", ref)
+}
+
+// Local configuration helper functions
 
 func listConfig() error {
 	configDir := "/etc/swarmcracker"
@@ -11,6 +11,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/restuhaqza/swarmcracker/pkg/security"
 	"github.com/spf13/cobra"
 )
 
@@ -156,6 +157,7 @@ func runDoctor(cfg *doctorConfig) error {
 	report.Checks = append(report.Checks,
 		dc("Firecracker processes", "vms", checkDoctorFCProcs, cfg),
 		dc("VM state files", "vms", checkDoctorVMStates, cfg),
+		dc("Seccomp filters", "vms", checkDoctorSeccomp, cfg),
 	)
 
 	// Summarize
@@ -745,6 +747,41 @@ func checkDoctorVMStates() DoctorCheck {
 	return c
 }
 
+func checkDoctorSeccomp() DoctorCheck {
+	c := DoctorCheck{Status: "skip"}
+	out, err := exec.Command("pgrep", "-x", "firecracker").Output()
+	if err != nil {
+		c.Message = "no Firecracker processes running"
+		return c
+	}
+	pids := strings.Fields(string(out))
+	var unfiltered []string
+	for _, field := range pids {
+		pid, err := strconv.Atoi(field)
+		if err != nil {
+			continue
+		}
+		threads, err := security.UnfilteredThreads(pid)
+		if err != nil {
+			// The process exited
+			continue
+		}
+		for _, name := range threads {
+			unfiltered = append(unfiltered, fmt.Sprintf("%d/%s", pid, name))
+		}
+	}
+	if len(unfiltered) > 0 {
+		c.Status = "warning"
+		c.Message = fmt.Sprintf("%d Firecracker thread(s) without a seccomp filter", len(unfiltered))
+		c.Detail = strings.Join(unfiltered, ", ")
+		c.FixHint = "Filters are installed when a VM boots; never run Firecracker with --no-seccomp, and set executor.seccomp_filter to \"default\" or leave it empty"
+		return c
+	}
+	c.Status = "ok"
+	c.Message = fmt.Sprintf("all threads of %d Firecracker process(es) filtered", len(pids))
+	return c
+}
+
 // ── Helpers ──
 
 func getHostname() string {
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/restuhaqza/swarmcracker/pkg/events"
+	"github.com/spf13/cobra"
+)
+
+// newEventsCommand creates the events command
+func newEventsCommand() *cobra.Command {
+	var (
+		filters []string
+		since   string
+		format  string
+		follow  bool
+		socket  string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "events",
+		Short: "Show task lifecycle events",
+		Long: `Show task lifecycle events from the local swarmd-firecracker agent.
+
+Events cover image pulls, rootfs builds, network attachment, VM boot,
+first healthy response, stops, OOM kills, crashes and snapshots. The agent
+keeps the most recent events in memory; --follow keeps streaming new ones.
+
+Filters (repeatable):
+  service=<name|id>   task=<id>   node=<hostname>   type=<event type>
+
+Examples:
+  swarmcracker events
+  swarmcracker events --filter service=web --since 10m
+  swarmcracker events --filter type=vm.crash --filter type=vm.oom --follow
+  swarmcracker events --format json`,
+		PreRun: func(cmd *cobra.Command, args []string) {
+			setupLogging(logLevel)
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			filter, err := events.ParseFilter(filters)
+			if err != nil {
+				return err
+			}
+			if since != "" {
+				if filter.Since, err = events.ParseSince(since, time.Now()); err != nil {
+					return fmt.Errorf("invalid --since value: %w", err)
+				}
+			}
+			if socket == "" {
+				socket = eventsSocketPath()
+			}
+
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+			return streamEvents(ctx, cmd.OutOrStdout(), events.NewClient(socket), filter, follow, format)
+		},
+	}
+
+	cmd.Flags().StringArrayVar(&filters, "filter", nil, "Filter events (key=value; keys: service, task, node, type)")
+	cmd.Flags().StringVar(&since, "since", "", "Show events since a time (e.g., 10m, 2026-01-02T15:04:05Z)")
+	cmd.Flags().StringVar(&format, "format", "table", "Output format (table, json)")
+	cmd.Flags().BoolVarP(&follow, "follow", "f", false, "Stream new events as they happen")
+	cmd.Flags().StringVar(&socket, "socket", "", "Events API socket (default: agent.events_socket from config)")
+
+	return cmd
+}
+
+// eventsSocketPath returns the agent's events socket from the config file,
+// falling back to the default.
+func eventsSocketPath() string {
+	cfg, err := loadSnapshotConfig(cfgFile)
+	if err != nil || cfg.Agent.EventsSocket == "" {
+		return events.DefaultSocket
+	}
+	return cfg.Agent.EventsSocket
+}
+
+// streamEvents prints events from client, one per line
+func streamEvents(ctx context.Context, out io.Writer, client *events.Client, filter events.Filter, follow bool, format string) error {
+	asJSON := strings.ToLower(format) == "json"
+	enc := json.NewEncoder(out)
+
+	if !asJSON {
+		fmt.Fprintf(out, "%-24s %-18s %-14s %-16s %s\n", "TIME", "TYPE", "TASK", "SERVICE", "MESSAGE")
+	}
+
+	err := client.Stream(ctx, filter, follow, func(e events.Event) error {
+		if asJSON {
+			return enc.Encode(e)
+		}
+		_, err := fmt.Fprintf(out, "%-24s %-18s %-14s %-16s %s\n",
+			e.Time.Local().Format("2006-01-02 15:04:05.000"), e.Type, truncate(e.TaskID, 12),
+			truncate(e.Service, 16), eventSummary(e))
+		return err
+	})
+	if err != nil && ctx.Err() != nil {
+		return nil // interrupted while following
+	}
+	return err
+}
+
+// eventSummary is the message column: the message, its error and attributes
+func eventSummary(e events.Event) string {
+	var b strings.Builder
+	b.WriteString(e.Message)
+	if e.Error != "" {
+		fmt.Fprintf(&b, ": %s", e.Error)
+	}
+	for _, key := range []string{"image", "duration", "after", "exit_reason", "snapshot_id"} {
+		if v, ok := e.Attributes[key]; ok && !(key == "exit_reason" && v == e.Error) {
+			fmt.Fprintf(&b, " %s=%s", key, v)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/restuhaqza/swarmcracker/pkg/events"
+)
+
+// TestStreamEvents verifies table and JSON output from the events API
+func TestStreamEvents(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "events.sock")
+	bus := events.NewBus("node-1", 0)
+	srv := events.NewServer(bus, socket)
+	if err := srv.Start(); err != nil {
+		t.Fatalf("failed to start events server: %v", err)
+	}
+	defer srv.Close()
+
+	bus.Publish(events.Event{Type: events.VMBoot, TaskID: "task-1", Service: "web", Message: "VM booted"})
+	bus.Publish(events.Event{
+		Type: events.VMCrash, TaskID: "task-1", Service: "web", Message: "VM exited unexpectedly",
+		Error: "exit status 1", Attributes: map[string]string{"exit_reason": "exit status 1"},
+	})
+	bus.Publish(events.Event{Type: events.VMBoot, TaskID: "task-2", Service: "db", Message: "VM booted"})
+
+	client := events.NewClient(socket)
+	filter, err := events.ParseFilter([]string{"service=web"})
+	if err != nil {
+		t.Fatalf("ParseFilter() error = %v", err)
+	}
+
+	var out bytes.Buffer
+	if err := streamEvents(context.Background(), &out, client, filter, false, "table"); err != nil {
+		t.Fatalf("streamEvents() error = %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("Expected header and 2 events, got:\n%s", out.String())
+	}
+	if !strings.Contains(lines[2], "vm.crash") || !strings.Contains(lines[2], "VM exited unexpectedly: exit status 1") {
+		t.Errorf("Unexpected crash line: %s", lines[2])
+	}
+	if strings.Contains(lines[2], "exit_reason=") {
+		t.Errorf("Exit reason repeated in crash line: %s", lines[2])
+	}
+
+	out.Reset()
+	if err := streamEvents(context.Background(), &out, client, events.Filter{}, false, "json"); err != nil {
+		t.Fatalf("streamEvents() error = %v", err)
+	}
+	dec := json.NewDecoder(&out)
+	var got []events.Event
+	for dec.More() {
+		var e events.Event
+		if err := dec.Decode(&e); err != nil {
+			t.Fatalf("invalid JSON line: %v", err)
+		}
+		got = append(got, e)
+	}
+	if len(got) != 3 || got[2].Service != "db" || got[2].Node != "node-1" {
+		t.Errorf("Unexpected JSON events: %+v", got)
+	}
+}
+
+// TestStreamEvents_NoAgent verifies the error when the agent is not running
+func TestStreamEvents_NoAgent(t *testing.T) {
+	client := events.NewClient(filepath.Join(t.TempDir(), "missing.sock"))
+	var out bytes.Buffer
+	err := streamEvents(context.Background(), &out, client, events.Filter{}, false, "table")
+	if err == nil || !strings.Contains(err.Error(), "is swarmd-firecracker running") {
+		t.Errorf("Expected connection error, got %v", err)
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"os"
@@ -8,6 +9,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/restuhaqza/swarmcracker/pkg/balloon"
 	"github.com/restuhaqza/swarmcracker/pkg/metrics"
 	"github.com/restuhaqza/swarmcracker/pkg/runtime"
 	"github.com/spf13/cobra"
@@ -26,7 +28,8 @@ func newMetricsCommand() *cobra.Command {
 		Short: "Show VM resource usage metrics",
 		Long: `Display resource usage metrics for running microVMs.
 
-This command shows CPU, memory, and network metrics collected from the /proc filesystem.
+This command shows CPU, memory, and network metrics collected from the /proc filesystem,
+and the memory balloon size of VMs that have one (actual/target MB).
 Metrics can be displayed in table or JSON format.
 
 Example:
@@ -127,8 +130,19 @@ func collectAndDisplay(collector *metrics.Collector, stateMgr *runtime.StateMana
 
 	// Collect metrics for each VM
 	metricsList := make(map[string]*metrics.VMMetrics)
+	balloons := make(map[string]*balloon.Stats)
 	for _, vm := range targetVMs {
 		if vm.PID > 0 {
+			// Prefer the VM's own counters when Firecracker writes metrics
+			if vm.SocketPath != "" {
+				metricsPath := metrics.FirecrackerMetricsPath(vm.SocketPath)
+				if _, err := os.Stat(metricsPath); err == nil {
+					collector.WatchFirecrackerMetrics(vm.ID, metricsPath)
+				}
+			}
+			if stats := balloonStats(vm); stats != nil {
+				balloons[vm.ID] = stats
+			}
 			m, err := collector.Collect(vm.ID, vm.PID)
 			if err != nil {
 				// Don't fail entirely, just log
@@ -142,31 +156,54 @@ func collectAndDisplay(collector *metrics.Collector, stateMgr *runtime.StateMana
 	// Output based on format
 	switch strings.ToLower(metricsFormat) {
 	case "json":
-		return outputMetricsJSON(metricsList, targetVMs)
+		return outputMetricsJSON(metricsList, balloons, targetVMs)
 	default:
-		return outputMetricsTable(metricsList, targetVMs)
+		return outputMetricsTable(metricsList, balloons, targetVMs)
+	}
+}
+
+// balloonStats returns the balloon statistics of a VM, or nil if it has
+// no balloon or its API does not answer
+func balloonStats(vm *runtime.VMState) *balloon.Stats {
+	if vm.SocketPath == "" {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	stats, err := balloon.NewClient(vm.SocketPath).Stats(ctx)
+	if err != nil {
+		return nil
+	}
+	return stats
+}
+
+// formatBalloon formats a balloon as actual/target MB
+func formatBalloon(stats *balloon.Stats) string {
+	if stats == nil {
+		return "-"
 	}
+	return fmt.Sprintf("%d/%d", stats.ActualMiB, stats.TargetMiB)
 }
 
 // outputMetricsTable displays metrics in table format
-func outputMetricsTable(metricsList map[string]*metrics.VMMetrics, vms []*runtime.VMState) error {
+func outputMetricsTable(metricsList map[string]*metrics.VMMetrics, balloons map[string]*balloon.Stats, vms []*runtime.VMState) error {
 	if len(vms) == 0 {
 		fmt.Println("No VMs found.")
 		return nil
 	}
 
 	// Print header
-	fmt.Printf("%-20s %-10s %-12s %-12s %-12s %-12s\n",
-		"ID", "PID", "CPU (ms)", "MEM (MB)", "RX (bytes)", "TX (bytes)")
-	fmt.Println(strings.Repeat("-", 90))
+	fmt.Printf("%-20s %-10s %-12s %-12s %-14s %-12s %-12s\n",
+		"ID", "PID", "CPU (ms)", "MEM (MB)", "BALLOON (MB)", "RX (bytes)", "TX (bytes)")
+	fmt.Println(strings.Repeat("-", 105))
 
 	// Print each VM
 	for _, vm := range vms {
 		m, exists := metricsList[vm.ID]
 		if !exists {
 			// No metrics available
-			fmt.Printf("%-20s %-10d %-12s %-12s %-12s %-12s\n",
-				vm.ID, vm.PID, "N/A", "N/A", "N/A", "N/A")
+			fmt.Printf("%-20s %-10d %-12s %-12s %-14s %-12s %-12s\n",
+				vm.ID, vm.PID, "N/A", "N/A", formatBalloon(balloons[vm.ID]), "N/A", "N/A")
 			continue
 		}
 
@@ -177,8 +214,8 @@ func outputMetricsTable(metricsList map[string]*metrics.VMMetrics, vms []*runtim
 		txBytes := formatBytes(m.NetTxBytes)
 
 		// Print row
-		fmt.Printf("%-20s %-10d %-12s %-12s %-12s %-12s\n",
-			vm.ID, m.PID, cpuMs, memMB, rxBytes, txBytes)
+		fmt.Printf("%-20s %-10d %-12s %-12s %-14s %-12s %-12s\n",
+			vm.ID, m.PID, cpuMs, memMB, formatBalloon(balloons[vm.ID]), rxBytes, txBytes)
 	}
 
 	// Print summary
@@ -191,17 +228,19 @@ func outputMetricsTable(metricsList map[string]*metrics.VMMetrics, vms []*runtim
 }
 
 // outputMetricsJSON displays metrics in JSON format
-func outputMetricsJSON(metricsList map[string]*metrics.VMMetrics, vms []*runtime.VMState) error {
+func outputMetricsJSON(metricsList map[string]*metrics.VMMetrics, balloons map[string]*balloon.Stats, vms []*runtime.VMState) error {
 	// Combine VM state with metrics
 	type vmMetricsWithState struct {
 		*runtime.VMState
 		Metrics *metrics.VMMetrics `json:"metrics,omitempty"`
+		Balloon *balloon.Stats     `json:"balloon,omitempty"`
 	}
 
 	result := make([]vmMetricsWithState, 0, len(vms))
 	for _, vm := range vms {
 		item := vmMetricsWithState{
 			VMState: vm,
+			Balloon: balloons[vm.ID],
 		}
 		if m, exists := metricsList[vm.ID]; exists {
 			item.Metrics = m
@@ -1,9 +1,33 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/restuhaqza/swarmcracker/pkg/network"
+	"github.com/restuhaqza/swarmcracker/pkg/types"
 	"github.com/spf13/cobra"
 )
 
+// defaultNetworkStateDir is where swarmd-firecracker keeps network state
+const defaultNetworkStateDir = "/var/lib/swarmkit/network"
+
+// ipamStateFiles maps the allocator name shown to users to its state file
+var ipamStateFiles = []struct {
+	source string
+	file   string
+}{
+	{"node", "ipam.json"},
+	{"cni", "cni-ipam.json"},
+}
+
 // newNetworkCommand creates the network command group
 func newNetworkCommand() *cobra.Command {
 	cmd := &cobra.Command{
@@ -11,12 +35,13 @@ func newNetworkCommand() *cobra.Command {
 		Short: "Manage network configuration",
 		Long: `Manage network configuration for SwarmCracker.
 
-Provides commands for VXLAN overlay and bridge management.`,
+Provides commands for VXLAN overlay, bridge and IPAM management.`,
 	}
 
 	// Add subcommands
 	cmd.AddCommand(newNetworkVXLANCommand())
 	cmd.AddCommand(newNetworkBridgeCommand())
+	cmd.AddCommand(newNetworkIPAMCommand())
 
 	return cmd
 }
@@ -109,3 +134,131 @@ func newBridgeStatusCommand() *cobra.Command {
 		},
 	}
 }
+
+// newNetworkIPAMCommand creates the IPAM subcommand
+func newNetworkIPAMCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "ipam",
+		Short: "Inspect IP address management",
+		Long:  `Inspect the persisted IP pools of the node allocator and the CNI IPAM.`,
+	}
+
+	cmd.AddCommand(newIPAMListCommand())
+
+	return cmd
+}
+
+// newIPAMListCommand lists IP pools and their allocations
+func newIPAMListCommand() *cobra.Command {
+	var (
+		format   string
+		stateDir string
+	)
+
+	cmd := &cobra.Command{
+		Use:     "ls",
+		Aliases: []string{"list"},
+		Short:   "List IP pools, utilization and owners",
+		Long: `List the IP pools persisted by the node allocator (ipam.json) and the
+CNI IPAM (cni-ipam.json), with their utilization and the owner of every
+allocated address.
+
+Examples:
+  swarmcracker network ipam ls
+  swarmcracker network ipam ls --format json
+  swarmcracker network ipam ls --state-dir /var/lib/swarmcracker/network`,
+		PreRun: func(cmd *cobra.Command, args []string) {
+			setupLogging(logLevel)
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return listIPAM(cmd.OutOrStdout(), stateDir, format)
+		},
+	}
+
+	cmd.Flags().StringVar(&format, "format", "table", "Output format (table, json)")
+	cmd.Flags().StringVar(&stateDir, "state-dir", defaultNetworkStateDir, "Network state directory")
+
+	return cmd
+}
+
+// ipamPoolInfo is one pool as shown by "network ipam ls"
+type ipamPoolInfo struct {
+	Source string `json:"source"`
+	types.IPAMPool
+	Used     int     `json:"used"`
+	Capacity int     `json:"capacity"`
+	Percent  float64 `json:"utilization"`
+}
+
+// listIPAM prints the pools found in stateDir
+func listIPAM(out io.Writer, stateDir, format string) error {
+	var pools []ipamPoolInfo
+	for _, f := range ipamStateFiles {
+		path := filepath.Join(stateDir, f.file)
+		if _, err := os.Stat(path); err != nil {
+			continue
+		}
+		state, err := network.LoadIPAMState(path)
+		if err != nil {
+			return err
+		}
+		for _, pool := range state.Pools {
+			info := ipamPoolInfo{
+				Source:   f.source,
+				IPAMPool: pool,
+				Used:     len(pool.Allocations),
+				Capacity: pool.Capacity(),
+			}
+			if info.Capacity > 0 {
+				info.Percent = float64(info.Used) * 100 / float64(info.Capacity)
+			}
+			pools = append(pools, info)
+		}
+	}
+
+	if strings.ToLower(format) == "json" {
+		if pools == nil {
+			pools = []ipamPoolInfo{}
+		}
+		data, err := json.MarshalIndent(pools, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal JSON: %w", err)
+		}
+		fmt.Fprintln(out, string(data))
+		return nil
+	}
+
+	if len(pools) == 0 {
+		fmt.Fprintf(out, "No IPAM state found in %s.\n", stateDir)
+		return nil
+	}
+
+	for i, pool := range pools {
+		if i > 0 {
+			fmt.Fprintln(out)
+		}
+		fmt.Fprintf(out, "%-6s %-20s gateway %-16s %d/%d used (%.1f%%)\n",
+			pool.Source, pool.Subnet, pool.Gateway, pool.Used, pool.Capacity, pool.Percent)
+
+		ips := make([]string, 0, len(pool.Allocations))
+		for ip := range pool.Allocations {
+			ips = append(ips, ip)
+		}
+		sort.Slice(ips, func(a, b int) bool {
+			return compareIPs(ips[a], ips[b])
+		})
+		for _, ip := range ips {
+			fmt.Fprintf(out, "  %-18s %s\n", ip, pool.Allocations[ip])
+		}
+	}
+	return nil
+}
+
+// compareIPs orders addresses numerically, falling back to string order
+func compareIPs(a, b string) bool {
+	ipA, ipB := net.ParseIP(a), net.ParseIP(b)
+	if ipA == nil || ipB == nil {
+		return a < b
+	}
+	return bytes.Compare(ipA.To16(), ipB.To16()) < 0
+}
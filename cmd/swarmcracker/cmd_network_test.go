@@ -1,6 +1,11 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -16,6 +21,7 @@ func TestNetworkCommandStructure(t *testing.T) {
 	expectedCommands := []string{
 		"vxlan",
 		"bridge",
+		"ipam",
 	}
 
 	for _, cmd := range expectedCommands {
@@ -125,3 +131,62 @@ func TestVXLANPeersPlaceholder(t *testing.T) {
 		t.Logf("listVXLANPeers placeholder returned error (expected): %v", err)
 	}
 }
+
+// TestIPAMListCommand verifies the ipam ls command and its output
+func TestIPAMListCommand(t *testing.T) {
+	cmd := newIPAMListCommand()
+	if cmd.Name() != "ls" {
+		t.Errorf("Expected command name 'ls', got '%s'", cmd.Name())
+	}
+	for _, flag := range []string{"format", "state-dir"} {
+		if cmd.Flags().Lookup(flag) == nil {
+			t.Errorf("Expected flag '%s' not found", flag)
+		}
+	}
+
+	dir := t.TempDir()
+	state := `{"pools":[{"subnet":"192.168.127.0/24","gateway":"192.168.127.1","reserved":["192.168.127.1"],` +
+		`"allocations":{"192.168.127.20":"task-b","192.168.127.3":"task-a"}}]}`
+	if err := os.WriteFile(filepath.Join(dir, "ipam.json"), []byte(state), 0640); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	if err := listIPAM(&out, dir, "table"); err != nil {
+		t.Fatalf("listIPAM failed: %v", err)
+	}
+	table := out.String()
+	if !strings.Contains(table, "2/253 used (0.8%)") {
+		t.Errorf("Expected utilization in output, got:\n%s", table)
+	}
+	if strings.Index(table, "task-a") > strings.Index(table, "task-b") {
+		t.Errorf("Expected allocations sorted by IP, got:\n%s", table)
+	}
+
+	out.Reset()
+	if err := listIPAM(&out, dir, "json"); err != nil {
+		t.Fatalf("listIPAM failed: %v", err)
+	}
+	var pools []ipamPoolInfo
+	if err := json.Unmarshal(out.Bytes(), &pools); err != nil {
+		t.Fatalf("Invalid JSON output: %v", err)
+	}
+	if len(pools) != 1 || pools[0].Source != "node" || pools[0].Used != 2 || pools[0].Capacity != 253 {
+		t.Errorf("Unexpected pools: %+v", pools)
+	}
+
+	out.Reset()
+	if err := listIPAM(&out, t.TempDir(), "table"); err != nil {
+		t.Fatalf("listIPAM failed: %v", err)
+	}
+	if !strings.Contains(out.String(), "No IPAM state found") {
+		t.Errorf("Expected empty message, got: %s", out.String())
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "cni-ipam.json"), []byte("{"), 0640); err != nil {
+		t.Fatal(err)
+	}
+	if err := listIPAM(&out, dir, "table"); err == nil {
+		t.Error("Expected error for corrupt state file")
+	}
+}
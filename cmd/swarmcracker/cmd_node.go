@@ -6,9 +6,11 @@ import (
 	"crypto/x509"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"time"
 
@@ -34,6 +36,7 @@ draining, and removing nodes.`,
 	cmd.AddCommand(newNodeInspectCommand())
 	cmd.AddCommand(newNodeDrainCommand())
 	cmd.AddCommand(newNodeActivateCommand())
+	cmd.AddCommand(newNodeUpdateCommand())
 	cmd.AddCommand(newNodePromoteCommand())
 	cmd.AddCommand(newNodeRemoveCommand())
 
@@ -141,6 +144,42 @@ An activated node can receive new tasks.`,
 	return cmd
 }
 
+// newNodeUpdateCommand creates the node update command
+func newNodeUpdateCommand() *cobra.Command {
+	var (
+		labelAdd []string
+		labelRm  []string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "update <node-id>",
+		Short: "Update a node's labels",
+		Long: `Add or remove a node's labels.
+
+Node labels are set by operators and used in placement constraints and
+preferences, e.g. --constraint node.labels.kvm==true.`,
+		Example: `  swarmcracker node update worker-1 --label-add kvm=true --label-add rack=r1
+  swarmcracker node update worker-1 --label-rm rack`,
+		Args: cobra.ExactArgs(1),
+		PreRun: func(cmd *cobra.Command, args []string) {
+			setupLogging(logLevel)
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(labelAdd) == 0 && len(labelRm) == 0 {
+				return fmt.Errorf("nothing to update: use --label-add or --label-rm")
+			}
+			return withSwarmClient(func(ctx context.Context, client api.ControlClient) error {
+				return updateNodeLabels(ctx, client, cmd.OutOrStdout(), args[0], labelAdd, labelRm)
+			})
+		},
+	}
+
+	cmd.Flags().StringArrayVar(&labelAdd, "label-add", nil, "Add or update a node label (key=value)")
+	cmd.Flags().StringArrayVar(&labelRm, "label-rm", nil, "Remove a node label")
+
+	return cmd
+}
+
 // newNodePromoteCommand creates the node promote command
 func newNodePromoteCommand() *cobra.Command {
 	cmd := &cobra.Command{
@@ -322,6 +361,15 @@ func inspectNode(nodeID, format string, pretty bool) error {
 		fmt.Printf("Role: %s\n", resp.Node.Spec.DesiredRole.String())
 		fmt.Printf("Status: %s\n", resp.Node.Status.State.String())
 		fmt.Printf("Availability: %s\n", resp.Node.Spec.Availability.String())
+		labels := resp.Node.Spec.Annotations.Labels
+		keys := make([]string, 0, len(labels))
+		for k := range labels {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			fmt.Printf("Label: %s=%s\n", k, labels[k])
+		}
 	}
 
 	return nil
@@ -358,6 +406,62 @@ func setNodeAvailability(nodeID string, availability api.NodeSpec_Availability)
 	return nil
 }
 
+// updateNodeLabels removes and then adds labels on a node's spec
+func updateNodeLabels(ctx context.Context, client api.ControlClient, out io.Writer, ref string, add, rm []string) error {
+	node, err := resolveNode(ctx, client, ref)
+	if err != nil {
+		return err
+	}
+
+	spec := node.Spec.Copy()
+	for _, key := range rm {
+		if _, ok := spec.Annotations.Labels[key]; !ok {
+			return fmt.Errorf("label %s not found on node %s", key, ref)
+		}
+		delete(spec.Annotations.Labels, key)
+	}
+	for _, l := range add {
+		key, value, _ := strings.Cut(l, "=")
+		if key == "" {
+			return fmt.Errorf("invalid label %q", l)
+		}
+		if spec.Annotations.Labels == nil {
+			spec.Annotations.Labels = map[string]string{}
+		}
+		spec.Annotations.Labels[key] = value
+	}
+
+	if _, err := client.UpdateNode(ctx, &api.UpdateNodeRequest{
+		NodeID:      node.ID,
+		NodeVersion: &node.Meta.Version,
+		Spec:        spec,
+	}); err != nil {
+		return fmt.Errorf("failed to update node: %w", err)
+	}
+
+	fmt.Fprintf(out, "Node %s updated\n", ref)
+	return nil
+}
+
+// resolveNode finds a node by ID or hostname
+func resolveNode(ctx context.Context, client api.ControlClient, ref string) (*api.Node, error) {
+	resp, err := client.GetNode(ctx, &api.GetNodeRequest{NodeID: ref})
+	if err == nil {
+		return resp.Node, nil
+	}
+
+	listResp, listErr := client.ListNodes(ctx, &api.ListNodesRequest{})
+	if listErr != nil {
+		return nil, fmt.Errorf("failed to get node: %w", err)
+	}
+	for _, n := range listResp.Nodes {
+		if n.Description != nil && n.Description.Hostname == ref || n.Spec.Annotations.Name == ref {
+			return n, nil
+		}
+	}
+	return nil, fmt.Errorf("node %s not found", ref)
+}
+
 func promoteNode(nodeID string) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
@@ -1,7 +1,11 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"testing"
+
+	"github.com/moby/swarmkit/v2/api"
 )
 
 // TestNodeCommandStructure verifies that all node commands are properly registered
@@ -18,6 +22,7 @@ func TestNodeCommandStructure(t *testing.T) {
 		"inspect",
 		"drain",
 		"activate",
+		"update",
 		"promote",
 		"rm",
 	}
@@ -97,3 +102,40 @@ func TestNodeRemoveCommand(t *testing.T) {
 		t.Errorf("Expected command name 'rm', got '%s'", cmd.Name())
 	}
 }
+
+// TestUpdateNodeLabels verifies adding and removing node labels by ID or hostname
+func TestUpdateNodeLabels(t *testing.T) {
+	ctx := context.Background()
+	f := newFakeControl()
+	f.nodes["n1"] = &api.Node{
+		ID:          "n1",
+		Description: &api.NodeDescription{Hostname: "worker-1"},
+		Spec:        api.NodeSpec{Annotations: api.Annotations{Labels: map[string]string{"rack": "r1"}}},
+	}
+
+	var out bytes.Buffer
+	if err := updateNodeLabels(ctx, f, &out, "worker-1", []string{"kvm=true", "rack=r2"}, nil); err != nil {
+		t.Fatalf("updateNodeLabels failed: %v", err)
+	}
+	labels := f.nodes["n1"].Spec.Annotations.Labels
+	if labels["kvm"] != "true" || labels["rack"] != "r2" {
+		t.Errorf("Expected kvm=true and rack=r2, got %v", labels)
+	}
+
+	if err := updateNodeLabels(ctx, f, &out, "n1", nil, []string{"rack"}); err != nil {
+		t.Fatalf("updateNodeLabels failed: %v", err)
+	}
+	if _, ok := f.nodes["n1"].Spec.Annotations.Labels["rack"]; ok {
+		t.Error("Expected rack label to be removed")
+	}
+
+	if err := updateNodeLabels(ctx, f, &out, "n1", nil, []string{"missing"}); err == nil {
+		t.Error("Expected error removing a label the node does not have")
+	}
+	if err := updateNodeLabels(ctx, f, &out, "n1", []string{"=x"}, nil); err == nil {
+		t.Error("Expected error for a label without a key")
+	}
+	if err := updateNodeLabels(ctx, f, &out, "nope", []string{"a=b"}, nil); err == nil {
+		t.Error("Expected error for an unknown node")
+	}
+}
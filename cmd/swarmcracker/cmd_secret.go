@@ -0,0 +1,459 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	gogotypes "github.com/gogo/protobuf/types"
+	"github.com/moby/swarmkit/v2/api"
+	"github.com/spf13/cobra"
+)
+
+// newSecretCommand creates the secret command group
+func newSecretCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "secret",
+		Short: "Manage cluster secrets",
+		Long: `Manage secrets stored in the SwarmKit cluster.
+
+Secrets are encrypted in the cluster store and only sent to nodes running
+tasks that use them. Their contents are never printed.`,
+	}
+
+	cmd.AddCommand(newSecretCreateCommand())
+	cmd.AddCommand(newSecretListCommand())
+	cmd.AddCommand(newSecretInspectCommand())
+	cmd.AddCommand(newSecretRemoveCommand())
+
+	return cmd
+}
+
+// newSecretCreateCommand creates a secret
+func newSecretCreateCommand() *cobra.Command {
+	var labels []string
+
+	cmd := &cobra.Command{
+		Use:   "create <name> <file|->",
+		Short: "Create a secret from a file or stdin",
+		Example: `  swarmcracker secret create db_password ./db_password.txt
+  printf 's3cret' | swarmcracker secret create db_password -`,
+		Args: cobra.ExactArgs(2),
+		PreRun: func(cmd *cobra.Command, args []string) {
+			setupLogging(logLevel)
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			data, err := readObjectData(args[1], cmd.InOrStdin())
+			if err != nil {
+				return err
+			}
+			return withSwarmClient(func(ctx context.Context, client api.ControlClient) error {
+				return createSecret(ctx, client, cmd.OutOrStdout(), args[0], data, parseLabels(labels))
+			})
+		},
+	}
+
+	cmd.Flags().StringArrayVarP(&labels, "label", "l", nil, "Secret labels (e.g., key=value)")
+
+	return cmd
+}
+
+// newSecretListCommand lists secrets
+func newSecretListCommand() *cobra.Command {
+	var (
+		format string
+		quiet  bool
+	)
+
+	cmd := &cobra.Command{
+		Use:     "ls",
+		Aliases: []string{"list"},
+		Short:   "List secrets",
+		PreRun: func(cmd *cobra.Command, args []string) {
+			setupLogging(logLevel)
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return withSwarmClient(func(ctx context.Context, client api.ControlClient) error {
+				return listSecrets(ctx, client, cmd.OutOrStdout(), format, quiet)
+			})
+		},
+	}
+
+	cmd.Flags().StringVar(&format, "format", "table", "Output format (table, json)")
+	cmd.Flags().BoolVarP(&quiet, "quiet", "q", false, "Only display IDs")
+
+	return cmd
+}
+
+// newSecretInspectCommand shows secrets' metadata
+func newSecretInspectCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "inspect <secret>...",
+		Short: "Show secret details",
+		Long:  `Show the metadata of one or more secrets, by name or ID. The contents are not shown.`,
+		Args:  cobra.MinimumNArgs(1),
+		PreRun: func(cmd *cobra.Command, args []string) {
+			setupLogging(logLevel)
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return withSwarmClient(func(ctx context.Context, client api.ControlClient) error {
+				return inspectSecrets(ctx, client, cmd.OutOrStdout(), args)
+			})
+		},
+	}
+
+	return cmd
+}
+
+// newSecretRemoveCommand removes secrets
+func newSecretRemoveCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "rm <secret>...",
+		Aliases: []string{"remove"},
+		Short:   "Remove secrets",
+		Long:    `Remove one or more secrets, by name or ID. Secrets in use by a service cannot be removed.`,
+		Args:    cobra.MinimumNArgs(1),
+		PreRun: func(cmd *cobra.Command, args []string) {
+			setupLogging(logLevel)
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return withSwarmClient(func(ctx context.Context, client api.ControlClient) error {
+				return removeSecrets(ctx, client, cmd.OutOrStdout(), args)
+			})
+		},
+	}
+
+	return cmd
+}
+
+// withSwarmClient runs fn with a control API client and a request timeout
+func withSwarmClient(fn func(ctx context.Context, client api.ControlClient) error) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	client, conn, err := getSwarmClient()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	return fn(ctx, client)
+}
+
+// readObjectData reads a secret's or config's contents from a file, or
+// from in if path is "-"
+func readObjectData(path string, in io.Reader) ([]byte, error) {
+	var (
+		data []byte
+		err  error
+	)
+	if path == "-" {
+		data, err = io.ReadAll(in)
+	} else {
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read data: %w", err)
+	}
+	if len(data) == 0 {
+		return nil, fmt.Errorf("no data given")
+	}
+	return data, nil
+}
+
+// objectInfo is the metadata of a secret or config shown by ls and inspect
+type objectInfo struct {
+	ID        string            `json:"id"`
+	Name      string            `json:"name"`
+	Labels    map[string]string `json:"labels,omitempty"`
+	CreatedAt time.Time         `json:"created_at"`
+	UpdatedAt time.Time         `json:"updated_at"`
+	// Data is only set for configs
+	Data string `json:"data,omitempty"`
+}
+
+func newObjectInfo(id string, meta api.Meta, annotations api.Annotations) objectInfo {
+	info := objectInfo{ID: id, Name: annotations.Name, Labels: annotations.Labels}
+	if meta.CreatedAt != nil {
+		info.CreatedAt, _ = gogotypes.TimestampFromProto(meta.CreatedAt)
+	}
+	if meta.UpdatedAt != nil {
+		info.UpdatedAt, _ = gogotypes.TimestampFromProto(meta.UpdatedAt)
+	}
+	return info
+}
+
+func secretInfo(s *api.Secret) objectInfo {
+	return newObjectInfo(s.ID, s.Meta, s.Spec.Annotations)
+}
+
+// printObjects prints secrets or configs as a table or JSON
+func printObjects(out io.Writer, kind string, objects []objectInfo, format string, quiet bool) error {
+	sort.Slice(objects, func(i, j int) bool { return objects[i].Name < objects[j].Name })
+
+	if format == "json" {
+		data, err := json.MarshalIndent(objects, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal JSON: %w", err)
+		}
+		fmt.Fprintln(out, string(data))
+		return nil
+	}
+
+	if quiet {
+		for _, o := range objects {
+			fmt.Fprintln(out, o.ID)
+		}
+		return nil
+	}
+
+	if len(objects) == 0 {
+		fmt.Fprintf(out, "No %ss found\n", kind)
+		return nil
+	}
+
+	fmt.Fprintf(out, "%-26s %-30s %s\n", "ID", "NAME", "CREATED")
+	for _, o := range objects {
+		created := ""
+		if !o.CreatedAt.IsZero() {
+			created = o.CreatedAt.Local().Format("2006-01-02 15:04:05")
+		}
+		fmt.Fprintf(out, "%-26s %-30s %s\n", o.ID, o.Name, created)
+	}
+	return nil
+}
+
+// printInspected prints inspected secrets or configs as JSON
+func printInspected(out io.Writer, objects []objectInfo) error {
+	data, err := json.MarshalIndent(objects, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal JSON: %w", err)
+	}
+	fmt.Fprintln(out, string(data))
+	return nil
+}
+
+// createSecret creates a secret and prints its ID
+func createSecret(ctx context.Context, client api.ControlClient, out io.Writer, name string, data []byte, labels map[string]string) error {
+	resp, err := client.CreateSecret(ctx, &api.CreateSecretRequest{Spec: &api.SecretSpec{
+		Annotations: api.Annotations{Name: name, Labels: labels},
+		Data:        data,
+	}})
+	if err != nil {
+		return fmt.Errorf("failed to create secret: %w", err)
+	}
+	fmt.Fprintln(out, resp.Secret.ID)
+	return nil
+}
+
+func listSecrets(ctx context.Context, client api.ControlClient, out io.Writer, format string, quiet bool) error {
+	resp, err := client.ListSecrets(ctx, &api.ListSecretsRequest{})
+	if err != nil {
+		return fmt.Errorf("failed to list secrets: %w", err)
+	}
+	objects := make([]objectInfo, 0, len(resp.Secrets))
+	for _, s := range resp.Secrets {
+		objects = append(objects, secretInfo(s))
+	}
+	return printObjects(out, "secret", objects, format, quiet)
+}
+
+func inspectSecrets(ctx context.Context, client api.ControlClient, out io.Writer, refs []string) error {
+	objects := make([]objectInfo, 0, len(refs))
+	for _, ref := range refs {
+		s, err := resolveSecret(ctx, client, ref)
+		if err != nil {
+			return err
+		}
+		objects = append(objects, secretInfo(s))
+	}
+	return printInspected(out, objects)
+}
+
+func removeSecrets(ctx context.Context, client api.ControlClient, out io.Writer, refs []string) error {
+	for _, ref := range refs {
+		s, err := resolveSecret(ctx, client, ref)
+		if err != nil {
+			return err
+		}
+		if _, err := client.RemoveSecret(ctx, &api.RemoveSecretRequest{SecretID: s.ID}); err != nil {
+			return fmt.Errorf("failed to remove secret %s: %w", ref, err)
+		}
+		fmt.Fprintf(out, "Secret %s removed\n", s.Spec.Annotations.Name)
+	}
+	return nil
+}
+
+// resolveSecret finds a secret by name or ID
+func resolveSecret(ctx context.Context, client api.ControlClient, ref string) (*api.Secret, error) {
+	resp, err := client.ListSecrets(ctx, &api.ListSecretsRequest{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list secrets: %w", err)
+	}
+	for _, s := range resp.Secrets {
+		if s.Spec.Annotations.Name == ref {
+			return s, nil
+		}
+	}
+	for _, s := range resp.Secrets {
+		if s.ID == ref {
+			return s, nil
+		}
+	}
+	return nil, fmt.Errorf("secret %s not found", ref)
+}
+
+// parseFileRef parses a --secret or --config value: the source name alone,
+// or comma separated key=value fields source (or src), target, uid, gid
+// and mode (octal), where a leading field without a key is the source
+func parseFileRef(value string) (composeFileRef, error) {
+	var ref composeFileRef
+	for i, field := range strings.Split(value, ",") {
+		key, val, ok := strings.Cut(field, "=")
+		if !ok {
+			if i == 0 {
+				ref.Source = field
+				continue
+			}
+			return ref, fmt.Errorf("invalid field %q in %q", field, value)
+		}
+		switch strings.ToLower(strings.TrimSpace(key)) {
+		case "source", "src":
+			ref.Source = val
+		case "target":
+			ref.Target = val
+		case "uid":
+			ref.UID = val
+		case "gid":
+			ref.GID = val
+		case "mode":
+			mode, err := strconv.ParseUint(val, 8, 32)
+			if err != nil {
+				return ref, fmt.Errorf("invalid mode %q in %q", val, value)
+			}
+			m := uint32(mode)
+			ref.Mode = &m
+		default:
+			return ref, fmt.Errorf("unknown field %q in %q", key, value)
+		}
+	}
+	if ref.Source == "" {
+		return ref, fmt.Errorf("no source in %q", value)
+	}
+	return ref, nil
+}
+
+// secretReferences resolves --secret values to the service's references
+func secretReferences(ctx context.Context, client api.ControlClient, values []string) ([]*api.SecretReference, error) {
+	var refs []*api.SecretReference
+	for _, value := range values {
+		ref, err := parseFileRef(value)
+		if err != nil {
+			return nil, fmt.Errorf("--secret: %w", err)
+		}
+		s, err := resolveSecret(ctx, client, ref.Source)
+		if err != nil {
+			return nil, err
+		}
+		refs = append(refs, &api.SecretReference{
+			SecretID:   s.ID,
+			SecretName: s.Spec.Annotations.Name,
+			Target:     &api.SecretReference_File{File: ref.fileTarget("/run/secrets/")},
+		})
+	}
+	return refs, nil
+}
+
+// configReferences resolves --config values to the service's references
+func configReferences(ctx context.Context, client api.ControlClient, values []string) ([]*api.ConfigReference, error) {
+	var refs []*api.ConfigReference
+	for _, value := range values {
+		ref, err := parseFileRef(value)
+		if err != nil {
+			return nil, fmt.Errorf("--config: %w", err)
+		}
+		c, err := resolveConfig(ctx, client, ref.Source)
+		if err != nil {
+			return nil, err
+		}
+		refs = append(refs, &api.ConfigReference{
+			ConfigID:   c.ID,
+			ConfigName: c.Spec.Annotations.Name,
+			Target:     &api.ConfigReference_File{File: ref.fileTarget("/")},
+		})
+	}
+	return refs, nil
+}
+
+// updateFileReferences applies --secret-rm/--config-rm and then
+// --secret-add/--config-add to a service's container. A removal matches a
+// reference by secret or config name or ID; an addition replaces any
+// reference to the same secret or config.
+func updateFileReferences(ctx context.Context, client api.ControlClient, spec *api.ServiceSpec, secretAdd, secretRm, configAdd, configRm []string) error {
+	if len(secretAdd)+len(secretRm)+len(configAdd)+len(configRm) == 0 {
+		return nil
+	}
+	container := spec.Task.GetContainer()
+	if container == nil {
+		return fmt.Errorf("service has no container to expose secrets or configs to")
+	}
+
+	addedSecrets, err := secretReferences(ctx, client, secretAdd)
+	if err != nil {
+		return err
+	}
+	addedConfigs, err := configReferences(ctx, client, configAdd)
+	if err != nil {
+		return err
+	}
+
+	secrets := container.Secrets[:0:0]
+	for _, ref := range container.Secrets {
+		if containsAny(secretRm, ref.SecretName, ref.SecretID) {
+			continue
+		}
+		replaced := false
+		for _, added := range addedSecrets {
+			replaced = replaced || added.SecretID == ref.SecretID
+		}
+		if !replaced {
+			secrets = append(secrets, ref)
+		}
+	}
+	container.Secrets = append(secrets, addedSecrets...)
+
+	configs := container.Configs[:0:0]
+	for _, ref := range container.Configs {
+		if containsAny(configRm, ref.ConfigName, ref.ConfigID) {
+			continue
+		}
+		replaced := false
+		for _, added := range addedConfigs {
+			replaced = replaced || added.ConfigID == ref.ConfigID
+		}
+		if !replaced {
+			configs = append(configs, ref)
+		}
+	}
+	container.Configs = append(configs, addedConfigs...)
+
+	return nil
+}
+
+// containsAny reports whether list holds any of values
+func containsAny(list []string, values ...string) bool {
+	for _, l := range list {
+		for _, v := range values {
+			if l == v {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/moby/swarmkit/v2/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewSecretCommand(t *testing.T) {
+	cmd := newSecretCommand()
+	assert.Equal(t, "secret", cmd.Use)
+
+	names := map[string]bool{}
+	for _, sub := range cmd.Commands() {
+		names[sub.Name()] = true
+	}
+	assert.Equal(t, map[string]bool{"create": true, "ls": true, "inspect": true, "rm": true}, names)
+}
+
+func TestNewConfigCommand_Subcommands(t *testing.T) {
+	cmd := newConfigCommand()
+
+	names := map[string]bool{}
+	for _, sub := range cmd.Commands() {
+		names[sub.Name()] = true
+	}
+	assert.Equal(t, map[string]bool{
+		"create": true, "ls": true, "inspect": true, "rm": true,
+		"files": true, "validate": true, "migrate": true,
+	}, names)
+}
+
+func TestReadObjectData(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "password")
+	require.NoError(t, os.WriteFile(path, []byte("from-file"), 0600))
+
+	data, err := readObjectData(path, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "from-file", string(data))
+
+	data, err = readObjectData("-", strings.NewReader("from-stdin"))
+	require.NoError(t, err)
+	assert.Equal(t, "from-stdin", string(data))
+
+	_, err = readObjectData("-", strings.NewReader(""))
+	assert.Error(t, err)
+
+	_, err = readObjectData(filepath.Join(t.TempDir(), "missing"), nil)
+	assert.Error(t, err)
+}
+
+func TestSecretLifecycle(t *testing.T) {
+	ctx := context.Background()
+	f := newFakeControl()
+
+	var out bytes.Buffer
+	require.NoError(t, createSecret(ctx, f, &out, "db_password", []byte("hunter2"), map[string]string{"env": "prod"}))
+	id := strings.TrimSpace(out.String())
+	assert.Equal(t, "hunter2", string(f.secrets[id].Spec.Data))
+
+	out.Reset()
+	require.NoError(t, listSecrets(ctx, f, &out, "table", false))
+	assert.Contains(t, out.String(), "db_password")
+	assert.NotContains(t, out.String(), "hunter2")
+
+	out.Reset()
+	require.NoError(t, listSecrets(ctx, f, &out, "table", true))
+	assert.Equal(t, id+"\n", out.String())
+
+	// Inspect by name and by ID shows metadata but never the contents
+	for _, ref := range []string{"db_password", id} {
+		out.Reset()
+		require.NoError(t, inspectSecrets(ctx, f, &out, []string{ref}))
+		assert.NotContains(t, out.String(), "hunter2")
+		assert.NotContains(t, out.String(), `"data"`)
+
+		var info []objectInfo
+		require.NoError(t, json.Unmarshal(out.Bytes(), &info))
+		require.Len(t, info, 1)
+		assert.Equal(t, id, info[0].ID)
+		assert.Equal(t, map[string]string{"env": "prod"}, info[0].Labels)
+	}
+
+	assert.Error(t, inspectSecrets(ctx, f, &out, []string{"missing"}))
+
+	out.Reset()
+	require.NoError(t, removeSecrets(ctx, f, &out, []string{"db_password"}))
+	assert.Empty(t, f.secrets)
+	assert.Contains(t, out.String(), "Secret db_password removed")
+}
+
+func TestConfigLifecycle(t *testing.T) {
+	ctx := context.Background()
+	f := newFakeControl()
+
+	var out bytes.Buffer
+	require.NoError(t, createConfig(ctx, f, &out, "nginx_conf", []byte("worker_processes 1;"), nil))
+
+	out.Reset()
+	require.NoError(t, listConfigs(ctx, f, &out, "json", false))
+	assert.Contains(t, out.String(), "nginx_conf")
+	assert.NotContains(t, out.String(), "worker_processes", "ls does not print contents")
+
+	out.Reset()
+	require.NoError(t, inspectConfigs(ctx, f, &out, []string{"nginx_conf"}))
+	assert.Contains(t, out.String(), "worker_processes 1;", "configs are not secret")
+
+	out.Reset()
+	require.NoError(t, removeConfigs(ctx, f, &out, []string{"nginx_conf"}))
+	assert.Empty(t, f.configs)
+}
+
+func TestParseFileRef(t *testing.T) {
+	mode := func(m uint32) *uint32 { return &m }
+
+	tests := []struct {
+		name    string
+		value   string
+		want    composeFileRef
+		wantErr bool
+	}{
+		{"name only", "db_password", composeFileRef{Source: "db_password"}, false},
+		{"long form", "source=db_password,target=pg_pass,uid=70,gid=70,mode=0400",
+			composeFileRef{Source: "db_password", Target: "pg_pass", UID: "70", GID: "70", Mode: mode(0400)}, false},
+		{"src alias", "src=tls_key,target=/etc/tls/key.pem", composeFileRef{Source: "tls_key", Target: "/etc/tls/key.pem"}, false},
+		{"bare source then fields", "db_password,mode=440", composeFileRef{Source: "db_password", Mode: mode(0440)}, false},
+		{"no source", "target=pg_pass", composeFileRef{}, true},
+		{"bad mode", "db_password,mode=999", composeFileRef{}, true},
+		{"unknown field", "db_password,owner=root", composeFileRef{}, true},
+		{"bare field after first", "db_password,pg_pass", composeFileRef{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseFileRef(tt.value)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestUpdateFileReferences(t *testing.T) {
+	ctx := context.Background()
+	f := newFakeControl()
+	var out bytes.Buffer
+	require.NoError(t, createSecret(ctx, f, &out, "db_password_v1", []byte("old"), nil))
+	require.NoError(t, createSecret(ctx, f, &out, "db_password_v2", []byte("new"), nil))
+	require.NoError(t, createSecret(ctx, f, &out, "api_key", []byte("key"), nil))
+	require.NoError(t, createConfig(ctx, f, &out, "nginx_conf", []byte("conf"), nil))
+
+	spec := &api.ServiceSpec{Task: api.TaskSpec{Runtime: &api.TaskSpec_Container{Container: &api.ContainerSpec{}}}}
+
+	// Service create
+	require.NoError(t, updateFileReferences(ctx, f, spec,
+		[]string{"source=db_password_v1,target=db_password", "api_key,mode=0400"}, nil,
+		[]string{"source=nginx_conf,target=/etc/nginx/nginx.conf"}, nil))
+
+	container := spec.Task.GetContainer()
+	require.Len(t, container.Secrets, 2)
+	assert.Equal(t, "db_password_v1", container.Secrets[0].SecretName)
+	assert.Equal(t, "/run/secrets/db_password", container.Secrets[0].GetFile().Name)
+	assert.Equal(t, "/run/secrets/api_key", container.Secrets[1].GetFile().Name)
+	assert.Equal(t, os.FileMode(0400), container.Secrets[1].GetFile().Mode)
+	require.Len(t, container.Configs, 1)
+	assert.Equal(t, "/etc/nginx/nginx.conf", container.Configs[0].GetFile().Name)
+
+	// Rotation: the old secret is removed and the new one takes its target
+	require.NoError(t, updateFileReferences(ctx, f, spec,
+		[]string{"source=db_password_v2,target=db_password"}, []string{"db_password_v1"},
+		nil, []string{"nginx_conf"}))
+
+	require.Len(t, container.Secrets, 2)
+	assert.Equal(t, "api_key", container.Secrets[0].SecretName)
+	assert.Equal(t, "db_password_v2", container.Secrets[1].SecretName)
+	assert.Equal(t, "/run/secrets/db_password", container.Secrets[1].GetFile().Name)
+	assert.Empty(t, container.Configs)
+
+	// Adding a secret again replaces its reference
+	require.NoError(t, updateFileReferences(ctx, f, spec, []string{"api_key,mode=0440"}, nil, nil, nil))
+	require.Len(t, container.Secrets, 2)
+	assert.Equal(t, os.FileMode(0440), container.Secrets[1].GetFile().Mode)
+
+	assert.Error(t, updateFileReferences(ctx, f, spec, []string{"missing"}, nil, nil, nil))
+}
+
+func TestServiceCommands_SecretFlags(t *testing.T) {
+	create := newServiceCreateCommand()
+	assert.NotNil(t, create.Flags().Lookup("secret"))
+	assert.NotNil(t, create.Flags().Lookup("config"))
+
+	update := newServiceUpdateCommand()
+	for _, name := range []string{"secret-add", "secret-rm", "config-add", "config-rm"} {
+		assert.NotNil(t, update.Flags().Lookup(name), name)
+	}
+}
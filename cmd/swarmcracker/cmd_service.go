@@ -8,11 +8,16 @@ import (
 	"fmt"
 	"net"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"strings"
 	"time"
 
 	"github.com/moby/swarmkit/v2/api"
+	"github.com/moby/swarmkit/v2/api/genericresource"
+	"github.com/moby/swarmkit/v2/manager/constraint"
+	"github.com/restuhaqza/swarmcracker/pkg/hostinfo"
+	"github.com/restuhaqza/swarmcracker/pkg/kernel"
 	"github.com/spf13/cobra"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials"
@@ -34,6 +39,7 @@ Services are replicated sets of VMs that can be scaled and updated.`,
 	cmd.AddCommand(newServicePSCommand())
 	cmd.AddCommand(newServiceCreateCommand())
 	cmd.AddCommand(newServiceUpdateCommand())
+	cmd.AddCommand(newServiceRollbackCommand())
 	cmd.AddCommand(newServiceScaleCommand())
 	cmd.AddCommand(newServiceRemoveCommand())
 
@@ -133,15 +139,24 @@ func newServicePSCommand() *cobra.Command {
 // newServiceCreateCommand creates a service
 func newServiceCreateCommand() *cobra.Command {
 	var (
-		name     string
-		image    string
-		replicas uint64
-		cpu      float64
-		memory   string
-		env      []string
-		command  []string
-		args     []string
-		labels   []string
+		name           string
+		image          string
+		replicas       uint64
+		cpu            float64
+		memory         string
+		env            []string
+		command        []string
+		cmdArgs        []string
+		labels         []string
+		secrets        []string
+		configs        []string
+		mode           string
+		maxConcurrent  uint64
+		constraints    []string
+		placementPrefs []string
+		maxPerNode     uint64
+		update         *updatePolicyFlags
+		rollback       *updatePolicyFlags
 	)
 
 	cmd := &cobra.Command{
@@ -150,15 +165,61 @@ func newServiceCreateCommand() *cobra.Command {
 		Long: `Create a new service in the SwarmCracker cluster.
 
 The service will be scheduled on available nodes and can be scaled
-and updated as needed.`,
+and updated as needed.
+
+Services run in one of four modes: replicated (--replicas tasks), global
+(one task per node), or as jobs that run to completion: replicated-job
+(--replicas completions, --max-concurrent at a time) and global-job (once
+on every node). Failed job tasks are restarted; successful ones are not.
+
+Placement constraints (--constraint) restrict the nodes a task may run on,
+e.g. node.labels.kvm==true or node.hostname!=edge-1. Placement preferences
+(--placement-pref spread=node.labels.zone) spread tasks evenly over the
+values of a node label.`,
 		Example: `  swarmcracker service create --name myapp --image nginx:latest --replicas 3
   swarmcracker service create --name api --image myimage:v1 --cpu 2 --memory 512M
-  swarmcracker service create --name worker --image busybox --command /bin/sh --args "-c,echo hello"`,
+  swarmcracker service create --name worker --image busybox --command /bin/sh --args "-c,echo hello"
+  swarmcracker service create --name db --image postgres:16 --secret source=db_password,target=pg_pass,mode=0400
+  swarmcracker service create --name api --image myimage:v1 --replicas 6 --constraint node.labels.kvm==true --placement-pref spread=node.labels.rack --max-replicas-per-node 2
+  swarmcracker service create --name agent --image monitoring-agent --mode global
+  swarmcracker service create --name migrate --image myimage:v1 --mode replicated-job --replicas 10 --max-concurrent 2 --command ./migrate
+  swarmcracker service create --name web --image nginx --replicas 4 --update-parallelism 2 --update-order start-first --update-failure-action rollback`,
 		PreRun: func(cmd *cobra.Command, args []string) {
 			setupLogging(logLevel)
 		},
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return createService(name, image, replicas, cpu, memory, env, command, args, labels)
+			spec, err := buildServiceSpec(serviceOptions{
+				Name:     name,
+				Image:    image,
+				Replicas: replicas,
+				CPU:      cpu,
+				Memory:   memory,
+				Env:      env,
+				Command:  command,
+				Args:     cmdArgs,
+				Labels:   parseLabels(labels),
+
+				Mode:               mode,
+				MaxConcurrent:      maxConcurrent,
+				Constraints:        constraints,
+				PlacementPrefs:     placementPrefs,
+				MaxReplicasPerNode: maxPerNode,
+			})
+			if err != nil {
+				return err
+			}
+			if err := update.apply(cmd, &spec.Update); err != nil {
+				return err
+			}
+			if isJob(spec) && spec.Update != nil {
+				return fmt.Errorf("jobs cannot have an update policy")
+			}
+			if err := rollback.apply(cmd, &spec.Rollback); err != nil {
+				return err
+			}
+			return createService(spec, func(ctx context.Context, client api.ControlClient, spec *api.ServiceSpec) error {
+				return updateFileReferences(ctx, client, spec, secrets, nil, configs, nil)
+			})
 		},
 	}
 
@@ -169,8 +230,17 @@ and updated as needed.`,
 	cmd.Flags().StringVar(&memory, "memory", "", "Memory limit (e.g., 512M, 1G)")
 	cmd.Flags().StringArrayVarP(&env, "env", "e", nil, "Environment variables (e.g., KEY=value)")
 	cmd.Flags().StringArrayVar(&command, "command", nil, "Override default container command")
-	cmd.Flags().StringArrayVar(&args, "args", nil, "Container arguments")
+	cmd.Flags().StringArrayVar(&cmdArgs, "args", nil, "Container arguments")
 	cmd.Flags().StringArrayVarP(&labels, "label", "l", nil, "Service labels (e.g., key=value)")
+	cmd.Flags().StringArrayVar(&secrets, "secret", nil, "Expose a secret (e.g., db_password or source=db_password,target=pg_pass,mode=0400)")
+	cmd.Flags().StringArrayVar(&configs, "config", nil, "Expose a config (e.g., source=nginx_conf,target=/etc/nginx/nginx.conf)")
+	cmd.Flags().StringVar(&mode, "mode", "replicated", "Service mode (replicated, global, replicated-job, global-job)")
+	cmd.Flags().Uint64Var(&maxConcurrent, "max-concurrent", 0, "Job tasks to run at once for replicated jobs (0 = --replicas)")
+	cmd.Flags().StringArrayVar(&constraints, "constraint", nil, "Placement constraint (e.g., node.labels.kvm==true)")
+	cmd.Flags().StringArrayVar(&placementPrefs, "placement-pref", nil, "Placement preference (e.g., spread=node.labels.zone)")
+	cmd.Flags().Uint64Var(&maxPerNode, "max-replicas-per-node", 0, "Maximum tasks per node (0 = unlimited)")
+	update = addUpdatePolicyFlags(cmd, "update")
+	rollback = addUpdatePolicyFlags(cmd, "rollback")
 
 	cmd.MarkFlagRequired("name")
 	cmd.MarkFlagRequired("image")
@@ -187,7 +257,14 @@ func newServiceUpdateCommand() *cobra.Command {
 		image       string
 		env         []string
 		envRemove   []string
+		secretAdd   []string
+		secretRm    []string
+		configAdd   []string
+		configRm    []string
 		force       bool
+		watch       bool
+		update      *updatePolicyFlags
+		rollback    *updatePolicyFlags
 	)
 
 	cmd := &cobra.Command{
@@ -195,17 +272,33 @@ func newServiceUpdateCommand() *cobra.Command {
 		Short: "Update a service",
 		Long: `Update an existing service's configuration.
 
-Supports updating replicas, resource limits, image, and environment variables.`,
+Supports updating replicas, resource limits, image, environment variables,
+secrets, configs, and the rolling update and rollback policies. With
+--watch, the command follows the rollout task by task until it completes.
+
+Removals are applied before additions, so a secret can be rotated in one
+update by removing the old one and adding the new one at the same target.`,
 		Example: `  swarmcracker service update my-service --replicas 5
   swarmcracker service update my-service --cpu-limit 2 --memory-limit 1G
-  swarmcracker service update my-service --image myimage:v2
-  swarmcracker service update my-service --env-add KEY=value`,
+  swarmcracker service update my-service --image myimage:v2 --watch
+  swarmcracker service update my-service --env-add KEY=value
+  swarmcracker service update my-service --secret-rm db_password_v1 --secret-add source=db_password_v2,target=db_password
+  swarmcracker service update my-service --update-order start-first --update-failure-action rollback`,
 		Args: cobra.ExactArgs(1),
 		PreRun: func(cmd *cobra.Command, args []string) {
 			setupLogging(logLevel)
 		},
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return updateService(args[0], replicas, cpuLimit, memoryLimit, image, env, envRemove, force)
+			configure := func(ctx context.Context, client api.ControlClient, spec *api.ServiceSpec) error {
+				if err := updateFileReferences(ctx, client, spec, secretAdd, secretRm, configAdd, configRm); err != nil {
+					return err
+				}
+				if err := update.apply(cmd, &spec.Update); err != nil {
+					return err
+				}
+				return rollback.apply(cmd, &spec.Rollback)
+			}
+			return updateService(args[0], replicas, cpuLimit, memoryLimit, image, env, envRemove, force, configure, watch)
 		},
 	}
 
@@ -215,7 +308,40 @@ Supports updating replicas, resource limits, image, and environment variables.`,
 	cmd.Flags().StringVar(&image, "image", "", "New container image")
 	cmd.Flags().StringArrayVar(&env, "env-add", nil, "Add environment variable (e.g., KEY=value)")
 	cmd.Flags().StringArrayVar(&envRemove, "env-rm", nil, "Remove environment variable")
+	cmd.Flags().StringArrayVar(&secretAdd, "secret-add", nil, "Add or replace a secret (same format as create --secret)")
+	cmd.Flags().StringArrayVar(&secretRm, "secret-rm", nil, "Remove a secret by name or ID")
+	cmd.Flags().StringArrayVar(&configAdd, "config-add", nil, "Add or replace a config (same format as create --config)")
+	cmd.Flags().StringArrayVar(&configRm, "config-rm", nil, "Remove a config by name or ID")
 	cmd.Flags().BoolVarP(&force, "force", "f", false, "Force update even if no changes detected")
+	cmd.Flags().BoolVar(&watch, "watch", false, "Follow the rollout until it completes")
+	update = addUpdatePolicyFlags(cmd, "update")
+	rollback = addUpdatePolicyFlags(cmd, "rollback")
+
+	return cmd
+}
+
+// newServiceRollbackCommand rolls a service back to its previous spec
+func newServiceRollbackCommand() *cobra.Command {
+	var watch bool
+
+	cmd := &cobra.Command{
+		Use:   "rollback <service-id>",
+		Short: "Roll a service back to its previous spec",
+		Long: `Roll a service back to the spec it had before its last update.
+
+The rollback is rolled out with the service's rollback policy.`,
+		Example: `  swarmcracker service rollback my-service
+  swarmcracker service rollback my-service --watch`,
+		Args: cobra.ExactArgs(1),
+		PreRun: func(cmd *cobra.Command, args []string) {
+			setupLogging(logLevel)
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return rollbackService(args[0], watch)
+		},
+	}
+
+	cmd.Flags().BoolVar(&watch, "watch", false, "Follow the rollback until it completes")
 
 	return cmd
 }
@@ -419,9 +545,11 @@ func listServices(format, filter string, quiet bool) error {
 			id = id[:12]
 		}
 		name := svc.Spec.Annotations.Name
-		replicas := "global"
+		replicas := serviceMode(&svc.Spec)
 		if r := svc.Spec.GetReplicated(); r != nil {
 			replicas = fmt.Sprintf("%d", r.Replicas)
+		} else if j := svc.Spec.GetReplicatedJob(); j != nil {
+			replicas = fmt.Sprintf("%d (job)", j.TotalCompletions)
 		}
 		image := ""
 		if svc.Spec.Task.GetContainer() != nil {
@@ -503,10 +631,24 @@ func inspectService(serviceID, format string, pretty bool) error {
 		fmt.Printf("ID: %s\n", svc.ID)
 		fmt.Printf("Name: %s\n", svc.Spec.Annotations.Name)
 		fmt.Printf("Version: %d\n", svc.Meta.Version.Index)
+		fmt.Printf("Mode: %s\n", serviceMode(&svc.Spec))
 		if r := svc.Spec.GetReplicated(); r != nil {
 			fmt.Printf("Replicas: %d\n", r.Replicas)
-		} else if g := svc.Spec.GetGlobal(); g != nil {
-			fmt.Printf("Mode: global\n")
+		} else if j := svc.Spec.GetReplicatedJob(); j != nil {
+			fmt.Printf("Completions: %d (max concurrent %d)\n", j.TotalCompletions, j.MaxConcurrent)
+		}
+		if p := svc.Spec.Task.Placement; p != nil {
+			for _, c := range p.Constraints {
+				fmt.Printf("Constraint: %s\n", c)
+			}
+			for _, pref := range p.Preferences {
+				if spread := pref.GetSpread(); spread != nil {
+					fmt.Printf("Placement preference: spread=%s\n", spread.SpreadDescriptor)
+				}
+			}
+			if p.MaxReplicas > 0 {
+				fmt.Printf("Max replicas per node: %d\n", p.MaxReplicas)
+			}
 		}
 		if svc.Spec.Task.GetContainer() != nil {
 			container := svc.Spec.Task.GetContainer()
@@ -634,58 +776,189 @@ func listServiceTasks(serviceID, format, filter string, quiet, noTrunc bool) err
 	return nil
 }
 
-func createService(name, image string, replicas uint64, cpu float64, memory string, env, command, args, labels []string) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
-
-	client, conn, err := getSwarmClientForService()
-	if err != nil {
-		return err
-	}
-	defer conn.Close()
+// serviceOptions describes a service as given on the command line or in a
+// Compose file
+type serviceOptions struct {
+	Name     string
+	Image    string
+	Replicas uint64
+	CPU      float64 // CPU limit in cores
+	Memory   string  // Memory limit, e.g. "512M"
+	Env      []string
+	Command  []string
+	Args     []string
+	Labels   map[string]string
+
+	// Mode is replicated (the default), global, replicated-job or
+	// global-job. Replicas is the number of completions of a replicated
+	// job, and MaxConcurrent how many of them run at once (0 = Replicas).
+	Mode          string
+	MaxConcurrent uint64
+
+	Constraints        []string
+	PlacementPrefs     []string // "spread=<descriptor>"
+	MaxReplicasPerNode uint64
+}
 
-	// Parse memory
-	memoryBytes, err := parseMemory(memory)
+// buildServiceSpec builds the SwarmKit spec of a replicated service
+func buildServiceSpec(opts serviceOptions) (*api.ServiceSpec, error) {
+	memoryBytes, err := parseMemory(opts.Memory)
 	if err != nil {
-		return fmt.Errorf("invalid memory value: %w", err)
+		return nil, fmt.Errorf("invalid memory value: %w", err)
 	}
 
-	// Build service spec
 	spec := &api.ServiceSpec{
 		Annotations: api.Annotations{
-			Name:   name,
-			Labels: parseLabels(labels),
+			Name:   opts.Name,
+			Labels: opts.Labels,
 		},
 		Task: api.TaskSpec{
 			Runtime: &api.TaskSpec_Container{
 				Container: &api.ContainerSpec{
-					Image:   image,
-					Env:     env,
-					Command: command,
-					Args:    args,
+					Image:   opts.Image,
+					Env:     opts.Env,
+					Command: opts.Command,
+					Args:    opts.Args,
 				},
 			},
 		},
-		Mode: &api.ServiceSpec_Replicated{
+	}
+
+	switch opts.Mode {
+	case "", "replicated":
+		spec.Mode = &api.ServiceSpec_Replicated{
 			Replicated: &api.ReplicatedService{
-				Replicas: replicas,
+				Replicas: opts.Replicas,
+			},
+		}
+	case "global":
+		spec.Mode = &api.ServiceSpec_Global{Global: &api.GlobalService{}}
+	case "replicated-job":
+		maxConcurrent := opts.MaxConcurrent
+		if maxConcurrent == 0 {
+			maxConcurrent = opts.Replicas
+		}
+		spec.Mode = &api.ServiceSpec_ReplicatedJob{
+			ReplicatedJob: &api.ReplicatedJob{
+				MaxConcurrent:    maxConcurrent,
+				TotalCompletions: opts.Replicas,
 			},
+		}
+	case "global-job":
+		spec.Mode = &api.ServiceSpec_GlobalJob{GlobalJob: &api.GlobalJob{}}
+	default:
+		return nil, fmt.Errorf("unsupported mode %q", opts.Mode)
+	}
+	if opts.MaxConcurrent > 0 && spec.GetReplicatedJob() == nil {
+		return nil, fmt.Errorf("max concurrent only applies to replicated jobs")
+	}
+	if opts.MaxReplicasPerNode > 0 && (spec.GetGlobal() != nil || spec.GetGlobalJob() != nil) {
+		return nil, fmt.Errorf("max replicas per node does not apply to global services")
+	}
+
+	// A job task that succeeded is done; only failed ones are restarted
+	if isJob(spec) {
+		spec.Task.Restart = &api.RestartPolicy{Condition: api.RestartOnFailure}
+	}
+
+	placement := &api.Placement{MaxReplicas: opts.MaxReplicasPerNode}
+	// Keep services that pick a kernel on the nodes that have it
+	if name := spec.Annotations.Labels[kernel.Label]; name != "" {
+		placement.Constraints = append(placement.Constraints, kernel.Constraint(name))
+	}
+	placement.Constraints = append(placement.Constraints, opts.Constraints...)
+	if _, err := constraint.Parse(placement.Constraints); err != nil {
+		return nil, err
+	}
+	for _, p := range opts.PlacementPrefs {
+		pref, err := parsePlacementPref(p)
+		if err != nil {
+			return nil, err
+		}
+		placement.Preferences = append(placement.Preferences, pref)
+	}
+	if len(placement.Constraints) > 0 || len(placement.Preferences) > 0 || placement.MaxReplicas > 0 {
+		spec.Task.Placement = placement
+	}
+
+	// Every task takes one of the microVM slots nodes report, so tasks
+	// only land on nodes that can boot them
+	spec.Task.Resources = &api.ResourceRequirements{
+		Reservations: &api.Resources{
+			Generic: []*api.GenericResource{genericresource.NewDiscrete(hostinfo.SlotResourceKind, 1)},
 		},
 	}
 
 	// Set resource limits if specified
-	if cpu > 0 || memoryBytes > 0 {
-		spec.Task.Resources = &api.ResourceRequirements{
-			Limits: &api.Resources{},
-		}
-		if cpu > 0 {
-			spec.Task.Resources.Limits.NanoCPUs = int64(cpu * 1e9)
+	if opts.CPU > 0 || memoryBytes > 0 {
+		spec.Task.Resources.Limits = &api.Resources{}
+		if opts.CPU > 0 {
+			spec.Task.Resources.Limits.NanoCPUs = int64(opts.CPU * 1e9)
 		}
 		if memoryBytes > 0 {
 			spec.Task.Resources.Limits.MemoryBytes = memoryBytes
 		}
 	}
 
+	return spec, nil
+}
+
+// isJob reports whether a service runs to completion
+func isJob(spec *api.ServiceSpec) bool {
+	return spec.GetReplicatedJob() != nil || spec.GetGlobalJob() != nil
+}
+
+// parsePlacementPref parses a placement preference; spread=<descriptor> is
+// the only strategy SwarmKit has
+func parsePlacementPref(s string) (*api.PlacementPreference, error) {
+	strategy, descriptor, ok := strings.Cut(s, "=")
+	if !ok || strategy != "spread" || descriptor == "" {
+		return nil, fmt.Errorf("invalid placement preference %q: want spread=<node label>", s)
+	}
+	return &api.PlacementPreference{
+		Preference: &api.PlacementPreference_Spread{
+			Spread: &api.SpreadOver{SpreadDescriptor: descriptor},
+		},
+	}, nil
+}
+
+// serviceMode describes a service's mode for ls and inspect
+func serviceMode(spec *api.ServiceSpec) string {
+	switch {
+	case spec.GetReplicated() != nil:
+		return "replicated"
+	case spec.GetGlobal() != nil:
+		return "global"
+	case spec.GetReplicatedJob() != nil:
+		return "replicated-job"
+	case spec.GetGlobalJob() != nil:
+		return "global-job"
+	}
+	return "unknown"
+}
+
+// serviceConfigurer makes changes to a service's spec that need the
+// control API, such as resolving secret names
+type serviceConfigurer func(ctx context.Context, client api.ControlClient, spec *api.ServiceSpec) error
+
+// createService creates a service. configure, if set, completes the spec
+// first.
+func createService(spec *api.ServiceSpec, configure serviceConfigurer) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	client, conn, err := getSwarmClientForService()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if configure != nil {
+		if err := configure(ctx, client, spec); err != nil {
+			return err
+		}
+	}
+
 	// Create service
 	resp, err := client.CreateService(ctx, &api.CreateServiceRequest{
 		Spec: spec,
@@ -694,14 +967,38 @@ func createService(name, image string, replicas uint64, cpu float64, memory stri
 		return fmt.Errorf("failed to create service: %w", err)
 	}
 
-	fmt.Printf("Service %s created with ID: %s\n", name, resp.Service.ID)
-	fmt.Printf("Replicas: %d\n", replicas)
-	fmt.Printf("Image: %s\n", image)
+	fmt.Printf("Service %s created with ID: %s\n", spec.Annotations.Name, resp.Service.ID)
+	if r := spec.GetReplicated(); r != nil {
+		fmt.Printf("Replicas: %d\n", r.Replicas)
+	}
+	fmt.Printf("Image: %s\n", spec.Task.GetContainer().Image)
 
 	return nil
 }
 
-func updateService(serviceID string, replicas uint64, cpuLimit float64, memoryLimit string, image string, env, envRemove []string, force bool) error {
+// resolveService finds a service by ID or name
+func resolveService(ctx context.Context, client api.ControlClient, ref string) (*api.Service, error) {
+	getResp, err := client.GetService(ctx, &api.GetServiceRequest{ServiceID: ref})
+	if err == nil {
+		return getResp.Service, nil
+	}
+
+	// Try to find by name
+	listResp, listErr := client.ListServices(ctx, &api.ListServicesRequest{})
+	if listErr != nil {
+		return nil, fmt.Errorf("failed to get service: %w", err)
+	}
+	for _, s := range listResp.Services {
+		if s.Spec.Annotations.Name == ref {
+			return s, nil
+		}
+	}
+	return nil, fmt.Errorf("service %s not found", ref)
+}
+
+// updateService changes a service's spec. configure, if set, makes further
+// changes to the spec after the other arguments are applied.
+func updateService(serviceID string, replicas uint64, cpuLimit float64, memoryLimit string, image string, env, envRemove []string, force bool, configure serviceConfigurer, watch bool) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
@@ -712,25 +1009,9 @@ func updateService(serviceID string, replicas uint64, cpuLimit float64, memoryLi
 	defer conn.Close()
 
 	// Get existing service
-	var svc *api.Service
-	getResp, err := client.GetService(ctx, &api.GetServiceRequest{ServiceID: serviceID})
+	svc, err := resolveService(ctx, client, serviceID)
 	if err != nil {
-		// Try to find by name
-		listResp, listErr := client.ListServices(ctx, &api.ListServicesRequest{})
-		if listErr != nil {
-			return fmt.Errorf("failed to get service: %w", err)
-		}
-		for _, s := range listResp.Services {
-			if s.Spec.Annotations.Name == serviceID {
-				svc = s
-				break
-			}
-		}
-		if svc == nil {
-			return fmt.Errorf("service %s not found", serviceID)
-		}
-	} else {
-		svc = getResp.Service
+		return err
 	}
 
 	// Parse memory
@@ -746,12 +1027,11 @@ func updateService(serviceID string, replicas uint64, cpuLimit float64, memoryLi
 	if replicas > 0 {
 		if r := spec.GetReplicated(); r != nil {
 			r.Replicas = replicas
+		} else if j := spec.GetReplicatedJob(); j != nil {
+			j.TotalCompletions = replicas
 		} else {
-			spec.Mode = &api.ServiceSpec_Replicated{
-				Replicated: &api.ReplicatedService{
-					Replicas: replicas,
-				},
-			}
+			// SwarmKit does not allow changing a service's mode
+			return fmt.Errorf("cannot set replicas of a %s service", serviceMode(spec))
 		}
 	}
 
@@ -820,6 +1100,12 @@ func updateService(serviceID string, replicas uint64, cpuLimit float64, memoryLi
 		}
 	}
 
+	if configure != nil {
+		if err := configure(ctx, client, spec); err != nil {
+			return err
+		}
+	}
+
 	// Force update if requested
 	if force {
 		spec.Task.ForceUpdate++
@@ -836,16 +1122,73 @@ func updateService(serviceID string, replicas uint64, cpuLimit float64, memoryLi
 	}
 
 	fmt.Printf("Service %s updated\n", svc.Spec.Annotations.Name)
+	if watch {
+		return watchUntilInterrupted(client, svc.ID, false)
+	}
+	return nil
+}
+
+// rollbackService rolls a service back to its previous spec
+func rollbackService(serviceID string, watch bool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	client, conn, err := getSwarmClientForService()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	svc, err := resolveService(ctx, client, serviceID)
+	if err != nil {
+		return err
+	}
+	if err := requestRollback(ctx, client, svc); err != nil {
+		return err
+	}
+
+	fmt.Printf("Service %s rolling back\n", svc.Spec.Annotations.Name)
+	if watch {
+		return watchUntilInterrupted(client, svc.ID, true)
+	}
+	return nil
+}
+
+// requestRollback asks the manager to roll the service back to its
+// previous spec
+func requestRollback(ctx context.Context, client api.ControlClient, svc *api.Service) error {
+	if svc.PreviousSpec == nil {
+		return fmt.Errorf("service %s has no previous spec to roll back to", svc.Spec.Annotations.Name)
+	}
+
+	// The manager takes the spec from the service's previous spec
+	_, err := client.UpdateService(ctx, &api.UpdateServiceRequest{
+		ServiceID:      svc.ID,
+		ServiceVersion: &svc.Meta.Version,
+		Spec:           &svc.Spec,
+		Rollback:       api.UpdateServiceRequest_PREVIOUS,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to roll back service: %w", err)
+	}
 	return nil
 }
 
+// watchUntilInterrupted follows a service's rollout on stdout until it
+// finishes or the user interrupts
+func watchUntilInterrupted(client api.ControlClient, serviceID string, rollback bool) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	return watchServiceUpdate(ctx, client, os.Stdout, serviceID, rollback)
+}
+
 func scaleService(serviceID, replicasStr string) error {
 	var replicas uint64
 	if _, err := fmt.Sscanf(replicasStr, "%d", &replicas); err != nil {
 		return fmt.Errorf("invalid replica count: %s", replicasStr)
 	}
 
-	return updateService(serviceID, replicas, 0, "", "", nil, nil, false)
+	return updateService(serviceID, replicas, 0, "", "", nil, nil, false, nil, false)
 }
 
 func removeService(serviceID string, force bool) error {
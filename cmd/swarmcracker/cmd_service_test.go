@@ -4,7 +4,10 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/moby/swarmkit/v2/api"
+	"github.com/restuhaqza/swarmcracker/pkg/hostinfo"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 // TestParseMemory tests the memory parsing function
@@ -148,14 +151,14 @@ func TestNewServiceCommand(t *testing.T) {
 
 	// Check subcommands exist
 	subcommands := cmd.Commands()
-	assert.Equal(t, 7, len(subcommands))
+	assert.Equal(t, 8, len(subcommands))
 
 	// Verify expected subcommand names exist (order may vary)
 	foundSubcmds := make(map[string]bool)
 	for _, subcmd := range subcommands {
 		foundSubcmds[subcmd.Name()] = true
 	}
-	expectedSubcmds := []string{"ls", "inspect", "ps", "create", "update", "scale", "rm"}
+	expectedSubcmds := []string{"ls", "inspect", "ps", "create", "update", "rollback", "scale", "rm"}
 	for _, expected := range expectedSubcmds {
 		assert.True(t, foundSubcmds[expected], "Expected subcommand '%s' not found", expected)
 	}
@@ -185,6 +188,14 @@ func TestServiceCreateCommandFlags(t *testing.T) {
 	memoryFlag := cmd.Flags().Lookup("memory")
 	assert.NotNil(t, memoryFlag)
 	assert.Equal(t, "", memoryFlag.DefValue)
+
+	modeFlag := cmd.Flags().Lookup("mode")
+	assert.NotNil(t, modeFlag)
+	assert.Equal(t, "replicated", modeFlag.DefValue)
+
+	for _, name := range []string{"max-concurrent", "constraint", "placement-pref", "max-replicas-per-node"} {
+		assert.NotNil(t, cmd.Flags().Lookup(name), name)
+	}
 }
 
 // TestServiceUpdateCommandFlags tests the update command flags
@@ -353,3 +364,83 @@ func TestServiceCommandExamples(t *testing.T) {
 	psCmd := newServicePSCommand()
 	assert.NotEmpty(t, psCmd.Example)
 }
+
+// TestBuildServiceSpec_Modes tests the service modes
+func TestBuildServiceSpec_Modes(t *testing.T) {
+	base := serviceOptions{Name: "svc", Image: "busybox", Replicas: 4}
+
+	spec, err := buildServiceSpec(base)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(4), spec.GetReplicated().Replicas)
+	assert.Nil(t, spec.Task.Restart)
+
+	opts := base
+	opts.Mode = "global"
+	spec, err = buildServiceSpec(opts)
+	require.NoError(t, err)
+	assert.NotNil(t, spec.GetGlobal())
+
+	opts = base
+	opts.Mode = "replicated-job"
+	spec, err = buildServiceSpec(opts)
+	require.NoError(t, err)
+	assert.Equal(t, &api.ReplicatedJob{MaxConcurrent: 4, TotalCompletions: 4}, spec.GetReplicatedJob())
+	assert.Equal(t, api.RestartOnFailure, spec.Task.Restart.Condition)
+
+	opts.MaxConcurrent = 2
+	spec, err = buildServiceSpec(opts)
+	require.NoError(t, err)
+	assert.Equal(t, &api.ReplicatedJob{MaxConcurrent: 2, TotalCompletions: 4}, spec.GetReplicatedJob())
+	assert.True(t, isJob(spec))
+	assert.Equal(t, "replicated-job", serviceMode(spec))
+
+	opts = base
+	opts.Mode = "global-job"
+	spec, err = buildServiceSpec(opts)
+	require.NoError(t, err)
+	assert.NotNil(t, spec.GetGlobalJob())
+	assert.True(t, isJob(spec))
+
+	for _, bad := range []serviceOptions{
+		{Name: "svc", Image: "busybox", Mode: "daemon"},
+		{Name: "svc", Image: "busybox", Mode: "replicated", MaxConcurrent: 2},
+		{Name: "svc", Image: "busybox", Mode: "global", MaxReplicasPerNode: 1},
+	} {
+		_, err := buildServiceSpec(bad)
+		assert.Error(t, err, "%+v", bad)
+	}
+}
+
+// TestBuildServiceSpec_Placement tests constraints and preferences
+func TestBuildServiceSpec_Placement(t *testing.T) {
+	spec, err := buildServiceSpec(serviceOptions{Name: "svc", Image: "busybox", Replicas: 1})
+	require.NoError(t, err)
+	assert.Nil(t, spec.Task.Placement)
+	require.Len(t, spec.Task.Resources.Reservations.Generic, 1, "every task reserves a microVM slot")
+	slot := spec.Task.Resources.Reservations.Generic[0].GetDiscreteResourceSpec()
+	assert.Equal(t, &api.DiscreteGenericResource{Kind: hostinfo.SlotResourceKind, Value: 1}, slot)
+	assert.Nil(t, spec.Task.Resources.Limits)
+
+	spec, err = buildServiceSpec(serviceOptions{
+		Name:               "svc",
+		Image:              "busybox",
+		Replicas:           6,
+		Constraints:        []string{"node.labels.kvm==true", "node.hostname!=edge-1"},
+		PlacementPrefs:     []string{"spread=node.labels.rack"},
+		MaxReplicasPerNode: 2,
+	})
+	require.NoError(t, err)
+	require.NotNil(t, spec.Task.Placement)
+	assert.Equal(t, []string{"node.labels.kvm==true", "node.hostname!=edge-1"}, spec.Task.Placement.Constraints)
+	require.Len(t, spec.Task.Placement.Preferences, 1)
+	assert.Equal(t, "node.labels.rack", spec.Task.Placement.Preferences[0].GetSpread().SpreadDescriptor)
+	assert.Equal(t, uint64(2), spec.Task.Placement.MaxReplicas)
+
+	_, err = buildServiceSpec(serviceOptions{Name: "svc", Image: "busybox", Constraints: []string{"node.labels.kvm"}})
+	assert.Error(t, err)
+
+	for _, pref := range []string{"node.labels.rack", "pack=node.labels.rack", "spread="} {
+		_, err := parsePlacementPref(pref)
+		assert.Error(t, err, pref)
+	}
+}
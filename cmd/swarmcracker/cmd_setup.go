@@ -8,6 +8,7 @@ import (
 	"runtime"
 	"strings"
 
+	"github.com/restuhaqza/swarmcracker/pkg/arch"
 	"github.com/restuhaqza/swarmcracker/pkg/config"
 	"github.com/spf13/cobra"
 )
@@ -269,17 +270,11 @@ func installFirecracker() error {
 	} else {
 		fmt.Printf("  📦 Installing Firecracker %s...\n", setupInstallFirecrackerVer)
 
-		arch := runtime.GOARCH
-		if arch == "amd64" {
-			arch = "x86_64"
-		}
-		if arch == "arm64" {
-			arch = "aarch64"
-		}
+		machine := arch.Default().Machine
 
 		url := fmt.Sprintf(
 			"https://github.com/firecracker-microvm/firecracker/releases/download/%s/firecracker-%s-%s.tgz",
-			setupInstallFirecrackerVer, setupInstallFirecrackerVer, arch,
+			setupInstallFirecrackerVer, setupInstallFirecrackerVer, machine,
 		)
 
 		fmt.Printf("     Downloading %s...\n", url)
@@ -289,12 +284,12 @@ func installFirecracker() error {
 		fmt.Printf("       curl -fsSL %s -o /tmp/firecracker.tgz\n", url)
 		fmt.Printf("       tar xzf /tmp/firecracker.tgz -C /tmp\n")
 		fmt.Printf("       sudo cp /tmp/release-%s-%s/firecracker-%s-%s /usr/local/bin/firecracker\n",
-			setupInstallFirecrackerVer, arch, setupInstallFirecrackerVer, arch)
+			setupInstallFirecrackerVer, machine, setupInstallFirecrackerVer, machine)
 		fmt.Printf("       sudo cp /tmp/release-%s-%s/jailer-%s-%s /usr/local/bin/jailer\n",
-			setupInstallFirecrackerVer, arch, setupInstallFirecrackerVer, arch)
+			setupInstallFirecrackerVer, machine, setupInstallFirecrackerVer, machine)
 		fmt.Printf("       sudo chmod +x /usr/local/bin/firecracker /usr/local/bin/jailer\n")
 		fmt.Printf("       rm -rf /tmp/firecracker.tgz /tmp/release-%s-%s\n",
-			setupInstallFirecrackerVer, arch)
+			setupInstallFirecrackerVer, machine)
 
 		// Try curl-based install if curl is available
 		if _, err := exec.LookPath("curl"); err == nil {
@@ -318,7 +313,7 @@ func installFirecracker() error {
 			}
 
 			// Find and install binaries
-			releaseDir := filepath.Join(tmpDir, fmt.Sprintf("release-%s-%s", setupInstallFirecrackerVer, arch))
+			releaseDir := filepath.Join(tmpDir, fmt.Sprintf("release-%s-%s", setupInstallFirecrackerVer, machine))
 
 			// Try to find the actual binary names (Firecracker naming varies)
 			fcFiles, _ := filepath.Glob(filepath.Join(releaseDir, "firecracker*"))
@@ -369,11 +364,8 @@ func downloadKernel() error {
 	fmt.Println("       curl -fsSL https://raw.githubusercontent.com/restuhaqza/SwarmCracker/main/install.sh | bash")
 	fmt.Println("     Or download manually:")
 	fmt.Println("       sudo mkdir -p /usr/share/firecracker")
-	arch := runtime.GOARCH
-	if arch == "amd64" {
-		arch = "x86_64"
-	}
-	fmt.Printf("       curl -fsSL https://s3.amazonaws.com/spec.ccfc.min/firecracker-ci/v1.15/%s/vmlinux-6.1.155 -o /usr/share/firecracker/vmlinux\n", arch)
+	machine := arch.Default().Machine
+	fmt.Printf("       curl -fsSL https://s3.amazonaws.com/spec.ccfc.min/firecracker-ci/v1.15/%s/vmlinux-6.1.155 -o /usr/share/firecracker/vmlinux\n", machine)
 	return nil
 }
 
@@ -382,12 +374,9 @@ func downloadRootfs() error {
 	fmt.Println("     Run the install script for automatic rootfs setup:")
 	fmt.Println("       curl -fsSL https://raw.githubusercontent.com/restuhaqza/SwarmCracker/main/install.sh | bash")
 	fmt.Println("     Or download manually:")
-	arch := runtime.GOARCH
-	if arch == "amd64" {
-		arch = "x86_64"
-	}
+	machine := arch.Default().Machine
 	fmt.Printf("       sudo mkdir -p /var/lib/firecracker/rootfs\n")
-	fmt.Printf("       curl -fsSL https://s3.amazonaws.com/spec.ccfc.min/img/quickstart_guide/%s/rootfs/bionic.rootfs.ext4 -o /var/lib/firecracker/rootfs/bionic.rootfs.ext4\n", arch)
+	fmt.Printf("       curl -fsSL https://s3.amazonaws.com/spec.ccfc.min/img/quickstart_guide/%s/rootfs/bionic.rootfs.ext4 -o /var/lib/firecracker/rootfs/bionic.rootfs.ext4\n", machine)
 	return nil
 }
 
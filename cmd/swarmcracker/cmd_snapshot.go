@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"github.com/restuhaqza/swarmcracker/pkg/config"
+	"github.com/restuhaqza/swarmcracker/pkg/events"
 	"github.com/restuhaqza/swarmcracker/pkg/snapshot"
 	"github.com/spf13/cobra"
 )
@@ -77,6 +78,7 @@ Example:
 			if err != nil {
 				return fmt.Errorf("failed to create snapshot manager: %w", err)
 			}
+			mgr.SetEventPublisher(events.NewClient(cfg.Agent.EventsSocket))
 
 			// Resolve socket path
 			if socketPath == "" {
@@ -152,6 +154,7 @@ Example:
 			if err != nil {
 				return fmt.Errorf("failed to create snapshot manager: %w", err)
 			}
+			mgr.SetEventPublisher(events.NewClient(cfg.Agent.EventsSocket))
 
 			// Find snapshot
 			snapshots, err := mgr.ListSnapshots(snapshot.SnapshotFilter{})
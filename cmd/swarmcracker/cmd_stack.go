@@ -0,0 +1,655 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/moby/swarmkit/v2/api"
+	"github.com/spf13/cobra"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// stackSpecHashLabel records the hash of the spec a stack deploy last
+// applied to a service, so redeploys only update services that changed
+const stackSpecHashLabel = "swarmcracker.stack.spec-hash"
+
+// newStackCommand creates the stack command group
+func newStackCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "stack",
+		Short: "Manage stacks deployed from Compose files",
+		Long: `Manage stacks in the SwarmCracker cluster.
+
+A stack is a set of services, networks, secrets and configs described by a
+Compose file. Every object is named <stack>_<name> and labelled with its
+stack.`,
+	}
+
+	cmd.AddCommand(newStackDeployCommand())
+	cmd.AddCommand(newStackListCommand())
+	cmd.AddCommand(newStackPSCommand())
+	cmd.AddCommand(newStackRemoveCommand())
+
+	return cmd
+}
+
+// newStackDeployCommand deploys or updates a stack
+func newStackDeployCommand() *cobra.Command {
+	var (
+		composeFile string
+		prune       bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "deploy <stack>",
+		Short: "Deploy a new stack or update an existing one",
+		Long: `Deploy a stack from a Compose file.
+
+Services whose definition did not change since the last deploy are left
+alone. Secrets and configs are immutable: change their name to roll out
+new content.`,
+		Example: `  swarmcracker stack deploy -c compose.yml myapp
+  swarmcracker stack deploy -c compose.yml --prune myapp`,
+		Args: cobra.ExactArgs(1),
+		PreRun: func(cmd *cobra.Command, args []string) {
+			setupLogging(logLevel)
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			file, err := loadComposeFile(composeFile)
+			if err != nil {
+				return err
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+			defer cancel()
+
+			client, conn, err := getSwarmClientForService()
+			if err != nil {
+				return err
+			}
+			defer conn.Close()
+
+			return deployStack(ctx, client, cmd.OutOrStdout(), args[0], file, prune)
+		},
+	}
+
+	cmd.Flags().StringVarP(&composeFile, "compose-file", "c", "", "Path to a Compose file (required)")
+	cmd.Flags().BoolVar(&prune, "prune", false, "Remove services that are no longer in the Compose file")
+	cmd.MarkFlagRequired("compose-file")
+
+	return cmd
+}
+
+// newStackListCommand lists stacks
+func newStackListCommand() *cobra.Command {
+	var format string
+
+	cmd := &cobra.Command{
+		Use:     "ls",
+		Short:   "List stacks",
+		Aliases: []string{"list"},
+		Example: `  swarmcracker stack ls
+  swarmcracker stack ls --format json`,
+		PreRun: func(cmd *cobra.Command, args []string) {
+			setupLogging(logLevel)
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+
+			client, conn, err := getSwarmClientForService()
+			if err != nil {
+				return err
+			}
+			defer conn.Close()
+
+			return listStacks(ctx, client, cmd.OutOrStdout(), format)
+		},
+	}
+
+	cmd.Flags().StringVar(&format, "format", "table", "Output format (table, json)")
+
+	return cmd
+}
+
+// newStackPSCommand lists the tasks of a stack
+func newStackPSCommand() *cobra.Command {
+	var (
+		format  string
+		noTrunc bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "ps <stack>",
+		Short: "List the tasks of a stack",
+		Example: `  swarmcracker stack ps myapp
+  swarmcracker stack ps --format json myapp`,
+		Args: cobra.ExactArgs(1),
+		PreRun: func(cmd *cobra.Command, args []string) {
+			setupLogging(logLevel)
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+
+			client, conn, err := getSwarmClientForService()
+			if err != nil {
+				return err
+			}
+			defer conn.Close()
+
+			return listStackTasks(ctx, client, cmd.OutOrStdout(), args[0], format, noTrunc)
+		},
+	}
+
+	cmd.Flags().StringVar(&format, "format", "table", "Output format (table, json)")
+	cmd.Flags().BoolVar(&noTrunc, "no-trunc", false, "Don't truncate output")
+
+	return cmd
+}
+
+// newStackRemoveCommand removes a stack
+func newStackRemoveCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "rm <stack>",
+		Short:   "Remove a stack",
+		Long:    `Remove the services, networks, secrets and configs of a stack. Volumes are kept.`,
+		Aliases: []string{"remove"},
+		Example: `  swarmcracker stack rm myapp`,
+		Args:    cobra.ExactArgs(1),
+		PreRun: func(cmd *cobra.Command, args []string) {
+			setupLogging(logLevel)
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+			defer cancel()
+
+			client, conn, err := getSwarmClientForService()
+			if err != nil {
+				return err
+			}
+			defer conn.Close()
+
+			return removeStack(ctx, client, cmd.OutOrStdout(), args[0])
+		},
+	}
+
+	return cmd
+}
+
+// stackFilter selects the objects of a stack
+func stackFilter(stack string) map[string]string {
+	return map[string]string{stackNamespaceLabel: stack}
+}
+
+// specHash returns a stable hash of a service spec, ignoring the hash label
+func specHash(spec *api.ServiceSpec) (string, error) {
+	s := spec.Copy()
+	delete(s.Annotations.Labels, stackSpecHashLabel)
+	data, err := json.Marshal(s)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])[:16], nil
+}
+
+// deployStack creates or updates the networks, secrets, configs and
+// services of a stack
+func deployStack(ctx context.Context, client api.ControlClient, out io.Writer, stack string, file *composeFile, prune bool) error {
+	networkIDs, err := deployStackNetworks(ctx, client, out, stack, file)
+	if err != nil {
+		return err
+	}
+	secretIDs, err := deployStackSecrets(ctx, client, out, stack, file)
+	if err != nil {
+		return err
+	}
+	configIDs, err := deployStackConfigs(ctx, client, out, stack, file)
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.ListServices(ctx, &api.ListServicesRequest{
+		Filters: &api.ListServicesRequest_Filters{Labels: stackFilter(stack)},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list services: %w", err)
+	}
+	existing := make(map[string]*api.Service, len(resp.Services))
+	for _, svc := range resp.Services {
+		existing[svc.Spec.Annotations.Name] = svc
+	}
+
+	names := make([]string, 0, len(file.Services))
+	for name := range file.Services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	wanted := make(map[string]bool, len(names))
+	for _, name := range names {
+		spec, err := file.serviceSpec(stack, name)
+		if err != nil {
+			return err
+		}
+		if err := resolveStackRefs(spec, networkIDs, secretIDs, configIDs); err != nil {
+			return fmt.Errorf("service %s: %w", name, err)
+		}
+		hash, err := specHash(spec)
+		if err != nil {
+			return fmt.Errorf("service %s: %w", name, err)
+		}
+		spec.Annotations.Labels[stackSpecHashLabel] = hash
+
+		fullName := spec.Annotations.Name
+		wanted[fullName] = true
+		svc, ok := existing[fullName]
+		if !ok {
+			fmt.Fprintf(out, "Creating service %s\n", fullName)
+			if _, err := client.CreateService(ctx, &api.CreateServiceRequest{Spec: spec}); err != nil {
+				return fmt.Errorf("failed to create service %s: %w", fullName, err)
+			}
+			continue
+		}
+		if svc.Spec.Annotations.Labels[stackSpecHashLabel] == hash {
+			fmt.Fprintf(out, "Service %s is up to date\n", fullName)
+			continue
+		}
+
+		fmt.Fprintf(out, "Updating service %s\n", fullName)
+		// Keep forced restarts counting up across deploys
+		spec.Task.ForceUpdate = svc.Spec.Task.ForceUpdate
+		_, err = client.UpdateService(ctx, &api.UpdateServiceRequest{
+			ServiceID:      svc.ID,
+			ServiceVersion: &svc.Meta.Version,
+			Spec:           spec,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to update service %s: %w", fullName, err)
+		}
+	}
+
+	if prune {
+		for name, svc := range existing {
+			if wanted[name] {
+				continue
+			}
+			fmt.Fprintf(out, "Removing service %s\n", name)
+			if _, err := client.RemoveService(ctx, &api.RemoveServiceRequest{ServiceID: svc.ID}); err != nil {
+				return fmt.Errorf("failed to remove service %s: %w", name, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// resolveStackRefs replaces the network, secret and config names in a
+// service spec with their IDs
+func resolveStackRefs(spec *api.ServiceSpec, networkIDs, secretIDs, configIDs map[string]string) error {
+	for _, n := range spec.Task.Networks {
+		id, ok := networkIDs[n.Target]
+		if !ok {
+			return fmt.Errorf("network %s not found", n.Target)
+		}
+		n.Target = id
+	}
+	container := spec.Task.GetContainer()
+	for _, s := range container.Secrets {
+		id, ok := secretIDs[s.SecretName]
+		if !ok {
+			return fmt.Errorf("secret %s not found", s.SecretName)
+		}
+		s.SecretID = id
+	}
+	for _, c := range container.Configs {
+		id, ok := configIDs[c.ConfigName]
+		if !ok {
+			return fmt.Errorf("config %s not found", c.ConfigName)
+		}
+		c.ConfigID = id
+	}
+	return nil
+}
+
+// deployStackNetworks creates the stack's missing networks and returns the
+// IDs of every network its services use, by name
+func deployStackNetworks(ctx context.Context, client api.ControlClient, out io.Writer, stack string, file *composeFile) (map[string]string, error) {
+	resp, err := client.ListNetworks(ctx, &api.ListNetworksRequest{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list networks: %w", err)
+	}
+	ids := make(map[string]string, len(resp.Networks))
+	for _, n := range resp.Networks {
+		ids[n.Spec.Annotations.Name] = n.ID
+	}
+
+	specs := file.networkSpecs(stack)
+	names := make([]string, 0, len(specs))
+	for name := range specs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if _, ok := ids[name]; ok {
+			continue
+		}
+		fmt.Fprintf(out, "Creating network %s\n", name)
+		created, err := client.CreateNetwork(ctx, &api.CreateNetworkRequest{Spec: specs[name]})
+		if err != nil {
+			return nil, fmt.Errorf("failed to create network %s: %w", name, err)
+		}
+		ids[name] = created.Network.ID
+	}
+	return ids, nil
+}
+
+// deployStackSecrets creates the stack's missing secrets and returns the
+// IDs of all secrets, by name. Like Docker, it fails when a secret of the
+// same name exists with different content, since secrets are immutable.
+func deployStackSecrets(ctx context.Context, client api.ControlClient, out io.Writer, stack string, file *composeFile) (map[string]string, error) {
+	resp, err := client.ListSecrets(ctx, &api.ListSecretsRequest{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list secrets: %w", err)
+	}
+	ids := make(map[string]string, len(resp.Secrets))
+	existing := make(map[string]*api.Secret, len(resp.Secrets))
+	for _, s := range resp.Secrets {
+		ids[s.Spec.Annotations.Name] = s.ID
+		existing[s.Spec.Annotations.Name] = s
+	}
+
+	for _, key := range sortedObjectKeys(file.Secrets) {
+		obj := file.Secrets[key]
+		name := objectName(stack, key, obj)
+		if obj.External {
+			continue
+		}
+		data, err := file.objectData("secret", key, obj)
+		if err != nil {
+			return nil, err
+		}
+		if s := existing[name]; s != nil {
+			// Secret data is never listed, so let the manager compare it:
+			// it refuses any update that changes the data.
+			_, err := client.UpdateSecret(ctx, &api.UpdateSecretRequest{
+				SecretID:      s.ID,
+				SecretVersion: &s.Meta.Version,
+				Spec:          &api.SecretSpec{Annotations: s.Spec.Annotations, Data: data},
+			})
+			if status.Code(err) == codes.InvalidArgument {
+				return nil, fmt.Errorf("secret %s already exists with different content; secrets cannot be changed, so give it a new name", name)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("failed to check secret %s: %w", name, err)
+			}
+			continue
+		}
+		fmt.Fprintf(out, "Creating secret %s\n", name)
+		created, err := client.CreateSecret(ctx, &api.CreateSecretRequest{Spec: &api.SecretSpec{
+			Annotations: api.Annotations{Name: name, Labels: stackLabels(stack, obj.Labels)},
+			Data:        data,
+		}})
+		if err != nil {
+			return nil, fmt.Errorf("failed to create secret %s: %w", name, err)
+		}
+		ids[name] = created.Secret.ID
+	}
+	return ids, nil
+}
+
+// deployStackConfigs creates the stack's missing configs and returns the
+// IDs of all configs, by name. It fails when a config of the same name
+// exists with different content, since configs are immutable.
+func deployStackConfigs(ctx context.Context, client api.ControlClient, out io.Writer, stack string, file *composeFile) (map[string]string, error) {
+	resp, err := client.ListConfigs(ctx, &api.ListConfigsRequest{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list configs: %w", err)
+	}
+	ids := make(map[string]string, len(resp.Configs))
+	existing := make(map[string]*api.Config, len(resp.Configs))
+	for _, c := range resp.Configs {
+		ids[c.Spec.Annotations.Name] = c.ID
+		existing[c.Spec.Annotations.Name] = c
+	}
+
+	for _, key := range sortedObjectKeys(file.Configs) {
+		obj := file.Configs[key]
+		name := objectName(stack, key, obj)
+		if obj.External {
+			continue
+		}
+		data, err := file.objectData("config", key, obj)
+		if err != nil {
+			return nil, err
+		}
+		if c := existing[name]; c != nil {
+			if !bytes.Equal(c.Spec.Data, data) {
+				return nil, fmt.Errorf("config %s already exists with different content; configs cannot be changed, so give it a new name", name)
+			}
+			continue
+		}
+		fmt.Fprintf(out, "Creating config %s\n", name)
+		created, err := client.CreateConfig(ctx, &api.CreateConfigRequest{Spec: &api.ConfigSpec{
+			Annotations: api.Annotations{Name: name, Labels: stackLabels(stack, obj.Labels)},
+			Data:        data,
+		}})
+		if err != nil {
+			return nil, fmt.Errorf("failed to create config %s: %w", name, err)
+		}
+		ids[name] = created.Config.ID
+	}
+	return ids, nil
+}
+
+// sortedObjectKeys returns the declared secrets or configs in name order,
+// skipping empty declarations
+func sortedObjectKeys(objs map[string]*composeObject) []string {
+	keys := make([]string, 0, len(objs))
+	for k, obj := range objs {
+		if obj != nil {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// stackInfo is one stack as shown by "stack ls"
+type stackInfo struct {
+	Name     string `json:"name"`
+	Services int    `json:"services"`
+}
+
+// listStacks prints the stacks that have services
+func listStacks(ctx context.Context, client api.ControlClient, out io.Writer, format string) error {
+	resp, err := client.ListServices(ctx, &api.ListServicesRequest{})
+	if err != nil {
+		return fmt.Errorf("failed to list services: %w", err)
+	}
+
+	counts := map[string]int{}
+	for _, svc := range resp.Services {
+		if stack := svc.Spec.Annotations.Labels[stackNamespaceLabel]; stack != "" {
+			counts[stack]++
+		}
+	}
+	stacks := make([]stackInfo, 0, len(counts))
+	for name, n := range counts {
+		stacks = append(stacks, stackInfo{Name: name, Services: n})
+	}
+	sort.Slice(stacks, func(i, j int) bool { return stacks[i].Name < stacks[j].Name })
+
+	if format == "json" {
+		data, err := json.MarshalIndent(stacks, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal JSON: %w", err)
+		}
+		fmt.Fprintln(out, string(data))
+		return nil
+	}
+
+	if len(stacks) == 0 {
+		fmt.Fprintln(out, "No stacks found")
+		return nil
+	}
+	fmt.Fprintf(out, "%-30s %s\n", "NAME", "SERVICES")
+	for _, s := range stacks {
+		fmt.Fprintf(out, "%-30s %d\n", s.Name, s.Services)
+	}
+	return nil
+}
+
+// listStackTasks prints the tasks of a stack's services
+func listStackTasks(ctx context.Context, client api.ControlClient, out io.Writer, stack, format string, noTrunc bool) error {
+	svcResp, err := client.ListServices(ctx, &api.ListServicesRequest{
+		Filters: &api.ListServicesRequest_Filters{Labels: stackFilter(stack)},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list services: %w", err)
+	}
+	if len(svcResp.Services) == 0 {
+		return fmt.Errorf("stack %s not found", stack)
+	}
+
+	names := make(map[string]string, len(svcResp.Services))
+	ids := make([]string, 0, len(svcResp.Services))
+	for _, svc := range svcResp.Services {
+		names[svc.ID] = svc.Spec.Annotations.Name
+		ids = append(ids, svc.ID)
+	}
+
+	taskResp, err := client.ListTasks(ctx, &api.ListTasksRequest{
+		Filters: &api.ListTasksRequest_Filters{ServiceIDs: ids},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list tasks: %w", err)
+	}
+	tasks := taskResp.Tasks
+	sort.Slice(tasks, func(i, j int) bool {
+		a, b := names[tasks[i].ServiceID], names[tasks[j].ServiceID]
+		if a != b {
+			return a < b
+		}
+		return tasks[i].Slot < tasks[j].Slot
+	})
+
+	if format == "json" {
+		data, err := json.MarshalIndent(tasks, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal JSON: %w", err)
+		}
+		fmt.Fprintln(out, string(data))
+		return nil
+	}
+
+	if len(tasks) == 0 {
+		fmt.Fprintf(out, "No tasks found for stack %s\n", stack)
+		return nil
+	}
+
+	fmt.Fprintf(out, "%-14s %-30s %-12s %-14s %s\n", "ID", "NAME", "STATUS", "NODE", "IMAGE")
+	fmt.Fprintln(out, strings.Repeat("-", 90))
+	for _, task := range tasks {
+		taskID, nodeID := task.ID, task.NodeID
+		if !noTrunc {
+			taskID, nodeID = truncateID(taskID), truncateID(nodeID)
+		}
+		name := names[task.ServiceID]
+		if task.Slot > 0 {
+			name = fmt.Sprintf("%s.%d", name, task.Slot)
+		}
+		image := ""
+		if c := task.Spec.GetContainer(); c != nil {
+			image = c.Image
+		}
+		fmt.Fprintf(out, "%-14s %-30s %-12s %-14s %s\n", taskID, name, task.Status.State.String(), nodeID, image)
+	}
+	return nil
+}
+
+// truncateID shortens an ID to the 12 characters shown in tables
+func truncateID(id string) string {
+	if len(id) > 12 {
+		return id[:12]
+	}
+	return id
+}
+
+// removeStack removes the services, networks, secrets and configs of a stack
+func removeStack(ctx context.Context, client api.ControlClient, out io.Writer, stack string) error {
+	filter := stackFilter(stack)
+	found := false
+
+	services, err := client.ListServices(ctx, &api.ListServicesRequest{
+		Filters: &api.ListServicesRequest_Filters{Labels: filter},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list services: %w", err)
+	}
+	for _, svc := range services.Services {
+		found = true
+		fmt.Fprintf(out, "Removing service %s\n", svc.Spec.Annotations.Name)
+		if _, err := client.RemoveService(ctx, &api.RemoveServiceRequest{ServiceID: svc.ID}); err != nil {
+			return fmt.Errorf("failed to remove service %s: %w", svc.Spec.Annotations.Name, err)
+		}
+	}
+
+	secrets, err := client.ListSecrets(ctx, &api.ListSecretsRequest{
+		Filters: &api.ListSecretsRequest_Filters{Labels: filter},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list secrets: %w", err)
+	}
+	for _, s := range secrets.Secrets {
+		found = true
+		fmt.Fprintf(out, "Removing secret %s\n", s.Spec.Annotations.Name)
+		if _, err := client.RemoveSecret(ctx, &api.RemoveSecretRequest{SecretID: s.ID}); err != nil {
+			return fmt.Errorf("failed to remove secret %s: %w", s.Spec.Annotations.Name, err)
+		}
+	}
+
+	configs, err := client.ListConfigs(ctx, &api.ListConfigsRequest{
+		Filters: &api.ListConfigsRequest_Filters{Labels: filter},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list configs: %w", err)
+	}
+	for _, c := range configs.Configs {
+		found = true
+		fmt.Fprintf(out, "Removing config %s\n", c.Spec.Annotations.Name)
+		if _, err := client.RemoveConfig(ctx, &api.RemoveConfigRequest{ConfigID: c.ID}); err != nil {
+			return fmt.Errorf("failed to remove config %s: %w", c.Spec.Annotations.Name, err)
+		}
+	}
+
+	// Networks go last, once no service is attached to them
+	networks, err := client.ListNetworks(ctx, &api.ListNetworksRequest{
+		Filters: &api.ListNetworksRequest_Filters{Labels: filter},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list networks: %w", err)
+	}
+	for _, n := range networks.Networks {
+		found = true
+		fmt.Fprintf(out, "Removing network %s\n", n.Spec.Annotations.Name)
+		if _, err := client.RemoveNetwork(ctx, &api.RemoveNetworkRequest{NetworkID: n.ID}); err != nil {
+			return fmt.Errorf("failed to remove network %s: %w", n.Spec.Annotations.Name, err)
+		}
+	}
+
+	if !found {
+		return fmt.Errorf("stack %s not found", stack)
+	}
+	return nil
+}
@@ -0,0 +1,597 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	gogotypes "github.com/gogo/protobuf/types"
+	"github.com/moby/swarmkit/v2/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const testComposeFile = `
+version: "3.8"
+services:
+  web:
+    image: nginx:${TAG:-1.25}
+    command: nginx -g 'daemon off;'
+    environment:
+      MODE: production
+    networks:
+      - front
+    deploy:
+      replicas: 3
+      labels:
+        tier: web
+      resources:
+        limits: {cpus: "0.5", memory: 256M}
+        reservations: {memory: 128M}
+      placement:
+        constraints: [node.role == worker]
+        preferences:
+          - spread: node.labels.zone
+      update_config:
+        parallelism: 2
+        delay: 10s
+        failure_action: rollback
+        order: start-first
+    healthcheck:
+      test: curl -f http://localhost/
+      interval: 30s
+      retries: 3
+  db:
+    image: postgres:16
+    environment:
+      - POSTGRES_DB=app
+    networks:
+      back:
+        aliases: [database]
+    volumes:
+      - data:/var/lib/postgresql/data
+      - ./init:/docker-entrypoint-initdb.d:ro
+    secrets:
+      - db_password
+      - source: db_password
+        target: /etc/pg/password
+        mode: 0400
+    configs:
+      - pg_conf
+  worker:
+    image: busybox
+    entrypoint: ["/bin/sh", "-c"]
+    command: ["echo hello"]
+    deploy:
+      mode: global
+networks:
+  front:
+  back:
+    driver_opts:
+      encrypted: "true"
+volumes:
+  data:
+secrets:
+  db_password:
+    file: ./db_password.txt
+configs:
+  pg_conf:
+    external: true
+`
+
+func loadTestCompose(t *testing.T) *composeFile {
+	t.Helper()
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "db_password.txt"), []byte("s3cret"), 0600))
+	path := filepath.Join(dir, "compose.yml")
+	require.NoError(t, os.WriteFile(path, []byte(testComposeFile), 0644))
+	file, err := loadComposeFile(path)
+	require.NoError(t, err)
+	return file
+}
+
+func TestParseComposeFile_Interpolation(t *testing.T) {
+	lookup := func(vars map[string]string) func(string) (string, bool) {
+		return func(k string) (string, bool) {
+			v, ok := vars[k]
+			return v, ok
+		}
+	}
+	src := []byte("services:\n  web:\n    image: nginx:${TAG:-latest}\n    command: echo $$HOME $NAME\n")
+
+	file, err := parseComposeFile(src, lookup(nil))
+	require.NoError(t, err)
+	assert.Equal(t, "nginx:latest", file.Services["web"].Image)
+	assert.Equal(t, shellCommand{"echo", "$HOME"}, file.Services["web"].Command)
+
+	file, err = parseComposeFile(src, lookup(map[string]string{"TAG": "1.25", "NAME": "x"}))
+	require.NoError(t, err)
+	assert.Equal(t, "nginx:1.25", file.Services["web"].Image)
+	assert.Equal(t, shellCommand{"echo", "$HOME", "x"}, file.Services["web"].Command)
+
+	_, err = parseComposeFile([]byte("version: '3'\n"), lookup(nil))
+	assert.Error(t, err)
+}
+
+func TestComposeServiceSpec(t *testing.T) {
+	file := loadTestCompose(t)
+
+	web, err := file.serviceSpec("app", "web")
+	require.NoError(t, err)
+
+	// The base matches what "service create" builds for the same input
+	base, err := buildServiceSpec(serviceOptions{
+		Name:     "app_web",
+		Image:    "nginx:1.25",
+		Replicas: 3,
+		CPU:      0.5,
+		Memory:   "256M",
+		Env:      []string{"MODE=production"},
+		Args:     []string{"nginx", "-g", "daemon off;"},
+		Labels:   map[string]string{stackNamespaceLabel: "app", "tier": "web"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, base.Annotations, web.Annotations)
+	assert.Equal(t, base.Mode, web.Mode)
+	assert.Equal(t, base.Task.Resources.Limits, web.Task.Resources.Limits)
+
+	container := web.Task.GetContainer()
+	assert.Equal(t, "nginx:1.25", container.Image)
+	assert.Empty(t, container.Command)
+	assert.Equal(t, []string{"nginx", "-g", "daemon off;"}, container.Args)
+	assert.Equal(t, int64(128<<20), web.Task.Resources.Reservations.MemoryBytes)
+	assert.Equal(t, base.Task.Resources.Reservations.Generic, web.Task.Resources.Reservations.Generic, "reservations keep the microVM slot")
+	assert.Equal(t, []string{"node.role == worker"}, web.Task.Placement.Constraints)
+	assert.Equal(t, "node.labels.zone", web.Task.Placement.Preferences[0].GetSpread().SpreadDescriptor)
+	assert.Equal(t, &api.UpdateConfig{
+		Parallelism:   2,
+		Delay:         10 * time.Second,
+		FailureAction: api.UpdateConfig_ROLLBACK,
+		Order:         api.UpdateConfig_START_FIRST,
+	}, web.Update)
+	assert.Equal(t, &api.HealthConfig{
+		Test:     []string{"CMD-SHELL", "curl -f http://localhost/"},
+		Interval: gogotypes.DurationProto(30 * time.Second),
+		Retries:  3,
+	}, container.Healthcheck)
+	require.Len(t, web.Task.Networks, 1)
+	assert.Equal(t, "app_front", web.Task.Networks[0].Target)
+	assert.Equal(t, []string{"web"}, web.Task.Networks[0].Aliases)
+
+	db, err := file.serviceSpec("app", "db")
+	require.NoError(t, err)
+	container = db.Task.GetContainer()
+	assert.Equal(t, []string{"POSTGRES_DB=app"}, container.Env)
+	assert.Equal(t, []string{"db", "database"}, db.Task.Networks[0].Aliases)
+	require.Len(t, container.Mounts, 2)
+	assert.Equal(t, api.MountTypeVolume, container.Mounts[0].Type)
+	assert.Equal(t, "app_data", container.Mounts[0].Source)
+	assert.Equal(t, "app", container.Mounts[0].VolumeOptions.Labels[stackNamespaceLabel])
+	assert.Equal(t, api.MountTypeBind, container.Mounts[1].Type)
+	assert.Equal(t, filepath.Join(file.dir, "init"), container.Mounts[1].Source)
+	assert.True(t, container.Mounts[1].ReadOnly)
+	require.Len(t, container.Secrets, 2)
+	assert.Equal(t, "app_db_password", container.Secrets[0].SecretName)
+	assert.Equal(t, "/run/secrets/db_password", container.Secrets[0].GetFile().Name)
+	assert.Equal(t, os.FileMode(0444), container.Secrets[0].GetFile().Mode)
+	assert.Equal(t, "/etc/pg/password", container.Secrets[1].GetFile().Name)
+	assert.Equal(t, os.FileMode(0400), container.Secrets[1].GetFile().Mode)
+	require.Len(t, container.Configs, 1)
+	assert.Equal(t, "pg_conf", container.Configs[0].ConfigName, "external configs keep their name")
+
+	worker, err := file.serviceSpec("app", "worker")
+	require.NoError(t, err)
+	assert.NotNil(t, worker.GetGlobal())
+	assert.Equal(t, []string{"/bin/sh", "-c"}, worker.Task.GetContainer().Command)
+	assert.Equal(t, "app_default", worker.Task.Networks[0].Target)
+}
+
+func TestComposeServiceSpec_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		compose string
+	}{
+		{"missing image", "services:\n  web:\n    command: x\n"},
+		{"undeclared network", "services:\n  web:\n    image: a\n    networks: [nope]\n"},
+		{"undeclared volume", "services:\n  web:\n    image: a\n    volumes: [\"nope:/data\"]\n"},
+		{"undeclared secret", "services:\n  web:\n    image: a\n    secrets: [nope]\n"},
+		{"bad memory", "services:\n  web:\n    image: a\n    deploy:\n      resources:\n        limits: {memory: lots}\n"},
+		{"bad mode", "services:\n  web:\n    image: a\n    deploy: {mode: daemon}\n"},
+		{"bad update order", "services:\n  web:\n    image: a\n    deploy:\n      update_config: {order: random}\n"},
+		{"rollback on failed rollback", "services:\n  web:\n    image: a\n    deploy:\n      rollback_config: {failure_action: rollback}\n"},
+		{"bad healthcheck", "services:\n  web:\n    image: a\n    healthcheck:\n      test: [curl, localhost]\n"},
+		{"bad constraint", "services:\n  web:\n    image: a\n    deploy:\n      placement: {constraints: [\"node.labels.kvm\"]}\n"},
+		{"job with update_config", "services:\n  web:\n    image: a\n    deploy:\n      mode: replicated-job\n      update_config: {parallelism: 2}\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file, err := parseComposeFile([]byte(tt.compose), func(string) (string, bool) { return "", false })
+			require.NoError(t, err)
+			_, err = file.serviceSpec("app", "web")
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestComposeNetworkSpecs(t *testing.T) {
+	file := loadTestCompose(t)
+
+	specs := file.networkSpecs("app")
+	assert.Len(t, specs, 3)
+	assert.Equal(t, "overlay", specs["app_front"].DriverConfig.Name)
+	assert.Equal(t, map[string]string{"encrypted": "true"}, specs["app_back"].DriverConfig.Options)
+	assert.Equal(t, "app", specs["app_default"].Annotations.Labels[stackNamespaceLabel])
+}
+
+func TestSplitShellWords(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+	}{
+		{"echo hello", []string{"echo", "hello"}},
+		{`sh -c "echo 'a b'"`, []string{"sh", "-c", "echo 'a b'"}},
+		{`a\ b 'c\d'`, []string{"a b", `c\d`}},
+		{`''`, []string{""}},
+		{"  ", nil},
+	}
+	for _, tt := range tests {
+		got, err := splitShellWords(tt.in)
+		require.NoError(t, err, tt.in)
+		assert.Equal(t, tt.want, got, tt.in)
+	}
+
+	_, err := splitShellWords(`echo "open`)
+	assert.Error(t, err)
+}
+
+// fakeControl is an in-memory SwarmKit control API for the calls the
+// stack, secret, config and node commands make
+type fakeControl struct {
+	api.ControlClient
+
+	nextID   int
+	services map[string]*api.Service
+	networks map[string]*api.Network
+	secrets  map[string]*api.Secret
+	configs  map[string]*api.Config
+	nodes    map[string]*api.Node
+	tasks    []*api.Task
+	calls    []string
+}
+
+func newFakeControl() *fakeControl {
+	return &fakeControl{
+		services: map[string]*api.Service{},
+		networks: map[string]*api.Network{},
+		secrets:  map[string]*api.Secret{},
+		configs:  map[string]*api.Config{},
+		nodes:    map[string]*api.Node{},
+	}
+}
+
+func (f *fakeControl) id() string {
+	f.nextID++
+	return fmt.Sprintf("id%d", f.nextID)
+}
+
+func matchLabels(labels, filter map[string]string) bool {
+	for k, v := range filter {
+		if labels[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+func (f *fakeControl) ListServices(_ context.Context, r *api.ListServicesRequest, _ ...grpc.CallOption) (*api.ListServicesResponse, error) {
+	resp := &api.ListServicesResponse{}
+	for _, s := range f.services {
+		if r.Filters == nil || matchLabels(s.Spec.Annotations.Labels, r.Filters.Labels) {
+			resp.Services = append(resp.Services, s)
+		}
+	}
+	return resp, nil
+}
+
+func (f *fakeControl) CreateService(_ context.Context, r *api.CreateServiceRequest, _ ...grpc.CallOption) (*api.CreateServiceResponse, error) {
+	svc := &api.Service{ID: f.id(), Spec: *r.Spec.Copy()}
+	f.services[svc.ID] = svc
+	f.calls = append(f.calls, "create service "+r.Spec.Annotations.Name)
+	return &api.CreateServiceResponse{Service: svc}, nil
+}
+
+func (f *fakeControl) GetService(_ context.Context, r *api.GetServiceRequest, _ ...grpc.CallOption) (*api.GetServiceResponse, error) {
+	svc, ok := f.services[r.ServiceID]
+	if !ok {
+		return nil, fmt.Errorf("service %s not found", r.ServiceID)
+	}
+	return &api.GetServiceResponse{Service: svc}, nil
+}
+
+func (f *fakeControl) UpdateService(_ context.Context, r *api.UpdateServiceRequest, _ ...grpc.CallOption) (*api.UpdateServiceResponse, error) {
+	svc := f.services[r.ServiceID]
+	if r.ServiceVersion != nil && r.ServiceVersion.Index != svc.Meta.Version.Index {
+		return nil, fmt.Errorf("update out of sequence")
+	}
+	if r.Rollback == api.UpdateServiceRequest_PREVIOUS {
+		svc.Spec, svc.PreviousSpec = *svc.PreviousSpec, nil
+		svc.UpdateStatus = &api.UpdateStatus{State: api.UpdateStatus_ROLLBACK_STARTED, Message: "manually requested rollback"}
+		f.calls = append(f.calls, "rollback service "+svc.Spec.Annotations.Name)
+		return &api.UpdateServiceResponse{Service: svc}, nil
+	}
+	svc.PreviousSpec = svc.Spec.Copy()
+	svc.Spec = *r.Spec.Copy()
+	svc.Meta.Version.Index++
+	f.calls = append(f.calls, "update service "+r.Spec.Annotations.Name)
+	return &api.UpdateServiceResponse{Service: svc}, nil
+}
+
+func (f *fakeControl) RemoveService(_ context.Context, r *api.RemoveServiceRequest, _ ...grpc.CallOption) (*api.RemoveServiceResponse, error) {
+	f.calls = append(f.calls, "remove service "+f.services[r.ServiceID].Spec.Annotations.Name)
+	delete(f.services, r.ServiceID)
+	return &api.RemoveServiceResponse{}, nil
+}
+
+func (f *fakeControl) ListNetworks(_ context.Context, r *api.ListNetworksRequest, _ ...grpc.CallOption) (*api.ListNetworksResponse, error) {
+	resp := &api.ListNetworksResponse{}
+	for _, n := range f.networks {
+		if r.Filters == nil || matchLabels(n.Spec.Annotations.Labels, r.Filters.Labels) {
+			resp.Networks = append(resp.Networks, n)
+		}
+	}
+	return resp, nil
+}
+
+func (f *fakeControl) CreateNetwork(_ context.Context, r *api.CreateNetworkRequest, _ ...grpc.CallOption) (*api.CreateNetworkResponse, error) {
+	n := &api.Network{ID: f.id(), Spec: *r.Spec.Copy()}
+	f.networks[n.ID] = n
+	f.calls = append(f.calls, "create network "+r.Spec.Annotations.Name)
+	return &api.CreateNetworkResponse{Network: n}, nil
+}
+
+func (f *fakeControl) RemoveNetwork(_ context.Context, r *api.RemoveNetworkRequest, _ ...grpc.CallOption) (*api.RemoveNetworkResponse, error) {
+	f.calls = append(f.calls, "remove network "+f.networks[r.NetworkID].Spec.Annotations.Name)
+	delete(f.networks, r.NetworkID)
+	return &api.RemoveNetworkResponse{}, nil
+}
+
+func (f *fakeControl) ListSecrets(_ context.Context, r *api.ListSecretsRequest, _ ...grpc.CallOption) (*api.ListSecretsResponse, error) {
+	resp := &api.ListSecretsResponse{}
+	for _, s := range f.secrets {
+		if r.Filters == nil || matchLabels(s.Spec.Annotations.Labels, r.Filters.Labels) {
+			resp.Secrets = append(resp.Secrets, s)
+		}
+	}
+	return resp, nil
+}
+
+func (f *fakeControl) CreateSecret(_ context.Context, r *api.CreateSecretRequest, _ ...grpc.CallOption) (*api.CreateSecretResponse, error) {
+	s := &api.Secret{ID: f.id(), Spec: *r.Spec.Copy()}
+	f.secrets[s.ID] = s
+	f.calls = append(f.calls, "create secret "+r.Spec.Annotations.Name)
+	return &api.CreateSecretResponse{Secret: s}, nil
+}
+
+// UpdateSecret allows label changes only, as the SwarmKit manager does
+func (f *fakeControl) UpdateSecret(_ context.Context, r *api.UpdateSecretRequest, _ ...grpc.CallOption) (*api.UpdateSecretResponse, error) {
+	s := f.secrets[r.SecretID]
+	if s.Spec.Annotations.Name != r.Spec.Annotations.Name || (r.Spec.Data != nil && !bytes.Equal(r.Spec.Data, s.Spec.Data)) {
+		return nil, status.Errorf(codes.InvalidArgument, "only updates to Labels are allowed")
+	}
+	s.Spec.Annotations.Labels = r.Spec.Annotations.Labels
+	s.Meta.Version.Index++
+	f.calls = append(f.calls, "update secret "+s.Spec.Annotations.Name)
+	return &api.UpdateSecretResponse{Secret: s}, nil
+}
+
+func (f *fakeControl) RemoveSecret(_ context.Context, r *api.RemoveSecretRequest, _ ...grpc.CallOption) (*api.RemoveSecretResponse, error) {
+	f.calls = append(f.calls, "remove secret "+f.secrets[r.SecretID].Spec.Annotations.Name)
+	delete(f.secrets, r.SecretID)
+	return &api.RemoveSecretResponse{}, nil
+}
+
+func (f *fakeControl) ListConfigs(_ context.Context, r *api.ListConfigsRequest, _ ...grpc.CallOption) (*api.ListConfigsResponse, error) {
+	resp := &api.ListConfigsResponse{}
+	for _, c := range f.configs {
+		if r.Filters == nil || matchLabels(c.Spec.Annotations.Labels, r.Filters.Labels) {
+			resp.Configs = append(resp.Configs, c)
+		}
+	}
+	return resp, nil
+}
+
+func (f *fakeControl) CreateConfig(_ context.Context, r *api.CreateConfigRequest, _ ...grpc.CallOption) (*api.CreateConfigResponse, error) {
+	c := &api.Config{ID: f.id(), Spec: *r.Spec.Copy()}
+	f.configs[c.ID] = c
+	f.calls = append(f.calls, "create config "+r.Spec.Annotations.Name)
+	return &api.CreateConfigResponse{Config: c}, nil
+}
+
+func (f *fakeControl) RemoveConfig(_ context.Context, r *api.RemoveConfigRequest, _ ...grpc.CallOption) (*api.RemoveConfigResponse, error) {
+	f.calls = append(f.calls, "remove config "+f.configs[r.ConfigID].Spec.Annotations.Name)
+	delete(f.configs, r.ConfigID)
+	return &api.RemoveConfigResponse{}, nil
+}
+
+func (f *fakeControl) GetNode(_ context.Context, r *api.GetNodeRequest, _ ...grpc.CallOption) (*api.GetNodeResponse, error) {
+	n, ok := f.nodes[r.NodeID]
+	if !ok {
+		return nil, fmt.Errorf("node %s not found", r.NodeID)
+	}
+	return &api.GetNodeResponse{Node: n}, nil
+}
+
+func (f *fakeControl) ListNodes(_ context.Context, _ *api.ListNodesRequest, _ ...grpc.CallOption) (*api.ListNodesResponse, error) {
+	resp := &api.ListNodesResponse{}
+	for _, n := range f.nodes {
+		resp.Nodes = append(resp.Nodes, n)
+	}
+	return resp, nil
+}
+
+func (f *fakeControl) UpdateNode(_ context.Context, r *api.UpdateNodeRequest, _ ...grpc.CallOption) (*api.UpdateNodeResponse, error) {
+	n, ok := f.nodes[r.NodeID]
+	if !ok {
+		return nil, fmt.Errorf("node %s not found", r.NodeID)
+	}
+	if r.NodeVersion == nil || r.NodeVersion.Index != n.Meta.Version.Index {
+		return nil, fmt.Errorf("update out of sequence")
+	}
+	n.Spec = *r.Spec.Copy()
+	n.Meta.Version.Index++
+	f.calls = append(f.calls, "update node "+n.ID)
+	return &api.UpdateNodeResponse{Node: n}, nil
+}
+
+func (f *fakeControl) ListTasks(_ context.Context, r *api.ListTasksRequest, _ ...grpc.CallOption) (*api.ListTasksResponse, error) {
+	resp := &api.ListTasksResponse{}
+	for _, task := range f.tasks {
+		for _, id := range r.Filters.ServiceIDs {
+			if task.ServiceID == id {
+				resp.Tasks = append(resp.Tasks, task)
+			}
+		}
+	}
+	return resp, nil
+}
+
+func (f *fakeControl) serviceByName(name string) *api.Service {
+	for _, s := range f.services {
+		if s.Spec.Annotations.Name == name {
+			return s
+		}
+	}
+	return nil
+}
+
+func TestDeployStack(t *testing.T) {
+	ctx := context.Background()
+	fake := newFakeControl()
+	fake.configs["cfg"] = &api.Config{ID: "cfg", Spec: api.ConfigSpec{Annotations: api.Annotations{Name: "pg_conf"}}}
+	var out bytes.Buffer
+
+	file := loadTestCompose(t)
+	require.NoError(t, deployStack(ctx, fake, &out, "app", file, false))
+	assert.ElementsMatch(t, []string{
+		"create network app_back",
+		"create network app_default",
+		"create network app_front",
+		"create secret app_db_password",
+		"create service app_db",
+		"create service app_web",
+		"create service app_worker",
+	}, fake.calls)
+
+	// References point at the objects' IDs
+	db := fake.serviceByName("app_db")
+	require.NotNil(t, db)
+	assert.Equal(t, fake.networks[db.Spec.Task.Networks[0].Target].Spec.Annotations.Name, "app_back")
+	secret := db.Spec.Task.GetContainer().Secrets[0]
+	assert.Equal(t, []byte("s3cret"), fake.secrets[secret.SecretID].Spec.Data)
+	assert.Equal(t, "cfg", db.Spec.Task.GetContainer().Configs[0].ConfigID)
+
+	// An unchanged redeploy only has the manager check the secret's content
+	fake.calls = nil
+	require.NoError(t, deployStack(ctx, fake, &out, "app", file, false))
+	assert.Equal(t, []string{"update secret app_db_password"}, fake.calls)
+
+	// Only the changed service is updated, and forced restarts are kept
+	fake.serviceByName("app_web").Spec.Task.ForceUpdate = 2
+	*file.Services["web"].Deploy.Replicas = 5
+	delete(file.Services, "worker")
+	fake.calls = nil
+	require.NoError(t, deployStack(ctx, fake, &out, "app", file, false))
+	assert.Equal(t, []string{"update secret app_db_password", "update service app_web"}, fake.calls)
+	web := fake.serviceByName("app_web")
+	assert.Equal(t, uint64(5), web.Spec.GetReplicated().Replicas)
+	assert.Equal(t, uint64(2), web.Spec.Task.ForceUpdate)
+
+	// Pruning removes services no longer in the file
+	fake.calls = nil
+	require.NoError(t, deployStack(ctx, fake, &out, "app", file, true))
+	assert.Equal(t, []string{"update secret app_db_password", "remove service app_worker"}, fake.calls)
+}
+
+func TestDeployStack_ChangedContent(t *testing.T) {
+	ctx := context.Background()
+	fake := newFakeControl()
+	fake.configs["cfg"] = &api.Config{ID: "cfg", Spec: api.ConfigSpec{Annotations: api.Annotations{Name: "pg_conf"}}}
+	var out bytes.Buffer
+	file := loadTestCompose(t)
+	require.NoError(t, deployStack(ctx, fake, &out, "app", file, false))
+
+	// A changed secret is refused rather than silently left stale
+	require.NoError(t, os.WriteFile(filepath.Join(file.dir, "db_password.txt"), []byte("changed"), 0600))
+	fake.calls = nil
+	err := deployStack(ctx, fake, &out, "app", file, false)
+	assert.ErrorContains(t, err, "secret app_db_password already exists with different content")
+	assert.Empty(t, fake.calls)
+
+	// So is a changed config
+	require.NoError(t, os.WriteFile(filepath.Join(file.dir, "db_password.txt"), []byte("s3cret"), 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(file.dir, "app.conf"), []byte("new"), 0644))
+	file.Configs["app_conf"] = &composeObject{File: "app.conf"}
+	fake.configs["old"] = &api.Config{ID: "old", Spec: api.ConfigSpec{Annotations: api.Annotations{Name: "app_app_conf"}, Data: []byte("old")}}
+	err = deployStack(ctx, fake, &out, "app", file, false)
+	assert.ErrorContains(t, err, "config app_app_conf already exists with different content")
+}
+
+func TestStackListPSAndRemove(t *testing.T) {
+	ctx := context.Background()
+	fake := newFakeControl()
+	fake.configs["cfg"] = &api.Config{ID: "cfg", Spec: api.ConfigSpec{Annotations: api.Annotations{Name: "pg_conf"}}}
+	fake.services["other"] = &api.Service{ID: "other", Spec: api.ServiceSpec{Annotations: api.Annotations{Name: "standalone"}}}
+	var out bytes.Buffer
+	require.NoError(t, deployStack(ctx, fake, &out, "app", loadTestCompose(t), false))
+
+	out.Reset()
+	require.NoError(t, listStacks(ctx, fake, &out, "table"))
+	assert.Contains(t, out.String(), "app")
+	assert.Regexp(t, `app\s+3`, out.String())
+
+	web := fake.serviceByName("app_web")
+	fake.tasks = []*api.Task{
+		{ID: "task1234567890", ServiceID: web.ID, Slot: 1, NodeID: "node1", Status: api.TaskStatus{State: api.TaskStateRunning},
+			Spec: api.TaskSpec{Runtime: &api.TaskSpec_Container{Container: &api.ContainerSpec{Image: "nginx:1.25"}}}},
+		{ID: "unrelated", ServiceID: "other"},
+	}
+	out.Reset()
+	require.NoError(t, listStackTasks(ctx, fake, &out, "app", "table", false))
+	assert.Contains(t, out.String(), "app_web.1")
+	assert.Contains(t, out.String(), "task12345678 ")
+	assert.NotContains(t, out.String(), "unrelated")
+
+	fake.calls = nil
+	require.NoError(t, removeStack(ctx, fake, &out, "app"))
+	assert.Len(t, fake.services, 1, "services outside the stack are kept")
+	assert.Empty(t, fake.networks)
+	assert.Empty(t, fake.secrets)
+	assert.Len(t, fake.configs, 1, "external configs are kept")
+	assert.Equal(t, "remove network", fake.calls[len(fake.calls)-1][:len("remove network")])
+
+	assert.Error(t, removeStack(ctx, fake, &out, "app"))
+	assert.Error(t, listStackTasks(ctx, fake, &out, "app", "table", false))
+}
+
+func TestNewStackCommand(t *testing.T) {
+	cmd := newStackCommand()
+	assert.Equal(t, "stack", cmd.Use)
+
+	names := map[string]bool{}
+	for _, sub := range cmd.Commands() {
+		names[sub.Name()] = true
+	}
+	assert.Equal(t, map[string]bool{"deploy": true, "ls": true, "ps": true, "rm": true}, names)
+
+	deploy, _, err := cmd.Find([]string{"deploy"})
+	require.NoError(t, err)
+	assert.NotNil(t, deploy.Flags().Lookup("compose-file"))
+	assert.NotNil(t, deploy.Flags().Lookup("prune"))
+}
@@ -204,6 +204,9 @@ func inspectTask(taskID, format string, pretty bool) error {
 		if task.Spec.GetContainer() != nil {
 			fmt.Printf("Image: %s\n", task.Spec.GetContainer().Image)
 		}
+		if cs := task.Status.GetContainer(); cs != nil && task.Status.State > api.TaskStateRunning {
+			fmt.Printf("Exit Code: %d\n", cs.ExitCode)
+		}
 		if task.Status.Err != "" {
 			fmt.Printf("Error: %s\n", task.Status.Err)
 		}
@@ -22,11 +22,15 @@ func newVMCommand() *cobra.Command {
 		Short: "Manage Firecracker microVMs",
 		Long: `Manage Firecracker microVMs in the SwarmCracker cluster.
 
-These commands provide VM-level operations like creating, listing, stopping, and viewing logs.`,
+These commands provide VM-level operations like creating, running, attaching to,
+listing, stopping, and viewing logs.`,
 	}
 
 	// Add subcommands
 	cmd.AddCommand(newVMCreateCommand())
+	cmd.AddCommand(newVMRunCommand())
+	cmd.AddCommand(newVMAttachCommand())
+	cmd.AddCommand(newVMShimCommand())
 	cmd.AddCommand(newVMListCommand())
 	cmd.AddCommand(newVMStopCommand())
 	cmd.AddCommand(newVMLogsCommand())
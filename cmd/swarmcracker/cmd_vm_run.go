@@ -0,0 +1,555 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/restuhaqza/swarmcracker/pkg/console"
+	"github.com/restuhaqza/swarmcracker/pkg/executor"
+	"github.com/restuhaqza/swarmcracker/pkg/image"
+	"github.com/restuhaqza/swarmcracker/pkg/runtime"
+	"github.com/restuhaqza/swarmcracker/pkg/types"
+	"github.com/restuhaqza/swarmcracker/pkg/vmexit"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+// vmStartTimeout bounds pulling the image and booting the VM
+const vmStartTimeout = 5 * time.Minute
+
+// vmRunOptions describe a VM started by "vm run". The shim that owns the
+// VM gets them as JSON.
+type vmRunOptions struct {
+	Name     string   `json:"name"`
+	Image    string   `json:"image"`
+	Command  []string `json:"command,omitempty"`
+	VCPUs    int      `json:"vcpus"`
+	MemoryMB int      `json:"memory_mb"`
+	Env      []string `json:"env,omitempty"`
+	Remove   bool     `json:"remove,omitempty"`
+}
+
+// exitCodeError makes the CLI exit with a workload's exit code.
+type exitCodeError struct {
+	code int
+}
+
+func (e *exitCodeError) Error() string {
+	return fmt.Sprintf("exit status %d", e.code)
+}
+
+// newVMRunCommand creates the VM run command
+func newVMRunCommand() *cobra.Command {
+	var (
+		opts        vmRunOptions
+		interactive bool
+		tty         bool
+		detach      bool
+		detachKeys  string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "run [flags] <image> [-- command...]",
+		Short: "Run a one-shot command in a microVM",
+		Long: `Run a command in a new Firecracker microVM and stream its console.
+
+The VM's serial console is attached to the terminal until the workload exits,
+and the command exits with the workload's exit code. With -i the terminal's
+input goes to the VM; with -t the terminal is put in raw mode so every key,
+Ctrl-C included, reaches the guest.
+
+Type the detach keys (default ctrl-p,ctrl-q) to leave the VM running and
+reattach later with "swarmcracker vm attach". Each VM runs on its own copy of
+the image. With --rm that copy, the TAP device and sockets are removed once
+the VM exits, even if detached.
+
+Example:
+  swarmcracker vm run alpine:latest -- echo hello
+  swarmcracker vm run -it --rm alpine:latest -- /bin/sh
+  swarmcracker vm run -d --name batch-1 myorg/batch:latest -- ./process --all`,
+		Args: cobra.MinimumNArgs(1),
+		PreRun: func(cmd *cobra.Command, args []string) {
+			setupLogging(logLevel)
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			opts.Image = args[0]
+			opts.Command = args[1:]
+			if opts.Name == "" {
+				opts.Name = fmt.Sprintf("task-%d", time.Now().Unix())
+			}
+
+			var keys []byte
+			if interactive {
+				var err error
+				if keys, err = console.ParseDetachKeys(detachKeys); err != nil {
+					return err
+				}
+			}
+
+			err := runVM(opts, interactive, tty, detach, keys)
+			silenceExitCode(cmd, err)
+			return err
+		},
+	}
+
+	// Everything after the image is the command
+	cmd.Flags().SetInterspersed(false)
+
+	cmd.Flags().StringVarP(&opts.Name, "name", "n", "", "Name for the VM (auto-generated if not specified)")
+	cmd.Flags().IntVar(&opts.VCPUs, "cpu", 1, "Number of vCPUs to allocate")
+	cmd.Flags().IntVarP(&opts.MemoryMB, "memory", "m", 512, "Memory in MB to allocate")
+	cmd.Flags().StringArrayVarP(&opts.Env, "env", "e", []string{}, "Environment variables (e.g., -e KEY=value)")
+	cmd.Flags().BoolVarP(&interactive, "interactive", "i", false, "Send the terminal's input to the VM console")
+	cmd.Flags().BoolVarP(&tty, "tty", "t", false, "Put the terminal in raw mode while attached")
+	cmd.Flags().BoolVar(&opts.Remove, "rm", false, "Remove the VM's rootfs copy, TAP device and sockets when it exits")
+	cmd.Flags().BoolVarP(&detach, "detach", "d", false, "Start the VM in the background and print its ID")
+	cmd.Flags().StringVar(&detachKeys, "detach-keys", console.DefaultDetachKeys, "Key sequence that detaches from the console")
+
+	return cmd
+}
+
+// newVMAttachCommand creates the VM attach command
+func newVMAttachCommand() *cobra.Command {
+	var (
+		noStdin    bool
+		detachKeys string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "attach <vm-id>",
+		Short: "Attach to the console of a running microVM",
+		Long: `Attach the terminal to the serial console of a VM started with "vm run".
+
+Type the detach keys (default ctrl-p,ctrl-q) to detach again. If the workload
+exits while attached, the command exits with its exit code.
+
+Example:
+  swarmcracker vm attach batch-1
+  swarmcracker vm attach --no-stdin batch-1`,
+		Args: cobra.ExactArgs(1),
+		PreRun: func(cmd *cobra.Command, args []string) {
+			setupLogging(logLevel)
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			keys, err := console.ParseDetachKeys(detachKeys)
+			if err != nil {
+				return err
+			}
+
+			cfg, err := loadConfigWithOverrides(cfgFile)
+			if err != nil {
+				return fmt.Errorf("failed to load configuration: %w", err)
+			}
+
+			conn, err := net.Dial("unix", console.SocketPath(cfg.Executor.SocketDir, args[0]))
+			if err != nil {
+				return fmt.Errorf("VM %s has no console to attach to (only running VMs started with vm run have one): %w", args[0], err)
+			}
+
+			_, err = attachConsole(conn, args[0], !noStdin, true, keys)
+			silenceExitCode(cmd, err)
+			return err
+		},
+	}
+
+	cmd.Flags().BoolVar(&noStdin, "no-stdin", false, "Only watch the console, do not send input")
+	cmd.Flags().StringVar(&detachKeys, "detach-keys", console.DefaultDetachKeys, "Key sequence that detaches from the console")
+
+	return cmd
+}
+
+// newVMShimCommand creates the hidden command that owns a VM started with
+// "vm run": it boots the VM, serves its console and cleans up once it
+// exits. It runs in its own session, so it outlives a detached client.
+func newVMShimCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:          "shim <options>",
+		Hidden:       true,
+		SilenceUsage: true,
+		Args:         cobra.ExactArgs(1),
+		PreRun: func(cmd *cobra.Command, args []string) {
+			setupLogging(logLevel)
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var opts vmRunOptions
+			if err := json.Unmarshal([]byte(args[0]), &opts); err != nil {
+				return fmt.Errorf("invalid shim options: %w", err)
+			}
+			return runVMShim(opts)
+		},
+	}
+}
+
+// runVM starts a shim for the VM, waits for its console and attaches to it
+// unless detached
+func runVM(opts vmRunOptions, interactive, tty, detach bool, keys []byte) error {
+	cfg, err := loadConfigWithOverrides(cfgFile)
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+	stateMgr, err := runtime.NewStateManager("")
+	if err != nil {
+		return fmt.Errorf("failed to create state manager: %w", err)
+	}
+
+	shim, err := startVMShim(opts, filepath.Join(stateMgr.GetLogDir(), opts.Name+".log"))
+	if err != nil {
+		return err
+	}
+	shimDone := make(chan error, 1)
+	go func() {
+		shimDone <- shim.Wait()
+	}()
+
+	conn, err := dialConsole(console.SocketPath(cfg.Executor.SocketDir, opts.Name), shimDone, vmStartTimeout)
+	if err != nil {
+		return fmt.Errorf("VM %s failed to start (see: swarmcracker vm logs %s): %w", opts.Name, opts.Name, err)
+	}
+
+	if detach {
+		conn.Close()
+		fmt.Println(opts.Name)
+		return nil
+	}
+
+	// Without a raw terminal, Ctrl-C stops the VM rather than the client
+	if !tty {
+		sigCh := make(chan os.Signal, 1)
+		signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+		defer signal.Stop(sigCh)
+		go func() {
+			for range sigCh {
+				shim.Process.Signal(syscall.SIGTERM)
+			}
+		}()
+	}
+
+	detached, err := attachConsole(conn, opts.Name, interactive, tty, keys)
+	var exitErr *exitCodeError
+	if detached || (err != nil && !errors.As(err, &exitErr)) {
+		return err
+	}
+
+	// Wait for the shim to clean up after the VM
+	if shimErr := <-shimDone; shimErr != nil {
+		return fmt.Errorf("VM %s failed (see: swarmcracker vm logs %s): %w", opts.Name, opts.Name, shimErr)
+	}
+	return err
+}
+
+// attachConsole attaches the terminal to a VM console until the user
+// detaches or the VM exits. A failed workload's exit code is returned as
+// an *exitCodeError.
+func attachConsole(conn net.Conn, vmID string, interactive, tty bool, keys []byte) (bool, error) {
+	defer conn.Close()
+
+	var in io.Reader
+	if interactive {
+		in = os.Stdin
+	}
+	if tty && console.IsTerminal(int(os.Stdin.Fd())) {
+		restore, err := console.MakeRaw(int(os.Stdin.Fd()))
+		if err != nil {
+			return false, err
+		}
+		defer restore()
+	}
+
+	watcher := vmexit.NewWatcher()
+	detached, err := console.Attach(conn, in, io.MultiWriter(os.Stdout, watcher), keys)
+	if err != nil {
+		return false, fmt.Errorf("console of VM %s failed: %w", vmID, err)
+	}
+	if detached {
+		fmt.Fprintf(os.Stderr, "\r\nDetached from %s, reattach with: swarmcracker vm attach %s\r\n", vmID, vmID)
+		return true, nil
+	}
+
+	if code := workloadExitCode(watcher.Status()); code != 0 {
+		return false, &exitCodeError{code: code}
+	}
+	return false, nil
+}
+
+// startVMShim starts the shim owning the VM in its own session, logging to
+// logPath, which also keeps the VM's console output
+func startVMShim(opts vmRunOptions, logPath string) (*exec.Cmd, error) {
+	self, err := os.Executable()
+	if err != nil {
+		return nil, fmt.Errorf("failed to find swarmcracker binary: %w", err)
+	}
+	data, err := json.Marshal(opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode shim options: %w", err)
+	}
+
+	logFile, err := os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open VM log: %w", err)
+	}
+	defer logFile.Close()
+
+	args := []string{"--log-level", logLevel}
+	if cfgFile != "" {
+		args = append(args, "--config", cfgFile)
+	}
+	if kernelPath != "" {
+		args = append(args, "--kernel", kernelPath)
+	}
+	if rootfsDir != "" {
+		args = append(args, "--rootfs-dir", rootfsDir)
+	}
+	args = append(args, "vm", "shim", string(data))
+
+	shim := exec.Command(self, args...)
+	shim.Stdout = logFile
+	shim.Stderr = logFile
+	shim.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	if err := shim.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start VM shim: %w", err)
+	}
+	return shim, nil
+}
+
+// dialConsole connects to a VM console as soon as the shim serves it
+func dialConsole(socketPath string, shimDone <-chan error, timeout time.Duration) (net.Conn, error) {
+	deadline := time.After(timeout)
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		if conn, err := net.Dial("unix", socketPath); err == nil {
+			return conn, nil
+		}
+		select {
+		case err := <-shimDone:
+			if err == nil {
+				err = fmt.Errorf("shim exited")
+			}
+			return nil, err
+		case <-deadline:
+			return nil, fmt.Errorf("timed out waiting for console")
+		case <-ticker.C:
+		}
+	}
+}
+
+// runVMShim boots a VM with its console on a relay, serves the console
+// until the VM exits and then cleans up after it
+func runVMShim(opts vmRunOptions) error {
+	cfg, err := loadConfigWithOverrides(cfgFile)
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+	stateMgr, err := runtime.NewStateManager("")
+	if err != nil {
+		return fmt.Errorf("failed to create state manager: %w", err)
+	}
+
+	// The console is served before the VM boots, so clients see all of it
+	socketPath := console.SocketPath(cfg.Executor.SocketDir, opts.Name)
+	if err := os.MkdirAll(filepath.Dir(socketPath), 0755); err != nil {
+		return fmt.Errorf("failed to create socket dir: %w", err)
+	}
+	os.Remove(socketPath)
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		return fmt.Errorf("failed to listen on console socket: %w", err)
+	}
+	defer os.Remove(socketPath)
+	defer listener.Close()
+	if err := os.Chmod(socketPath, 0600); err != nil {
+		return fmt.Errorf("failed to restrict console socket: %w", err)
+	}
+
+	inR, inW, err := os.Pipe()
+	if err != nil {
+		return fmt.Errorf("failed to create console pipe: %w", err)
+	}
+	defer inW.Close()
+	outR, outW, err := os.Pipe()
+	if err != nil {
+		inR.Close()
+		return fmt.Errorf("failed to create console pipe: %w", err)
+	}
+	defer outR.Close()
+
+	vmExec, err := createConsoleExecutor(cfg, inR, outW)
+	if err != nil {
+		inR.Close()
+		outW.Close()
+		return fmt.Errorf("failed to create executor: %w", err)
+	}
+	defer vmExec.Close()
+
+	// Console output goes to the shim's stdout, the VM's log file
+	relay := console.NewRelay(inW, os.Stdout)
+	go relay.Serve(listener)
+
+	task := createMockTask(opts.Image, opts.VCPUs, opts.MemoryMB, opts.Env)
+	task.ID = opts.Name
+	container := task.Spec.Runtime.(*types.Container)
+	container.Command = opts.Command
+
+	rootfsDir := cfg.Executor.RootfsDir
+	ctx, cancel := context.WithTimeout(context.Background(), vmStartTimeout)
+	err = startShimTask(ctx, vmExec, task, rootfsDir)
+	cancel()
+	// Firecracker holds its ends of the console now, so the output ends
+	// when it exits
+	inR.Close()
+	outW.Close()
+	if err != nil {
+		cleanupShimTask(vmExec, task, rootfsDir, opts.Remove)
+		return err
+	}
+
+	vmState := &runtime.VMState{
+		ID:         task.ID,
+		SocketPath: filepath.Join(cfg.Executor.SocketDir, task.ID+".sock"),
+		Image:      container.Image,
+		Command:    opts.Command,
+		Status:     "running",
+		VCPUs:      opts.VCPUs,
+		MemoryMB:   opts.MemoryMB,
+		KernelPath: cfg.Executor.KernelPath,
+		RootfsPath: task.Annotations["rootfs"],
+		LogPath:    filepath.Join(stateMgr.GetLogDir(), task.ID+".log"),
+	}
+	if status, err := vmExec.Describe(context.Background(), task); err == nil {
+		if runtimeStatus, ok := status.RuntimeStatus.(map[string]interface{}); ok {
+			vmState.PID, _ = runtimeStatus["pid"].(int)
+		}
+	}
+	if len(task.Networks) > 0 {
+		vmState.NetworkID = task.Networks[0].Network.ID
+		vmState.IPAddresses = task.Networks[0].Addresses
+	}
+	if err := stateMgr.Add(vmState); err != nil {
+		log.Warn().Err(err).Msg("Failed to save VM state")
+	}
+
+	// Stopping the shim stops the VM; the cleanup below still runs
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	defer signal.Stop(sigCh)
+	go func() {
+		for sig := range sigCh {
+			log.Info().Str("signal", sig.String()).Str("vm_id", task.ID).Msg("Stopping VM")
+			vmExec.Stop(context.Background(), task)
+		}
+	}()
+
+	watcher := vmexit.NewWatcher()
+	if err := relay.Copy(io.TeeReader(outR, watcher)); err != nil {
+		log.Warn().Err(err).Msg("Console relay failed")
+	}
+
+	status := watcher.Status()
+	log.Info().
+		Str("vm_id", task.ID).
+		Int("exit_code", workloadExitCode(status)).
+		Msg("VM exited")
+	if status.Panic != "" {
+		stateMgr.UpdateError(task.ID, "kernel panic: "+status.Panic)
+	}
+
+	cleanupShimTask(vmExec, task, rootfsDir, opts.Remove)
+	if opts.Remove {
+		stateMgr.Remove(task.ID)
+	} else {
+		stateMgr.UpdateStatus(task.ID, "exited")
+	}
+	return nil
+}
+
+// startShimTask prepares and boots the VM of a task
+func startShimTask(ctx context.Context, vmExec *executor.FirecrackerExecutor, task *types.Task, rootfsDir string) error {
+	log.Info().Str("task_id", task.ID).Msg("Preparing task...")
+	if err := vmExec.Prepare(ctx, task); err != nil {
+		return fmt.Errorf("failed to prepare task: %w", err)
+	}
+	if err := privateRootfs(rootfsDir, task); err != nil {
+		return err
+	}
+	log.Info().Str("task_id", task.ID).Msg("Starting task...")
+	if err := vmExec.Start(ctx, task); err != nil {
+		return fmt.Errorf("failed to start task: %w", err)
+	}
+	return nil
+}
+
+// privateRootfs gives the VM its own copy of its image, unless the image
+// preparer already made one. The VM writes to its rootfs, and the cached
+// image is shared with every other VM of the image.
+func privateRootfs(rootfsDir string, task *types.Task) error {
+	taskRootfs := image.TaskRootfsPath(rootfsDir, task.ID)
+	rootfs := task.Annotations["rootfs"]
+	if rootfs == "" || rootfs == taskRootfs {
+		return nil
+	}
+	if err := image.CloneRootfs(rootfs, taskRootfs); err != nil {
+		return fmt.Errorf("failed to copy rootfs: %w", err)
+	}
+	task.Annotations["rootfs"] = taskRootfs
+	return nil
+}
+
+// cleanupShimTask removes the VM's TAP device and API socket, and with
+// remove its rootfs copy too
+func cleanupShimTask(vmExec *executor.FirecrackerExecutor, task *types.Task, rootfsDir string, remove bool) {
+	if err := vmExec.Remove(context.Background(), task); err != nil {
+		log.Warn().Err(err).Str("task_id", task.ID).Msg("Cleanup failed")
+	}
+	if remove {
+		removePrivateRootfs(rootfsDir, task)
+	}
+}
+
+// removePrivateRootfs deletes the VM's copy of its image. A rootfs that is
+// not the VM's own copy is the shared cache and is left alone.
+func removePrivateRootfs(rootfsDir string, task *types.Task) {
+	rootfs := image.TaskRootfsPath(rootfsDir, task.ID)
+	if task.Annotations["rootfs"] != rootfs {
+		return
+	}
+	if err := os.Remove(rootfs); err != nil && !os.IsNotExist(err) {
+		log.Warn().Err(err).Str("path", rootfs).Msg("Failed to remove rootfs")
+	}
+}
+
+// workloadExitCode returns the exit code of the workload the console
+// reported: its status as reported by the init wrapper, 137 if the guest
+// ran out of memory and 1 if its kernel panicked. A VM powered off
+// without a report exited cleanly.
+func workloadExitCode(status vmexit.Status) int {
+	switch {
+	case status.Reported:
+		return status.Code
+	case status.OOM:
+		return 128 + int(syscall.SIGKILL)
+	case status.Panic != "":
+		return 1
+	}
+	return 0
+}
+
+// silenceExitCode keeps cobra from printing a workload's exit code as an
+// error; main exits with it instead
+func silenceExitCode(cmd *cobra.Command, err error) {
+	var exitErr *exitCodeError
+	if errors.As(err, &exitErr) {
+		cmd.SilenceErrors = true
+		cmd.SilenceUsage = true
+	}
+}
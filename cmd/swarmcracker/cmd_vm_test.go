@@ -1,7 +1,13 @@
 package main
 
 import (
+	"os"
+	"path/filepath"
 	"testing"
+
+	"github.com/restuhaqza/swarmcracker/pkg/image"
+	"github.com/restuhaqza/swarmcracker/pkg/types"
+	"github.com/restuhaqza/swarmcracker/pkg/vmexit"
 )
 
 // TestVMCommandStructure verifies that VM commands are registered
@@ -15,6 +21,8 @@ func TestVMCommandStructure(t *testing.T) {
 	// Check that expected subcommands are registered
 	expectedCommands := []string{
 		"create",
+		"run",
+		"attach",
 		"list", // 'ls' has alias 'list' but main name is 'list'
 		"stop",
 		"logs",
@@ -179,3 +187,123 @@ func TestVMSnapshotCommand(t *testing.T) {
 		t.Errorf("Expected command name 'snapshot', got '%s'", cmd.Name())
 	}
 }
+
+// TestVMRunCommand verifies the run command
+func TestVMRunCommand(t *testing.T) {
+	cmd := newVMRunCommand()
+
+	if cmd.Name() != "run" {
+		t.Errorf("Expected command name 'run', got '%s'", cmd.Name())
+	}
+
+	if err := cmd.Args(cmd, []string{}); err == nil {
+		t.Error("Expected error when no image provided")
+	}
+	if err := cmd.Args(cmd, []string{"alpine:latest", "echo", "hello"}); err != nil {
+		t.Errorf("Unexpected error with image and command: %v", err)
+	}
+
+	shorthands := map[string]string{
+		"name": "n", "cpu": "", "memory": "m", "env": "e",
+		"interactive": "i", "tty": "t", "rm": "", "detach": "d", "detach-keys": "",
+	}
+	for name, shorthand := range shorthands {
+		flag := cmd.Flags().Lookup(name)
+		if flag == nil {
+			t.Errorf("Expected flag '%s' not found", name)
+			continue
+		}
+		if flag.Shorthand != shorthand {
+			t.Errorf("Expected %s shorthand '%s', got '%s'", name, shorthand, flag.Shorthand)
+		}
+	}
+
+	if def := cmd.Flags().Lookup("detach-keys").DefValue; def != "ctrl-p,ctrl-q" {
+		t.Errorf("Expected default detach keys 'ctrl-p,ctrl-q', got '%s'", def)
+	}
+
+	// Flags after the image belong to the guest command
+	if err := cmd.Flags().Parse([]string{"-it", "--rm", "alpine:latest", "ls", "-l"}); err != nil {
+		t.Fatalf("Unexpected parse error: %v", err)
+	}
+	if args := cmd.Flags().Args(); len(args) != 3 || args[2] != "-l" {
+		t.Errorf("Expected guest command flags to be kept as args, got %v", args)
+	}
+}
+
+// TestVMAttachCommand verifies the attach command
+func TestVMAttachCommand(t *testing.T) {
+	cmd := newVMAttachCommand()
+
+	if cmd.Name() != "attach" {
+		t.Errorf("Expected command name 'attach', got '%s'", cmd.Name())
+	}
+	if err := cmd.Args(cmd, []string{}); err == nil {
+		t.Error("Expected error when no VM ID provided")
+	}
+	for _, flag := range []string{"no-stdin", "detach-keys"} {
+		if cmd.Flags().Lookup(flag) == nil {
+			t.Errorf("Expected flag '%s' not found", flag)
+		}
+	}
+}
+
+// TestWorkloadExitCode tests the exit codes vm run and vm attach return
+func TestWorkloadExitCode(t *testing.T) {
+	tests := []struct {
+		name   string
+		status vmexit.Status
+		want   int
+	}{
+		{"reported success", vmexit.Status{Reported: true}, 0},
+		{"reported failure", vmexit.Status{Reported: true, Code: 3}, 3},
+		{"killed by signal", vmexit.Status{Reported: true, Code: 143}, 143},
+		{"reported wins over OOM", vmexit.Status{Reported: true, Code: 2, OOM: true}, 2},
+		{"out of memory", vmexit.Status{OOM: true}, 137},
+		{"kernel panic", vmexit.Status{Panic: "Attempted to kill init!"}, 1},
+		{"powered off without report", vmexit.Status{}, 0},
+	}
+
+	for _, tt := range tests {
+		if got := workloadExitCode(tt.status); got != tt.want {
+			t.Errorf("%s: expected exit code %d, got %d", tt.name, tt.want, got)
+		}
+	}
+}
+
+// TestPrivateRootfs verifies that a VM runs on its own copy of the image
+// and that removing it leaves the cached image alone
+func TestPrivateRootfs(t *testing.T) {
+	rootfsDir := t.TempDir()
+	cached := filepath.Join(rootfsDir, "alpine-latest.ext4")
+	if err := os.WriteFile(cached, []byte("cached image"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	task := &types.Task{ID: "vm-1", Annotations: map[string]string{"rootfs": cached}}
+
+	if err := privateRootfs(rootfsDir, task); err != nil {
+		t.Fatalf("privateRootfs failed: %v", err)
+	}
+	copied := image.TaskRootfsPath(rootfsDir, task.ID)
+	if task.Annotations["rootfs"] != copied {
+		t.Fatalf("Expected rootfs %s, got %s", copied, task.Annotations["rootfs"])
+	}
+	if data, err := os.ReadFile(copied); err != nil || string(data) != "cached image" {
+		t.Fatalf("Expected a copy of the cached image, got %q (%v)", data, err)
+	}
+
+	removePrivateRootfs(rootfsDir, task)
+	if _, err := os.Stat(copied); !os.IsNotExist(err) {
+		t.Errorf("Expected the VM's copy to be removed, got %v", err)
+	}
+	if _, err := os.Stat(cached); err != nil {
+		t.Errorf("Expected the cached image to be kept, got %v", err)
+	}
+
+	// A task still pointing at the cache never deletes it
+	task.Annotations["rootfs"] = cached
+	removePrivateRootfs(rootfsDir, task)
+	if _, err := os.Stat(cached); err != nil {
+		t.Errorf("Expected the cached image to be kept, got %v", err)
+	}
+}
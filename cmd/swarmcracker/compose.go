@@ -0,0 +1,749 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	gogotypes "github.com/gogo/protobuf/types"
+	"github.com/moby/swarmkit/v2/api"
+	"gopkg.in/yaml.v3"
+)
+
+// stackNamespaceLabel marks every object a stack deploy creates with the
+// name of its stack
+const stackNamespaceLabel = "swarmcracker.stack.namespace"
+
+// composeFile is the part of the Compose file format stack deploy supports
+type composeFile struct {
+	Version  string                     `yaml:"version"`
+	Services map[string]*composeService `yaml:"services"`
+	Networks map[string]*composeNetwork `yaml:"networks"`
+	Volumes  map[string]*composeVolume  `yaml:"volumes"`
+	Secrets  map[string]*composeObject  `yaml:"secrets"`
+	Configs  map[string]*composeObject  `yaml:"configs"`
+
+	dir string // directory of the file, for relative secret and config files
+}
+
+type composeService struct {
+	Image       string              `yaml:"image"`
+	Entrypoint  shellCommand        `yaml:"entrypoint"`
+	Command     shellCommand        `yaml:"command"`
+	Environment mappingList         `yaml:"environment"`
+	Labels      mappingList         `yaml:"labels"`
+	Networks    serviceNetworks     `yaml:"networks"`
+	Volumes     []composeMount      `yaml:"volumes"`
+	Secrets     []composeFileRef    `yaml:"secrets"`
+	Configs     []composeFileRef    `yaml:"configs"`
+	Healthcheck *composeHealthcheck `yaml:"healthcheck"`
+	Deploy      composeDeploy       `yaml:"deploy"`
+}
+
+type composeNetwork struct {
+	Name       string            `yaml:"name"`
+	Driver     string            `yaml:"driver"`
+	DriverOpts map[string]string `yaml:"driver_opts"`
+	External   bool              `yaml:"external"`
+	Attachable bool              `yaml:"attachable"`
+	Internal   bool              `yaml:"internal"`
+	Labels     mappingList       `yaml:"labels"`
+}
+
+type composeVolume struct {
+	Name       string            `yaml:"name"`
+	Driver     string            `yaml:"driver"`
+	DriverOpts map[string]string `yaml:"driver_opts"`
+	External   bool              `yaml:"external"`
+	Labels     mappingList       `yaml:"labels"`
+}
+
+// composeObject is a top-level secret or config
+type composeObject struct {
+	Name     string      `yaml:"name"`
+	File     string      `yaml:"file"`
+	External bool        `yaml:"external"`
+	Labels   mappingList `yaml:"labels"`
+}
+
+type composeHealthcheck struct {
+	Test        healthTest `yaml:"test"`
+	Interval    string     `yaml:"interval"`
+	Timeout     string     `yaml:"timeout"`
+	StartPeriod string     `yaml:"start_period"`
+	Retries     int32      `yaml:"retries"`
+	Disable     bool       `yaml:"disable"`
+}
+
+type composeDeploy struct {
+	Mode      string      `yaml:"mode"`
+	Replicas  *uint64     `yaml:"replicas"`
+	Labels    mappingList `yaml:"labels"`
+	Resources struct {
+		Limits       composeResources `yaml:"limits"`
+		Reservations composeResources `yaml:"reservations"`
+	} `yaml:"resources"`
+	Placement      composePlacement     `yaml:"placement"`
+	UpdateConfig   *composeUpdateConfig `yaml:"update_config"`
+	RollbackConfig *composeUpdateConfig `yaml:"rollback_config"`
+}
+
+type composePlacement struct {
+	Constraints []string `yaml:"constraints"`
+	Preferences []struct {
+		Spread string `yaml:"spread"`
+	} `yaml:"preferences"`
+	MaxReplicas uint64 `yaml:"max_replicas_per_node"`
+}
+
+type composeResources struct {
+	CPUs   string `yaml:"cpus"`
+	Memory string `yaml:"memory"`
+}
+
+type composeUpdateConfig struct {
+	Parallelism     *uint64 `yaml:"parallelism"`
+	Delay           string  `yaml:"delay"`
+	FailureAction   string  `yaml:"failure_action"`
+	Monitor         string  `yaml:"monitor"`
+	MaxFailureRatio float32 `yaml:"max_failure_ratio"`
+	Order           string  `yaml:"order"`
+}
+
+// shellCommand is a command given either as a list or as a string that is
+// split like a shell would
+type shellCommand []string
+
+func (c *shellCommand) UnmarshalYAML(n *yaml.Node) error {
+	if n.Kind == yaml.ScalarNode {
+		words, err := splitShellWords(n.Value)
+		if err != nil {
+			return fmt.Errorf("line %d: %w", n.Line, err)
+		}
+		*c = words
+		return nil
+	}
+	var list []string
+	if err := n.Decode(&list); err != nil {
+		return err
+	}
+	*c = list
+	return nil
+}
+
+// healthTest is a healthcheck command: a string runs through the shell,
+// a list starts with CMD, CMD-SHELL or NONE
+type healthTest []string
+
+func (t *healthTest) UnmarshalYAML(n *yaml.Node) error {
+	if n.Kind == yaml.ScalarNode {
+		*t = healthTest{"CMD-SHELL", n.Value}
+		return nil
+	}
+	var list []string
+	if err := n.Decode(&list); err != nil {
+		return err
+	}
+	*t = list
+	return nil
+}
+
+// mappingList is a KEY: value mapping or a list of KEY=value strings
+type mappingList map[string]string
+
+func (m *mappingList) UnmarshalYAML(n *yaml.Node) error {
+	out := mappingList{}
+	switch n.Kind {
+	case yaml.SequenceNode:
+		var list []string
+		if err := n.Decode(&list); err != nil {
+			return err
+		}
+		for _, item := range list {
+			key, value, ok := strings.Cut(item, "=")
+			if !ok {
+				// A bare key takes its value from the deploying shell
+				if v, set := os.LookupEnv(key); set {
+					out[key] = v
+				}
+				continue
+			}
+			out[key] = value
+		}
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			key, value := n.Content[i].Value, n.Content[i+1]
+			if value.Tag == "!!null" {
+				if v, set := os.LookupEnv(key); set {
+					out[key] = v
+				}
+				continue
+			}
+			out[key] = value.Value
+		}
+	default:
+		return fmt.Errorf("line %d: expected a mapping or a list", n.Line)
+	}
+	*m = out
+	return nil
+}
+
+// pairs returns the mapping as sorted KEY=value strings
+func (m mappingList) pairs() []string {
+	if len(m) == 0 {
+		return nil
+	}
+	out := make([]string, 0, len(m))
+	for k, v := range m {
+		out = append(out, k+"="+v)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// serviceNetworks maps the networks a service joins to their aliases
+type serviceNetworks map[string][]string
+
+func (s *serviceNetworks) UnmarshalYAML(n *yaml.Node) error {
+	out := serviceNetworks{}
+	if n.Kind == yaml.SequenceNode {
+		var list []string
+		if err := n.Decode(&list); err != nil {
+			return err
+		}
+		for _, name := range list {
+			out[name] = nil
+		}
+		*s = out
+		return nil
+	}
+	var m map[string]*struct {
+		Aliases []string `yaml:"aliases"`
+	}
+	if err := n.Decode(&m); err != nil {
+		return err
+	}
+	for name, cfg := range m {
+		if cfg != nil {
+			out[name] = cfg.Aliases
+		} else {
+			out[name] = nil
+		}
+	}
+	*s = out
+	return nil
+}
+
+// composeMount is a service volume in short ("source:target:ro") or long
+// syntax
+type composeMount struct {
+	Type     string `yaml:"type"`
+	Source   string `yaml:"source"`
+	Target   string `yaml:"target"`
+	ReadOnly bool   `yaml:"read_only"`
+}
+
+func (m *composeMount) UnmarshalYAML(n *yaml.Node) error {
+	if n.Kind != yaml.ScalarNode {
+		type plain composeMount
+		return n.Decode((*plain)(m))
+	}
+	parts := strings.Split(n.Value, ":")
+	switch len(parts) {
+	case 1:
+		m.Target = parts[0]
+	case 2, 3:
+		m.Source, m.Target = parts[0], parts[1]
+		if len(parts) == 3 {
+			for _, opt := range strings.Split(parts[2], ",") {
+				if opt == "ro" {
+					m.ReadOnly = true
+				}
+			}
+		}
+	default:
+		return fmt.Errorf("line %d: invalid volume %q", n.Line, n.Value)
+	}
+	return nil
+}
+
+// composeFileRef is a service secret or config, by name or in long syntax
+type composeFileRef struct {
+	Source string  `yaml:"source"`
+	Target string  `yaml:"target"`
+	UID    string  `yaml:"uid"`
+	GID    string  `yaml:"gid"`
+	Mode   *uint32 `yaml:"mode"`
+}
+
+func (r *composeFileRef) UnmarshalYAML(n *yaml.Node) error {
+	if n.Kind == yaml.ScalarNode {
+		r.Source = n.Value
+		return nil
+	}
+	type plain composeFileRef
+	return n.Decode((*plain)(r))
+}
+
+// loadComposeFile reads a Compose file, substituting ${VAR} and
+// ${VAR:-default} from the environment
+func loadComposeFile(path string) (*composeFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read compose file: %w", err)
+	}
+	file, err := parseComposeFile(data, os.LookupEnv)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	file.dir = filepath.Dir(path)
+	return file, nil
+}
+
+// parseComposeFile parses a Compose file, looking up variables with lookup
+func parseComposeFile(data []byte, lookup func(string) (string, bool)) (*composeFile, error) {
+	expanded := os.Expand(string(data), func(name string) string {
+		if name == "$" {
+			return "$"
+		}
+		key, def, hasDefault := strings.Cut(name, ":-")
+		if v, ok := lookup(key); ok && (v != "" || !hasDefault) {
+			return v
+		}
+		return def
+	})
+
+	var file composeFile
+	if err := yaml.Unmarshal([]byte(expanded), &file); err != nil {
+		return nil, fmt.Errorf("invalid compose file: %w", err)
+	}
+	if len(file.Services) == 0 {
+		return nil, fmt.Errorf("compose file defines no services")
+	}
+	return &file, nil
+}
+
+// stackName returns the namespaced name of a stack object
+func stackName(stack, name string) string {
+	return stack + "_" + name
+}
+
+// stackLabels returns labels with the stack namespace added
+func stackLabels(stack string, labels map[string]string) map[string]string {
+	out := map[string]string{stackNamespaceLabel: stack}
+	for k, v := range labels {
+		out[k] = v
+	}
+	return out
+}
+
+// networkName returns the cluster-wide name of a network of the file
+func (f *composeFile) networkName(stack, name string) string {
+	if n := f.Networks[name]; n != nil && (n.Name != "" || n.External) {
+		if n.Name != "" {
+			return n.Name
+		}
+		return name
+	}
+	return stackName(stack, name)
+}
+
+// networkSpecs returns the networks the stack creates, keyed by their
+// cluster-wide name. External networks are not included.
+func (f *composeFile) networkSpecs(stack string) map[string]*api.NetworkSpec {
+	used := map[string]bool{}
+	for _, svc := range f.Services {
+		if len(svc.Networks) == 0 {
+			used["default"] = true
+		}
+		for name := range svc.Networks {
+			used[name] = true
+		}
+	}
+
+	specs := map[string]*api.NetworkSpec{}
+	for name := range used {
+		n := f.Networks[name]
+		if n == nil {
+			n = &composeNetwork{}
+		}
+		if n.External {
+			continue
+		}
+		driver := n.Driver
+		if driver == "" {
+			driver = "overlay"
+		}
+		fullName := f.networkName(stack, name)
+		specs[fullName] = &api.NetworkSpec{
+			Annotations: api.Annotations{
+				Name:   fullName,
+				Labels: stackLabels(stack, n.Labels),
+			},
+			DriverConfig: &api.Driver{Name: driver, Options: n.DriverOpts},
+			Attachable:   n.Attachable,
+			Internal:     n.Internal,
+		}
+	}
+	return specs
+}
+
+// objectName returns the cluster-wide name of a secret or config
+func objectName(stack, name string, obj *composeObject) string {
+	if obj.Name != "" {
+		return obj.Name
+	}
+	if obj.External {
+		return name
+	}
+	return stackName(stack, name)
+}
+
+// objectData reads the content of a secret or config defined in the file
+func (f *composeFile) objectData(kind, name string, obj *composeObject) ([]byte, error) {
+	if obj.File == "" {
+		return nil, fmt.Errorf("%s %s: file is required unless external", kind, name)
+	}
+	path := obj.File
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(f.dir, path)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("%s %s: %w", kind, name, err)
+	}
+	return data, nil
+}
+
+// serviceSpec builds the spec of a service of the stack. Network, secret
+// and config references carry names only; deploy resolves them to IDs.
+func (f *composeFile) serviceSpec(stack, name string) (*api.ServiceSpec, error) {
+	svc := f.Services[name]
+	if svc == nil || svc.Image == "" {
+		return nil, fmt.Errorf("service %s: image is required", name)
+	}
+
+	replicas := uint64(1)
+	if svc.Deploy.Replicas != nil {
+		replicas = *svc.Deploy.Replicas
+	}
+	var cpu float64
+	if c := svc.Deploy.Resources.Limits.CPUs; c != "" {
+		var err error
+		if cpu, err = strconv.ParseFloat(c, 64); err != nil {
+			return nil, fmt.Errorf("service %s: invalid cpus %q", name, c)
+		}
+	}
+
+	spec, err := buildServiceSpec(serviceOptions{
+		Name:     stackName(stack, name),
+		Image:    svc.Image,
+		Replicas: replicas,
+		CPU:      cpu,
+		Memory:   svc.Deploy.Resources.Limits.Memory,
+		Env:      svc.Environment.pairs(),
+		Command:  svc.Entrypoint,
+		Args:     svc.Command,
+		Labels:   stackLabels(stack, svc.Deploy.Labels),
+
+		Mode:               svc.Deploy.Mode,
+		Constraints:        svc.Deploy.Placement.Constraints,
+		PlacementPrefs:     svc.Deploy.Placement.spreadPrefs(),
+		MaxReplicasPerNode: svc.Deploy.Placement.MaxReplicas,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("service %s: %w", name, err)
+	}
+	container := spec.Task.GetContainer()
+	container.Labels = stackLabels(stack, svc.Labels)
+
+	if err := applyReservations(spec, svc.Deploy.Resources.Reservations); err != nil {
+		return nil, fmt.Errorf("service %s: %w", name, err)
+	}
+
+	if svc.Deploy.UpdateConfig != nil {
+		if isJob(spec) {
+			return nil, fmt.Errorf("service %s: update_config does not apply to jobs", name)
+		}
+		if spec.Update, err = svc.Deploy.UpdateConfig.toAPI(false); err != nil {
+			return nil, fmt.Errorf("service %s: update_config: %w", name, err)
+		}
+	}
+	if svc.Deploy.RollbackConfig != nil {
+		if spec.Rollback, err = svc.Deploy.RollbackConfig.toAPI(true); err != nil {
+			return nil, fmt.Errorf("service %s: rollback_config: %w", name, err)
+		}
+	}
+	if svc.Healthcheck != nil {
+		if container.Healthcheck, err = svc.Healthcheck.toAPI(); err != nil {
+			return nil, fmt.Errorf("service %s: %w", name, err)
+		}
+	}
+
+	networks := svc.Networks
+	if len(networks) == 0 {
+		networks = serviceNetworks{"default": nil}
+	}
+	netNames := make([]string, 0, len(networks))
+	for n := range networks {
+		if _, declared := f.Networks[n]; !declared && n != "default" {
+			return nil, fmt.Errorf("service %s: network %s is not declared", name, n)
+		}
+		netNames = append(netNames, n)
+	}
+	sort.Strings(netNames)
+	for _, n := range netNames {
+		spec.Task.Networks = append(spec.Task.Networks, &api.NetworkAttachmentConfig{
+			Target:  f.networkName(stack, n),
+			Aliases: append([]string{name}, networks[n]...),
+		})
+	}
+
+	for _, m := range svc.Volumes {
+		mount, err := f.mount(stack, m)
+		if err != nil {
+			return nil, fmt.Errorf("service %s: %w", name, err)
+		}
+		container.Mounts = append(container.Mounts, mount)
+	}
+
+	for _, ref := range svc.Secrets {
+		obj, ok := f.Secrets[ref.Source]
+		if !ok || obj == nil {
+			return nil, fmt.Errorf("service %s: secret %s is not declared", name, ref.Source)
+		}
+		container.Secrets = append(container.Secrets, &api.SecretReference{
+			SecretName: objectName(stack, ref.Source, obj),
+			Target:     &api.SecretReference_File{File: ref.fileTarget("/run/secrets/")},
+		})
+	}
+	for _, ref := range svc.Configs {
+		obj, ok := f.Configs[ref.Source]
+		if !ok || obj == nil {
+			return nil, fmt.Errorf("service %s: config %s is not declared", name, ref.Source)
+		}
+		container.Configs = append(container.Configs, &api.ConfigReference{
+			ConfigName: objectName(stack, ref.Source, obj),
+			Target:     &api.ConfigReference_File{File: ref.fileTarget("/")},
+		})
+	}
+
+	return spec, nil
+}
+
+// mount converts a service volume, namespacing named volumes
+func (f *composeFile) mount(stack string, m composeMount) (api.Mount, error) {
+	if m.Target == "" {
+		return api.Mount{}, fmt.Errorf("volume %q has no target", m.Source)
+	}
+	mount := api.Mount{Target: m.Target, ReadOnly: m.ReadOnly}
+
+	isPath := strings.HasPrefix(m.Source, "/") || strings.HasPrefix(m.Source, ".")
+	if m.Type == "bind" || (m.Type == "" && isPath) {
+		source := m.Source
+		if !filepath.IsAbs(source) {
+			source = filepath.Join(f.dir, source)
+		}
+		mount.Type = api.MountTypeBind
+		mount.Source = source
+		return mount, nil
+	}
+
+	mount.Type = api.MountTypeVolume
+	if m.Source == "" {
+		return mount, nil
+	}
+	vol, declared := f.Volumes[m.Source]
+	if !declared {
+		return api.Mount{}, fmt.Errorf("volume %s is not declared", m.Source)
+	}
+	if vol == nil {
+		vol = &composeVolume{}
+	}
+	switch {
+	case vol.Name != "":
+		mount.Source = vol.Name
+	case vol.External:
+		mount.Source = m.Source
+	default:
+		mount.Source = stackName(stack, m.Source)
+	}
+	mount.VolumeOptions = &api.Mount_VolumeOptions{Labels: stackLabels(stack, vol.Labels)}
+	if vol.Driver != "" {
+		mount.VolumeOptions.DriverConfig = &api.Driver{Name: vol.Driver, Options: vol.DriverOpts}
+	}
+	return mount, nil
+}
+
+// fileTarget returns where a secret or config is placed in the task
+func (r composeFileRef) fileTarget(dir string) *api.FileTarget {
+	target := &api.FileTarget{Name: r.Target, UID: r.UID, GID: r.GID, Mode: 0444}
+	if target.Name == "" {
+		target.Name = r.Source
+	}
+	if !strings.HasPrefix(target.Name, "/") {
+		target.Name = dir + target.Name
+	}
+	if target.UID == "" {
+		target.UID = "0"
+	}
+	if target.GID == "" {
+		target.GID = "0"
+	}
+	if r.Mode != nil {
+		target.Mode = os.FileMode(*r.Mode)
+	}
+	return target
+}
+
+func applyReservations(spec *api.ServiceSpec, res composeResources) error {
+	if res.CPUs == "" && res.Memory == "" {
+		return nil
+	}
+	r := &api.Resources{}
+	if res.CPUs != "" {
+		cpu, err := strconv.ParseFloat(res.CPUs, 64)
+		if err != nil {
+			return fmt.Errorf("invalid reserved cpus %q", res.CPUs)
+		}
+		r.NanoCPUs = int64(cpu * 1e9)
+	}
+	mem, err := parseMemory(res.Memory)
+	if err != nil {
+		return fmt.Errorf("invalid reserved memory: %w", err)
+	}
+	r.MemoryBytes = mem
+
+	if spec.Task.Resources == nil {
+		spec.Task.Resources = &api.ResourceRequirements{}
+	}
+	if old := spec.Task.Resources.Reservations; old != nil {
+		r.Generic = old.Generic
+	}
+	spec.Task.Resources.Reservations = r
+	return nil
+}
+
+// spreadPrefs returns the placement preferences as --placement-pref values
+func (p composePlacement) spreadPrefs() []string {
+	var prefs []string
+	for _, pref := range p.Preferences {
+		prefs = append(prefs, "spread="+pref.Spread)
+	}
+	return prefs
+}
+
+// toAPI converts an update_config, or a rollback_config if rollback is set
+func (u *composeUpdateConfig) toAPI(rollback bool) (*api.UpdateConfig, error) {
+	cfg := &api.UpdateConfig{Parallelism: 1, MaxFailureRatio: u.MaxFailureRatio}
+	if u.Parallelism != nil {
+		cfg.Parallelism = *u.Parallelism
+	}
+	if u.Delay != "" {
+		d, err := time.ParseDuration(u.Delay)
+		if err != nil {
+			return nil, fmt.Errorf("invalid update delay: %w", err)
+		}
+		cfg.Delay = d
+	}
+	if u.Monitor != "" {
+		d, err := time.ParseDuration(u.Monitor)
+		if err != nil {
+			return nil, fmt.Errorf("invalid update monitor: %w", err)
+		}
+		cfg.Monitor = gogotypes.DurationProto(d)
+	}
+
+	var err error
+	if cfg.FailureAction, err = parseFailureAction(u.FailureAction, rollback); err != nil {
+		return nil, err
+	}
+	if cfg.Order, err = parseUpdateOrder(u.Order); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+func (h *composeHealthcheck) toAPI() (*api.HealthConfig, error) {
+	if h.Disable {
+		return &api.HealthConfig{Test: []string{"NONE"}}, nil
+	}
+
+	cfg := &api.HealthConfig{Test: h.Test, Retries: h.Retries}
+	if len(h.Test) > 0 {
+		switch h.Test[0] {
+		case "CMD", "CMD-SHELL", "NONE":
+		default:
+			return nil, fmt.Errorf("healthcheck test must start with CMD, CMD-SHELL or NONE")
+		}
+	}
+
+	for _, d := range []struct {
+		value string
+		field **gogotypes.Duration
+		name  string
+	}{
+		{h.Interval, &cfg.Interval, "interval"},
+		{h.Timeout, &cfg.Timeout, "timeout"},
+		{h.StartPeriod, &cfg.StartPeriod, "start_period"},
+	} {
+		if d.value == "" {
+			continue
+		}
+		parsed, err := time.ParseDuration(d.value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid healthcheck %s: %w", d.name, err)
+		}
+		*d.field = gogotypes.DurationProto(parsed)
+	}
+	return cfg, nil
+}
+
+// splitShellWords splits s into words like a POSIX shell, honoring single
+// and double quotes and backslash escapes
+func splitShellWords(s string) ([]string, error) {
+	var (
+		words   []string
+		word    strings.Builder
+		inWord  bool
+		quote   rune
+		escaped bool
+	)
+	for _, r := range s {
+		switch {
+		case escaped:
+			word.WriteRune(r)
+			escaped = false
+		case r == '\\' && quote != '\'':
+			escaped, inWord = true, true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				word.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote, inWord = r, true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+	if quote != 0 || escaped {
+		return nil, fmt.Errorf("unterminated quote in %q", s)
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"os"
@@ -14,12 +15,15 @@ import (
 	"time"
 
 	"al.essio.dev/pkg/shellescape"
+	"github.com/restuhaqza/swarmcracker/pkg/arch"
+	"github.com/restuhaqza/swarmcracker/pkg/balloon"
 	"github.com/restuhaqza/swarmcracker/pkg/config"
 	"github.com/restuhaqza/swarmcracker/pkg/executor"
 	"github.com/restuhaqza/swarmcracker/pkg/image"
 	"github.com/restuhaqza/swarmcracker/pkg/lifecycle"
 	"github.com/restuhaqza/swarmcracker/pkg/network"
 	"github.com/restuhaqza/swarmcracker/pkg/runtime"
+	"github.com/restuhaqza/swarmcracker/pkg/security"
 	"github.com/restuhaqza/swarmcracker/pkg/translator"
 	"github.com/restuhaqza/swarmcracker/pkg/types"
 	"github.com/rs/zerolog"
@@ -75,13 +79,16 @@ It provides a simple interface to the SwarmCracker executor, allowing you to:
 	rootCmd.AddCommand(newClusterCommand())
 	rootCmd.AddCommand(newNodeCommand())
 	rootCmd.AddCommand(newServiceCommand())
+	rootCmd.AddCommand(newStackCommand())
 	rootCmd.AddCommand(newTaskCommand())
 	rootCmd.AddCommand(newVMCommand())
 	rootCmd.AddCommand(newNetworkCommand())
 	rootCmd.AddCommand(newVolumeCommand())
 	rootCmd.AddCommand(newAssetCommand())
 	rootCmd.AddCommand(newConfigCommand())
+	rootCmd.AddCommand(newSecretCommand())
 	rootCmd.AddCommand(newSetupCommand())
+	rootCmd.AddCommand(newEventsCommand())
 
 	// Backward compatibility: add legacy commands with deprecation warnings
 	rootCmd.AddCommand(newDeprecatedInitCommand())
@@ -105,6 +112,11 @@ It provides a simple interface to the SwarmCracker executor, allowing you to:
 
 	// Execute
 	if err := rootCmd.Execute(); err != nil {
+		// vm run and vm attach exit with the workload's exit code
+		var exitErr *exitCodeError
+		if errors.As(err, &exitErr) {
+			os.Exit(exitErr.code)
+		}
 		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
 	}
@@ -466,11 +478,21 @@ func loadConfigWithOverrides(path string) (*config.Config, error) {
 	// Set defaults for any missing values
 	cfg.SetDefaults()
 
+	// Pick this node's kernel when paths name one per architecture
+	cfg.Executor.KernelPath = arch.Default().ExpandPath(cfg.Executor.KernelPath)
+	cfg.Executor.InitrdPath = arch.Default().ExpandPath(cfg.Executor.InitrdPath)
+
 	return cfg, nil
 }
 
 // createExecutor creates a new Firecracker executor with all dependencies
 func createExecutor(cfg *config.Config) (*executor.FirecrackerExecutor, error) {
+	return createConsoleExecutor(cfg, nil, nil)
+}
+
+// createConsoleExecutor creates an executor whose VMs read their serial
+// console input from in and write its output to out
+func createConsoleExecutor(cfg *config.Config, in io.Reader, out io.Writer) (*executor.FirecrackerExecutor, error) {
 	// Create executor config
 	execConfig := &executor.Config{
 		KernelPath:      cfg.Executor.KernelPath,
@@ -494,9 +516,16 @@ func createExecutor(cfg *config.Config) (*executor.FirecrackerExecutor, error) {
 			BridgeIP:         cfg.Network.BridgeIP,
 			IPMode:           cfg.Network.IPMode,
 			NATEnabled:       *cfg.Network.NATEnabled,
+			StateDir:         "/var/lib/swarmcracker/network",
 		},
 	}
 
+	// Compiled seccomp filter, kept next to the API sockets
+	seccompFilter, err := security.PrepareSeccompFilter(context.Background(), cfg.Executor.SeccompFilter, execConfig.SocketDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to prepare seccomp filter: %w", err)
+	}
+
 	// Create component instances (dependency injection)
 	vmmConfig := &lifecycle.ManagerConfig{
 		KernelPath:      execConfig.KernelPath,
@@ -505,6 +534,9 @@ func createExecutor(cfg *config.Config) (*executor.FirecrackerExecutor, error) {
 		DefaultVCPUs:    execConfig.DefaultVCPUs,
 		DefaultMemoryMB: execConfig.DefaultMemoryMB,
 		EnableJailer:    execConfig.EnableJailer,
+		SeccompFilter:   seccompFilter,
+		ConsoleIn:       in,
+		ConsoleOut:      out,
 	}
 
 	imageConfig := &image.PreparerConfig{
@@ -522,6 +554,12 @@ func createExecutor(cfg *config.Config) (*executor.FirecrackerExecutor, error) {
 		DefaultMemMB:  execConfig.DefaultMemoryMB,
 		InitSystem:    "tini",
 		NetworkConfig: execConfig.Network,
+		EnableBalloon: cfg.Executor.Balloon.Enabled,
+		Balloon: balloon.Device{
+			DeflateOnOOM:          cfg.Executor.Balloon.DeflateOnOOM == nil || *cfg.Executor.Balloon.DeflateOnOOM,
+			StatsPollingIntervalS: int(cfg.Executor.Balloon.StatsInterval.ToDuration() / time.Second),
+		},
+		HugePages: cfg.Executor.HugePages,
 	}
 
 	vmmManager := lifecycle.NewVMMManager(vmmConfig)
@@ -942,6 +980,23 @@ func checkKVMAvailable(client *ssh.Client) error {
 	return nil
 }
 
+// remoteArch returns the remote host's architecture, or this host's if it
+// cannot be determined
+func remoteArch(client *ssh.Client) arch.Arch {
+	output, err := executeSSHCommand(client, "uname -m")
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to detect remote architecture, assuming local")
+		return arch.Default()
+	}
+
+	a, err := arch.Lookup(strings.TrimSpace(output))
+	if err != nil {
+		log.Warn().Err(err).Msg("Unsupported remote architecture, assuming local")
+		return arch.Default()
+	}
+	return a
+}
+
 // executeSSHCommand executes a command on the remote host
 func executeSSHCommand(client *ssh.Client, command string) (string, error) {
 	session, err := client.NewSession()
@@ -1127,6 +1182,10 @@ func startMicroVM(client *ssh.Client, taskID, rootfsPath string, plan *Deploymen
 		kernelPath = plan.Config.KernelPath
 	}
 
+	// Boot the guest for the remote host's architecture
+	guestArch := remoteArch(client)
+	kernelPath = guestArch.ExpandPath(kernelPath)
+
 	// Socket path for this VM
 	socketPath := fmt.Sprintf("/var/run/firecracker/%s.sock", taskID)
 
@@ -1134,7 +1193,7 @@ func startMicroVM(client *ssh.Client, taskID, rootfsPath string, plan *Deploymen
 	fcCfg := fcConfig{
 		BootSource: fcBootSource{
 			KernelImagePath: kernelPath,
-			BootArgs:        "console=ttyS0 reboot=k panic=1 pci=off nomodules ip=dhcp -- /sbin/init",
+			BootArgs:        guestArch.KernelArgs() + " nomodules ip=dhcp -- /sbin/init",
 		},
 		Drives: []fcDrive{
 			{
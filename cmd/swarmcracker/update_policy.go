@@ -0,0 +1,225 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	gogotypes "github.com/gogo/protobuf/types"
+	"github.com/moby/swarmkit/v2/api"
+	"github.com/spf13/cobra"
+)
+
+// updatePolicyFlags are the --update-* or --rollback-* flags of
+// "service create" and "service update"
+type updatePolicyFlags struct {
+	prefix          string // "update" or "rollback"
+	parallelism     uint64
+	delay           time.Duration
+	failureAction   string
+	monitor         time.Duration
+	maxFailureRatio float32
+	order           string
+}
+
+// addUpdatePolicyFlags registers the policy flags with the given prefix
+func addUpdatePolicyFlags(cmd *cobra.Command, prefix string) *updatePolicyFlags {
+	p := &updatePolicyFlags{prefix: prefix}
+	fs := cmd.Flags()
+
+	actions := "pause, continue, rollback"
+	if prefix == "rollback" {
+		actions = "pause, continue"
+	}
+	fs.Uint64Var(&p.parallelism, prefix+"-parallelism", 1, fmt.Sprintf("Maximum number of tasks to %s at once (0 = all)", prefix))
+	fs.DurationVar(&p.delay, prefix+"-delay", 0, fmt.Sprintf("Delay between task %ss", prefix))
+	fs.StringVar(&p.failureAction, prefix+"-failure-action", "pause", fmt.Sprintf("Action on %s failure (%s)", prefix, actions))
+	fs.DurationVar(&p.monitor, prefix+"-monitor", 5*time.Second, "Duration after each task update to watch for failure")
+	fs.Float32Var(&p.maxFailureRatio, prefix+"-max-failure-ratio", 0, fmt.Sprintf("Fraction of tasks that may fail during the %s (0-1)", prefix))
+	fs.StringVar(&p.order, prefix+"-order", "stop-first", "Order of operations (stop-first, start-first)")
+	return p
+}
+
+// apply sets the flags given on the command line on cfg, creating it if
+// needed. Flags that were not given leave cfg alone.
+func (p *updatePolicyFlags) apply(cmd *cobra.Command, cfg **api.UpdateConfig) error {
+	changed := func(name string) bool { return cmd.Flags().Changed(p.prefix + "-" + name) }
+
+	if !changed("parallelism") && !changed("delay") && !changed("failure-action") &&
+		!changed("monitor") && !changed("max-failure-ratio") && !changed("order") {
+		return nil
+	}
+	if *cfg == nil {
+		*cfg = &api.UpdateConfig{Parallelism: 1}
+	}
+	c := *cfg
+
+	if changed("parallelism") {
+		c.Parallelism = p.parallelism
+	}
+	if changed("delay") {
+		c.Delay = p.delay
+	}
+	if changed("failure-action") {
+		action, err := parseFailureAction(p.failureAction, p.prefix == "rollback")
+		if err != nil {
+			return fmt.Errorf("--%s-failure-action: %w", p.prefix, err)
+		}
+		c.FailureAction = action
+	}
+	if changed("monitor") {
+		c.Monitor = gogotypes.DurationProto(p.monitor)
+	}
+	if changed("max-failure-ratio") {
+		if p.maxFailureRatio < 0 || p.maxFailureRatio > 1 {
+			return fmt.Errorf("--%s-max-failure-ratio must be between 0 and 1", p.prefix)
+		}
+		c.MaxFailureRatio = p.maxFailureRatio
+	}
+	if changed("order") {
+		order, err := parseUpdateOrder(p.order)
+		if err != nil {
+			return fmt.Errorf("--%s-order: %w", p.prefix, err)
+		}
+		c.Order = order
+	}
+	return nil
+}
+
+// parseFailureAction parses an update or rollback failure action. A failed
+// rollback cannot itself be rolled back.
+func parseFailureAction(s string, rollback bool) (api.UpdateConfig_FailureAction, error) {
+	switch s {
+	case "", "pause":
+		return api.UpdateConfig_PAUSE, nil
+	case "continue":
+		return api.UpdateConfig_CONTINUE, nil
+	case "rollback":
+		if !rollback {
+			return api.UpdateConfig_ROLLBACK, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid failure action %q", s)
+}
+
+// parseUpdateOrder parses the order in which tasks are replaced
+func parseUpdateOrder(s string) (api.UpdateConfig_UpdateOrder, error) {
+	switch s {
+	case "", "stop-first":
+		return api.UpdateConfig_STOP_FIRST, nil
+	case "start-first":
+		return api.UpdateConfig_START_FIRST, nil
+	}
+	return 0, fmt.Errorf("invalid update order %q", s)
+}
+
+// How often "service update --watch" polls the manager
+var watchPollInterval = time.Second
+
+// watchServiceUpdate follows a service's rolling update, or the rollback
+// requested with rollback set, printing each task of the new spec as its
+// state changes until the update completes, pauses or is rolled back.
+func watchServiceUpdate(ctx context.Context, client api.ControlClient, out io.Writer, serviceID string, rollback bool) error {
+	seen := map[string]api.TaskState{}
+	var lastState api.UpdateStatus_UpdateState = -1
+
+	ticker := time.NewTicker(watchPollInterval)
+	defer ticker.Stop()
+
+	for {
+		svcResp, err := client.GetService(ctx, &api.GetServiceRequest{ServiceID: serviceID})
+		if err != nil {
+			return fmt.Errorf("failed to get service: %w", err)
+		}
+		svc := svcResp.Service
+
+		tasksResp, err := client.ListTasks(ctx, &api.ListTasksRequest{
+			Filters: &api.ListTasksRequest_Filters{ServiceIDs: []string{serviceID}},
+		})
+		if err != nil {
+			return fmt.Errorf("failed to list tasks: %w", err)
+		}
+
+		// Tasks of the spec being rolled out, in slot order for replicated
+		// services
+		var current []*api.Task
+		for _, t := range tasksResp.Tasks {
+			if svc.SpecVersion != nil && t.SpecVersion != nil && t.SpecVersion.Index != svc.SpecVersion.Index {
+				continue
+			}
+			if t.DesiredState > api.TaskStateRunning {
+				continue
+			}
+			current = append(current, t)
+		}
+		sort.Slice(current, func(i, j int) bool { return current[i].Slot < current[j].Slot })
+
+		running := 0
+		for _, t := range current {
+			if t.Status.State == api.TaskStateRunning {
+				running++
+			}
+			if prev, ok := seen[t.ID]; ok && prev == t.Status.State {
+				continue
+			}
+			seen[t.ID] = t.Status.State
+			fmt.Fprintf(out, "%-24s %-12s %-10s %s\n", taskName(svc, t), truncateID(t.ID),
+				strings.ToLower(t.Status.State.String()), t.Status.Message)
+		}
+
+		if us := svc.UpdateStatus; us != nil && us.State != lastState {
+			lastState = us.State
+			fmt.Fprintf(out, "update %s", strings.ToLower(us.State.String()))
+			if us.Message != "" {
+				fmt.Fprintf(out, ": %s", us.Message)
+			}
+			fmt.Fprintln(out)
+		}
+
+		switch {
+		case svc.UpdateStatus == nil:
+			// Specs that change nothing the orchestrator acts on (or a first
+			// deploy) never get an update status
+			if want, ok := desiredTasks(svc); ok && running == want && len(current) == want {
+				fmt.Fprintf(out, "%d/%d tasks running\n", running, want)
+				return nil
+			}
+		case svc.UpdateStatus.State == api.UpdateStatus_COMPLETED:
+			return nil
+		case svc.UpdateStatus.State == api.UpdateStatus_ROLLBACK_COMPLETED:
+			if rollback {
+				return nil
+			}
+			return fmt.Errorf("update rolled back: %s", svc.UpdateStatus.Message)
+		case svc.UpdateStatus.State == api.UpdateStatus_PAUSED,
+			svc.UpdateStatus.State == api.UpdateStatus_ROLLBACK_PAUSED:
+			return fmt.Errorf("update %s: %s", strings.ToLower(svc.UpdateStatus.State.String()), svc.UpdateStatus.Message)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// desiredTasks returns how many tasks a replicated service should run
+func desiredTasks(svc *api.Service) (int, bool) {
+	if r := svc.Spec.GetReplicated(); r != nil {
+		return int(r.Replicas), true
+	}
+	return 0, false
+}
+
+// taskName names a task like "docker service ps" does: <service>.<slot>,
+// or <service>.<node> for global services
+func taskName(svc *api.Service, t *api.Task) string {
+	if t.Slot != 0 {
+		return fmt.Sprintf("%s.%d", svc.Spec.Annotations.Name, t.Slot)
+	}
+	return fmt.Sprintf("%s.%s", svc.Spec.Annotations.Name, truncateID(t.NodeID))
+}
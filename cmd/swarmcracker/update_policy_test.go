@@ -0,0 +1,234 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	gogotypes "github.com/gogo/protobuf/types"
+	"github.com/moby/swarmkit/v2/api"
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+)
+
+func TestUpdatePolicyFlags(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		current *api.UpdateConfig
+		want    *api.UpdateConfig
+		wantErr bool
+	}{
+		{
+			name: "no flags",
+			args: nil,
+			want: nil,
+		},
+		{
+			name: "all flags",
+			args: []string{
+				"--update-parallelism=2", "--update-delay=10s", "--update-failure-action=rollback",
+				"--update-monitor=30s", "--update-max-failure-ratio=0.25", "--update-order=start-first",
+			},
+			want: &api.UpdateConfig{
+				Parallelism:     2,
+				Delay:           10 * time.Second,
+				FailureAction:   api.UpdateConfig_ROLLBACK,
+				Monitor:         gogotypes.DurationProto(30 * time.Second),
+				MaxFailureRatio: 0.25,
+				Order:           api.UpdateConfig_START_FIRST,
+			},
+		},
+		{
+			name:    "keeps what is not given",
+			args:    []string{"--update-order=start-first"},
+			current: &api.UpdateConfig{Parallelism: 3, Delay: time.Second},
+			want:    &api.UpdateConfig{Parallelism: 3, Delay: time.Second, Order: api.UpdateConfig_START_FIRST},
+		},
+		{
+			name: "new policy defaults to one task at a time",
+			args: []string{"--update-delay=5s"},
+			want: &api.UpdateConfig{Parallelism: 1, Delay: 5 * time.Second},
+		},
+		{name: "bad action", args: []string{"--update-failure-action=retry"}, wantErr: true},
+		{name: "bad order", args: []string{"--update-order=random"}, wantErr: true},
+		{name: "bad ratio", args: []string{"--update-max-failure-ratio=1.5"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := &cobra.Command{Use: "update"}
+			p := addUpdatePolicyFlags(cmd, "update")
+			require.NoError(t, cmd.ParseFlags(tt.args))
+			cfg := tt.current
+			err := p.apply(cmd, &cfg)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, cfg)
+		})
+	}
+}
+
+func TestParseFailureAction(t *testing.T) {
+	action, err := parseFailureAction("rollback", false)
+	require.NoError(t, err)
+	assert.Equal(t, api.UpdateConfig_ROLLBACK, action)
+
+	// A failed rollback cannot be rolled back
+	_, err = parseFailureAction("rollback", true)
+	assert.Error(t, err)
+
+	action, err = parseFailureAction("continue", true)
+	require.NoError(t, err)
+	assert.Equal(t, api.UpdateConfig_CONTINUE, action)
+}
+
+// scriptedControl advances a fake cluster one step each time the watched
+// service is read
+type scriptedControl struct {
+	*fakeControl
+	steps []func()
+}
+
+func (s *scriptedControl) GetService(ctx context.Context, r *api.GetServiceRequest, opts ...grpc.CallOption) (*api.GetServiceResponse, error) {
+	if len(s.steps) > 0 {
+		s.steps[0]()
+		s.steps = s.steps[1:]
+	}
+	return s.fakeControl.GetService(ctx, r, opts...)
+}
+
+func TestWatchServiceUpdate(t *testing.T) {
+	old := watchPollInterval
+	watchPollInterval = time.Millisecond
+	defer func() { watchPollInterval = old }()
+
+	newService := func() (*fakeControl, *api.Service) {
+		fake := newFakeControl()
+		svc := &api.Service{
+			ID:          "svc1",
+			Spec:        api.ServiceSpec{Annotations: api.Annotations{Name: "web"}, Mode: &api.ServiceSpec_Replicated{Replicated: &api.ReplicatedService{Replicas: 2}}},
+			SpecVersion: &api.Version{Index: 2},
+		}
+		fake.services[svc.ID] = svc
+		fake.tasks = []*api.Task{
+			{ID: "old1", ServiceID: "svc1", Slot: 1, SpecVersion: &api.Version{Index: 1}, DesiredState: api.TaskStateShutdown},
+		}
+		return fake, svc
+	}
+	task := func(id string, slot uint64, state api.TaskState) *api.Task {
+		return &api.Task{ID: id, ServiceID: "svc1", Slot: slot, SpecVersion: &api.Version{Index: 2},
+			DesiredState: api.TaskStateRunning, Status: api.TaskStatus{State: state}}
+	}
+
+	t.Run("completes", func(t *testing.T) {
+		fake, svc := newService()
+		var new1, new2 *api.Task
+		client := &scriptedControl{fakeControl: fake, steps: []func(){
+			func() {
+				svc.UpdateStatus = &api.UpdateStatus{State: api.UpdateStatus_UPDATING}
+				new1 = task("new1", 1, api.TaskStateStarting)
+				fake.tasks = append(fake.tasks, new1)
+			},
+			func() { new1.Status.State = api.TaskStateRunning },
+			func() {
+				new2 = task("new2", 2, api.TaskStateRunning)
+				fake.tasks = append(fake.tasks, new2)
+				svc.UpdateStatus = &api.UpdateStatus{State: api.UpdateStatus_COMPLETED, Message: "update completed"}
+			},
+		}}
+
+		var out bytes.Buffer
+		require.NoError(t, watchServiceUpdate(context.Background(), client, &out, "svc1", false))
+		assert.Equal(t, ""+
+			"web.1                    new1         starting   \n"+
+			"update updating\n"+
+			"web.1                    new1         running    \n"+
+			"web.2                    new2         running    \n"+
+			"update completed: update completed\n", out.String())
+		assert.NotContains(t, out.String(), "old1", "tasks of the old spec are not shown")
+	})
+
+	t.Run("rolled back", func(t *testing.T) {
+		fake, svc := newService()
+		svc.UpdateStatus = &api.UpdateStatus{State: api.UpdateStatus_ROLLBACK_COMPLETED, Message: "rollback completed"}
+
+		var out bytes.Buffer
+		assert.Error(t, watchServiceUpdate(context.Background(), fake, &out, "svc1", false))
+		assert.NoError(t, watchServiceUpdate(context.Background(), fake, &out, "svc1", true))
+	})
+
+	t.Run("paused", func(t *testing.T) {
+		fake, svc := newService()
+		svc.UpdateStatus = &api.UpdateStatus{State: api.UpdateStatus_PAUSED, Message: "update paused due to failure"}
+
+		var out bytes.Buffer
+		err := watchServiceUpdate(context.Background(), fake, &out, "svc1", false)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "update paused due to failure")
+	})
+
+	t.Run("no update status", func(t *testing.T) {
+		fake, _ := newService()
+		fake.tasks = append(fake.tasks, task("new1", 1, api.TaskStateRunning), task("new2", 2, api.TaskStateRunning))
+
+		var out bytes.Buffer
+		require.NoError(t, watchServiceUpdate(context.Background(), fake, &out, "svc1", false))
+		assert.Contains(t, out.String(), "2/2 tasks running")
+	})
+
+	t.Run("canceled", func(t *testing.T) {
+		fake, _ := newService()
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		var out bytes.Buffer
+		assert.ErrorIs(t, watchServiceUpdate(ctx, fake, &out, "svc1", false), context.DeadlineExceeded)
+	})
+}
+
+func TestRequestRollback(t *testing.T) {
+	ctx := context.Background()
+	fake := newFakeControl()
+	svc, err := fake.CreateService(ctx, &api.CreateServiceRequest{Spec: &api.ServiceSpec{
+		Annotations: api.Annotations{Name: "web"},
+		Task:        api.TaskSpec{Runtime: &api.TaskSpec_Container{Container: &api.ContainerSpec{Image: "nginx:1"}}},
+	}})
+	require.NoError(t, err)
+
+	// Nothing to roll back to yet
+	assert.Error(t, requestRollback(ctx, fake, svc.Service))
+
+	spec := svc.Service.Spec.Copy()
+	spec.Task.GetContainer().Image = "nginx:2"
+	_, err = fake.UpdateService(ctx, &api.UpdateServiceRequest{ServiceID: svc.Service.ID, ServiceVersion: &svc.Service.Meta.Version, Spec: spec})
+	require.NoError(t, err)
+
+	current, err := resolveService(ctx, fake, "web")
+	require.NoError(t, err)
+	require.NoError(t, requestRollback(ctx, fake, current))
+	assert.Equal(t, "nginx:1", fake.services[svc.Service.ID].Spec.Task.GetContainer().Image)
+	assert.Equal(t, api.UpdateStatus_ROLLBACK_STARTED, fake.services[svc.Service.ID].UpdateStatus.State)
+
+	_, err = resolveService(ctx, fake, "nope")
+	assert.Error(t, err)
+}
+
+func TestNewServiceRollbackCommand(t *testing.T) {
+	cmd := newServiceRollbackCommand()
+	assert.Equal(t, "rollback <service-id>", cmd.Use)
+	assert.NotNil(t, cmd.Flags().Lookup("watch"))
+
+	for _, name := range []string{"update-order", "rollback-parallelism", "watch"} {
+		assert.NotNil(t, newServiceUpdateCommand().Flags().Lookup(name), name)
+	}
+	for _, name := range []string{"update-failure-action", "rollback-monitor"} {
+		assert.NotNil(t, newServiceCreateCommand().Flags().Lookup(name), name)
+	}
+}
@@ -24,11 +24,15 @@ import (
 	"github.com/moby/swarmkit/v2/log"
 	"github.com/moby/swarmkit/v2/manager/allocator/networkallocator"
 	"github.com/moby/swarmkit/v2/node"
+	"github.com/restuhaqza/swarmcracker/pkg/balloon"
 	"github.com/restuhaqza/swarmcracker/pkg/cni"
 	"github.com/restuhaqza/swarmcracker/pkg/config"
+	"github.com/restuhaqza/swarmcracker/pkg/events"
 	"github.com/restuhaqza/swarmcracker/pkg/health"
 	"github.com/restuhaqza/swarmcracker/pkg/logging"
+	"github.com/restuhaqza/swarmcracker/pkg/metrics"
 	"github.com/restuhaqza/swarmcracker/pkg/swarmkit"
+	"github.com/restuhaqza/swarmcracker/pkg/tracing"
 	"github.com/rs/zerolog"
 	"github.com/sirupsen/logrus"
 	"github.com/urfave/cli/v2"
@@ -43,6 +47,7 @@ var (
 
 const (
 	defaultStateDir  = "/var/lib/swarmkit"
+	ipamGCInterval   = 5 * time.Minute
 	defaultJoinRetry = 3
 )
 
@@ -52,6 +57,12 @@ func main() {
 	app.Usage = "SwarmKit agent with Firecracker microVM executor"
 	app.Version = Version
 	app.Flags = []cli.Flag{
+		&cli.StringFlag{
+			Name:    "config",
+			Aliases: []string{"c"},
+			Usage:   "Path to config file (settings precedence: defaults < file < SWARMCRACKER_* env < flags)",
+			Value:   config.GetDefaultConfigPath(),
+		},
 		&cli.StringFlag{
 			Name:    "state-dir",
 			Aliases: []string{"d"},
@@ -166,6 +177,29 @@ func main() {
 			Usage: "Address for health check HTTP server",
 			Value: "127.0.0.1:8080",
 		},
+		&cli.StringFlag{
+			Name:  "events-socket",
+			Usage: "Unix socket for the task lifecycle events API",
+			Value: "/var/run/swarmcracker/events.sock",
+		},
+		&cli.BoolFlag{
+			Name:  "metrics-enabled",
+			Usage: "Serve Prometheus metrics at /metrics",
+		},
+		&cli.StringFlag{
+			Name:  "metrics-addr",
+			Usage: "Address for the Prometheus metrics HTTP server",
+			Value: "127.0.0.1:9100",
+		},
+		&cli.BoolFlag{
+			Name:  "tracing-enabled",
+			Usage: "Export OpenTelemetry traces of task starts",
+		},
+		&cli.StringFlag{
+			Name:  "tracing-endpoint",
+			Usage: "OTLP/HTTP collector URL for traces",
+			Value: "http://127.0.0.1:4318",
+		},
 		&cli.BoolFlag{
 			Name:  "enable-jailer",
 			Usage: "Enable Firecracker jailer for enhanced security isolation",
@@ -268,13 +302,26 @@ func main() {
 }
 
 func runAgent(ctx *cli.Context) error {
+	// Ensure default config exists (auto-generate on first run)
+	if ctx.String("config") == config.GetDefaultConfigPath() {
+		if created, err := config.EnsureDefaultConfig(); err != nil {
+			log.G(context.Background()).Warnf("Failed to create default config: %v (continuing with defaults and flags)", err)
+		} else if created {
+			log.G(context.Background()).Infof("Default config created at %s", config.GetDefaultConfigPath())
+		}
+	}
+
+	cfg, err := loadAgentConfig(ctx)
+	if err != nil {
+		return err
+	}
+
 	// Setup logging
-	setupLogging(ctx)
+	setupLogging(cfg.Logging.Level)
 
 	// Get hostname
-	hostname := ctx.String("hostname")
+	hostname := cfg.Agent.Hostname
 	if hostname == "" {
-		var err error
 		hostname, err = os.Hostname()
 		if err != nil {
 			return fmt.Errorf("failed to get hostname: %w", err)
@@ -282,52 +329,13 @@ func runAgent(ctx *cli.Context) error {
 	}
 
 	// Create state directory
-	stateDir := ctx.String("state-dir")
+	stateDir := cfg.Agent.StateDir
 	if err := os.MkdirAll(stateDir, 0755); err != nil {
 		return fmt.Errorf("failed to create state directory: %w", err)
 	}
 
-	// Ensure default config exists (auto-generate on first run)
-	if created, err := config.EnsureDefaultConfig(); err != nil {
-		log.G(context.Background()).Warnf("Failed to create default config: %v (continuing with CLI flags)", err)
-	} else if created {
-		log.G(context.Background()).Infof("Default config created at %s", config.GetDefaultConfigPath())
-	}
-
 	// Create SwarmCracker executor
-	natEnabled := ctx.Bool("nat-enabled")
-	executorConfig := &swarmkit.Config{
-		FirecrackerPath: "firecracker",
-		KernelPath:      ctx.String("kernel-path"),
-		RootfsDir:       ctx.String("rootfs-dir"),
-		Hostname:        hostname,
-		JoinAddr:        ctx.String("join-addr"),
-		AdvertiseAddr:   ctx.String("advertise-remote-api"), // For managers, use advertise address
-		ConsulEnabled:   ctx.Bool("consul-enabled"),
-		ConsulAddress:   ctx.String("consul-address"),
-		SocketDir:       ctx.String("socket-dir"),
-		DefaultVCPUs:    ctx.Int("default-vcpus"),
-		DefaultMemoryMB: ctx.Int("default-memory"),
-		BridgeName:      ctx.String("bridge-name"),
-		Subnet:          ctx.String("subnet"),
-		BridgeIP:        ctx.String("bridge-ip"),
-		IPMode:          ctx.String("ip-mode"),
-		NATEnabled:      &natEnabled,
-		VXLANEnabled:    ctx.Bool("vxlan-enabled"),
-		VXLANPeers:      parseCommaSeparated(ctx.String("vxlan-peers")),
-		// Consul service discovery
-		Debug:    ctx.Bool("debug"),
-		StateDir: stateDir,
-		// Jailer configuration
-		EnableJailer:    ctx.Bool("enable-jailer"),
-		JailerPath:      ctx.String("jailer-path"),
-		JailerUID:       ctx.Int("jailer-uid"),
-		JailerGID:       ctx.Int("jailer-gid"),
-		JailerChrootDir: ctx.String("jailer-chroot-dir"),
-		ParentCgroup:    ctx.String("parent-cgroup"),
-		CgroupVersion:   ctx.String("cgroup-version"),
-		EnableCgroups:   ctx.Bool("enable-cgroups"),
-	}
+	executorConfig := swarmkit.ConfigFrom(cfg, hostname)
 
 	fcExecutor, err := swarmkit.NewExecutor(executorConfig)
 	if err != nil {
@@ -353,31 +361,94 @@ func runAgent(ctx *cli.Context) error {
 	}
 
 	// Start health check server
-	healthChecker := health.NewChecker(ctx.String("bridge-name"), "firecracker")
+	healthChecker := health.NewChecker(cfg.Network.BridgeName, "firecracker")
 	go func() {
 		mux := http.NewServeMux()
 		mux.Handle("/healthz", healthChecker)
-		healthAddr := ctx.String("health-addr")
+		healthAddr := cfg.Agent.HealthAddr
 		log.G(context.Background()).Infof("Starting health check server on %s", healthAddr)
 		if err := http.ListenAndServe(healthAddr, mux); err != nil {
 			log.G(context.Background()).WithError(err).Warn("Health check server failed")
 		}
 	}()
 
+	// Start events server
+	eventBus := events.NewBus(hostname, events.DefaultHistory)
+	fcExecutor.SetEventPublisher(eventBus)
+	eventsServer := events.NewServer(eventBus, cfg.Agent.EventsSocket)
+	if err := eventsServer.Start(); err != nil {
+		log.G(context.Background()).WithError(err).Warn("Events server failed, events are still recorded but not served")
+	} else {
+		defer eventsServer.Close()
+		log.G(context.Background()).Infof("Serving task events on %s", cfg.Agent.EventsSocket)
+	}
+
+	// Start metrics server
+	if cfg.Metrics.Enabled {
+		exporter := metrics.NewExporter(hostname)
+		fcExecutor.SetMetricsExporter(exporter)
+		go func() {
+			mux := http.NewServeMux()
+			mux.Handle("/metrics", exporter.Handler())
+			log.G(context.Background()).Infof("Starting metrics server on %s", cfg.Metrics.Address)
+			if err := http.ListenAndServe(cfg.Metrics.Address, mux); err != nil {
+				log.G(context.Background()).WithError(err).Warn("Metrics server failed")
+			}
+		}()
+	}
+
+	// Reclaim idle guest memory through balloons
+	if reclaim := cfg.Executor.Balloon.Reclaim; reclaim.Enabled {
+		reclaimer := balloon.NewReclaimer(balloon.ReclaimerConfig{
+			Interval:            reclaim.Interval.ToDuration(),
+			PSIThreshold:        reclaim.PSIThreshold,
+			MinAvailablePercent: reclaim.MinAvailablePercent,
+			StepMiB:             reclaim.StepMiB,
+			MaxPercent:          reclaim.MaxPercent,
+			GuestReservePercent: reclaim.GuestReservePercent,
+		})
+		fcExecutor.SetBalloonReclaimer(reclaimer)
+		reclaimCtx, stopReclaim := context.WithCancel(context.Background())
+		defer stopReclaim()
+		go reclaimer.Run(reclaimCtx)
+		log.G(context.Background()).Info("Balloon reclaimer started")
+	}
+
+	// Export traces
+	if cfg.Tracing.Enabled {
+		shutdown, err := tracing.Setup(context.Background(), tracing.Options{
+			Endpoint:    cfg.Tracing.Endpoint,
+			SampleRatio: cfg.Tracing.SampleRatio,
+			Node:        hostname,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to set up tracing: %w", err)
+		}
+		defer func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := shutdown(ctx); err != nil {
+				log.G(ctx).WithError(err).Warn("Failed to flush traces")
+			}
+		}()
+		log.G(context.Background()).Infof("Exporting traces to %s", cfg.Tracing.Endpoint)
+	}
+
 	// Create CNI network provider if enabled
 	var networkProvider networkallocator.Provider
 	var networkConfig *networkallocator.Config
 
-	if ctx.Bool("enable-cni") {
+	if cfg.Agent.CNI.Enabled {
 		cniConfig := &cni.CNIConfig{
-			BridgeName:   ctx.String("bridge-name"),
-			SubnetPool:   ctx.String("cni-subnet-pool"),
-			SubnetSize:   ctx.Int("cni-subnet-size"),
-			VXLANPort:    uint32(ctx.Int("cni-vxlan-port")),
-			IPAMType:     "host-local",
-			PluginDir:    ctx.String("cni-plugin-dir"),
-			ConfigDir:    ctx.String("cni-config-dir"),
-			EnableIPMasq: true,
+			BridgeName:    cfg.Network.BridgeName,
+			SubnetPool:    cfg.Agent.CNI.SubnetPool,
+			SubnetSize:    cfg.Agent.CNI.SubnetSize,
+			VXLANPort:     uint32(cfg.Agent.CNI.VXLANPort),
+			IPAMType:      "host-local",
+			PluginDir:     cfg.Agent.CNI.PluginDir,
+			ConfigDir:     cfg.Agent.CNI.ConfigDir,
+			EnableIPMasq:  true,
+			IPAMStateFile: filepath.Join(stateDir, "network", "cni-ipam.json"),
 		}
 
 		cniProvider, err := cni.NewCNIProvider(cniConfig)
@@ -385,6 +456,18 @@ func runAgent(ctx *cli.Context) error {
 			return fmt.Errorf("failed to create CNI provider: %w", err)
 		}
 
+		// Periodically release IPs whose tasks, nodes or services are gone.
+		// The first run waits a full interval so SwarmKit can restore its state.
+		go func() {
+			ticker := time.NewTicker(ipamGCInterval)
+			defer ticker.Stop()
+			for range ticker.C {
+				if err := cniProvider.RunGC(context.Background()); err != nil {
+					log.G(context.Background()).WithError(err).Warn("IPAM garbage collection failed")
+				}
+			}
+		}()
+
 		networkProvider = cniProvider
 		networkConfig = &networkallocator.Config{
 			DefaultAddrPool: []string{cniConfig.SubnetPool},
@@ -408,28 +491,144 @@ func runAgent(ctx *cli.Context) error {
 	nodeConfig := &node.Config{
 		Hostname:           hostname,
 		StateDir:           stateDir,
-		JoinAddr:           ctx.String("join-addr"),
-		JoinToken:          ctx.String("join-token"),
-		ListenRemoteAPI:    ctx.String("listen-remote-api"),
-		ListenControlAPI:   ctx.String("listen-control-api"),
-		AdvertiseRemoteAPI: ctx.String("advertise-remote-api"),
+		JoinAddr:           cfg.Agent.JoinAddr,
+		JoinToken:          cfg.Agent.JoinToken,
+		ListenRemoteAPI:    cfg.Agent.ListenRemoteAPI,
+		ListenControlAPI:   cfg.Agent.ListenControlAPI,
+		AdvertiseRemoteAPI: cfg.Agent.AdvertiseRemoteAPI,
 		Executor:           fcExecutor,
 		NetworkProvider:    networkProvider, // ← CNI Provider
 		NetworkConfig:      networkConfig,   // ← Network config
 		ForceNewCluster:    ctx.Bool("force-new-cluster"),
-		HeartbeatTick:      uint32(ctx.Int("heartbeat-tick")),
-		ElectionTick:       uint32(ctx.Int("election-tick")),
+		HeartbeatTick:      uint32(cfg.Agent.HeartbeatTick),
+		ElectionTick:       uint32(cfg.Agent.ElectionTick),
 		Availability:       api.NodeAvailabilityActive,
 	}
 
+	// Reload safe-to-change settings on SIGHUP
+	reload := func() error {
+		next, err := loadAgentConfig(ctx)
+		if err != nil {
+			return err
+		}
+		changed, restartRequired := cfg.ApplyReload(next)
+		setLogLevel(cfg.Logging.Level)
+		if err := fcExecutor.Reload(swarmkit.RuntimeSettingsFrom(cfg)); err != nil {
+			return fmt.Errorf("failed to apply reloaded settings: %w", err)
+		}
+		log.G(context.Background()).Infof("Configuration reloaded (changed: %v)", changed)
+		if len(restartRequired) > 0 {
+			log.G(context.Background()).Warnf("Changes to %v need a restart to take effect", restartRequired)
+		}
+		return nil
+	}
+
 	// Start node
-	if err := startNode(nodeConfig, fcExecutor); err != nil {
+	if err := startNode(nodeConfig, fcExecutor, reload); err != nil {
 		return fmt.Errorf("failed to start node: %w", err)
 	}
 
 	return nil
 }
 
+// loadAgentConfig loads the configuration file named by --config, applies
+// SWARMCRACKER_* environment variables and then any flags set on the
+// command line, and validates the result.
+func loadAgentConfig(ctx *cli.Context) (*config.Config, error) {
+	cfg, err := config.Load(ctx.String("config"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config: %w", err)
+	}
+
+	applyFlags(ctx, cfg)
+
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+	return cfg, nil
+}
+
+// applyFlags overrides config fields with the flags set on the command line.
+// Unset flags keep the value from the defaults, file or environment.
+func applyFlags(ctx *cli.Context, cfg *config.Config) {
+	setString := func(flag string, dst *string) {
+		if ctx.IsSet(flag) {
+			*dst = ctx.String(flag)
+		}
+	}
+	setInt := func(flag string, dst *int) {
+		if ctx.IsSet(flag) {
+			*dst = ctx.Int(flag)
+		}
+	}
+	setBool := func(flag string, dst *bool) {
+		if ctx.IsSet(flag) {
+			*dst = ctx.Bool(flag)
+		}
+	}
+
+	setString("state-dir", &cfg.Agent.StateDir)
+	setString("join-addr", &cfg.Agent.JoinAddr)
+	setString("join-token", &cfg.Agent.JoinToken)
+	setString("listen-remote-api", &cfg.Agent.ListenRemoteAPI)
+	setString("listen-control-api", &cfg.Agent.ListenControlAPI)
+	setString("advertise-remote-api", &cfg.Agent.AdvertiseRemoteAPI)
+	setString("hostname", &cfg.Agent.Hostname)
+	setBool("manager", &cfg.Agent.Manager)
+	setString("health-addr", &cfg.Agent.HealthAddr)
+	setString("events-socket", &cfg.Agent.EventsSocket)
+	setBool("metrics-enabled", &cfg.Metrics.Enabled)
+	setString("metrics-addr", &cfg.Metrics.Address)
+	setBool("tracing-enabled", &cfg.Tracing.Enabled)
+	setString("tracing-endpoint", &cfg.Tracing.Endpoint)
+	setInt("heartbeat-tick", &cfg.Agent.HeartbeatTick)
+	setInt("election-tick", &cfg.Agent.ElectionTick)
+	setBool("consul-enabled", &cfg.Agent.Consul.Enabled)
+	setString("consul-address", &cfg.Agent.Consul.Address)
+
+	setString("kernel-path", &cfg.Executor.KernelPath)
+	setString("rootfs-dir", &cfg.Executor.RootfsDir)
+	setString("socket-dir", &cfg.Executor.SocketDir)
+	setInt("default-vcpus", &cfg.Executor.DefaultVCPUs)
+	setInt("default-memory", &cfg.Executor.DefaultMemoryMB)
+
+	setString("bridge-name", &cfg.Network.BridgeName)
+	setString("subnet", &cfg.Network.Subnet)
+	setString("bridge-ip", &cfg.Network.BridgeIP)
+	setString("ip-mode", &cfg.Network.IPMode)
+	if ctx.IsSet("nat-enabled") {
+		natEnabled := ctx.Bool("nat-enabled")
+		cfg.Network.NATEnabled = &natEnabled
+	}
+	setBool("vxlan-enabled", &cfg.Network.VXLANEnabled)
+	if ctx.IsSet("vxlan-peers") {
+		cfg.Network.VXLANStaticPeers = parseCommaSeparated(ctx.String("vxlan-peers"))
+	}
+
+	if ctx.IsSet("debug") && ctx.Bool("debug") {
+		cfg.Logging.Level = "debug"
+	}
+
+	setBool("enable-jailer", &cfg.Executor.EnableJailer)
+	setString("jailer-path", &cfg.Executor.Jailer.Path)
+	setInt("jailer-uid", &cfg.Executor.Jailer.UID)
+	setInt("jailer-gid", &cfg.Executor.Jailer.GID)
+	setString("jailer-chroot-dir", &cfg.Executor.Jailer.ChrootBaseDir)
+	setString("parent-cgroup", &cfg.Executor.Jailer.ParentCgroup)
+	setString("cgroup-version", &cfg.Executor.Jailer.CgroupVersion)
+	if ctx.IsSet("enable-cgroups") {
+		enableCgroups := ctx.Bool("enable-cgroups")
+		cfg.Executor.Jailer.EnableCgroups = &enableCgroups
+	}
+
+	setBool("enable-cni", &cfg.Agent.CNI.Enabled)
+	setString("cni-plugin-dir", &cfg.Agent.CNI.PluginDir)
+	setString("cni-config-dir", &cfg.Agent.CNI.ConfigDir)
+	setString("cni-subnet-pool", &cfg.Agent.CNI.SubnetPool)
+	setInt("cni-subnet-size", &cfg.Agent.CNI.SubnetSize)
+	setInt("cni-vxlan-port", &cfg.Agent.CNI.VXLANPort)
+}
+
 // parseCommaSeparated parses a comma-separated string into a slice.
 func parseCommaSeparated(s string) []string {
 	if s == "" {
@@ -517,7 +716,7 @@ func checkAndMigrateClusterAddress(stateDir, advertiseAddr string) error {
 	return nil
 }
 
-func startNode(config *node.Config, executor *swarmkit.Executor) error {
+func startNode(config *node.Config, executor *swarmkit.Executor, reload func() error) error {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
@@ -562,8 +761,15 @@ func startNode(config *node.Config, executor *swarmkit.Executor) error {
 		printJoinTokens(ctx, config.StateDir)
 	}
 
-	// Wait for shutdown signal
+	// Wait for shutdown signal; SIGHUP reloads the configuration instead
 	sig := <-sigChan
+	for sig == syscall.SIGHUP {
+		log.G(ctx).Info("Received SIGHUP, reloading configuration")
+		if err := reload(); err != nil {
+			log.G(ctx).WithError(err).Error("Failed to reload configuration, keeping current settings")
+		}
+		sig = <-sigChan
+	}
 	log.G(ctx).WithField("signal", sig).Info("Received shutdown signal")
 
 	// Stop the node gracefully
@@ -576,7 +782,7 @@ func startNode(config *node.Config, executor *swarmkit.Executor) error {
 		return err
 	}
 
-	// Close executor (cleanup dnsmasq, VXLAN)
+	// Close executor (stop DHCP/DNS, VXLAN)
 	if err := executor.Close(); err != nil {
 		log.G(ctx).WithError(err).Warn("Failed to close executor")
 	}
@@ -590,13 +796,9 @@ func startNode(config *node.Config, executor *swarmkit.Executor) error {
 	return nil
 }
 
-func setupLogging(ctx *cli.Context) {
+func setupLogging(levelName string) {
 	// Setup SwarmKit logging (uses logrus)
-	level := logrus.InfoLevel
-	if ctx.Bool("debug") {
-		level = logrus.DebugLevel
-	}
-	logrus.SetLevel(level)
+	setLogLevel(levelName)
 	logrus.SetOutput(os.Stderr)
 	logrus.SetFormatter(&logrus.TextFormatter{
 		FullTimestamp: true,
@@ -608,6 +810,22 @@ func setupLogging(ctx *cli.Context) {
 	logging.InstallZerologHook(zlogger)
 }
 
+// setLogLevel sets the logrus (SwarmKit) and zerolog (SwarmCracker) levels.
+// Unknown names fall back to info.
+func setLogLevel(levelName string) {
+	level, err := logrus.ParseLevel(levelName)
+	if err != nil {
+		level = logrus.InfoLevel
+	}
+	logrus.SetLevel(level)
+
+	zlevel, err := zerolog.ParseLevel(levelName)
+	if err != nil {
+		zlevel = zerolog.InfoLevel
+	}
+	zerolog.SetGlobalLevel(zlevel)
+}
+
 // printJoinTokens reads the actual join tokens from the cluster's Raft store
 // via the local control API socket using the node's own TLS certificates.
 func printJoinTokens(ctx context.Context, stateDir string) {
@@ -0,0 +1,107 @@
+// Package arch describes the host architectures Firecracker runs on and
+// what differs between them: names, guest console and kernel arguments,
+// and the image platform VMs need.
+package arch
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+)
+
+// Arch is a Firecracker host architecture. Guests always have the host's
+// architecture, since KVM cannot emulate another one.
+type Arch struct {
+	// Name is the Go and OCI name: amd64 or arm64
+	Name string
+	// Machine is the kernel name (uname -m) Firecracker, seccompiler and
+	// kernel artifacts use: x86_64 or aarch64
+	Machine string
+	// Variant is the OCI platform variant preferred when an image index
+	// has several images of the architecture
+	Variant string
+	// Console is the guest's serial console. Firecracker emulates an 8250
+	// UART on both architectures, so it is ttyS0 on both
+	Console string
+	// BootArgs are the kernel arguments every guest of the architecture
+	// gets, before the init and network arguments
+	BootArgs []string
+}
+
+var (
+	// AMD64 is x86_64. pci=off skips probing for the PCI bus Firecracker
+	// does not emulate.
+	AMD64 = Arch{
+		Name:     "amd64",
+		Machine:  "x86_64",
+		Console:  "ttyS0",
+		BootArgs: []string{"console=ttyS0", "reboot=k", "panic=1", "pci=off"},
+	}
+
+	// ARM64 is aarch64. keep_bootcon keeps the early console, set up from
+	// the device tree, until the serial driver takes over; pci= is an x86
+	// option the arm64 kernel would hand to init.
+	ARM64 = Arch{
+		Name:     "arm64",
+		Machine:  "aarch64",
+		Variant:  "v8",
+		Console:  "ttyS0",
+		BootArgs: []string{"keep_bootcon", "console=ttyS0", "reboot=k", "panic=1"},
+	}
+)
+
+// All lists the architectures Firecracker supports.
+var All = []Arch{AMD64, ARM64}
+
+// aliases maps the names architectures go by to their Go name
+var aliases = map[string]string{
+	"amd64":   "amd64",
+	"x86_64":  "amd64",
+	"x86-64":  "amd64",
+	"arm64":   "arm64",
+	"aarch64": "arm64",
+	"arm64v8": "arm64",
+}
+
+// Lookup returns the architecture for a Go, OCI or kernel name, e.g.
+// amd64, x86_64, arm64 or aarch64.
+func Lookup(name string) (Arch, error) {
+	goName := aliases[strings.ToLower(strings.TrimSpace(name))]
+	for _, a := range All {
+		if a.Name == goName {
+			return a, nil
+		}
+	}
+	return Arch{}, fmt.Errorf("unsupported architecture: %s (Firecracker requires amd64 or arm64)", name)
+}
+
+// Host returns the architecture of this machine.
+func Host() (Arch, error) {
+	return Lookup(runtime.GOARCH)
+}
+
+// Default returns the architecture of this machine, or amd64 on hosts
+// Firecracker does not support, which cannot boot VMs anyway.
+func Default() Arch {
+	if a, err := Host(); err == nil {
+		return a
+	}
+	return AMD64
+}
+
+// KernelArgs returns the architecture's kernel arguments as a command line.
+func (a Arch) KernelArgs() string {
+	return strings.Join(a.BootArgs, " ")
+}
+
+// ExpandPath replaces {arch} in path with the machine name, so one
+// configuration can name per-architecture kernels, e.g.
+// /usr/share/firecracker/vmlinux-{arch}.
+func (a Arch) ExpandPath(path string) string {
+	return strings.ReplaceAll(path, "{arch}", a.Machine)
+}
+
+// String returns the Go name.
+func (a Arch) String() string {
+	return a.Name
+}
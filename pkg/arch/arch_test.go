@@ -0,0 +1,267 @@
+package arch
+
+import (
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLookup(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    Arch
+		wantErr bool
+	}{
+		{"amd64", AMD64, false},
+		{"x86_64", AMD64, false},
+		{"X86-64", AMD64, false},
+		{"arm64", ARM64, false},
+		{"aarch64", ARM64, false},
+		{" arm64v8 ", ARM64, false},
+		{"riscv64", Arch{}, true},
+		{"", Arch{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Lookup(tt.name)
+			if tt.wantErr {
+				assert.ErrorContains(t, err, "unsupported architecture")
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestHost(t *testing.T) {
+	a, err := Host()
+	if runtime.GOARCH != "amd64" && runtime.GOARCH != "arm64" {
+		assert.Error(t, err)
+		assert.Equal(t, AMD64, Default())
+		return
+	}
+	require.NoError(t, err)
+	assert.Equal(t, runtime.GOARCH, a.Name)
+	assert.Equal(t, a, Default())
+}
+
+func TestKernelArgs(t *testing.T) {
+	tests := []struct {
+		arch Arch
+		want string
+	}{
+		{AMD64, "console=ttyS0 reboot=k panic=1 pci=off"},
+		{ARM64, "keep_bootcon console=ttyS0 reboot=k panic=1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.arch.Name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.arch.KernelArgs())
+			assert.Contains(t, tt.arch.KernelArgs(), "console="+tt.arch.Console)
+		})
+	}
+}
+
+func TestExpandPath(t *testing.T) {
+	assert.Equal(t, "/k/vmlinux-x86_64", AMD64.ExpandPath("/k/vmlinux-{arch}"))
+	assert.Equal(t, "/k/aarch64/vmlinux", ARM64.ExpandPath("/k/{arch}/vmlinux"))
+	assert.Equal(t, "/k/vmlinux", ARM64.ExpandPath("/k/vmlinux"))
+}
+
+func TestPlatform(t *testing.T) {
+	assert.Equal(t, v1.Platform{OS: "linux", Architecture: "amd64"}, AMD64.Platform())
+	assert.Equal(t, v1.Platform{OS: "linux", Architecture: "arm64", Variant: "v8"}, ARM64.Platform())
+}
+
+// descriptor returns a manifest descriptor for a platform, identified by
+// its size
+func descriptor(size int64, p *v1.Platform) v1.Descriptor {
+	return v1.Descriptor{Size: size, Platform: p}
+}
+
+func TestSelectManifest(t *testing.T) {
+	linux := func(arch, variant string) *v1.Platform {
+		return &v1.Platform{OS: "linux", Architecture: arch, Variant: variant}
+	}
+
+	tests := []struct {
+		name      string
+		arch      Arch
+		manifests []v1.Descriptor
+		want      int64
+		wantOK    bool
+	}{
+		{
+			name: "amd64 from multi-arch",
+			arch: AMD64,
+			manifests: []v1.Descriptor{
+				descriptor(1, linux("arm64", "v8")),
+				descriptor(2, linux("amd64", "")),
+				descriptor(3, linux("arm", "v7")),
+			},
+			want: 2, wantOK: true,
+		},
+		{
+			name: "arm64 prefers v8",
+			arch: ARM64,
+			manifests: []v1.Descriptor{
+				descriptor(1, linux("arm64", "")),
+				descriptor(2, linux("arm64", "v8")),
+				descriptor(3, linux("amd64", "")),
+			},
+			want: 2, wantOK: true,
+		},
+		{
+			name: "arm64 without variant",
+			arch: ARM64,
+			manifests: []v1.Descriptor{
+				descriptor(1, linux("amd64", "")),
+				descriptor(2, linux("arm64", "")),
+			},
+			want: 2, wantOK: true,
+		},
+		{
+			name: "arm64 other variant",
+			arch: ARM64,
+			manifests: []v1.Descriptor{
+				descriptor(1, linux("arm", "v7")),
+				descriptor(2, linux("arm64", "v9")),
+			},
+			want: 2, wantOK: true,
+		},
+		{
+			name: "aarch64 platform name",
+			arch: ARM64,
+			manifests: []v1.Descriptor{
+				descriptor(1, linux("aarch64", "")),
+			},
+			want: 1, wantOK: true,
+		},
+		{
+			name: "skips other OS",
+			arch: AMD64,
+			manifests: []v1.Descriptor{
+				descriptor(1, &v1.Platform{OS: "windows", Architecture: "amd64"}),
+				descriptor(2, linux("amd64", "")),
+			},
+			want: 2, wantOK: true,
+		},
+		{
+			name:      "missing platform is amd64",
+			arch:      AMD64,
+			manifests: []v1.Descriptor{descriptor(1, nil)},
+			want:      1, wantOK: true,
+		},
+		{
+			name:      "no arm64 image",
+			arch:      ARM64,
+			manifests: []v1.Descriptor{descriptor(1, linux("amd64", "")), descriptor(2, nil)},
+			wantOK:    false,
+		},
+		{
+			name:   "empty index",
+			arch:   AMD64,
+			wantOK: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := tt.arch.SelectManifest(tt.manifests)
+			assert.Equal(t, tt.wantOK, ok)
+			if tt.wantOK {
+				assert.Equal(t, tt.want, got.Size)
+			}
+		})
+	}
+}
+
+// pushIndex pushes an image index with an image per platform to a test
+// registry and returns its reference and the images
+func pushIndex(t *testing.T, platforms ...v1.Platform) (name.Reference, []v1.Image) {
+	t.Helper()
+	srv := httptest.NewServer(registry.New())
+	t.Cleanup(srv.Close)
+
+	var images []v1.Image
+	var adds []mutate.IndexAddendum
+	for i := range platforms {
+		img, err := random.Image(64, 1)
+		require.NoError(t, err)
+		images = append(images, img)
+		adds = append(adds, mutate.IndexAddendum{
+			Add:        img,
+			Descriptor: v1.Descriptor{Platform: &platforms[i]},
+		})
+	}
+	idx := mutate.AppendManifests(empty.Index, adds...)
+
+	ref, err := name.ParseReference(strings.TrimPrefix(srv.URL, "http://") + "/library/app:latest")
+	require.NoError(t, err)
+	require.NoError(t, remote.WriteIndex(ref, idx))
+	return ref, images
+}
+
+func TestImage(t *testing.T) {
+	ref, images := pushIndex(t, AMD64.Platform(), ARM64.Platform())
+
+	tests := []struct {
+		arch Arch
+		want v1.Image
+	}{
+		{AMD64, images[0]},
+		{ARM64, images[1]},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.arch.Name, func(t *testing.T) {
+			img, err := tt.arch.Image(ref)
+			require.NoError(t, err)
+			got, err := img.Digest()
+			require.NoError(t, err)
+			want, err := tt.want.Digest()
+			require.NoError(t, err)
+			assert.Equal(t, want, got)
+		})
+	}
+}
+
+func TestImage_NoMatch(t *testing.T) {
+	ref, _ := pushIndex(t, AMD64.Platform())
+
+	_, err := ARM64.Image(ref)
+	assert.ErrorContains(t, err, "has no image for linux/arm64")
+	assert.ErrorIs(t, err, ErrNoImage)
+}
+
+func TestImage_SingleManifest(t *testing.T) {
+	srv := httptest.NewServer(registry.New())
+	t.Cleanup(srv.Close)
+
+	img, err := random.Image(64, 1)
+	require.NoError(t, err)
+	ref, err := name.ParseReference(strings.TrimPrefix(srv.URL, "http://") + "/library/app:latest")
+	require.NoError(t, err)
+	require.NoError(t, remote.Write(ref, img))
+
+	got, err := ARM64.Image(ref)
+	require.NoError(t, err)
+	gotDigest, err := got.Digest()
+	require.NoError(t, err)
+	wantDigest, err := img.Digest()
+	require.NoError(t, err)
+	assert.Equal(t, wantDigest, gotDigest)
+}
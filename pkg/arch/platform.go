@@ -0,0 +1,76 @@
+package arch
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+// ErrNoImage is returned by Image when an image index has no image for
+// the architecture.
+var ErrNoImage = errors.New("no image for architecture")
+
+// Platform returns the OCI platform of the architecture's guests.
+func (a Arch) Platform() v1.Platform {
+	return v1.Platform{OS: "linux", Architecture: a.Name, Variant: a.Variant}
+}
+
+// SelectManifest picks the architecture's image among the manifests of an
+// image index: a linux image of the architecture with the preferred
+// variant, else one without a variant, else one with any other variant.
+// Manifests without a platform count as linux/amd64, as registries assume.
+func (a Arch) SelectManifest(manifests []v1.Descriptor) (v1.Descriptor, bool) {
+	var best v1.Descriptor
+	bestRank := 0
+	for _, m := range manifests {
+		p := v1.Platform{OS: "linux", Architecture: "amd64"}
+		if m.Platform != nil {
+			p = *m.Platform
+		}
+		if p.OS != "linux" || aliases[p.Architecture] != a.Name {
+			continue
+		}
+
+		rank := 1
+		switch p.Variant {
+		case a.Variant:
+			rank = 3
+		case "":
+			rank = 2
+		}
+		if rank > bestRank {
+			best, bestRank = m, rank
+		}
+	}
+	return best, bestRank > 0
+}
+
+// Image fetches the architecture's image of ref. Image indexes are
+// resolved with SelectManifest; a single image is returned as it is, for
+// the caller to check its platform.
+func (a Arch) Image(ref name.Reference, opts ...remote.Option) (v1.Image, error) {
+	desc, err := remote.Get(ref, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if !desc.MediaType.IsIndex() {
+		return desc.Image()
+	}
+
+	index, err := desc.ImageIndex()
+	if err != nil {
+		return nil, err
+	}
+	manifest, err := index.IndexManifest()
+	if err != nil {
+		return nil, err
+	}
+	child, ok := a.SelectManifest(manifest.Manifests)
+	if !ok {
+		return nil, fmt.Errorf("%s has no image for linux/%s: %w", ref, a.Name, ErrNoImage)
+	}
+	return index.Image(child.Digest)
+}
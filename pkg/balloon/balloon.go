@@ -0,0 +1,139 @@
+// Package balloon manages Firecracker memory balloon devices: the device
+// configuration, the balloon API of a running VM, and a reclaimer that
+// inflates balloons on idle VMs when the host runs short of memory.
+package balloon
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Label is the service label that turns the balloon on ("true") or off
+// ("false") for a service, overriding the node default.
+const Label = "swarmcracker.balloon"
+
+// MiB is the number of bytes in a mebibyte.
+const MiB = 1024 * 1024
+
+// Device is the balloon device configured before boot (PUT /balloon).
+type Device struct {
+	AmountMiB             int  `json:"amount_mib"`
+	DeflateOnOOM          bool `json:"deflate_on_oom"`
+	StatsPollingIntervalS int  `json:"stats_polling_interval_s"`
+}
+
+// Enabled reports whether a service with the given labels gets a balloon.
+// Services without the label use nodeDefault.
+func Enabled(nodeDefault bool, labels map[string]string) (bool, error) {
+	v, ok := labels[Label]
+	if !ok || v == "" {
+		return nodeDefault, nil
+	}
+	enabled, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, fmt.Errorf("label %s: invalid value %q, want true or false", Label, v)
+	}
+	return enabled, nil
+}
+
+// Stats are the balloon statistics reported by the guest
+// (GET /balloon/statistics). Memory fields are in bytes and are only set
+// once the guest has reported.
+type Stats struct {
+	TargetPages     int    `json:"target_pages"`
+	ActualPages     int    `json:"actual_pages"`
+	TargetMiB       int    `json:"target_mib"`
+	ActualMiB       int    `json:"actual_mib"`
+	SwapIn          uint64 `json:"swap_in,omitempty"`
+	SwapOut         uint64 `json:"swap_out,omitempty"`
+	MajorFaults     uint64 `json:"major_faults,omitempty"`
+	MinorFaults     uint64 `json:"minor_faults,omitempty"`
+	FreeMemory      uint64 `json:"free_memory,omitempty"`
+	TotalMemory     uint64 `json:"total_memory,omitempty"`
+	AvailableMemory uint64 `json:"available_memory,omitempty"`
+	DiskCaches      uint64 `json:"disk_caches,omitempty"`
+}
+
+// API is the balloon part of a VM's Firecracker API.
+type API interface {
+	Stats(ctx context.Context) (*Stats, error)
+	SetTarget(ctx context.Context, amountMiB int) error
+}
+
+// Client talks to the balloon endpoints of one VM's API socket.
+type Client struct {
+	http *http.Client
+}
+
+// NewClient creates a client for the Firecracker API at socketPath.
+func NewClient(socketPath string) *Client {
+	return &Client{http: &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", socketPath)
+			},
+		},
+		Timeout: 5 * time.Second,
+	}}
+}
+
+// Stats returns the VM's balloon statistics. It fails if the VM has no
+// balloon.
+func (c *Client) Stats(ctx context.Context) (*Stats, error) {
+	var stats Stats
+	if err := c.do(ctx, http.MethodGet, "/balloon/statistics", nil, &stats); err != nil {
+		return nil, err
+	}
+	return &stats, nil
+}
+
+// SetTarget changes the balloon's target size. The guest inflates or
+// deflates towards it asynchronously.
+func (c *Client) SetTarget(ctx context.Context, amountMiB int) error {
+	return c.do(ctx, http.MethodPatch, "/balloon", map[string]int{"amount_mib": amountMiB}, nil)
+}
+
+// do sends a request and decodes the response into out, if set.
+func (c *Client) do(ctx context.Context, method, path string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to marshal request: %w", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, "http://localhost"+path, reader)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s %s failed: %w", method, path, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("%s %s returned %d: %s", method, path, resp.StatusCode, bytes.TrimSpace(msg))
+	}
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return fmt.Errorf("failed to decode %s response: %w", path, err)
+		}
+	}
+	return nil
+}
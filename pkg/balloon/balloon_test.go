@@ -0,0 +1,93 @@
+package balloon
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEnabled(t *testing.T) {
+	tests := []struct {
+		name        string
+		nodeDefault bool
+		labels      map[string]string
+		want        bool
+		wantErr     bool
+	}{
+		{"node default off", false, nil, false, false},
+		{"node default on", true, nil, true, false},
+		{"label turns on", false, map[string]string{Label: "true"}, true, false},
+		{"label turns off", true, map[string]string{Label: "false"}, false, false},
+		{"empty label uses default", true, map[string]string{Label: ""}, true, false},
+		{"invalid label", true, map[string]string{Label: "maybe"}, false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Enabled(tt.nodeDefault, tt.labels)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+// startFirecracker serves a fake balloon API on a unix socket
+func startFirecracker(t *testing.T, handler http.HandlerFunc) string {
+	t.Helper()
+	socketPath := filepath.Join(t.TempDir(), "fc.sock")
+	l, err := net.Listen("unix", socketPath)
+	require.NoError(t, err)
+	srv := &http.Server{Handler: handler}
+	go srv.Serve(l)
+	t.Cleanup(func() { srv.Close() })
+	return socketPath
+}
+
+func TestClient(t *testing.T) {
+	var patched map[string]int
+	socketPath := startFirecracker(t, func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/balloon/statistics":
+			w.Write([]byte(`{"target_pages":16384,"actual_pages":8192,"target_mib":64,"actual_mib":32,` +
+				`"total_memory":536870912,"available_memory":268435456}`))
+		case r.Method == http.MethodPatch && r.URL.Path == "/balloon":
+			json.NewDecoder(r.Body).Decode(&patched)
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			http.Error(w, `{"fault_message":"not found"}`, http.StatusBadRequest)
+		}
+	})
+
+	client := NewClient(socketPath)
+	ctx := context.Background()
+
+	stats, err := client.Stats(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 64, stats.TargetMiB)
+	assert.Equal(t, 32, stats.ActualMiB)
+	assert.Equal(t, uint64(256*MiB), stats.AvailableMemory)
+
+	require.NoError(t, client.SetTarget(ctx, 128))
+	assert.Equal(t, map[string]int{"amount_mib": 128}, patched)
+}
+
+func TestClient_NoBalloon(t *testing.T) {
+	socketPath := startFirecracker(t, func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"fault_message":"Balloon device not configured"}`, http.StatusBadRequest)
+	})
+
+	_, err := NewClient(socketPath).Stats(context.Background())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "400")
+	assert.Contains(t, err.Error(), "not configured")
+}
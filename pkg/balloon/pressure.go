@@ -0,0 +1,92 @@
+package balloon
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// procDir is the proc filesystem root - overridable for testing
+var procDir = "/proc"
+
+// HostMemory is the host's memory state.
+type HostMemory struct {
+	TotalMiB     int
+	AvailableMiB int
+	// PSISome10 is the share of the last 10s in which some task stalled on
+	// memory, in percent. Zero when the kernel has no PSI support.
+	PSISome10 float64
+}
+
+// AvailablePercent is MemAvailable as a share of MemTotal.
+func (h HostMemory) AvailablePercent() float64 {
+	if h.TotalMiB == 0 {
+		return 100
+	}
+	return float64(h.AvailableMiB) * 100 / float64(h.TotalMiB)
+}
+
+// ReadHostMemory reads /proc/meminfo and, if present, /proc/pressure/memory.
+func ReadHostMemory() (HostMemory, error) {
+	var h HostMemory
+
+	f, err := os.Open(filepath.Join(procDir, "meminfo"))
+	if err != nil {
+		return h, fmt.Errorf("failed to read meminfo: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		kb, err := strconv.Atoi(fields[1])
+		if err != nil {
+			continue
+		}
+		switch fields[0] {
+		case "MemTotal:":
+			h.TotalMiB = kb / 1024
+		case "MemAvailable:":
+			h.AvailableMiB = kb / 1024
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return h, fmt.Errorf("failed to read meminfo: %w", err)
+	}
+	if h.TotalMiB == 0 {
+		return h, fmt.Errorf("MemTotal missing from meminfo")
+	}
+
+	// PSI needs CONFIG_PSI; without it only MemAvailable is used
+	data, err := os.ReadFile(filepath.Join(procDir, "pressure", "memory"))
+	if err != nil {
+		return h, nil
+	}
+	h.PSISome10 = parsePSISome10(string(data))
+	return h, nil
+}
+
+// parsePSISome10 extracts avg10 from the "some" line of a PSI file:
+//
+//	some avg10=1.23 avg60=0.50 avg300=0.10 total=12345
+func parsePSISome10(data string) float64 {
+	for _, line := range strings.Split(data, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || fields[0] != "some" {
+			continue
+		}
+		for _, f := range fields[1:] {
+			if v, ok := strings.CutPrefix(f, "avg10="); ok {
+				n, _ := strconv.ParseFloat(v, 64)
+				return n
+			}
+		}
+	}
+	return 0
+}
@@ -0,0 +1,189 @@
+package balloon
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// ReclaimerConfig tunes when and how far balloons are inflated.
+type ReclaimerConfig struct {
+	// Interval between control steps.
+	Interval time.Duration
+	// PSIThreshold is the host memory pressure (PSI "some" avg10, percent)
+	// at which balloons start to inflate.
+	PSIThreshold float64
+	// MinAvailablePercent is the host MemAvailable share below which
+	// balloons start to inflate, regardless of PSI.
+	MinAvailablePercent float64
+	// StepMiB is how far a balloon moves per step.
+	StepMiB int
+	// MaxPercent caps a balloon as a share of its VM's memory.
+	MaxPercent int
+	// GuestReservePercent is the share of a VM's memory that must stay
+	// available in the guest. Below it the balloon deflates; a VM is only
+	// considered idle, and inflated, while it has a step more than that.
+	GuestReservePercent int
+}
+
+// DefaultReclaimerConfig returns the defaults used for unset fields.
+func DefaultReclaimerConfig() ReclaimerConfig {
+	return ReclaimerConfig{
+		Interval:            10 * time.Second,
+		PSIThreshold:        10,
+		MinAvailablePercent: 10,
+		StepMiB:             64,
+		MaxPercent:          50,
+		GuestReservePercent: 20,
+	}
+}
+
+// newAPI returns the balloon API of a VM - overridable for testing
+var newAPI = func(socketPath string) API {
+	return NewClient(socketPath)
+}
+
+// readHostMemory reads the host memory state - overridable for testing
+var readHostMemory = ReadHostMemory
+
+// trackedVM is a VM with a balloon under the reclaimer's control.
+type trackedVM struct {
+	api    API
+	memMiB int
+}
+
+// Reclaimer inflates the balloons of idle VMs while the host is under
+// memory pressure, and deflates them once the pressure is gone or when a
+// guest runs low on memory itself.
+//
+// A nil *Reclaimer is valid and tracks nothing.
+type Reclaimer struct {
+	cfg ReclaimerConfig
+
+	mu  sync.Mutex
+	vms map[string]*trackedVM // taskID -> VM
+}
+
+// NewReclaimer creates a reclaimer. Zero fields of cfg use the defaults.
+func NewReclaimer(cfg ReclaimerConfig) *Reclaimer {
+	def := DefaultReclaimerConfig()
+	if cfg.Interval <= 0 {
+		cfg.Interval = def.Interval
+	}
+	if cfg.PSIThreshold <= 0 {
+		cfg.PSIThreshold = def.PSIThreshold
+	}
+	if cfg.MinAvailablePercent <= 0 {
+		cfg.MinAvailablePercent = def.MinAvailablePercent
+	}
+	if cfg.StepMiB <= 0 {
+		cfg.StepMiB = def.StepMiB
+	}
+	if cfg.MaxPercent <= 0 {
+		cfg.MaxPercent = def.MaxPercent
+	}
+	if cfg.GuestReservePercent <= 0 {
+		cfg.GuestReservePercent = def.GuestReservePercent
+	}
+	return &Reclaimer{cfg: cfg, vms: make(map[string]*trackedVM)}
+}
+
+// Track puts a running VM's balloon under the reclaimer's control.
+func (r *Reclaimer) Track(taskID, socketPath string, memMiB int) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.vms[taskID] = &trackedVM{api: newAPI(socketPath), memMiB: memMiB}
+}
+
+// Untrack releases a VM, e.g. after it stopped.
+func (r *Reclaimer) Untrack(taskID string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.vms, taskID)
+}
+
+// Run steps every interval until ctx is cancelled.
+func (r *Reclaimer) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			r.Step(ctx)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Step reads the host's memory state once and moves each balloon by at
+// most one step.
+func (r *Reclaimer) Step(ctx context.Context) {
+	host, err := readHostMemory()
+	if err != nil {
+		log.Warn().Err(err).Msg("Balloon reclaimer cannot read host memory")
+		return
+	}
+	pressure := host.PSISome10 >= r.cfg.PSIThreshold || host.AvailablePercent() < r.cfg.MinAvailablePercent
+
+	r.mu.Lock()
+	vms := make(map[string]*trackedVM, len(r.vms))
+	for id, vm := range r.vms {
+		vms[id] = vm
+	}
+	r.mu.Unlock()
+
+	for taskID, vm := range vms {
+		stats, err := vm.api.Stats(ctx)
+		if err != nil {
+			log.Debug().Err(err).Str("task_id", taskID).Msg("Failed to read balloon statistics")
+			continue
+		}
+		target := r.nextTarget(vm, stats, pressure)
+		if target == stats.TargetMiB {
+			continue
+		}
+		if err := vm.api.SetTarget(ctx, target); err != nil {
+			log.Warn().Err(err).Str("task_id", taskID).Int("target_mib", target).Msg("Failed to resize balloon")
+			continue
+		}
+		log.Debug().
+			Str("task_id", taskID).
+			Int("from_mib", stats.TargetMiB).
+			Int("to_mib", target).
+			Bool("host_pressure", pressure).
+			Msg("Balloon resized")
+	}
+}
+
+// nextTarget decides a balloon's next target size.
+func (r *Reclaimer) nextTarget(vm *trackedVM, stats *Stats, pressure bool) int {
+	target := stats.TargetMiB
+	if stats.TotalMemory == 0 {
+		return target // the guest has not reported yet
+	}
+
+	step := r.cfg.StepMiB
+	available := int(stats.AvailableMemory / MiB)
+	reserve := vm.memMiB * r.cfg.GuestReservePercent / 100
+	maxMiB := vm.memMiB * r.cfg.MaxPercent / 100
+
+	switch {
+	case available < reserve:
+		// The guest needs its memory back
+		target -= step
+	case pressure && available >= reserve+step:
+		target += step
+	case !pressure:
+		target -= step
+	}
+	return max(0, min(target, maxMiB))
+}
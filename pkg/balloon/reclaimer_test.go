@@ -0,0 +1,149 @@
+package balloon
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadHostMemory(t *testing.T) {
+	dir := t.TempDir()
+	oldProc := procDir
+	procDir = dir
+	defer func() { procDir = oldProc }()
+
+	meminfo := "MemTotal:        8388608 kB\nMemFree:          102400 kB\nMemAvailable:     524288 kB\n"
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "meminfo"), []byte(meminfo), 0644))
+
+	// Without PSI only MemAvailable is read
+	h, err := ReadHostMemory()
+	require.NoError(t, err)
+	assert.Equal(t, 8192, h.TotalMiB)
+	assert.Equal(t, 512, h.AvailableMiB)
+	assert.Equal(t, 6.25, h.AvailablePercent())
+	assert.Zero(t, h.PSISome10)
+
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "pressure"), 0755))
+	psi := "some avg10=12.50 avg60=3.00 avg300=1.00 total=123456\nfull avg10=2.00 avg60=0.50 avg300=0.10 total=2345\n"
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "pressure", "memory"), []byte(psi), 0644))
+
+	h, err = ReadHostMemory()
+	require.NoError(t, err)
+	assert.Equal(t, 12.5, h.PSISome10)
+}
+
+func TestReadHostMemory_Missing(t *testing.T) {
+	oldProc := procDir
+	procDir = t.TempDir()
+	defer func() { procDir = oldProc }()
+
+	_, err := ReadHostMemory()
+	assert.Error(t, err)
+}
+
+// fakeAPI is a VM balloon whose guest has a fixed amount of memory available
+type fakeAPI struct {
+	mu        sync.Mutex
+	stats     Stats
+	statsErr  error
+	setCalls  []int
+	setTarget error
+}
+
+func (f *fakeAPI) Stats(ctx context.Context) (*Stats, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.statsErr != nil {
+		return nil, f.statsErr
+	}
+	stats := f.stats
+	return &stats, nil
+}
+
+func (f *fakeAPI) SetTarget(ctx context.Context, amountMiB int) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.setCalls = append(f.setCalls, amountMiB)
+	if f.setTarget != nil {
+		return f.setTarget
+	}
+	f.stats.TargetMiB = amountMiB
+	return nil
+}
+
+func TestReclaimer_Step(t *testing.T) {
+	underPressure := HostMemory{TotalMiB: 8192, AvailableMiB: 4096, PSISome10: 25}
+	lowAvailable := HostMemory{TotalMiB: 8192, AvailableMiB: 512}
+	relaxed := HostMemory{TotalMiB: 8192, AvailableMiB: 4096, PSISome10: 1}
+
+	// VMs have 1024 MiB: the guest reserve is 204 MiB and the balloon is
+	// capped at 512 MiB
+	guest := func(targetMiB, availableMiB int) Stats {
+		return Stats{TargetMiB: targetMiB, TotalMemory: 1024 * MiB, AvailableMemory: uint64(availableMiB) * MiB}
+	}
+
+	tests := []struct {
+		name     string
+		host     HostMemory
+		stats    Stats
+		statsErr error
+		want     []int
+	}{
+		{"pressure inflates idle VM", underPressure, guest(0, 800), nil, []int{64}},
+		{"low MemAvailable inflates idle VM", lowAvailable, guest(128, 800), nil, []int{192}},
+		{"pressure leaves busy VM alone", underPressure, guest(64, 250), nil, nil},
+		{"balloon stops at cap", underPressure, guest(512, 800), nil, nil},
+		{"guest short of memory deflates", underPressure, guest(256, 100), nil, []int{192}},
+		{"no pressure deflates", relaxed, guest(96, 800), nil, []int{32}},
+		{"deflates to zero", relaxed, guest(32, 800), nil, []int{0}},
+		{"deflated balloon stays", relaxed, guest(0, 800), nil, nil},
+		{"guest not reporting yet", underPressure, Stats{}, nil, nil},
+		{"stats unavailable", underPressure, Stats{}, fmt.Errorf("connection refused"), nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := &fakeAPI{stats: tt.stats, statsErr: tt.statsErr}
+
+			oldAPI, oldRead := newAPI, readHostMemory
+			newAPI = func(string) API { return api }
+			readHostMemory = func() (HostMemory, error) { return tt.host, nil }
+			defer func() { newAPI, readHostMemory = oldAPI, oldRead }()
+
+			r := NewReclaimer(ReclaimerConfig{})
+			r.Track("task-1", "/run/task-1.sock", 1024)
+			r.Step(context.Background())
+
+			assert.Equal(t, tt.want, api.setCalls)
+		})
+	}
+}
+
+func TestReclaimer_Untrack(t *testing.T) {
+	api := &fakeAPI{stats: Stats{TotalMemory: 1024 * MiB, AvailableMemory: 800 * MiB}}
+
+	oldAPI, oldRead := newAPI, readHostMemory
+	newAPI = func(string) API { return api }
+	readHostMemory = func() (HostMemory, error) { return HostMemory{TotalMiB: 8192, PSISome10: 50}, nil }
+	defer func() { newAPI, readHostMemory = oldAPI, oldRead }()
+
+	r := NewReclaimer(ReclaimerConfig{StepMiB: 100})
+	r.Track("task-1", "/run/task-1.sock", 1024)
+	r.Step(context.Background())
+	r.Untrack("task-1")
+	r.Step(context.Background())
+
+	assert.Equal(t, []int{100}, api.setCalls)
+}
+
+func TestReclaimer_Nil(t *testing.T) {
+	var r *Reclaimer
+	r.Track("task-1", "/run/task-1.sock", 1024)
+	r.Untrack("task-1")
+}
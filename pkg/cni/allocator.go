@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/moby/swarmkit/v2/api"
+	"github.com/moby/swarmkit/v2/log"
 	"github.com/moby/swarmkit/v2/manager/allocator/networkallocator"
 )
 
@@ -16,7 +17,9 @@ type CNINetworkAllocator struct {
 	provider      *CNIProvider
 	config        *networkallocator.Config
 	allocatedNets map[string]*AllocatedNetwork
-	mu            sync.RWMutex
+	// live tracks the IPAM owners SwarmKit still knows about, per subnet
+	live map[string]map[string]struct{}
+	mu   sync.RWMutex
 }
 
 // NewCNINetworkAllocator creates a new CNI network allocator
@@ -29,6 +32,7 @@ func NewCNINetworkAllocator(provider *CNIProvider, cfg *networkallocator.Config)
 		provider:      provider,
 		config:        cfg,
 		allocatedNets: make(map[string]*AllocatedNetwork),
+		live:          make(map[string]map[string]struct{}),
 	}
 
 	// Initialize with config defaults if provided
@@ -87,8 +91,15 @@ func (a *CNINetworkAllocator) Allocate(n *api.Network) error {
 		name = n.ID
 	}
 
-	// Allocate network from provider
-	allocatedNet, err := a.provider.AllocateNetwork(name, driver)
+	// Allocate network from provider, keeping the subnet SwarmKit already
+	// recorded for it when the manager restarts
+	var allocatedNet *AllocatedNetwork
+	var err error
+	if n.IPAM != nil && len(n.IPAM.Configs) > 0 && n.IPAM.Configs[0].Subnet != "" {
+		allocatedNet, err = a.provider.AllocateNetworkWithSubnet(name, driver, n.IPAM.Configs[0].Subnet)
+	} else {
+		allocatedNet, err = a.provider.AllocateNetwork(name, driver)
+	}
 	if err != nil {
 		return fmt.Errorf("failed to allocate network: %w", err)
 	}
@@ -135,9 +146,11 @@ func (a *CNINetworkAllocator) Deallocate(n *api.Network) error {
 	}
 
 	// Remove IP pool
-	a.provider.ipamMgr.mu.Lock()
-	delete(a.provider.ipamMgr.pools, allocatedNet.Subnet.String())
-	a.provider.ipamMgr.mu.Unlock()
+	subnet := allocatedNet.Subnet.String()
+	if err := a.provider.ipamMgr.DeletePool(subnet); err != nil {
+		return fmt.Errorf("failed to delete IP pool: %w", err)
+	}
+	delete(a.live, subnet)
 
 	// Remove from allocated networks
 	delete(a.allocatedNets, n.ID)
@@ -202,6 +215,7 @@ func (a *CNINetworkAllocator) AllocateService(s *api.Service) error {
 		if err != nil {
 			return fmt.Errorf("failed to allocate VIP: %w", err)
 		}
+		a.markLive(allocatedNet.Subnet.String(), "vip:"+s.ID)
 
 		// Store VIP allocation
 		allocatedNet.mu.Lock()
@@ -258,6 +272,7 @@ func (a *CNINetworkAllocator) DeallocateService(s *api.Service) error {
 			// Release VIP
 			a.provider.ipamMgr.ReleaseVIP(vipAlloc.VIP, allocatedNet.Subnet.String(), s.ID)
 			delete(allocatedNet.Services, s.ID)
+			a.markDead(allocatedNet.Subnet.String(), "vip:"+s.ID)
 		}
 		allocatedNet.mu.Unlock()
 	}
@@ -277,17 +292,40 @@ func (a *CNINetworkAllocator) DeallocateService(s *api.Service) error {
 
 // ===== Task Allocation =====
 
-// IsTaskAllocated returns if the task has network resources allocated
+// IsTaskAllocated returns if the task has network resources allocated: an
+// address on every attachment that this allocator has recorded for the
+// task. It changes nothing; after a manager restart no task is recorded
+// yet, so SwarmKit hands each one to AllocateTask, which reconciles the
+// addresses the task already carries.
 func (a *CNINetworkAllocator) IsTaskAllocated(t *api.Task) bool {
 	if t == nil {
 		return false
 	}
 
-	// Task is allocated if all its network attachments have IPs
+	a.mu.RLock()
+	defer a.mu.RUnlock()
 	for _, attachment := range t.Networks {
 		if len(attachment.Addresses) == 0 {
 			return false
 		}
+		if attachment.Network == nil {
+			continue
+		}
+		allocatedNet, exists := a.allocatedNets[attachment.Network.ID]
+		if !exists {
+			continue
+		}
+		subnet := allocatedNet.Subnet.String()
+		if _, live := a.live[subnet][t.ID]; !live {
+			return false
+		}
+		ip := parseAddress(attachment.Addresses[0])
+		if ip == nil {
+			return false
+		}
+		if owner, err := a.provider.ipamMgr.GetAllocationOwner(ip, subnet); err != nil || owner != t.ID {
+			return false
+		}
 	}
 
 	return true
@@ -309,18 +347,37 @@ func (a *CNINetworkAllocator) AllocateTask(t *api.Task) error {
 		}
 
 		// Allocate IP for task
-		ip, err := a.provider.ipamMgr.AllocateIP(allocatedNet.Subnet.String(), t.ID)
+		subnet := allocatedNet.Subnet.String()
+		ip, err := a.reconcileTaskAddress(attachment, subnet, t.ID)
 		if err != nil {
 			return fmt.Errorf("failed to allocate IP for task: %w", err)
 		}
 
 		// Update task attachment
 		attachment.Addresses = []string{ip.String()}
+		a.markLive(subnet, t.ID)
 	}
 
 	return nil
 }
 
+// reconcileTaskAddress returns the task's address on a network. An address
+// the attachment already carries, as tasks SwarmKit restores do, is kept
+// and recorded unless another owner holds it; otherwise the task gets a
+// new one. The caller holds a.mu.
+func (a *CNINetworkAllocator) reconcileTaskAddress(attachment *api.NetworkAttachment, subnet, taskID string) (net.IP, error) {
+	if len(attachment.Addresses) > 0 {
+		if ip := parseAddress(attachment.Addresses[0]); ip != nil {
+			err := a.provider.ipamMgr.ReserveIP(ip, subnet, taskID)
+			if err == nil {
+				return ip, nil
+			}
+			log.L.WithError(err).WithField("task.id", taskID).Warn("Cannot keep task address, allocating a new one")
+		}
+	}
+	return a.provider.ipamMgr.AllocateIP(subnet, taskID)
+}
+
 // DeallocateTask releases IPs for all networks a task is attached to
 func (a *CNINetworkAllocator) DeallocateTask(t *api.Task) error {
 	if t == nil {
@@ -340,13 +397,14 @@ func (a *CNINetworkAllocator) DeallocateTask(t *api.Task) error {
 		if len(attachment.Addresses) == 0 {
 			continue
 		}
-		ip := net.ParseIP(attachment.Addresses[0])
+		ip := parseAddress(attachment.Addresses[0])
 		if ip == nil {
 			continue
 		}
 
 		// Release IP
 		a.provider.ipamMgr.ReleaseIP(ip, allocatedNet.Subnet.String())
+		a.markDead(allocatedNet.Subnet.String(), t.ID)
 		attachment.Addresses = nil
 	}
 
@@ -390,6 +448,7 @@ func (a *CNINetworkAllocator) AllocateAttachment(node *api.Node, na *api.Network
 	allocatedNet.mu.Lock()
 	allocatedNet.Attachments[node.ID] = attachment
 	allocatedNet.mu.Unlock()
+	a.markLive(allocatedNet.Subnet.String(), node.ID)
 
 	// Update SwarmKit network attachment
 	na.Addresses = []string{ip.String()}
@@ -427,6 +486,7 @@ func (a *CNINetworkAllocator) DeallocateAttachment(node *api.Node, na *api.Netwo
 
 	// Release IP
 	a.provider.ipamMgr.ReleaseIP(attachment.IPAddress, allocatedNet.Subnet.String())
+	a.markDead(allocatedNet.Subnet.String(), node.ID)
 
 	// Remove attachment
 	delete(allocatedNet.Attachments, node.ID)
@@ -487,11 +547,55 @@ func (a *CNINetworkAllocator) ListAllocatedNetworks() []*AllocatedNetwork {
 	return networks
 }
 
-// RunGC runs garbage collection for stale allocations
+// RunGC releases IPAM allocations whose owners (tasks, node attachments and
+// service VIPs) this allocator has not seen since it started. Run it only
+// after SwarmKit has restored its state, or live allocations are released.
 func (a *CNINetworkAllocator) RunGC(ctx context.Context) error {
-	// Implementation for cleaning up stale allocations
-	// This would be called periodically to clean up orphaned IPs
-	return nil
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	managed := make(map[string]bool, len(a.allocatedNets))
+	for _, allocatedNet := range a.allocatedNets {
+		managed[allocatedNet.Subnet.String()] = true
+	}
+
+	_, err := a.provider.ipamMgr.Reconcile(func(subnet, owner string) bool {
+		if !managed[subnet] {
+			// Pools of networks SwarmKit has not restored yet are left alone
+			return true
+		}
+		_, alive := a.live[subnet][owner]
+		return alive
+	})
+	return err
+}
+
+// markLive records an IPAM owner as in use. The caller holds a.mu.
+func (a *CNINetworkAllocator) markLive(subnet, owner string) {
+	owners, exists := a.live[subnet]
+	if !exists {
+		owners = make(map[string]struct{})
+		a.live[subnet] = owners
+	}
+	owners[owner] = struct{}{}
+}
+
+// markDead forgets an IPAM owner. The caller holds a.mu.
+func (a *CNINetworkAllocator) markDead(subnet, owner string) {
+	delete(a.live[subnet], owner)
+}
+
+// parseAddress parses a SwarmKit attachment address, which may carry a
+// prefix length ("10.0.0.5/24").
+func parseAddress(addr string) net.IP {
+	if ip, _, err := net.ParseCIDR(addr); err == nil {
+		return ip
+	}
+	return net.ParseIP(addr)
 }
 
 // ===== DriverState and IPAMState helpers =====
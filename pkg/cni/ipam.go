@@ -1,10 +1,17 @@
 package cni
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"net"
+	"os"
+	"sort"
 	"sync"
 	"time"
+
+	"github.com/restuhaqza/swarmcracker/pkg/statefile"
+	"github.com/restuhaqza/swarmcracker/pkg/types"
 )
 
 // IPAMManager manages IP address allocation across multiple pools
@@ -56,9 +63,40 @@ func (m *IPAMManager) CreatePool(subnetCIDR string, gatewayIP net.IP) (*IPPool,
 	}
 
 	m.pools[subnetCIDR] = pool
+	if err := m.saveLocked(); err != nil {
+		delete(m.pools, subnetCIDR)
+		return nil, err
+	}
 	return pool, nil
 }
 
+// HasPool reports whether a pool exists for a subnet
+func (m *IPAMManager) HasPool(subnetCIDR string) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	_, exists := m.pools[subnetCIDR]
+	return exists
+}
+
+// DeletePool removes a subnet pool and all of its allocations
+func (m *IPAMManager) DeletePool(subnetCIDR string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	pool, exists := m.pools[subnetCIDR]
+	if !exists {
+		return nil
+	}
+
+	delete(m.pools, subnetCIDR)
+	if err := m.saveLocked(); err != nil {
+		m.pools[subnetCIDR] = pool
+		return err
+	}
+	return nil
+}
+
 // AllocateIP allocates an IP address from a subnet pool
 func (m *IPAMManager) AllocateIP(subnetCIDR string, ownerID string) (net.IP, error) {
 	m.mu.Lock()
@@ -69,9 +107,28 @@ func (m *IPAMManager) AllocateIP(subnetCIDR string, ownerID string) (net.IP, err
 		return nil, fmt.Errorf("pool not found for subnet %s", subnetCIDR)
 	}
 
+	ip, err := allocateFromPool(pool, subnetCIDR, ownerID)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.saveLocked(); err != nil {
+		pool.release(ip)
+		return nil, err
+	}
+	return ip, nil
+}
+
+// allocateFromPool picks the next free address of a pool for an owner. An
+// owner that already holds an address in the pool gets the same one back,
+// which keeps re-allocation after a restart stable.
+func allocateFromPool(pool *IPPool, subnetCIDR, ownerID string) (net.IP, error) {
 	pool.mu.Lock()
 	defer pool.mu.Unlock()
 
+	if ip := pool.ownedBy(ownerID); ip != nil {
+		return ip, nil
+	}
+
 	// Find next available IP
 	ip := pool.NextIP
 	attempts := 0
@@ -112,18 +169,74 @@ func (m *IPAMManager) ReleaseIP(ip net.IP, subnetCIDR string) error {
 		return fmt.Errorf("pool not found for subnet %s", subnetCIDR)
 	}
 
-	pool.mu.Lock()
-	defer pool.mu.Unlock()
+	if !pool.release(ip) {
+		return fmt.Errorf("IP %s not allocated", ip.String())
+	}
+	return m.saveLocked()
+}
+
+// ReserveIP records an existing allocation, e.g. an address SwarmKit already
+// assigned before a restart. Reserving an address the owner already holds
+// is a no-op.
+func (m *IPAMManager) ReserveIP(ip net.IP, subnetCIDR string, ownerID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	pool, exists := m.pools[subnetCIDR]
+	if !exists {
+		return fmt.Errorf("pool not found for subnet %s", subnetCIDR)
+	}
 
+	pool.mu.Lock()
 	ipStr := ip.String()
-	if _, used := pool.UsedIPs[ipStr]; !used {
-		return fmt.Errorf("IP %s not allocated", ipStr)
+	if !pool.Subnet.Contains(ip) {
+		pool.mu.Unlock()
+		return fmt.Errorf("IP %s not in subnet %s", ipStr, subnetCIDR)
+	}
+	if owner, used := pool.UsedIPs[ipStr]; used {
+		pool.mu.Unlock()
+		if owner == ownerID {
+			return nil
+		}
+		return fmt.Errorf("IP %s already allocated to %s", ipStr, owner)
 	}
+	pool.UsedIPs[ipStr] = ownerID
+	pool.mu.Unlock()
 
-	delete(pool.UsedIPs, ipStr)
+	if err := m.saveLocked(); err != nil {
+		pool.release(ip)
+		return err
+	}
 	return nil
 }
 
+// Reconcile releases every allocation whose owner is no longer alive in
+// its subnet and returns how many were released. Owners are task IDs, node
+// IDs and "vip:<service ID>" for service VIPs.
+func (m *IPAMManager) Reconcile(isAlive func(subnetCIDR, ownerID string) bool) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	released := 0
+	for subnet, pool := range m.pools {
+		pool.mu.Lock()
+		for ip, owner := range pool.UsedIPs {
+			if !isAlive(subnet, owner) {
+				delete(pool.UsedIPs, ip)
+				released++
+			}
+		}
+		pool.mu.Unlock()
+	}
+
+	if released > 0 {
+		if err := m.saveLocked(); err != nil {
+			return released, err
+		}
+	}
+	return released, nil
+}
+
 // GetPoolStats returns statistics for an IP pool
 func (m *IPAMManager) GetPoolStats(subnetCIDR string) (used, total int, err error) {
 	m.mu.RLock()
@@ -169,9 +282,26 @@ func (m *IPAMManager) AllocateVIP(subnetCIDR string, serviceID string) (net.IP,
 		return nil, fmt.Errorf("pool not found for subnet %s", subnetCIDR)
 	}
 
+	vip, err := allocateVIPFromPool(pool, subnetCIDR, "vip:"+serviceID)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.saveLocked(); err != nil {
+		pool.release(vip)
+		return nil, err
+	}
+	return vip, nil
+}
+
+// allocateVIPFromPool picks a free address from the VIP range of a pool.
+func allocateVIPFromPool(pool *IPPool, subnetCIDR, ownerID string) (net.IP, error) {
 	pool.mu.Lock()
 	defer pool.mu.Unlock()
 
+	if ip := pool.ownedBy(ownerID); ip != nil {
+		return ip, nil
+	}
+
 	// VIPs are allocated from the higher end of the subnet
 	// to avoid conflicts with node attachments
 	vipStart := getVIPRangeStart(pool.Subnet)
@@ -185,7 +315,7 @@ func (m *IPAMManager) AllocateVIP(subnetCIDR string, serviceID string) (net.IP,
 
 		// Check if IP is available
 		if _, used := pool.UsedIPs[ipStr]; !used && !isReserved(pool, ip) {
-			pool.UsedIPs[ipStr] = "vip:" + serviceID
+			pool.UsedIPs[ipStr] = ownerID
 			return ip, nil
 		}
 
@@ -241,6 +371,120 @@ func (m *IPAMManager) CleanupStaleAllocations(subnetCIDR string, olderThan time.
 	return 0
 }
 
+// Load restores the pools saved in the state file. A missing file is not an error.
+func (m *IPAMManager) Load() error {
+	if m.config.IPAMStateFile == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(m.config.IPAMStateFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read IPAM state: %w", err)
+	}
+
+	var state types.IPAMState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return fmt.Errorf("failed to parse IPAM state: %w", err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, saved := range state.Pools {
+		subnet, _, err := ParseCIDR(saved.Subnet)
+		if err != nil {
+			return fmt.Errorf("invalid subnet %q in IPAM state: %w", saved.Subnet, err)
+		}
+		gateway := net.ParseIP(saved.Gateway)
+		pool := &IPPool{
+			Subnet:  subnet,
+			Gateway: gateway,
+			UsedIPs: make(map[string]string, len(saved.Allocations)),
+			NextIP:  incrementIP(gateway),
+		}
+		for _, reserved := range saved.Reserved {
+			if ip := net.ParseIP(reserved); ip != nil {
+				pool.ReservedIPs = append(pool.ReservedIPs, ip)
+			}
+		}
+		for ip, owner := range saved.Allocations {
+			pool.UsedIPs[ip] = owner
+		}
+		m.pools[saved.Subnet] = pool
+	}
+	return nil
+}
+
+// State returns a snapshot of all pools, sorted by subnet
+func (m *IPAMManager) State() types.IPAMState {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.stateLocked()
+}
+
+func (m *IPAMManager) stateLocked() types.IPAMState {
+	state := types.IPAMState{Pools: make([]types.IPAMPool, 0, len(m.pools))}
+	for subnet, pool := range m.pools {
+		pool.mu.RLock()
+		saved := types.IPAMPool{
+			Subnet:      subnet,
+			Gateway:     pool.Gateway.String(),
+			Allocations: make(map[string]string, len(pool.UsedIPs)),
+		}
+		for _, ip := range pool.ReservedIPs {
+			saved.Reserved = append(saved.Reserved, ip.String())
+		}
+		for ip, owner := range pool.UsedIPs {
+			saved.Allocations[ip] = owner
+		}
+		pool.mu.RUnlock()
+		state.Pools = append(state.Pools, saved)
+	}
+	sort.Slice(state.Pools, func(i, j int) bool { return state.Pools[i].Subnet < state.Pools[j].Subnet })
+	return state
+}
+
+// saveLocked writes the pools to the state file atomically. The caller
+// holds m.mu and no pool lock.
+func (m *IPAMManager) saveLocked() error {
+	path := m.config.IPAMStateFile
+	if path == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(m.stateLocked(), "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal IPAM state: %w", err)
+	}
+	return statefile.Write(path, data, 0640)
+}
+
+// ownedBy returns the address held by an owner, if any. The caller holds pool.mu.
+func (p *IPPool) ownedBy(ownerID string) net.IP {
+	for ip, owner := range p.UsedIPs {
+		if owner == ownerID {
+			return net.ParseIP(ip)
+		}
+	}
+	return nil
+}
+
+// release frees an address and reports whether it was allocated.
+func (p *IPPool) release(ip net.IP) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	ipStr := ip.String()
+	if _, used := p.UsedIPs[ipStr]; !used {
+		return false
+	}
+	delete(p.UsedIPs, ipStr)
+	return true
+}
+
 // Helper functions
 
 // incrementIP returns the next IP address
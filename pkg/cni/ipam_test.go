@@ -0,0 +1,224 @@
+package cni
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/moby/swarmkit/v2/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func persistentIPAMConfig(t *testing.T) *CNIConfig {
+	cfg := DefaultCNIConfig()
+	cfg.IPAMStateFile = filepath.Join(t.TempDir(), "network", "cni-ipam.json")
+	return cfg
+}
+
+func TestIPAMManager_Persistence(t *testing.T) {
+	cfg := persistentIPAMConfig(t)
+	mgr := NewIPAMManager(cfg)
+
+	_, err := mgr.CreatePool("10.0.1.0/24", net.ParseIP("10.0.1.1"))
+	require.NoError(t, err)
+	ip, err := mgr.AllocateIP("10.0.1.0/24", "task-1")
+	require.NoError(t, err)
+	vip, err := mgr.AllocateVIP("10.0.1.0/24", "svc-1")
+	require.NoError(t, err)
+
+	restored := NewIPAMManager(cfg)
+	require.NoError(t, restored.Load())
+	assert.Equal(t, mgr.State(), restored.State())
+
+	owner, err := restored.GetAllocationOwner(vip, "10.0.1.0/24")
+	require.NoError(t, err)
+	assert.Equal(t, "vip:svc-1", owner)
+
+	// Allocating again for a known owner returns its address
+	again, err := restored.AllocateIP("10.0.1.0/24", "task-1")
+	require.NoError(t, err)
+	assert.Equal(t, ip.String(), again.String())
+	againVIP, err := restored.AllocateVIP("10.0.1.0/24", "svc-1")
+	require.NoError(t, err)
+	assert.Equal(t, vip.String(), againVIP.String())
+
+	// New allocations skip the restored ones
+	next, err := restored.AllocateIP("10.0.1.0/24", "task-2")
+	require.NoError(t, err)
+	assert.NotEqual(t, ip.String(), next.String())
+
+	require.NoError(t, restored.ReleaseIP(ip, "10.0.1.0/24"))
+	require.NoError(t, restored.DeletePool("10.0.1.0/24"))
+	assert.False(t, restored.HasPool("10.0.1.0/24"))
+
+	empty := NewIPAMManager(cfg)
+	require.NoError(t, empty.Load())
+	assert.Empty(t, empty.ListPools())
+}
+
+func TestIPAMManager_LoadErrors(t *testing.T) {
+	cfg := persistentIPAMConfig(t)
+
+	// Missing file is not an error
+	require.NoError(t, NewIPAMManager(cfg).Load())
+
+	require.NoError(t, os.MkdirAll(filepath.Dir(cfg.IPAMStateFile), 0750))
+	require.NoError(t, os.WriteFile(cfg.IPAMStateFile, []byte("{"), 0640))
+	assert.Error(t, NewIPAMManager(cfg).Load())
+
+	require.NoError(t, os.WriteFile(cfg.IPAMStateFile, []byte(`{"pools":[{"subnet":"bogus"}]}`), 0640))
+	assert.Error(t, NewIPAMManager(cfg).Load())
+}
+
+func TestIPAMManager_SaveFailureRollsBack(t *testing.T) {
+	blocker := filepath.Join(t.TempDir(), "blocker")
+	require.NoError(t, os.WriteFile(blocker, nil, 0640))
+
+	cfg := DefaultCNIConfig()
+	mgr := NewIPAMManager(cfg)
+	_, err := mgr.CreatePool("10.0.1.0/24", nil)
+	require.NoError(t, err)
+
+	cfg.IPAMStateFile = filepath.Join(blocker, "cni-ipam.json")
+	_, err = mgr.AllocateIP("10.0.1.0/24", "task-1")
+	assert.Error(t, err)
+
+	used, _, err := mgr.GetPoolStats("10.0.1.0/24")
+	require.NoError(t, err)
+	assert.Zero(t, used)
+}
+
+func TestIPAMManager_ReserveIP(t *testing.T) {
+	mgr := NewIPAMManager(nil)
+	_, err := mgr.CreatePool("10.0.1.0/24", net.ParseIP("10.0.1.1"))
+	require.NoError(t, err)
+
+	ip := net.ParseIP("10.0.1.50")
+	require.NoError(t, mgr.ReserveIP(ip, "10.0.1.0/24", "task-1"))
+	require.NoError(t, mgr.ReserveIP(ip, "10.0.1.0/24", "task-1"))
+	assert.Error(t, mgr.ReserveIP(ip, "10.0.1.0/24", "task-2"))
+	assert.Error(t, mgr.ReserveIP(net.ParseIP("10.0.2.5"), "10.0.1.0/24", "task-1"))
+	assert.Error(t, mgr.ReserveIP(ip, "10.0.9.0/24", "task-1"))
+
+	got, err := mgr.AllocateIP("10.0.1.0/24", "task-1")
+	require.NoError(t, err)
+	assert.Equal(t, "10.0.1.50", got.String())
+}
+
+func TestIPAMManager_Reconcile(t *testing.T) {
+	mgr := NewIPAMManager(nil)
+	_, err := mgr.CreatePool("10.0.1.0/24", nil)
+	require.NoError(t, err)
+
+	_, err = mgr.AllocateIP("10.0.1.0/24", "task-live")
+	require.NoError(t, err)
+	gone, err := mgr.AllocateIP("10.0.1.0/24", "task-gone")
+	require.NoError(t, err)
+
+	released, err := mgr.Reconcile(func(subnet, owner string) bool { return owner == "task-live" })
+	require.NoError(t, err)
+	assert.Equal(t, 1, released)
+
+	_, err = mgr.GetAllocationOwner(gone, "10.0.1.0/24")
+	assert.Error(t, err)
+}
+
+func TestCNINetworkAllocator_RunGCReleasesStaleOwners(t *testing.T) {
+	provider := setupCNIProvider(t)
+	allocator, err := NewCNINetworkAllocator(provider, nil)
+	require.NoError(t, err)
+
+	n := &api.Network{ID: "net-1", Spec: api.NetworkSpec{Annotations: api.Annotations{Name: "app"}}}
+	require.NoError(t, allocator.Allocate(n))
+	subnet := n.IPAM.Configs[0].Subnet
+
+	task := &api.Task{ID: "task-1", Networks: []*api.NetworkAttachment{{Network: n}}}
+	require.NoError(t, allocator.AllocateTask(task))
+
+	// An allocation left behind by a task the allocator never saw
+	orphan, err := provider.GetIPAMManager().AllocateIP(subnet, "task-orphan")
+	require.NoError(t, err)
+
+	require.NoError(t, allocator.RunGC(context.Background()))
+
+	_, err = provider.GetIPAMManager().GetAllocationOwner(orphan, subnet)
+	assert.Error(t, err, "orphaned allocation should be released")
+	owner, err := provider.GetIPAMManager().GetAllocationOwner(net.ParseIP(task.Networks[0].Addresses[0]), subnet)
+	require.NoError(t, err)
+	assert.Equal(t, "task-1", owner)
+
+	// Deallocated tasks are collected too
+	ip := net.ParseIP(task.Networks[0].Addresses[0])
+	require.NoError(t, allocator.DeallocateTask(task))
+	require.NoError(t, allocator.RunGC(context.Background()))
+	_, err = provider.GetIPAMManager().GetAllocationOwner(ip, subnet)
+	assert.Error(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.Error(t, allocator.RunGC(ctx))
+}
+
+func TestCNINetworkAllocator_RestoreAfterRestart(t *testing.T) {
+	cfg := DefaultCNIConfig()
+	cfg.PluginDir = t.TempDir()
+	cfg.ConfigDir = t.TempDir()
+	cfg.IPAMStateFile = filepath.Join(t.TempDir(), "cni-ipam.json")
+	for _, plugin := range []string{"bridge", "loopback", "host-local"} {
+		require.NoError(t, os.WriteFile(filepath.Join(cfg.PluginDir, plugin), nil, 0755))
+	}
+
+	provider, err := NewCNIProvider(cfg)
+	require.NoError(t, err)
+	allocator, err := provider.NewAllocator(nil)
+	require.NoError(t, err)
+
+	n := &api.Network{ID: "net-1", Spec: api.NetworkSpec{Annotations: api.Annotations{Name: "app"}}}
+	require.NoError(t, allocator.Allocate(n))
+	task := &api.Task{ID: "task-1", Networks: []*api.NetworkAttachment{{Network: n}}}
+	require.NoError(t, allocator.AllocateTask(task))
+
+	// A new manager process restores the network on the same subnet. The
+	// task is reported unallocated until SwarmKit hands it to AllocateTask,
+	// which keeps its address through GC
+	restarted, err := NewCNIProvider(cfg)
+	require.NoError(t, err)
+	restartedAlloc, err := restarted.NewAllocator(nil)
+	require.NoError(t, err)
+
+	restoredNet := n.Copy()
+	require.NoError(t, restartedAlloc.Allocate(restoredNet))
+	assert.Equal(t, n.IPAM.Configs[0].Subnet, restoredNet.IPAM.Configs[0].Subnet)
+	addresses := append([]string(nil), task.Networks[0].Addresses...)
+	assert.False(t, restartedAlloc.IsTaskAllocated(task))
+	require.NoError(t, restartedAlloc.AllocateTask(task))
+	assert.Equal(t, addresses, task.Networks[0].Addresses)
+	assert.True(t, restartedAlloc.IsTaskAllocated(task))
+	require.NoError(t, restarted.RunGC(context.Background()))
+
+	owner, err := restarted.GetIPAMManager().GetAllocationOwner(
+		net.ParseIP(task.Networks[0].Addresses[0]), n.IPAM.Configs[0].Subnet)
+	require.NoError(t, err)
+	assert.Equal(t, "task-1", owner)
+
+	// A task claiming an address another task holds gets a new one
+	clash := &api.Task{ID: "task-2", Networks: []*api.NetworkAttachment{{
+		Network:   restoredNet,
+		Addresses: append([]string(nil), task.Networks[0].Addresses...),
+	}}}
+	assert.False(t, restartedAlloc.IsTaskAllocated(clash))
+	used, _, err := restarted.GetIPAMManager().GetPoolStats(restoredNet.IPAM.Configs[0].Subnet)
+	require.NoError(t, err)
+	assert.Equal(t, 1, used, "checking a task records nothing")
+	require.NoError(t, restartedAlloc.AllocateTask(clash))
+	assert.NotEqual(t, task.Networks[0].Addresses, clash.Networks[0].Addresses)
+	assert.True(t, restartedAlloc.IsTaskAllocated(clash))
+
+	// A brand new network does not reuse the restored subnet
+	other := &api.Network{ID: "net-2", Spec: api.NetworkSpec{Annotations: api.Annotations{Name: "other"}}}
+	require.NoError(t, restartedAlloc.Allocate(other))
+	assert.NotEqual(t, n.IPAM.Configs[0].Subnet, other.IPAM.Configs[0].Subnet)
+}
@@ -1,6 +1,7 @@
 package cni
 
 import (
+	"context"
 	"fmt"
 	"sync"
 
@@ -15,6 +16,7 @@ type CNIProvider struct {
 	config       *CNIConfig
 	pluginMgr    *PluginManager
 	ipamMgr      *IPAMManager
+	allocator    *CNINetworkAllocator
 	configGen    *NetworkConfigGenerator
 	vxlanPort    uint32
 	networks     map[string]*AllocatedNetwork
@@ -36,8 +38,11 @@ func NewCNIProvider(cfg *CNIConfig) (*CNIProvider, error) {
 		return nil, fmt.Errorf("CNI plugin validation failed: %w", err)
 	}
 
-	// Create IPAM manager
+	// Create IPAM manager and restore persisted allocations
 	ipamMgr := NewIPAMManager(cfg)
+	if err := ipamMgr.Load(); err != nil {
+		return nil, err
+	}
 
 	// Create config generator
 	configGen := NewConfigGenerator()
@@ -61,7 +66,29 @@ func NewCNIProvider(cfg *CNIConfig) (*CNIProvider, error) {
 
 // NewAllocator returns a new NetworkAllocator instance
 func (p *CNIProvider) NewAllocator(cfg *networkallocator.Config) (networkallocator.NetworkAllocator, error) {
-	return NewCNINetworkAllocator(p, cfg)
+	allocator, err := NewCNINetworkAllocator(p, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	p.allocator = allocator
+	p.mu.Unlock()
+
+	return allocator, nil
+}
+
+// RunGC garbage collects stale IPAM allocations through the allocator the
+// SwarmKit manager is using. It is a no-op until the manager has created one.
+func (p *CNIProvider) RunGC(ctx context.Context) error {
+	p.mu.RLock()
+	allocator := p.allocator
+	p.mu.RUnlock()
+
+	if allocator == nil {
+		return nil
+	}
+	return allocator.RunGC(ctx)
 }
 
 // PredefinedNetworks returns predefined network data for SwarmKit
@@ -178,13 +205,35 @@ func (p *CNIProvider) AllocateNetwork(name, driver string) (*AllocatedNetwork, e
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
-	// Generate subnet
-	p.networkIndex++
-	subnet, err := GenerateSubnet(p.config.SubnetPool, p.config.SubnetSize, p.networkIndex)
-	if err != nil {
-		return nil, fmt.Errorf("failed to generate subnet: %w", err)
+	// Generate a subnet, skipping those restored from the IPAM state
+	var subnet string
+	for {
+		p.networkIndex++
+		var err error
+		subnet, err = GenerateSubnet(p.config.SubnetPool, p.config.SubnetSize, p.networkIndex)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate subnet: %w", err)
+		}
+		if !p.ipamMgr.HasPool(subnet) {
+			break
+		}
 	}
 
+	return p.allocateNetworkLocked(name, driver, subnet)
+}
+
+// AllocateNetworkWithSubnet allocates a network on a known subnet, e.g. one
+// SwarmKit recorded before a restart. An existing pool for the subnet is
+// reused with its allocations.
+func (p *CNIProvider) AllocateNetworkWithSubnet(name, driver, subnet string) (*AllocatedNetwork, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.networkIndex++
+	return p.allocateNetworkLocked(name, driver, subnet)
+}
+
+func (p *CNIProvider) allocateNetworkLocked(name, driver, subnet string) (*AllocatedNetwork, error) {
 	// Parse subnet and get gateway
 	subnetNet, gateway, err := ParseCIDR(subnet)
 	if err != nil {
@@ -195,9 +244,10 @@ func (p *CNIProvider) AllocateNetwork(name, driver string) (*AllocatedNetwork, e
 	bridgeName := fmt.Sprintf("br-%s", NetworkNameFromSwarmKit(name))
 
 	// Create IP pool
-	_, err = p.ipamMgr.CreatePool(subnet, gateway)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create IP pool: %w", err)
+	if !p.ipamMgr.HasPool(subnet) {
+		if _, err := p.ipamMgr.CreatePool(subnet, gateway); err != nil {
+			return nil, fmt.Errorf("failed to create IP pool: %w", err)
+		}
 	}
 
 	// Generate VXLAN ID for overlay networks
@@ -66,6 +66,10 @@ type CNIConfig struct {
 
 	// EnableIPMasq enables IP masquerading for external traffic
 	EnableIPMasq bool
+
+	// IPAMStateFile persists IPAM allocations across restarts (empty keeps
+	// them in memory only)
+	IPAMStateFile string
 }
 
 // DefaultCNIConfig returns a default CNI configuration
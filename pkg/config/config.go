@@ -74,7 +74,10 @@ type Config struct {
 	Logging  LoggingConfig  `yaml:"logging"`
 	Images   ImagesConfig   `yaml:"images"`
 	Metrics  MetricsConfig  `yaml:"metrics"`
+	Tracing  TracingConfig  `yaml:"tracing"`
 	Snapshot SnapshotConfig `yaml:"snapshot"`
+	Agent    AgentConfig    `yaml:"agent"`
+	Cleanup  CleanupConfig  `yaml:"cleanup"`
 
 	// Legacy fields for backward compatibility
 	KernelPath      string       `yaml:"kernel_path"`
@@ -89,17 +92,71 @@ type Config struct {
 
 // ExecutorConfig holds executor-specific configuration.
 type ExecutorConfig struct {
-	Name            string       `yaml:"name"`
-	KernelPath      string       `yaml:"kernel_path"`
-	InitrdPath      string       `yaml:"initrd_path"`
-	RootfsDir       string       `yaml:"rootfs_dir"`
-	SocketDir       string       `yaml:"socket_dir"`
-	DefaultVCPUs    int          `yaml:"default_vcpus"`
-	DefaultMemoryMB int          `yaml:"default_memory_mb"`
-	EnableJailer    bool         `yaml:"enable_jailer"`
-	Jailer          JailerConfig `yaml:"jailer"`
-	InitSystem      string       `yaml:"init_system"`       // "none", "tini", "dumb-init"
-	InitGracePeriod int          `yaml:"init_grace_period"` // Grace period in seconds
+	Name            string         `yaml:"name"`
+	FirecrackerPath string         `yaml:"firecracker_path"`
+	KernelPath      string         `yaml:"kernel_path"`
+	InitrdPath      string         `yaml:"initrd_path"`
+	RootfsDir       string         `yaml:"rootfs_dir"`
+	SocketDir       string         `yaml:"socket_dir"`
+	DefaultVCPUs    int            `yaml:"default_vcpus"`
+	DefaultMemoryMB int            `yaml:"default_memory_mb"`
+	EnableJailer    bool           `yaml:"enable_jailer"`
+	Jailer          JailerConfig   `yaml:"jailer"`
+	InitSystem      string         `yaml:"init_system"`       // "none", "tini", "dumb-init"
+	InitGracePeriod int            `yaml:"init_grace_period"` // Grace period in seconds
+	Balloon         BalloonConfig  `yaml:"balloon"`
+	MMDS            MMDSConfig     `yaml:"mmds"`
+	CPU             CPUConfig      `yaml:"cpu"`
+	HugePages       string         `yaml:"huge_pages"`     // "None" or "2M", for services without the swarmcracker.hugepages label
+	KernelCatalog   string         `yaml:"kernel_catalog"` // kernels services can pick with the swarmcracker.kernel label
+	VMOverheadMB    int            `yaml:"vm_overhead_mb"` // host memory per VM beyond guest memory, sizes the microvm slots
+	MaxVMs          int            `yaml:"max_vms"`        // cap on the microvm slots (0 = no cap)
+	WarmPool        WarmPoolConfig `yaml:"warm_pool"`
+	SeccompFilter   string         `yaml:"seccomp_filter"` // "" for Firecracker's built-in filters, "default", a seccompiler JSON profile or a compiled BPF file
+}
+
+// WarmPoolConfig holds the settings of the pools of paused VMs restored
+// from golden snapshots of hot images.
+type WarmPoolConfig struct {
+	Enabled       bool           `yaml:"enabled"`
+	Dir           string         `yaml:"dir"`            // golden snapshots
+	Sizes         map[string]int `yaml:"sizes"`          // image -> pool size, for services without the swarmcracker.warmpool label
+	GoldenTimeout Duration       `yaml:"golden_timeout"` // how long a golden VM may take to reach the workload
+}
+
+// CPUConfig holds the CPU template and pinning settings of the node.
+type CPUConfig struct {
+	Template        string            `yaml:"template"`         // default for services without the swarmcracker.cpu.template label
+	CustomTemplates map[string]string `yaml:"custom_templates"` // custom template name -> JSON file
+	Pinning         bool              `yaml:"pinning"`          // allow services to take exclusive cores
+	Reserved        string            `yaml:"reserved"`         // cores never given out exclusively, e.g. "0-1"
+}
+
+// MMDSConfig holds the settings of the metadata service served to guests.
+type MMDSConfig struct {
+	Enabled        bool `yaml:"enabled"`         // default for services without the swarmcracker.mmds label
+	IncludeSecrets bool `yaml:"include_secrets"` // put secret payloads in the document
+	IncludeConfigs bool `yaml:"include_configs"` // put config payloads in the document
+}
+
+// BalloonConfig holds the memory balloon settings of the node.
+type BalloonConfig struct {
+	Enabled       bool                 `yaml:"enabled"`        // default for services without the swarmcracker.balloon label
+	DeflateOnOOM  *bool                `yaml:"deflate_on_oom"` // nil means true
+	StatsInterval Duration             `yaml:"stats_interval"` // how often guests report balloon statistics
+	Reclaim       BalloonReclaimConfig `yaml:"reclaim"`
+}
+
+// BalloonReclaimConfig holds the settings of the agent's balloon reclaimer,
+// which inflates balloons on idle VMs under host memory pressure.
+type BalloonReclaimConfig struct {
+	Enabled             bool     `yaml:"enabled"`
+	Interval            Duration `yaml:"interval"`
+	PSIThreshold        float64  `yaml:"psi_threshold"`         // host memory PSI "some" avg10, in percent
+	MinAvailablePercent float64  `yaml:"min_available_percent"` // host MemAvailable floor, in percent
+	StepMiB             int      `yaml:"step_mib"`
+	MaxPercent          int      `yaml:"max_percent"`           // largest balloon, as a share of the VM's memory
+	GuestReservePercent int      `yaml:"guest_reserve_percent"` // memory kept available in the guest
 }
 
 // NetworkConfig holds network configuration.
@@ -140,12 +197,64 @@ type MetricsConfig struct {
 	Format  string `yaml:"format"`
 }
 
+// TracingConfig holds OpenTelemetry tracing configuration.
+type TracingConfig struct {
+	Enabled     bool    `yaml:"enabled"`
+	Endpoint    string  `yaml:"endpoint"`     // OTLP/HTTP collector URL
+	SampleRatio float64 `yaml:"sample_ratio"` // fraction of task launches traced
+}
+
 // JailerConfig holds jailer-specific configuration.
 type JailerConfig struct {
 	UID           int    `yaml:"uid"`
 	GID           int    `yaml:"gid"`
 	ChrootBaseDir string `yaml:"chroot_base_dir"`
 	NetNS         string `yaml:"netns"`
+	Path          string `yaml:"path"`
+	ParentCgroup  string `yaml:"parent_cgroup"`
+	CgroupVersion string `yaml:"cgroup_version"` // "v1", "v2" or empty to auto-detect
+	EnableCgroups *bool  `yaml:"enable_cgroups"` // nil means unset
+}
+
+// AgentConfig holds the swarmd-firecracker node settings.
+type AgentConfig struct {
+	StateDir           string       `yaml:"state_dir"`
+	Hostname           string       `yaml:"hostname"`
+	JoinAddr           string       `yaml:"join_addr"`
+	JoinToken          string       `yaml:"join_token"`
+	ListenRemoteAPI    string       `yaml:"listen_remote_api"`
+	ListenControlAPI   string       `yaml:"listen_control_api"`
+	AdvertiseRemoteAPI string       `yaml:"advertise_remote_api"`
+	Manager            bool         `yaml:"manager"`
+	HealthAddr         string       `yaml:"health_addr"`
+	EventsSocket       string       `yaml:"events_socket"`
+	HeartbeatTick      int          `yaml:"heartbeat_tick"`
+	ElectionTick       int          `yaml:"election_tick"`
+	Consul             ConsulConfig `yaml:"consul"`
+	CNI                CNIConfig    `yaml:"cni"`
+}
+
+// ConsulConfig holds Consul service discovery settings.
+type ConsulConfig struct {
+	Enabled bool   `yaml:"enabled"`
+	Address string `yaml:"address"`
+}
+
+// CNIConfig holds the manager's CNI network provider settings.
+type CNIConfig struct {
+	Enabled    bool   `yaml:"enabled"`
+	PluginDir  string `yaml:"plugin_dir"`
+	ConfigDir  string `yaml:"config_dir"`
+	SubnetPool string `yaml:"subnet_pool"`
+	SubnetSize int    `yaml:"subnet_size"`
+	VXLANPort  int    `yaml:"vxlan_port"`
+}
+
+// CleanupConfig holds the intervals of the executor's background cleanup.
+type CleanupConfig struct {
+	ImageInterval   Duration `yaml:"image_interval"`
+	OrphanInterval  Duration `yaml:"orphan_interval"`
+	MaxImageAgeDays int      `yaml:"max_image_age_days"`
 }
 
 // SnapshotConfig holds snapshot configuration.
@@ -178,7 +287,14 @@ func LoadConfig(path string) (*Config, error) {
 		return nil, fmt.Errorf("unsupported config version %d (this binary supports version 1). Run 'swarmcracker config migrate' to upgrade", cfg.Version)
 	}
 
-	// Migrate legacy fields to nested structure
+	cfg.migrateLegacy()
+
+	return &cfg, nil
+}
+
+// migrateLegacy copies the legacy top-level fields into the nested structure
+// unless the nested field is already set.
+func (cfg *Config) migrateLegacy() {
 	if cfg.KernelPath != "" && cfg.Executor.KernelPath == "" {
 		cfg.Executor.KernelPath = cfg.KernelPath
 	}
@@ -200,8 +316,6 @@ func LoadConfig(path string) (*Config, error) {
 	if cfg.EnableJailer && !cfg.Executor.EnableJailer {
 		cfg.Executor.EnableJailer = cfg.EnableJailer
 	}
-
-	return &cfg, nil
 }
 
 // LoadConfigFromEnv loads configuration from the path specified in SWARMCRACKER_CONFIG env var,
@@ -263,6 +377,30 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("max_packets_per_sec must be > 0 when rate limiting is enabled")
 	}
 
+	if c.Network.IPMode != "" && c.Network.IPMode != "static" && c.Network.IPMode != "dhcp" {
+		return fmt.Errorf("network.ip_mode must be either 'static' or 'dhcp'")
+	}
+
+	if err := c.Executor.Balloon.Validate(); err != nil {
+		return fmt.Errorf("executor.balloon invalid: %w", err)
+	}
+
+	if err := c.Executor.CPU.Validate(); err != nil {
+		return fmt.Errorf("executor.cpu invalid: %w", err)
+	}
+
+	if hp := c.Executor.HugePages; hp != "" && hp != "None" && hp != "2M" {
+		return fmt.Errorf("executor.huge_pages must be either 'None' or '2M'")
+	}
+
+	if c.Executor.VMOverheadMB < 0 || c.Executor.MaxVMs < 0 {
+		return fmt.Errorf("executor.vm_overhead_mb and executor.max_vms cannot be negative")
+	}
+
+	if err := c.Executor.WarmPool.Validate(); err != nil {
+		return fmt.Errorf("executor.warm_pool invalid: %w", err)
+	}
+
 	// Validate jailer config if enabled
 	if c.Executor.EnableJailer || c.EnableJailer {
 		if err := c.Executor.Jailer.Validate(); err != nil {
@@ -270,9 +408,47 @@ func (c *Config) Validate() error {
 		}
 	}
 
+	if c.Logging.Level != "" && !validLogLevels[strings.ToLower(c.Logging.Level)] {
+		return fmt.Errorf("logging.level must be one of trace, debug, info, warn, error")
+	}
+
+	if c.Metrics.Format != "" && c.Metrics.Format != "prometheus" {
+		return fmt.Errorf("metrics.format must be 'prometheus'")
+	}
+	if c.Metrics.Enabled && c.Metrics.Address == "" {
+		return fmt.Errorf("metrics.address is required when metrics are enabled")
+	}
+
+	if c.Tracing.Enabled && c.Tracing.Endpoint == "" {
+		return fmt.Errorf("tracing.endpoint is required when tracing is enabled")
+	}
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		return fmt.Errorf("tracing.sample_ratio must be between 0 and 1")
+	}
+
+	if err := c.Agent.Validate(); err != nil {
+		return fmt.Errorf("agent config invalid: %w", err)
+	}
+
+	if c.Cleanup.ImageInterval < 0 || c.Cleanup.OrphanInterval < 0 {
+		return fmt.Errorf("cleanup intervals must not be negative")
+	}
+	if c.Cleanup.MaxImageAgeDays < 0 {
+		return fmt.Errorf("cleanup.max_image_age_days must not be negative")
+	}
+
 	return nil
 }
 
+// validLogLevels are the accepted logging.level values.
+var validLogLevels = map[string]bool{
+	"trace": true,
+	"debug": true,
+	"info":  true,
+	"warn":  true,
+	"error": true,
+}
+
 // SetDefaults sets default values for empty fields.
 func (c *Config) SetDefaults() {
 	// Set executor defaults
@@ -302,6 +478,79 @@ func (c *Config) SetDefaults() {
 		c.Executor.DefaultMemoryMB = 512
 	}
 
+	if c.Executor.FirecrackerPath == "" {
+		c.Executor.FirecrackerPath = "firecracker"
+	}
+	if c.Executor.KernelPath == "" {
+		c.Executor.KernelPath = "/usr/share/firecracker/vmlinux"
+	}
+	if c.Executor.RootfsDir == "" {
+		c.Executor.RootfsDir = "/var/lib/firecracker/rootfs"
+	}
+
+	// Set jailer defaults (only used when the jailer is enabled)
+	if c.Executor.Jailer.UID == 0 {
+		c.Executor.Jailer.UID = 1000
+	}
+	if c.Executor.Jailer.GID == 0 {
+		c.Executor.Jailer.GID = 1000
+	}
+	if c.Executor.Jailer.ChrootBaseDir == "" {
+		c.Executor.Jailer.ChrootBaseDir = "/var/lib/swarmcracker/jailer"
+	}
+	if c.Executor.Jailer.Path == "" {
+		c.Executor.Jailer.Path = "/usr/local/bin/jailer"
+	}
+	if c.Executor.Jailer.ParentCgroup == "" {
+		c.Executor.Jailer.ParentCgroup = "firecracker"
+	}
+	if c.Executor.Jailer.EnableCgroups == nil {
+		c.Executor.Jailer.EnableCgroups = boolPtr(true)
+	}
+
+	// Set balloon defaults (only used for VMs with a balloon)
+	if c.Executor.Balloon.DeflateOnOOM == nil {
+		c.Executor.Balloon.DeflateOnOOM = boolPtr(true)
+	}
+	if c.Executor.Balloon.StatsInterval == 0 {
+		c.Executor.Balloon.StatsInterval = Duration(5 * time.Second)
+	}
+	reclaim := &c.Executor.Balloon.Reclaim
+	if reclaim.Interval == 0 {
+		reclaim.Interval = Duration(10 * time.Second)
+	}
+	if reclaim.PSIThreshold == 0 {
+		reclaim.PSIThreshold = 10
+	}
+	if reclaim.MinAvailablePercent == 0 {
+		reclaim.MinAvailablePercent = 10
+	}
+	if reclaim.StepMiB == 0 {
+		reclaim.StepMiB = 64
+	}
+	if reclaim.MaxPercent == 0 {
+		reclaim.MaxPercent = 50
+	}
+	if reclaim.GuestReservePercent == 0 {
+		reclaim.GuestReservePercent = 20
+	}
+
+	if c.Executor.KernelCatalog == "" {
+		c.Executor.KernelCatalog = "/var/lib/firecracker/kernels/catalog.yaml"
+	}
+
+	if c.Executor.WarmPool.Dir == "" {
+		c.Executor.WarmPool.Dir = "/var/lib/firecracker/warmpool"
+	}
+	if c.Executor.WarmPool.GoldenTimeout == 0 {
+		c.Executor.WarmPool.GoldenTimeout = Duration(time.Minute)
+	}
+
+	// Keep the first core for the host when pinning
+	if c.Executor.CPU.Reserved == "" {
+		c.Executor.CPU.Reserved = "0"
+	}
+
 	// Set network defaults
 	if c.Network.BridgeName == "" {
 		c.Network.BridgeName = "swarm-br0"
@@ -335,6 +584,22 @@ func (c *Config) SetDefaults() {
 		c.Images.CacheDir = "/var/cache/swarmcracker"
 	}
 
+	// Set metrics defaults
+	if c.Metrics.Address == "" {
+		c.Metrics.Address = "127.0.0.1:9100"
+	}
+	if c.Metrics.Format == "" {
+		c.Metrics.Format = "prometheus"
+	}
+
+	// Set tracing defaults
+	if c.Tracing.Endpoint == "" {
+		c.Tracing.Endpoint = "http://127.0.0.1:4318"
+	}
+	if c.Tracing.SampleRatio == 0 {
+		c.Tracing.SampleRatio = 1
+	}
+
 	// Set snapshot defaults
 	if c.Snapshot.SnapshotDir == "" {
 		c.Snapshot.SnapshotDir = "/var/lib/firecracker/snapshots"
@@ -345,6 +610,62 @@ func (c *Config) SetDefaults() {
 	if c.Snapshot.MaxAge == 0 {
 		c.Snapshot.MaxAge = Duration(168 * time.Hour)
 	}
+
+	c.Agent.SetDefaults()
+
+	// Set cleanup defaults
+	if c.Cleanup.ImageInterval == 0 {
+		c.Cleanup.ImageInterval = Duration(24 * time.Hour)
+	}
+	if c.Cleanup.OrphanInterval == 0 {
+		c.Cleanup.OrphanInterval = Duration(5 * time.Minute)
+	}
+	if c.Cleanup.MaxImageAgeDays == 0 {
+		c.Cleanup.MaxImageAgeDays = 7
+	}
+}
+
+// SetDefaults sets default values for empty agent fields.
+func (a *AgentConfig) SetDefaults() {
+	if a.StateDir == "" {
+		a.StateDir = "/var/lib/swarmkit"
+	}
+	if a.ListenRemoteAPI == "" {
+		a.ListenRemoteAPI = "0.0.0.0:4242"
+	}
+	if a.ListenControlAPI == "" {
+		a.ListenControlAPI = "/var/run/swarmkit/swarm.sock"
+	}
+	if a.HealthAddr == "" {
+		a.HealthAddr = "127.0.0.1:8080"
+	}
+	if a.EventsSocket == "" {
+		a.EventsSocket = "/var/run/swarmcracker/events.sock"
+	}
+	if a.HeartbeatTick == 0 {
+		a.HeartbeatTick = 1
+	}
+	if a.ElectionTick == 0 {
+		a.ElectionTick = 10
+	}
+	if a.Consul.Address == "" {
+		a.Consul.Address = "127.0.0.1:8500"
+	}
+	if a.CNI.PluginDir == "" {
+		a.CNI.PluginDir = "/opt/cni/bin"
+	}
+	if a.CNI.ConfigDir == "" {
+		a.CNI.ConfigDir = "/etc/cni/net.d"
+	}
+	if a.CNI.SubnetPool == "" {
+		a.CNI.SubnetPool = "10.0.0.0/8"
+	}
+	if a.CNI.SubnetSize == 0 {
+		a.CNI.SubnetSize = 24
+	}
+	if a.CNI.VXLANPort == 0 {
+		a.CNI.VXLANPort = 4789
+	}
 }
 
 // Merge merges another config into this one, with override taking precedence.
@@ -431,6 +752,70 @@ func (j *JailerConfig) Validate() error {
 	return nil
 }
 
+// Validate validates the balloon configuration. Zero values mean "use the default".
+func (b *BalloonConfig) Validate() error {
+	if b.StatsInterval < 0 || b.StatsInterval.ToDuration()%time.Second != 0 {
+		return fmt.Errorf("stats_interval must be a whole number of seconds")
+	}
+	r := b.Reclaim
+	if r.Interval < 0 || r.StepMiB < 0 {
+		return fmt.Errorf("reclaim interval and step_mib must not be negative")
+	}
+	if r.PSIThreshold < 0 || r.PSIThreshold > 100 || r.MinAvailablePercent < 0 || r.MinAvailablePercent > 100 {
+		return fmt.Errorf("reclaim psi_threshold and min_available_percent must be between 0 and 100")
+	}
+	if r.MaxPercent < 0 || r.MaxPercent > 100 || r.GuestReservePercent < 0 || r.GuestReservePercent > 100 {
+		return fmt.Errorf("reclaim max_percent and guest_reserve_percent must be between 0 and 100")
+	}
+	return nil
+}
+
+// Validate validates the CPU configuration. Template names are checked
+// when the executor starts.
+func (c *CPUConfig) Validate() error {
+	for name, path := range c.CustomTemplates {
+		if name == "" || path == "" {
+			return fmt.Errorf("custom_templates entries need a name and a file")
+		}
+	}
+	for _, part := range strings.Split(c.Reserved, ",") {
+		if strings.Trim(strings.TrimSpace(part), "0123456789-") != "" {
+			return fmt.Errorf("reserved must be a CPU list like \"0-1,8\", got %q", c.Reserved)
+		}
+	}
+	return nil
+}
+
+// Validate validates the warm pool configuration.
+func (w *WarmPoolConfig) Validate() error {
+	for image, size := range w.Sizes {
+		if image == "" || size < 0 {
+			return fmt.Errorf("sizes entries need an image and a size of 0 or more")
+		}
+	}
+	if w.GoldenTimeout < 0 {
+		return fmt.Errorf("golden_timeout must not be negative")
+	}
+	return nil
+}
+
+// Validate validates the agent configuration. Zero values mean "use the default".
+func (a *AgentConfig) Validate() error {
+	if a.HeartbeatTick < 0 {
+		return fmt.Errorf("heartbeat_tick must not be negative")
+	}
+	if a.ElectionTick != 0 && a.ElectionTick <= a.HeartbeatTick {
+		return fmt.Errorf("election_tick must be greater than heartbeat_tick")
+	}
+	if a.CNI.Enabled && a.CNI.SubnetSize != 0 && (a.CNI.SubnetSize < 8 || a.CNI.SubnetSize > 30) {
+		return fmt.Errorf("cni.subnet_size must be between 8 and 30")
+	}
+	if a.CNI.VXLANPort < 0 || a.CNI.VXLANPort > 65535 {
+		return fmt.Errorf("cni.vxlan_port must be a valid UDP port")
+	}
+	return nil
+}
+
 // Validate validates the network configuration.
 func (n *NetworkConfig) Validate() error {
 	if n.BridgeName == "" {
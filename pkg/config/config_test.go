@@ -4,6 +4,7 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -189,6 +190,150 @@ func TestConfig_Validate(t *testing.T) {
 			},
 			wantErr: true,
 		},
+		{
+			name: "balloon stats interval below a second",
+			config: &Config{
+				Executor: ExecutorConfig{
+					KernelPath:      "/usr/share/firecracker/vmlinux",
+					RootfsDir:       "/var/lib/firecracker/rootfs",
+					DefaultVCPUs:    1,
+					DefaultMemoryMB: 512,
+					Balloon:         BalloonConfig{StatsInterval: Duration(500 * time.Millisecond)},
+				},
+				Network: NetworkConfig{
+					BridgeName: "swarm-br0",
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "balloon max percent above 100",
+			config: &Config{
+				Executor: ExecutorConfig{
+					KernelPath:      "/usr/share/firecracker/vmlinux",
+					RootfsDir:       "/var/lib/firecracker/rootfs",
+					DefaultVCPUs:    1,
+					DefaultMemoryMB: 512,
+					Balloon:         BalloonConfig{Reclaim: BalloonReclaimConfig{Enabled: true, MaxPercent: 150}},
+				},
+				Network: NetworkConfig{
+					BridgeName: "swarm-br0",
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "cpu reserved not a list",
+			config: &Config{
+				Executor: ExecutorConfig{
+					KernelPath:      "/usr/share/firecracker/vmlinux",
+					RootfsDir:       "/var/lib/firecracker/rootfs",
+					DefaultVCPUs:    1,
+					DefaultMemoryMB: 512,
+					CPU:             CPUConfig{Pinning: true, Reserved: "first two"},
+				},
+				Network: NetworkConfig{
+					BridgeName: "swarm-br0",
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "cpu custom template without file",
+			config: &Config{
+				Executor: ExecutorConfig{
+					KernelPath:      "/usr/share/firecracker/vmlinux",
+					RootfsDir:       "/var/lib/firecracker/rootfs",
+					DefaultVCPUs:    1,
+					DefaultMemoryMB: 512,
+					CPU:             CPUConfig{CustomTemplates: map[string]string{"fleet": ""}},
+				},
+				Network: NetworkConfig{
+					BridgeName: "swarm-br0",
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid huge page size",
+			config: &Config{
+				Executor: ExecutorConfig{
+					KernelPath:      "/usr/share/firecracker/vmlinux",
+					RootfsDir:       "/var/lib/firecracker/rootfs",
+					DefaultVCPUs:    1,
+					DefaultMemoryMB: 512,
+					HugePages:       "1G",
+				},
+				Network: NetworkConfig{
+					BridgeName: "swarm-br0",
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "negative vm overhead",
+			config: &Config{
+				Executor: ExecutorConfig{
+					KernelPath:      "/usr/share/firecracker/vmlinux",
+					RootfsDir:       "/var/lib/firecracker/rootfs",
+					DefaultVCPUs:    1,
+					DefaultMemoryMB: 512,
+					VMOverheadMB:    -1,
+				},
+				Network: NetworkConfig{
+					BridgeName: "swarm-br0",
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "negative warm pool size",
+			config: &Config{
+				Executor: ExecutorConfig{
+					KernelPath:      "/usr/share/firecracker/vmlinux",
+					RootfsDir:       "/var/lib/firecracker/rootfs",
+					DefaultVCPUs:    1,
+					DefaultMemoryMB: 512,
+					WarmPool:        WarmPoolConfig{Enabled: true, Sizes: map[string]int{"nginx:alpine": -1}},
+				},
+				Network: NetworkConfig{
+					BridgeName: "swarm-br0",
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "tracing without endpoint",
+			config: &Config{
+				Executor: ExecutorConfig{
+					KernelPath:      "/usr/share/firecracker/vmlinux",
+					RootfsDir:       "/var/lib/firecracker/rootfs",
+					DefaultVCPUs:    1,
+					DefaultMemoryMB: 512,
+				},
+				Network: NetworkConfig{
+					BridgeName: "swarm-br0",
+				},
+				Tracing: TracingConfig{Enabled: true},
+			},
+			wantErr: true,
+		},
+		{
+			name: "tracing sample ratio above 1",
+			config: &Config{
+				Executor: ExecutorConfig{
+					KernelPath:      "/usr/share/firecracker/vmlinux",
+					RootfsDir:       "/var/lib/firecracker/rootfs",
+					DefaultVCPUs:    1,
+					DefaultMemoryMB: 512,
+				},
+				Network: NetworkConfig{
+					BridgeName: "swarm-br0",
+				},
+				Tracing: TracingConfig{Enabled: true, Endpoint: "http://127.0.0.1:4318", SampleRatio: 2},
+			},
+			wantErr: true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -219,6 +364,22 @@ func TestConfig_SetDefaults(t *testing.T) {
 	assert.Equal(t, "/usr/share/firecracker/vmlinux", config.Executor.KernelPath)
 	assert.Equal(t, "swarm-br0", config.Network.BridgeName)
 	assert.False(t, config.Network.EnableRateLimit)
+	assert.False(t, config.Tracing.Enabled)
+	assert.Equal(t, "http://127.0.0.1:4318", config.Tracing.Endpoint)
+	assert.Equal(t, 1.0, config.Tracing.SampleRatio)
+	assert.False(t, config.Executor.Balloon.Enabled)
+	assert.True(t, *config.Executor.Balloon.DeflateOnOOM)
+	assert.Equal(t, 5*time.Second, config.Executor.Balloon.StatsInterval.ToDuration())
+	assert.False(t, config.Executor.Balloon.Reclaim.Enabled)
+	assert.Equal(t, 64, config.Executor.Balloon.Reclaim.StepMiB)
+	assert.False(t, config.Executor.MMDS.Enabled)
+	assert.False(t, config.Executor.MMDS.IncludeSecrets)
+	assert.False(t, config.Executor.CPU.Pinning)
+	assert.Equal(t, "0", config.Executor.CPU.Reserved)
+	assert.Equal(t, "/var/lib/firecracker/kernels/catalog.yaml", config.Executor.KernelCatalog)
+	assert.False(t, config.Executor.WarmPool.Enabled)
+	assert.Equal(t, "/var/lib/firecracker/warmpool", config.Executor.WarmPool.Dir)
+	assert.Equal(t, time.Minute, config.Executor.WarmPool.GoldenTimeout.ToDuration())
 }
 
 func TestGetDefaultConfigPath(t *testing.T) {
@@ -0,0 +1,204 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// EnvPrefix prefixes every environment variable that overrides a config
+// field. The variable name is the field's YAML path in upper case, joined
+// by underscores, e.g. SWARMCRACKER_NETWORK_BRIDGE_NAME or
+// SWARMCRACKER_AGENT_CNI_SUBNET_POOL.
+const EnvPrefix = "SWARMCRACKER_"
+
+// envSections are the top-level sections that can be set from the
+// environment. Legacy top-level fields are deliberately left out.
+var envSections = []string{"executor", "network", "logging", "images", "metrics", "snapshot", "agent", "cleanup"}
+
+// Load builds the effective configuration, lowest precedence first:
+//
+//  1. built-in defaults
+//  2. the YAML file at path (skipped if it does not exist)
+//  3. SWARMCRACKER_* environment variables
+//
+// Command-line flags take precedence over all of these; callers apply them
+// to the returned config and then call Validate.
+func Load(path string) (*Config, error) {
+	cfg := &Config{Version: 1}
+
+	if _, err := os.Stat(path); err == nil {
+		loaded, err := LoadConfig(path)
+		if err != nil {
+			return nil, err
+		}
+		cfg = loaded
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to stat config file: %w", err)
+	}
+
+	if err := cfg.ApplyEnv(os.Environ()); err != nil {
+		return nil, err
+	}
+
+	// Defaults only fill what the file and environment left empty
+	cfg.SetDefaults()
+	return cfg, nil
+}
+
+// ApplyEnv overrides fields from SWARMCRACKER_* entries of environ
+// ("KEY=value" pairs, as returned by os.Environ).
+func (c *Config) ApplyEnv(environ []string) error {
+	vars := make(map[string]string)
+	for _, kv := range environ {
+		key, value, ok := strings.Cut(kv, "=")
+		if ok && strings.HasPrefix(key, EnvPrefix) {
+			vars[strings.TrimPrefix(key, EnvPrefix)] = value
+		}
+	}
+	if len(vars) == 0 {
+		return nil
+	}
+
+	root := reflect.ValueOf(c).Elem()
+	for i := 0; i < root.NumField(); i++ {
+		name := yamlName(root.Type().Field(i))
+		for _, section := range envSections {
+			if name == section {
+				if err := applyEnvStruct(root.Field(i), strings.ToUpper(name), vars); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// applyEnvStruct sets the fields of v whose variable name (prefix plus the
+// field's YAML name) is present in vars, recursing into nested structs.
+func applyEnvStruct(v reflect.Value, prefix string, vars map[string]string) error {
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Field(i)
+		name := prefix + "_" + strings.ToUpper(yamlName(v.Type().Field(i)))
+
+		if field.Kind() == reflect.Struct {
+			if err := applyEnvStruct(field, name, vars); err != nil {
+				return err
+			}
+			continue
+		}
+
+		value, ok := vars[name]
+		if !ok {
+			continue
+		}
+		if err := setFromString(field, value); err != nil {
+			return fmt.Errorf("invalid %s%s: %w", EnvPrefix, name, err)
+		}
+	}
+	return nil
+}
+
+// setFromString parses value into a config field.
+func setFromString(field reflect.Value, value string) error {
+	switch field.Interface().(type) {
+	case Duration:
+		var d Duration
+		if err := d.UnmarshalYAML(&yaml.Node{Kind: yaml.ScalarNode, Value: value}); err != nil {
+			return err
+		}
+		field.Set(reflect.ValueOf(d))
+		return nil
+	case *bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		field.Set(reflect.ValueOf(&b))
+		return nil
+	case []string:
+		var items []string
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		field.Set(reflect.ValueOf(items))
+		return nil
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	case reflect.Int:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(n))
+	default:
+		return fmt.Errorf("unsupported field type %s", field.Type())
+	}
+	return nil
+}
+
+// yamlName returns the YAML key of a struct field.
+func yamlName(f reflect.StructField) string {
+	name, _, _ := strings.Cut(f.Tag.Get("yaml"), ",")
+	if name == "" {
+		return strings.ToLower(f.Name)
+	}
+	return name
+}
+
+// ApplyReload copies the settings that are safe to change at runtime from
+// next into c and returns the names of those that changed. Any other
+// difference needs a restart; those sections are returned in
+// restartRequired and left untouched in c.
+//
+// Reloadable settings are logging.level, the network rate limit, the static
+// VXLAN peers and the cleanup settings.
+func (c *Config) ApplyReload(next *Config) (changed, restartRequired []string) {
+	if c.Logging.Level != next.Logging.Level {
+		c.Logging.Level = next.Logging.Level
+		changed = append(changed, "logging.level")
+	}
+	if c.Network.EnableRateLimit != next.Network.EnableRateLimit {
+		c.Network.EnableRateLimit = next.Network.EnableRateLimit
+		changed = append(changed, "network.enable_rate_limit")
+	}
+	if c.Network.MaxPacketsPerSec != next.Network.MaxPacketsPerSec {
+		c.Network.MaxPacketsPerSec = next.Network.MaxPacketsPerSec
+		changed = append(changed, "network.max_packets_per_sec")
+	}
+	if !slices.Equal(c.Network.VXLANStaticPeers, next.Network.VXLANStaticPeers) {
+		changed = append(changed, "network.vxlan_static_peers")
+	}
+	c.Network.VXLANStaticPeers = next.Network.VXLANStaticPeers
+	if c.Cleanup != next.Cleanup {
+		c.Cleanup = next.Cleanup
+		changed = append(changed, "cleanup")
+	}
+
+	// Everything else is compared section by section
+	cur := reflect.ValueOf(c).Elem()
+	nxt := reflect.ValueOf(next).Elem()
+	for i := 0; i < cur.NumField(); i++ {
+		if !reflect.DeepEqual(cur.Field(i).Interface(), nxt.Field(i).Interface()) {
+			restartRequired = append(restartRequired, yamlName(cur.Type().Field(i)))
+		}
+	}
+	return changed, restartRequired
+}
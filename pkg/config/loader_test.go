@@ -0,0 +1,171 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoad_Precedence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	content := `
+executor:
+  kernel_path: /file/vmlinux
+  default_vcpus: 2
+network:
+  bridge_name: file-br0
+  vxlan_static_peers: [10.0.0.1]
+logging:
+  level: warn
+`
+	require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+
+	t.Setenv("SWARMCRACKER_NETWORK_BRIDGE_NAME", "env-br0")
+	t.Setenv("SWARMCRACKER_NETWORK_VXLAN_STATIC_PEERS", "10.0.0.2, 10.0.0.3")
+	t.Setenv("SWARMCRACKER_AGENT_CNI_ENABLED", "true")
+	t.Setenv("SWARMCRACKER_CLEANUP_ORPHAN_INTERVAL", "90s")
+
+	cfg, err := Load(path)
+	require.NoError(t, err)
+
+	// File beats defaults
+	assert.Equal(t, "/file/vmlinux", cfg.Executor.KernelPath)
+	assert.Equal(t, 2, cfg.Executor.DefaultVCPUs)
+	assert.Equal(t, "warn", cfg.Logging.Level)
+	// Env beats file
+	assert.Equal(t, "env-br0", cfg.Network.BridgeName)
+	assert.Equal(t, []string{"10.0.0.2", "10.0.0.3"}, cfg.Network.VXLANStaticPeers)
+	assert.True(t, cfg.Agent.CNI.Enabled)
+	assert.Equal(t, 90*time.Second, cfg.Cleanup.OrphanInterval.ToDuration())
+	// Defaults fill the rest
+	assert.Equal(t, 512, cfg.Executor.DefaultMemoryMB)
+	assert.Equal(t, "/var/lib/swarmkit", cfg.Agent.StateDir)
+	assert.Equal(t, 24*time.Hour, cfg.Cleanup.ImageInterval.ToDuration())
+	require.NoError(t, cfg.Validate())
+}
+
+func TestLoad_MissingFile(t *testing.T) {
+	cfg, err := Load(filepath.Join(t.TempDir(), "missing.yaml"))
+	require.NoError(t, err)
+
+	assert.Equal(t, 1, cfg.Version)
+	assert.Equal(t, "/usr/share/firecracker/vmlinux", cfg.Executor.KernelPath)
+	assert.Equal(t, "swarm-br0", cfg.Network.BridgeName)
+	require.NotNil(t, cfg.Executor.Jailer.EnableCgroups)
+	assert.True(t, *cfg.Executor.Jailer.EnableCgroups)
+	require.NoError(t, cfg.Validate())
+}
+
+func TestLoad_Errors(t *testing.T) {
+	dir := t.TempDir()
+
+	corrupt := filepath.Join(dir, "corrupt.yaml")
+	require.NoError(t, os.WriteFile(corrupt, []byte("executor: ["), 0644))
+	_, err := Load(corrupt)
+	assert.Error(t, err)
+
+	t.Setenv("SWARMCRACKER_EXECUTOR_DEFAULT_VCPUS", "many")
+	_, err = Load(filepath.Join(dir, "missing.yaml"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "SWARMCRACKER_EXECUTOR_DEFAULT_VCPUS")
+}
+
+func TestApplyEnv(t *testing.T) {
+	cfg := &Config{}
+	err := cfg.ApplyEnv([]string{
+		"SWARMCRACKER_EXECUTOR_JAILER_ENABLE_CGROUPS=false",
+		"SWARMCRACKER_NETWORK_NAT_ENABLED=true",
+		"SWARMCRACKER_AGENT_HEARTBEAT_TICK=2",
+		"SWARMCRACKER_SNAPSHOT_MAX_AGE=2d",
+		"SWARMCRACKER_KERNEL_PATH=/legacy/ignored",
+		"SWARMCRACKER_CONFIG=/etc/other.yaml",
+		"PATH=/usr/bin",
+	})
+	require.NoError(t, err)
+
+	require.NotNil(t, cfg.Executor.Jailer.EnableCgroups)
+	assert.False(t, *cfg.Executor.Jailer.EnableCgroups)
+	require.NotNil(t, cfg.Network.NATEnabled)
+	assert.True(t, *cfg.Network.NATEnabled)
+	assert.Equal(t, 2, cfg.Agent.HeartbeatTick)
+	assert.Equal(t, 48*time.Hour, cfg.Snapshot.MaxAge.ToDuration())
+	assert.Empty(t, cfg.KernelPath, "legacy top-level fields are not set from the environment")
+
+	for _, kv := range []string{
+		"SWARMCRACKER_NETWORK_VXLAN_ENABLED=maybe",
+		"SWARMCRACKER_NETWORK_NAT_ENABLED=maybe",
+		"SWARMCRACKER_CLEANUP_IMAGE_INTERVAL=soon",
+	} {
+		assert.Error(t, (&Config{}).ApplyEnv([]string{kv}), kv)
+	}
+}
+
+func TestConfig_ValidateUnified(t *testing.T) {
+	tests := []struct {
+		name    string
+		mutate  func(c *Config)
+		wantErr bool
+	}{
+		{"defaults", func(c *Config) {}, false},
+		{"bad ip mode", func(c *Config) { c.Network.IPMode = "bootp" }, true},
+		{"bad log level", func(c *Config) { c.Logging.Level = "loud" }, true},
+		{"election not above heartbeat", func(c *Config) { c.Agent.ElectionTick = 1 }, true},
+		{"cni subnet too small", func(c *Config) { c.Agent.CNI.Enabled = true; c.Agent.CNI.SubnetSize = 31 }, true},
+		{"bad vxlan port", func(c *Config) { c.Agent.CNI.VXLANPort = 70000 }, true},
+		{"negative interval", func(c *Config) { c.Cleanup.OrphanInterval = Duration(-time.Second) }, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{}
+			cfg.SetDefaults()
+			tt.mutate(cfg)
+			if tt.wantErr {
+				assert.Error(t, cfg.Validate())
+			} else {
+				assert.NoError(t, cfg.Validate())
+			}
+		})
+	}
+}
+
+func TestConfig_ApplyReload(t *testing.T) {
+	cur := &Config{}
+	cur.SetDefaults()
+
+	next := &Config{}
+	next.SetDefaults()
+	next.Logging.Level = "debug"
+	next.Network.EnableRateLimit = true
+	next.Network.MaxPacketsPerSec = 1000
+	next.Network.VXLANStaticPeers = []string{"10.0.0.2"}
+	next.Cleanup.OrphanInterval = Duration(time.Minute)
+	next.Executor.DefaultVCPUs = 4
+	next.Agent.JoinAddr = "10.0.0.1:4242"
+
+	changed, restartRequired := cur.ApplyReload(next)
+
+	assert.Equal(t, []string{
+		"logging.level",
+		"network.enable_rate_limit",
+		"network.max_packets_per_sec",
+		"network.vxlan_static_peers",
+		"cleanup",
+	}, changed)
+	assert.Equal(t, []string{"executor", "agent"}, restartRequired)
+
+	assert.Equal(t, "debug", cur.Logging.Level)
+	assert.Equal(t, 1000, cur.Network.MaxPacketsPerSec)
+	assert.Equal(t, time.Minute, cur.Cleanup.OrphanInterval.ToDuration())
+	// Settings that need a restart are not applied
+	assert.Equal(t, 1, cur.Executor.DefaultVCPUs)
+	assert.Empty(t, cur.Agent.JoinAddr)
+
+	changed, restartRequired = cur.ApplyReload(next)
+	assert.Empty(t, changed)
+	assert.Equal(t, []string{"executor", "agent"}, restartRequired)
+}
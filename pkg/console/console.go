@@ -0,0 +1,185 @@
+// Package console relays a VM's serial console to the terminals attached
+// to it.
+//
+// Firecracker carries the guest's serial console on its stdin and stdout.
+// A Relay owns both ends and serves them on a unix socket next to the
+// VM's API socket, so clients can attach, detach and attach again while
+// the VM keeps running.
+package console
+
+import (
+	"errors"
+	"io"
+	"net"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// writeTimeout bounds how long a stalled client may hold up the console
+// before it is dropped
+const writeTimeout = 5 * time.Second
+
+// SocketPath returns the console socket of a VM whose API socket lives in
+// socketDir.
+func SocketPath(socketDir, vmID string) string {
+	return filepath.Join(socketDir, vmID+".console")
+}
+
+// Relay copies a VM's console output to every attached client and the
+// clients' input to the VM.
+type Relay struct {
+	in  io.Writer // the VM's serial input
+	log io.Writer // keeps all output, e.g. the VM's log file; may be nil
+
+	inMu    sync.Mutex
+	mu      sync.Mutex
+	clients map[net.Conn]struct{}
+	closed  bool
+}
+
+// NewRelay creates a relay writing client input to in and keeping a copy
+// of all output in log.
+func NewRelay(in, log io.Writer) *Relay {
+	return &Relay{
+		in:      in,
+		log:     log,
+		clients: make(map[net.Conn]struct{}),
+	}
+}
+
+// Serve attaches the clients connecting to l until l is closed.
+func (r *Relay) Serve(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+
+		r.mu.Lock()
+		if r.closed {
+			r.mu.Unlock()
+			conn.Close()
+			continue
+		}
+		r.clients[conn] = struct{}{}
+		r.mu.Unlock()
+
+		go r.readInput(conn)
+	}
+}
+
+// Copy relays the VM's output until it ends, i.e. the VM exited, then
+// disconnects all clients.
+func (r *Relay) Copy(out io.Reader) error {
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := out.Read(buf)
+		if n > 0 {
+			r.broadcast(buf[:n])
+		}
+		if err != nil {
+			r.close()
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+// Clients returns the number of attached clients.
+func (r *Relay) Clients() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.clients)
+}
+
+// broadcast writes output to the log and every client, dropping clients
+// that cannot keep up
+func (r *Relay) broadcast(p []byte) {
+	if r.log != nil {
+		r.log.Write(p)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for conn := range r.clients {
+		conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+		if _, err := conn.Write(p); err != nil {
+			conn.Close()
+			delete(r.clients, conn)
+		}
+	}
+}
+
+// readInput forwards a client's input to the VM until the client detaches
+func (r *Relay) readInput(conn net.Conn) {
+	buf := make([]byte, 1024)
+	for {
+		n, err := conn.Read(buf)
+		if n > 0 {
+			r.inMu.Lock()
+			_, werr := r.in.Write(buf[:n])
+			r.inMu.Unlock()
+			if werr != nil {
+				err = werr
+			}
+		}
+		if err != nil {
+			break
+		}
+	}
+
+	r.mu.Lock()
+	delete(r.clients, conn)
+	r.mu.Unlock()
+	conn.Close()
+}
+
+// close disconnects all clients and refuses new ones
+func (r *Relay) close() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.closed = true
+	for conn := range r.clients {
+		conn.Close()
+		delete(r.clients, conn)
+	}
+}
+
+// Attach connects a terminal to a console: in is copied to conn until the
+// detach keys are typed, and conn to out until the console closes, i.e.
+// the VM exited. It reports whether the user detached. in may be nil to
+// only watch the output.
+func Attach(conn net.Conn, in io.Reader, out io.Writer, detachKeys []byte) (bool, error) {
+	output := make(chan error, 1)
+	go func() {
+		_, err := io.Copy(out, conn)
+		output <- err
+	}()
+
+	detached := make(chan struct{})
+	if in != nil {
+		go func() {
+			_, err := io.Copy(conn, NewDetachReader(in, detachKeys))
+			if errors.Is(err, ErrDetached) {
+				close(detached)
+			}
+		}()
+	}
+
+	select {
+	case err := <-output:
+		if errors.Is(err, net.ErrClosed) {
+			err = nil
+		}
+		return false, err
+	case <-detached:
+		conn.Close()
+		return true, nil
+	}
+}
@@ -0,0 +1,192 @@
+package console
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseDetachKeys(t *testing.T) {
+	tests := []struct {
+		name    string
+		keys    string
+		want    []byte
+		wantErr bool
+	}{
+		{"default", DefaultDetachKeys, []byte{0x10, 0x11}, false},
+		{"upper case", "ctrl-P,ctrl-Q", []byte{0x10, 0x11}, false},
+		{"punctuation", "ctrl-@,ctrl-[,ctrl-\\,ctrl-],ctrl-^,ctrl-_", []byte{0, 0x1b, 0x1c, 0x1d, 0x1e, 0x1f}, false},
+		{"plain keys", "a,ctrl-a", []byte{'a', 0x01}, false},
+		{"empty", "", nil, true},
+		{"bad ctrl key", "ctrl-1", nil, true},
+		{"word", "ctrl-p,quit", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseDetachKeys(tt.keys)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestDetachReader(t *testing.T) {
+	keys := []byte{0x10, 0x11}
+
+	tests := []struct {
+		name     string
+		input    string
+		want     string
+		detached bool
+	}{
+		{"no keys typed", "ls -l\n", "ls -l\n", false},
+		{"detach", "ls\n\x10\x11exit\n", "ls\n", true},
+		{"broken off sequence passes through", "\x10a\x10\x10\x11", "\x10a\x10", true},
+		{"first key alone", "vi\x10", "vi\x10", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// One byte per read, as typed on a terminal
+			var got bytes.Buffer
+			_, err := io.Copy(&got, NewDetachReader(&oneByteReader{r: strings.NewReader(tt.input)}, keys))
+			if tt.detached {
+				assert.ErrorIs(t, err, ErrDetached)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tt.want, got.String())
+
+			// Pasted in one read
+			got.Reset()
+			_, err = io.Copy(&got, NewDetachReader(strings.NewReader(tt.input), keys))
+			if tt.detached {
+				assert.ErrorIs(t, err, ErrDetached)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tt.want, got.String())
+		})
+	}
+
+	var got bytes.Buffer
+	_, err := io.Copy(&got, NewDetachReader(strings.NewReader("\x10\x11"), nil))
+	assert.NoError(t, err)
+	assert.Equal(t, "\x10\x11", got.String(), "no keys never detach")
+}
+
+func TestRelay(t *testing.T) {
+	socketPath := SocketPath(t.TempDir(), "vm-1")
+	assert.Equal(t, "vm-1.console", filepath.Base(socketPath))
+
+	listener, err := net.Listen("unix", socketPath)
+	require.NoError(t, err)
+	defer listener.Close()
+
+	vmIn := &syncBuffer{}
+	var logBuf syncBuffer
+	relay := NewRelay(vmIn, &logBuf)
+	go relay.Serve(listener)
+
+	outR, outW := io.Pipe()
+	copied := make(chan error, 1)
+	go func() {
+		copied <- relay.Copy(outR)
+	}()
+
+	// A client that detaches leaves the VM running
+	conn, err := net.Dial("unix", socketPath)
+	require.NoError(t, err)
+	waitFor(t, func() bool { return relay.Clients() == 1 })
+
+	stdinR, stdinW := io.Pipe()
+	var screen syncBuffer
+	detached := make(chan bool, 1)
+	go func() {
+		d, _ := Attach(conn, stdinR, &screen, []byte{0x10, 0x11})
+		detached <- d
+	}()
+
+	outW.Write([]byte("login: "))
+	waitFor(t, func() bool { return screen.String() == "login: " })
+	stdinW.Write([]byte("root\n"))
+	waitFor(t, func() bool { return vmIn.String() == "root\n" })
+	stdinW.Write([]byte{0x10, 0x11})
+	assert.True(t, <-detached)
+	waitFor(t, func() bool { return relay.Clients() == 0 })
+
+	// A client attached when the VM exits sees the console close
+	conn, err = net.Dial("unix", socketPath)
+	require.NoError(t, err)
+	waitFor(t, func() bool { return relay.Clients() == 1 })
+	screen.Reset()
+	go func() {
+		d, _ := Attach(conn, nil, &screen, nil)
+		detached <- d
+	}()
+
+	outW.Write([]byte("bye\n"))
+	outW.Close()
+	require.NoError(t, <-copied)
+	assert.False(t, <-detached)
+	assert.Equal(t, "bye\n", screen.String())
+	assert.Equal(t, "login: bye\n", logBuf.String(), "the log keeps all output")
+}
+
+// oneByteReader reads one byte at a time
+type oneByteReader struct {
+	r io.Reader
+}
+
+func (o *oneByteReader) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	return o.r.Read(p[:1])
+}
+
+// syncBuffer is a bytes.Buffer safe for concurrent use
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func (b *syncBuffer) Reset() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.buf.Reset()
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
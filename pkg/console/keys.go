@@ -0,0 +1,109 @@
+package console
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// DefaultDetachKeys detach from a console without stopping the VM.
+const DefaultDetachKeys = "ctrl-p,ctrl-q"
+
+// ErrDetached is returned by a DetachReader once the detach keys were read.
+var ErrDetached = errors.New("detached")
+
+// ParseDetachKeys parses a detach key sequence: comma-separated keys, each
+// a single character or "ctrl-<key>" with <key> one of a-z, @, [, \, ],
+// ^ and _, e.g. "ctrl-p,ctrl-q".
+func ParseDetachKeys(s string) ([]byte, error) {
+	if s == "" {
+		return nil, fmt.Errorf("empty detach key sequence")
+	}
+
+	var keys []byte
+	for _, key := range strings.Split(s, ",") {
+		switch {
+		case len(key) == 1:
+			keys = append(keys, key[0])
+		case strings.HasPrefix(strings.ToLower(key), "ctrl-") && len(key) == len("ctrl-")+1:
+			c := key[len(key)-1]
+			switch {
+			case c >= 'a' && c <= 'z':
+				keys = append(keys, c-'a'+1)
+			case c >= 'A' && c <= 'Z':
+				keys = append(keys, c-'A'+1)
+			case c >= '@' && c <= '_':
+				keys = append(keys, c-'@')
+			default:
+				return nil, fmt.Errorf("invalid detach key %q", key)
+			}
+		default:
+			return nil, fmt.Errorf("invalid detach key %q", key)
+		}
+	}
+	return keys, nil
+}
+
+// DetachReader passes input through until it reads the detach keys. Keys
+// that start the sequence are held back until the sequence completes or
+// breaks off, so a detach never reaches the VM.
+type DetachReader struct {
+	r        io.Reader
+	keys     []byte
+	matched  int    // keys of the sequence read so far
+	pending  []byte // input ready to be returned
+	detached bool   // the keys were read; pending is all that is left
+}
+
+// NewDetachReader wraps r to stop at keys. With no keys, it never detaches.
+func NewDetachReader(r io.Reader, keys []byte) *DetachReader {
+	return &DetachReader{r: r, keys: keys}
+}
+
+// Read implements io.Reader. It returns ErrDetached once the detach keys
+// were read.
+func (d *DetachReader) Read(p []byte) (int, error) {
+	for len(d.pending) == 0 {
+		if d.detached {
+			return 0, ErrDetached
+		}
+		buf := make([]byte, len(p))
+		n, err := d.r.Read(buf)
+		for _, c := range buf[:n] {
+			if len(d.keys) == 0 {
+				d.pending = append(d.pending, c)
+				continue
+			}
+			if c == d.keys[d.matched] {
+				d.matched++
+				if d.matched == len(d.keys) {
+					d.detached = true
+					break
+				}
+				continue
+			}
+			// The sequence broke off: the held keys were plain input
+			d.pending = append(d.pending, d.keys[:d.matched]...)
+			d.matched = 0
+			if c == d.keys[0] {
+				d.matched = 1
+				continue
+			}
+			d.pending = append(d.pending, c)
+		}
+		if err != nil && !d.detached {
+			// Input ended: the held keys were plain input
+			d.pending = append(d.pending, d.keys[:d.matched]...)
+			d.matched = 0
+			if len(d.pending) == 0 {
+				return 0, err
+			}
+			break
+		}
+	}
+
+	n := copy(p, d.pending)
+	d.pending = d.pending[n:]
+	return n, nil
+}
@@ -0,0 +1,15 @@
+//go:build !linux
+
+package console
+
+import "fmt"
+
+// IsTerminal is only supported on Linux.
+func IsTerminal(fd int) bool {
+	return false
+}
+
+// MakeRaw is only supported on Linux.
+func MakeRaw(fd int) (func(), error) {
+	return nil, fmt.Errorf("raw terminal mode is not supported on this platform")
+}
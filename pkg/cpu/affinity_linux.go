@@ -0,0 +1,42 @@
+package cpu
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"golang.org/x/sys/unix"
+)
+
+// procDir is the proc filesystem root - overridable for testing
+var procDir = "/proc"
+
+// SetAffinity confines every thread of a process to cpus. Threads the
+// process starts later inherit the affinity of their creator, so VMs
+// pinned before boot have their vCPU threads pinned too.
+func SetAffinity(pid int, cpus Set) error {
+	if len(cpus) == 0 {
+		return fmt.Errorf("empty CPU set")
+	}
+	var mask unix.CPUSet
+	for _, id := range cpus {
+		mask.Set(id)
+	}
+
+	threads, err := os.ReadDir(filepath.Join(procDir, strconv.Itoa(pid), "task"))
+	if err != nil {
+		return fmt.Errorf("failed to list threads of %d: %w", pid, err)
+	}
+	for _, thread := range threads {
+		tid, err := strconv.Atoi(thread.Name())
+		if err != nil {
+			continue
+		}
+		// Threads may exit while we iterate
+		if err := unix.SchedSetaffinity(tid, &mask); err != nil && err != unix.ESRCH {
+			return fmt.Errorf("failed to set affinity of thread %d: %w", tid, err)
+		}
+	}
+	return nil
+}
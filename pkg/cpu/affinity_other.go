@@ -0,0 +1,10 @@
+//go:build !linux
+
+package cpu
+
+import "fmt"
+
+// SetAffinity is only supported on Linux.
+func SetAffinity(pid int, cpus Set) error {
+	return fmt.Errorf("CPU affinity is not supported on this platform")
+}
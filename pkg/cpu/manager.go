@@ -0,0 +1,232 @@
+package cpu
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+)
+
+// ExclusiveLabel is the service label that gives each of a service's VMs
+// dedicated host cores, one per vCPU ("true").
+const ExclusiveLabel = "swarmcracker.cpu.exclusive"
+
+// ErrInsufficientCPUs is returned when no NUMA node has enough free cores.
+var ErrInsufficientCPUs = errors.New("not enough free CPUs on a single NUMA node")
+
+// Exclusive reports whether a service with the given labels asks for
+// dedicated cores.
+func Exclusive(labels map[string]string) (bool, error) {
+	v, ok := labels[ExclusiveLabel]
+	if !ok || v == "" {
+		return false, nil
+	}
+	exclusive, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, fmt.Errorf("label %s: invalid value %q, want true or false", ExclusiveLabel, v)
+	}
+	return exclusive, nil
+}
+
+// Allocation is the set of cores given to one VM, all on one NUMA node so
+// the VM's memory can be kept local.
+type Allocation struct {
+	CPUs Set `json:"cpus"`
+	Node int `json:"node"`
+}
+
+// Mems returns the allocation's NUMA node as a memory node set.
+func (a Allocation) Mems() Set {
+	return Set{a.Node}
+}
+
+// Manager hands out exclusive cores to pinned VMs. Cores that are not
+// allocated, including the reserved ones, form the shared pool every other
+// VM and the host run on.
+//
+// A nil *Manager is valid and allocates nothing.
+type Manager struct {
+	topo     Topology
+	reserved Set
+
+	mu        sync.Mutex
+	allocs    map[string]Allocation // taskID -> cores
+	stateFile string                // empty disables persistence
+}
+
+// NewManager creates a manager for the given topology. Reserved cores are
+// never allocated exclusively.
+func NewManager(topo Topology, reserved Set) *Manager {
+	return &Manager{
+		topo:     topo,
+		reserved: reserved,
+		allocs:   make(map[string]Allocation),
+	}
+}
+
+// Persist loads allocations saved at path and saves every later change
+// there, so a restarted agent keeps running VMs' cores out of the pool.
+func (m *Manager) Persist(path string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	data, err := os.ReadFile(path)
+	switch {
+	case os.IsNotExist(err):
+	case err != nil:
+		return fmt.Errorf("failed to read CPU allocations: %w", err)
+	default:
+		var allocs map[string]Allocation
+		if err := json.Unmarshal(data, &allocs); err != nil {
+			return fmt.Errorf("failed to parse CPU allocations: %w", err)
+		}
+		for taskID, a := range allocs {
+			m.allocs[taskID] = a
+		}
+	}
+	m.stateFile = path
+	return nil
+}
+
+// Allocate gives a task n exclusive cores on a single NUMA node. The node
+// with the fewest free cores that still fits is used, which keeps large
+// blocks free for larger VMs. Allocating again for the same task returns
+// its existing cores.
+func (m *Manager) Allocate(taskID string, n int) (Allocation, error) {
+	if m == nil {
+		return Allocation{}, fmt.Errorf("CPU pinning is not enabled on this node")
+	}
+	if n < 1 {
+		return Allocation{}, fmt.Errorf("invalid CPU count %d", n)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if a, ok := m.allocs[taskID]; ok {
+		return a, nil
+	}
+
+	used := m.reserved
+	for _, a := range m.allocs {
+		used = used.Union(a.CPUs)
+	}
+
+	nodes := make([]int, 0, len(m.topo.Nodes))
+	for node := range m.topo.Nodes {
+		nodes = append(nodes, node)
+	}
+	sort.Ints(nodes)
+
+	best, bestFree := -1, Set(nil)
+	for _, node := range nodes {
+		free := m.topo.Nodes[node].Difference(used)
+		if len(free) >= n && (best < 0 || len(free) < len(bestFree)) {
+			best, bestFree = node, free
+		}
+	}
+	if best < 0 {
+		return Allocation{}, fmt.Errorf("%w: need %d", ErrInsufficientCPUs, n)
+	}
+
+	// The shared pool must keep at least one core
+	if len(m.reserved) == 0 && len(m.topo.CPUs().Difference(used)) == n {
+		return Allocation{}, fmt.Errorf("%w: need %d and the shared pool needs one", ErrInsufficientCPUs, n)
+	}
+
+	a := Allocation{CPUs: bestFree[:n], Node: best}
+	m.allocs[taskID] = a
+	m.saveLocked()
+	return a, nil
+}
+
+// Release returns a task's cores to the shared pool. It reports whether
+// the task had any.
+func (m *Manager) Release(taskID string) bool {
+	if m == nil {
+		return false
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.allocs[taskID]; !ok {
+		return false
+	}
+	delete(m.allocs, taskID)
+	m.saveLocked()
+	return true
+}
+
+// Get returns a task's allocation.
+func (m *Manager) Get(taskID string) (Allocation, bool) {
+	if m == nil {
+		return Allocation{}, false
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	a, ok := m.allocs[taskID]
+	return a, ok
+}
+
+// Shared returns the cores not allocated to any task.
+func (m *Manager) Shared() Set {
+	if m == nil {
+		return nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	shared := m.topo.CPUs()
+	for _, a := range m.allocs {
+		shared = shared.Difference(a.CPUs)
+	}
+	return shared
+}
+
+// Reconcile releases allocations of tasks that are no longer running and
+// returns how many were released.
+func (m *Manager) Reconcile(isRunning func(taskID string) bool) int {
+	if m == nil {
+		return 0
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	released := 0
+	for taskID := range m.allocs {
+		if !isRunning(taskID) {
+			delete(m.allocs, taskID)
+			released++
+		}
+	}
+	if released > 0 {
+		m.saveLocked()
+	}
+	return released
+}
+
+// saveLocked writes the allocations to the state file, if any.
+func (m *Manager) saveLocked() {
+	if m.stateFile == "" {
+		return
+	}
+	data, err := json.MarshalIndent(m.allocs, "", "  ")
+	if err == nil {
+		err = os.MkdirAll(filepath.Dir(m.stateFile), 0750)
+	}
+	if err == nil {
+		tmp := m.stateFile + ".tmp"
+		if err = os.WriteFile(tmp, data, 0640); err == nil {
+			err = os.Rename(tmp, m.stateFile)
+		}
+	}
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to save CPU allocations")
+	}
+}
@@ -0,0 +1,130 @@
+package cpu
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExclusive(t *testing.T) {
+	tests := []struct {
+		name    string
+		labels  map[string]string
+		want    bool
+		wantErr bool
+	}{
+		{"no label", nil, false, false},
+		{"true", map[string]string{ExclusiveLabel: "true"}, true, false},
+		{"false", map[string]string{ExclusiveLabel: "false"}, false, false},
+		{"empty", map[string]string{ExclusiveLabel: ""}, false, false},
+		{"invalid", map[string]string{ExclusiveLabel: "yes please"}, false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Exclusive(tt.labels)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func twoNodes() Topology {
+	return Topology{Nodes: map[int]Set{0: {0, 1, 2, 3}, 1: {4, 5, 6, 7}}}
+}
+
+func TestManager_Allocate(t *testing.T) {
+	m := NewManager(twoNodes(), Set{0})
+
+	// Node 0 has 3 free cores, node 1 has 4: the tighter fit wins
+	a, err := m.Allocate("task-1", 2)
+	require.NoError(t, err)
+	assert.Equal(t, Allocation{CPUs: Set{1, 2}, Node: 0}, a)
+	assert.Equal(t, Set{0}, a.Mems())
+
+	// Node 0 has only one core left
+	b, err := m.Allocate("task-2", 2)
+	require.NoError(t, err)
+	assert.Equal(t, Allocation{CPUs: Set{4, 5}, Node: 1}, b)
+
+	// Idempotent per task
+	again, err := m.Allocate("task-1", 2)
+	require.NoError(t, err)
+	assert.Equal(t, a, again)
+
+	// No single node has three free cores
+	_, err = m.Allocate("task-3", 3)
+	assert.True(t, errors.Is(err, ErrInsufficientCPUs))
+
+	assert.Equal(t, Set{0, 3, 6, 7}, m.Shared())
+
+	got, ok := m.Get("task-2")
+	assert.True(t, ok)
+	assert.Equal(t, b, got)
+
+	assert.True(t, m.Release("task-2"))
+	assert.False(t, m.Release("task-2"))
+	_, ok = m.Get("task-2")
+	assert.False(t, ok)
+	assert.Equal(t, Set{0, 3, 4, 5, 6, 7}, m.Shared())
+}
+
+func TestManager_Allocate_KeepsSharedCore(t *testing.T) {
+	m := NewManager(Topology{Nodes: map[int]Set{0: {0, 1}}}, nil)
+
+	_, err := m.Allocate("task-1", 2)
+	assert.True(t, errors.Is(err, ErrInsufficientCPUs))
+
+	_, err = m.Allocate("task-1", 1)
+	require.NoError(t, err)
+
+	_, err = m.Allocate("task-2", 0)
+	assert.Error(t, err)
+}
+
+func TestManager_Persist(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "cpus.json")
+
+	m := NewManager(twoNodes(), Set{0})
+	require.NoError(t, m.Persist(path))
+	a, err := m.Allocate("task-1", 2)
+	require.NoError(t, err)
+	_, err = m.Allocate("task-2", 1)
+	require.NoError(t, err)
+
+	// A restarted agent picks the allocations up
+	restarted := NewManager(twoNodes(), Set{0})
+	require.NoError(t, restarted.Persist(path))
+	got, ok := restarted.Get("task-1")
+	require.True(t, ok)
+	assert.Equal(t, a, got)
+
+	released := restarted.Reconcile(func(taskID string) bool { return taskID == "task-1" })
+	assert.Equal(t, 1, released)
+	_, ok = restarted.Get("task-2")
+	assert.False(t, ok)
+
+	reloaded := NewManager(twoNodes(), Set{0})
+	require.NoError(t, reloaded.Persist(path))
+	_, ok = reloaded.Get("task-2")
+	assert.False(t, ok, "reconcile must be persisted")
+}
+
+func TestManager_Nil(t *testing.T) {
+	var m *Manager
+
+	_, err := m.Allocate("task-1", 1)
+	assert.Error(t, err)
+	assert.False(t, m.Release("task-1"))
+	_, ok := m.Get("task-1")
+	assert.False(t, ok)
+	assert.Nil(t, m.Shared())
+	assert.Equal(t, 0, m.Reconcile(func(string) bool { return false }))
+}
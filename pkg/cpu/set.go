@@ -0,0 +1,107 @@
+// Package cpu manages host CPUs for microVMs: the node's CPU and NUMA
+// topology, exclusive core allocation for pinned VMs, and Firecracker CPU
+// templates.
+package cpu
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Set is a sorted set of CPU or NUMA node IDs.
+type Set []int
+
+// NewSet creates a set from IDs in any order.
+func NewSet(ids ...int) Set {
+	seen := make(map[int]bool, len(ids))
+	s := make(Set, 0, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			s = append(s, id)
+		}
+	}
+	sort.Ints(s)
+	return s
+}
+
+// Parse parses the kernel list format, e.g. "0-3,8,10-11".
+func Parse(list string) (Set, error) {
+	list = strings.TrimSpace(list)
+	if list == "" {
+		return Set{}, nil
+	}
+
+	var ids []int
+	for _, part := range strings.Split(list, ",") {
+		lo, hi, isRange := strings.Cut(strings.TrimSpace(part), "-")
+		start, err := strconv.Atoi(lo)
+		if err != nil || start < 0 {
+			return nil, fmt.Errorf("invalid CPU list %q", list)
+		}
+		end := start
+		if isRange {
+			end, err = strconv.Atoi(hi)
+			if err != nil || end < start {
+				return nil, fmt.Errorf("invalid CPU list %q", list)
+			}
+		}
+		for id := start; id <= end; id++ {
+			ids = append(ids, id)
+		}
+	}
+	return NewSet(ids...), nil
+}
+
+// String formats the set in the kernel list format.
+func (s Set) String() string {
+	var parts []string
+	for i := 0; i < len(s); {
+		j := i
+		for j+1 < len(s) && s[j+1] == s[j]+1 {
+			j++
+		}
+		if i == j {
+			parts = append(parts, strconv.Itoa(s[i]))
+		} else {
+			parts = append(parts, fmt.Sprintf("%d-%d", s[i], s[j]))
+		}
+		i = j + 1
+	}
+	return strings.Join(parts, ",")
+}
+
+// Contains reports whether id is in the set.
+func (s Set) Contains(id int) bool {
+	i := sort.SearchInts(s, id)
+	return i < len(s) && s[i] == id
+}
+
+// Difference returns the IDs of s that are not in other.
+func (s Set) Difference(other Set) Set {
+	out := Set{}
+	for _, id := range s {
+		if !other.Contains(id) {
+			out = append(out, id)
+		}
+	}
+	return out
+}
+
+// Intersect returns the IDs in both sets.
+func (s Set) Intersect(other Set) Set {
+	out := Set{}
+	for _, id := range s {
+		if other.Contains(id) {
+			out = append(out, id)
+		}
+	}
+	return out
+}
+
+// Union returns the IDs in either set.
+func (s Set) Union(other Set) Set {
+	return NewSet(append(append([]int{}, s...), other...)...)
+}
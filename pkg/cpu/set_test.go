@@ -0,0 +1,56 @@
+package cpu
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		list    string
+		want    Set
+		wantErr bool
+	}{
+		{"", Set{}, false},
+		{"3", Set{3}, false},
+		{"0-3", Set{0, 1, 2, 3}, false},
+		{"0-1,4,6-7\n", Set{0, 1, 4, 6, 7}, false},
+		{"4,0-1,1", Set{0, 1, 4}, false},
+		{"a", nil, true},
+		{"3-1", nil, true},
+		{"-1", nil, true},
+		{"1,", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.list, func(t *testing.T) {
+			got, err := Parse(tt.list)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestSet_String(t *testing.T) {
+	assert.Equal(t, "", Set{}.String())
+	assert.Equal(t, "5", NewSet(5).String())
+	assert.Equal(t, "0-3,8,10-11", NewSet(11, 0, 1, 2, 3, 8, 10).String())
+}
+
+func TestSet_Operations(t *testing.T) {
+	a := NewSet(0, 1, 2, 3)
+	b := NewSet(2, 3, 4)
+
+	assert.True(t, a.Contains(2))
+	assert.False(t, a.Contains(4))
+	assert.Equal(t, Set{0, 1}, a.Difference(b))
+	assert.Equal(t, Set{2, 3}, a.Intersect(b))
+	assert.Equal(t, Set{0, 1, 2, 3, 4}, a.Union(b))
+	assert.Equal(t, Set{0, 1, 2, 3}, a, "operations must not modify the receiver")
+}
@@ -0,0 +1,62 @@
+package cpu
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+)
+
+// TemplateLabel is the service label that picks the Firecracker CPU
+// template of a service's VMs, overriding the node default. "None" turns
+// the node default off.
+const TemplateLabel = "swarmcracker.cpu.template"
+
+// StaticTemplates are the CPU templates built into Firecracker. Which ones
+// a host supports depends on its CPU vendor and generation.
+var StaticTemplates = []string{"C3", "T2", "T2S", "T2CL", "T2A", "V1N1"}
+
+// Template is a resolved CPU template: either a static template name for
+// the machine config, or a custom template file for PUT /cpu-config.
+type Template struct {
+	Static     string
+	CustomPath string
+}
+
+// IsZero reports whether no template applies.
+func (t Template) IsZero() bool {
+	return t.Static == "" && t.CustomPath == ""
+}
+
+// ResolveTemplate returns the template for a service with the given
+// labels. Names are static templates or keys of custom, which maps custom
+// template names to their JSON files.
+func ResolveTemplate(nodeDefault string, custom map[string]string, labels map[string]string) (Template, error) {
+	name := nodeDefault
+	if v, ok := labels[TemplateLabel]; ok && v != "" {
+		name = v
+	}
+
+	switch {
+	case name == "" || name == "None":
+		return Template{}, nil
+	case slices.Contains(StaticTemplates, name):
+		return Template{Static: name}, nil
+	case custom[name] != "":
+		return Template{CustomPath: custom[name]}, nil
+	}
+	return Template{}, fmt.Errorf("unknown CPU template %q", name)
+}
+
+// LoadCustomTemplate reads a custom CPU template file. The content is
+// passed to Firecracker unchanged; only its JSON syntax is checked.
+func LoadCustomTemplate(path string) (json.RawMessage, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CPU template: %w", err)
+	}
+	if !json.Valid(data) {
+		return nil, fmt.Errorf("CPU template %s is not valid JSON", path)
+	}
+	return json.RawMessage(data), nil
+}
@@ -0,0 +1,62 @@
+package cpu
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolveTemplate(t *testing.T) {
+	custom := map[string]string{"fleet": "/etc/swarmcracker/cpu/fleet.json"}
+
+	tests := []struct {
+		name        string
+		nodeDefault string
+		labels      map[string]string
+		want        Template
+		wantErr     bool
+	}{
+		{"none", "", nil, Template{}, false},
+		{"node default", "T2", nil, Template{Static: "T2"}, false},
+		{"label overrides default", "T2", map[string]string{TemplateLabel: "C3"}, Template{Static: "C3"}, false},
+		{"label turns default off", "T2", map[string]string{TemplateLabel: "None"}, Template{}, false},
+		{"empty label uses default", "T2S", map[string]string{TemplateLabel: ""}, Template{Static: "T2S"}, false},
+		{"custom", "", map[string]string{TemplateLabel: "fleet"}, Template{CustomPath: "/etc/swarmcracker/cpu/fleet.json"}, false},
+		{"unknown", "", map[string]string{TemplateLabel: "T9"}, Template{}, true},
+		{"unknown default", "T9", nil, Template{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ResolveTemplate(tt.nodeDefault, custom, tt.labels)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+			assert.Equal(t, tt.want == Template{}, got.IsZero())
+		})
+	}
+}
+
+func TestLoadCustomTemplate(t *testing.T) {
+	dir := t.TempDir()
+
+	valid := filepath.Join(dir, "valid.json")
+	require.NoError(t, os.WriteFile(valid, []byte(`{"cpuid_modifiers": []}`), 0644))
+	data, err := LoadCustomTemplate(valid)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"cpuid_modifiers": []}`, string(data))
+
+	invalid := filepath.Join(dir, "invalid.json")
+	require.NoError(t, os.WriteFile(invalid, []byte(`{"cpuid_modifiers": [`), 0644))
+	_, err = LoadCustomTemplate(invalid)
+	assert.Error(t, err)
+
+	_, err = LoadCustomTemplate(filepath.Join(dir, "missing.json"))
+	assert.Error(t, err)
+}
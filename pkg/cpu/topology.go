@@ -0,0 +1,75 @@
+package cpu
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// sysDir is the sysfs system devices root - overridable for testing
+var sysDir = "/sys/devices/system"
+
+// Topology maps each NUMA node to its online CPUs.
+type Topology struct {
+	Nodes map[int]Set
+}
+
+// CPUs returns all online CPUs.
+func (t Topology) CPUs() Set {
+	all := Set{}
+	for _, cpus := range t.Nodes {
+		all = all.Union(cpus)
+	}
+	return all
+}
+
+// NodeOf returns the NUMA node of a CPU, or -1.
+func (t Topology) NodeOf(cpu int) int {
+	for node, cpus := range t.Nodes {
+		if cpus.Contains(cpu) {
+			return node
+		}
+	}
+	return -1
+}
+
+// ReadTopology reads the online CPUs and their NUMA nodes from sysfs.
+// Kernels without NUMA support report all CPUs on node 0.
+func ReadTopology() (Topology, error) {
+	data, err := os.ReadFile(filepath.Join(sysDir, "cpu", "online"))
+	if err != nil {
+		return Topology{}, fmt.Errorf("failed to read online CPUs: %w", err)
+	}
+	online, err := Parse(string(data))
+	if err != nil {
+		return Topology{}, err
+	}
+
+	topo := Topology{Nodes: make(map[int]Set)}
+	nodeDirs, _ := filepath.Glob(filepath.Join(sysDir, "node", "node[0-9]*"))
+	for _, dir := range nodeDirs {
+		node, err := strconv.Atoi(strings.TrimPrefix(filepath.Base(dir), "node"))
+		if err != nil {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, "cpulist"))
+		if err != nil {
+			continue
+		}
+		cpus, err := Parse(string(data))
+		if err != nil {
+			return Topology{}, fmt.Errorf("node %d: %w", node, err)
+		}
+		// Offline CPUs stay listed on their node
+		if cpus = cpus.Intersect(online); len(cpus) > 0 {
+			topo.Nodes[node] = cpus
+		}
+	}
+
+	if len(topo.Nodes) == 0 {
+		topo.Nodes[0] = online
+	}
+	return topo, nil
+}
@@ -0,0 +1,66 @@
+package cpu
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeSysfs points sysDir at a temp dir with the given online CPUs and
+// per-node CPU lists
+func fakeSysfs(t *testing.T, online string, nodes map[string]string) {
+	t.Helper()
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "cpu"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "cpu", "online"), []byte(online+"\n"), 0644))
+	for node, cpulist := range nodes {
+		nodeDir := filepath.Join(dir, "node", node)
+		require.NoError(t, os.MkdirAll(nodeDir, 0755))
+		require.NoError(t, os.WriteFile(filepath.Join(nodeDir, "cpulist"), []byte(cpulist+"\n"), 0644))
+	}
+
+	orig := sysDir
+	sysDir = dir
+	t.Cleanup(func() { sysDir = orig })
+}
+
+func TestReadTopology(t *testing.T) {
+	t.Run("two nodes", func(t *testing.T) {
+		fakeSysfs(t, "0-7", map[string]string{"node0": "0-3", "node1": "4-7"})
+
+		topo, err := ReadTopology()
+		require.NoError(t, err)
+		assert.Equal(t, map[int]Set{0: {0, 1, 2, 3}, 1: {4, 5, 6, 7}}, topo.Nodes)
+		assert.Equal(t, Set{0, 1, 2, 3, 4, 5, 6, 7}, topo.CPUs())
+		assert.Equal(t, 1, topo.NodeOf(5))
+		assert.Equal(t, -1, topo.NodeOf(9))
+	})
+
+	t.Run("offline CPUs are dropped", func(t *testing.T) {
+		fakeSysfs(t, "0-2,4-5", map[string]string{"node0": "0-3", "node1": "4-7"})
+
+		topo, err := ReadTopology()
+		require.NoError(t, err)
+		assert.Equal(t, map[int]Set{0: {0, 1, 2}, 1: {4, 5}}, topo.Nodes)
+	})
+
+	t.Run("no NUMA", func(t *testing.T) {
+		fakeSysfs(t, "0-3", nil)
+
+		topo, err := ReadTopology()
+		require.NoError(t, err)
+		assert.Equal(t, map[int]Set{0: {0, 1, 2, 3}}, topo.Nodes)
+	})
+
+	t.Run("missing sysfs", func(t *testing.T) {
+		orig := sysDir
+		sysDir = filepath.Join(t.TempDir(), "missing")
+		t.Cleanup(func() { sysDir = orig })
+
+		_, err := ReadTopology()
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,302 @@
+// Package events provides the task lifecycle event bus: a bounded history
+// of recent events, live subscriptions, and a local socket API to query
+// both.
+package events
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/restuhaqza/swarmcracker/pkg/types"
+	"github.com/rs/zerolog/log"
+)
+
+// Type identifies what happened.
+type Type string
+
+// Lifecycle event types, in roughly the order a task goes through them.
+const (
+	ImagePullStart  Type = "image.pull.start"
+	ImagePullFinish Type = "image.pull.finish"
+	RootfsBuild     Type = "rootfs.build"
+	NetworkAttach   Type = "network.attach"
+	VMBoot          Type = "vm.boot"
+	VMHealthy       Type = "vm.healthy"
+	VMStop          Type = "vm.stop"
+	VMOOM           Type = "vm.oom"
+	VMCrash         Type = "vm.crash"
+	SnapshotCreate  Type = "snapshot.create"
+	SnapshotRestore Type = "snapshot.restore"
+)
+
+// DefaultHistory is the number of events a bus keeps by default.
+const DefaultHistory = 1024
+
+// DefaultSocket is where the agent serves the events API.
+const DefaultSocket = "/var/run/swarmcracker/events.sock"
+
+// Event is one lifecycle event.
+type Event struct {
+	ID         uint64            `json:"id"`
+	Time       time.Time         `json:"time"`
+	Type       Type              `json:"type"`
+	TaskID     string            `json:"task_id,omitempty"`
+	ServiceID  string            `json:"service_id,omitempty"`
+	Service    string            `json:"service,omitempty"`
+	Node       string            `json:"node,omitempty"`
+	Message    string            `json:"message,omitempty"`
+	Error      string            `json:"error,omitempty"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+}
+
+// Publisher accepts events.
+type Publisher interface {
+	Publish(Event)
+}
+
+// TaskEvent returns an event about task. A non-nil err is recorded as the
+// event's error.
+func TaskEvent(typ Type, task *types.Task, message string, err error) Event {
+	e := Event{Type: typ, Message: message}
+	if task != nil {
+		e.TaskID = task.ID
+		e.ServiceID = task.ServiceID
+		e.Service = task.ServiceName
+	}
+	if err != nil {
+		e.Error = err.Error()
+	}
+	return e
+}
+
+// Bus stores recent events in a ring buffer and fans them out to
+// subscribers. A nil *Bus discards events.
+type Bus struct {
+	node string
+
+	mu      sync.Mutex
+	history []Event // ring buffer
+	start   int     // index of the oldest event
+	size    int
+	seq     uint64
+	subs    map[*subscription]struct{}
+}
+
+type subscription struct {
+	filter Filter
+	ch     chan Event
+}
+
+// NewBus creates a bus that stamps events with node and keeps the last
+// history events (DefaultHistory if history <= 0).
+func NewBus(node string, history int) *Bus {
+	if history <= 0 {
+		history = DefaultHistory
+	}
+	return &Bus{
+		node:    node,
+		history: make([]Event, history),
+		subs:    make(map[*subscription]struct{}),
+	}
+}
+
+// Publish records an event and delivers it to matching subscribers. The ID
+// is assigned by the bus; Time and Node are filled in if empty. Subscribers
+// that are not keeping up miss the event rather than blocking the publisher.
+func (b *Bus) Publish(e Event) {
+	if b == nil {
+		return
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	if e.Node == "" {
+		e.Node = b.node
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.seq++
+	e.ID = b.seq
+
+	end := (b.start + b.size) % len(b.history)
+	b.history[end] = e
+	if b.size < len(b.history) {
+		b.size++
+	} else {
+		b.start = (b.start + 1) % len(b.history)
+	}
+
+	for sub := range b.subs {
+		if !sub.filter.Match(e) {
+			continue
+		}
+		select {
+		case sub.ch <- e:
+		default:
+			log.Warn().Str("type", string(e.Type)).Msg("Event subscriber is falling behind, dropping event")
+		}
+	}
+}
+
+// Recent returns the stored events matching f, oldest first.
+func (b *Bus) Recent(f Filter) []Event {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.recentLocked(f)
+}
+
+func (b *Bus) recentLocked(f Filter) []Event {
+	var out []Event
+	for i := 0; i < b.size; i++ {
+		e := b.history[(b.start+i)%len(b.history)]
+		if f.Match(e) {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+// Subscribe returns the stored events matching f and a channel of the
+// matching events published afterwards, with nothing lost or repeated in
+// between. Call cancel to unsubscribe; it closes the channel.
+func (b *Bus) Subscribe(f Filter) (history []Event, ch <-chan Event, cancel func()) {
+	sub := &subscription{filter: f, ch: make(chan Event, 64)}
+
+	b.mu.Lock()
+	history = b.recentLocked(f)
+	b.subs[sub] = struct{}{}
+	b.mu.Unlock()
+
+	var once sync.Once
+	cancel = func() {
+		once.Do(func() {
+			b.mu.Lock()
+			delete(b.subs, sub)
+			b.mu.Unlock()
+			close(sub.ch)
+		})
+	}
+	return history, sub.ch, cancel
+}
+
+// Filter selects events. Empty fields match everything.
+type Filter struct {
+	Task    string
+	Service string // service name or ID
+	Node    string
+	Types   []Type
+	Since   time.Time
+}
+
+// ParseFilter parses "key=value" filters as given to
+// `swarmcracker events --filter`. Keys are task, service, node and type;
+// type may be repeated.
+func ParseFilter(args []string) (Filter, error) {
+	var f Filter
+	for _, arg := range args {
+		key, value, ok := strings.Cut(arg, "=")
+		if !ok || value == "" {
+			return f, fmt.Errorf("invalid filter %q: expected key=value", arg)
+		}
+		switch key {
+		case "task":
+			f.Task = value
+		case "service":
+			f.Service = value
+		case "node":
+			f.Node = value
+		case "type", "event":
+			f.Types = append(f.Types, Type(value))
+		default:
+			return f, fmt.Errorf("unknown filter %q: use task, service, node or type", key)
+		}
+	}
+	return f, nil
+}
+
+// ParseSince parses a --since value: a duration before now ("10m"), an
+// RFC 3339 timestamp, or Unix seconds.
+func ParseSince(s string, now time.Time) (time.Time, error) {
+	if d, err := time.ParseDuration(s); err == nil {
+		return now.Add(-d), nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	if secs, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.Unix(secs, 0), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q: use a duration (10m), RFC 3339 or Unix seconds", s)
+}
+
+// Match reports whether e passes the filter.
+func (f Filter) Match(e Event) bool {
+	if f.Task != "" && e.TaskID != f.Task {
+		return false
+	}
+	if f.Service != "" && e.Service != f.Service && e.ServiceID != f.Service {
+		return false
+	}
+	if f.Node != "" && e.Node != f.Node {
+		return false
+	}
+	if !f.Since.IsZero() && e.Time.Before(f.Since) {
+		return false
+	}
+	if len(f.Types) == 0 {
+		return true
+	}
+	for _, t := range f.Types {
+		if e.Type == t {
+			return true
+		}
+	}
+	return false
+}
+
+// query encodes the filter as URL query parameters.
+func (f Filter) query() url.Values {
+	q := url.Values{}
+	if f.Task != "" {
+		q.Set("task", f.Task)
+	}
+	if f.Service != "" {
+		q.Set("service", f.Service)
+	}
+	if f.Node != "" {
+		q.Set("node", f.Node)
+	}
+	for _, t := range f.Types {
+		q.Add("type", string(t))
+	}
+	if !f.Since.IsZero() {
+		q.Set("since", f.Since.Format(time.RFC3339Nano))
+	}
+	return q
+}
+
+// filterFromQuery decodes URL query parameters written by query.
+func filterFromQuery(q url.Values) (Filter, error) {
+	f := Filter{
+		Task:    q.Get("task"),
+		Service: q.Get("service"),
+		Node:    q.Get("node"),
+	}
+	for _, t := range q["type"] {
+		f.Types = append(f.Types, Type(t))
+	}
+	if since := q.Get("since"); since != "" {
+		t, err := time.Parse(time.RFC3339Nano, since)
+		if err != nil {
+			return f, fmt.Errorf("invalid since: %w", err)
+		}
+		f.Since = t
+	}
+	return f, nil
+}
@@ -0,0 +1,123 @@
+package events
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/restuhaqza/swarmcracker/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBus_History(t *testing.T) {
+	b := NewBus("node-1", 3)
+	for i := 0; i < 5; i++ {
+		b.Publish(Event{Type: VMBoot, TaskID: string(rune('a' + i))})
+	}
+
+	got := b.Recent(Filter{})
+	require.Len(t, got, 3, "ring keeps only the newest events")
+	assert.Equal(t, "c", got[0].TaskID)
+	assert.Equal(t, "e", got[2].TaskID)
+	assert.Equal(t, uint64(5), got[2].ID)
+	assert.Equal(t, "node-1", got[2].Node)
+	assert.False(t, got[2].Time.IsZero())
+
+	var nilBus *Bus
+	nilBus.Publish(Event{Type: VMBoot})
+}
+
+func TestBus_Subscribe(t *testing.T) {
+	b := NewBus("node-1", 0)
+	b.Publish(Event{Type: VMBoot, Service: "web"})
+	b.Publish(Event{Type: VMBoot, Service: "db"})
+
+	history, ch, cancel := b.Subscribe(Filter{Service: "web"})
+	require.Len(t, history, 1)
+
+	b.Publish(Event{Type: VMCrash, Service: "db"})
+	b.Publish(Event{Type: VMCrash, Service: "web"})
+
+	select {
+	case e := <-ch:
+		assert.Equal(t, VMCrash, e.Type)
+		assert.Equal(t, "web", e.Service)
+	case <-time.After(time.Second):
+		t.Fatal("no event delivered")
+	}
+
+	cancel()
+	cancel() // idempotent
+	_, ok := <-ch
+	assert.False(t, ok)
+	b.Publish(Event{Type: VMStop, Service: "web"}) // no subscriber left
+}
+
+func TestFilter(t *testing.T) {
+	now := time.Now()
+	e := Event{Type: VMCrash, TaskID: "t1", ServiceID: "svc-1", Service: "web", Node: "n1", Time: now}
+
+	tests := []struct {
+		name   string
+		filter Filter
+		want   bool
+	}{
+		{"empty", Filter{}, true},
+		{"service name", Filter{Service: "web"}, true},
+		{"service id", Filter{Service: "svc-1"}, true},
+		{"other service", Filter{Service: "db"}, false},
+		{"task", Filter{Task: "t2"}, false},
+		{"node", Filter{Node: "n1"}, true},
+		{"types", Filter{Types: []Type{VMOOM, VMCrash}}, true},
+		{"other type", Filter{Types: []Type{VMBoot}}, false},
+		{"since before", Filter{Since: now.Add(-time.Minute)}, true},
+		{"since after", Filter{Since: now.Add(time.Minute)}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.filter.Match(e))
+
+			// The filter survives the trip through the socket API
+			decoded, err := filterFromQuery(tt.filter.query())
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, decoded.Match(e))
+		})
+	}
+}
+
+func TestParseFilter(t *testing.T) {
+	f, err := ParseFilter([]string{"service=web", "type=vm.crash", "type=vm.oom", "task=t1", "node=n1"})
+	require.NoError(t, err)
+	assert.Equal(t, Filter{Service: "web", Task: "t1", Node: "n1", Types: []Type{VMCrash, VMOOM}}, f)
+
+	_, err = ParseFilter([]string{"service"})
+	assert.Error(t, err)
+	_, err = ParseFilter([]string{"image=nginx"})
+	assert.Error(t, err)
+}
+
+func TestParseSince(t *testing.T) {
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	got, err := ParseSince("10m", now)
+	require.NoError(t, err)
+	assert.Equal(t, now.Add(-10*time.Minute), got)
+
+	got, err = ParseSince("2026-01-01T00:00:00Z", now)
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC), got)
+
+	got, err = ParseSince("1700000000", now)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1700000000), got.Unix())
+
+	_, err = ParseSince("yesterday", now)
+	assert.Error(t, err)
+}
+
+func TestTaskEvent(t *testing.T) {
+	task := &types.Task{ID: "t1", ServiceID: "svc-1", ServiceName: "web"}
+	e := TaskEvent(VMCrash, task, "VM exited", errors.New("exit status 1"))
+	assert.Equal(t, Event{Type: VMCrash, TaskID: "t1", ServiceID: "svc-1", Service: "web", Message: "VM exited", Error: "exit status 1"}, e)
+}
@@ -0,0 +1,233 @@
+package events
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Server serves a bus over a Unix socket:
+//
+//	GET  /events?task=&service=&node=&type=&since=[&follow=1]
+//	     matching events as newline-delimited JSON; with follow=1 the
+//	     response stays open and streams new events
+//	POST /events
+//	     publishes the JSON event in the body (used by local tools such as
+//	     `swarmcracker snapshot`)
+type Server struct {
+	bus        *Bus
+	socketPath string
+	srv        *http.Server
+	listener   net.Listener
+}
+
+// NewServer creates a server for bus on socketPath.
+func NewServer(bus *Bus, socketPath string) *Server {
+	s := &Server{bus: bus, socketPath: socketPath}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/events", s.handleEvents)
+	s.srv = &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	return s
+}
+
+// Start listens on the socket, replacing a stale one, and serves in the
+// background.
+func (s *Server) Start() error {
+	if err := os.MkdirAll(filepath.Dir(s.socketPath), 0755); err != nil {
+		return fmt.Errorf("failed to create events socket directory: %w", err)
+	}
+	if err := os.Remove(s.socketPath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove stale events socket: %w", err)
+	}
+
+	l, err := net.Listen("unix", s.socketPath)
+	if err != nil {
+		return fmt.Errorf("failed to listen on events socket: %w", err)
+	}
+	if err := os.Chmod(s.socketPath, 0660); err != nil {
+		l.Close()
+		return fmt.Errorf("failed to set events socket permissions: %w", err)
+	}
+	s.listener = l
+
+	go func() {
+		if err := s.srv.Serve(l); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Warn().Err(err).Msg("Events server failed")
+		}
+	}()
+	return nil
+}
+
+// Close stops the server and removes the socket.
+func (s *Server) Close() error {
+	err := s.srv.Close()
+	os.Remove(s.socketPath)
+	return err
+}
+
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.streamEvents(w, r)
+	case http.MethodPost:
+		var e Event
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10)).Decode(&e); err != nil {
+			http.Error(w, "invalid event: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if e.Type == "" {
+			http.Error(w, "invalid event: missing type", http.StatusBadRequest)
+			return
+		}
+		s.bus.Publish(e)
+		w.WriteHeader(http.StatusAccepted)
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *Server) streamEvents(w http.ResponseWriter, r *http.Request) {
+	f, err := filterFromQuery(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	enc := json.NewEncoder(w)
+
+	if r.URL.Query().Get("follow") != "1" {
+		for _, e := range s.bus.Recent(f) {
+			if err := enc.Encode(e); err != nil {
+				return
+			}
+		}
+		return
+	}
+
+	history, ch, cancel := s.bus.Subscribe(f)
+	defer cancel()
+
+	flusher, _ := w.(http.Flusher)
+	for _, e := range history {
+		if err := enc.Encode(e); err != nil {
+			return
+		}
+	}
+	if flusher != nil {
+		flusher.Flush()
+	}
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case e, ok := <-ch:
+			if !ok {
+				return
+			}
+			if err := enc.Encode(e); err != nil {
+				return
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+	}
+}
+
+// Client talks to an events server.
+type Client struct {
+	socketPath string
+	http       *http.Client
+}
+
+// NewClient returns a client for the server on socketPath.
+func NewClient(socketPath string) *Client {
+	return &Client{
+		socketPath: socketPath,
+		http: &http.Client{
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					var d net.Dialer
+					return d.DialContext(ctx, "unix", socketPath)
+				},
+			},
+		},
+	}
+}
+
+// Stream calls fn for every event matching f, oldest first. With follow it
+// keeps streaming new events until ctx is done or fn returns an error.
+func (c *Client) Stream(ctx context.Context, f Filter, follow bool, fn func(Event) error) error {
+	q := f.query()
+	if follow {
+		q.Set("follow", "1")
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://events/events?"+q.Encode(), nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to connect to events socket %s (is swarmd-firecracker running?): %w", c.socketPath, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		var msg bytes.Buffer
+		msg.ReadFrom(resp.Body)
+		return fmt.Errorf("events API returned %s: %s", resp.Status, bytes.TrimSpace(msg.Bytes()))
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64<<10), 1<<20)
+	for scanner.Scan() {
+		var e Event
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return fmt.Errorf("invalid event from server: %w", err)
+		}
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil && ctx.Err() == nil {
+		return err
+	}
+	return nil
+}
+
+// Publish sends an event to the server. It is best effort: failures, such
+// as no agent running, are logged at debug level and otherwise ignored.
+func (c *Client) Publish(e Event) {
+	body, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "http://events/events", bytes.NewReader(body))
+	if err != nil {
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		log.Debug().Err(err).Str("type", string(e.Type)).Msg("Event not published")
+		return
+	}
+	resp.Body.Close()
+}
@@ -0,0 +1,85 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func startServer(t *testing.T, bus *Bus) *Client {
+	t.Helper()
+	socket := filepath.Join(t.TempDir(), "events.sock")
+	srv := NewServer(bus, socket)
+	require.NoError(t, srv.Start())
+	t.Cleanup(func() { srv.Close() })
+	return NewClient(socket)
+}
+
+func TestServer_History(t *testing.T) {
+	bus := NewBus("node-1", 0)
+	client := startServer(t, bus)
+
+	bus.Publish(Event{Type: VMBoot, Service: "web"})
+	bus.Publish(Event{Type: VMBoot, Service: "db"})
+	client.Publish(Event{Type: SnapshotCreate, Service: "web", Message: "from CLI"})
+
+	var got []Event
+	err := client.Stream(context.Background(), Filter{Service: "web"}, false, func(e Event) error {
+		got = append(got, e)
+		return nil
+	})
+	require.NoError(t, err)
+	require.Len(t, got, 2)
+	assert.Equal(t, VMBoot, got[0].Type)
+	assert.Equal(t, SnapshotCreate, got[1].Type)
+	assert.Equal(t, "node-1", got[1].Node)
+}
+
+func TestServer_Follow(t *testing.T) {
+	bus := NewBus("node-1", 0)
+	client := startServer(t, bus)
+	bus.Publish(Event{Type: VMBoot, TaskID: "t1"})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	done := errors.New("done")
+	var got []Type
+	go func() {
+		// Publish once the stream is open and the history has arrived
+		for {
+			bus.mu.Lock()
+			n := len(bus.subs)
+			bus.mu.Unlock()
+			if n > 0 {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		bus.Publish(Event{Type: VMCrash, TaskID: "t2"})
+		bus.Publish(Event{Type: VMCrash, TaskID: "t1"})
+	}()
+
+	err := client.Stream(ctx, Filter{Task: "t1"}, true, func(e Event) error {
+		got = append(got, e.Type)
+		if len(got) == 2 {
+			return done
+		}
+		return nil
+	})
+	assert.ErrorIs(t, err, done)
+	assert.Equal(t, []Type{VMBoot, VMCrash}, got)
+}
+
+func TestClient_NoServer(t *testing.T) {
+	client := NewClient(filepath.Join(t.TempDir(), "missing.sock"))
+	client.Publish(Event{Type: VMBoot}) // best effort, no panic
+
+	err := client.Stream(context.Background(), Filter{}, false, func(Event) error { return nil })
+	assert.Error(t, err)
+}
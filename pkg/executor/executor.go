@@ -7,6 +7,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/restuhaqza/swarmcracker/pkg/image"
 	"github.com/restuhaqza/swarmcracker/pkg/network"
 	"github.com/restuhaqza/swarmcracker/pkg/types"
 	"github.com/rs/zerolog/log"
@@ -143,11 +144,7 @@ func (e *FirecrackerExecutor) Prepare(ctx context.Context, t *types.Task) error
 	}
 	rollbacks = append(rollbacks, func() {
 		log.Warn().Str("task_id", t.ID).Msg("Rolling back image preparation")
-		if rootfsPath, ok := t.Annotations["rootfs"]; ok && rootfsPath != "" {
-			if err := os.Remove(rootfsPath); err != nil && !os.IsNotExist(err) {
-				log.Error().Err(err).Str("path", rootfsPath).Msg("Failed to remove prepared rootfs")
-			}
-		}
+		e.removeTaskRootfs(t)
 	})
 
 	// 2. Prepare network interfaces
@@ -242,6 +239,18 @@ func (e *FirecrackerExecutor) Remove(ctx context.Context, t *types.Task) error {
 	return nil
 }
 
+// removeTaskRootfs deletes the private rootfs copy the image preparer made
+// for a task. The cached image the copy came from is shared and kept.
+func (e *FirecrackerExecutor) removeTaskRootfs(t *types.Task) {
+	rootfsPath := image.TaskRootfsPath(e.config.RootfsDir, t.ID)
+	if t.Annotations["rootfs"] != rootfsPath {
+		return
+	}
+	if err := os.Remove(rootfsPath); err != nil && !os.IsNotExist(err) {
+		log.Error().Err(err).Str("path", rootfsPath).Msg("Failed to remove task rootfs")
+	}
+}
+
 // Describe returns the current state of a task.
 func (e *FirecrackerExecutor) Describe(ctx context.Context, t *types.Task) (*types.TaskStatus, error) {
 	return e.vmmManager.Describe(ctx, t)
@@ -261,7 +270,7 @@ func (e *FirecrackerExecutor) Close() error {
 		close(e.events)
 	})
 
-	// Cleanup network resources (dnsmasq, VXLAN)
+	// Cleanup network resources (DHCP/DNS servers, VXLAN)
 	if nm, ok := e.networkMgr.(*network.NetworkManager); ok {
 		if err := nm.Shutdown(); err != nil {
 			log.Error().Err(err).Msg("Failed to shutdown network manager")
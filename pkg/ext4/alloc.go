@@ -0,0 +1,330 @@
+package ext4
+
+import "fmt"
+
+func testBit(b []byte, i uint32) bool { return b[i/8]&(1<<(i%8)) != 0 }
+func setBit(b []byte, i uint32)       { b[i/8] |= 1 << (i % 8) }
+func clearBit(b []byte, i uint32)     { b[i/8] &^= 1 << (i % 8) }
+
+// setBitsFrom marks the padding at the end of a bitmap block.
+func setBitsFrom(b []byte, from uint32) {
+	for i := from; i < uint32(len(b))*8; i++ {
+		setBit(b, i)
+	}
+}
+
+// uninitBG reports whether the group descriptor flags for lazily
+// initialised bitmaps are in use.
+func (e *Editor) uninitBG() bool {
+	return e.fs.sb.roCompat&(roCompatGdtCsum|roCompatMetadataCsum) != 0
+}
+
+// blockBitmap returns a group's block bitmap, building it for groups mkfs
+// left uninitialised.
+func (e *Editor) blockBitmap(g uint32) ([]byte, error) {
+	if b, ok := e.blockBitmaps[g]; ok {
+		return b, nil
+	}
+	gd := e.fs.groups[g]
+	var b []byte
+	if e.uninitBG() && gd.flags()&bgBlockUninit != 0 {
+		b = e.initBlockBitmap(g)
+		used := uint32(0)
+		for i := uint32(0); i < e.fs.sb.groupBlocks(g); i++ {
+			if testBit(b, i) {
+				used++
+			}
+		}
+		if e.fs.sb.groupBlocks(g)-used != gd.freeBlocks() {
+			return nil, fmt.Errorf("%w: uninitialised block bitmap of group %d", ErrUnsupported, g)
+		}
+	} else {
+		var err error
+		if b, err = e.fs.readBlock(gd.blockBitmap()); err != nil {
+			return nil, err
+		}
+	}
+	e.blockBitmaps[g] = b
+	return b, nil
+}
+
+// initBlockBitmap computes the block bitmap of a group holding only
+// metadata: its superblock and descriptor table backups and any group's
+// bitmaps and inode table placed in it.
+func (e *Editor) initBlockBitmap(g uint32) []byte {
+	sb := e.fs.sb
+	b := make([]byte, e.fs.bs)
+	first, count := sb.groupFirstBlock(g), uint64(sb.groupBlocks(g))
+	mark := func(start, n uint64) {
+		for blk := start; blk < start+n; blk++ {
+			if blk >= first && blk < first+count {
+				setBit(b, uint32(blk-first))
+			}
+		}
+	}
+	if sb.hasSuper(g) {
+		mark(first, 1+sb.gdtBlocks()+uint64(sb.reservedGdtBlocks))
+	}
+	tableBlocks := e.inodeTableBlocks()
+	for _, gd := range e.fs.groups {
+		mark(gd.blockBitmap(), 1)
+		mark(gd.inodeBitmap(), 1)
+		mark(gd.inodeTable(), tableBlocks)
+	}
+	setBitsFrom(b, uint32(count))
+	return b
+}
+
+// inodeTableBlocks returns the number of blocks of one group's inode table.
+func (e *Editor) inodeTableBlocks() uint64 {
+	size := uint64(e.fs.sb.inodesPerGroup) * uint64(e.fs.sb.inodeSize)
+	return (size + uint64(e.fs.bs) - 1) / uint64(e.fs.bs)
+}
+
+// inodeBitmap returns a group's inode bitmap.
+func (e *Editor) inodeBitmap(g uint32) ([]byte, error) {
+	if b, ok := e.inodeBitmaps[g]; ok {
+		return b, nil
+	}
+	gd := e.fs.groups[g]
+	var b []byte
+	if e.uninitBG() && gd.flags()&bgInodeUninit != 0 {
+		if gd.freeInodes() != e.fs.sb.inodesPerGroup {
+			return nil, fmt.Errorf("%w: uninitialised inode bitmap of group %d", ErrUnsupported, g)
+		}
+		b = make([]byte, e.fs.bs)
+		setBitsFrom(b, e.fs.sb.inodesPerGroup)
+	} else {
+		var err error
+		if b, err = e.fs.readBlock(gd.inodeBitmap()); err != nil {
+			return nil, err
+		}
+	}
+	e.inodeBitmaps[g] = b
+	return b, nil
+}
+
+// allocRun allocates up to n contiguous blocks, at goal or the first free
+// block after it. It returns the first block and how many were allocated.
+func (e *Editor) allocRun(n, goal uint64) (uint64, uint64, error) {
+	sb := e.fs.sb
+	if goal < uint64(sb.firstDataBlock) || goal >= sb.blocksCount {
+		goal = uint64(sb.firstDataBlock)
+	}
+	start := uint32((goal - uint64(sb.firstDataBlock)) / uint64(sb.blocksPerGroup))
+	// The goal's group is visited twice so the blocks before the goal are
+	// tried last.
+	for i := uint32(0); i <= sb.groupCount; i++ {
+		g := (start + i) % sb.groupCount
+		gd := e.fs.groups[g]
+		if gd.freeBlocks() == 0 {
+			continue
+		}
+		b, err := e.blockBitmap(g)
+		if err != nil {
+			return 0, 0, err
+		}
+		count := sb.groupBlocks(g)
+		bit := uint32(0)
+		if i == 0 {
+			bit = uint32(goal - sb.groupFirstBlock(g))
+		}
+		for ; bit < count; bit++ {
+			if bit%8 == 0 && b[bit/8] == 0xFF {
+				bit += 7
+				continue
+			}
+			if testBit(b, bit) {
+				continue
+			}
+			length := uint32(0)
+			for bit+length < count && uint64(length) < n && !testBit(b, bit+length) {
+				setBit(b, bit+length)
+				length++
+			}
+			gd.setFreeBlocks(gd.freeBlocks() - length)
+			if e.uninitBG() {
+				gd.setFlags(gd.flags() &^ bgBlockUninit)
+			}
+			e.dirtyGroups[g] = true
+			return sb.groupFirstBlock(g) + uint64(bit), uint64(length), nil
+		}
+	}
+	return 0, 0, ErrNoSpace
+}
+
+// freeBlocks returns n blocks from start to the free pool.
+func (e *Editor) freeBlocks(start, n uint64) error {
+	sb := e.fs.sb
+	for blk := start; blk < start+n; blk++ {
+		if blk < uint64(sb.firstDataBlock) || blk >= sb.blocksCount {
+			return corrupt("freeing block %d outside the file system", blk)
+		}
+		g := uint32((blk - uint64(sb.firstDataBlock)) / uint64(sb.blocksPerGroup))
+		b, err := e.blockBitmap(g)
+		if err != nil {
+			return err
+		}
+		bit := uint32(blk - sb.groupFirstBlock(g))
+		if !testBit(b, bit) {
+			return corrupt("freeing free block %d", blk)
+		}
+		clearBit(b, bit)
+		gd := e.fs.groups[g]
+		gd.setFreeBlocks(gd.freeBlocks() + 1)
+		e.dirtyGroups[g] = true
+	}
+	return nil
+}
+
+// allocInode allocates an inode, preferring the goal group.
+func (e *Editor) allocInode(goal uint32, dir bool) (uint32, error) {
+	sb := e.fs.sb
+	ipg := sb.inodesPerGroup
+	for i := uint32(0); i < sb.groupCount; i++ {
+		g := (goal + i) % sb.groupCount
+		gd := e.fs.groups[g]
+		if gd.freeInodes() == 0 {
+			continue
+		}
+		b, err := e.inodeBitmap(g)
+		if err != nil {
+			return 0, err
+		}
+		for bit := uint32(0); bit < ipg; bit++ {
+			if bit%8 == 0 && b[bit/8] == 0xFF {
+				bit += 7
+				continue
+			}
+			num := g*ipg + bit + 1
+			if num < sb.firstIno || testBit(b, bit) {
+				continue
+			}
+			setBit(b, bit)
+			gd.setFreeInodes(gd.freeInodes() - 1)
+			if dir {
+				gd.setUsedDirs(gd.usedDirs() + 1)
+			}
+			if e.uninitBG() {
+				gd.setFlags(gd.flags() &^ bgInodeUninit)
+				if bit >= ipg-gd.itableUnused() {
+					gd.setItableUnused(ipg - bit - 1)
+				}
+			}
+			e.dirtyGroups[g] = true
+			return num, nil
+		}
+	}
+	return 0, ErrNoSpace
+}
+
+// freeInode returns an inode to the free pool.
+func (e *Editor) freeInode(num uint32, dir bool) error {
+	ipg := e.fs.sb.inodesPerGroup
+	g, bit := (num-1)/ipg, (num-1)%ipg
+	b, err := e.inodeBitmap(g)
+	if err != nil {
+		return err
+	}
+	if !testBit(b, bit) {
+		return corrupt("freeing free inode %d", num)
+	}
+	clearBit(b, bit)
+	gd := e.fs.groups[g]
+	gd.setFreeInodes(gd.freeInodes() + 1)
+	if dir {
+		gd.setUsedDirs(gd.usedDirs() - 1)
+	}
+	e.dirtyGroups[g] = true
+	return nil
+}
+
+// commit writes the changed metadata: directory and extent blocks, inodes,
+// bitmaps, group descriptors and finally the superblock.
+func (e *Editor) commit() error {
+	fsys, sb := e.fs, e.fs.sb
+	for n, d := range fsys.blocks {
+		switch d.kind {
+		case blockDir:
+			fsys.setDirBlockChecksum(d.data, d.owner)
+		case blockExtent:
+			fsys.setExtentBlockChecksum(d.data, d.owner)
+		}
+		if _, err := e.f.WriteAt(d.data, int64(n)*fsys.bs); err != nil {
+			return err
+		}
+	}
+	for num, in := range fsys.inodes {
+		fsys.setInodeChecksum(in)
+		off, err := fsys.inodeOffset(num)
+		if err != nil {
+			return err
+		}
+		if _, err := e.f.WriteAt(in.raw, off); err != nil {
+			return err
+		}
+	}
+
+	for g := range e.dirtyGroups {
+		gd := fsys.groups[g]
+		bb, err := e.blockBitmap(g)
+		if err != nil {
+			return err
+		}
+		ib, err := e.inodeBitmap(g)
+		if err != nil {
+			return err
+		}
+		if _, err := e.f.WriteAt(bb, int64(gd.blockBitmap())*fsys.bs); err != nil {
+			return err
+		}
+		if _, err := e.f.WriteAt(ib, int64(gd.inodeBitmap())*fsys.bs); err != nil {
+			return err
+		}
+		fsys.setBitmapChecksums(gd, bb, ib)
+		fsys.setGroupChecksum(g, gd.raw)
+	}
+	ds := int(sb.descSize)
+	gdt := make([]byte, sb.gdtBlocks()*uint64(fsys.bs))
+	var freeBlocks uint64
+	var freeInodes uint32
+	for g, gd := range fsys.groups {
+		copy(gdt[g*ds:], gd.raw)
+		freeBlocks += uint64(gd.freeBlocks())
+		freeInodes += gd.freeInodes()
+	}
+
+	le.PutUint32(sb.raw[0xC:], uint32(freeBlocks))
+	if sb.incompat&incompat64Bit != 0 {
+		le.PutUint32(sb.raw[0x158:], uint32(freeBlocks>>32))
+	}
+	le.PutUint32(sb.raw[0x10:], freeInodes)
+	le.PutUint32(sb.raw[0x30:], uint32(e.now.Unix()))
+
+	groups := []uint32{0}
+	if e.backups {
+		for g := uint32(1); g < sb.groupCount; g++ {
+			if sb.hasSuper(g) {
+				groups = append(groups, g)
+			}
+		}
+	}
+	// Backups go first so the primary superblock is the last write.
+	for i := len(groups) - 1; i >= 0; i-- {
+		g := groups[i]
+		first := sb.groupFirstBlock(g)
+		if _, err := e.f.WriteAt(gdt, int64(first+1)*fsys.bs); err != nil {
+			return err
+		}
+		le.PutUint16(sb.raw[0x5A:], uint16(g))
+		sb.setChecksum()
+		off := int64(first) * fsys.bs
+		if g == 0 {
+			off = superblockOffset
+		}
+		if _, err := e.f.WriteAt(sb.raw, off); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+package ext4
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+)
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// crc32c continues an ext4 crc32c: the raw CRC, without the pre- and
+// post-inversion hash/crc32 applies.
+func crc32c(crc uint32, p []byte) uint32 {
+	return ^crc32.Update(^crc, castagnoli, p)
+}
+
+// crc32cUint32 continues an ext4 crc32c over a little-endian uint32.
+func crc32cUint32(crc, v uint32) uint32 {
+	var b [4]byte
+	binary.LittleEndian.PutUint32(b[:], v)
+	return crc32c(crc, b[:])
+}
+
+// crc16 continues the CRC-16 (reflected 0x8005) of gdt_csum group
+// descriptors.
+func crc16(crc uint16, p []byte) uint16 {
+	for _, b := range p {
+		crc ^= uint16(b)
+		for i := 0; i < 8; i++ {
+			if crc&1 != 0 {
+				crc = crc>>1 ^ 0xA001
+			} else {
+				crc >>= 1
+			}
+		}
+	}
+	return crc
+}
+
+// csumSeed returns the seed of an image's metadata checksums.
+func (sb *superblock) csumSeed() uint32 {
+	if sb.incompat&incompatCsumSeed != 0 {
+		return binary.LittleEndian.Uint32(sb.raw[0x270:])
+	}
+	return crc32c(^uint32(0), sb.uuid[:])
+}
+
+// metadataCsum reports whether the image has crc32c metadata checksums.
+func (sb *superblock) metadataCsum() bool {
+	return sb.roCompat&roCompatMetadataCsum != 0
+}
+
+// inodeSeed returns the checksum seed of an inode's metadata: its inode
+// table entry, directory blocks and extent tree blocks.
+func (fsys *fsys) inodeSeed(num, generation uint32) uint32 {
+	return crc32cUint32(crc32cUint32(fsys.seed, num), generation)
+}
+
+// setInodeChecksum stores an inode's checksum in its raw bytes.
+func (fsys *fsys) setInodeChecksum(in *inode) {
+	if !fsys.sb.metadataCsum() {
+		return
+	}
+	raw := in.raw
+	binary.LittleEndian.PutUint16(raw[0x7C:], 0)
+	hasHi := len(raw) > goodOldInodeLen && in.extraIsize() >= 4
+	if hasHi {
+		binary.LittleEndian.PutUint16(raw[0x82:], 0)
+	}
+	csum := crc32c(fsys.inodeSeed(in.num, in.generation()), raw)
+	binary.LittleEndian.PutUint16(raw[0x7C:], uint16(csum))
+	if hasHi {
+		binary.LittleEndian.PutUint16(raw[0x82:], uint16(csum>>16))
+	}
+}
+
+// setDirBlockChecksum stores the checksum in a directory block's tail.
+func (fsys *fsys) setDirBlockChecksum(block []byte, owner *inode) {
+	if !fsys.sb.metadataCsum() {
+		return
+	}
+	tail := len(block) - dirTailLen
+	csum := crc32c(fsys.inodeSeed(owner.num, owner.generation()), block[:tail])
+	binary.LittleEndian.PutUint32(block[tail+8:], csum)
+}
+
+// setExtentBlockChecksum stores the checksum after an extent tree block's
+// entries.
+func (fsys *fsys) setExtentBlockChecksum(block []byte, owner *inode) {
+	if !fsys.sb.metadataCsum() {
+		return
+	}
+	off := extentEntryLen + extentEntryLen*int(binary.LittleEndian.Uint16(block[4:]))
+	csum := crc32c(fsys.inodeSeed(owner.num, owner.generation()), block[:off])
+	binary.LittleEndian.PutUint32(block[off:], csum)
+}
+
+// setBitmapChecksums stores a group's bitmap checksums in its descriptor.
+func (fsys *fsys) setBitmapChecksums(gd groupDesc, blockBitmap, inodeBitmap []byte) {
+	if !fsys.sb.metadataCsum() {
+		return
+	}
+	gd.setBitmapChecksums(
+		crc32c(fsys.seed, blockBitmap[:fsys.sb.blocksPerGroup/8]),
+		crc32c(fsys.seed, inodeBitmap[:fsys.sb.inodesPerGroup/8]),
+	)
+}
+
+// setGroupChecksum stores a group descriptor's checksum in its raw bytes.
+func (fsys *fsys) setGroupChecksum(group uint32, raw []byte) {
+	binary.LittleEndian.PutUint16(raw[0x1E:], 0)
+	switch {
+	case fsys.sb.metadataCsum():
+		csum := crc32c(crc32cUint32(fsys.seed, group), raw)
+		binary.LittleEndian.PutUint16(raw[0x1E:], uint16(csum))
+	case fsys.sb.roCompat&roCompatGdtCsum != 0:
+		var g [4]byte
+		binary.LittleEndian.PutUint32(g[:], group)
+		crc := crc16(crc16(0xFFFF, fsys.sb.uuid[:]), g[:])
+		crc = crc16(crc16(crc, raw[:0x1E]), raw[0x20:])
+		binary.LittleEndian.PutUint16(raw[0x1E:], crc)
+	}
+}
+
+// setChecksum stores the superblock's checksum in its raw bytes.
+func (sb *superblock) setChecksum() {
+	if sb.metadataCsum() {
+		binary.LittleEndian.PutUint32(sb.raw[0x3FC:], crc32c(^uint32(0), sb.raw[:0x3FC]))
+	}
+}
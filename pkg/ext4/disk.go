@@ -0,0 +1,335 @@
+package ext4
+
+import (
+	"encoding/binary"
+	"fmt"
+	"time"
+)
+
+var le = binary.LittleEndian
+
+// superblock holds the geometry of an image. Fields that change while an
+// image is edited are written straight into raw on commit.
+type superblock struct {
+	raw []byte
+
+	blockSize         uint32
+	blocksCount       uint64
+	inodesCount       uint32
+	firstDataBlock    uint32
+	blocksPerGroup    uint32
+	inodesPerGroup    uint32
+	inodeSize         uint16
+	firstIno          uint32
+	compat            uint32
+	incompat          uint32
+	roCompat          uint32
+	uuid              [16]byte
+	descSize          uint16
+	reservedGdtBlocks uint16
+	groupCount        uint32
+}
+
+// parseSuperblock decodes and sanity checks a raw superblock.
+func parseSuperblock(raw []byte) (*superblock, error) {
+	if len(raw) < superblockSize || le.Uint16(raw[0x38:]) != superMagic {
+		return nil, fmt.Errorf("not an ext4 image: bad superblock magic")
+	}
+	sb := &superblock{raw: raw}
+	logBlockSize := le.Uint32(raw[0x18:])
+	if logBlockSize > 6 {
+		return nil, fmt.Errorf("invalid block size 2^%d KiB", logBlockSize)
+	}
+	sb.blockSize = 1024 << logBlockSize
+	sb.inodesCount = le.Uint32(raw[0x0:])
+	sb.blocksCount = uint64(le.Uint32(raw[0x4:]))
+	sb.firstDataBlock = le.Uint32(raw[0x14:])
+	sb.blocksPerGroup = le.Uint32(raw[0x20:])
+	sb.inodesPerGroup = le.Uint32(raw[0x28:])
+	sb.compat = le.Uint32(raw[0x5C:])
+	sb.incompat = le.Uint32(raw[0x60:])
+	sb.roCompat = le.Uint32(raw[0x64:])
+	copy(sb.uuid[:], raw[0x68:0x78])
+	sb.reservedGdtBlocks = le.Uint16(raw[0xCE:])
+
+	sb.inodeSize, sb.firstIno = goodOldInodeLen, 11
+	if le.Uint32(raw[0x4C:]) > 0 {
+		sb.inodeSize = le.Uint16(raw[0x58:])
+		sb.firstIno = le.Uint32(raw[0x54:])
+	}
+	sb.descSize = 32
+	if sb.incompat&incompat64Bit != 0 {
+		sb.blocksCount |= uint64(le.Uint32(raw[0x150:])) << 32
+		sb.descSize = le.Uint16(raw[0xFE:])
+	}
+
+	switch {
+	case sb.inodeSize < goodOldInodeLen || sb.inodeSize&(sb.inodeSize-1) != 0 || uint32(sb.inodeSize) > sb.blockSize:
+		return nil, fmt.Errorf("invalid inode size %d", sb.inodeSize)
+	case sb.descSize < 32 || sb.descSize&(sb.descSize-1) != 0 || uint32(sb.descSize) > sb.blockSize:
+		return nil, fmt.Errorf("invalid group descriptor size %d", sb.descSize)
+	case sb.blocksPerGroup == 0 || sb.blocksPerGroup > 8*sb.blockSize:
+		return nil, fmt.Errorf("invalid blocks per group %d", sb.blocksPerGroup)
+	case sb.inodesPerGroup == 0 || sb.inodesPerGroup > 8*sb.blockSize:
+		return nil, fmt.Errorf("invalid inodes per group %d", sb.inodesPerGroup)
+	case sb.blocksCount <= uint64(sb.firstDataBlock):
+		return nil, fmt.Errorf("invalid block count %d", sb.blocksCount)
+	}
+	if unknown := sb.incompat &^ readIncompat; unknown != 0 {
+		return nil, fmt.Errorf("%w: incompatible features %#x", ErrUnsupported, unknown)
+	}
+	groups := (sb.blocksCount - uint64(sb.firstDataBlock) + uint64(sb.blocksPerGroup) - 1) / uint64(sb.blocksPerGroup)
+	if uint64(sb.inodesPerGroup)*groups != uint64(sb.inodesCount) {
+		return nil, fmt.Errorf("inode count %d does not match %d groups", sb.inodesCount, groups)
+	}
+	sb.groupCount = uint32(groups)
+	return sb, nil
+}
+
+// label returns the volume label.
+func (sb *superblock) label() string {
+	name := sb.raw[0x78:0x88]
+	for i, c := range name {
+		if c == 0 {
+			return string(name[:i])
+		}
+	}
+	return string(name)
+}
+
+// hasSuper reports whether a group holds a backup of the superblock and
+// group descriptor table.
+func (sb *superblock) hasSuper(group uint32) bool {
+	switch {
+	case group == 0:
+		return true
+	case sb.compat&compatSparseSuper2 != 0:
+		return group == le.Uint32(sb.raw[0x24C:]) || group == le.Uint32(sb.raw[0x250:])
+	case sb.roCompat&roCompatSparseSuper == 0 || group == 1:
+		return true
+	}
+	for _, base := range []uint32{3, 5, 7} {
+		n := group
+		for n%base == 0 {
+			n /= base
+		}
+		if n == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// gdtBlocks returns the number of blocks the group descriptor table uses.
+func (sb *superblock) gdtBlocks() uint64 {
+	size := uint64(sb.groupCount) * uint64(sb.descSize)
+	return (size + uint64(sb.blockSize) - 1) / uint64(sb.blockSize)
+}
+
+// groupFirstBlock returns the first block of a group.
+func (sb *superblock) groupFirstBlock(group uint32) uint64 {
+	return uint64(sb.firstDataBlock) + uint64(group)*uint64(sb.blocksPerGroup)
+}
+
+// groupBlocks returns the number of blocks in a group; the last group may
+// be short.
+func (sb *superblock) groupBlocks(group uint32) uint32 {
+	if group == sb.groupCount-1 {
+		return uint32(sb.blocksCount - sb.groupFirstBlock(group))
+	}
+	return sb.blocksPerGroup
+}
+
+// groupDesc is a block group descriptor, kept as its raw on-disk bytes.
+type groupDesc struct {
+	raw []byte
+}
+
+func (gd groupDesc) wide() bool { return len(gd.raw) >= 64 }
+
+func (gd groupDesc) get32(lo, hi int) uint64 {
+	v := uint64(le.Uint32(gd.raw[lo:]))
+	if gd.wide() {
+		v |= uint64(le.Uint32(gd.raw[hi:])) << 32
+	}
+	return v
+}
+
+func (gd groupDesc) get16(lo, hi int) uint32 {
+	v := uint32(le.Uint16(gd.raw[lo:]))
+	if gd.wide() {
+		v |= uint32(le.Uint16(gd.raw[hi:])) << 16
+	}
+	return v
+}
+
+func (gd groupDesc) set32(lo, hi int, v uint64) {
+	le.PutUint32(gd.raw[lo:], uint32(v))
+	if gd.wide() {
+		le.PutUint32(gd.raw[hi:], uint32(v>>32))
+	}
+}
+
+func (gd groupDesc) set16(lo, hi int, v uint32) {
+	le.PutUint16(gd.raw[lo:], uint16(v))
+	if gd.wide() {
+		le.PutUint16(gd.raw[hi:], uint16(v>>16))
+	}
+}
+
+func (gd groupDesc) blockBitmap() uint64 { return gd.get32(0x0, 0x20) }
+func (gd groupDesc) inodeBitmap() uint64 { return gd.get32(0x4, 0x24) }
+func (gd groupDesc) inodeTable() uint64  { return gd.get32(0x8, 0x28) }
+func (gd groupDesc) freeBlocks() uint32  { return gd.get16(0xC, 0x2C) }
+func (gd groupDesc) freeInodes() uint32  { return gd.get16(0xE, 0x2E) }
+func (gd groupDesc) usedDirs() uint32    { return gd.get16(0x10, 0x30) }
+func (gd groupDesc) flags() uint16       { return le.Uint16(gd.raw[0x12:]) }
+func (gd groupDesc) itableUnused() uint32 {
+	return gd.get16(0x1C, 0x32)
+}
+
+func (gd groupDesc) setBlockBitmap(v uint64)  { gd.set32(0x0, 0x20, v) }
+func (gd groupDesc) setInodeBitmap(v uint64)  { gd.set32(0x4, 0x24, v) }
+func (gd groupDesc) setInodeTable(v uint64)   { gd.set32(0x8, 0x28, v) }
+func (gd groupDesc) setFreeBlocks(v uint32)   { gd.set16(0xC, 0x2C, v) }
+func (gd groupDesc) setFreeInodes(v uint32)   { gd.set16(0xE, 0x2E, v) }
+func (gd groupDesc) setUsedDirs(v uint32)     { gd.set16(0x10, 0x30, v) }
+func (gd groupDesc) setFlags(v uint16)        { le.PutUint16(gd.raw[0x12:], v) }
+func (gd groupDesc) setItableUnused(v uint32) { gd.set16(0x1C, 0x32, v) }
+
+// setBitmapChecksums stores the crc32c checksums of a group's bitmaps.
+func (gd groupDesc) setBitmapChecksums(blockCsum, inodeCsum uint32) {
+	le.PutUint16(gd.raw[0x18:], uint16(blockCsum))
+	le.PutUint16(gd.raw[0x1A:], uint16(inodeCsum))
+	if gd.wide() {
+		le.PutUint16(gd.raw[0x38:], uint16(blockCsum>>16))
+		le.PutUint16(gd.raw[0x3A:], uint16(inodeCsum>>16))
+	}
+}
+
+// inode is an inode table entry, kept as its raw on-disk bytes so fields
+// this package does not know about, such as in-inode extended attributes,
+// survive an edit.
+type inode struct {
+	num uint32
+	raw []byte
+}
+
+func (in *inode) mode() uint16       { return le.Uint16(in.raw[0x0:]) }
+func (in *inode) links() uint16      { return le.Uint16(in.raw[0x1A:]) }
+func (in *inode) flags() uint32      { return le.Uint32(in.raw[0x20:]) }
+func (in *inode) generation() uint32 { return le.Uint32(in.raw[0x64:]) }
+func (in *inode) fileACL() uint64 {
+	return uint64(le.Uint32(in.raw[0x68:])) | uint64(le.Uint16(in.raw[0x76:]))<<32
+}
+func (in *inode) blockData() []byte { return in.raw[0x28:0x64] }
+
+func (in *inode) isDir() bool     { return in.mode()&modeType == modeDir }
+func (in *inode) isSymlink() bool { return in.mode()&modeType == modeLink }
+func (in *inode) isRegular() bool { return in.mode()&modeType == modeFile }
+
+func (in *inode) uid() uint32 {
+	return uint32(le.Uint16(in.raw[0x2:])) | uint32(le.Uint16(in.raw[0x78:]))<<16
+}
+
+func (in *inode) gid() uint32 {
+	return uint32(le.Uint16(in.raw[0x18:])) | uint32(le.Uint16(in.raw[0x7A:]))<<16
+}
+
+func (in *inode) size() int64 {
+	return int64(uint64(le.Uint32(in.raw[0x4:])) | uint64(le.Uint32(in.raw[0x6C:]))<<32)
+}
+
+// sectors returns i_blocks in 512-byte units.
+func (in *inode) sectors(blockSize uint32) uint64 {
+	n := uint64(le.Uint32(in.raw[0x1C:])) | uint64(le.Uint16(in.raw[0x74:]))<<32
+	if in.flags()&flagHugeFile != 0 {
+		n *= uint64(blockSize / 512)
+	}
+	return n
+}
+
+// extraIsize returns the size of the fields past the first 128 bytes.
+func (in *inode) extraIsize() uint16 {
+	if len(in.raw) <= goodOldInodeLen {
+		return 0
+	}
+	return le.Uint16(in.raw[0x80:])
+}
+
+// hasExtra reports whether an extra field at off fits in the inode.
+func (in *inode) hasExtra(off int) bool {
+	return int(in.extraIsize()) >= off+4-goodOldInodeLen
+}
+
+func (in *inode) setMode(v uint16)  { le.PutUint16(in.raw[0x0:], v) }
+func (in *inode) setLinks(v uint16) { le.PutUint16(in.raw[0x1A:], v) }
+func (in *inode) setFlags(v uint32) { le.PutUint32(in.raw[0x20:], v) }
+func (in *inode) setDtime(v uint32) { le.PutUint32(in.raw[0x14:], v) }
+func (in *inode) setExtraIsize(v uint16) {
+	le.PutUint16(in.raw[0x80:], v)
+}
+
+func (in *inode) setOwner(uid, gid uint32) {
+	le.PutUint16(in.raw[0x2:], uint16(uid))
+	le.PutUint16(in.raw[0x78:], uint16(uid>>16))
+	le.PutUint16(in.raw[0x18:], uint16(gid))
+	le.PutUint16(in.raw[0x7A:], uint16(gid>>16))
+}
+
+func (in *inode) setSize(v int64) {
+	le.PutUint32(in.raw[0x4:], uint32(v))
+	le.PutUint32(in.raw[0x6C:], uint32(uint64(v)>>32))
+}
+
+func (in *inode) setSectors(v uint64) {
+	le.PutUint32(in.raw[0x1C:], uint32(v))
+	le.PutUint16(in.raw[0x74:], uint16(v>>32))
+	in.setFlags(in.flags() &^ flagHugeFile)
+}
+
+// Timestamp offsets: the seconds field and its nanosecond/epoch extension.
+const (
+	timeAccess = iota
+	timeChange
+	timeModify
+	timeCreate
+)
+
+var timeOffsets = [...][2]int{
+	timeAccess: {0x08, 0x8C},
+	timeChange: {0x0C, 0x84},
+	timeModify: {0x10, 0x88},
+	timeCreate: {0x90, 0x94},
+}
+
+// time returns one of an inode's timestamps.
+func (in *inode) time(which int) time.Time {
+	off := timeOffsets[which]
+	if which == timeCreate && !in.hasExtra(off[0]) {
+		return time.Time{}
+	}
+	sec := int64(int32(le.Uint32(in.raw[off[0]:])))
+	var nsec int64
+	if in.hasExtra(off[1]) {
+		extra := le.Uint32(in.raw[off[1]:])
+		sec += int64(extra&3) << 32
+		nsec = int64(extra >> 2)
+	}
+	return time.Unix(sec, nsec)
+}
+
+// setTime stores one of an inode's timestamps, with nanoseconds when the
+// inode has room for them.
+func (in *inode) setTime(which int, t time.Time) {
+	off := timeOffsets[which]
+	if which == timeCreate && !in.hasExtra(off[0]) {
+		return
+	}
+	sec := t.Unix()
+	le.PutUint32(in.raw[off[0]:], uint32(sec))
+	if in.hasExtra(off[1]) {
+		epoch := uint32((sec-int64(int32(sec)))>>32) & 3
+		le.PutUint32(in.raw[off[1]:], epoch|uint32(t.Nanosecond())<<2)
+	}
+}
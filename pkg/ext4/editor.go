@@ -0,0 +1,848 @@
+package ext4
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Editor adds files to an image. File data is written as it is added;
+// inodes, directories, bitmaps and group descriptors are kept in memory
+// and written by Close, so an Editor that fails part way leaves the image
+// as it was. Any error from Add is sticky and makes Close return it
+// without committing.
+type Editor struct {
+	f   *os.File
+	fs  *fsys
+	now time.Time
+
+	blockBitmaps map[uint32][]byte
+	inodeBitmaps map[uint32][]byte
+	dirtyGroups  map[uint32]bool
+	// backups makes commit rewrite the backup superblocks and descriptor
+	// tables, which only a freshly formatted image needs
+	backups bool
+	goal    uint64
+	err     error
+	closed  bool
+}
+
+// openEditor opens an existing image for editing. Images using features
+// the Editor cannot keep consistent fail with ErrUnsupported.
+func openEditor(path string) (*Editor, error) {
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+	fsys, err := openFS(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	sb := fsys.sb
+	switch {
+	case sb.incompat&incompatExtents == 0:
+		err = fmt.Errorf("%w: image without extents", ErrUnsupported)
+	case sb.incompat&^editIncompat != 0:
+		err = fmt.Errorf("%w: incompatible features %#x", ErrUnsupported, sb.incompat&^editIncompat)
+	case sb.roCompat&^editROCompat != 0:
+		err = fmt.Errorf("%w: read-only compatible features %#x", ErrUnsupported, sb.roCompat&^editROCompat)
+	case le.Uint16(sb.raw[0x3A:])&1 == 0 || le.Uint32(sb.raw[0xE8:]) != 0:
+		err = fmt.Errorf("ext4 image %s is mounted or was not cleanly unmounted", path)
+	}
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return newEditor(f, fsys), nil
+}
+
+func newEditor(f *os.File, fsys *fsys) *Editor {
+	fsys.dirs = make(map[uint32]map[string]dirent)
+	return &Editor{
+		f:            f,
+		fs:           fsys,
+		now:          time.Now(),
+		blockBitmaps: make(map[uint32][]byte),
+		inodeBitmaps: make(map[uint32][]byte),
+		dirtyGroups:  make(map[uint32]bool),
+	}
+}
+
+// Add adds one entry in the form of a tar header: a regular file read from
+// r, a directory, symlink, hard link, device node or FIFO. Missing parent
+// directories are created with mode 0755 and owned by root. An existing
+// entry of the same name is replaced, except that a directory is only
+// updated in place and never replaced by something else.
+func (e *Editor) Add(hdr *tar.Header, r io.Reader) error {
+	if e.err != nil {
+		return e.err
+	}
+	if e.closed {
+		return fs.ErrClosed
+	}
+	if err := e.add(hdr, r); err != nil {
+		e.err = fmt.Errorf("failed to add %s: %w", hdr.Name, err)
+		return e.err
+	}
+	return nil
+}
+
+// Close commits the changes and closes the image.
+func (e *Editor) Close() error {
+	if e.closed {
+		return nil
+	}
+	e.closed = true
+	if e.err != nil {
+		e.f.Close()
+		return e.err
+	}
+	if err := e.commit(); err != nil {
+		e.f.Close()
+		return fmt.Errorf("failed to write ext4 metadata: %w", err)
+	}
+	if err := e.f.Sync(); err != nil {
+		e.f.Close()
+		return err
+	}
+	return e.f.Close()
+}
+
+// abort closes the image without committing.
+func (e *Editor) abort() {
+	if !e.closed {
+		e.closed = true
+		e.f.Close()
+	}
+}
+
+func (e *Editor) add(hdr *tar.Header, r io.Reader) error {
+	name := cleanPath(hdr.Name)
+	if name == "." {
+		if hdr.Typeflag != tar.TypeDir {
+			return nil
+		}
+		root, err := e.inode(rootIno)
+		if err != nil {
+			return err
+		}
+		e.setAttrs(root, hdr)
+		return nil
+	}
+	if len(path.Base(name)) > 255 {
+		return syscall.ENAMETOOLONG
+	}
+	parent, err := e.mkdirAll(path.Dir(name))
+	if err != nil {
+		return err
+	}
+	base := path.Base(name)
+	old, exists, err := e.fs.find(parent, base)
+	if err != nil {
+		return err
+	}
+	var oldInode *inode
+	if exists {
+		if oldInode, err = e.inode(old.ino); err != nil {
+			return err
+		}
+	}
+
+	switch hdr.Typeflag {
+	case tar.TypeDir:
+		if exists && oldInode.isDir() {
+			e.setAttrs(oldInode, hdr)
+			return nil
+		}
+		if exists {
+			if err := e.unlink(parent, old); err != nil {
+				return err
+			}
+		}
+		_, err := e.mkdir(parent, base, hdr)
+		return err
+
+	case tar.TypeLink:
+		target, _, err := e.fs.resolve(cleanPath(hdr.Linkname), false)
+		if err != nil {
+			return fmt.Errorf("hard link target %s: %w", hdr.Linkname, err)
+		}
+		if target.isDir() {
+			return fmt.Errorf("hard link target %s: %w", hdr.Linkname, syscall.EPERM)
+		}
+		if exists && old.ino == target.num {
+			return nil
+		}
+		if exists && oldInode.isDir() {
+			return syscall.EISDIR
+		}
+		if target, err = e.inode(target.num); err != nil {
+			return err
+		}
+		if target.links() >= maxLinks {
+			return syscall.EMLINK
+		}
+		if exists {
+			if err := e.unlink(parent, old); err != nil {
+				return err
+			}
+		}
+		target.setLinks(target.links() + 1)
+		target.setTime(timeChange, e.now)
+		return e.addEntry(parent, base, target)
+	}
+
+	if exists && oldInode.isDir() {
+		return syscall.EISDIR
+	}
+	in, err := e.create(parent, hdr, r)
+	if err != nil {
+		return err
+	}
+	if exists {
+		if err := e.unlink(parent, old); err != nil {
+			return err
+		}
+	}
+	return e.addEntry(parent, base, in)
+}
+
+// create allocates and fills the inode of a non-directory entry.
+func (e *Editor) create(parent *inode, hdr *tar.Header, r io.Reader) (*inode, error) {
+	var typ uint16
+	switch hdr.Typeflag {
+	case tar.TypeReg, 0: // 0 is the pre-POSIX regular file flag
+		typ = modeFile
+	case tar.TypeSymlink:
+		typ = modeLink
+	case tar.TypeChar:
+		typ = modeChar
+	case tar.TypeBlock:
+		typ = modeBlock
+	case tar.TypeFifo:
+		typ = modeFIFO
+	default:
+		return nil, fmt.Errorf("%w: tar entry type %q", ErrUnsupported, hdr.Typeflag)
+	}
+	in, err := e.newInode(parent, typ, hdr)
+	if err != nil {
+		return nil, err
+	}
+	in.setLinks(1)
+
+	switch typ {
+	case modeFile:
+		if hdr.Size < 0 {
+			return nil, fmt.Errorf("negative size %d", hdr.Size)
+		}
+		if r == nil {
+			r = strings.NewReader("")
+		}
+		err = e.writeData(in, r, hdr.Size)
+	case modeLink:
+		if len(hdr.Linkname) == 0 || len(hdr.Linkname) >= int(e.fs.bs) {
+			return nil, fmt.Errorf("invalid symlink target length %d", len(hdr.Linkname))
+		}
+		if len(hdr.Linkname) < len(in.blockData()) {
+			copy(in.blockData(), hdr.Linkname)
+			in.setSize(int64(len(hdr.Linkname)))
+		} else {
+			err = e.writeData(in, strings.NewReader(hdr.Linkname), int64(len(hdr.Linkname)))
+		}
+	case modeChar, modeBlock:
+		major, minor := uint32(hdr.Devmajor), uint32(hdr.Devminor)
+		if major < 256 && minor < 256 {
+			le.PutUint32(in.blockData(), major<<8|minor)
+		} else {
+			le.PutUint32(in.blockData()[4:], minor&0xFF|major<<8|(minor&^0xFF)<<12)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return in, nil
+}
+
+// inode returns an inode from the image, marked dirty so the Editor's
+// changes to it are committed.
+func (e *Editor) inode(num uint32) (*inode, error) {
+	in, err := e.fs.inode(num)
+	if err != nil {
+		return nil, err
+	}
+	e.fs.inodes[num] = in
+	return in, nil
+}
+
+// newInode allocates an inode near its parent directory.
+func (e *Editor) newInode(parent *inode, typ uint16, hdr *tar.Header) (*inode, error) {
+	num, err := e.allocInode((parent.num-1)/e.fs.sb.inodesPerGroup, typ == modeDir)
+	if err != nil {
+		return nil, err
+	}
+	in := &inode{num: num, raw: make([]byte, e.fs.sb.inodeSize)}
+	if len(in.raw) >= goodOldInodeLen+32 {
+		in.setExtraIsize(32)
+	}
+	in.setMode(typ)
+	e.setAttrs(in, hdr)
+	in.setTime(timeCreate, e.now)
+	e.fs.inodes[num] = in
+	return in, nil
+}
+
+// setAttrs copies the permissions, ownership and timestamps of a tar
+// header to an inode.
+func (e *Editor) setAttrs(in *inode, hdr *tar.Header) {
+	in.setMode(in.mode()&modeType | uint16(hdr.Mode&0o7777))
+	in.setOwner(uint32(hdr.Uid), uint32(hdr.Gid))
+	mtime := hdr.ModTime
+	if mtime.IsZero() {
+		mtime = e.now
+	}
+	atime, ctime := hdr.AccessTime, hdr.ChangeTime
+	if atime.IsZero() {
+		atime = mtime
+	}
+	if ctime.IsZero() {
+		ctime = e.now
+	}
+	in.setTime(timeModify, mtime)
+	in.setTime(timeAccess, atime)
+	in.setTime(timeChange, ctime)
+}
+
+// mkdirAll returns the directory at an image path, creating missing
+// directories and following symlinks within the image.
+func (e *Editor) mkdirAll(dir string) (*inode, error) {
+	cur, err := e.inode(rootIno)
+	if err != nil {
+		return nil, err
+	}
+	if dir == "." {
+		return cur, nil
+	}
+	curPath := "."
+	for _, part := range strings.Split(dir, "/") {
+		next := path.Join(curPath, part)
+		de, ok, err := e.fs.find(cur, part)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			hdr := &tar.Header{Mode: 0o755, ModTime: e.now}
+			if cur, err = e.mkdir(cur, part, hdr); err != nil {
+				return nil, err
+			}
+			curPath = next
+			continue
+		}
+		in, err := e.fs.inode(de.ino)
+		if err != nil {
+			return nil, err
+		}
+		if in.isSymlink() {
+			if in, next, err = e.fs.resolve(next, true); err != nil {
+				return nil, &fs.PathError{Op: "mkdir", Path: next, Err: err}
+			}
+		}
+		if !in.isDir() {
+			return nil, &fs.PathError{Op: "mkdir", Path: next, Err: syscall.ENOTDIR}
+		}
+		if cur, err = e.inode(in.num); err != nil {
+			return nil, err
+		}
+		curPath = next
+	}
+	return cur, nil
+}
+
+// mkdir creates a directory with "." and ".." entries.
+func (e *Editor) mkdir(parent *inode, name string, hdr *tar.Header) (*inode, error) {
+	nlink := parent.links()
+	if nlink != 1 && nlink+1 >= maxLinks && e.fs.sb.roCompat&roCompatDirNlink == 0 {
+		return nil, syscall.EMLINK
+	}
+	in, err := e.newInode(parent, modeDir, hdr)
+	if err != nil {
+		return nil, err
+	}
+	if err := e.initDir(in, parent.num); err != nil {
+		return nil, err
+	}
+	if err := e.addEntry(parent, name, in); err != nil {
+		return nil, err
+	}
+	switch {
+	case nlink == 1:
+	case nlink+1 >= maxLinks:
+		parent.setLinks(1)
+	default:
+		parent.setLinks(nlink + 1)
+	}
+	return in, nil
+}
+
+// initDir gives a new directory inode its first block.
+func (e *Editor) initDir(in *inode, parent uint32) error {
+	blk, _, err := e.allocRun(1, e.groupStart(in.num))
+	if err != nil {
+		return err
+	}
+	b := make([]byte, e.fs.bs)
+	end := e.dirSpace()
+	putDirent(b, 0, 12, dirent{name: ".", ino: in.num, typ: 2}, e.filetype())
+	putDirent(b, 12, end-12, dirent{name: "..", ino: parent, typ: 2}, e.filetype())
+	e.putDirTail(b)
+	e.fs.blocks[blk] = &dirtyBlock{data: b, kind: blockDir, owner: in}
+
+	initExtentTree(in)
+	if err := e.appendExtent(in, extent{logical: 0, start: blk, length: 1}); err != nil {
+		return err
+	}
+	e.addSectors(in, 1)
+	in.setSize(e.fs.bs)
+	in.setLinks(2)
+	e.fs.dirs[in.num] = map[string]dirent{
+		".":  {name: ".", ino: in.num, typ: 2},
+		"..": {name: "..", ino: parent, typ: 2},
+	}
+	return nil
+}
+
+// groupStart returns the first block of the group holding an inode, a
+// good place for its data.
+func (e *Editor) groupStart(num uint32) uint64 {
+	return e.fs.sb.groupFirstBlock((num - 1) / e.fs.sb.inodesPerGroup)
+}
+
+// filetype reports whether directory entries carry a file type.
+func (e *Editor) filetype() bool {
+	return e.fs.sb.incompat&incompatFiletype != 0
+}
+
+// dirSpace returns the bytes of a directory block available to entries.
+func (e *Editor) dirSpace() int {
+	if e.fs.sb.metadataCsum() {
+		return int(e.fs.bs) - dirTailLen
+	}
+	return int(e.fs.bs)
+}
+
+// putDirTail adds the checksum tail to a directory block.
+func (e *Editor) putDirTail(b []byte) {
+	if !e.fs.sb.metadataCsum() {
+		return
+	}
+	tail := b[len(b)-dirTailLen:]
+	clear(tail)
+	le.PutUint16(tail[4:], dirTailLen)
+	tail[7] = 0xDE
+}
+
+// recLen returns the space an entry with a name of n bytes needs.
+func recLen(n int) int {
+	return (dirEntryHeader + n + 3) &^ 3
+}
+
+func putDirent(b []byte, off, length int, de dirent, filetype bool) {
+	le.PutUint32(b[off:], de.ino)
+	le.PutUint16(b[off+4:], uint16(length))
+	b[off+6] = uint8(len(de.name))
+	b[off+7] = 0
+	if filetype {
+		b[off+7] = de.typ
+	}
+	copy(b[off+dirEntryHeader:], de.name)
+}
+
+// dirBlocks returns the blocks of an extent-mapped linear directory.
+func (e *Editor) dirBlocks(dir *inode) ([]extent, error) {
+	switch {
+	case dir.flags()&flagInlineData != 0:
+		return nil, fmt.Errorf("%w: inline directory %d", ErrUnsupported, dir.num)
+	case dir.flags()&flagExtents == 0:
+		return nil, fmt.Errorf("%w: block-mapped directory %d", ErrUnsupported, dir.num)
+	case dir.flags()&flagIndex != 0:
+		if e.fs.sb.metadataCsum() {
+			return nil, fmt.Errorf("%w: hashed directory %d", ErrUnsupported, dir.num)
+		}
+		// Without checksums the index blocks read as empty entries, so
+		// dropping the index leaves a valid linear directory.
+		dir.setFlags(dir.flags() &^ flagIndex)
+	}
+	return e.fs.extents(dir, nil)
+}
+
+// metaBlock returns a metadata block for modification.
+func (e *Editor) metaBlock(n uint64, kind blockKind, owner *inode) ([]byte, error) {
+	if d, ok := e.fs.blocks[n]; ok {
+		return d.data, nil
+	}
+	b, err := e.fs.readBlock(n)
+	if err != nil {
+		return nil, err
+	}
+	if kind == blockDir && e.fs.sb.metadataCsum() {
+		tail := b[len(b)-dirTailLen:]
+		if le.Uint32(tail) != 0 || le.Uint16(tail[4:]) != dirTailLen || tail[7] != 0xDE {
+			return nil, fmt.Errorf("%w: directory block %d without checksum tail", ErrUnsupported, n)
+		}
+	}
+	e.fs.blocks[n] = &dirtyBlock{data: b, kind: kind, owner: owner}
+	return b, nil
+}
+
+// addEntry links an inode into a directory, in the last block if it has
+// room and in a new block otherwise.
+func (e *Editor) addEntry(dir *inode, name string, in *inode) error {
+	de := dirent{name: name, ino: in.num, typ: direntType(in.mode())}
+	exts, err := e.dirBlocks(dir)
+	if err != nil {
+		return err
+	}
+	need := recLen(len(name))
+	nblocks := uint64(dir.size() / e.fs.bs)
+	goal := e.groupStart(dir.num)
+	if nblocks > 0 {
+		if ext, ok := mapBlock(exts, nblocks-1); ok && !ext.uninit {
+			blk := ext.start + nblocks - 1 - uint64(ext.logical)
+			goal = blk + 1
+			b, err := e.metaBlock(blk, blockDir, dir)
+			if err != nil {
+				return err
+			}
+			done, err := e.insertDirent(b, need, de)
+			if err != nil {
+				return fmt.Errorf("directory %d: %w", dir.num, err)
+			}
+			if done {
+				e.cacheEntry(dir, de)
+				dir.setTime(timeModify, e.now)
+				dir.setTime(timeChange, e.now)
+				return nil
+			}
+		}
+	}
+
+	blk, _, err := e.allocRun(1, goal)
+	if err != nil {
+		return err
+	}
+	b := make([]byte, e.fs.bs)
+	putDirent(b, 0, e.dirSpace(), de, e.filetype())
+	e.putDirTail(b)
+	e.fs.blocks[blk] = &dirtyBlock{data: b, kind: blockDir, owner: dir}
+	if err := e.appendExtent(dir, extent{logical: uint32(nblocks), start: blk, length: 1}); err != nil {
+		return err
+	}
+	e.addSectors(dir, 1)
+	dir.setSize(int64(nblocks+1) * e.fs.bs)
+	dir.setTime(timeModify, e.now)
+	dir.setTime(timeChange, e.now)
+	e.cacheEntry(dir, de)
+	return nil
+}
+
+// insertDirent puts an entry into the first gap of a directory block that
+// fits it.
+func (e *Editor) insertDirent(b []byte, need int, de dirent) (bool, error) {
+	space := b[:e.dirSpace()]
+	done := false
+	err := e.fs.parseDirBlock(space, func(off, length int, cur dirent) bool {
+		if cur.ino == 0 && length >= need {
+			putDirent(space, off, length, de, e.filetype())
+			done = true
+			return false
+		}
+		used := recLen(len(cur.name))
+		if cur.ino != 0 && length-used >= need {
+			le.PutUint16(space[off+4:], uint16(used))
+			putDirent(space, off+used, length-used, de, e.filetype())
+			done = true
+			return false
+		}
+		return true
+	})
+	return done, err
+}
+
+// removeEntry deletes a name from a directory, merging its record into the
+// previous one.
+func (e *Editor) removeEntry(dir *inode, name string) error {
+	exts, err := e.dirBlocks(dir)
+	if err != nil {
+		return err
+	}
+	for _, ext := range exts {
+		for i := uint32(0); i < ext.length && !ext.uninit; i++ {
+			blk := ext.start + uint64(i)
+			b, err := e.fs.readBlock(blk)
+			if err != nil {
+				return err
+			}
+			found, prev := -1, -1
+			err = e.fs.parseDirBlock(b[:e.dirSpace()], func(off, _ int, de dirent) bool {
+				if de.ino != 0 && de.name == name {
+					found = off
+					return false
+				}
+				prev = off
+				return true
+			})
+			if err != nil {
+				return fmt.Errorf("directory %d: %w", dir.num, err)
+			}
+			if found < 0 {
+				continue
+			}
+			if b, err = e.metaBlock(blk, blockDir, dir); err != nil {
+				return err
+			}
+			if prev < 0 {
+				le.PutUint32(b[found:], 0)
+			} else {
+				merged := le.Uint16(b[prev+4:]) + le.Uint16(b[found+4:])
+				le.PutUint16(b[prev+4:], merged)
+			}
+			if cached, ok := e.fs.dirs[dir.num]; ok {
+				delete(cached, name)
+			}
+			dir.setTime(timeModify, e.now)
+			dir.setTime(timeChange, e.now)
+			return nil
+		}
+	}
+	return fs.ErrNotExist
+}
+
+func (e *Editor) cacheEntry(dir *inode, de dirent) {
+	if cached, ok := e.fs.dirs[dir.num]; ok {
+		cached[de.name] = de
+	}
+}
+
+// unlink removes a non-directory entry and frees its inode once the last
+// link is gone.
+func (e *Editor) unlink(dir *inode, de dirent) error {
+	in, err := e.inode(de.ino)
+	if err != nil {
+		return err
+	}
+	if in.isDir() {
+		return syscall.EISDIR
+	}
+	if err := e.removeEntry(dir, de.name); err != nil {
+		return err
+	}
+	in.setTime(timeChange, e.now)
+	if in.links() > 1 {
+		in.setLinks(in.links() - 1)
+		return nil
+	}
+	return e.release(in)
+}
+
+// release frees a deleted inode and its blocks.
+func (e *Editor) release(in *inode) error {
+	const flagEAInode = 0x200000
+	if in.fileACL() != 0 || in.flags()&flagEAInode != 0 {
+		return fmt.Errorf("%w: freeing inode %d with extended attribute blocks", ErrUnsupported, in.num)
+	}
+	if typ := in.mode() & modeType; (typ == modeFile || typ == modeLink || typ == modeDir) && !e.fs.fastSymlink(in) {
+		var nodes []uint64
+		exts, err := e.fs.extents(in, &nodes)
+		if err != nil {
+			return err
+		}
+		for _, ext := range exts {
+			if err := e.freeBlocks(ext.start, uint64(ext.length)); err != nil {
+				return err
+			}
+		}
+		for _, n := range nodes {
+			delete(e.fs.blocks, n)
+			if err := e.freeBlocks(n, 1); err != nil {
+				return err
+			}
+		}
+	}
+	in.setLinks(0)
+	in.setDtime(uint32(e.now.Unix()))
+	return e.freeInode(in.num, in.isDir())
+}
+
+// addSectors accounts n more blocks to an inode.
+func (e *Editor) addSectors(in *inode, n uint64) {
+	in.setSectors(in.sectors(e.fs.sb.blockSize) + n*uint64(e.fs.bs/512))
+}
+
+// writeData allocates blocks for size bytes read from r and writes them.
+func (e *Editor) writeData(in *inode, r io.Reader, size int64) error {
+	initExtentTree(in)
+	in.setSize(size)
+	bs := e.fs.bs
+	blocks := uint64((size + bs - 1) / bs)
+	buf := make([]byte, min(int64(blocks)*bs, 1<<20))
+	var logical uint64
+	for logical < blocks {
+		start, n, err := e.allocRun(min(blocks-logical, maxExtentLen), e.goal)
+		if err != nil {
+			return err
+		}
+		e.goal = start + n
+		for done := uint64(0); done < n; {
+			chunk := min(uint64(len(buf))/uint64(bs), n-done)
+			want := min(int64(chunk)*bs, size-int64(logical+done)*bs)
+			if _, err := io.ReadFull(r, buf[:want]); err != nil {
+				if errors.Is(err, io.EOF) {
+					err = io.ErrUnexpectedEOF
+				}
+				return err
+			}
+			clear(buf[want : int64(chunk)*bs])
+			if _, err := e.f.WriteAt(buf[:int64(chunk)*bs], int64(start+done)*bs); err != nil {
+				return err
+			}
+			done += chunk
+		}
+		if err := e.appendExtent(in, extent{logical: uint32(logical), start: start, length: uint32(n)}); err != nil {
+			return err
+		}
+		e.addSectors(in, n)
+		logical += n
+	}
+	return nil
+}
+
+// initExtentTree gives an inode an empty extent tree.
+func initExtentTree(in *inode) {
+	root := in.blockData()
+	clear(root)
+	putExtentHeader(root, 0, inodeExtentRoom, 0)
+	in.setFlags(in.flags() | flagExtents)
+}
+
+func putExtentHeader(node []byte, entries, max, depth uint16) {
+	le.PutUint16(node, extentMagic)
+	le.PutUint16(node[2:], entries)
+	le.PutUint16(node[4:], max)
+	le.PutUint16(node[6:], depth)
+}
+
+func putExtent(node []byte, i int, ext extent) {
+	putExtentEntry(node[extentEntryLen*(i+1):], ext)
+}
+
+func putExtentEntry(e []byte, ext extent) {
+	le.PutUint32(e, ext.logical)
+	le.PutUint16(e[4:], uint16(ext.length))
+	le.PutUint16(e[6:], uint16(ext.start>>32))
+	le.PutUint32(e[8:], uint32(ext.start))
+}
+
+func putIndex(node []byte, i int, logical uint32, leaf uint64) {
+	e := node[extentEntryLen*(i+1):]
+	le.PutUint32(e, logical)
+	le.PutUint32(e[4:], uint32(leaf))
+	le.PutUint16(e[8:], uint16(leaf>>32))
+	le.PutUint16(e[10:], 0)
+}
+
+// appendLeaf adds an extent at the end of a leaf node, merging it with the
+// last extent when they are contiguous. It reports false when the leaf is
+// full.
+func appendLeaf(node []byte, ext extent) bool {
+	entries, max := int(le.Uint16(node[2:])), int(le.Uint16(node[4:]))
+	if entries > 0 {
+		last := node[extentEntryLen*entries:]
+		length := uint32(le.Uint16(last[4:]))
+		start := uint64(le.Uint16(last[6:]))<<32 | uint64(le.Uint32(last[8:]))
+		if length <= maxExtentLen && le.Uint32(last)+length == ext.logical &&
+			start+uint64(length) == ext.start && length+ext.length <= maxExtentLen {
+			le.PutUint16(last[4:], uint16(length+ext.length))
+			return true
+		}
+	}
+	if entries == max {
+		return false
+	}
+	putExtent(node, entries, ext)
+	le.PutUint16(node[2:], uint16(entries+1))
+	return true
+}
+
+// appendExtent adds an extent after the last one of an inode. Trees grow
+// to one level of index with up to four leaves; larger ones fail with
+// ErrUnsupported.
+func (e *Editor) appendExtent(in *inode, ext extent) error {
+	root := in.blockData()
+	entries, _, depth, err := extentHeader(root)
+	if err != nil {
+		return fmt.Errorf("inode %d: %w", in.num, err)
+	}
+	if depth == 0 {
+		if appendLeaf(root, ext) {
+			return nil
+		}
+		first := le.Uint32(root[extentEntryLen:])
+		leaf, err := e.newLeaf(in, root[extentEntryLen:extentEntryLen*(1+int(entries))], entries)
+		if err != nil {
+			return err
+		}
+		clear(root[extentEntryLen:])
+		putExtentHeader(root, 1, inodeExtentRoom, 1)
+		putIndex(root, 0, first, leaf)
+		entries, depth = 1, 1
+	}
+	if depth != 1 {
+		return fmt.Errorf("%w: extent tree of inode %d has depth %d", ErrUnsupported, in.num, depth)
+	}
+
+	last := root[extentEntryLen*int(entries):]
+	leafBlk := uint64(le.Uint32(last[4:])) | uint64(le.Uint16(last[8:]))<<32
+	node, err := e.metaBlock(leafBlk, blockExtent, in)
+	if err != nil {
+		return err
+	}
+	if _, _, _, err := extentHeader(node); err != nil {
+		return fmt.Errorf("inode %d: %w", in.num, err)
+	}
+	if appendLeaf(node, ext) {
+		return nil
+	}
+	if entries == inodeExtentRoom {
+		return fmt.Errorf("%w: extent tree of inode %d is full", ErrUnsupported, in.num)
+	}
+	var first [extentEntryLen]byte
+	putExtentEntry(first[:], ext)
+	leaf, err := e.newLeaf(in, first[:], 1)
+	if err != nil {
+		return err
+	}
+	putIndex(root, int(entries), ext.logical, leaf)
+	le.PutUint16(root[2:], entries+1)
+	return nil
+}
+
+// newLeaf allocates an extent leaf block holding the given entries.
+func (e *Editor) newLeaf(in *inode, entries []byte, n uint16) (uint64, error) {
+	blk, _, err := e.allocRun(1, e.groupStart(in.num))
+	if err != nil {
+		return 0, err
+	}
+	node := make([]byte, e.fs.bs)
+	putExtentHeader(node, n, uint16((e.fs.bs-extentEntryLen)/extentEntryLen), 0)
+	copy(node[extentEntryLen:], entries)
+	e.fs.blocks[blk] = &dirtyBlock{data: node, kind: blockExtent, owner: in}
+	e.addSectors(in, 1)
+	return blk, nil
+}
@@ -0,0 +1,426 @@
+package ext4
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fsck checks an image with e2fsck when it is installed.
+func fsck(t *testing.T, path string) {
+	t.Helper()
+	e2fsck, err := exec.LookPath("e2fsck")
+	if err != nil {
+		t.Log("e2fsck not installed, skipping consistency check")
+		return
+	}
+	out, err := exec.Command(e2fsck, "-fn", path).CombinedOutput()
+	require.NoError(t, err, "e2fsck found problems:\n%s", out)
+}
+
+// pattern returns n bytes that differ from block to block.
+func pattern(n int) []byte {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = byte(i*7 + i/4096)
+	}
+	return b
+}
+
+var testTime = time.Date(2024, 5, 1, 12, 30, 15, 123456789, time.UTC)
+
+func TestCreate_RoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rootfs.ext4")
+	e, err := Create(path, Options{Size: 32 << 20, Label: "rootfs"})
+	require.NoError(t, err)
+
+	big := pattern(3*formatBlockSize + 100)
+	longTarget := "/usr/bin/" + strings.Repeat("../bin/", 10) + "tool"
+	entries := []struct {
+		hdr  tar.Header
+		data []byte
+	}{
+		{hdr: tar.Header{Typeflag: tar.TypeDir, Name: "etc", Mode: 0o755}},
+		{hdr: tar.Header{Typeflag: tar.TypeReg, Name: "etc/hosts", Mode: 0o644}, data: []byte("127.0.0.1 localhost\n")},
+		{hdr: tar.Header{Typeflag: tar.TypeReg, Name: "etc/empty", Mode: 0o600}},
+		{hdr: tar.Header{Typeflag: tar.TypeReg, Name: "usr/bin/tool", Mode: 0o4755, Uid: 1000, Gid: 70000}, data: big},
+		{hdr: tar.Header{Typeflag: tar.TypeSymlink, Name: "bin", Linkname: "usr/bin", Mode: 0o777}},
+		{hdr: tar.Header{Typeflag: tar.TypeSymlink, Name: "long", Linkname: longTarget, Mode: 0o777}},
+		{hdr: tar.Header{Typeflag: tar.TypeLink, Name: "etc/hosts.bak", Linkname: "etc/hosts"}},
+		{hdr: tar.Header{Typeflag: tar.TypeChar, Name: "dev/null", Mode: 0o666, Devmajor: 1, Devminor: 3}},
+		{hdr: tar.Header{Typeflag: tar.TypeBlock, Name: "dev/big", Mode: 0o660, Devmajor: 259, Devminor: 300}},
+		{hdr: tar.Header{Typeflag: tar.TypeFifo, Name: "run/fifo", Mode: 0o644}},
+	}
+	for _, entry := range entries {
+		hdr := entry.hdr
+		hdr.Size = int64(len(entry.data))
+		hdr.ModTime = testTime
+		require.NoError(t, e.Add(&hdr, bytes.NewReader(entry.data)), hdr.Name)
+	}
+	require.NoError(t, e.Close())
+	fsck(t, path)
+
+	img, err := Open(path)
+	require.NoError(t, err)
+	defer img.Close()
+	assert.Equal(t, "rootfs", img.Label())
+
+	data, err := img.ReadFile("/etc/hosts")
+	require.NoError(t, err)
+	assert.Equal(t, "127.0.0.1 localhost\n", string(data))
+	data, err = img.ReadFile("bin/tool")
+	require.NoError(t, err)
+	assert.Equal(t, big, data)
+	data, err = img.ReadFile("etc/empty")
+	require.NoError(t, err)
+	assert.Empty(t, data)
+
+	info, err := img.Lstat("usr/bin/tool")
+	require.NoError(t, err)
+	assert.Equal(t, fs.FileMode(0o755)|fs.ModeSetuid, info.Mode())
+	assert.Equal(t, int64(len(big)), info.Size())
+	assert.True(t, info.ModTime().Equal(testTime), info.ModTime())
+	hdr, err := tar.FileInfoHeader(info, "")
+	require.NoError(t, err)
+	assert.Equal(t, 1000, hdr.Uid)
+	assert.Equal(t, 70000, hdr.Gid)
+
+	for name, want := range map[string]string{"bin": "usr/bin", "long": longTarget} {
+		target, err := img.ReadLink(name)
+		require.NoError(t, err)
+		assert.Equal(t, want, target)
+	}
+	info, err = img.Stat("bin")
+	require.NoError(t, err)
+	assert.True(t, info.IsDir())
+
+	for name, want := range map[string][2]int64{"dev/null": {1, 3}, "dev/big": {259, 300}} {
+		info, err := img.Lstat(name)
+		require.NoError(t, err)
+		assert.NotZero(t, info.Mode()&fs.ModeDevice, name)
+		sys := info.Sys().(*tar.Header)
+		assert.Equal(t, want, [2]int64{sys.Devmajor, sys.Devminor}, name)
+	}
+	info, err = img.Lstat("run/fifo")
+	require.NoError(t, err)
+	assert.Equal(t, fs.ModeNamedPipe, info.Mode().Type())
+
+	names := func(dir string) []string {
+		entries, err := img.ReadDir(dir)
+		require.NoError(t, err)
+		var out []string
+		for _, entry := range entries {
+			out = append(out, entry.Name())
+		}
+		return out
+	}
+	assert.Equal(t, []string{"bin", "dev", "etc", "long", "lost+found", "run", "usr"}, names("."))
+	assert.Equal(t, []string{"empty", "hosts", "hosts.bak"}, names("etc"))
+
+	var walked []string
+	require.NoError(t, fs.WalkDir(img, "usr", func(p string, d fs.DirEntry, err error) error {
+		walked = append(walked, p)
+		return err
+	}))
+	assert.Equal(t, []string{"usr", "usr/bin", "usr/bin/tool"}, walked)
+}
+
+func TestCreate_Errors(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name    string
+		opts    Options
+		wantErr string
+	}{
+		{"too small", Options{Size: 64 << 10}, "too small"},
+		{"negative", Options{Size: -1}, "too small"},
+		{"long label", Options{Size: 8 << 20, Label: strings.Repeat("x", 17)}, "longer than 16 bytes"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Create(filepath.Join(dir, tt.name), tt.opts)
+			assert.ErrorContains(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestCreate_ManyGroups(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "large.ext4")
+	e, err := Create(path, Options{Size: 3 << 30, Inodes: 4096})
+	require.NoError(t, err)
+
+	// Spread directories over the inode groups and fill a few data groups.
+	data := pattern(200 << 20)
+	for i := 0; i < 5; i++ {
+		hdr := &tar.Header{Typeflag: tar.TypeReg, Name: fmt.Sprintf("d%d/blob", i), Mode: 0o644, Size: int64(len(data))}
+		require.NoError(t, e.Add(hdr, bytes.NewReader(data)))
+	}
+	require.NoError(t, e.Close())
+	fsck(t, path)
+
+	img, err := Open(path)
+	require.NoError(t, err)
+	defer img.Close()
+	got, err := img.ReadFile("d4/blob")
+	require.NoError(t, err)
+	assert.True(t, bytes.Equal(data, got))
+}
+
+func TestCreateFromDir_Extract(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "src")
+	files := map[string][]byte{
+		"etc/passwd":             []byte("root:x:0:0:root:/root:/bin/sh\n"),
+		"usr/lib/libbig.so":      pattern(1<<20 + 17),
+		"var/empty":              nil,
+		"srv/a/b/c/d/e/deep.txt": []byte("deep"),
+	}
+	for name, data := range files {
+		p := filepath.Join(src, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(p), 0o755))
+		require.NoError(t, os.WriteFile(p, data, 0o640))
+	}
+	for i := 0; i < 300; i++ {
+		require.NoError(t, os.WriteFile(filepath.Join(src, "etc", fmt.Sprintf("conf-%03d.d", i)), []byte{byte(i)}, 0o644))
+	}
+	require.NoError(t, os.Symlink("../etc/passwd", filepath.Join(src, "var/passwd")))
+	require.NoError(t, os.Link(filepath.Join(src, "etc/passwd"), filepath.Join(src, "etc/passwd-")))
+	require.NoError(t, os.Chmod(filepath.Join(src, "srv"), 0o750))
+
+	path := filepath.Join(t.TempDir(), "rootfs.ext4")
+	require.NoError(t, CreateFromDir(path, src, Options{Size: 16 << 20}))
+	fsck(t, path)
+
+	img, err := Open(path)
+	require.NoError(t, err)
+	defer img.Close()
+	dest := filepath.Join(t.TempDir(), "out")
+	require.NoError(t, img.Extract("/", dest))
+
+	for name, data := range files {
+		got, err := os.ReadFile(filepath.Join(dest, name))
+		require.NoError(t, err, name)
+		assert.Equal(t, len(data), len(got), name)
+		assert.True(t, bytes.Equal(data, got), name)
+	}
+	got, err := os.ReadFile(filepath.Join(dest, "etc/conf-299.d"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte{byte(299 % 256)}, got)
+
+	target, err := os.Readlink(filepath.Join(dest, "var/passwd"))
+	require.NoError(t, err)
+	assert.Equal(t, "../etc/passwd", target)
+	data, err := img.ReadFile("var/passwd")
+	require.NoError(t, err)
+	assert.Equal(t, files["etc/passwd"], data)
+
+	a, err := os.Stat(filepath.Join(dest, "etc/passwd"))
+	require.NoError(t, err)
+	b, err := os.Stat(filepath.Join(dest, "etc/passwd-"))
+	require.NoError(t, err)
+	assert.True(t, os.SameFile(a, b), "hard link not kept")
+
+	info, err := os.Stat(filepath.Join(dest, "srv"))
+	require.NoError(t, err)
+	assert.Equal(t, fs.FileMode(0o750), info.Mode().Perm())
+
+	// A subtree extracts on its own.
+	sub := filepath.Join(t.TempDir(), "sub")
+	require.NoError(t, img.Extract("srv/a/b", sub))
+	got, err = os.ReadFile(filepath.Join(sub, "c/d/e/deep.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "deep", string(got))
+}
+
+func TestEditor_AddTar(t *testing.T) {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, entry := range []struct {
+		hdr  tar.Header
+		data string
+	}{
+		{hdr: tar.Header{Typeflag: tar.TypeDir, Name: "./", Mode: 0o711}},
+		{hdr: tar.Header{Typeflag: tar.TypeDir, Name: "./app/", Mode: 0o755}},
+		{hdr: tar.Header{Typeflag: tar.TypeReg, Name: "./app/main", Mode: 0o755}, data: "#!/bin/sh\n"},
+		{hdr: tar.Header{Typeflag: tar.TypeLink, Name: "./app/alias", Linkname: "./app/main"}},
+	} {
+		hdr := entry.hdr
+		hdr.Size = int64(len(entry.data))
+		require.NoError(t, tw.WriteHeader(&hdr))
+		_, err := io.WriteString(tw, entry.data)
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+
+	path := filepath.Join(t.TempDir(), "layer.ext4")
+	e, err := Create(path, Options{Size: 4 << 20})
+	require.NoError(t, err)
+	require.NoError(t, e.AddTar(&buf))
+	require.NoError(t, e.Close())
+	fsck(t, path)
+
+	img, err := Open(path)
+	require.NoError(t, err)
+	defer img.Close()
+	info, err := img.Stat(".")
+	require.NoError(t, err)
+	assert.Equal(t, fs.FileMode(0o711), info.Mode().Perm())
+	data, err := img.ReadFile("app/alias")
+	require.NoError(t, err)
+	assert.Equal(t, "#!/bin/sh\n", string(data))
+}
+
+func TestEditor_Replace(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "replace.ext4")
+	e, err := Create(path, Options{Size: 8 << 20})
+	require.NoError(t, err)
+	add := func(typ byte, name string, data []byte) error {
+		hdr := &tar.Header{Typeflag: typ, Name: name, Mode: 0o644, Size: int64(len(data))}
+		if typ == tar.TypeSymlink || typ == tar.TypeLink {
+			hdr.Linkname, hdr.Size = string(data), 0
+		}
+		return e.Add(hdr, bytes.NewReader(data))
+	}
+	require.NoError(t, add(tar.TypeReg, "etc/config", pattern(100<<10)))
+	require.NoError(t, add(tar.TypeLink, "etc/config.link", []byte("etc/config")))
+	require.NoError(t, add(tar.TypeReg, "etc/config", []byte("new")))
+	require.NoError(t, add(tar.TypeSymlink, "etc/config.link", []byte("config")))
+	require.NoError(t, add(tar.TypeDir, "etc", nil))
+	require.NoError(t, e.Close())
+	fsck(t, path)
+
+	img, err := Open(path)
+	require.NoError(t, err)
+	defer img.Close()
+	data, err := img.ReadFile("etc/config.link")
+	require.NoError(t, err)
+	assert.Equal(t, "new", string(data))
+	info, err := img.Stat("etc")
+	require.NoError(t, err)
+	assert.Equal(t, fs.FileMode(0o644), info.Mode().Perm())
+}
+
+func TestEditor_Errors(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "errors.ext4")
+	e, err := Create(path, Options{Size: 4 << 20})
+	require.NoError(t, err)
+	require.NoError(t, e.Add(&tar.Header{Typeflag: tar.TypeDir, Name: "dir", Mode: 0o755}, nil))
+	require.NoError(t, e.Add(&tar.Header{Typeflag: tar.TypeReg, Name: "file", Mode: 0o644}, nil))
+	require.NoError(t, e.Close())
+
+	tests := []struct {
+		name    string
+		hdr     tar.Header
+		data    string
+		wantErr error
+	}{
+		{"file over directory", tar.Header{Typeflag: tar.TypeReg, Name: "dir"}, "", syscall.EISDIR},
+		{"file under file", tar.Header{Typeflag: tar.TypeReg, Name: "file/child"}, "", syscall.ENOTDIR},
+		{"missing link target", tar.Header{Typeflag: tar.TypeLink, Name: "link", Linkname: "missing"}, "", fs.ErrNotExist},
+		{"short data", tar.Header{Typeflag: tar.TypeReg, Name: "short", Size: 10}, "abc", io.ErrUnexpectedEOF},
+		{"no space", tar.Header{Typeflag: tar.TypeReg, Name: "huge", Size: 8 << 20}, "", ErrNoSpace},
+		{"sparse", tar.Header{Typeflag: tar.TypeGNUSparse, Name: "sparse"}, "", ErrUnsupported},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Inject(path, func(e *Editor) error {
+				r := io.MultiReader(strings.NewReader(tt.data), bytes.NewReader(make([]byte, max(0, int(tt.hdr.Size)-len(tt.data)))))
+				if tt.wantErr == io.ErrUnexpectedEOF {
+					r = strings.NewReader(tt.data)
+				}
+				return e.Add(&tt.hdr, r)
+			})
+			require.Error(t, err)
+			assert.True(t, errors.Is(err, tt.wantErr), "got %v", err)
+
+			// Failed edits leave the metadata alone.
+			after, err := Open(path)
+			require.NoError(t, err)
+			defer after.Close()
+			info, err := after.Lstat(tt.hdr.Name)
+			if tt.hdr.Name == "dir" {
+				require.NoError(t, err)
+				assert.True(t, info.IsDir())
+			} else {
+				assert.Error(t, err)
+			}
+			fsck(t, path)
+		})
+	}
+}
+
+func TestEditor_FragmentedFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fragmented.ext4")
+	e, err := Create(path, Options{Size: 64 << 20})
+	require.NoError(t, err)
+	one := make([]byte, formatBlockSize)
+	for i := 0; i < 2000; i++ {
+		hdr := &tar.Header{Typeflag: tar.TypeReg, Name: fmt.Sprintf("small/%04d", i), Mode: 0o644, Size: int64(len(one))}
+		require.NoError(t, e.Add(hdr, bytes.NewReader(one)))
+	}
+	// Replacing every other file leaves single free blocks behind.
+	for i := 0; i < 2000; i += 2 {
+		hdr := &tar.Header{Typeflag: tar.TypeReg, Name: fmt.Sprintf("small/%04d", i), Mode: 0o644}
+		require.NoError(t, e.Add(hdr, nil))
+	}
+	e.goal = 0
+	data := pattern(6 << 20)
+	hdr := &tar.Header{Typeflag: tar.TypeReg, Name: "big", Mode: 0o644, Size: int64(len(data))}
+	require.NoError(t, e.Add(hdr, bytes.NewReader(data)))
+	require.NoError(t, e.Close())
+	fsck(t, path)
+
+	img, err := Open(path)
+	require.NoError(t, err)
+	defer img.Close()
+	in, _, err := img.fs.resolve("big", false)
+	require.NoError(t, err)
+	exts, err := img.fs.extents(in, nil)
+	require.NoError(t, err)
+	assert.Greater(t, len(exts), 340, "file should need more than one extent leaf")
+	got, err := img.ReadFile("big")
+	require.NoError(t, err)
+	assert.True(t, bytes.Equal(data, got))
+}
+
+func TestOpen_Errors(t *testing.T) {
+	dir := t.TempDir()
+	_, err := Open(filepath.Join(dir, "missing"))
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+
+	junk := filepath.Join(dir, "junk")
+	require.NoError(t, os.WriteFile(junk, make([]byte, 8192), 0o644))
+	_, err = Open(junk)
+	assert.ErrorContains(t, err, "bad superblock magic")
+
+	path := filepath.Join(dir, "loop.ext4")
+	e, err := Create(path, Options{Size: 4 << 20})
+	require.NoError(t, err)
+	require.NoError(t, e.Add(&tar.Header{Typeflag: tar.TypeSymlink, Name: "a", Linkname: "b"}, nil))
+	require.NoError(t, e.Add(&tar.Header{Typeflag: tar.TypeSymlink, Name: "b", Linkname: "/a"}, nil))
+	require.NoError(t, e.Add(&tar.Header{Typeflag: tar.TypeSymlink, Name: "escape", Linkname: "../../../lost+found"}, nil))
+	require.NoError(t, e.Close())
+
+	img, err := Open(path)
+	require.NoError(t, err)
+	defer img.Close()
+	_, err = img.Stat("a")
+	assert.ErrorIs(t, err, syscall.ELOOP)
+	_, err = img.ReadFile("lost+found")
+	assert.ErrorIs(t, err, syscall.EISDIR)
+	info, err := img.Stat("escape")
+	require.NoError(t, err, "symlinks resolve inside the image")
+	assert.True(t, info.IsDir())
+}
@@ -0,0 +1,205 @@
+package ext4
+
+import (
+	"archive/tar"
+	"crypto/rand"
+	"fmt"
+	"os"
+	"time"
+)
+
+// Geometry of new images: 4 KiB blocks, 256-byte inodes and the metadata
+// of 16 groups packed together, as mkfs.ext4 lays out a default image.
+const (
+	formatBlockSize      = 4096
+	formatInodeSize      = 256
+	formatBlocksPerGroup = 8 * formatBlockSize
+	formatBytesPerInode  = 16384
+	formatLogFlex        = 4
+	formatMinBlocks      = 64
+
+	formatIncompat = incompatFiletype | incompatExtents | incompatFlexBG
+	formatROCompat = roCompatSparseSuper | roCompatLargeFile | roCompatDirNlink | roCompatExtraIsize
+)
+
+// Create formats a new, empty image at path and returns an Editor to fill
+// it. The image has the root directory and lost+found; nothing is written
+// to disk beyond the sparse file until the Editor is closed.
+func Create(path string, opts Options) (*Editor, error) {
+	blocks := uint64(opts.Size) / formatBlockSize
+	if rest := blocks % formatBlocksPerGroup; blocks > formatBlocksPerGroup && rest < formatMinBlocks {
+		// Like mkfs, drop a last group too small to be useful.
+		blocks -= rest
+	}
+	switch {
+	case opts.Size < 0 || blocks < formatMinBlocks:
+		return nil, fmt.Errorf("image size %d too small, need at least %d bytes", opts.Size, formatMinBlocks*formatBlockSize)
+	case blocks > 1<<32-1:
+		return nil, fmt.Errorf("image size %d too large", opts.Size)
+	case len(opts.Label) > 16:
+		return nil, fmt.Errorf("label %q longer than 16 bytes", opts.Label)
+	}
+	groups := (blocks + formatBlocksPerGroup - 1) / formatBlocksPerGroup
+	inodes := uint64(opts.Inodes)
+	if inodes == 0 {
+		inodes = blocks * formatBlockSize / formatBytesPerInode
+	}
+	const inodesPerBlock = formatBlockSize / formatInodeSize
+	ipg := (inodes + groups - 1) / groups
+	ipg = max(inodesPerBlock, (ipg+inodesPerBlock-1)/inodesPerBlock*inodesPerBlock)
+	ipg = min(ipg, 8*formatBlockSize)
+
+	now := opts.Time
+	if now.IsZero() {
+		now = time.Now()
+	}
+	uuid := opts.UUID
+	if uuid == [16]byte{} {
+		if _, err := rand.Read(uuid[:]); err != nil {
+			return nil, err
+		}
+		uuid[6] = uuid[6]&0x0F | 0x40
+		uuid[8] = uuid[8]&0x3F | 0x80
+	}
+	sb, err := parseSuperblock(formatSuperblock(uint32(blocks), uint32(ipg*groups), uint32(ipg), uuid, opts.Label, now))
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := f.Truncate(int64(blocks) * formatBlockSize); err != nil {
+		f.Close()
+		return nil, err
+	}
+	fsys := newFS(f, sb)
+	gdt := make([]byte, int(sb.groupCount)*int(sb.descSize))
+	for g := range fsys.groups {
+		fsys.groups[g] = groupDesc{raw: gdt[g*32 : (g+1)*32 : (g+1)*32]}
+	}
+	e := newEditor(f, fsys)
+	e.now = now
+	e.backups = true
+	if err := e.format(); err != nil {
+		e.abort()
+		os.Remove(path)
+		return nil, err
+	}
+	return e, nil
+}
+
+// formatSuperblock returns the superblock of a new image.
+func formatSuperblock(blocks, inodes, ipg uint32, uuid [16]byte, label string, now time.Time) []byte {
+	raw := make([]byte, superblockSize)
+	le.PutUint32(raw[0x0:], inodes)
+	le.PutUint32(raw[0x4:], blocks)
+	le.PutUint32(raw[0x18:], 2) // 1024 << 2
+	le.PutUint32(raw[0x1C:], 2)
+	le.PutUint32(raw[0x20:], formatBlocksPerGroup)
+	le.PutUint32(raw[0x24:], formatBlocksPerGroup)
+	le.PutUint32(raw[0x28:], ipg)
+	le.PutUint32(raw[0x30:], uint32(now.Unix()))
+	le.PutUint16(raw[0x36:], 0xFFFF) // no mount count check
+	le.PutUint16(raw[0x38:], superMagic)
+	le.PutUint16(raw[0x3A:], 1) // cleanly unmounted
+	le.PutUint16(raw[0x3C:], 1) // continue on errors
+	le.PutUint32(raw[0x40:], uint32(now.Unix()))
+	le.PutUint32(raw[0x4C:], 1) // dynamic revision
+	le.PutUint32(raw[0x54:], lostFoundIno)
+	le.PutUint16(raw[0x58:], formatInodeSize)
+	le.PutUint32(raw[0x60:], formatIncompat)
+	le.PutUint32(raw[0x64:], formatROCompat)
+	copy(raw[0x68:], uuid[:])
+	copy(raw[0x78:0x88], label)
+	copy(raw[0xEC:0xFC], uuid[:])
+	raw[0xFC] = 1 // half MD4 directory hash
+	le.PutUint32(raw[0x108:], uint32(now.Unix()))
+	le.PutUint16(raw[0x15C:], 32)
+	le.PutUint16(raw[0x15E:], 32)
+	raw[0x174] = formatLogFlex
+	return raw
+}
+
+// format lays out the group metadata and creates the root directory and
+// lost+found.
+func (e *Editor) format() error {
+	sb := e.fs.sb
+	gdtBlocks := sb.gdtBlocks()
+	cursor := uint64(1) + gdtBlocks
+	// place returns the next n free blocks, skipping the backup superblocks
+	// and descriptor tables of later groups.
+	place := func(n uint64) uint64 {
+	retry:
+		for {
+			end := cursor + n
+			for g := uint32(cursor / formatBlocksPerGroup); uint64(g)*formatBlocksPerGroup < end && g < sb.groupCount; g++ {
+				start := uint64(g) * formatBlocksPerGroup
+				if g > 0 && sb.hasSuper(g) && cursor < start+1+gdtBlocks && end > start {
+					cursor = start + 1 + gdtBlocks
+					continue retry
+				}
+			}
+			start := cursor
+			cursor = end
+			return start
+		}
+	}
+	for _, gd := range e.fs.groups {
+		gd.setBlockBitmap(place(1))
+	}
+	for _, gd := range e.fs.groups {
+		gd.setInodeBitmap(place(1))
+	}
+	tableBlocks := e.inodeTableBlocks()
+	for _, gd := range e.fs.groups {
+		gd.setInodeTable(place(tableBlocks))
+	}
+	if cursor >= sb.blocksCount {
+		return fmt.Errorf("image of %d blocks too small for its metadata", sb.blocksCount)
+	}
+
+	for g, gd := range e.fs.groups {
+		g := uint32(g)
+		bb := e.initBlockBitmap(g)
+		used := uint32(0)
+		for i := uint32(0); i < sb.groupBlocks(g); i++ {
+			if testBit(bb, i) {
+				used++
+			}
+		}
+		gd.setFreeBlocks(sb.groupBlocks(g) - used)
+		ib := make([]byte, e.fs.bs)
+		setBitsFrom(ib, sb.inodesPerGroup)
+		free := sb.inodesPerGroup
+		if g == 0 {
+			for i := uint32(0); i < sb.firstIno-1; i++ {
+				setBit(ib, i)
+			}
+			free -= sb.firstIno - 1
+		}
+		gd.setFreeInodes(free)
+		e.blockBitmaps[g], e.inodeBitmaps[g] = bb, ib
+		e.dirtyGroups[g] = true
+	}
+
+	root := &inode{num: rootIno, raw: make([]byte, sb.inodeSize)}
+	root.setExtraIsize(32)
+	root.setMode(modeDir)
+	e.setAttrs(root, &tar.Header{Mode: 0o755, ModTime: e.now})
+	root.setTime(timeCreate, e.now)
+	e.fs.inodes[rootIno] = root
+	e.fs.groups[0].setUsedDirs(1)
+	if err := e.initDir(root, rootIno); err != nil {
+		return err
+	}
+	lostFound, err := e.mkdir(root, "lost+found", &tar.Header{Mode: 0o700, ModTime: e.now})
+	if err != nil {
+		return err
+	}
+	if lostFound.num != lostFoundIno {
+		return fmt.Errorf("lost+found got inode %d", lostFound.num)
+	}
+	return nil
+}
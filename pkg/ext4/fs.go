@@ -0,0 +1,582 @@
+package ext4
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"syscall"
+)
+
+// maxSymlinks bounds symlink resolution, as the kernel's MAXSYMLINKS does.
+const maxSymlinks = 40
+
+// blockKind tells commit which checksum a dirty metadata block carries.
+type blockKind int
+
+const (
+	blockRaw blockKind = iota
+	blockDir
+	blockExtent
+)
+
+// dirtyBlock is a metadata block changed in memory and not yet committed.
+type dirtyBlock struct {
+	data  []byte
+	kind  blockKind
+	owner *inode
+}
+
+// fsys reads an image. The Editor changes inodes and metadata blocks in
+// the inodes and blocks overlays, which reads see before the image itself.
+type fsys struct {
+	dev    io.ReaderAt
+	sb     *superblock
+	bs     int64
+	groups []groupDesc
+	seed   uint32
+
+	inodes map[uint32]*inode
+	blocks map[uint64]*dirtyBlock
+	// dirs caches directory listings by inode while editing
+	dirs map[uint32]map[string]dirent
+}
+
+// dirent is a directory entry.
+type dirent struct {
+	name string
+	ino  uint32
+	typ  uint8
+}
+
+// extent maps length blocks of a file from logical onwards to start.
+type extent struct {
+	logical uint32
+	start   uint64
+	length  uint32
+	uninit  bool
+}
+
+// newFS returns a file system for a parsed superblock; the caller fills
+// in the group descriptors.
+func newFS(dev io.ReaderAt, sb *superblock) *fsys {
+	fsys := &fsys{
+		dev:    dev,
+		sb:     sb,
+		bs:     int64(sb.blockSize),
+		groups: make([]groupDesc, sb.groupCount),
+		inodes: make(map[uint32]*inode),
+		blocks: make(map[uint64]*dirtyBlock),
+	}
+	if sb.metadataCsum() {
+		fsys.seed = sb.csumSeed()
+	}
+	return fsys
+}
+
+// openFS reads the superblock and group descriptors of an image. An image
+// that was not cleanly unmounted is read as if its journal was replayed.
+func openFS(dev io.ReaderAt) (*fsys, error) {
+	fsys, err := readFS(dev)
+	if err != nil || fsys.sb.incompat&incompatRecover == 0 {
+		return fsys, err
+	}
+	blocks, err := fsys.replayJournal()
+	if err != nil {
+		return nil, fmt.Errorf("failed to replay journal: %w", err)
+	}
+	if len(blocks) == 0 {
+		return fsys, nil
+	}
+	return readFS(&replayedDev{dev: dev, bs: fsys.bs, blocks: blocks})
+}
+
+// readFS reads the superblock and group descriptors from dev as they are.
+func readFS(dev io.ReaderAt) (*fsys, error) {
+	raw := make([]byte, superblockSize)
+	if _, err := dev.ReadAt(raw, superblockOffset); err != nil {
+		return nil, fmt.Errorf("failed to read superblock: %w", err)
+	}
+	sb, err := parseSuperblock(raw)
+	if err != nil {
+		return nil, err
+	}
+	fsys := newFS(dev, sb)
+	ds := int(sb.descSize)
+	gdt := make([]byte, int(sb.groupCount)*ds)
+	if _, err := dev.ReadAt(gdt, int64(sb.firstDataBlock+1)*fsys.bs); err != nil {
+		return nil, fmt.Errorf("failed to read group descriptors: %w", err)
+	}
+	for g := range fsys.groups {
+		fsys.groups[g] = groupDesc{raw: gdt[g*ds : (g+1)*ds : (g+1)*ds]}
+	}
+	return fsys, nil
+}
+
+// corrupt returns an error for inconsistent on-disk structures.
+func corrupt(format string, args ...any) error {
+	return fmt.Errorf("corrupt ext4 image: "+format, args...)
+}
+
+// readBlock returns a block, from the dirty overlay if it was changed.
+// Callers must not modify the result.
+func (fsys *fsys) readBlock(n uint64) ([]byte, error) {
+	if d, ok := fsys.blocks[n]; ok {
+		return d.data, nil
+	}
+	if n >= fsys.sb.blocksCount {
+		return nil, corrupt("block %d beyond end of file system", n)
+	}
+	b := make([]byte, fsys.bs)
+	if _, err := fsys.dev.ReadAt(b, int64(n)*fsys.bs); err != nil {
+		return nil, fmt.Errorf("failed to read block %d: %w", n, err)
+	}
+	return b, nil
+}
+
+// inodeOffset returns the byte offset of an inode table entry.
+func (fsys *fsys) inodeOffset(num uint32) (int64, error) {
+	if num == 0 || num > fsys.sb.inodesCount {
+		return 0, corrupt("inode %d out of range", num)
+	}
+	group := (num - 1) / fsys.sb.inodesPerGroup
+	index := (num - 1) % fsys.sb.inodesPerGroup
+	table := fsys.groups[group].inodeTable()
+	return int64(table)*fsys.bs + int64(index)*int64(fsys.sb.inodeSize), nil
+}
+
+// inode returns an inode, from the dirty overlay if it was changed.
+func (fsys *fsys) inode(num uint32) (*inode, error) {
+	if in, ok := fsys.inodes[num]; ok {
+		return in, nil
+	}
+	off, err := fsys.inodeOffset(num)
+	if err != nil {
+		return nil, err
+	}
+	in := &inode{num: num, raw: make([]byte, fsys.sb.inodeSize)}
+	if _, err := fsys.dev.ReadAt(in.raw, off); err != nil {
+		return nil, fmt.Errorf("failed to read inode %d: %w", num, err)
+	}
+	return in, nil
+}
+
+// extentHeader decodes the header of an extent tree node.
+func extentHeader(node []byte) (entries, max, depth uint16, err error) {
+	if len(node) < extentEntryLen || le.Uint16(node) != extentMagic {
+		return 0, 0, 0, corrupt("bad extent header")
+	}
+	entries, max, depth = le.Uint16(node[2:]), le.Uint16(node[4:]), le.Uint16(node[6:])
+	if entries > max || extentEntryLen*(1+int(max)) > len(node) || depth > 5 {
+		return 0, 0, 0, corrupt("bad extent header")
+	}
+	return entries, max, depth, nil
+}
+
+// extents returns the block mapping of an inode in logical order. nodes,
+// when not nil, collects the blocks of the extent tree itself.
+func (fsys *fsys) extents(in *inode, nodes *[]uint64) ([]extent, error) {
+	if in.flags()&(flagInlineData) != 0 {
+		return nil, nil
+	}
+	if in.flags()&flagExtents == 0 {
+		if nodes != nil {
+			return nil, fmt.Errorf("%w: block-mapped inode %d", ErrUnsupported, in.num)
+		}
+		return fsys.blockMap(in)
+	}
+	var out []extent
+	if err := fsys.walkExtents(in.blockData(), -1, &out, nodes); err != nil {
+		return nil, fmt.Errorf("inode %d: %w", in.num, err)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].logical < out[j].logical })
+	return out, nil
+}
+
+func (fsys *fsys) walkExtents(node []byte, parentDepth int, out *[]extent, nodes *[]uint64) error {
+	entries, _, depth, err := extentHeader(node)
+	if err != nil {
+		return err
+	}
+	if parentDepth >= 0 && int(depth) != parentDepth-1 {
+		return corrupt("extent tree depth mismatch")
+	}
+	for i := 0; i < int(entries); i++ {
+		e := node[extentEntryLen*(i+1):]
+		if depth == 0 {
+			ext := extent{
+				logical: le.Uint32(e),
+				length:  uint32(le.Uint16(e[4:])),
+				start:   uint64(le.Uint16(e[6:]))<<32 | uint64(le.Uint32(e[8:])),
+			}
+			if ext.length > maxExtentLen {
+				ext.length -= maxExtentLen
+				ext.uninit = true
+			}
+			*out = append(*out, ext)
+			continue
+		}
+		leaf := uint64(le.Uint32(e[4:])) | uint64(le.Uint16(e[8:]))<<32
+		if nodes != nil {
+			*nodes = append(*nodes, leaf)
+		}
+		b, err := fsys.readBlock(leaf)
+		if err != nil {
+			return err
+		}
+		if err := fsys.walkExtents(b, int(depth), out, nodes); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// blockMap returns the mapping of an inode using ext2/ext3 indirect blocks.
+func (fsys *fsys) blockMap(in *inode) ([]extent, error) {
+	nblocks := uint64((in.size() + fsys.bs - 1) / fsys.bs)
+	var out []extent
+	add := func(logical, phys uint64) {
+		if phys == 0 || logical >= nblocks {
+			return
+		}
+		if n := len(out); n > 0 {
+			last := &out[n-1]
+			if uint64(last.logical)+uint64(last.length) == logical &&
+				last.start+uint64(last.length) == phys && last.length < maxExtentLen {
+				last.length++
+				return
+			}
+		}
+		out = append(out, extent{logical: uint32(logical), start: phys, length: 1})
+	}
+
+	ptrs := in.blockData()
+	for i := 0; i < 12; i++ {
+		add(uint64(i), uint64(le.Uint32(ptrs[4*i:])))
+	}
+	per := uint64(fsys.bs / 4)
+	logical, span := uint64(12), per
+	for level := 1; level <= 3 && logical < nblocks; level++ {
+		if root := le.Uint32(ptrs[4*(11+level):]); root != 0 {
+			if err := fsys.walkIndirect(uint64(root), level, logical, add); err != nil {
+				return nil, fmt.Errorf("inode %d: %w", in.num, err)
+			}
+		}
+		logical += span
+		span *= per
+	}
+	return out, nil
+}
+
+func (fsys *fsys) walkIndirect(blk uint64, level int, logical uint64, add func(logical, phys uint64)) error {
+	b, err := fsys.readBlock(blk)
+	if err != nil {
+		return err
+	}
+	per := uint64(fsys.bs / 4)
+	span := uint64(1)
+	for i := 1; i < level; i++ {
+		span *= per
+	}
+	for i := uint64(0); i < per; i++ {
+		p := uint64(le.Uint32(b[4*i:]))
+		switch {
+		case p == 0:
+		case level == 1:
+			add(logical+i, p)
+		default:
+			if err := fsys.walkIndirect(p, level-1, logical+i*span, add); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// mapBlock returns the extent holding a logical block, if any.
+func mapBlock(exts []extent, logical uint64) (extent, bool) {
+	i := sort.Search(len(exts), func(i int) bool {
+		return uint64(exts[i].logical)+uint64(exts[i].length) > logical
+	})
+	if i < len(exts) && uint64(exts[i].logical) <= logical {
+		return exts[i], true
+	}
+	return extent{}, false
+}
+
+// fastSymlink reports whether a symlink keeps its target in i_block.
+func (fsys *fsys) fastSymlink(in *inode) bool {
+	if !in.isSymlink() || in.flags()&flagInlineData != 0 || in.size() >= 60 {
+		return false
+	}
+	sectors := in.sectors(fsys.sb.blockSize)
+	if in.fileACL() != 0 {
+		sectors -= uint64(fsys.bs / 512)
+	}
+	return sectors == 0
+}
+
+// fileData reads the contents of an inode.
+type fileData struct {
+	fsys   *fsys
+	size   int64
+	exts   []extent
+	inline []byte
+}
+
+// data returns a reader for the contents of a file, directory or symlink.
+func (fsys *fsys) data(in *inode) (*fileData, error) {
+	d := &fileData{fsys: fsys, size: in.size()}
+	switch {
+	case in.flags()&flagEncrypt != 0:
+		return nil, fmt.Errorf("%w: encrypted inode %d", ErrUnsupported, in.num)
+	case in.flags()&flagInlineData != 0:
+		if d.size > int64(len(in.blockData())) {
+			return nil, fmt.Errorf("%w: inline data in extended attributes of inode %d", ErrUnsupported, in.num)
+		}
+		d.inline = in.blockData()[:d.size]
+	case fsys.fastSymlink(in):
+		d.inline = in.blockData()[:d.size]
+	default:
+		exts, err := fsys.extents(in, nil)
+		if err != nil {
+			return nil, err
+		}
+		d.exts = exts
+	}
+	return d, nil
+}
+
+// ReadAt implements io.ReaderAt. Holes and unwritten extents read as zeros.
+func (d *fileData) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, fmt.Errorf("negative offset")
+	}
+	if off >= d.size {
+		return 0, io.EOF
+	}
+	var eof error
+	if rest := d.size - off; int64(len(p)) > rest {
+		p, eof = p[:rest], io.EOF
+	}
+	if d.inline != nil {
+		return copy(p, d.inline[off:]), eof
+	}
+
+	bs := d.fsys.bs
+	n := 0
+	for n < len(p) {
+		pos := off + int64(n)
+		logical := uint64(pos / bs)
+		within := pos % bs
+		chunk := int64(len(p) - n)
+		ext, ok := mapBlock(d.exts, logical)
+		if !ok || ext.uninit {
+			if ok {
+				chunk = min(chunk, int64(uint64(ext.logical)+uint64(ext.length)-logical)*bs-within)
+			} else if i := sort.Search(len(d.exts), func(i int) bool { return uint64(d.exts[i].logical) > logical }); i < len(d.exts) {
+				chunk = min(chunk, int64(uint64(d.exts[i].logical)-logical)*bs-within)
+			}
+			clear(p[n : n+int(chunk)])
+			n += int(chunk)
+			continue
+		}
+		chunk = min(chunk, int64(uint64(ext.logical)+uint64(ext.length)-logical)*bs-within)
+		phys := ext.start + logical - uint64(ext.logical)
+		if _, err := d.fsys.dev.ReadAt(p[n:n+int(chunk)], int64(phys)*bs+within); err != nil {
+			return n, fmt.Errorf("failed to read block %d: %w", phys, err)
+		}
+		n += int(chunk)
+	}
+	return n, eof
+}
+
+// readLink returns the target of a symlink.
+func (fsys *fsys) readLink(in *inode) (string, error) {
+	if !in.isSymlink() {
+		return "", syscall.EINVAL
+	}
+	d, err := fsys.data(in)
+	if err != nil {
+		return "", err
+	}
+	b := make([]byte, d.size)
+	if _, err := d.ReadAt(b, 0); err != nil && err != io.EOF {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// parseDirBlock calls fn for each record in a linear directory block,
+// including unused ones, until fn returns false.
+func (fsys *fsys) parseDirBlock(b []byte, fn func(off, recLen int, de dirent) bool) error {
+	filetype := fsys.sb.incompat&incompatFiletype != 0
+	for off := 0; off < len(b); {
+		if off+dirEntryHeader > len(b) {
+			return corrupt("truncated directory entry")
+		}
+		recLen := int(le.Uint16(b[off+4:]))
+		if (recLen == 0 || recLen == 65535) && len(b) == 65536 {
+			recLen = len(b)
+		}
+		de := dirent{ino: le.Uint32(b[off:])}
+		nameLen := int(b[off+6])
+		if filetype {
+			de.typ = b[off+7]
+		} else {
+			nameLen = int(le.Uint16(b[off+6:]))
+		}
+		if recLen < dirEntryHeader || recLen%4 != 0 || off+recLen > len(b) || dirEntryHeader+nameLen > recLen {
+			return corrupt("bad directory entry at offset %d", off)
+		}
+		de.name = string(b[off+dirEntryHeader : off+dirEntryHeader+nameLen])
+		if !fn(off, recLen, de) {
+			return nil
+		}
+		off += recLen
+	}
+	return nil
+}
+
+// readDir returns the entries of a directory, including "." and "..".
+func (fsys *fsys) readDir(dir *inode) ([]dirent, error) {
+	if !dir.isDir() {
+		return nil, syscall.ENOTDIR
+	}
+	var out []dirent
+	collect := func(_, _ int, de dirent) bool {
+		if de.ino != 0 {
+			out = append(out, de)
+		}
+		return true
+	}
+
+	if dir.flags()&flagInlineData != 0 {
+		if dir.size() > int64(len(dir.blockData())) {
+			return nil, fmt.Errorf("%w: inline directory %d in extended attributes", ErrUnsupported, dir.num)
+		}
+		b := dir.blockData()
+		out = append(out, dirent{name: ".", ino: dir.num, typ: 2}, dirent{name: "..", ino: le.Uint32(b), typ: 2})
+		if err := fsys.parseDirBlock(b[4:dir.size()], collect); err != nil {
+			return nil, fmt.Errorf("directory %d: %w", dir.num, err)
+		}
+		return out, nil
+	}
+
+	exts, err := fsys.extents(dir, nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, ext := range exts {
+		if ext.uninit {
+			continue
+		}
+		for i := uint32(0); i < ext.length; i++ {
+			if int64(ext.logical+i)*fsys.bs >= dir.size() {
+				break
+			}
+			b, err := fsys.readBlock(ext.start + uint64(i))
+			if err != nil {
+				return nil, err
+			}
+			if err := fsys.parseDirBlock(b, collect); err != nil {
+				return nil, fmt.Errorf("directory %d: %w", dir.num, err)
+			}
+		}
+	}
+	return out, nil
+}
+
+// find looks a name up in a directory.
+func (fsys *fsys) find(dir *inode, name string) (dirent, bool, error) {
+	if fsys.dirs != nil {
+		if cached, ok := fsys.dirs[dir.num]; ok {
+			de, ok := cached[name]
+			return de, ok, nil
+		}
+	}
+	entries, err := fsys.readDir(dir)
+	if err != nil {
+		return dirent{}, false, err
+	}
+	if fsys.dirs != nil {
+		cached := make(map[string]dirent, len(entries))
+		for _, de := range entries {
+			cached[de.name] = de
+		}
+		fsys.dirs[dir.num] = cached
+		de, ok := cached[name]
+		return de, ok, nil
+	}
+	for _, de := range entries {
+		if de.name == name {
+			return de, true, nil
+		}
+	}
+	return dirent{}, false, nil
+}
+
+// cleanPath turns an image path, absolute or relative to the root, into
+// the slash-separated form io/fs uses, with "." for the root.
+func cleanPath(name string) string {
+	name = strings.TrimLeft(path.Clean("/"+name), "/")
+	if name == "" {
+		return "."
+	}
+	return name
+}
+
+// resolve walks a path from the root. Symlinks in the middle of the path
+// are followed, the last element only when follow is set; absolute
+// targets resolve against the image root. It returns the inode and its
+// path with symlinks resolved.
+func (fsys *fsys) resolve(name string, follow bool) (*inode, string, error) {
+	links := 0
+walk:
+	for {
+		cur, err := fsys.inode(rootIno)
+		if err != nil {
+			return nil, "", err
+		}
+		resolved := "."
+		if name == "." {
+			return cur, resolved, nil
+		}
+		parts := strings.Split(name, "/")
+		for i, part := range parts {
+			if !cur.isDir() {
+				return nil, "", syscall.ENOTDIR
+			}
+			de, ok, err := fsys.find(cur, part)
+			if err != nil {
+				return nil, "", err
+			}
+			if !ok {
+				return nil, "", fs.ErrNotExist
+			}
+			in, err := fsys.inode(de.ino)
+			if err != nil {
+				return nil, "", err
+			}
+			last := i == len(parts)-1
+			if in.isSymlink() && (!last || follow) {
+				if links++; links > maxSymlinks {
+					return nil, "", syscall.ELOOP
+				}
+				target, err := fsys.readLink(in)
+				if err != nil {
+					return nil, "", err
+				}
+				if !path.IsAbs(target) {
+					target = path.Join(resolved, target)
+				}
+				name = cleanPath(path.Join(append([]string{target}, parts[i+1:]...)...))
+				continue walk
+			}
+			cur, resolved = in, path.Join(resolved, part)
+		}
+		return cur, resolved, nil
+	}
+}
@@ -0,0 +1,447 @@
+package ext4
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// Image is a read-only view of an ext4 image. It implements fs.FS along
+// with fs.ReadDirFS, fs.ReadFileFS, fs.StatFS and fs.ReadLinkFS. Names may
+// be given relative to the root or as absolute paths inside the image.
+type Image struct {
+	f  *os.File
+	fs *fsys
+}
+
+var (
+	_ fs.ReadDirFS  = (*Image)(nil)
+	_ fs.ReadFileFS = (*Image)(nil)
+	_ fs.StatFS     = (*Image)(nil)
+	_ fs.ReadLinkFS = (*Image)(nil)
+)
+
+// Open opens an image for reading.
+func Open(path string) (*Image, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	fsys, err := openFS(f)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &Image{f: f, fs: fsys}, nil
+}
+
+// Close closes the image.
+func (img *Image) Close() error {
+	return img.f.Close()
+}
+
+// Label returns the volume label.
+func (img *Image) Label() string {
+	return img.fs.sb.label()
+}
+
+// lookup resolves a name for an io/fs operation.
+func (img *Image) lookup(op, name string, follow bool) (*inode, string, error) {
+	clean := cleanPath(name)
+	if !fs.ValidPath(clean) {
+		return nil, "", &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	in, _, err := img.fs.resolve(clean, follow)
+	if err != nil {
+		return nil, "", &fs.PathError{Op: op, Path: name, Err: err}
+	}
+	return in, clean, nil
+}
+
+// Open implements fs.FS.
+func (img *Image) Open(name string) (fs.File, error) {
+	in, clean, err := img.lookup("open", name, true)
+	if err != nil {
+		return nil, err
+	}
+	f := &file{img: img, info: img.info(path.Base(clean), in)}
+	if !in.isDir() {
+		if f.data, err = img.fs.data(in); err != nil {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+		}
+	}
+	return f, nil
+}
+
+// Stat implements fs.StatFS, following symlinks.
+func (img *Image) Stat(name string) (fs.FileInfo, error) {
+	in, clean, err := img.lookup("stat", name, true)
+	if err != nil {
+		return nil, err
+	}
+	return img.info(path.Base(clean), in), nil
+}
+
+// Lstat implements fs.ReadLinkFS; it does not follow a final symlink.
+func (img *Image) Lstat(name string) (fs.FileInfo, error) {
+	in, clean, err := img.lookup("lstat", name, false)
+	if err != nil {
+		return nil, err
+	}
+	return img.info(path.Base(clean), in), nil
+}
+
+// ReadLink implements fs.ReadLinkFS.
+func (img *Image) ReadLink(name string) (string, error) {
+	in, _, err := img.lookup("readlink", name, false)
+	if err != nil {
+		return "", err
+	}
+	target, err := img.fs.readLink(in)
+	if err != nil {
+		return "", &fs.PathError{Op: "readlink", Path: name, Err: err}
+	}
+	return target, nil
+}
+
+// ReadDir implements fs.ReadDirFS. Entries are sorted by name.
+func (img *Image) ReadDir(name string) ([]fs.DirEntry, error) {
+	in, _, err := img.lookup("readdir", name, true)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := img.readDir(in)
+	if err != nil {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: err}
+	}
+	return entries, nil
+}
+
+func (img *Image) readDir(dir *inode) ([]fs.DirEntry, error) {
+	raw, err := img.fs.readDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]fs.DirEntry, 0, len(raw))
+	for _, de := range raw {
+		if de.name == "." || de.name == ".." {
+			continue
+		}
+		in, err := img.fs.inode(de.ino)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, fs.FileInfoToDirEntry(img.info(de.name, in)))
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries, nil
+}
+
+// ReadFile implements fs.ReadFileFS.
+func (img *Image) ReadFile(name string) ([]byte, error) {
+	in, _, err := img.lookup("readfile", name, true)
+	if err != nil {
+		return nil, err
+	}
+	if in.isDir() {
+		return nil, &fs.PathError{Op: "readfile", Path: name, Err: syscall.EISDIR}
+	}
+	d, err := img.fs.data(in)
+	if err != nil {
+		return nil, &fs.PathError{Op: "readfile", Path: name, Err: err}
+	}
+	b := make([]byte, d.size)
+	if _, err := d.ReadAt(b, 0); err != nil && err != io.EOF {
+		return nil, &fs.PathError{Op: "readfile", Path: name, Err: err}
+	}
+	return b, nil
+}
+
+// Extract copies the file or directory tree at name to dest on the host,
+// keeping modes, timestamps and symlinks. Ownership and device nodes are
+// only restored when running as root. A directory's contents are merged
+// into dest, which is created if missing.
+func (img *Image) Extract(name, dest string) error {
+	in, clean, err := img.lookup("extract", name, true)
+	if err != nil {
+		return err
+	}
+	x := extractor{img: img, links: make(map[uint32]string), root: os.Geteuid() == 0}
+	if err := x.extract(in, clean, dest); err != nil {
+		return err
+	}
+	// Directory timestamps are set last, after their contents are written.
+	for i := len(x.dirs) - 1; i >= 0; i-- {
+		d := x.dirs[i]
+		if err := os.Chtimes(d.path, d.in.time(timeAccess), d.in.time(timeModify)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type extractor struct {
+	img   *Image
+	links map[uint32]string
+	root  bool
+	dirs  []struct {
+		path string
+		in   *inode
+	}
+}
+
+func (x *extractor) extract(in *inode, name, dest string) error {
+	mode := fileMode(in.mode())
+	if in.links() > 1 && !in.isDir() {
+		if first, ok := x.links[in.num]; ok {
+			_ = os.Remove(dest)
+			return os.Link(first, dest)
+		}
+		x.links[in.num] = dest
+	}
+
+	switch mode.Type() {
+	case fs.ModeDir:
+		if err := os.MkdirAll(dest, 0o700); err != nil {
+			return err
+		}
+		entries, err := x.img.fs.readDir(in)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		for _, de := range entries {
+			if de.name == "." || de.name == ".." {
+				continue
+			}
+			child, err := x.img.fs.inode(de.ino)
+			if err != nil {
+				return err
+			}
+			if err := x.extract(child, path.Join(name, de.name), filepath.Join(dest, de.name)); err != nil {
+				return err
+			}
+		}
+		x.dirs = append(x.dirs, struct {
+			path string
+			in   *inode
+		}{dest, in})
+	case fs.ModeSymlink:
+		target, err := x.img.fs.readLink(in)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		_ = os.Remove(dest)
+		if err := os.Symlink(target, dest); err != nil {
+			return err
+		}
+		return x.chown(dest, in)
+	case fs.ModeNamedPipe:
+		_ = os.Remove(dest)
+		if err := unix.Mkfifo(dest, uint32(mode.Perm())); err != nil {
+			return err
+		}
+	case fs.ModeDevice, fs.ModeDevice | fs.ModeCharDevice:
+		if !x.root {
+			return nil
+		}
+		_ = os.Remove(dest)
+		major, minor := deviceNumber(in)
+		typ := uint32(unix.S_IFBLK)
+		if mode&fs.ModeCharDevice != 0 {
+			typ = unix.S_IFCHR
+		}
+		if err := unix.Mknod(dest, typ|uint32(mode.Perm()), int(unix.Mkdev(major, minor))); err != nil {
+			return err
+		}
+	case fs.ModeSocket:
+		return nil
+	default:
+		d, err := x.img.fs.data(in)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		_ = os.Remove(dest)
+		f, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(f, io.NewSectionReader(d, 0, d.size))
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := x.chown(dest, in); err != nil {
+		return err
+	}
+	if err := os.Chmod(dest, mode&(fs.ModePerm|fs.ModeSetuid|fs.ModeSetgid|fs.ModeSticky)); err != nil {
+		return err
+	}
+	if mode.IsDir() {
+		return nil
+	}
+	return os.Chtimes(dest, in.time(timeAccess), in.time(timeModify))
+}
+
+func (x *extractor) chown(dest string, in *inode) error {
+	if !x.root {
+		return nil
+	}
+	return os.Lchown(dest, int(in.uid()), int(in.gid()))
+}
+
+// deviceNumber decodes the device number of a device node.
+func deviceNumber(in *inode) (major, minor uint32) {
+	b := in.blockData()
+	if old := le.Uint32(b); old != 0 {
+		return old >> 8 & 0xFF, old & 0xFF
+	}
+	dev := le.Uint32(b[4:])
+	return dev >> 8 & 0xFFF, dev&0xFF | dev>>12&0xFFF00
+}
+
+// fileMode converts an i_mode to an fs.FileMode.
+func fileMode(m uint16) fs.FileMode {
+	mode := fs.FileMode(m & 0o777)
+	if m&0o4000 != 0 {
+		mode |= fs.ModeSetuid
+	}
+	if m&0o2000 != 0 {
+		mode |= fs.ModeSetgid
+	}
+	if m&0o1000 != 0 {
+		mode |= fs.ModeSticky
+	}
+	switch m & modeType {
+	case modeDir:
+		mode |= fs.ModeDir
+	case modeLink:
+		mode |= fs.ModeSymlink
+	case modeFIFO:
+		mode |= fs.ModeNamedPipe
+	case modeSocket:
+		mode |= fs.ModeSocket
+	case modeChar:
+		mode |= fs.ModeDevice | fs.ModeCharDevice
+	case modeBlock:
+		mode |= fs.ModeDevice
+	}
+	return mode
+}
+
+// info returns the fs.FileInfo of an inode.
+func (img *Image) info(name string, in *inode) *fileInfo {
+	return &fileInfo{name: name, in: in, fsys: img.fs}
+}
+
+// fileInfo implements fs.FileInfo. Sys returns a *tar.Header, so
+// tar.FileInfoHeader copies ownership and device numbers from it.
+type fileInfo struct {
+	name string
+	in   *inode
+	fsys *fsys
+}
+
+func (fi *fileInfo) Name() string       { return fi.name }
+func (fi *fileInfo) Size() int64        { return fi.in.size() }
+func (fi *fileInfo) Mode() fs.FileMode  { return fileMode(fi.in.mode()) }
+func (fi *fileInfo) ModTime() time.Time { return fi.in.time(timeModify) }
+func (fi *fileInfo) IsDir() bool        { return fi.in.isDir() }
+
+func (fi *fileInfo) Sys() any {
+	hdr := &tar.Header{
+		Uid:        int(fi.in.uid()),
+		Gid:        int(fi.in.gid()),
+		AccessTime: fi.in.time(timeAccess),
+		ChangeTime: fi.in.time(timeChange),
+	}
+	if fi.in.mode()&modeType == modeChar || fi.in.mode()&modeType == modeBlock {
+		major, minor := deviceNumber(fi.in)
+		hdr.Devmajor, hdr.Devminor = int64(major), int64(minor)
+	}
+	return hdr
+}
+
+// file implements fs.File, io.ReaderAt and io.Seeker for files and
+// fs.ReadDirFile for directories.
+type file struct {
+	img     *Image
+	info    *fileInfo
+	data    *fileData
+	off     int64
+	entries []fs.DirEntry
+	listed  bool
+}
+
+func (f *file) Stat() (fs.FileInfo, error) { return f.info, nil }
+func (f *file) Close() error               { return nil }
+
+func (f *file) Read(p []byte) (int, error) {
+	if f.data == nil {
+		return 0, &fs.PathError{Op: "read", Path: f.info.name, Err: syscall.EISDIR}
+	}
+	n, err := f.data.ReadAt(p, f.off)
+	f.off += int64(n)
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
+	return n, err
+}
+
+func (f *file) ReadAt(p []byte, off int64) (int, error) {
+	if f.data == nil {
+		return 0, &fs.PathError{Op: "read", Path: f.info.name, Err: syscall.EISDIR}
+	}
+	return f.data.ReadAt(p, off)
+}
+
+func (f *file) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += f.off
+	case io.SeekEnd:
+		offset += f.info.Size()
+	}
+	if offset < 0 {
+		return 0, &fs.PathError{Op: "seek", Path: f.info.name, Err: fs.ErrInvalid}
+	}
+	f.off = offset
+	return offset, nil
+}
+
+func (f *file) ReadDir(n int) ([]fs.DirEntry, error) {
+	if !f.info.IsDir() {
+		return nil, &fs.PathError{Op: "readdir", Path: f.info.name, Err: syscall.ENOTDIR}
+	}
+	if !f.listed {
+		entries, err := f.img.readDir(f.info.in)
+		if err != nil {
+			return nil, &fs.PathError{Op: "readdir", Path: f.info.name, Err: err}
+		}
+		f.entries, f.listed = entries, true
+	}
+	if n <= 0 {
+		entries := f.entries
+		f.entries = nil
+		return entries, nil
+	}
+	if len(f.entries) == 0 {
+		return nil, io.EOF
+	}
+	n = min(n, len(f.entries))
+	entries := f.entries[:n]
+	f.entries = f.entries[n:]
+	return entries, nil
+}
@@ -0,0 +1,227 @@
+package ext4
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+)
+
+// Inject changes an existing image through an Editor and commits the
+// result. Images with features the Editor cannot change in place, or
+// changes it cannot make there, are rebuilt: the contents are copied into
+// a new image of the same size, apply runs again on that and the new image
+// replaces the old one. Extended attributes are not carried over by a
+// rebuild. apply must therefore be safe to run twice.
+func Inject(path string, apply func(*Editor) error) error {
+	err := inject(path, apply)
+	if !errors.Is(err, ErrUnsupported) {
+		return err
+	}
+	return rebuild(path, apply)
+}
+
+func inject(path string, apply func(*Editor) error) error {
+	e, err := openEditor(path)
+	if err != nil {
+		return err
+	}
+	if err := apply(e); err != nil {
+		e.abort()
+		return err
+	}
+	return e.Close()
+}
+
+// rebuild copies an image into a new one, applies the changes and swaps
+// the new image in.
+func rebuild(path string, apply func(*Editor) error) error {
+	src, err := Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	info, err := src.f.Stat()
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+"-*")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+	tmp.Close()
+	defer os.Remove(tmpPath)
+
+	e, err := Create(tmpPath, Options{
+		Size:   info.Size(),
+		Inodes: src.fs.sb.inodesCount,
+		Label:  src.Label(),
+		UUID:   src.fs.sb.uuid,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to rebuild %s: %w", path, err)
+	}
+	if err := e.copyImage(src.fs); err != nil {
+		e.abort()
+		return fmt.Errorf("failed to rebuild %s: %w", path, err)
+	}
+	if err := apply(e); err != nil {
+		e.abort()
+		return err
+	}
+	if err := e.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmpPath, info.Mode().Perm()); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+// copyImage adds the whole tree of another image.
+func (e *Editor) copyImage(src *fsys) error {
+	root, err := src.inode(rootIno)
+	if err != nil {
+		return err
+	}
+	if err := e.Add(inodeHeader(".", root), nil); err != nil {
+		return err
+	}
+	return e.copyTree(src, root, ".", make(map[uint32]string))
+}
+
+func (e *Editor) copyTree(src *fsys, dir *inode, name string, links map[uint32]string) error {
+	entries, err := src.readDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, de := range entries {
+		if de.name == "." || de.name == ".." {
+			continue
+		}
+		in, err := src.inode(de.ino)
+		if err != nil {
+			return err
+		}
+		p := path.Join(name, de.name)
+		hdr := inodeHeader(p, in)
+		var r io.Reader
+		switch {
+		case in.mode()&modeType == modeSocket:
+			continue
+		case in.isDir():
+			if err := e.Add(hdr, nil); err != nil {
+				return err
+			}
+			if err := e.copyTree(src, in, p, links); err != nil {
+				return err
+			}
+			continue
+		case in.links() > 1 && links[in.num] != "":
+			hdr.Typeflag, hdr.Linkname = tar.TypeLink, links[in.num]
+		case in.isSymlink():
+			if hdr.Linkname, err = src.readLink(in); err != nil {
+				return err
+			}
+		case in.isRegular():
+			d, err := src.data(in)
+			if err != nil {
+				return err
+			}
+			hdr.Size, r = d.size, io.NewSectionReader(d, 0, d.size)
+		}
+		if in.links() > 1 {
+			links[in.num] = p
+		}
+		if err := e.Add(hdr, r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// inodeHeader describes an inode as a tar header, without its contents.
+func inodeHeader(name string, in *inode) *tar.Header {
+	hdr := &tar.Header{
+		Name:       name,
+		Mode:       int64(in.mode() & 0o7777),
+		Uid:        int(in.uid()),
+		Gid:        int(in.gid()),
+		ModTime:    in.time(timeModify),
+		AccessTime: in.time(timeAccess),
+		ChangeTime: in.time(timeChange),
+	}
+	switch in.mode() & modeType {
+	case modeDir:
+		hdr.Typeflag = tar.TypeDir
+	case modeLink:
+		hdr.Typeflag = tar.TypeSymlink
+	case modeFIFO:
+		hdr.Typeflag = tar.TypeFifo
+	case modeChar, modeBlock:
+		hdr.Typeflag = tar.TypeBlock
+		if in.mode()&modeType == modeChar {
+			hdr.Typeflag = tar.TypeChar
+		}
+		major, minor := deviceNumber(in)
+		hdr.Devmajor, hdr.Devminor = int64(major), int64(minor)
+	default:
+		hdr.Typeflag = tar.TypeReg
+	}
+	return hdr
+}
+
+// WriteFile writes a regular file owned by root into an existing image,
+// creating missing parent directories and replacing any file of the same
+// name.
+func WriteFile(imagePath, name string, data []byte, perm fs.FileMode) error {
+	return WriteFileOwned(imagePath, name, data, perm, 0, 0)
+}
+
+// WriteFileOwned is like WriteFile but gives the file the owner uid and
+// group gid.
+func WriteFileOwned(imagePath, name string, data []byte, perm fs.FileMode, uid, gid int) error {
+	hdr := &tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Mode:     int64(perm.Perm()),
+		Uid:      uid,
+		Gid:      gid,
+		Size:     int64(len(data)),
+		ModTime:  time.Now(),
+	}
+	return Inject(imagePath, func(e *Editor) error {
+		h := *hdr
+		return e.Add(&h, bytes.NewReader(data))
+	})
+}
+
+// InjectDir copies the tree under dir into the root of an existing image,
+// replacing files that already exist.
+func InjectDir(imagePath, dir string) error {
+	return Inject(imagePath, func(e *Editor) error {
+		return e.AddDir(dir)
+	})
+}
+
+// CreateFromDir formats a new image holding a copy of the tree under dir.
+func CreateFromDir(path, dir string, opts Options) error {
+	e, err := Create(path, opts)
+	if err != nil {
+		return err
+	}
+	if err := e.AddDir(dir); err != nil {
+		e.abort()
+		os.Remove(path)
+		return err
+	}
+	return e.Close()
+}
@@ -0,0 +1,289 @@
+package ext4
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mkfs formats an image with mke2fs so the injector is checked against
+// the layouts real tools produce.
+func mkfs(t *testing.T, size int64, src string, args ...string) string {
+	t.Helper()
+	mke2fs, err := exec.LookPath("mke2fs")
+	if err != nil {
+		t.Skip("mke2fs not installed")
+	}
+	path := filepath.Join(t.TempDir(), "image.ext4")
+	f, err := os.Create(path)
+	require.NoError(t, err)
+	require.NoError(t, f.Truncate(size))
+	require.NoError(t, f.Close())
+
+	args = append([]string{"-q", "-F", "-L", "mkfs"}, args...)
+	if src != "" {
+		args = append(args, "-d", src)
+	}
+	out, err := exec.Command(mke2fs, append(args, path)...).CombinedOutput()
+	require.NoError(t, err, "mke2fs: %s", out)
+	return path
+}
+
+func TestInject_MkfsImages(t *testing.T) {
+	src := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(src, "etc"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(src, "etc/hostname"), []byte("old\n"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(src, "etc/blob"), pattern(2<<20), 0o644))
+
+	overlay := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(overlay, "etc"), 0o700))
+	require.NoError(t, os.WriteFile(filepath.Join(overlay, "etc/hostname"), []byte("new\n"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(overlay, "etc/blob"), []byte("small"), 0o644))
+	require.NoError(t, os.MkdirAll(filepath.Join(overlay, "data"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(overlay, "data/large"), pattern(5<<20), 0o600))
+
+	tests := []struct {
+		name        string
+		args        []string
+		wantRebuild bool
+	}{
+		{name: "ext4 defaults", args: []string{"-t", "ext4"}},
+		{name: "1k blocks", args: []string{"-t", "ext4", "-b", "1024"}},
+		{name: "no metadata_csum", args: []string{"-t", "ext4", "-O", "^metadata_csum"}},
+		{name: "uninit_bg", args: []string{"-t", "ext4", "-O", "^metadata_csum,uninit_bg"}},
+		{name: "32-bit descriptors", args: []string{"-t", "ext4", "-b", "2048", "-O", "^64bit"}},
+		{name: "ext2", args: []string{"-t", "ext2"}, wantRebuild: true},
+		{name: "inline data", args: []string{"-t", "ext4", "-O", "inline_data"}, wantRebuild: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := mkfs(t, 32<<20, src, tt.args...)
+			before, err := Open(path)
+			require.NoError(t, err)
+			sb := *before.fs.sb
+			before.Close()
+
+			require.NoError(t, WriteFile(path, "/run/secrets/token", []byte("s3cret"), 0o400))
+			require.NoError(t, InjectDir(path, overlay))
+			fsck(t, path)
+
+			img, err := Open(path)
+			require.NoError(t, err)
+			defer img.Close()
+			assert.Equal(t, "mkfs", img.Label())
+			assert.Equal(t, sb.uuid, img.fs.sb.uuid)
+			if tt.wantRebuild {
+				assert.Equal(t, uint32(formatIncompat), img.fs.sb.incompat)
+			} else {
+				assert.Equal(t, sb.incompat, img.fs.sb.incompat, "image not edited in place")
+				assert.Equal(t, sb.roCompat, img.fs.sb.roCompat, "image not edited in place")
+			}
+
+			for name, want := range map[string][]byte{
+				"run/secrets/token": []byte("s3cret"),
+				"etc/hostname":      []byte("new\n"),
+				"etc/blob":          []byte("small"),
+				"data/large":        pattern(5 << 20),
+			} {
+				got, err := img.ReadFile(name)
+				require.NoError(t, err, name)
+				assert.True(t, bytes.Equal(want, got), name)
+			}
+			info, err := img.Stat("run/secrets/token")
+			require.NoError(t, err)
+			assert.Equal(t, os.FileMode(0o400), info.Mode())
+			info, err = img.Stat("etc")
+			require.NoError(t, err)
+			assert.Equal(t, os.ModeDir|0o755, info.Mode(), "existing directory metadata replaced")
+		})
+	}
+}
+
+func TestInject_Unclean(t *testing.T) {
+	path := mkfs(t, 8<<20, "", "-t", "ext4")
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	require.NoError(t, err)
+	// Clear the cleanly-unmounted state, as a mounted image would have.
+	_, err = f.WriteAt([]byte{0, 0}, superblockOffset+0x3A)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	err = WriteFile(path, "etc/hostname", []byte("x"), 0o644)
+	assert.ErrorContains(t, err, "not cleanly unmounted")
+}
+
+func TestWriteFileOwned(t *testing.T) {
+	path := mkfs(t, 8<<20, "", "-t", "ext4")
+
+	require.NoError(t, WriteFileOwned(path, "/run/secrets/token", []byte("s3cret"), 0o440, 70, 71))
+	fsck(t, path)
+
+	img, err := Open(path)
+	require.NoError(t, err)
+	defer img.Close()
+	info, err := img.Stat("run/secrets/token")
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o440), info.Mode())
+	hdr := info.Sys().(*tar.Header)
+	assert.Equal(t, 70, hdr.Uid)
+	assert.Equal(t, 71, hdr.Gid)
+}
+
+func TestInject_RebuildKeepsMetadata(t *testing.T) {
+	src := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(src, "bin"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(src, "bin/sh"), pattern(300<<10), 0o755))
+	require.NoError(t, os.Symlink("sh", filepath.Join(src, "bin/bash")))
+	require.NoError(t, os.Link(filepath.Join(src, "bin/sh"), filepath.Join(src, "bin/ash")))
+	path := mkfs(t, 16<<20, src, "-t", "ext2")
+	require.NoError(t, os.Chmod(path, 0o640))
+
+	require.NoError(t, WriteFile(path, "etc/motd", []byte("hi"), 0o644))
+	fsck(t, path)
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o640), info.Mode().Perm())
+	assert.Equal(t, int64(16<<20), info.Size())
+	entries, err := os.ReadDir(filepath.Dir(path))
+	require.NoError(t, err)
+	assert.Len(t, entries, 1, "temporary image left behind")
+
+	img, err := Open(path)
+	require.NoError(t, err)
+	defer img.Close()
+	target, err := img.ReadLink("bin/bash")
+	require.NoError(t, err)
+	assert.Equal(t, "sh", target)
+	sh, _, err := img.fs.resolve("bin/sh", false)
+	require.NoError(t, err)
+	ash, _, err := img.fs.resolve("bin/ash", false)
+	require.NoError(t, err)
+	assert.Equal(t, sh.num, ash.num, "hard link not kept")
+	assert.Equal(t, uint16(2), sh.links())
+	got, err := img.ReadFile("bin/ash")
+	require.NoError(t, err)
+	assert.True(t, bytes.Equal(pattern(300<<10), got))
+}
+
+// dirtyJournal logs transactions in an image's journal with debugfs and
+// leaves them unreplayed, as a guest stopped uncleanly does. Each entry
+// of blocks maps a file in the image to the data logged for its first
+// block; revoke names files whose first block is revoked afterwards.
+func dirtyJournal(t *testing.T, path string, blocks map[string][]byte, revoke ...string) {
+	t.Helper()
+	debugfs, err := exec.LookPath("debugfs")
+	if err != nil {
+		t.Skip("debugfs not installed")
+	}
+	firstBlock := func(name string) string {
+		out, err := exec.Command(debugfs, "-R", "blocks "+name, path).Output()
+		require.NoError(t, err)
+		fields := strings.Fields(string(out))
+		require.NotEmpty(t, fields, "no blocks for %s", name)
+		return fields[0]
+	}
+
+	cmds := []string{"jo"}
+	for name, data := range blocks {
+		src := filepath.Join(t.TempDir(), "block")
+		require.NoError(t, os.WriteFile(src, data, 0o644))
+		cmds = append(cmds, fmt.Sprintf("jw -b %s %s", firstBlock(name), src))
+	}
+	for _, name := range revoke {
+		cmds = append(cmds, "jw -r "+firstBlock(name))
+	}
+	cmds = append(cmds, "jc")
+	script := filepath.Join(t.TempDir(), "cmds")
+	require.NoError(t, os.WriteFile(script, []byte(strings.Join(cmds, "\n")+"\n"), 0o644))
+	out, err := exec.Command(debugfs, "-w", "-f", script, path).CombinedOutput()
+	require.NoError(t, err, "debugfs: %s", out)
+
+	raw := make([]byte, superblockSize)
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+	_, err = f.ReadAt(raw, superblockOffset)
+	require.NoError(t, err)
+	require.NotZero(t, le.Uint32(raw[0x60:])&incompatRecover, "journal left clean")
+}
+
+func TestOpen_DirtyJournal(t *testing.T) {
+	src := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(src, "etc"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(src, "etc/hostname"), []byte("old\n"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(src, "etc/revoked"), []byte("kept\n"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(src, "etc/escaped"), []byte("plain\n"), 0o644))
+
+	block := func(head []byte) []byte {
+		b := bytes.Repeat([]byte{'x'}, 4096)
+		copy(b, head)
+		return b
+	}
+	escaped := []byte{0xC0, 0x3B, 0x39, 0x98, '\n'}
+
+	for _, args := range [][]string{
+		{"-t", "ext4"},
+		{"-t", "ext4", "-O", "^64bit,^metadata_csum"},
+	} {
+		t.Run(strings.Join(args, " "), func(t *testing.T) {
+			path := mkfs(t, 16<<20, src, args...)
+			dirtyJournal(t, path, map[string][]byte{
+				"/etc/hostname": block([]byte("new\n")),
+				"/etc/revoked":  block([]byte("lost\n")),
+				"/etc/escaped":  block(escaped),
+			}, "/etc/revoked")
+
+			// e2fsck replays the journal the way the kernel does on mount.
+			replayed := filepath.Join(t.TempDir(), "replayed.ext4")
+			data, err := os.ReadFile(path)
+			require.NoError(t, err)
+			require.NoError(t, os.WriteFile(replayed, data, 0o644))
+			if e2fsck, err := exec.LookPath("e2fsck"); err == nil {
+				out, err := exec.Command(e2fsck, "-fy", replayed).CombinedOutput()
+				var exit *exec.ExitError
+				if errors.As(err, &exit) && exit.ExitCode() == 1 {
+					err = nil // errors corrected: the journal was replayed
+				}
+				require.NoError(t, err, "e2fsck: %s", out)
+			}
+
+			want := map[string][]byte{
+				"etc/hostname": []byte("new\n"),
+				"etc/revoked":  []byte("kept\n"),
+				"etc/escaped":  block(escaped)[:len("plain\n")],
+			}
+			for _, p := range []string{path, replayed} {
+				img, err := Open(p)
+				require.NoError(t, err)
+				for name, data := range want {
+					got, err := img.ReadFile(name)
+					require.NoError(t, err, name)
+					assert.Equal(t, data, got, "%s in %s", name, filepath.Base(p))
+				}
+				img.Close()
+			}
+
+			require.NoError(t, WriteFile(path, "etc/motd", []byte("hi"), 0o644))
+			fsck(t, path)
+			img, err := Open(path)
+			require.NoError(t, err)
+			defer img.Close()
+			assert.Equal(t, uint32(formatIncompat), img.fs.sb.incompat, "image not rebuilt")
+			for name, data := range want {
+				got, err := img.ReadFile(name)
+				require.NoError(t, err, name)
+				assert.Equal(t, data, got, name)
+			}
+		})
+	}
+}
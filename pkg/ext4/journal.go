@@ -0,0 +1,282 @@
+package ext4
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+var be = binary.BigEndian
+
+// JBD2 journal constants; the journal is stored big-endian.
+const (
+	journalMagic = 0xC03B3998
+
+	journalDescriptor = 1
+	journalCommit     = 2
+	journalSuperV1    = 3
+	journalSuperV2    = 4
+	journalRevoke     = 5
+
+	journalIncompatRevoke     = 0x1
+	journalIncompat64Bit      = 0x2
+	journalIncompatAsync      = 0x4
+	journalIncompatCsumV2     = 0x8
+	journalIncompatCsumV3     = 0x10
+	journalIncompatFastCommit = 0x20
+
+	journalReplayIncompat = journalIncompatRevoke | journalIncompat64Bit |
+		journalIncompatAsync | journalIncompatCsumV2 | journalIncompatCsumV3
+
+	journalFlagEscape   = 0x1
+	journalFlagSameUUID = 0x2
+	journalFlagLastTag  = 0x8
+)
+
+// journalBlock is a file system block logged in the journal: phys holds
+// its newest committed copy. escaped blocks started with the journal magic,
+// which the journal stores zeroed.
+type journalBlock struct {
+	phys    uint64
+	escaped bool
+}
+
+// journalTxn is a transaction found in the journal.
+type journalTxn struct {
+	seq     uint32
+	blocks  map[uint64]journalBlock
+	order   []uint64
+	revokes []uint64
+}
+
+// tidAfter reports whether transaction a is newer than b, allowing for
+// sequence numbers wrapping around.
+func tidAfter(a, b uint32) bool { return int32(a-b) > 0 }
+
+// replayJournal returns the blocks the committed transactions of an
+// image's internal journal write, as the kernel replays them when an image
+// that was not cleanly unmounted is mounted. It returns nil when the
+// journal is empty.
+func (fsys *fsys) replayJournal() (map[uint64]journalBlock, error) {
+	sb := fsys.sb
+	jino := le.Uint32(sb.raw[0xE0:])
+	if sb.compat&compatHasJournal == 0 || jino == 0 {
+		return nil, fmt.Errorf("%w: recovery needed without an internal journal", ErrUnsupported)
+	}
+	in, err := fsys.inode(jino)
+	if err != nil {
+		return nil, err
+	}
+	exts, err := fsys.extents(in, nil)
+	if err != nil {
+		return nil, err
+	}
+	phys := func(logical uint32) (uint64, error) {
+		ext, ok := mapBlock(exts, uint64(logical))
+		if !ok || ext.uninit {
+			return 0, corrupt("journal block %d is not mapped", logical)
+		}
+		return ext.start + uint64(logical) - uint64(ext.logical), nil
+	}
+	read := func(logical uint32) ([]byte, error) {
+		p, err := phys(logical)
+		if err != nil {
+			return nil, err
+		}
+		return fsys.readBlock(p)
+	}
+
+	jsb, err := read(0)
+	if err != nil {
+		return nil, err
+	}
+	if be.Uint32(jsb) != journalMagic {
+		return nil, corrupt("bad journal superblock magic")
+	}
+	var incompat uint32
+	switch be.Uint32(jsb[0x4:]) {
+	case journalSuperV1:
+	case journalSuperV2:
+		incompat = be.Uint32(jsb[0x28:])
+	default:
+		return nil, corrupt("bad journal superblock type %d", be.Uint32(jsb[0x4:]))
+	}
+	if unknown := incompat &^ journalReplayIncompat; unknown != 0 {
+		return nil, fmt.Errorf("%w: journal features %#x", ErrUnsupported, unknown)
+	}
+	if be.Uint32(jsb[0xC:]) != sb.blockSize {
+		return nil, corrupt("journal block size %d differs from %d", be.Uint32(jsb[0xC:]), sb.blockSize)
+	}
+	maxLen, first := be.Uint32(jsb[0x10:]), be.Uint32(jsb[0x14:])
+	seq, start := be.Uint32(jsb[0x18:]), be.Uint32(jsb[0x1C:])
+	if start == 0 {
+		return nil, nil
+	}
+	if first == 0 || first >= maxLen || start < first || start >= maxLen {
+		return nil, corrupt("bad journal geometry")
+	}
+
+	tagLen := 12
+	switch {
+	case incompat&journalIncompatCsumV3 != 0:
+		tagLen = 16
+	case incompat&journalIncompatCsumV2 != 0:
+		tagLen += 2
+	}
+	if incompat&journalIncompatCsumV3 == 0 && incompat&journalIncompat64Bit == 0 {
+		tagLen -= 4
+	}
+	end := int(sb.blockSize)
+	if incompat&(journalIncompatCsumV2|journalIncompatCsumV3) != 0 {
+		end -= 4 // block tail checksum
+	}
+
+	// Walk the log from its start until a block that does not carry the
+	// next expected sequence number; a transaction without its commit
+	// block was cut short and is dropped.
+	var committed []*journalTxn
+	txn := &journalTxn{seq: seq, blocks: make(map[uint64]journalBlock)}
+	blk, visited := start, uint32(0)
+	next := func() error {
+		if blk++; blk >= maxLen {
+			blk = first
+		}
+		if visited++; visited > maxLen-first {
+			return corrupt("journal log wraps onto itself")
+		}
+		return nil
+	}
+walk:
+	for {
+		b, err := read(blk)
+		if err != nil {
+			return nil, err
+		}
+		if be.Uint32(b) != journalMagic || be.Uint32(b[0x8:]) != txn.seq {
+			break
+		}
+		switch be.Uint32(b[0x4:]) {
+		case journalDescriptor:
+			for off := 12; off+tagLen <= end; {
+				tag := b[off:]
+				target := uint64(be.Uint32(tag))
+				var flags uint32
+				if tagLen == 16 {
+					flags = be.Uint32(tag[0x4:])
+					target |= uint64(be.Uint32(tag[0x8:])) << 32
+				} else {
+					flags = uint32(be.Uint16(tag[0x6:]))
+					if incompat&journalIncompat64Bit != 0 {
+						target |= uint64(be.Uint32(tag[0x8:])) << 32
+					}
+				}
+				off += tagLen
+				if flags&journalFlagSameUUID == 0 {
+					off += 16
+				}
+				if err := next(); err != nil {
+					return nil, err
+				}
+				p, err := phys(blk)
+				if err != nil {
+					return nil, err
+				}
+				if target >= sb.blocksCount {
+					return nil, corrupt("journal logs block %d beyond end of file system", target)
+				}
+				if _, ok := txn.blocks[target]; !ok {
+					txn.order = append(txn.order, target)
+				}
+				txn.blocks[target] = journalBlock{phys: p, escaped: flags&journalFlagEscape != 0}
+				if flags&journalFlagLastTag != 0 {
+					break
+				}
+			}
+		case journalRevoke:
+			recLen := 4
+			if incompat&journalIncompat64Bit != 0 {
+				recLen = 8
+			}
+			count := int(be.Uint32(b[0xC:]))
+			if count > end {
+				return nil, corrupt("bad journal revoke block")
+			}
+			for off := 16; off+recLen <= count; off += recLen {
+				target := uint64(be.Uint32(b[off:]))
+				if recLen == 8 {
+					target = be.Uint64(b[off:])
+				}
+				txn.revokes = append(txn.revokes, target)
+			}
+		case journalCommit:
+			committed = append(committed, txn)
+			txn = &journalTxn{seq: txn.seq + 1, blocks: make(map[uint64]journalBlock)}
+		default:
+			break walk
+		}
+		if err := next(); err != nil {
+			return nil, err
+		}
+	}
+
+	// A revoke cancels the copies of a block logged by its own and older
+	// transactions; newer transactions still write it.
+	revoked := make(map[uint64]uint32)
+	for _, t := range committed {
+		for _, target := range t.revokes {
+			revoked[target] = t.seq
+		}
+	}
+	out := make(map[uint64]journalBlock)
+	for _, t := range committed {
+		for _, target := range t.order {
+			if r, ok := revoked[target]; ok && !tidAfter(t.seq, r) {
+				continue
+			}
+			out[target] = t.blocks[target]
+		}
+	}
+	return out, nil
+}
+
+// replayedDev reads an image as it looks once its journal is replayed,
+// without writing to it.
+type replayedDev struct {
+	dev    io.ReaderAt
+	bs     int64
+	blocks map[uint64]journalBlock
+}
+
+// ReadAt implements io.ReaderAt.
+func (r *replayedDev) ReadAt(p []byte, off int64) (int, error) {
+	n := 0
+	for n < len(p) {
+		pos := off + int64(n)
+		blk, within := uint64(pos/r.bs), pos%r.bs
+		jb, logged := r.blocks[blk]
+		chunk := min(int64(len(p)-n), r.bs-within)
+		src := pos
+		if logged {
+			src = int64(jb.phys)*r.bs + within
+		} else {
+			// Read through to the next logged block in one go.
+			for b := blk + 1; int64(n)+chunk < int64(len(p)); b++ {
+				if _, ok := r.blocks[b]; ok {
+					break
+				}
+				chunk = min(int64(len(p)-n), chunk+r.bs)
+			}
+		}
+		m, err := r.dev.ReadAt(p[n:n+int(chunk)], src)
+		if logged && jb.escaped && within < 4 {
+			var magic [4]byte
+			be.PutUint32(magic[:], journalMagic)
+			copy(p[n:n+m], magic[within:])
+		}
+		n += m
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
@@ -0,0 +1,95 @@
+package ext4
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// AddDir copies the tree under dir on the host into the image root,
+// keeping modes, ownership, timestamps, symlinks, hard links and device
+// nodes. The metadata of dir itself is not copied, directories that
+// already exist in the image keep theirs, and sockets are skipped.
+func (e *Editor) AddDir(dir string) error {
+	type fileID struct{ dev, ino uint64 }
+	seen := make(map[fileID]string)
+	return filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil || rel == "." {
+			return err
+		}
+		name := filepath.ToSlash(rel)
+		if d.IsDir() {
+			if in, _, err := e.fs.resolve(name, false); err == nil && in.isDir() {
+				return nil
+			}
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if info.Mode()&fs.ModeSocket != 0 {
+			return nil
+		}
+		var link string
+		if info.Mode()&fs.ModeSymlink != 0 {
+			if link, err = os.Readlink(p); err != nil {
+				return err
+			}
+		}
+		hdr, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return fmt.Errorf("%s: %w", p, err)
+		}
+		hdr.Name = name
+		hdr.Uname, hdr.Gname = "", ""
+
+		if st, ok := info.Sys().(*syscall.Stat_t); ok && info.Mode().IsRegular() && st.Nlink > 1 {
+			id := fileID{uint64(st.Dev), st.Ino}
+			if first, ok := seen[id]; ok {
+				hdr.Typeflag, hdr.Linkname, hdr.Size = tar.TypeLink, first, 0
+				return e.Add(hdr, nil)
+			}
+			seen[id] = name
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			return e.Add(hdr, nil)
+		}
+		f, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		return e.Add(hdr, f)
+	})
+}
+
+// AddTar adds the entries of a tar stream. Entry types the image cannot
+// hold, such as PAX global headers, are skipped.
+func (e *Editor) AddTar(r io.Reader) error {
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		switch hdr.Typeflag {
+		case tar.TypeXGlobalHeader, tar.TypeXHeader, tar.TypeGNULongName, tar.TypeGNULongLink:
+			continue
+		}
+		if err := e.Add(hdr, tr); err != nil {
+			return err
+		}
+	}
+}
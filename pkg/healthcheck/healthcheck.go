@@ -0,0 +1,120 @@
+// Package healthcheck runs a service's container healthcheck inside its
+// guest and reads the result back on the host.
+//
+// The healthcheck travels to the guest on the kernel command line (see
+// BootArg). The init wrapper runs it in the background next to the
+// workload and reports each change of health on the serial console as
+// "<Marker>healthy" or "<Marker>unhealthy", which the host picks up with
+// the VM's console watcher.
+package healthcheck
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/restuhaqza/swarmcracker/pkg/types"
+)
+
+// BootArg is the kernel argument carrying the healthcheck:
+// swarmcracker.health=<interval>,<timeout>,<start period>,<retries>,<command>
+// with durations in whole seconds and the shell command base64 encoded.
+const BootArg = "swarmcracker.health"
+
+// Marker starts the console line on which the init wrapper reports the
+// guest's health, e.g. "swarmcracker: health status=healthy".
+const Marker = "swarmcracker: health status="
+
+// Health states reported after Marker.
+const (
+	Healthy   = "healthy"
+	Unhealthy = "unhealthy"
+)
+
+// Defaults for unset healthcheck fields, as in Docker.
+const (
+	DefaultInterval = 30 * time.Second
+	DefaultTimeout  = 30 * time.Second
+	DefaultRetries  = 3
+)
+
+// Command returns the shell command the guest runs for a healthcheck, or
+// false if the healthcheck is unset or disabled.
+func Command(hc *types.HealthConfig) (string, bool) {
+	if hc == nil || len(hc.Test) == 0 {
+		return "", false
+	}
+	switch hc.Test[0] {
+	case "CMD":
+		if len(hc.Test) < 2 {
+			return "", false
+		}
+		quoted := make([]string, len(hc.Test)-1)
+		for i, arg := range hc.Test[1:] {
+			quoted[i] = shellQuote(arg)
+		}
+		return strings.Join(quoted, " "), true
+	case "CMD-SHELL":
+		if len(hc.Test) < 2 || strings.TrimSpace(hc.Test[1]) == "" {
+			return "", false
+		}
+		return hc.Test[1], true
+	}
+	// "NONE" and anything unknown disable the check
+	return "", false
+}
+
+// KernelArg returns the kernel argument passing the healthcheck to the
+// guest, or false if there is nothing to run.
+func KernelArg(hc *types.HealthConfig) (string, bool) {
+	cmd, ok := Command(hc)
+	if !ok {
+		return "", false
+	}
+	return fmt.Sprintf("%s=%d,%d,%d,%d,%s", BootArg,
+		seconds(interval(hc)), seconds(timeout(hc)), seconds(hc.StartPeriod), retries(hc),
+		base64.StdEncoding.EncodeToString([]byte(cmd))), true
+}
+
+// ReadyTimeout is how long after boot a guest may take to report healthy
+// before it is considered failed: the start period plus enough intervals
+// for the retries to run out.
+func ReadyTimeout(hc *types.HealthConfig) time.Duration {
+	return hc.StartPeriod + time.Duration(retries(hc)+1)*(interval(hc)+timeout(hc))
+}
+
+func interval(hc *types.HealthConfig) time.Duration {
+	if hc.Interval > 0 {
+		return hc.Interval
+	}
+	return DefaultInterval
+}
+
+func timeout(hc *types.HealthConfig) time.Duration {
+	if hc.Timeout > 0 {
+		return hc.Timeout
+	}
+	return DefaultTimeout
+}
+
+func retries(hc *types.HealthConfig) int {
+	if hc.Retries > 0 {
+		return hc.Retries
+	}
+	return DefaultRetries
+}
+
+// seconds rounds a duration up to whole seconds, the resolution of the
+// guest's sleep
+func seconds(d time.Duration) int {
+	return int((d + time.Second - 1) / time.Second)
+}
+
+// shellQuote quotes an argument for sh
+func shellQuote(s string) string {
+	if s != "" && !strings.ContainsAny(s, " \t\n'\"\\$`!*?[](){}<>&|;#~") {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,70 @@
+package healthcheck
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/restuhaqza/swarmcracker/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCommand(t *testing.T) {
+	tests := []struct {
+		name string
+		test []string
+		want string
+		ok   bool
+	}{
+		{"exec form", []string{"CMD", "curl", "-f", "http://localhost/"}, "curl -f http://localhost/", true},
+		{"exec form quoting", []string{"CMD", "sh", "-c", "test -f /ready && echo 'ok'"}, `sh -c 'test -f /ready && echo '\''ok'\'''`, true},
+		{"shell form", []string{"CMD-SHELL", "pg_isready -U app || exit 1"}, "pg_isready -U app || exit 1", true},
+		{"disabled", []string{"NONE"}, "", false},
+		{"empty exec form", []string{"CMD"}, "", false},
+		{"empty shell form", []string{"CMD-SHELL", " "}, "", false},
+		{"unknown", []string{"curl", "localhost"}, "", false},
+		{"unset", nil, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := Command(&types.HealthConfig{Test: tt.test})
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	_, ok := Command(nil)
+	assert.False(t, ok)
+}
+
+func TestKernelArg(t *testing.T) {
+	hc := &types.HealthConfig{
+		Test:        []string{"CMD-SHELL", "curl -f localhost, or else"},
+		Interval:    1500 * time.Millisecond,
+		StartPeriod: time.Minute,
+	}
+
+	arg, ok := KernelArg(hc)
+	require.True(t, ok)
+	require.True(t, strings.HasPrefix(arg, BootArg+"=2,30,60,3,"), arg)
+	assert.NotContains(t, arg, " ", "kernel arguments cannot hold spaces")
+
+	cmd, err := base64.StdEncoding.DecodeString(arg[strings.LastIndex(arg, ",")+1:])
+	require.NoError(t, err)
+	assert.Equal(t, "curl -f localhost, or else", string(cmd))
+
+	_, ok = KernelArg(&types.HealthConfig{Test: []string{"NONE"}})
+	assert.False(t, ok)
+}
+
+func TestReadyTimeout(t *testing.T) {
+	assert.Equal(t, 4*time.Minute, ReadyTimeout(&types.HealthConfig{}))
+	assert.Equal(t, time.Minute+3*3*time.Second, ReadyTimeout(&types.HealthConfig{
+		Interval:    time.Second,
+		Timeout:     2 * time.Second,
+		StartPeriod: time.Minute,
+		Retries:     2,
+	}))
+}
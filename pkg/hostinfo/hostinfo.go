@@ -0,0 +1,235 @@
+// Package hostinfo probes the host capabilities a node advertises to the
+// scheduler: engine labels that placement constraints can target, and the
+// number of microVMs the node has room for.
+package hostinfo
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/restuhaqza/swarmcracker/pkg/hugepages"
+)
+
+// Engine labels a node advertises, e.g. the constraint
+// engine.labels.swarmcracker.cpu.feature.avx512f==true keeps a service on
+// nodes whose CPUs have AVX-512.
+const (
+	LabelKVM                = "swarmcracker.kvm"
+	LabelFirecrackerVersion = "swarmcracker.firecracker.version"
+	LabelJailer             = "swarmcracker.jailer"
+	LabelCgroup             = "swarmcracker.cgroup"
+	LabelCPUVendor          = "swarmcracker.cpu.vendor"
+	LabelCPUModel           = "swarmcracker.cpu.model"
+	LabelCPUFeaturePrefix   = "swarmcracker.cpu.feature."
+	LabelHugePages2M        = "swarmcracker.hugepages.2M" // pages in the host pool
+	LabelHostKernel         = "swarmcracker.host.kernel"
+)
+
+// SlotResourceKind is the generic resource a node counts its microVM slots
+// in. Services reserve one slot per task, so nodes that cannot boot VMs,
+// and so report no slots, never get their tasks.
+const SlotResourceKind = "microvm"
+
+// DefaultVMOverheadMiB is the host memory a VM costs on top of its guest
+// memory: the VMM process, its API server and buffers, and the TAP device.
+const DefaultVMOverheadMiB = 64
+
+// Features are the CPU flags advertised as labels: the ones workloads
+// built for newer CPUs commonly need. /proc/cpuinfo uses the x86 names in
+// "flags" and the arm64 names in "Features".
+var Features = []string{
+	// x86
+	"aes", "avx", "avx2", "avx512f", "avx512bw", "avx512cd", "avx512dq", "avx512vl",
+	"avx512_vnni", "avx512_bf16", "amx_tile", "sha_ni", "sse4_2", "vmx", "svm",
+	// arm64
+	"asimd", "atomics", "sha2", "sha512", "sve", "sve2",
+}
+
+// Paths of the host's proc and sysfs trees - overridable for testing
+var (
+	procDir = "/proc"
+	sysDir  = "/sys"
+	kvmPath = "/dev/kvm"
+)
+
+// Info is what the node knows about its host.
+type Info struct {
+	KVM                bool
+	FirecrackerVersion string // e.g. "1.7.0", empty if unknown
+	Jailer             bool
+	CgroupVersion      string // "v1" or "v2", empty if unknown
+	CPUVendor          string
+	CPUModel           string
+	CPUFeatures        []string // the Features the CPU has
+	HugePages2M        int
+	HostKernel         string
+}
+
+// Probe reads the host's capabilities. Anything that cannot be read is left
+// out rather than failing the probe.
+func Probe(firecrackerPath, jailerPath string) Info {
+	var info Info
+
+	if _, err := os.Stat(kvmPath); err == nil {
+		info.KVM = true
+	}
+	if out, err := exec.Command(lookPath(firecrackerPath, "firecracker"), "--version").Output(); err == nil {
+		info.FirecrackerVersion = ParseFirecrackerVersion(string(out))
+	}
+	if _, err := exec.LookPath(lookPath(jailerPath, "jailer")); err == nil {
+		info.Jailer = true
+	}
+	info.CgroupVersion = cgroupVersion()
+	if data, err := os.ReadFile(filepath.Join(procDir, "cpuinfo")); err == nil {
+		info.CPUVendor, info.CPUModel, info.CPUFeatures = ParseCPUInfo(data)
+	}
+	if pool, err := hugepages.ReadPool(hugepages.Size2M); err == nil {
+		info.HugePages2M = pool.Total
+	}
+	if data, err := os.ReadFile(filepath.Join(procDir, "sys/kernel/osrelease")); err == nil {
+		info.HostKernel = strings.TrimSpace(string(data))
+	}
+
+	return info
+}
+
+// Labels returns the engine labels advertising the host's capabilities.
+func (i Info) Labels() map[string]string {
+	labels := map[string]string{
+		LabelKVM:    strconv.FormatBool(i.KVM),
+		LabelJailer: strconv.FormatBool(i.Jailer),
+	}
+	set := func(key, value string) {
+		if value != "" {
+			labels[key] = value
+		}
+	}
+	set(LabelFirecrackerVersion, i.FirecrackerVersion)
+	set(LabelCgroup, i.CgroupVersion)
+	set(LabelCPUVendor, i.CPUVendor)
+	set(LabelCPUModel, i.CPUModel)
+	set(LabelHostKernel, i.HostKernel)
+	if i.HugePages2M > 0 {
+		labels[LabelHugePages2M] = strconv.Itoa(i.HugePages2M)
+	}
+	for _, f := range i.CPUFeatures {
+		labels[LabelCPUFeaturePrefix+f] = "true"
+	}
+	return labels
+}
+
+// Slots returns how many microVMs fit in memoryBytes of host memory at
+// overheadMiB each (DefaultVMOverheadMiB if zero), capped at maxVMs if it
+// is set.
+func Slots(memoryBytes int64, overheadMiB, maxVMs int) int64 {
+	if overheadMiB <= 0 {
+		overheadMiB = DefaultVMOverheadMiB
+	}
+	slots := memoryBytes / (int64(overheadMiB) << 20)
+	if slots < 0 {
+		slots = 0
+	}
+	if maxVMs > 0 && slots > int64(maxVMs) {
+		slots = int64(maxVMs)
+	}
+	return slots
+}
+
+var versionRe = regexp.MustCompile(`v?(\d+\.\d+(\.\d+)?)`)
+
+// ParseFirecrackerVersion extracts the version from the output of
+// "firecracker --version", e.g. "Firecracker v1.7.0".
+func ParseFirecrackerVersion(out string) string {
+	line, _, _ := strings.Cut(out, "\n")
+	if m := versionRe.FindStringSubmatch(line); m != nil {
+		return m[1]
+	}
+	return ""
+}
+
+// armImplementers names the CPU implementer codes of common arm64 CPUs
+var armImplementers = map[string]string{
+	"0x41": "ARM",
+	"0x48": "HiSilicon",
+	"0x4e": "NVIDIA",
+	"0x51": "Qualcomm",
+	"0x61": "Apple",
+	"0xc0": "Ampere",
+}
+
+// ParseCPUInfo returns the vendor, model name and the Features of the first
+// CPU in /proc/cpuinfo.
+func ParseCPUInfo(data []byte) (vendor, model string, features []string) {
+	var flags string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			// A blank line ends the first CPU on x86
+			if vendor != "" && flags != "" {
+				break
+			}
+			continue
+		}
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		switch key {
+		case "vendor_id":
+			if vendor == "" {
+				vendor = value
+			}
+		case "CPU implementer":
+			if vendor == "" {
+				vendor = value
+				if name, ok := armImplementers[value]; ok {
+					vendor = name
+				}
+			}
+		case "model name":
+			if model == "" {
+				model = value
+			}
+		case "flags", "Features":
+			if flags == "" {
+				flags = value
+			}
+		}
+	}
+
+	have := map[string]bool{}
+	for _, f := range strings.Fields(flags) {
+		have[f] = true
+	}
+	for _, f := range Features {
+		if have[f] {
+			features = append(features, f)
+		}
+	}
+	return vendor, model, features
+}
+
+// cgroupVersion reports whether the host runs the unified cgroup v2
+// hierarchy or cgroup v1
+func cgroupVersion() string {
+	if _, err := os.Stat(filepath.Join(sysDir, "fs/cgroup/cgroup.controllers")); err == nil {
+		return "v2"
+	}
+	if _, err := os.Stat(filepath.Join(sysDir, "fs/cgroup")); err == nil {
+		return "v1"
+	}
+	return ""
+}
+
+// lookPath returns path, or name to look up in $PATH if path is empty
+func lookPath(path, name string) string {
+	if path != "" {
+		return path
+	}
+	return name
+}
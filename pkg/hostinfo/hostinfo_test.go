@@ -0,0 +1,118 @@
+package hostinfo
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const x86CPUInfo = `processor	: 0
+vendor_id	: GenuineIntel
+cpu family	: 6
+model name	: Intel(R) Xeon(R) Platinum 8375C CPU @ 2.90GHz
+flags		: fpu vme sse4_2 aes avx avx2 avx512f avx512bw avx512vl vmx sha_ni
+
+processor	: 1
+vendor_id	: GenuineIntel
+model name	: Intel(R) Xeon(R) Platinum 8375C CPU @ 2.90GHz
+flags		: fpu vme sse4_2 aes avx avx2 avx512f avx512bw avx512vl vmx sha_ni amx_tile
+`
+
+const arm64CPUInfo = `processor	: 0
+BogoMIPS	: 243.75
+Features	: fp asimd evtstrm aes pmull sha1 sha2 crc32 atomics fphp asimdhp cpuid sve
+CPU implementer	: 0x41
+CPU architecture: 8
+CPU part	: 0xd40
+`
+
+func TestParseCPUInfo(t *testing.T) {
+	vendor, model, features := ParseCPUInfo([]byte(x86CPUInfo))
+	assert.Equal(t, "GenuineIntel", vendor)
+	assert.Equal(t, "Intel(R) Xeon(R) Platinum 8375C CPU @ 2.90GHz", model)
+	assert.Equal(t, []string{"aes", "avx", "avx2", "avx512f", "avx512bw", "avx512vl", "sha_ni", "sse4_2", "vmx"}, features,
+		"only the first CPU is read")
+
+	vendor, model, features = ParseCPUInfo([]byte(arm64CPUInfo))
+	assert.Equal(t, "ARM", vendor)
+	assert.Empty(t, model)
+	assert.Equal(t, []string{"aes", "asimd", "atomics", "sha2", "sve"}, features)
+
+	vendor, _, features = ParseCPUInfo(nil)
+	assert.Empty(t, vendor)
+	assert.Empty(t, features)
+}
+
+func TestParseFirecrackerVersion(t *testing.T) {
+	assert.Equal(t, "1.7.0", ParseFirecrackerVersion("Firecracker v1.7.0\n\nSupported snapshot data format versions: v1.0.0\n"))
+	assert.Equal(t, "1.10.1", ParseFirecrackerVersion("Firecracker v1.10.1"))
+	assert.Empty(t, ParseFirecrackerVersion("firecracker: command not found"))
+}
+
+func TestLabels(t *testing.T) {
+	labels := Info{
+		KVM:                true,
+		FirecrackerVersion: "1.7.0",
+		CgroupVersion:      "v2",
+		CPUVendor:          "AuthenticAMD",
+		CPUFeatures:        []string{"avx2", "svm"},
+		HugePages2M:        512,
+		HostKernel:         "6.1.0-18-amd64",
+	}.Labels()
+
+	assert.Equal(t, map[string]string{
+		LabelKVM:                       "true",
+		LabelJailer:                    "false",
+		LabelFirecrackerVersion:        "1.7.0",
+		LabelCgroup:                    "v2",
+		LabelCPUVendor:                 "AuthenticAMD",
+		LabelHugePages2M:               "512",
+		LabelHostKernel:                "6.1.0-18-amd64",
+		LabelCPUFeaturePrefix + "avx2": "true",
+		LabelCPUFeaturePrefix + "svm":  "true",
+	}, labels)
+}
+
+func TestSlots(t *testing.T) {
+	const gib = int64(1) << 30
+	assert.Equal(t, int64(16), Slots(gib, 0, 0), "1 GiB at the default 64 MiB")
+	assert.Equal(t, int64(8), Slots(gib, 128, 0))
+	assert.Equal(t, int64(10), Slots(gib, 0, 10), "capped at max VMs")
+	assert.Equal(t, int64(0), Slots(-gib, 0, 0))
+}
+
+func TestProbe(t *testing.T) {
+	dir := t.TempDir()
+	oldProc, oldSys, oldKVM := procDir, sysDir, kvmPath
+	procDir, sysDir, kvmPath = filepath.Join(dir, "proc"), filepath.Join(dir, "sys"), filepath.Join(dir, "kvm")
+	t.Cleanup(func() { procDir, sysDir, kvmPath = oldProc, oldSys, oldKVM })
+
+	write := func(path, data string) {
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte(data), 0755))
+	}
+	write(filepath.Join(procDir, "cpuinfo"), x86CPUInfo)
+	write(filepath.Join(procDir, "sys/kernel/osrelease"), "6.8.0-generic\n")
+	write(filepath.Join(sysDir, "fs/cgroup/cgroup.controllers"), "cpu memory\n")
+	write(kvmPath, "")
+	firecracker := filepath.Join(dir, "firecracker")
+	write(firecracker, "#!/bin/sh\necho Firecracker v1.9.1\n")
+	jailer := filepath.Join(dir, "jailer")
+	write(jailer, "#!/bin/sh\n")
+
+	info := Probe(firecracker, jailer)
+	assert.True(t, info.KVM)
+	assert.Equal(t, "1.9.1", info.FirecrackerVersion)
+	assert.True(t, info.Jailer)
+	assert.Equal(t, "v2", info.CgroupVersion)
+	assert.Equal(t, "GenuineIntel", info.CPUVendor)
+	assert.Contains(t, info.CPUFeatures, "avx512f")
+	assert.Equal(t, "6.8.0-generic", info.HostKernel)
+
+	info = Probe(filepath.Join(dir, "missing"), filepath.Join(dir, "missing"))
+	assert.Empty(t, info.FirecrackerVersion)
+	assert.False(t, info.Jailer)
+}
@@ -0,0 +1,141 @@
+// Package hugepages backs guest memory with huge pages: the per-service
+// option and the host's huge page pool the memory comes from.
+package hugepages
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Label is the service label that picks the page size of a service's guest
+// memory ("2M" or "None"), overriding the node default.
+const Label = "swarmcracker.hugepages"
+
+// Page sizes accepted by Firecracker's machine config.
+const (
+	None   = "None"
+	Size2M = "2M"
+)
+
+// ResourceKind is the generic resource a node reports its 2M pages as.
+const ResourceKind = "hugepages-2M"
+
+// ErrUnavailable is returned when the host pool cannot hold a VM's memory.
+var ErrUnavailable = errors.New("not enough free huge pages")
+
+// sysDir is the sysfs huge page root - overridable for testing
+var sysDir = "/sys/kernel/mm/hugepages"
+
+// pageKiB maps the page sizes to their size in KiB.
+var pageKiB = map[string]int{Size2M: 2048}
+
+// Validate checks a page size setting. Empty means None.
+func Validate(size string) error {
+	if size == "" || size == None {
+		return nil
+	}
+	if _, ok := pageKiB[size]; !ok {
+		return fmt.Errorf("invalid huge page size %q, want %s or %s", size, Size2M, None)
+	}
+	return nil
+}
+
+// Resolve returns the huge page size for a service with the given labels,
+// or "" when its memory uses regular pages. Services without the label use
+// nodeDefault.
+func Resolve(nodeDefault string, labels map[string]string) (string, error) {
+	size := nodeDefault
+	if v, ok := labels[Label]; ok && v != "" {
+		if err := Validate(v); err != nil {
+			return "", fmt.Errorf("label %s: %w", Label, err)
+		}
+		size = v
+	}
+	if size == None {
+		return "", nil
+	}
+	return size, Validate(size)
+}
+
+// Align rounds a memory size up to a whole number of pages, which
+// Firecracker requires for huge page backed memory.
+func Align(size string, memMiB int) int {
+	pageMiB := pageKiB[size] / 1024
+	if pageMiB <= 1 {
+		return memMiB
+	}
+	return (memMiB + pageMiB - 1) / pageMiB * pageMiB
+}
+
+// Pool is the host's pool of pages of one size.
+type Pool struct {
+	Size  string
+	Total int // pages
+	Free  int // pages
+}
+
+// TotalMiB returns the size of the pool.
+func (p Pool) TotalMiB() int {
+	return p.Total * pageKiB[p.Size] / 1024
+}
+
+// FreeMiB returns the memory left in the pool.
+func (p Pool) FreeMiB() int {
+	return p.Free * pageKiB[p.Size] / 1024
+}
+
+// ReadPool reads the host pool of the given page size. A kernel without
+// the size reports an empty pool.
+func ReadPool(size string) (Pool, error) {
+	kib, ok := pageKiB[size]
+	if !ok {
+		return Pool{}, fmt.Errorf("invalid huge page size %q", size)
+	}
+	pool := Pool{Size: size}
+
+	dir := filepath.Join(sysDir, fmt.Sprintf("hugepages-%dkB", kib))
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		return pool, nil
+	}
+
+	var err error
+	if pool.Total, err = readCount(filepath.Join(dir, "nr_hugepages")); err != nil {
+		return Pool{}, err
+	}
+	if pool.Free, err = readCount(filepath.Join(dir, "free_hugepages")); err != nil {
+		return Pool{}, err
+	}
+	return pool, nil
+}
+
+// Check returns an error wrapping ErrUnavailable unless the host pool has
+// room for memMiB of guest memory in pages of the given size.
+func Check(size string, memMiB int) error {
+	pool, err := ReadPool(size)
+	if err != nil {
+		return err
+	}
+	if pool.Total == 0 {
+		return fmt.Errorf("%w: node has no %s huge pages (see vm.nr_hugepages)", ErrUnavailable, size)
+	}
+	if pool.FreeMiB() < memMiB {
+		return fmt.Errorf("%w: VM needs %d MiB of %s pages, node has %d MiB free", ErrUnavailable, memMiB, size, pool.FreeMiB())
+	}
+	return nil
+}
+
+func readCount(path string) (int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read huge page pool: %w", err)
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return 0, fmt.Errorf("invalid huge page count in %s: %w", path, err)
+	}
+	return n, nil
+}
@@ -0,0 +1,112 @@
+package hugepages
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolve(t *testing.T) {
+	tests := []struct {
+		name        string
+		nodeDefault string
+		labels      map[string]string
+		want        string
+		wantErr     bool
+	}{
+		{"off by default", "", nil, "", false},
+		{"node default", "2M", nil, "2M", false},
+		{"node default None", "None", nil, "", false},
+		{"label enables", "", map[string]string{Label: "2M"}, "2M", false},
+		{"label disables", "2M", map[string]string{Label: "None"}, "", false},
+		{"empty label uses default", "2M", map[string]string{Label: ""}, "2M", false},
+		{"invalid label", "", map[string]string{Label: "1G"}, "", true},
+		{"invalid default", "1G", nil, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Resolve(tt.nodeDefault, tt.labels)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestAlign(t *testing.T) {
+	assert.Equal(t, 512, Align(Size2M, 512))
+	assert.Equal(t, 514, Align(Size2M, 513))
+	assert.Equal(t, 513, Align(None, 513))
+}
+
+// fakePool points sysDir at a temp dir with a 2M pool of the given size
+func fakePool(t *testing.T, total, free string) {
+	t.Helper()
+	dir := t.TempDir()
+	if total != "" {
+		poolDir := filepath.Join(dir, "hugepages-2048kB")
+		require.NoError(t, os.MkdirAll(poolDir, 0755))
+		require.NoError(t, os.WriteFile(filepath.Join(poolDir, "nr_hugepages"), []byte(total+"\n"), 0644))
+		require.NoError(t, os.WriteFile(filepath.Join(poolDir, "free_hugepages"), []byte(free+"\n"), 0644))
+	}
+
+	orig := sysDir
+	sysDir = dir
+	t.Cleanup(func() { sysDir = orig })
+}
+
+func TestReadPool(t *testing.T) {
+	fakePool(t, "1024", "300")
+
+	pool, err := ReadPool(Size2M)
+	require.NoError(t, err)
+	assert.Equal(t, Pool{Size: Size2M, Total: 1024, Free: 300}, pool)
+	assert.Equal(t, 2048, pool.TotalMiB())
+	assert.Equal(t, 600, pool.FreeMiB())
+
+	_, err = ReadPool("1G")
+	assert.Error(t, err)
+}
+
+func TestReadPool_NoKernelSupport(t *testing.T) {
+	fakePool(t, "", "")
+
+	pool, err := ReadPool(Size2M)
+	require.NoError(t, err)
+	assert.Equal(t, 0, pool.Total)
+}
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name    string
+		total   string
+		free    string
+		memMiB  int
+		wantErr bool
+	}{
+		{"fits", "512", "512", 1024, false},
+		{"too little free", "512", "100", 512, true},
+		{"empty pool", "0", "0", 512, true},
+		{"no kernel support", "", "", 512, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fakePool(t, tt.total, tt.free)
+			err := Check(Size2M, tt.memMiB)
+			if tt.wantErr {
+				assert.True(t, errors.Is(err, ErrUnavailable), "got %v", err)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
@@ -16,6 +16,9 @@ func injectBusybox(tmpDir string) error {
 	}
 
 	// Write the embedded busybox binary
+	if len(busyboxBinary) == 0 {
+		return missingBinaryError("busybox")
+	}
 	busyboxPath := filepath.Join(binDir, "busybox")
 	if err := os.WriteFile(busyboxPath, busyboxBinary, 0755); err != nil {
 		return fmt.Errorf("failed to write busybox binary: %w", err)
@@ -30,6 +33,7 @@ func injectBusybox(tmpDir string) error {
 		"echo", "printf", // Output
 		"pwd", "cd", "env", // Environment
 		"sleep", "true", "false", "test", "[", // Utilities
+		"base64", "timeout", // Used by the healthcheck in the init wrapper
 		"ps", "kill", "top", // Process management
 		"mount", "umount", // Mount operations
 		"grep", "sed", "awk", "head", "tail", "wc", "tr", // Text processing
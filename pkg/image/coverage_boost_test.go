@@ -437,7 +437,7 @@ func TestPrepare_ImageScenarios(t *testing.T) {
 				// Create existing rootfs file
 				imageID := generateImageID("nginx:latest")
 				rootfsPath := filepath.Join(rootfsDir, imageID+".ext4")
-				err := os.WriteFile(rootfsPath, []byte("existing rootfs"), 0644)
+				err := writeCachedRootfs(rootfsPath)
 				require.NoError(t, err)
 				return rootfsPath
 			},
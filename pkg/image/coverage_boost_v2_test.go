@@ -947,34 +947,6 @@ func TestGetInitBinaryPath_WhichCommand(t *testing.T) {
 	assert.True(t, true, "getInitBinaryPath which fallback exercised")
 }
 
-// ============================================================================
-// mountExt4/unmountExt4 coverage (75% -> target 85%+)
-// ============================================================================
-
-// TestMountExt4_NonexistentPath tests mount with nonexistent image
-func TestMountExt4_NonexistentPath(t *testing.T) {
-	ip := NewImagePreparer(&PreparerConfig{RootfsDir: t.TempDir()}).(*ImagePreparer)
-
-	mountDir, err := ip.mountExt4("/nonexistent/path/to/image.ext4")
-	assert.Error(t, err)
-	assert.Empty(t, mountDir)
-}
-
-// TestUnmountExt4_NilSafety tests unmount safety
-func TestUnmountExt4_NilSafety(t *testing.T) {
-	ip := NewImagePreparer(&PreparerConfig{RootfsDir: t.TempDir()}).(*ImagePreparer)
-
-	// Call with various paths - should not crash
-	err := ip.unmountExt4("")
-	assert.NoError(t, err)
-
-	err = ip.unmountExt4("/nonexistent/mount")
-	assert.NoError(t, err)
-
-	err = ip.unmountExt4(t.TempDir())
-	assert.NoError(t, err)
-}
-
 // ============================================================================
 // Additional RealContainerRuntime tests
 // ============================================================================
@@ -1107,7 +1079,7 @@ func TestPrepare_WithInitInjection(t *testing.T) {
 	// Create a fake rootfs that already exists
 	imageID := generateImageID("alpine:latest")
 	rootfsPath := filepath.Join(rootfsDir, imageID+".ext4")
-	err := os.WriteFile(rootfsPath, []byte("fake ext4 rootfs content"), 0644)
+	err := writeCachedRootfs(rootfsPath)
 	require.NoError(t, err)
 
 	ip := NewImagePreparer(&PreparerConfig{
@@ -1143,7 +1115,7 @@ func TestPrepare_WithMultipleMountsAndSecrets(t *testing.T) {
 	// Create existing rootfs
 	imageID := generateImageID("nginx:latest")
 	rootfsPath := filepath.Join(rootfsDir, imageID+".ext4")
-	err := os.WriteFile(rootfsPath, []byte("fake rootfs"), 0644)
+	err := writeCachedRootfs(rootfsPath)
 	require.NoError(t, err)
 
 	// Create source directories for mounts
@@ -1188,8 +1160,8 @@ func TestPrepare_WithMultipleMountsAndSecrets(t *testing.T) {
 	err = ip.Prepare(ctx, task)
 
 	_ = err
-	// Rootfs annotation should be set
-	assert.Equal(t, rootfsPath, task.Annotations["rootfs"])
+	// Rootfs annotation should point at the task's private copy
+	assert.Equal(t, TaskRootfsPath(rootfsDir, task.ID), task.Annotations["rootfs"])
 }
 
 // ============================================================================
@@ -1850,7 +1822,7 @@ func TestPrepare_AnnotationsInitialization(t *testing.T) {
 	// Create existing rootfs
 	imageID := generateImageID("test:latest")
 	rootfsPath := filepath.Join(rootfsDir, imageID+".ext4")
-	os.WriteFile(rootfsPath, []byte("rootfs"), 0644)
+	writeCachedRootfs(rootfsPath)
 
 	ip := NewImagePreparer(&PreparerConfig{
 		RootfsDir:  rootfsDir,
@@ -1881,7 +1853,7 @@ func TestPrepare_ExistingRootfsPath(t *testing.T) {
 
 	imageID := generateImageID("existing:v1")
 	rootfsPath := filepath.Join(rootfsDir, imageID+".ext4")
-	os.WriteFile(rootfsPath, []byte("existing rootfs"), 0644)
+	writeCachedRootfs(rootfsPath)
 
 	ip := NewImagePreparer(&PreparerConfig{
 		RootfsDir:       rootfsDir,
@@ -2192,50 +2164,6 @@ func TestInjectInitSystem_DifferentInitSystemsV2(t *testing.T) {
 	}
 }
 
-// TestMountExt4_VariousPaths tests mount with different paths
-func TestMountExt4_VariousPaths(t *testing.T) {
-	tests := []struct {
-		name      string
-		imagePath string
-		wantErr   bool
-	}{
-		{
-			name:      "empty_path",
-			imagePath: "",
-			wantErr:   true,
-		},
-		{
-			name:      "nonexistent",
-			imagePath: filepath.Join(t.TempDir(), "nonexistent.ext4"),
-			wantErr:   true,
-		},
-		{
-			name: "regular_file",
-			imagePath: func() string {
-				p := filepath.Join(t.TempDir(), "file.ext4")
-				os.WriteFile(p, []byte("data"), 0644)
-				return p
-			}(),
-			wantErr: true, // mount requires proper ext4 and privileges
-		},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			ip := NewImagePreparer(&PreparerConfig{RootfsDir: t.TempDir()}).(*ImagePreparer)
-
-			mountDir, err := ip.mountExt4(tt.imagePath)
-
-			if tt.wantErr {
-				assert.Error(t, err)
-				assert.Empty(t, mountDir)
-			} else {
-				assert.NoError(t, err)
-			}
-		})
-	}
-}
-
 // TestGetInitBinaryPath_AllInitSystems tests binary path lookup for all init systems
 func TestGetInitBinaryPath_AllInitSystems(t *testing.T) {
 	tests := []struct {
@@ -2262,57 +2190,6 @@ func TestGetInitBinaryPath_AllInitSystems(t *testing.T) {
 	}
 }
 
-// TestUnmountExt4_VariousScenarios tests unmount scenarios
-func TestUnmountExt4_VariousScenarios(t *testing.T) {
-	tests := []struct {
-		name     string
-		mountDir string
-		setup    func(t *testing.T) string
-	}{
-		{
-			name:     "empty_dir",
-			mountDir: "",
-			setup:    nil,
-		},
-		{
-			name:     "nonexistent_dir",
-			mountDir: filepath.Join(t.TempDir(), "nonexistent"),
-			setup:    nil,
-		},
-		{
-			name:     "existing_dir",
-			mountDir: "",
-			setup: func(t *testing.T) string {
-				return t.TempDir()
-			},
-		},
-		{
-			name:     "dir_with_files",
-			mountDir: "",
-			setup: func(t *testing.T) string {
-				dir := t.TempDir()
-				os.WriteFile(filepath.Join(dir, "file.txt"), []byte("content"), 0644)
-				return dir
-			},
-		},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			ip := NewImagePreparer(&PreparerConfig{RootfsDir: t.TempDir()}).(*ImagePreparer)
-
-			mountDir := tt.mountDir
-			if tt.setup != nil {
-				mountDir = tt.setup(t)
-			}
-
-			err := ip.unmountExt4(mountDir)
-			// Should always succeed (cleanup mode)
-			assert.NoError(t, err)
-		})
-	}
-}
-
 // TestGenerateImageID_VariousFormats tests image ID generation
 func TestGenerateImageID_VariousFormats(t *testing.T) {
 	tests := []struct {
@@ -2604,17 +2481,18 @@ func TestInjectInitSystem_WithExistingRootfs(t *testing.T) {
 // TestPrepare_MultipleScenarios tests various Prepare flow scenarios
 func TestPrepare_MultipleScenarios(t *testing.T) {
 	tests := []struct {
-		name    string
-		setup   func(t *testing.T, rootfsDir string) string
-		task    *types.Task
-		wantErr bool
+		name     string
+		setup    func(t *testing.T, rootfsDir string) string
+		task     *types.Task
+		wantErr  bool
+		taskCopy bool // Writes into the rootfs, so gets a private copy
 	}{
 		{
 			name: "existing_rootfs",
 			setup: func(t *testing.T, rootfsDir string) string {
 				imageID := generateImageID("existing:v1")
 				rootfsPath := filepath.Join(rootfsDir, imageID+".ext4")
-				os.WriteFile(rootfsPath, []byte("rootfs"), 0644)
+				writeCachedRootfs(rootfsPath)
 				return rootfsPath
 			},
 			task: &types.Task{
@@ -2631,7 +2509,7 @@ func TestPrepare_MultipleScenarios(t *testing.T) {
 			setup: func(t *testing.T, rootfsDir string) string {
 				imageID := generateImageID("mounted:v1")
 				rootfsPath := filepath.Join(rootfsDir, imageID+".ext4")
-				os.WriteFile(rootfsPath, []byte("rootfs"), 0644)
+				writeCachedRootfs(rootfsPath)
 				return rootfsPath
 			},
 			task: &types.Task{
@@ -2649,14 +2527,15 @@ func TestPrepare_MultipleScenarios(t *testing.T) {
 				Secrets: []types.SecretRef{},
 				Configs: []types.ConfigRef{},
 			},
-			wantErr: false,
+			wantErr:  false,
+			taskCopy: true,
 		},
 		{
 			name: "with_secrets_and_configs",
 			setup: func(t *testing.T, rootfsDir string) string {
 				imageID := generateImageID("secrets:v1")
 				rootfsPath := filepath.Join(rootfsDir, imageID+".ext4")
-				os.WriteFile(rootfsPath, []byte("rootfs"), 0644)
+				writeCachedRootfs(rootfsPath)
 				return rootfsPath
 			},
 			task: &types.Task{
@@ -2672,14 +2551,15 @@ func TestPrepare_MultipleScenarios(t *testing.T) {
 					{ID: "c2", Target: "/config2"},
 				},
 			},
-			wantErr: false,
+			wantErr:  false,
+			taskCopy: true,
 		},
 		{
 			name: "with_nil_annotations",
 			setup: func(t *testing.T, rootfsDir string) string {
 				imageID := generateImageID("nil-ann:v1")
 				rootfsPath := filepath.Join(rootfsDir, imageID+".ext4")
-				os.WriteFile(rootfsPath, []byte("rootfs"), 0644)
+				writeCachedRootfs(rootfsPath)
 				return rootfsPath
 			},
 			task: &types.Task{
@@ -2696,7 +2576,7 @@ func TestPrepare_MultipleScenarios(t *testing.T) {
 			setup: func(t *testing.T, rootfsDir string) string {
 				imageID := generateImageID("init:test")
 				rootfsPath := filepath.Join(rootfsDir, imageID+".ext4")
-				os.WriteFile(rootfsPath, []byte("rootfs"), 0644)
+				writeCachedRootfs(rootfsPath)
 				return rootfsPath
 			},
 			task: &types.Task{
@@ -2728,6 +2608,9 @@ func TestPrepare_MultipleScenarios(t *testing.T) {
 				assert.Error(t, err)
 			} else {
 				assert.NoError(t, err)
+				if tt.taskCopy {
+					rootfsPath = TaskRootfsPath(rootfsDir, tt.task.ID)
+				}
 				assert.Equal(t, rootfsPath, tt.task.Annotations["rootfs"])
 			}
 		})
@@ -2743,7 +2626,7 @@ func TestPrepare_WithDifferentInitSystems(t *testing.T) {
 			rootfsDir := t.TempDir()
 			imageID := generateImageID("init-test:v1")
 			rootfsPath := filepath.Join(rootfsDir, imageID+".ext4")
-			os.WriteFile(rootfsPath, []byte("rootfs"), 0644)
+			writeCachedRootfs(rootfsPath)
 
 			ip := NewImagePreparer(&PreparerConfig{
 				RootfsDir:       rootfsDir,
@@ -3,10 +3,13 @@
 package image
 
 import (
+	"context"
 	"os"
 	"path/filepath"
 	"testing"
 
+	"github.com/restuhaqza/swarmcracker/pkg/ext4"
+	"github.com/restuhaqza/swarmcracker/pkg/types"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -34,6 +37,15 @@ func TestCreateExt4Image_Basic(t *testing.T) {
 	info, err := os.Stat(outputPath)
 	require.NoError(t, err)
 	assert.True(t, info.Size() > 0, "Image should have non-zero size")
+
+	// Read the contents back out of the image
+	img, err := ext4.Open(outputPath)
+	require.NoError(t, err)
+	defer img.Close()
+	assert.Equal(t, "rootfs", img.Label())
+	data, err := img.ReadFile("/subdir/nested.txt")
+	require.NoError(t, err)
+	assert.Equal(t, "nested content", string(data))
 }
 
 // TestCreateExt4Image_EmptyDirectory tests with empty source
@@ -119,6 +131,43 @@ func TestCreateExt4Image_LargeDirectory(t *testing.T) {
 	assert.FileExists(t, outputPath)
 }
 
+// TestHandleMounts_WritesIntoImage tests that bind mounts are copied into the ext4 image
+func TestHandleMounts_WritesIntoImage(t *testing.T) {
+	sourceDir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(sourceDir, "etc"), 0755))
+	rootfsPath := filepath.Join(t.TempDir(), "rootfs.ext4")
+
+	ip := NewImagePreparer(&PreparerConfig{RootfsDir: t.TempDir()}).(*ImagePreparer)
+	require.NoError(t, ip.createExt4Image(sourceDir, rootfsPath))
+
+	dataDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dataDir, "index.html"), []byte("hello"), 0644))
+	confFile := filepath.Join(t.TempDir(), "app.conf")
+	require.NoError(t, os.WriteFile(confFile, []byte("port=80"), 0600))
+
+	task := &types.Task{ID: "task-1", Annotations: make(map[string]string)}
+	mounts := []types.Mount{
+		{Source: dataDir, Target: "/srv/www"},
+		{Source: confFile, Target: "/etc/app.conf"},
+	}
+	require.NoError(t, ip.handleMounts(context.Background(), task, rootfsPath, mounts))
+
+	img, err := ext4.Open(rootfsPath)
+	require.NoError(t, err)
+	defer img.Close()
+	data, err := img.ReadFile("/srv/www/index.html")
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(data))
+	data, err = img.ReadFile("/etc/app.conf")
+	require.NoError(t, err)
+	assert.Equal(t, "port=80", string(data))
+
+	// Directories already in the image keep their permissions
+	info, err := img.Stat("/etc")
+	require.NoError(t, err)
+	assert.Equal(t, os.ModeDir|0755, info.Mode())
+}
+
 // TestGetDirSize_Basic tests directory size calculation
 func TestGetDirSize_Basic(t *testing.T) {
 	dir := t.TempDir()
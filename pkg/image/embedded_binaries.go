@@ -1,16 +1,24 @@
 // Package image provides init system injection for container images.
 package image
 
-import _ "embed"
+import (
+	"fmt"
+	"runtime"
+)
 
-// Embedded static binaries for injection into VM rootfs.
-// These are compiled for amd64 and provide init/shell capabilities.
+// Static binaries for injection into VM rootfs. Guests share the host's
+// architecture, so each build embeds only binaries/<name>-<GOARCH>, from
+// the embedded_binaries_<GOARCH>.go file for its architecture. The amd64
+// binaries are in the tree; `make binaries` downloads the arm64 ones, which
+// builds embed with the arm64binaries tag.
 
-//go:embed binaries/tini-amd64
-var tiniBinary []byte
-
-//go:embed binaries/busybox-amd64
-var busyboxBinary []byte
+// missingBinaryError explains that this build has no binary to inject.
+func missingBinaryError(name string) error {
+	if runtime.GOARCH == "arm64" {
+		return fmt.Errorf("no embedded %s binary for arm64: build with `make binaries` and the arm64binaries tag", name)
+	}
+	return fmt.Errorf("no embedded %s binary for %s: only amd64 and arm64 builds embed guest binaries", name, runtime.GOARCH)
+}
 
 // HasEmbeddedBinaries returns true if embedded binaries are available.
 func HasEmbeddedBinaries() bool {
@@ -0,0 +1,14 @@
+//go:build amd64
+
+package image
+
+import _ "embed"
+
+// Guest binaries for amd64 hosts.
+var (
+	//go:embed binaries/tini-amd64
+	tiniBinary []byte
+
+	//go:embed binaries/busybox-amd64
+	busyboxBinary []byte
+)
@@ -0,0 +1,15 @@
+//go:build arm64 && arm64binaries
+
+package image
+
+import _ "embed"
+
+// Guest binaries for arm64 hosts. They are not in the tree: run
+// `make binaries` and build with the arm64binaries tag.
+var (
+	//go:embed binaries/tini-arm64
+	tiniBinary []byte
+
+	//go:embed binaries/busybox-arm64
+	busyboxBinary []byte
+)
@@ -0,0 +1,10 @@
+//go:build !amd64 && !(arm64 && arm64binaries)
+
+package image
+
+// No guest binaries for other architectures, or for arm64 builds without
+// the arm64binaries tag; injection fails with missingBinaryError.
+var (
+	tiniBinary    []byte
+	busyboxBinary []byte
+)
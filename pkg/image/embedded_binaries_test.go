@@ -1,8 +1,12 @@
 package image
 
 import (
+	"bytes"
+	"debug/elf"
 	"os"
 	"path/filepath"
+	"runtime"
+	"strings"
 	"testing"
 )
 
@@ -234,3 +238,68 @@ func TestInjectBusyboxCreatesAppletSymlinks(t *testing.T) {
 		}
 	}
 }
+
+// TestEmbeddedBinariesMatchArch verifies the build embeds binaries for its
+// own architecture, and every binary in the tree is built for the
+// architecture its name says.
+func TestEmbeddedBinariesMatchArch(t *testing.T) {
+	machines := map[string]elf.Machine{
+		"amd64": elf.EM_X86_64,
+		"arm64": elf.EM_AARCH64,
+	}
+
+	check := func(t *testing.T, data []byte, goarch string) {
+		t.Helper()
+		want, ok := machines[goarch]
+		if !ok {
+			t.Fatalf("unsupported architecture %q", goarch)
+		}
+		f, err := elf.NewFile(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("not an ELF file: %v", err)
+		}
+		if f.Machine != want {
+			t.Errorf("built for %v, want %v", f.Machine, want)
+		}
+	}
+
+	// arm64 builds without the arm64binaries tag embed none
+	if _, ok := machines[runtime.GOARCH]; ok && HasEmbeddedBinaries() {
+		t.Run("embedded", func(t *testing.T) {
+			check(t, tiniBinary, runtime.GOARCH)
+			check(t, busyboxBinary, runtime.GOARCH)
+		})
+	}
+
+	entries, err := os.ReadDir("binaries")
+	if err != nil {
+		t.Fatalf("Failed to list binaries: %v", err)
+	}
+	for _, entry := range entries {
+		t.Run(entry.Name(), func(t *testing.T) {
+			idx := strings.LastIndex(entry.Name(), "-")
+			if idx < 0 {
+				t.Fatalf("binary name %q is not <name>-<arch>", entry.Name())
+			}
+			data, err := os.ReadFile(filepath.Join("binaries", entry.Name()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			check(t, data, entry.Name()[idx+1:])
+		})
+	}
+}
+
+// TestEmbeddedBinaryMissing verifies injection explains a build without
+// binaries.
+func TestEmbeddedBinaryMissing(t *testing.T) {
+	saved := tiniBinary
+	tiniBinary = nil
+	defer func() { tiniBinary = saved }()
+
+	injector := NewInitInjector(&InitSystemConfig{Type: InitSystemTini})
+	err := injector.injectTiniIntoDir(t.TempDir(), nil)
+	if err == nil || !strings.Contains(err.Error(), "no embedded tini binary") {
+		t.Errorf("injectTiniIntoDir without tini returned %v, want missing binary error", err)
+	}
+}
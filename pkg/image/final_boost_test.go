@@ -128,7 +128,7 @@ func TestPrepare_NilAnnotationsInitialization(t *testing.T) {
 	rootfsDir := t.TempDir()
 	imageID := generateImageID("nil-ann:v1")
 	rootfsPath := filepath.Join(rootfsDir, imageID+".ext4")
-	os.WriteFile(rootfsPath, []byte("rootfs"), 0644)
+	writeCachedRootfs(rootfsPath)
 
 	ip := NewImagePreparer(&PreparerConfig{
 		RootfsDir:  rootfsDir,
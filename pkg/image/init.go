@@ -29,7 +29,7 @@ type InitInjector struct {
 	config *InitSystemConfig
 }
 
-// tiniBinary is declared in embedded_binaries.go via go:embed.
+// tiniBinary is declared in embedded_binaries_<GOARCH>.go, read from its go:embed files.
 
 // NewInitInjector creates a new InitInjector.
 func NewInitInjector(config *InitSystemConfig) *InitInjector {
@@ -106,6 +106,9 @@ func (ii *InitInjector) injectTiniIntoDir(tmpDir string, info *OCIImageInfo) err
 	}
 
 	// Write the embedded tini binary to /sbin/tini
+	if len(tiniBinary) == 0 {
+		return missingBinaryError("tini")
+	}
 	tiniPath := filepath.Join(sbinDir, "tini")
 	if err := os.WriteFile(tiniPath, tiniBinary, 0755); err != nil {
 		return fmt.Errorf("failed to write tini binary: %w", err)
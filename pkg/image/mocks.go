@@ -6,6 +6,9 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"sync"
+
+	"github.com/restuhaqza/swarmcracker/pkg/ext4"
 )
 
 // ContainerRuntime defines the interface for container runtime operations
@@ -85,18 +88,27 @@ func (r *RealContainerRuntime) ImageExists(ctx context.Context, imageRef string)
 	return cmd.Run() == nil
 }
 
-// RealFilesystemOperator implements FilesystemOperator using real system calls
-type RealFilesystemOperator struct{}
+// RealFilesystemOperator implements FilesystemOperator using real system calls.
+// Images are built and edited with pkg/ext4, so no root or loop devices are
+// needed: Mount extracts the image into mountDir and Unmount writes the
+// directory back into the image.
+type RealFilesystemOperator struct {
+	mu     sync.Mutex
+	mounts map[string]string
+}
 
 func NewRealFilesystemOperator() FilesystemOperator {
 	return &RealFilesystemOperator{}
 }
 
+// MkfsExt4 formats outputPath, which must already have its final size, with
+// the contents of sourceDir.
 func (r *RealFilesystemOperator) MkfsExt4(sourceDir, outputPath string) error {
-	cmd := exec.Command("mkfs.ext4", "-d", sourceDir, outputPath)
-	output, err := cmd.CombinedOutput()
-	_ = output
-	return err
+	info, err := os.Stat(outputPath)
+	if err != nil {
+		return err
+	}
+	return ext4.CreateFromDir(outputPath, sourceDir, ext4.Options{Size: info.Size()})
 }
 
 func (r *RealFilesystemOperator) Truncate(path string, sizeMB int) error {
@@ -105,15 +117,36 @@ func (r *RealFilesystemOperator) Truncate(path string, sizeMB int) error {
 }
 
 func (r *RealFilesystemOperator) Mount(imagePath, mountDir string) error {
-	cmd := exec.Command("mount", "-o", "loop", imagePath, mountDir)
-	output, err := cmd.CombinedOutput()
-	_ = output
-	return err
+	img, err := ext4.Open(imagePath)
+	if err != nil {
+		return err
+	}
+	defer img.Close()
+	if err := img.Extract(".", mountDir); err != nil {
+		os.RemoveAll(mountDir)
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.mounts == nil {
+		r.mounts = make(map[string]string)
+	}
+	r.mounts[mountDir] = imagePath
+	return nil
 }
 
 func (r *RealFilesystemOperator) Unmount(mountDir string) error {
-	cmd := exec.Command("umount", mountDir)
-	return cmd.Run()
+	r.mu.Lock()
+	imagePath, ok := r.mounts[mountDir]
+	delete(r.mounts, mountDir)
+	r.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("%s is not mounted", mountDir)
+	}
+
+	defer os.RemoveAll(mountDir)
+	return ext4.InjectDir(imagePath, mountDir)
 }
 
 func (r *RealFilesystemOperator) CreateFile(path string) error {
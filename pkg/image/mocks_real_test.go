@@ -12,6 +12,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/restuhaqza/swarmcracker/pkg/ext4"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -379,6 +380,39 @@ func TestRealFilesystemOperator_MkfsExt4(t *testing.T) {
 	}
 }
 
+// TestRealFilesystemOperator_MountRoundTrip tests that changes made under a
+// mount are written back into the image on unmount
+func TestRealFilesystemOperator_MountRoundTrip(t *testing.T) {
+	fs := NewRealFilesystemOperator()
+	tmpDir := t.TempDir()
+
+	sourceDir := filepath.Join(tmpDir, "source")
+	require.NoError(t, os.MkdirAll(filepath.Join(sourceDir, "etc"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(sourceDir, "etc", "hostname"), []byte("vm"), 0644))
+
+	imagePath := filepath.Join(tmpDir, "rootfs.ext4")
+	require.NoError(t, fs.Truncate(imagePath, 8))
+	require.NoError(t, fs.MkfsExt4(sourceDir, imagePath))
+
+	mountDir := filepath.Join(tmpDir, "mnt")
+	require.NoError(t, fs.Mount(imagePath, mountDir))
+	data, err := os.ReadFile(filepath.Join(mountDir, "etc", "hostname"))
+	require.NoError(t, err)
+	assert.Equal(t, "vm", string(data))
+
+	require.NoError(t, fs.CopyFile(filepath.Join(mountDir, "etc", "hostname"), filepath.Join(mountDir, "etc", "copy"), 0600))
+	require.NoError(t, fs.Unmount(mountDir))
+	assert.NoDirExists(t, mountDir)
+	assert.Error(t, fs.Unmount(mountDir), "second unmount should fail")
+
+	img, err := ext4.Open(imagePath)
+	require.NoError(t, err)
+	defer img.Close()
+	data, err = img.ReadFile("etc/copy")
+	require.NoError(t, err)
+	assert.Equal(t, "vm", string(data))
+}
+
 // TestRealFilesystemOperator_Truncate tests Truncate method
 func TestRealFilesystemOperator_Truncate(t *testing.T) {
 	tests := []struct {
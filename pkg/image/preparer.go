@@ -9,18 +9,21 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
-	"runtime"
 	"strings"
 	"syscall"
 	"time"
 
 	"github.com/google/go-containerregistry/pkg/name"
-	v1 "github.com/google/go-containerregistry/pkg/v1"
 	"github.com/google/go-containerregistry/pkg/v1/mutate"
-	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/restuhaqza/swarmcracker/pkg/arch"
+	"github.com/restuhaqza/swarmcracker/pkg/events"
+	"github.com/restuhaqza/swarmcracker/pkg/ext4"
 	"github.com/restuhaqza/swarmcracker/pkg/storage"
+	"github.com/restuhaqza/swarmcracker/pkg/tracing"
 	localtypes "github.com/restuhaqza/swarmcracker/pkg/types"
 	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/attribute"
+	"golang.org/x/sys/unix"
 )
 
 // ImagePreparer prepares OCI images as root filesystems.
@@ -31,9 +34,14 @@ type ImagePreparer struct {
 	initInjector  *InitInjector
 	volumeManager *storage.VolumeManager
 	secretManager *storage.SecretManager
-	ociInfo       *OCIImageInfo // Parsed OCI image configuration
+	ociInfo       *OCIImageInfo    // Parsed OCI image configuration
+	events        events.Publisher // nil disables events
 }
 
+// taskKey carries the task being prepared through ctx, so pull and build
+// events can name it.
+type taskKey struct{}
+
 // PreparerConfig holds image preparer configuration.
 type PreparerConfig struct {
 	KernelPath      string
@@ -103,8 +111,25 @@ func NewImagePreparer(config interface{}) localtypes.ImagePreparer {
 	}
 }
 
+// SetEventPublisher makes the preparer publish image pull and rootfs build
+// events to p.
+func (ip *ImagePreparer) SetEventPublisher(p events.Publisher) {
+	ip.events = p
+}
+
+// publish sends a lifecycle event for the task in ctx, if events are enabled.
+func (ip *ImagePreparer) publish(ctx context.Context, typ events.Type, message string, err error, attrs map[string]string) {
+	if ip.events == nil {
+		return
+	}
+	task, _ := ctx.Value(taskKey{}).(*localtypes.Task)
+	e := events.TaskEvent(typ, task, message, err)
+	e.Attributes = attrs
+	ip.events.Publish(e)
+}
+
 // Prepare prepares an OCI image for the given task.
-func (ip *ImagePreparer) Prepare(ctx context.Context, task *localtypes.Task) error {
+func (ip *ImagePreparer) Prepare(ctx context.Context, task *localtypes.Task) (err error) {
 	if task == nil {
 		return fmt.Errorf("task cannot be nil")
 	}
@@ -123,6 +148,9 @@ func (ip *ImagePreparer) Prepare(ctx context.Context, task *localtypes.Task) err
 		Str("task_id", task.ID).
 		Str("image", container.Image).
 		Msg("Preparing container image")
+	ctx = context.WithValue(ctx, taskKey{}, task)
+	ctx, span := tracing.Start(ctx, "image.prepare", attribute.String("image", container.Image))
+	defer func() { tracing.End(span, err) }()
 
 	// Validate architecture support
 	if err := ip.validateArchitecture(); err != nil {
@@ -134,29 +162,46 @@ func (ip *ImagePreparer) Prepare(ctx context.Context, task *localtypes.Task) err
 	rootfsPath := filepath.Join(ip.rootfsDir, imageID+".ext4")
 
 	// Check if rootfs already exists with valid init
+	cached := false
 	if _, err := os.Stat(rootfsPath); err == nil {
 		// Verify cached rootfs has valid /init
 		if ip.verifyCachedRootfs(rootfsPath) {
 			log.Info().
 				Str("path", rootfsPath).
 				Msg("Rootfs already exists and valid, skipping")
-			task.Annotations["rootfs"] = rootfsPath
-			return nil
+			ip.publish(ctx, events.ImagePullFinish, "Image already present", nil,
+				map[string]string{"image": container.Image, "cached": "true"})
+			span.SetAttributes(attribute.Bool("image.cached", true))
+			cached = true
+		} else {
+			log.Info().
+				Str("path", rootfsPath).
+				Msg("Cached rootfs invalid (missing init), re-preparing")
 		}
-		log.Info().
-			Str("path", rootfsPath).
-			Msg("Cached rootfs invalid (missing init), re-preparing")
 	}
 
-	// Prepare the image with file locking for concurrent safety
-	if err := ip.prepareWithLock(ctx, container.Image, imageID, rootfsPath); err != nil {
-		return fmt.Errorf("failed to prepare image: %w", err)
+	if !cached {
+		// Prepare the image with file locking for concurrent safety
+		if err := ip.prepareWithLock(ctx, container.Image, imageID, rootfsPath); err != nil {
+			return fmt.Errorf("failed to prepare image: %w", err)
+		}
+
+		// Store init system type in annotations (init was injected during prepareImage)
+		if ip.initInjector.IsEnabled() {
+			task.Annotations["init_system"] = string(ip.initInjector.config.Type)
+			task.Annotations["init_path"] = ip.initInjector.GetInitPath()
+		}
 	}
 
-	// Store init system type in annotations (init was injected during prepareImage)
-	if ip.initInjector.IsEnabled() {
-		task.Annotations["init_system"] = string(ip.initInjector.config.Type)
-		task.Annotations["init_path"] = ip.initInjector.GetInitPath()
+	// The cached image is shared by every task of the image: a task that
+	// writes into its rootfs gets a private copy, so its secrets and volume
+	// data never reach the cache or other VMs
+	if len(task.Secrets) > 0 || len(task.Configs) > 0 || len(container.Mounts) > 0 {
+		taskRootfs := TaskRootfsPath(ip.rootfsDir, task.ID)
+		if err := CloneRootfs(rootfsPath, taskRootfs); err != nil {
+			return fmt.Errorf("failed to copy rootfs for task: %w", err)
+		}
+		rootfsPath = taskRootfs
 	}
 
 	// Handle mounts if volume manager is available
@@ -206,6 +251,43 @@ func (ip *ImagePreparer) Prepare(ctx context.Context, task *localtypes.Task) err
 	return nil
 }
 
+// TaskRootfsPath returns where the private rootfs copy of a task is kept.
+// Copies live in a subdirectory so image listing and cleanup skip them.
+func TaskRootfsPath(rootfsDir, taskID string) string {
+	return filepath.Join(rootfsDir, "tasks", taskID+".ext4")
+}
+
+// CloneRootfs copies the image at src to dst, replacing dst. The copy
+// shares its blocks with src on file systems that support reflinks and is
+// only readable by its owner, since secrets are injected into it.
+func CloneRootfs(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(dst), filepath.Base(dst)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := unix.IoctlFileClone(int(tmp.Fd()), int(in.Fd())); err != nil {
+		if _, err := io.Copy(tmp, in); err != nil {
+			tmp.Close()
+			return fmt.Errorf("failed to copy %s: %w", src, err)
+		}
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), dst)
+}
+
 // prepareImage prepares an OCI image and converts to ext4 filesystem.
 // Init injection happens BEFORE ext4 creation so files are included.
 func (ip *ImagePreparer) prepareImage(ctx context.Context, imageRef, imageID, outputPath string) error {
@@ -219,15 +301,28 @@ func (ip *ImagePreparer) prepareImage(ctx context.Context, imageRef, imageID, ou
 	// Step 1: Validate image manifest (OS/architecture compatibility)
 	log.Debug().Str("image", imageRef).Msg("Validating image manifest")
 	buildOpts := buildRemoteOptions(ctx, ip.config.RegistryAuth)
-	if err := validateImageManifest(ctx, imageRef, buildOpts...); err != nil {
+	_, span := tracing.Start(ctx, "image.validate")
+	err = validateImageManifest(ctx, imageRef, buildOpts...)
+	tracing.End(span, err)
+	if err != nil {
 		return fmt.Errorf("image validation failed: %w", err)
 	}
 
 	// Step 2: Pull and extract OCI image
 	log.Debug().Str("image", imageRef).Msg("Pulling OCI image")
-	if err := ip.extractOCIImage(ctx, imageRef, tmpDir); err != nil {
+	ip.publish(ctx, events.ImagePullStart, "Pulling image", nil, map[string]string{"image": imageRef})
+	pullStart := time.Now()
+	pullCtx, span := tracing.Start(ctx, "image.pull")
+	err = ip.extractOCIImage(pullCtx, imageRef, tmpDir)
+	tracing.End(span, err)
+	if err != nil {
+		ip.publish(ctx, events.ImagePullFinish, "Image pull failed", err, map[string]string{"image": imageRef})
 		return fmt.Errorf("failed to extract OCI image: %w", err)
 	}
+	ip.publish(ctx, events.ImagePullFinish, "Pulled image", nil, map[string]string{
+		"image":    imageRef,
+		"duration": time.Since(pullStart).Round(time.Millisecond).String(),
+	})
 
 	// Step 3: Validate critical symlinks (especially /bin/sh)
 	log.Debug().Str("tmpDir", tmpDir).Msg("Validating critical symlinks")
@@ -236,6 +331,7 @@ func (ip *ImagePreparer) prepareImage(ctx context.Context, imageRef, imageID, ou
 	}
 
 	// Step 4: Inject init system BEFORE ext4 creation (NEW - was after)
+	_, span = tracing.Start(ctx, "image.inject")
 	if ip.initInjector.IsEnabled() {
 		log.Info().
 			Str("init_system", string(ip.initInjector.config.Type)).
@@ -243,6 +339,7 @@ func (ip *ImagePreparer) prepareImage(ctx context.Context, imageRef, imageID, ou
 
 		// Pass OCI config to init injector for generic wrapper
 		if err := ip.initInjector.InjectIntoDir(tmpDir, ip.ociInfo); err != nil {
+			tracing.End(span, err)
 			return fmt.Errorf("failed to inject init system: %w", err)
 		}
 	}
@@ -250,6 +347,7 @@ func (ip *ImagePreparer) prepareImage(ctx context.Context, imageRef, imageID, ou
 	// Step 5: Inject essential files (DNS, hosts, nsswitch, machine-id, dirs)
 	log.Debug().Str("tmpDir", tmpDir).Msg("Injecting essential files")
 	if err := injectEssentialFiles(tmpDir, imageID); err != nil {
+		tracing.End(span, err)
 		return fmt.Errorf("failed to inject essential files: %w", err)
 	}
 
@@ -257,15 +355,29 @@ func (ip *ImagePreparer) prepareImage(ctx context.Context, imageRef, imageID, ou
 	if err := ip.injectNetworkConfig(tmpDir); err != nil {
 		log.Warn().Err(err).Msg("Failed to inject network config (may still work if image has it)")
 	}
+	span.End()
 
 	// Step 7: Create ext4 filesystem image (now includes init files)
 	log.Debug().Str("output", outputPath).Msg("Creating ext4 filesystem")
-	if err := ip.createExt4Image(tmpDir, outputPath); err != nil {
+	buildStart := time.Now()
+	_, span = tracing.Start(ctx, "image.mkfs")
+	err = ip.createExt4Image(tmpDir, outputPath)
+	tracing.End(span, err)
+	if err != nil {
+		ip.publish(ctx, events.RootfsBuild, "Rootfs build failed", err, map[string]string{"image": imageRef})
 		return fmt.Errorf("failed to create ext4 image: %w", err)
 	}
+	ip.publish(ctx, events.RootfsBuild, "Built rootfs", nil, map[string]string{
+		"image":    imageRef,
+		"path":     outputPath,
+		"duration": time.Since(buildStart).Round(time.Millisecond).String(),
+	})
 
 	// Step 8: Verify rootfs is bootable (graceful warning if verification fails)
-	if err := VerifyBootable(outputPath); err != nil {
+	_, span = tracing.Start(ctx, "image.verify")
+	err = VerifyBootable(outputPath)
+	tracing.End(span, err)
+	if err != nil {
 		log.Warn().Err(err).Msg("Rootfs verification failed, but continuing")
 		// Don't fail the whole preparation — just warn
 	}
@@ -294,7 +406,10 @@ func (ip *ImagePreparer) prepareWithLock(ctx context.Context, imageRef, imageID,
 
 	// Acquire exclusive lock
 	log.Debug().Str("lock", lockPath).Msg("Acquiring lock for image preparation")
-	if err := syscall.Flock(int(lockFile.Fd()), syscall.LOCK_EX); err != nil {
+	_, span := tracing.Start(ctx, "image.lock")
+	err = syscall.Flock(int(lockFile.Fd()), syscall.LOCK_EX)
+	tracing.End(span, err)
+	if err != nil {
 		return fmt.Errorf("failed to acquire lock: %w", err)
 	}
 	defer syscall.Flock(int(lockFile.Fd()), syscall.LOCK_UN)
@@ -316,7 +431,7 @@ func (ip *ImagePreparer) prepareWithLock(ctx context.Context, imageRef, imageID,
 }
 
 // verifyCachedRootfs checks if a cached rootfs has a valid /init entry.
-// Uses debugfs to inspect the ext4 image without mounting.
+// Reads the ext4 image directly without mounting.
 func (ip *ImagePreparer) verifyCachedRootfs(rootfsPath string) bool {
 	// Check if rootfs file exists first
 	if _, err := os.Stat(rootfsPath); err != nil {
@@ -324,20 +439,16 @@ func (ip *ImagePreparer) verifyCachedRootfs(rootfsPath string) bool {
 		return false
 	}
 
-	// Check if debugfs is available
-	if _, err := exec.LookPath("debugfs"); err != nil {
-		// debugfs not available, assume rootfs is valid
-		log.Debug().Msg("debugfs not available, assuming cached rootfs is valid")
-		return true
+	img, err := ext4.Open(rootfsPath)
+	if err != nil {
+		log.Debug().Err(err).Str("path", rootfsPath).Msg("Cached rootfs unreadable, will re-prepare")
+		return false
 	}
+	defer img.Close()
 
-	// Use debugfs to check for /init
-	cmd := exec.Command("debugfs", "-R", "stat /init", rootfsPath)
-	output, err := cmd.CombinedOutput()
-	if err != nil {
+	if _, err := img.Lstat("/init"); err != nil {
 		log.Debug().
 			Err(err).
-			Str("output", string(output)).
 			Msg("Cached rootfs missing /init, will re-prepare")
 		return false
 	}
@@ -418,17 +529,14 @@ func (ip *ImagePreparer) extractWithGGCR(ctx context.Context, imageRef, destPath
 		return fmt.Errorf("failed to parse image reference %q: %w", fullRef, err)
 	}
 
-	// Build remote options with auth and explicit platform selection
+	// Build remote options with auth
 	opts := buildRemoteOptions(ctx, ip.config.RegistryAuth)
-	opts = append(opts, remote.WithPlatform(v1.Platform{
-		OS:           "linux",
-		Architecture: runtime.GOARCH,
-	}))
 
 	log.Info().Str("image", fullRef).Msg("Pulling image from registry")
 
-	// Pull image from registry (no daemon required)
-	img, err := remote.Image(ref, opts...)
+	// Pull the host architecture's image from the registry (no daemon
+	// required), preferring its variant in multi-arch indexes
+	img, err := arch.Default().Image(ref, opts...)
 	if err != nil {
 		return fmt.Errorf("failed to pull image %q: %w", fullRef, err)
 	}
@@ -598,11 +706,6 @@ func (ip *ImagePreparer) createExt4ImageWithOverhead(sourceDir, outputPath strin
 		return fmt.Errorf("source directory does not exist: %w", err)
 	}
 
-	// Check if mkfs.ext4 is available
-	if _, err := exec.LookPath("mkfs.ext4"); err != nil {
-		return fmt.Errorf("mkfs.ext4 not found: %w", err)
-	}
-
 	// Calculate directory size
 	var dirSize int64
 	filepath.Walk(sourceDir, func(_ string, info os.FileInfo, walkErr error) error {
@@ -649,20 +752,15 @@ func (ip *ImagePreparer) createExt4ImageWithOverhead(sourceDir, outputPath strin
 		inodeRatio = 4096
 	}
 
-	// Create ext4 with explicit size using mkfs.ext4 -d
-	cmd := exec.Command("mkfs.ext4",
-		"-d", sourceDir,
-		"-b", fmt.Sprintf("%d", blockSize),
-		"-L", "rootfs",
-		"-i", fmt.Sprintf("%d", inodeRatio),
-		outputPath,
-		fmt.Sprintf("%d", blockCount),
-	)
-
-	output, err := cmd.CombinedOutput()
+	// Build the filesystem in user space; no mkfs, loop device or root needed
+	err := ext4.CreateFromDir(outputPath, sourceDir, ext4.Options{
+		Size:   blockCount * blockSize,
+		Inodes: uint32(blockCount * blockSize / inodeRatio),
+		Label:  "rootfs",
+	})
 	if err != nil {
 		os.Remove(outputPath)
-		return fmt.Errorf("mkfs.ext4 failed: %w\nOutput: %s", err, string(output))
+		return fmt.Errorf("failed to build ext4 image: %w", err)
 	}
 
 	log.Info().
@@ -713,17 +811,8 @@ func generateImageID(imageRef string) string {
 func (ip *ImagePreparer) injectInitSystem(rootfsPath string) error {
 	// Init injection now happens via InjectIntoDir BEFORE ext4 creation.
 	// The old Inject method (which used broken mountRootfs) has been removed.
-	// If init needs to be injected post-creation (unusual), mount and copy manually.
-
-	// For ext4 images, we need to mount, copy, unmount
-	// This is a simplified implementation
-	mountDir, err := ip.mountExt4(rootfsPath)
-	if err != nil {
-		log.Debug().Err(err).Msg("Could not mount rootfs for init injection (may require privileges)")
-		// Continue anyway - init might already be present
-		return nil
-	}
-	defer ip.unmountExt4(mountDir)
+	// If init needs to be injected post-creation (unusual), the binary is
+	// written straight into the ext4 image.
 
 	// Copy init binary
 	initBinaryPath := ip.getInitBinaryPath()
@@ -732,13 +821,13 @@ func (ip *ImagePreparer) injectInitSystem(rootfsPath string) error {
 		return nil
 	}
 
-	targetPath := filepath.Join(mountDir, ip.initInjector.GetInitPath())
-	if err := os.MkdirAll(filepath.Dir(targetPath), 0755); err != nil {
-		return fmt.Errorf("failed to create init directory: %w", err)
+	data, err := os.ReadFile(initBinaryPath)
+	if err != nil {
+		return fmt.Errorf("failed to read init binary: %w", err)
 	}
 
-	// Copy binary
-	if err := ip.copyFile(initBinaryPath, targetPath, 0755); err != nil {
+	targetPath := ip.initInjector.GetInitPath()
+	if err := ext4.WriteFile(rootfsPath, targetPath, data, 0755); err != nil {
 		return fmt.Errorf("failed to copy init binary: %w", err)
 	}
 
@@ -747,34 +836,9 @@ func (ip *ImagePreparer) injectInitSystem(rootfsPath string) error {
 		Str("to", targetPath).
 		Msg("Init binary copied")
 
-	// Create /sbin/init wrapper that runs tini with entrypoint
-	if err := ip.createInitWrapper(mountDir); err != nil {
-		log.Warn().Err(err).Msg("Failed to create init wrapper")
-	}
-
 	return nil
 }
 
-// mountExt4 mounts an ext4 image temporarily.
-func (ip *ImagePreparer) mountExt4(imagePath string) (string, error) {
-	// Create temp mount point
-	mountDir, err := os.MkdirTemp("", "swarmcracker-mount-")
-	if err != nil {
-		return "", err
-	}
-
-	// Try to mount the image
-	// This requires root privileges or user namespace setup
-	// For non-root, we'll skip this step
-	cmd := exec.Command("mount", "-o", "loop", imagePath, mountDir)
-	if output, err := cmd.CombinedOutput(); err != nil {
-		os.RemoveAll(mountDir)
-		return "", fmt.Errorf("mount failed: %s: %w", string(output), err)
-	}
-
-	return mountDir, nil
-}
-
 // createInitWrapper creates /sbin/init as a wrapper that calls tini with entrypoint.
 // Deprecated: This method is only used by the deprecated Inject() method.
 // The generic wrapper is now created by createGenericInitWrapper in injectTiniIntoDir.
@@ -786,17 +850,6 @@ func (ip *ImagePreparer) createInitWrapper(mountDir string) error {
 	return nil
 }
 
-// unmountExt4 unmounts a temporary mount point.
-func (ip *ImagePreparer) unmountExt4(mountDir string) error {
-	// Unmount
-	cmd := exec.Command("umount", mountDir)
-	_ = cmd.Run() // Ignore errors
-
-	// Cleanup temp dir
-	os.RemoveAll(mountDir)
-	return nil
-}
-
 // getInitBinaryPath returns the path to the init binary on the host.
 func (ip *ImagePreparer) getInitBinaryPath() string {
 	// Search for init binaries in common locations
@@ -842,15 +895,22 @@ func (ip *ImagePreparer) copyFile(src, dst string, mode os.FileMode) error {
 }
 
 // handleMounts processes mount specifications and applies them to the rootfs.
+// Mount contents are staged in a scratch directory laid out like the rootfs
+// and then copied into the ext4 image in one pass.
 func (ip *ImagePreparer) handleMounts(ctx context.Context, task *localtypes.Task, rootfsPath string, mounts []localtypes.Mount) error {
-	// Temporarily mount the rootfs to apply mounts
-	mountDir, err := ip.mountExt4(rootfsPath)
+	img, err := ext4.Open(rootfsPath)
 	if err != nil {
-		log.Warn().Err(err).Msg("Could not mount rootfs for mount handling (may require privileges)")
+		log.Warn().Err(err).Msg("Could not open rootfs image for mount handling")
 		// Continue without mounts - non-critical
 		return nil
 	}
-	defer ip.unmountExt4(mountDir)
+	img.Close()
+
+	mountDir, err := os.MkdirTemp("", "swarmcracker-mounts-")
+	if err != nil {
+		return fmt.Errorf("failed to create staging directory: %w", err)
+	}
+	defer os.RemoveAll(mountDir)
 
 	for _, mount := range mounts {
 		if mount.Target == "" {
@@ -888,11 +948,21 @@ func (ip *ImagePreparer) handleMounts(ctx context.Context, task *localtypes.Task
 		}
 	}
 
+	if err := ext4.InjectDir(rootfsPath, mountDir); err != nil {
+		log.Warn().Err(err).Msg("Could not write mounts into rootfs image")
+		// Continue without mounts - non-critical
+		return nil
+	}
+
 	return nil
 }
 
 // handleVolumeMount handles a volume mount.
 func (ip *ImagePreparer) handleVolumeMount(ctx context.Context, task *localtypes.Task, rootfsPath string, mount *localtypes.Mount) error {
+	if ip.volumeManager == nil {
+		return fmt.Errorf("volume manager not configured")
+	}
+
 	// Extract volume name
 	volumeName := storage.ExtractVolumeName(mount.Source)
 
@@ -1172,12 +1242,13 @@ iface eth0 inet dhcp
 ::sysinit:/usr/sbin/udhcpc -i eth0 -s /usr/share/udhcpc/default.script -q -n
 
 # Serial console
-ttyS0::respawn:/sbin/getty -L 115200 ttyS0 vt100
+{console}::respawn:/sbin/getty -L 115200 {console} vt100
 
 # Shutdown
 ::ctrlaltdel:/sbin/reboot
 ::shutdown:/bin/busybox umount -a -r
 `
+	initTabContent = strings.ReplaceAll(initTabContent, "{console}", arch.Default().Console)
 	if err := os.WriteFile(initTabPath, []byte(initTabContent), 0644); err != nil {
 		return fmt.Errorf("failed to write inittab: %w", err)
 	}
@@ -1247,13 +1318,8 @@ stop() {
 
 // validateArchitecture checks if the host architecture is supported
 func (ip *ImagePreparer) validateArchitecture() error {
-	// Firecracker supports x86_64 and aarch64
-	switch runtime.GOARCH {
-	case "amd64", "arm64":
-		return nil
-	default:
-		return fmt.Errorf("unsupported architecture: %s (Firecracker requires amd64 or arm64)", runtime.GOARCH)
-	}
+	_, err := arch.Host()
+	return err
 }
 
 // GetOCIInfo returns the parsed OCI image configuration.
@@ -4,7 +4,6 @@ import (
 	"context"
 	"os"
 	"path/filepath"
-	"strings"
 	"testing"
 
 	"github.com/restuhaqza/swarmcracker/pkg/types"
@@ -54,7 +53,7 @@ func TestImagePreparer_Prepare_WithExistingRootfs(t *testing.T) {
 	// Create an existing rootfs file
 	imageID := generateImageID("nginx:latest")
 	rootfsPath := filepath.Join(tmpDir, imageID+".ext4")
-	err := os.WriteFile(rootfsPath, []byte("fake rootfs"), 0644)
+	err := writeCachedRootfs(rootfsPath)
 	require.NoError(t, err)
 
 	task := &types.Task{
@@ -183,8 +182,7 @@ func TestImagePreparer_createExt4Image_DirSizeErrors(t *testing.T) {
 	outputPath := filepath.Join(tmpDir, "output.ext4")
 
 	err := ip.createExt4Image(sourceDir, outputPath)
-	// Should fail on dir size calculation and use default size,
-	// then fail on truncate/mkfs commands
+	// Should fail because the source directory does not exist
 	assert.Error(t, err)
 }
 
@@ -233,13 +231,12 @@ func TestImagePreparer_createExt4Image_SmallDirectory(t *testing.T) {
 	outputPath := filepath.Join(tmpDir, "small.ext4")
 
 	err = ip.createExt4Image(sourceDir, outputPath)
+	require.NoError(t, err)
+
 	// Should apply minimum 100MB size
-	// (will fail on truncate/mkfs commands)
-	if err != nil {
-		assert.True(t,
-			strings.Contains(err.Error(), "truncate") ||
-				strings.Contains(err.Error(), "mkfs.ext4"))
-	}
+	info, err := os.Stat(outputPath)
+	require.NoError(t, err)
+	assert.Equal(t, int64(100*1024*1024), info.Size())
 }
 
 func TestGetDirSize_SpecialCases(t *testing.T) {
@@ -390,7 +387,7 @@ func TestImagePreparer_Prepare_ConcurrentSameImage(t *testing.T) {
 	// Create existing rootfs to simulate race condition
 	imageID := generateImageID("nginx:latest")
 	rootfsPath := filepath.Join(tmpDir, imageID+".ext4")
-	err := os.WriteFile(rootfsPath, []byte("fake rootfs"), 0644)
+	err := writeCachedRootfs(rootfsPath)
 	require.NoError(t, err)
 
 	// Try to prepare same image concurrently
@@ -429,7 +426,7 @@ func TestImagePreparer_Prepare_VerifyRootfsAnnotation(t *testing.T) {
 	// Create existing rootfs
 	imageID := generateImageID("redis:alpine")
 	rootfsPath := filepath.Join(tmpDir, imageID+".ext4")
-	err := os.WriteFile(rootfsPath, []byte("fake rootfs"), 0644)
+	err := writeCachedRootfs(rootfsPath)
 	require.NoError(t, err)
 
 	task := &types.Task{
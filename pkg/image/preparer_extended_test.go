@@ -221,28 +221,6 @@ func TestPreparerExtended_InjectNetworkConfig(t *testing.T) {
 	}
 }
 
-// TestPreparerExtended_UnmountExt4 tests unmountExt4 function
-func TestPreparerExtended_UnmountExt4(t *testing.T) {
-	tempDir, err := os.MkdirTemp("", "unmount-test-")
-	if err != nil {
-		t.Fatalf("Failed to create temp dir: %v", err)
-	}
-	defer os.RemoveAll(tempDir)
-
-	prep := &ImagePreparer{}
-
-	// Test unmount of non-mounted directory (should not error)
-	if err := prep.unmountExt4(tempDir); err != nil {
-		t.Errorf("unmountExt4 should not error on non-mounted dir: %v", err)
-	}
-
-	// Verify directory was cleaned up
-	if _, err := os.Stat(tempDir); os.IsExist(err) {
-		// unmountExt4 calls RemoveAll, so dir should be gone
-		// This is expected behavior
-	}
-}
-
 // TestPreparerExtended_HandleMounts tests handleMounts function
 func TestPreparerExtended_HandleMounts(t *testing.T) {
 	tempDir, err := os.MkdirTemp("", "mounts-test-")
@@ -758,34 +736,3 @@ func TestPreparerExtended_GetInitBinaryPath(t *testing.T) {
 		})
 	}
 }
-
-// TestPreparerExtended_MountExt4 tests mountExt4 function
-func TestPreparerExtended_MountExt4(t *testing.T) {
-	tempDir, err := os.MkdirTemp("", "mount-test-")
-	if err != nil {
-		t.Fatalf("Failed to create temp dir: %v", err)
-	}
-	defer os.RemoveAll(tempDir)
-
-	// Create fake ext4 file
-	imagePath := filepath.Join(tempDir, "test.ext4")
-	if err := os.WriteFile(imagePath, []byte("fake ext4"), 0644); err != nil {
-		t.Fatalf("Failed to create image file: %v", err)
-	}
-
-	prep := &ImagePreparer{}
-
-	// Will fail without root privileges
-	mountDir, err := prep.mountExt4(imagePath)
-	if err != nil {
-		t.Logf("mountExt4 failed as expected without root: %v", err)
-		return
-	}
-
-	// If succeeded, cleanup
-	defer prep.unmountExt4(mountDir)
-
-	if mountDir == "" {
-		t.Error("mountDir should not be empty on success")
-	}
-}
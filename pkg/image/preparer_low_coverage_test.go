@@ -443,96 +443,6 @@ func TestHandleVolumeMount_ErrorPaths(t *testing.T) {
 	t.Skip("Volume mount tests require full volume manager integration")
 }
 
-// TestMountExt4_ErrorPaths tests mountExt4 error paths
-func TestMountExt4_ErrorPaths(t *testing.T) {
-	tests := []struct {
-		name        string
-		setupFile   func(*testing.T) string
-		wantErr     bool
-		errContains string
-	}{
-		{
-			name: "invalid_ext4_file",
-			setupFile: func(t *testing.T) string {
-				path := filepath.Join(t.TempDir(), "invalid.ext4")
-				err := os.WriteFile(path, []byte("not an ext4 filesystem"), 0644)
-				require.NoError(t, err)
-				return path
-			},
-			wantErr:     true, // mount will fail
-			errContains: "mount failed",
-		},
-		{
-			name: "nonexistent_file",
-			setupFile: func(t *testing.T) string {
-				return filepath.Join(t.TempDir(), "nonexistent.ext4")
-			},
-			wantErr:     true,
-			errContains: "mount failed",
-		},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			ip := NewImagePreparer(&PreparerConfig{
-				RootfsDir: t.TempDir(),
-			}).(*ImagePreparer)
-
-			imagePath := tt.setupFile(t)
-
-			mountDir, err := ip.mountExt4(imagePath)
-
-			if tt.wantErr {
-				assert.Error(t, err)
-				if tt.errContains != "" {
-					assert.Contains(t, err.Error(), tt.errContains)
-				}
-			} else {
-				assert.NoError(t, err)
-				assert.NotEmpty(t, mountDir)
-				// Cleanup if mount succeeded
-				if mountDir != "" {
-					ip.unmountExt4(mountDir)
-				}
-			}
-		})
-	}
-}
-
-// TestUnmountExt4 tests unmountExt4 behavior
-func TestUnmountExt4(t *testing.T) {
-	tests := []struct {
-		name       string
-		setupMount func(*testing.T) string
-	}{
-		{
-			name: "unmount_temp_dir",
-			setupMount: func(t *testing.T) string {
-				return t.TempDir()
-			},
-		},
-		{
-			name: "unmount_nonexistent_dir",
-			setupMount: func(t *testing.T) string {
-				return filepath.Join(t.TempDir(), "nonexistent-mount")
-			},
-		},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			ip := NewImagePreparer(&PreparerConfig{
-				RootfsDir: t.TempDir(),
-			}).(*ImagePreparer)
-
-			mountDir := tt.setupMount(t)
-			// unmountExt4 always returns nil (ignores errors)
-			err := ip.unmountExt4(mountDir)
-			assert.NoError(t, err, "unmountExt4 should not return error")
-		})
-	}
-}
-
 // TestCopyFile_ErrorPaths tests copyFile error paths
 func TestCopyFile_ErrorPaths(t *testing.T) {
 	tests := []struct {
@@ -551,49 +551,6 @@ func TestHandleBindMount_Low(t *testing.T) {
 	}
 }
 
-// TestMountExt4_Low tests mountExt4 method
-func TestMountExt4_Low(t *testing.T) {
-	tests := []struct {
-		name    string
-		setup   func(t *testing.T) string
-		wantErr bool
-	}{
-		{
-			name: "mount_nonexistent_image",
-			setup: func(t *testing.T) string {
-				return filepath.Join(t.TempDir(), "nonexistent.ext4")
-			},
-			wantErr: true,
-		},
-		{
-			name: "mount_regular_file",
-			setup: func(t *testing.T) string {
-				path := filepath.Join(t.TempDir(), "fake.ext4")
-				os.WriteFile(path, []byte("fake ext4 content"), 0644)
-				return path
-			},
-			wantErr: true,
-		},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			ip := NewImagePreparer(&PreparerConfig{RootfsDir: t.TempDir()}).(*ImagePreparer)
-			imagePath := tt.setup(t)
-
-			mountDir, err := ip.mountExt4(imagePath)
-
-			if tt.wantErr {
-				assert.Error(t, err)
-				assert.Empty(t, mountDir)
-			} else {
-				assert.NoError(t, err)
-				assert.NotEmpty(t, mountDir)
-			}
-		})
-	}
-}
-
 // TestValidateArchitecture_Low tests validateArchitecture method
 func TestValidateArchitecture_Low(t *testing.T) {
 	ip := NewImagePreparer(&PreparerConfig{RootfsDir: t.TempDir()}).(*ImagePreparer)
@@ -7,6 +7,7 @@ import (
 	"path/filepath"
 	"testing"
 
+	"github.com/restuhaqza/swarmcracker/pkg/events"
 	"github.com/restuhaqza/swarmcracker/pkg/types"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -471,7 +472,7 @@ func TestImagePreparer_CacheBehavior_Unit(t *testing.T) {
 	// Create a fake rootfs file
 	imageID := "nginx-latest"
 	rootfsPath := filepath.Join(rootfsDir, imageID+".ext4")
-	err := os.WriteFile(rootfsPath, []byte("fake rootfs"), 0644)
+	err := writeCachedRootfs(rootfsPath)
 	require.NoError(t, err)
 
 	task := &types.Task{
@@ -605,3 +606,32 @@ func TestImagePreparer_Prepare_InitSystemAnnotations_Unit(t *testing.T) {
 		})
 	}
 }
+
+type recordingPublisher struct {
+	events []events.Event
+}
+
+func (r *recordingPublisher) Publish(e events.Event) {
+	r.events = append(r.events, e)
+}
+
+// TestImagePreparer_Publish_Unit tests that events name the task being prepared
+func TestImagePreparer_Publish_Unit(t *testing.T) {
+	ip := &ImagePreparer{}
+	task := &types.Task{ID: "task-1", ServiceID: "svc-1", ServiceName: "web"}
+	ctx := context.WithValue(context.Background(), taskKey{}, task)
+
+	// No publisher set
+	ip.publish(ctx, events.ImagePullStart, "Pulling image", nil, nil)
+
+	rec := &recordingPublisher{}
+	ip.SetEventPublisher(rec)
+	ip.publish(ctx, events.ImagePullStart, "Pulling image", nil, map[string]string{"image": "nginx"})
+	ip.publish(context.Background(), events.RootfsBuild, "Built rootfs", nil, nil)
+
+	require.Len(t, rec.events, 2)
+	assert.Equal(t, "task-1", rec.events[0].TaskID)
+	assert.Equal(t, "web", rec.events[0].Service)
+	assert.Equal(t, "nginx", rec.events[0].Attributes["image"])
+	assert.Empty(t, rec.events[1].TaskID)
+}
@@ -3,12 +3,14 @@ package image
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"runtime"
 	"strings"
 
 	"github.com/google/go-containerregistry/pkg/name"
 	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/restuhaqza/swarmcracker/pkg/arch"
 	"github.com/rs/zerolog/log"
 )
 
@@ -63,8 +65,11 @@ func validateImageManifest(ctx context.Context, imageRef string, opts ...remote.
 		return fmt.Errorf("failed to parse image reference %q: %w", fullRef, err)
 	}
 
-	// Get the manifest
-	img, err := remote.Image(ref, opts...)
+	// Get the manifest, resolving multi-arch indexes to the host's image
+	img, err := arch.Default().Image(ref, opts...)
+	if errors.Is(err, arch.ErrNoImage) {
+		return fmt.Errorf("incompatible image architecture: %s has no image for host %q", fullRef, normalizeArch(runtime.GOARCH))
+	}
 	if err != nil {
 		// Graceful degradation: log warning and return nil
 		// This allows the system to work with images that may not support
@@ -2,7 +2,19 @@
 package image
 
 import (
+	"context"
+	"net/http/httptest"
+	"runtime"
+	"strings"
 	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
 )
 
 func TestNormalizeArch(t *testing.T) {
@@ -150,3 +162,73 @@ func TestArchAliasesCompleteness(t *testing.T) {
 		}
 	}
 }
+
+// pushPlatformIndex pushes an image index with an image per architecture,
+// each config naming its architecture, and returns its reference
+func pushPlatformIndex(t *testing.T, archs ...string) string {
+	t.Helper()
+	srv := httptest.NewServer(registry.New())
+	t.Cleanup(srv.Close)
+
+	idx := v1.ImageIndex(empty.Index)
+	for _, a := range archs {
+		img, err := random.Image(64, 1)
+		if err != nil {
+			t.Fatalf("random.Image() failed: %v", err)
+		}
+		cfg, err := img.ConfigFile()
+		if err != nil {
+			t.Fatalf("ConfigFile() failed: %v", err)
+		}
+		cfg.OS, cfg.Architecture = "linux", a
+		if img, err = mutate.ConfigFile(img, cfg); err != nil {
+			t.Fatalf("mutate.ConfigFile() failed: %v", err)
+		}
+		idx = mutate.AppendManifests(idx, mutate.IndexAddendum{
+			Add:        img,
+			Descriptor: v1.Descriptor{Platform: &v1.Platform{OS: "linux", Architecture: a}},
+		})
+	}
+
+	ref := strings.TrimPrefix(srv.URL, "http://") + "/library/app:latest"
+	parsed, err := name.ParseReference(ref)
+	if err != nil {
+		t.Fatalf("ParseReference() failed: %v", err)
+	}
+	if err := remote.WriteIndex(parsed, idx); err != nil {
+		t.Fatalf("WriteIndex() failed: %v", err)
+	}
+	return ref
+}
+
+func TestValidateImageManifest_MultiArchIndex(t *testing.T) {
+	if runtime.GOARCH != "amd64" && runtime.GOARCH != "arm64" {
+		t.Skip("Firecracker does not support this architecture")
+	}
+
+	tests := []struct {
+		name    string
+		archs   []string
+		wantErr string
+	}{
+		{"host image listed last", []string{"s390x", runtime.GOARCH}, ""},
+		{"amd64 and arm64", []string{"amd64", "arm64"}, ""},
+		{"no host image", []string{"s390x", "ppc64le"}, "incompatible image architecture"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ref := pushPlatformIndex(t, tt.archs...)
+			err := validateImageManifest(context.Background(), ref)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("validateImageManifest() = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("validateImageManifest() = %v, want error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
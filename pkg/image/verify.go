@@ -2,20 +2,19 @@ package image
 
 import (
 	"fmt"
-	"os/exec"
 
+	"github.com/restuhaqza/swarmcracker/pkg/ext4"
 	"github.com/rs/zerolog/log"
 )
 
 // VerifyBootable checks if a rootfs image has all required files for booting.
-// Uses debugfs to inspect the ext4 image without mounting.
+// Reads the ext4 image directly without mounting.
 func VerifyBootable(rootfsPath string) error {
-	// Check debugfs availability
-	if _, err := exec.LookPath("debugfs"); err != nil {
-		log.Debug().Msg("debugfs not available, skipping bootable verification")
-		//nolint:nilerr
-		return nil
+	img, err := ext4.Open(rootfsPath)
+	if err != nil {
+		return fmt.Errorf("rootfs verification failed: %w", err)
 	}
+	defer img.Close()
 
 	requiredPaths := []string{
 		"/init",
@@ -27,10 +26,9 @@ func VerifyBootable(rootfsPath string) error {
 
 	var missing []string
 	for _, path := range requiredPaths {
-		cmd := exec.Command("debugfs", "-R", "stat "+path, rootfsPath)
-		if output, err := cmd.CombinedOutput(); err != nil {
+		if _, err := img.Lstat(path); err != nil {
 			missing = append(missing, path)
-			log.Debug().Str("path", path).Err(err).Str("output", string(output)).Msg("Missing required file")
+			log.Debug().Str("path", path).Err(err).Msg("Missing required file")
 		}
 	}
 
@@ -1,42 +1,16 @@
 package image
 
 import (
-	"fmt"
 	"os"
-	"os/exec"
 	"path/filepath"
+	"strings"
 	"testing"
-)
-
-// TestVerifyBootable_DebugfsNotAvailable tests that verification gracefully skips when debugfs is missing.
-func TestVerifyBootable_DebugfsNotAvailable(t *testing.T) {
-	// Skip if debugfs is available (we can't easily mock this)
-	if _, err := exec.LookPath("debugfs"); err == nil {
-		t.Skip("debugfs is available, cannot test missing debugfs scenario")
-	}
 
-	// Create a dummy file to pass as rootfs
-	tmpFile, err := os.CreateTemp("", "test-rootfs-*.ext4")
-	if err != nil {
-		t.Fatalf("Failed to create temp file: %v", err)
-	}
-	defer os.Remove(tmpFile.Name())
-	tmpFile.Close()
-
-	// Should return nil when debugfs is not available
-	err = VerifyBootable(tmpFile.Name())
-	if err != nil {
-		t.Errorf("Expected nil when debugfs not available, got: %v", err)
-	}
-}
+	"github.com/restuhaqza/swarmcracker/pkg/ext4"
+)
 
 // TestVerifyBootable_InvalidExt4 tests verification with a non-ext4 file.
 func TestVerifyBootable_InvalidExt4(t *testing.T) {
-	// Skip if debugfs is not available
-	if _, err := exec.LookPath("debugfs"); err != nil {
-		t.Skip("debugfs not available")
-	}
-
 	// Create a non-ext4 file
 	tmpFile, err := os.CreateTemp("", "test-rootfs-*.ext4")
 	if err != nil {
@@ -51,23 +25,37 @@ func TestVerifyBootable_InvalidExt4(t *testing.T) {
 	}
 	tmpFile.Close()
 
-	// debugfs should fail on non-ext4 files - it may return error or nil depending on behavior
-	// We just verify the function doesn't panic
-	_ = VerifyBootable(tmpFile.Name())
+	if err := VerifyBootable(tmpFile.Name()); err == nil {
+		t.Error("Expected verification to fail for a non-ext4 file")
+	}
 }
 
-// TestVerifyBootable_CreatedRootfs tests verification with a real ext4 image.
-func TestVerifyBootable_CreatedRootfs(t *testing.T) {
-	// Skip if mkfs.ext4 is not available
-	if _, err := exec.LookPath("mkfs.ext4"); err != nil {
-		t.Skip("mkfs.ext4 not available")
+// TestVerifyBootable_MissingFiles tests that missing boot files are reported.
+func TestVerifyBootable_MissingFiles(t *testing.T) {
+	tmpDir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(tmpDir, "bin"), 0755); err != nil {
+		t.Fatalf("Failed to create bin dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(tmpDir, "bin", "sh"), []byte("#!/bin/sh"), 0755); err != nil {
+		t.Fatalf("Failed to create sh: %v", err)
+	}
+
+	outputPath := filepath.Join(t.TempDir(), "rootfs.ext4")
+	if err := ext4.CreateFromDir(outputPath, tmpDir, ext4.Options{Size: 16 << 20, Label: "rootfs"}); err != nil {
+		t.Fatalf("Failed to create ext4 image: %v", err)
 	}
 
-	// Skip if debugfs is not available
-	if _, err := exec.LookPath("debugfs"); err != nil {
-		t.Skip("debugfs not available")
+	err := VerifyBootable(outputPath)
+	if err == nil {
+		t.Fatal("Expected verification to fail")
+	}
+	if !strings.Contains(err.Error(), "/sbin/tini") || strings.Contains(err.Error(), "/bin/sh") {
+		t.Errorf("Unexpected missing list: %v", err)
 	}
+}
 
+// TestVerifyBootable_CreatedRootfs tests verification with a real ext4 image.
+func TestVerifyBootable_CreatedRootfs(t *testing.T) {
 	// Create a temp directory with required files
 	tmpDir, err := os.MkdirTemp("", "test-rootfs-content-")
 	if err != nil {
@@ -100,15 +88,11 @@ func TestVerifyBootable_CreatedRootfs(t *testing.T) {
 	}
 
 	// Create ext4 image
-	outputPath := filepath.Join(os.TempDir(), "test-verify-rootfs.ext4")
-	defer os.Remove(outputPath)
+	outputPath := filepath.Join(t.TempDir(), "test-verify-rootfs.ext4")
 
-	// Create ext4 image with mkfs.ext4 -d
-	// Block count for 100MB = 25600 blocks (4K each)
-	blockCount := 25600
-	cmd := exec.Command("mkfs.ext4", "-d", tmpDir, "-L", "rootfs", outputPath, fmt.Sprintf("%d", blockCount))
-	if output, err := cmd.CombinedOutput(); err != nil {
-		t.Fatalf("Failed to create ext4 image: %v\nOutput: %s", err, string(output))
+	ip := &ImagePreparer{config: &PreparerConfig{}}
+	if err := ip.createExt4Image(tmpDir, outputPath); err != nil {
+		t.Fatalf("Failed to create ext4 image: %v", err)
 	}
 
 	// Verify should pass
@@ -120,11 +104,6 @@ func TestVerifyBootable_CreatedRootfs(t *testing.T) {
 
 // TestCreateExt4ImageWithOverhead_MinSize tests that tiny dirs produce at least 100MB output.
 func TestCreateExt4ImageWithOverhead_MinSize(t *testing.T) {
-	// Skip if mkfs.ext4 is not available
-	if _, err := exec.LookPath("mkfs.ext4"); err != nil {
-		t.Skip("mkfs.ext4 not available")
-	}
-
 	// Create a tiny temp directory
 	tmpDir, err := os.MkdirTemp("", "test-tiny-rootfs-")
 	if err != nil {
@@ -171,11 +150,6 @@ func TestCreateExt4ImageWithOverhead_MinSize(t *testing.T) {
 
 // TestCreateExt4ImageWithOverhead_DiskSpaceCheck tests disk space checking.
 func TestCreateExt4ImageWithOverhead_DiskSpaceCheck(t *testing.T) {
-	// Skip if mkfs.ext4 is not available
-	if _, err := exec.LookPath("mkfs.ext4"); err != nil {
-		t.Skip("mkfs.ext4 not available")
-	}
-
 	// Create a temp directory
 	tmpDir, err := os.MkdirTemp("", "test-diskspace-rootfs-")
 	if err != nil {
@@ -205,11 +179,6 @@ func TestCreateExt4ImageWithOverhead_DiskSpaceCheck(t *testing.T) {
 
 // TestCreateExt4ImageWithOverhead_OverheadApplied tests that large dirs get overhead applied.
 func TestCreateExt4ImageWithOverhead_OverheadApplied(t *testing.T) {
-	// Skip if mkfs.ext4 is not available
-	if _, err := exec.LookPath("mkfs.ext4"); err != nil {
-		t.Skip("mkfs.ext4 not available")
-	}
-
 	// Create a temp directory with larger files
 	tmpDir, err := os.MkdirTemp("", "test-overhead-rootfs-")
 	if err != nil {
@@ -276,11 +245,6 @@ func TestCreateExt4ImageWithOverhead_OverheadApplied(t *testing.T) {
 func TestCreateExt4ImageWithOverhead_DefaultOverhead(t *testing.T) {
 	// Test that overheadPercent defaults to 50 when <= 0
 
-	// Skip if mkfs.ext4 is not available
-	if _, err := exec.LookPath("mkfs.ext4"); err != nil {
-		t.Skip("mkfs.ext4 not available")
-	}
-
 	tmpDir, err := os.MkdirTemp("", "test-default-overhead-")
 	if err != nil {
 		t.Fatalf("Failed to create temp dir: %v", err)
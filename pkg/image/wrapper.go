@@ -6,11 +6,18 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+
+	"github.com/restuhaqza/swarmcracker/pkg/healthcheck"
+	"github.com/restuhaqza/swarmcracker/pkg/mmds"
+	"github.com/restuhaqza/swarmcracker/pkg/network"
+	"github.com/restuhaqza/swarmcracker/pkg/tracing"
+	"github.com/restuhaqza/swarmcracker/pkg/vmexit"
+	"github.com/restuhaqza/swarmcracker/pkg/warmpool"
 )
 
 // createGenericInitWrapper creates an /sbin/init script that uses OCI config.
-// The wrapper handles filesystems, environment, user, workdir, and executes
-// the OCI-defined command via tini as PID 1 signal handler.
+// The wrapper handles filesystems, environment, user, workdir, and runs the
+// OCI-defined command via tini as a subreaper, then reports its exit status.
 func createGenericInitWrapper(tmpDir string, info *OCIImageInfo, gracePeriod int) error {
 	// Ensure /sbin directory exists
 	sbinDir := filepath.Join(tmpDir, "sbin")
@@ -64,6 +71,9 @@ func generateWrapperScript(info *OCIImageInfo, gracePeriod int) string {
 	lines = append(lines, "fi")
 	lines = append(lines, "")
 
+	lines = append(lines, warmWaitLines()...)
+	lines = append(lines, networkSetupLines()...)
+
 	// Environment variables
 	if info != nil && len(info.Env) > 0 {
 		lines = append(lines, "# Environment")
@@ -130,13 +140,155 @@ func generateWrapperScript(info *OCIImageInfo, gracePeriod int) string {
 		tiniCmd = fmt.Sprintf("/sbin/tini %s", stopSignal)
 	}
 
-	execLine := fmt.Sprintf("exec %s %s %s -- %s", userCmd, tiniCmd, tiniArgs, cmdStr)
+	lines = append(lines, readyReportLines()...)
+	lines = append(lines, healthCheckLines()...)
+
+	execLine := fmt.Sprintf("(exec %s %s %s -- %s)", userCmd, tiniCmd, tiniArgs, cmdStr)
 	lines = append(lines, "# Execute")
 	lines = append(lines, execLine)
+	lines = append(lines, exitReportLines()...)
 
 	return strings.Join(lines, "\n")
 }
 
+// exitReportLines returns the wrapper section that follows the workload: it
+// reports the workload's exit status on the console (see vmexit.Marker) and
+// powers the VM off. Should reboot fail, the wrapper exits and the kernel
+// panics, which reboots the VM too (panic=1).
+func exitReportLines() []string {
+	return []string{
+		"sc_status=$?",
+		"echo \"" + vmexit.Marker + "$sc_status\"",
+		"sync",
+		"reboot -f 2>/dev/null",
+		"exit $sc_status",
+	}
+}
+
+// warmWaitLines returns the wrapper section that, in a VM booted for a warm
+// pool golden snapshot (see warmpool.BootArg), stops before the workload
+// until a task claims the VM. The task's kernel arguments are then read
+// from the metadata service and replace /proc/cmdline for the rest of the
+// wrapper. Waiting needs curl in the image.
+func warmWaitLines() []string {
+	release := "http://" + mmds.Address + "/" + warmpool.ReleaseKey + "/cmdline"
+	return []string{
+		"# Kernel arguments; a warm pool VM gets its task's from the metadata service",
+		"SC_CMDLINE=/proc/cmdline",
+		"if grep -qw " + warmpool.BootArg + " /proc/cmdline 2>/dev/null && command -v curl >/dev/null 2>&1; then",
+		"    ip link set eth0 up 2>/dev/null",
+		"    ip route add " + mmds.Address + " dev eth0 2>/dev/null",
+		"    echo \"" + warmpool.ReadyMarker + "\"",
+		"    while :; do",
+		"        token=$(curl -sf -X PUT http://" + mmds.Address + "/latest/api/token -H \"X-metadata-token-ttl-seconds: 60\" 2>/dev/null)",
+		"        [ -n \"$token\" ] && curl -sf -H \"X-metadata-token: $token\" -o /tmp/.sc-cmdline " + release + " 2>/dev/null && break",
+		"        sleep 0.05 2>/dev/null || sleep 1",
+		"    done",
+		"    SC_CMDLINE=/tmp/.sc-cmdline",
+		"fi",
+		"",
+	}
+}
+
+// networkSetupLines returns the wrapper section that applies the per-interface
+// network configuration passed on the kernel command line (see
+// network.GuestNetworkConfig.BootArgs). It runs in a function so that
+// "set --" does not clobber the wrapper's positional parameters.
+func networkSetupLines() []string {
+	ifArg := network.GuestInterfaceArg
+	routeArg := network.GuestRouteArg
+	return []string{
+		"# Network configuration from " + ifArg + "= and " + routeArg + "= kernel arguments",
+		"sc_setup_network() {",
+		"    command -v ip >/dev/null 2>&1 || return 0",
+		"    ip link set lo up 2>/dev/null",
+		"    for arg in $(cat \"$SC_CMDLINE\" 2>/dev/null); do",
+		"        case \"$arg\" in",
+		"        " + ifArg + "=*)",
+		"            OLDIFS=$IFS; IFS=,; set -- ${arg#" + ifArg + "=}; IFS=$OLDIFS",
+		"            dev=$1; mac=$2; mtu=$3; shift 3",
+		"            ip link set dev \"$dev\" down 2>/dev/null",
+		"            [ -n \"$mac\" ] && ip link set dev \"$dev\" address \"$mac\" 2>/dev/null",
+		"            [ -n \"$mtu\" ] && ip link set dev \"$dev\" mtu \"$mtu\" 2>/dev/null",
+		"            ip addr flush dev \"$dev\" 2>/dev/null",
+		"            for addr in \"$@\"; do ip addr add \"$addr\" dev \"$dev\" 2>/dev/null; done",
+		"            ip link set dev \"$dev\" up 2>/dev/null",
+		"            ;;",
+		"        " + routeArg + "=*)",
+		"            OLDIFS=$IFS; IFS=,; set -- ${arg#" + routeArg + "=}; IFS=$OLDIFS",
+		"            if [ -n \"$2\" ]; then ip route replace \"$1\" via \"$2\" dev \"$3\" 2>/dev/null",
+		"            else ip route replace \"$1\" dev \"$3\" 2>/dev/null; fi",
+		"            ;;",
+		"        esac",
+		"    done",
+		"}",
+		"sc_setup_network",
+		"",
+	}
+}
+
+// readyReportLines returns the wrapper section that reports userspace ready
+// on the console, so the host knows the guest is up. When the VM was booted
+// with a trace (see tracing.BootArg) the report carries it, so the host can
+// end the guest's span.
+func readyReportLines() []string {
+	arg := tracing.BootArg
+	return []string{
+		"# Report userspace ready, with the trace from the " + arg + "= kernel argument",
+		"sc_ready=\"" + tracing.ReadyMarker + "\"",
+		"for arg in $(cat \"$SC_CMDLINE\" 2>/dev/null); do",
+		"    case \"$arg\" in",
+		"    " + arg + "=*) sc_ready=\"$sc_ready traceparent=${arg#" + arg + "=}\" ;;",
+		"    esac",
+		"done",
+		"echo \"$sc_ready\"",
+		"",
+	}
+}
+
+// healthCheckLines returns the wrapper section that runs the service's
+// healthcheck, passed as a kernel argument (see healthcheck.KernelArg), in
+// the background for as long as the VM is up. Each change of health is
+// reported on the console (see healthcheck.Marker); failures within the
+// start period do not count. Images without base64 or timeout use the
+// applets of the busybox injected into scratch images; a command that
+// cannot be decoded is reported unhealthy rather than never checked.
+func healthCheckLines() []string {
+	arg := healthcheck.BootArg
+	marker := healthcheck.Marker
+	return []string{
+		"# Healthcheck from the " + arg + "= kernel argument",
+		"sc_healthcheck() {",
+		"    OLDIFS=$IFS; IFS=,; set -- $1; IFS=$OLDIFS",
+		"    interval=$1; timeout=$2; start=$3; retries=$4",
+		"    b64=base64; command -v base64 >/dev/null 2>&1 || b64=\"/bin/busybox base64\"",
+		"    if ! cmd=$(echo \"$5\" | $b64 -d 2>/dev/null) || [ -z \"$cmd\" ]; then",
+		"        echo \"" + marker + healthcheck.Unhealthy + "\"; return",
+		"    fi",
+		"    to=",
+		"    if command -v timeout >/dev/null 2>&1; then to=\"timeout $timeout\"",
+		"    elif [ -x /bin/busybox ]; then to=\"/bin/busybox timeout $timeout\"; fi",
+		"    begin=$(date +%s); health=; fails=0",
+		"    while :; do",
+		"        if $to sh -c \"$cmd\" >/dev/null 2>&1; then",
+		"            fails=0",
+		"            [ \"$health\" != " + healthcheck.Healthy + " ] && health=" + healthcheck.Healthy + " && echo \"" + marker + "$health\"",
+		"        elif [ $(( $(date +%s) - begin )) -ge \"$start\" ]; then",
+		"            fails=$((fails + 1))",
+		"            [ $fails -ge \"$retries\" ] && [ \"$health\" != " + healthcheck.Unhealthy + " ] && health=" + healthcheck.Unhealthy + " && echo \"" + marker + "$health\"",
+		"        fi",
+		"        sleep \"$interval\"",
+		"    done",
+		"}",
+		"for arg in $(cat \"$SC_CMDLINE\" 2>/dev/null); do",
+		"    case \"$arg\" in",
+		"    " + arg + "=*) sc_healthcheck \"${arg#" + arg + "=}\" & ;;",
+		"    esac",
+		"done",
+		"",
+	}
+}
+
 // shellEscape escapes a string for safe shell use (adds quotes if needed).
 func shellEscape(s string) string {
 	// If already quoted, return as-is
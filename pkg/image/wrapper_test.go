@@ -2,6 +2,7 @@ package image
 
 import (
 	"os"
+	"os/exec"
 	"path/filepath"
 	"strings"
 	"testing"
@@ -311,6 +312,77 @@ func TestCreateGenericInitWrapper_NilInfo(t *testing.T) {
 	}
 }
 
+func TestCreateGenericInitWrapper_ReadyReport(t *testing.T) {
+	script := generateWrapperScript(nil, 10)
+
+	if !strings.Contains(script, `swarmcracker.traceparent=*) sc_ready="$sc_ready traceparent=${arg#swarmcracker.traceparent=}" ;;`) {
+		t.Errorf("wrapper does not add the trace to the ready report:\n%s", script)
+	}
+	report := strings.Index(script, `echo "$sc_ready"`)
+	if report < 0 || !strings.Contains(script, `sc_ready="swarmcracker: userspace ready"`) {
+		t.Fatalf("wrapper does not report userspace ready:\n%s", script)
+	}
+	if exec := strings.Index(script, "exec "); exec < report {
+		t.Error("ready report should come right before exec")
+	}
+}
+
+func TestCreateGenericInitWrapper_HealthCheck(t *testing.T) {
+	script := generateWrapperScript(nil, 10)
+
+	start := strings.Index(script, `swarmcracker.health=*) sc_healthcheck "${arg#swarmcracker.health=}" & ;;`)
+	if start < 0 {
+		t.Fatalf("wrapper does not start the healthcheck:\n%s", script)
+	}
+	if exec := strings.Index(script, "(exec "); exec < start {
+		t.Error("healthcheck should start before the workload")
+	}
+	for _, report := range []string{"health=healthy", "health=unhealthy", `echo "swarmcracker: health status=$health"`} {
+		if !strings.Contains(script, report) {
+			t.Errorf("wrapper should report %q", report)
+		}
+	}
+}
+
+func TestHealthCheckLines_UndecodableCommand(t *testing.T) {
+	// Run the healthcheck function on its own, without the argument loop
+	var fn []string
+	for _, line := range healthCheckLines() {
+		if strings.HasPrefix(line, "for arg in") {
+			break
+		}
+		fn = append(fn, line)
+	}
+	script := strings.Join(fn, "\n") + "\nsc_healthcheck '1,1,0,1,!!!'\n"
+
+	out, err := exec.Command("sh", "-c", script).Output()
+	if err != nil {
+		t.Fatalf("healthcheck failed to run: %v", err)
+	}
+	if got := strings.TrimSpace(string(out)); got != "swarmcracker: health status=unhealthy" {
+		t.Errorf("an undecodable healthcheck should be reported unhealthy, got %q", got)
+	}
+}
+
+func TestCreateGenericInitWrapper_WarmWait(t *testing.T) {
+	script := generateWrapperScript(nil, 10)
+
+	wait := strings.Index(script, `echo "swarmcracker: warm ready"`)
+	if wait < 0 {
+		t.Fatalf("wrapper does not wait for warm pool release:\n%s", script)
+	}
+	if !strings.Contains(script, "http://169.254.169.254/warmpool/cmdline") {
+		t.Error("wrapper should read the release from the metadata service")
+	}
+	// The task's kernel arguments are applied after the release
+	if network := strings.Index(script, "sc_setup_network()"); network < wait {
+		t.Error("network setup should follow the warm pool wait")
+	}
+	if !strings.Contains(script, `for arg in $(cat "$SC_CMDLINE" 2>/dev/null); do`) {
+		t.Error("network setup should read the released kernel arguments")
+	}
+}
+
 // --- ShellEscape tests ---
 
 func TestShellEscape(t *testing.T) {
@@ -462,3 +534,19 @@ func itoa(n int) string {
 	}
 	return ""
 }
+
+func TestCreateGenericInitWrapper_ExitReport(t *testing.T) {
+	script := generateWrapperScript(&OCIImageInfo{Cmd: []string{"/bin/job"}}, 10)
+
+	run := strings.Index(script, "(exec ")
+	report := strings.Index(script, `echo "swarmcracker: exit status=$sc_status"`)
+	if run < 0 || report < 0 {
+		t.Fatalf("wrapper does not report the workload's exit:\n%s", script)
+	}
+	if report < run {
+		t.Error("exit report should follow the workload")
+	}
+	if !strings.Contains(script[run:], "sc_status=$?") || !strings.HasSuffix(script, "exit $sc_status") {
+		t.Errorf("wrapper should keep the workload's status and exit with it:\n%s", script[run:])
+	}
+}
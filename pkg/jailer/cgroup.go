@@ -46,6 +46,14 @@ type ResourceLimits struct {
 
 	// IO write bandwidth limit in bytes per second
 	IOWriteBPS int64 `yaml:"io_write_bps"`
+
+	// CPUs the VM may run on, in the kernel list format (cpuset.cpus)
+	// Example: "4-7" pins the VM to cores 4 to 7
+	CPUs string `yaml:"cpus"`
+
+	// NUMA nodes the VM's memory is allocated from (cpuset.mems)
+	// Example: "0" keeps memory on node 0
+	Mems string `yaml:"mems"`
 }
 
 // NewCgroupManager creates a new cgroup manager.
@@ -88,6 +96,11 @@ func (m *CgroupManager) CreateCgroup(taskID string, limits ResourceLimits) error
 		return fmt.Errorf("failed to set CPU limits: %w", err)
 	}
 
+	// Set CPU and memory node placement
+	if err := m.setCPUSet(cgroupPath, limits.CPUs, limits.Mems); err != nil {
+		return fmt.Errorf("failed to set cpuset: %w", err)
+	}
+
 	// Set memory limits
 	if err := m.setMemoryLimits(cgroupPath, limits); err != nil {
 		return fmt.Errorf("failed to set memory limits: %w", err)
@@ -218,6 +231,16 @@ func (m *CgroupManager) GetStats(taskID string) (*CgroupStats, error) {
 		}
 	}
 
+	// Read OOM kills from memory events
+	if data, err := os.ReadFile(filepath.Join(cgroupPath, "memory.events")); err == nil {
+		for _, line := range strings.Split(string(data), "\n") {
+			fields := strings.Fields(line)
+			if len(fields) == 2 && fields[0] == "oom_kill" {
+				stats.OOMKills, _ = strconv.ParseInt(fields[1], 10, 64)
+			}
+		}
+	}
+
 	return stats, nil
 }
 
@@ -232,6 +255,7 @@ type CgroupStats struct {
 	MemoryMax     int64 `json:"memory_max"`
 	IOReadBytes   int64 `json:"io_read_bytes"`
 	IOWriteBytes  int64 `json:"io_write_bytes"`
+	OOMKills      int64 `json:"oom_kills"`
 }
 
 // setCPULimits configures CPU resource limits.
@@ -256,6 +280,39 @@ func (m *CgroupManager) setCPULimits(cgroupPath string, limits ResourceLimits) e
 	return nil
 }
 
+// SetCPUs moves a task's VM to other CPUs, e.g. when cores are handed out
+// to or returned by pinned VMs.
+func (m *CgroupManager) SetCPUs(taskID, cpus string) error {
+	return m.setCPUSet(filepath.Join(m.basePath, taskID), cpus, "")
+}
+
+// setCPUSet configures the CPUs and memory nodes of a cgroup. The cpuset
+// controller is enabled for the base cgroup's children first.
+func (m *CgroupManager) setCPUSet(cgroupPath, cpus, mems string) error {
+	if cpus == "" && mems == "" {
+		return nil
+	}
+
+	subtreeControl := filepath.Join(m.basePath, "cgroup.subtree_control")
+	if err := os.WriteFile(subtreeControl, []byte("+cpuset"), 0644); err != nil {
+		m.logger.Debug().Err(err).Msg("Failed to enable cpuset controller")
+	}
+
+	if cpus != "" {
+		m.logger.Debug().Str("cpus", cpus).Msg("Setting cpuset CPUs")
+		if err := os.WriteFile(filepath.Join(cgroupPath, "cpuset.cpus"), []byte(cpus), 0644); err != nil {
+			return fmt.Errorf("failed to write cpuset.cpus: %w", err)
+		}
+	}
+	if mems != "" {
+		m.logger.Debug().Str("mems", mems).Msg("Setting cpuset memory nodes")
+		if err := os.WriteFile(filepath.Join(cgroupPath, "cpuset.mems"), []byte(mems), 0644); err != nil {
+			return fmt.Errorf("failed to write cpuset.mems: %w", err)
+		}
+	}
+	return nil
+}
+
 // setMemoryLimits configures memory resource limits.
 func (m *CgroupManager) setMemoryLimits(cgroupPath string, limits ResourceLimits) error {
 	// Set memory max (hard limit)
@@ -374,6 +374,57 @@ func TestCgroupCPULimits(t *testing.T) {
 	}
 }
 
+// TestCgroupCPUSet tests CPU and NUMA node placement.
+func TestCgroupCPUSet(t *testing.T) {
+	if !isCgroupV2Available() {
+		t.Skip("Cgroup v2 not available on this system")
+	}
+
+	tmpDir := t.TempDir()
+	testPath := filepath.Join(tmpDir, "cgroup-test")
+
+	mgr, err := NewCgroupManager(testPath)
+	if err != nil {
+		t.Fatalf("NewCgroupManager() error = %v", err)
+	}
+
+	taskID := "test-cpuset"
+	limits := ResourceLimits{
+		CPUs: "4-5",
+		Mems: "1",
+	}
+	if err := mgr.CreateCgroup(taskID, limits); err != nil {
+		t.Fatalf("CreateCgroup() error = %v", err)
+	}
+	defer mgr.RemoveCgroup(taskID)
+
+	readFile := func(name string) string {
+		data, err := os.ReadFile(filepath.Join(testPath, taskID, name))
+		if err != nil {
+			t.Fatalf("Failed to read %s: %v", name, err)
+		}
+		return strings.TrimSpace(string(data))
+	}
+
+	if got := readFile("cpuset.cpus"); got != "4-5" {
+		t.Errorf("cpuset.cpus = %q, want %q", got, "4-5")
+	}
+	if got := readFile("cpuset.mems"); got != "1" {
+		t.Errorf("cpuset.mems = %q, want %q", got, "1")
+	}
+
+	// Moving the VM keeps its memory node
+	if err := mgr.SetCPUs(taskID, "0-3"); err != nil {
+		t.Fatalf("SetCPUs() error = %v", err)
+	}
+	if got := readFile("cpuset.cpus"); got != "0-3" {
+		t.Errorf("cpuset.cpus = %q, want %q", got, "0-3")
+	}
+	if got := readFile("cpuset.mems"); got != "1" {
+		t.Errorf("cpuset.mems = %q, want %q", got, "1")
+	}
+}
+
 // TestCgroupMemoryLimits tests memory limit configuration.
 func TestCgroupMemoryLimits(t *testing.T) {
 	if !isCgroupV2Available() {
@@ -40,6 +40,7 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/restuhaqza/swarmcracker/pkg/security"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 )
@@ -79,7 +80,8 @@ type Config struct {
 	// Enable seccomp filtering
 	EnableSeccomp bool `yaml:"enable_seccomp"`
 
-	// Seccomp policy file path (optional, uses default if empty)
+	// Compiled seccomp filter (BPF) passed to Firecracker with
+	// --seccomp-filter (optional, Firecracker's built-in filters if empty)
 	SeccompPolicyPath string `yaml:"seccomp_policy_path"`
 
 	// Parent cgroup for jailer VMs
@@ -110,6 +112,9 @@ type VMConfig struct {
 	// Path to kernel image
 	KernelPath string
 
+	// Path to initrd image (optional)
+	InitrdPath string
+
 	// Path to rootfs image
 	RootfsPath string
 
@@ -124,6 +129,10 @@ type VMConfig struct {
 
 	// Guest MAC address (optional)
 	GuestMac string
+
+	// Console receives the guest serial console (Firecracker's stdout)
+	// besides the log (optional)
+	Console io.Writer
 }
 
 // Process represents a running jailed Firecracker process.
@@ -131,6 +140,7 @@ type Process struct {
 	TaskID     string
 	Cmd        *exec.Cmd
 	SocketPath string
+	ChrootDir  string // host path of the chroot Firecracker runs in
 	Pid        int
 	StartTime  time.Time
 }
@@ -252,6 +262,7 @@ func (j *Jailer) Start(_ context.Context, cfg VMConfig) (*Process, error) {
 		TaskID:     cfg.TaskID,
 		Cmd:        cmd,
 		SocketPath: socketPath,
+		ChrootDir:  chrootDir,
 		Pid:        cmd.Process.Pid,
 		StartTime:  time.Now(),
 	}
@@ -315,11 +326,6 @@ func (j *Jailer) buildJailerCommand(cfg VMConfig) (*exec.Cmd, string, error) {
 		j.logger.Debug().Int64("memory_max", j.config.MemoryMax).Msg("Setting memory cgroup limit")
 	}
 
-	// Optional seccomp
-	// Note: Jailer v1.15.0 doesn't support --seccomp flag
-	// Seccomp filtering is handled internally by Firecracker when run via jailer
-	// The EnableSeccomp config option is reserved for future use
-
 	// Add extra arguments
 	if len(j.config.ExtraArgs) > 0 {
 		args = append(args, j.config.ExtraArgs...)
@@ -333,6 +339,12 @@ func (j *Jailer) buildJailerCommand(cfg VMConfig) (*exec.Cmd, string, error) {
 		"--api-sock", filepath.Join("/", socketRelPath),
 	}
 
+	// Optional custom seccomp filter, copied into the chroot; the jailer has
+	// no seccomp flag of its own, Firecracker installs the filter
+	if j.seccompFilterEnabled() {
+		firecrackerArgs = append(firecrackerArgs, "--seccomp-filter", filepath.Join("/", seccompFilterName))
+	}
+
 	args = append(args, firecrackerArgs...)
 
 	j.logger.Debug().
@@ -343,6 +355,9 @@ func (j *Jailer) buildJailerCommand(cfg VMConfig) (*exec.Cmd, string, error) {
 	cmd := exec.Command(j.config.JailerPath, args...)
 	cmd.Stdout = &logWriter{logger: j.logger.Level(zerolog.DebugLevel)}
 	cmd.Stderr = &logWriter{logger: j.logger.Level(zerolog.DebugLevel)}
+	if cfg.Console != nil {
+		cmd.Stdout = io.MultiWriter(cmd.Stdout, cfg.Console)
+	}
 
 	return cmd, socketPath, nil
 }
@@ -375,6 +390,13 @@ func (j *Jailer) validateVMConfig(cfg VMConfig) error {
 		return fmt.Errorf("rootfs not found: %w", err)
 	}
 
+	// Verify initrd exists
+	if cfg.InitrdPath != "" {
+		if _, err := os.Stat(cfg.InitrdPath); err != nil {
+			return fmt.Errorf("initrd not found: %w", err)
+		}
+	}
+
 	return nil
 }
 
@@ -530,75 +552,24 @@ func (j *Jailer) Close() error {
 	return nil
 }
 
-// createDefaultSeccompPolicy creates a default seccomp policy file.
-func (j *Jailer) createDefaultSeccompPolicy(taskID string) (string, error) {
-	// Default policy for Firecracker
-	policy := `{
-		"defaultAction": "kill",
-		"syscalls": [
-			{
-				"action": "allow",
-				"names": [
-					"accept", "accept4", "access", "arch_prctl", "bind", "brk",
-					"capget", "capset", "chdir", "chmod", "chown", "chown32",
-					"clock_getres", "clock_gettime", "clock_nanosleep", "clone",
-					"close", "connect", "dup", "dup2", "dup3", "epoll_create",
-					"epoll_create1", "epoll_ctl", "epoll_pwait", "epoll_wait",
-					"eventfd", "eventfd2", "execve", "exit", "exit_group",
-					"fcntl", "fcntl64", "fdatasync", "fgetxattr", "flistxattr",
-					"flock", "fork", "fsetxattr", "fstat", "fstat64", "fstatat64",
-					"fstatfs", "fstatfs64", "fsync", "ftruncate", "ftruncate64",
-					"futex", "getcwd", "getdents", "getdents64", "getegid",
-					"getegid32", "geteuid", "geteuid32", "getgid", "getgid32",
-					"getgroups", "getgroups32", "getpeername", "getpgrp", "getpid",
-					"getppid", "getpriority", "getrandom", "getresgid", "getresgid32",
-					"getresuid", "getresuid32", "getrlimit", "getrusage", "getsid",
-					"getsockname", "getsockopt", "gettid", "gettimeofday", "getuid",
-					"getuid32", "getxattr", "inotify_add_watch", "inotify_init",
-					"inotify_init1", "inotify_rm_watch", "ioctl", "ioprio_get",
-					"ioprio_set", "kill", "lgetxattr", "link", "linkat", "listen",
-					"llistxattr", "lseek", "lsetxattr", "lstat", "lstat64", "madvise",
-					"memfd_create", "mincore", "mkdir", "mkdirat", "mknod", "mknodat",
-					"mlock", "mlock2", "mlockall", "mmap", "mmap2", "mprotect",
-					"mremap", "msync", "munlock", "munlockall", "munmap", "nanosleep",
-					"newfstatat", "_newselect", "open", "openat", "pause", "pipe",
-					"pipe2", "poll", "ppoll", "prctl", "pread64", "preadv", "prlimit64",
-					"pselect6", "pwrite64", "pwritev", "read", "readahead", "readlink",
-					"readlinkat", "readv", "recv", "recvfrom", "recvmmsg", "recvmsg",
-					"rename", "renameat", "renameat2", "restart_syscall", "rmdir",
-					"rt_sigaction", "rt_sigpending", "rt_sigprocmask", "rt_sigqueueinfo",
-					"rt_sigreturn", "rt_sigsuspend", "rt_sigtimedwait", "rt_tgsigqueueinfo",
-					"sched_getaffinity", "sched_getattr", "sched_getparam", "sched_get_priority_max",
-					"sched_get_priority_min", "sched_getscheduler", "sched_rr_get_interval",
-					"sched_setaffinity", "sched_setattr", "sched_setparam", "sched_setscheduler",
-					"sched_yield", "seccomp", "select", "semctl", "semget", "semop", "semtimedop",
-					"send", "sendfile", "sendfile64", "sendmmsg", "sendmsg", "sendto",
-					"setfsgid", "setfsgid32", "setfsuid", "setfsuid32", "setgid", "setgid32",
-					"setgroups", "setgroups32", "setitimer", "setpgid", "setpriority",
-					"setregid", "setregid32", "setresgid", "setresgid32", "setresuid",
-					"setresuid32", "setreuid", "setreuid32", "setrlimit", "setsid",
-					"setsockopt", "setuid", "setuid32", "setxattr", "shmat", "shmctl",
-					"shmdt", "shmget", "shutdown", "sigaltstack", "signalfd", "signalfd4",
-					"socket", "socketcall", "socketpair", "splice", "stat", "stat64",
-					"statfs", "statfs64", "statx", "symlink", "symlinkat", "sync",
-					"sync_file_range", "syncfs", "sysinfo", "tee", "tgkill", "time",
-					"timer_create", "timer_delete", "timerfd_create", "timerfd_gettime",
-					"timerfd_settime", "timer_getoverrun", "timer_gettime", "timer_settime",
-					"times", "tkill", "truncate", "truncate64", "ugetrlimit", "umask",
-					"uname", "unlink", "unlinkat", "utime", "utimensat", "utimes",
-					"vfork", "vmsplice", "wait4", "waitid", "waitpid", "write", "writev"
-				]
-			}
-		]
-	}`
+// seccompFilterName is the compiled seccomp filter inside the chroot.
+const seccompFilterName = "seccomp.bpf"
+
+// seccompFilterEnabled reports whether Firecracker gets a custom seccomp filter.
+func (j *Jailer) seccompFilterEnabled() bool {
+	return j.config.EnableSeccomp && j.config.SeccompPolicyPath != ""
+}
 
+// createDefaultSeccompPolicy writes the default Firecracker seccompiler
+// profile for the host architecture, ready for seccompiler-bin.
+func (j *Jailer) createDefaultSeccompPolicy(taskID string) (string, error) {
 	// Ensure chroot base directory exists
 	if err := os.MkdirAll(j.config.ChrootBaseDir, 0755); err != nil {
 		return "", fmt.Errorf("failed to create chroot base dir: %w", err)
 	}
 
 	policyPath := filepath.Join(j.config.ChrootBaseDir, taskID+".seccomp.json")
-	if err := os.WriteFile(policyPath, []byte(policy), 0644); err != nil {
+	if err := security.WriteSeccompProfile(taskID, policyPath); err != nil {
 		return "", fmt.Errorf("failed to write seccomp policy: %w", err)
 	}
 
@@ -635,6 +606,15 @@ func (j *Jailer) prepareChrootResources(chrootDir string, cfg VMConfig) error {
 	}
 	j.logger.Debug().Str("dest", kernelDest).Msg("Kernel copied")
 
+	// Copy initrd into chroot
+	if cfg.InitrdPath != "" {
+		initrdDest := filepath.Join(kernelDir, "initrd")
+		if err := copyFile(cfg.InitrdPath, initrdDest); err != nil {
+			return fmt.Errorf("failed to copy initrd: %w", err)
+		}
+		j.logger.Debug().Str("dest", initrdDest).Msg("Initrd copied")
+	}
+
 	// Copy rootfs into chroot
 	rootfsDest := filepath.Join(drivesDir, "rootfs.ext4")
 	if err := copyFile(cfg.RootfsPath, rootfsDest); err != nil {
@@ -642,6 +622,15 @@ func (j *Jailer) prepareChrootResources(chrootDir string, cfg VMConfig) error {
 	}
 	j.logger.Debug().Str("dest", rootfsDest).Msg("Rootfs copied")
 
+	// Copy the seccomp filter into chroot
+	if j.seccompFilterEnabled() {
+		filterDest := filepath.Join(chrootDir, seccompFilterName)
+		if err := copyFile(j.config.SeccompPolicyPath, filterDest); err != nil {
+			return fmt.Errorf("failed to copy seccomp filter: %w", err)
+		}
+		j.logger.Debug().Str("dest", filterDest).Msg("Seccomp filter copied")
+	}
+
 	return nil
 }
 
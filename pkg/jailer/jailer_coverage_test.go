@@ -418,6 +418,12 @@ shmem 0
 		t.Fatalf("Failed to create memory.max: %v", err)
 	}
 
+	// Create mock memory.events
+	memEvents := "low 0\nhigh 12\nmax 3\noom 1\noom_kill 1\n"
+	if err := os.WriteFile(filepath.Join(cgroupPath, "memory.events"), []byte(memEvents), 0644); err != nil {
+		t.Fatalf("Failed to create memory.events: %v", err)
+	}
+
 	cm := &CgroupManager{
 		basePath: tmpDir,
 	}
@@ -455,6 +461,9 @@ shmem 0
 	if stats.MemoryMax != 268435456 {
 		t.Errorf("Expected memory max 268435456, got %d", stats.MemoryMax)
 	}
+	if stats.OOMKills != 1 {
+		t.Errorf("Expected 1 OOM kill, got %d", stats.OOMKills)
+	}
 }
 
 // TestGetStats_UnlimitedMemory tests GetStats with unlimited memory (max)
@@ -834,6 +843,54 @@ func TestStart_ChrootResourceCreation(t *testing.T) {
 	}
 }
 
+// TestStart_ChrootInitrd tests that an initrd is copied next to the kernel
+func TestStart_ChrootInitrd(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	kernelPath := filepath.Join(tmpDir, "vmlinux")
+	initrdPath := filepath.Join(tmpDir, "initrd.img")
+	rootfsPath := filepath.Join(tmpDir, "rootfs.img")
+	os.WriteFile(kernelPath, []byte("kernel"), 0644)
+	os.WriteFile(initrdPath, []byte("initrd"), 0644)
+	os.WriteFile(rootfsPath, []byte("rootfs"), 0644)
+
+	j := &Jailer{
+		config: &Config{
+			ChrootBaseDir: tmpDir,
+		},
+	}
+
+	cfg := VMConfig{
+		TaskID:     "test-initrd",
+		VcpuCount:  1,
+		MemoryMB:   512,
+		KernelPath: kernelPath,
+		InitrdPath: initrdPath,
+		RootfsPath: rootfsPath,
+	}
+	if err := j.validateVMConfig(cfg); err != nil {
+		t.Fatalf("validateVMConfig() error = %v", err)
+	}
+
+	chrootDir := filepath.Join(tmpDir, "firecracker", cfg.TaskID, "root")
+	if err := j.prepareChrootResources(chrootDir, cfg); err != nil {
+		t.Fatalf("prepareChrootResources() error = %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(chrootDir, "kernel", "initrd"))
+	if err != nil {
+		t.Fatalf("Initrd not copied: %v", err)
+	}
+	if string(data) != "initrd" {
+		t.Errorf("Initrd content = %q, want %q", data, "initrd")
+	}
+
+	cfg.InitrdPath = filepath.Join(tmpDir, "missing.img")
+	if err := j.validateVMConfig(cfg); err == nil {
+		t.Error("Expected error for missing initrd")
+	}
+}
+
 // TestForceStop_AlreadyDead tests ForceStop on already dead process
 func TestForceStop_AlreadyDead(t *testing.T) {
 	// Create a process that exits immediately
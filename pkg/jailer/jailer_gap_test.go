@@ -234,11 +234,10 @@ func TestCreateDefaultSeccompPolicy(t *testing.T) {
 					t.Errorf("Failed to read policy file: %v", err)
 				} else {
 					content := string(data)
-					if !strings.Contains(content, "defaultAction") {
-						t.Error("Policy missing defaultAction")
-					}
-					if !strings.Contains(content, "syscalls") {
-						t.Error("Policy missing syscalls")
+					for _, key := range []string{`"vmm"`, `"api"`, `"vcpu"`, "default_action", "filter_action"} {
+						if !strings.Contains(content, key) {
+							t.Errorf("Policy missing %s", key)
+						}
 					}
 				}
 			}
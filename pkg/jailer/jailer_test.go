@@ -354,17 +354,20 @@ func TestJailerBuildJailerCommandWithSeccomp(t *testing.T) {
 	rootfsPath := filepath.Join(tmpDir, "rootfs.img")
 	os.WriteFile(kernelPath, []byte("kernel"), 0644)
 	os.WriteFile(rootfsPath, []byte("rootfs"), 0644)
+	filterPath := filepath.Join(tmpDir, "seccomp.bpf")
+	os.WriteFile(filterPath, []byte("bpf"), 0644)
 
 	chrootDir := filepath.Join(tmpDir, "chroot")
 	j := &Jailer{
 		config: &Config{
-			FirecrackerPath: firecrackerPath,
-			JailerPath:      jailerPath,
-			ChrootBaseDir:   chrootDir,
-			UID:             1000,
-			GID:             1000,
-			CgroupVersion:   "v2",
-			EnableSeccomp:   true,
+			FirecrackerPath:   firecrackerPath,
+			JailerPath:        jailerPath,
+			ChrootBaseDir:     chrootDir,
+			UID:               1000,
+			GID:               1000,
+			CgroupVersion:     "v2",
+			EnableSeccomp:     true,
+			SeccompPolicyPath: filterPath,
 		},
 	}
 
@@ -387,9 +390,20 @@ func TestJailerBuildJailerCommandWithSeccomp(t *testing.T) {
 	}
 	cmdArgs := cmd.Args //nolint:staticcheck // t.Fatal terminates test
 
-	// Note: Jailer v1.15.0 does not support --seccomp flag
-	// Seccomp filtering is built-in to Firecracker when run via jailer
-	// The test verifies the command was built correctly without --seccomp
+	// The compiled filter goes to Firecracker, after the "--" separator
+	wantArgs := []string{"--", "--api-sock", "/run/firecracker/test-vm-seccomp.sock", "--seccomp-filter", "/seccomp.bpf"}
+	if got := cmdArgs[len(cmdArgs)-len(wantArgs):]; strings.Join(got, " ") != strings.Join(wantArgs, " ") {
+		t.Errorf("Firecracker args = %v, want %v", got, wantArgs)
+	}
+
+	// and is copied into the chroot
+	vmChroot := filepath.Join(chrootDir, "firecracker", cfg.TaskID, "root")
+	if err := j.prepareChrootResources(vmChroot, cfg); err != nil {
+		t.Fatalf("prepareChrootResources() error = %v", err)
+	}
+	if data, err := os.ReadFile(filepath.Join(vmChroot, "seccomp.bpf")); err != nil || string(data) != "bpf" {
+		t.Errorf("Seccomp filter not copied into chroot: %v", err)
+	}
 
 	// Verify socket path is in chroot directory
 	expectedSocketPattern := filepath.Join(chrootDir, "test-vm-seccomp", "run", "firecracker")
@@ -397,15 +411,14 @@ func TestJailerBuildJailerCommandWithSeccomp(t *testing.T) {
 		t.Errorf("Socket path %q should contain %q", socketPath, expectedSocketPattern)
 	}
 
-	// Verify --seccomp is NOT in the command (not supported in v1.15.0)
+	// The jailer itself has no --seccomp flag
 	for _, arg := range cmdArgs {
 		if arg == "--seccomp" {
-			t.Error("--seccomp flag should not be present (not supported in jailer v1.15.0)")
+			t.Error("--seccomp flag should not be present (not supported by the jailer)")
 		}
 	}
 
 	t.Logf("Command args: %v", cmdArgs)
-	t.Log("Jailer command built correctly without unsupported --seccomp flag")
 }
 
 // TestJailerListProcesses tests process listing.
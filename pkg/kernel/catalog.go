@@ -0,0 +1,258 @@
+// Package kernel keeps the catalog of guest kernels installed on a node:
+// which kernels services can ask for, where they are, and the checksums
+// they are verified against before each boot.
+package kernel
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+
+	"github.com/restuhaqza/swarmcracker/pkg/arch"
+	"gopkg.in/yaml.v3"
+)
+
+// Label is the service label that picks a catalog kernel for a service's
+// VMs, e.g. "5.10-lts". Services without it boot the node's default kernel.
+const Label = "swarmcracker.kernel"
+
+// NodeLabelPrefix prefixes the engine labels a node advertises its
+// installed kernels with, e.g. swarmcracker.kernel.5.10-lts=true.
+const NodeLabelPrefix = Label + "."
+
+// DefaultCatalogPath is where nodes keep their catalog.
+const DefaultCatalogPath = "/var/lib/firecracker/kernels/catalog.yaml"
+
+// ErrChecksumMismatch is returned when a kernel or initrd does not match
+// its catalog checksum.
+var ErrChecksumMismatch = errors.New("checksum mismatch")
+
+// validName matches kernel names; they end up in label keys and paths.
+var validName = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9._-]{0,62}$`)
+
+// Kernel is one catalog entry.
+type Kernel struct {
+	Name         string `yaml:"name"`
+	Version      string `yaml:"version"`
+	Arch         string `yaml:"arch"` // x86_64 or aarch64
+	Path         string `yaml:"path"`
+	SHA256       string `yaml:"sha256"`
+	Initrd       string `yaml:"initrd,omitempty"`
+	InitrdSHA256 string `yaml:"initrd_sha256,omitempty"`
+}
+
+// Validate checks that an entry is complete.
+func (k Kernel) Validate() error {
+	if !validName.MatchString(k.Name) {
+		return fmt.Errorf("invalid kernel name %q", k.Name)
+	}
+	if k.Arch != "x86_64" && k.Arch != "aarch64" {
+		return fmt.Errorf("kernel %s: invalid arch %q, want x86_64 or aarch64", k.Name, k.Arch)
+	}
+	if k.Path == "" || k.SHA256 == "" {
+		return fmt.Errorf("kernel %s: path and sha256 are required", k.Name)
+	}
+	if k.Initrd != "" && k.InitrdSHA256 == "" {
+		return fmt.Errorf("kernel %s: initrd_sha256 is required with an initrd", k.Name)
+	}
+	return nil
+}
+
+// Verify checks the kernel and initrd files against their checksums.
+func (k Kernel) Verify() error {
+	if err := VerifyFile(k.Path, k.SHA256); err != nil {
+		return fmt.Errorf("kernel %s: %w", k.Name, err)
+	}
+	if k.Initrd != "" {
+		if err := VerifyFile(k.Initrd, k.InitrdSHA256); err != nil {
+			return fmt.Errorf("kernel %s initrd: %w", k.Name, err)
+		}
+	}
+	return nil
+}
+
+// Catalog is the set of kernels installed on a node, stored as YAML.
+type Catalog struct {
+	Kernels []Kernel `yaml:"kernels"`
+
+	path string
+}
+
+// Load reads the catalog at path. A missing file is an empty catalog.
+func Load(path string) (*Catalog, error) {
+	c := &Catalog{path: path}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read kernel catalog: %w", err)
+	}
+	if err := yaml.Unmarshal(data, c); err != nil {
+		return nil, fmt.Errorf("failed to parse kernel catalog %s: %w", path, err)
+	}
+	for _, k := range c.Kernels {
+		if err := k.Validate(); err != nil {
+			return nil, fmt.Errorf("kernel catalog %s: %w", path, err)
+		}
+	}
+	return c, nil
+}
+
+// Path returns the file the catalog is stored in.
+func (c *Catalog) Path() string {
+	return c.path
+}
+
+// Save writes the catalog back to its file.
+func (c *Catalog) Save() error {
+	data, err := yaml.Marshal(c)
+	if err != nil {
+		return fmt.Errorf("failed to encode kernel catalog: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(c.path), 0755); err != nil {
+		return fmt.Errorf("failed to create catalog directory: %w", err)
+	}
+	tmp := c.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write kernel catalog: %w", err)
+	}
+	return os.Rename(tmp, c.path)
+}
+
+// Get returns the kernel with the given name.
+func (c *Catalog) Get(name string) (Kernel, bool) {
+	for _, k := range c.Kernels {
+		if k.Name == name {
+			return k, true
+		}
+	}
+	return Kernel{}, false
+}
+
+// Lookup returns the kernel stored at path, if the catalog has one.
+func (c *Catalog) Lookup(path string) (Kernel, bool) {
+	for _, k := range c.Kernels {
+		if k.Path == path {
+			return k, true
+		}
+	}
+	return Kernel{}, false
+}
+
+// Add adds a kernel, replacing any kernel of the same name.
+func (c *Catalog) Add(k Kernel) error {
+	if err := k.Validate(); err != nil {
+		return err
+	}
+	for i := range c.Kernels {
+		if c.Kernels[i].Name == k.Name {
+			c.Kernels[i] = k
+			return nil
+		}
+	}
+	c.Kernels = append(c.Kernels, k)
+	sort.Slice(c.Kernels, func(i, j int) bool { return c.Kernels[i].Name < c.Kernels[j].Name })
+	return nil
+}
+
+// Remove removes a kernel and reports whether it was in the catalog.
+func (c *Catalog) Remove(name string) bool {
+	for i, k := range c.Kernels {
+		if k.Name == name {
+			c.Kernels = append(c.Kernels[:i], c.Kernels[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Installed returns the kernels this node can boot: built for its
+// architecture and present on disk.
+func (c *Catalog) Installed() []Kernel {
+	var installed []Kernel
+	for _, k := range c.Kernels {
+		if k.Arch != HostArch() {
+			continue
+		}
+		if _, err := os.Stat(k.Path); err != nil {
+			continue
+		}
+		installed = append(installed, k)
+	}
+	return installed
+}
+
+// Resolve returns the kernel a service with the given labels asks for. It
+// reports false for services without the label.
+func (c *Catalog) Resolve(labels map[string]string) (Kernel, bool, error) {
+	name := labels[Label]
+	if name == "" {
+		return Kernel{}, false, nil
+	}
+	k, ok := c.Get(name)
+	if !ok {
+		return Kernel{}, false, fmt.Errorf("kernel %q is not in this node's catalog", name)
+	}
+	if k.Arch != HostArch() {
+		return Kernel{}, false, fmt.Errorf("kernel %q is built for %s, node is %s", name, k.Arch, HostArch())
+	}
+	return k, true, nil
+}
+
+// NodeLabels returns the engine labels advertising kernels.
+func NodeLabels(kernels []Kernel) map[string]string {
+	labels := make(map[string]string, len(kernels))
+	for _, k := range kernels {
+		labels[NodeLabelPrefix+k.Name] = "true"
+	}
+	return labels
+}
+
+// Constraint returns the placement constraint that keeps a service on
+// nodes that have the named kernel.
+func Constraint(name string) string {
+	return "engine.labels." + NodeLabelPrefix + name + "==true"
+}
+
+// HostArch returns the node's architecture in Firecracker's naming.
+func HostArch() string {
+	if a, err := arch.Host(); err == nil {
+		return a.Machine
+	}
+	return runtime.GOARCH
+}
+
+// Checksum returns the hex SHA-256 of a file.
+func Checksum(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// VerifyFile checks a file against its hex SHA-256.
+func VerifyFile(path, sum string) error {
+	got, err := Checksum(path)
+	if err != nil {
+		return err
+	}
+	if got != sum {
+		return fmt.Errorf("%w: %s has sha256 %s, want %s", ErrChecksumMismatch, path, got, sum)
+	}
+	return nil
+}
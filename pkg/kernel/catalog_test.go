@@ -0,0 +1,127 @@
+package kernel
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeKernel writes a fake kernel and returns its catalog entry
+func writeKernel(t *testing.T, dir, name string) Kernel {
+	t.Helper()
+	path := filepath.Join(dir, name+".vmlinux")
+	require.NoError(t, os.WriteFile(path, []byte("kernel "+name), 0644))
+	sum, err := Checksum(path)
+	require.NoError(t, err)
+	return Kernel{Name: name, Version: "1.0", Arch: HostArch(), Path: path, SHA256: sum}
+}
+
+func TestCatalog_SaveLoad(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "kernels", "catalog.yaml")
+
+	empty, err := Load(path)
+	require.NoError(t, err)
+	assert.Empty(t, empty.Kernels)
+
+	lts := writeKernel(t, dir, "5.10-lts")
+	current := writeKernel(t, dir, "6.1")
+	require.NoError(t, empty.Add(current))
+	require.NoError(t, empty.Add(lts))
+	require.NoError(t, empty.Save())
+
+	loaded, err := Load(path)
+	require.NoError(t, err)
+	assert.Equal(t, []Kernel{lts, current}, loaded.Kernels, "kernels are kept sorted by name")
+	assert.Equal(t, path, loaded.Path())
+
+	// Adding a kernel of the same name replaces it
+	lts.Version = "1.1"
+	require.NoError(t, loaded.Add(lts))
+	got, ok := loaded.Get("5.10-lts")
+	require.True(t, ok)
+	assert.Equal(t, "1.1", got.Version)
+
+	got, ok = loaded.Lookup(current.Path)
+	require.True(t, ok)
+	assert.Equal(t, "6.1", got.Name)
+
+	assert.True(t, loaded.Remove("6.1"))
+	assert.False(t, loaded.Remove("6.1"))
+	assert.Len(t, loaded.Kernels, 1)
+}
+
+func TestLoad_Invalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "catalog.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("kernels:\n  - name: bad name\n"), 0644))
+
+	_, err := Load(path)
+	assert.Error(t, err)
+}
+
+func TestKernel_Validate(t *testing.T) {
+	valid := Kernel{Name: "6.1", Arch: "x86_64", Path: "/k", SHA256: "ab"}
+	assert.NoError(t, valid.Validate())
+
+	tests := []struct {
+		name   string
+		mutate func(k *Kernel)
+	}{
+		{"empty name", func(k *Kernel) { k.Name = "" }},
+		{"name with slash", func(k *Kernel) { k.Name = "../6.1" }},
+		{"unknown arch", func(k *Kernel) { k.Arch = "riscv64" }},
+		{"no checksum", func(k *Kernel) { k.SHA256 = "" }},
+		{"initrd without checksum", func(k *Kernel) { k.Initrd = "/initrd" }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k := valid
+			tt.mutate(&k)
+			assert.Error(t, k.Validate())
+		})
+	}
+}
+
+func TestKernel_Verify(t *testing.T) {
+	dir := t.TempDir()
+	k := writeKernel(t, dir, "6.1")
+	assert.NoError(t, k.Verify())
+
+	require.NoError(t, os.WriteFile(k.Path, []byte("tampered"), 0644))
+	assert.True(t, errors.Is(k.Verify(), ErrChecksumMismatch))
+
+	k.Path = filepath.Join(dir, "missing")
+	assert.Error(t, k.Verify())
+}
+
+func TestCatalog_Resolve(t *testing.T) {
+	dir := t.TempDir()
+	lts := writeKernel(t, dir, "5.10-lts")
+	foreign := writeKernel(t, dir, "foreign")
+	foreign.Arch = "riscv64"
+	missing := writeKernel(t, dir, "missing")
+	require.NoError(t, os.Remove(missing.Path))
+	c := &Catalog{Kernels: []Kernel{lts, foreign, missing}}
+
+	k, ok, err := c.Resolve(map[string]string{Label: "5.10-lts"})
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, lts, k)
+
+	_, ok, err = c.Resolve(nil)
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	_, _, err = c.Resolve(map[string]string{Label: "4.14"})
+	assert.Error(t, err)
+	_, _, err = c.Resolve(map[string]string{Label: "foreign"})
+	assert.Error(t, err)
+
+	assert.Equal(t, []Kernel{lts}, c.Installed())
+	assert.Equal(t, map[string]string{"swarmcracker.kernel.5.10-lts": "true"}, NodeLabels(c.Installed()))
+	assert.Equal(t, "engine.labels.swarmcracker.kernel.5.10-lts==true", Constraint("5.10-lts"))
+}
@@ -0,0 +1,132 @@
+package kernel
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/restuhaqza/swarmcracker/pkg/arch"
+	"github.com/rs/zerolog/log"
+)
+
+// Media types of the layers of a kernel artifact.
+const (
+	MediaTypeKernel types.MediaType = "application/vnd.swarmcracker.kernel.v1"
+	MediaTypeInitrd types.MediaType = "application/vnd.swarmcracker.initrd.v1"
+)
+
+// Manifest annotations describing a kernel artifact.
+const (
+	AnnotationName    = "io.swarmcracker.kernel.name"
+	AnnotationVersion = "io.swarmcracker.kernel.version"
+	AnnotationArch    = "io.swarmcracker.kernel.arch"
+)
+
+// Pull downloads a kernel artifact into dir/<name> and returns its catalog
+// entry. The artifact is an OCI manifest with a MediaTypeKernel layer, an
+// optional MediaTypeInitrd layer, and annotations describing the kernel;
+// kernelName, if set, overrides the annotated name. Indexes are resolved
+// to the node's platform.
+func Pull(ctx context.Context, ref, dir, kernelName string, opts ...remote.Option) (Kernel, error) {
+	parsed, err := name.ParseReference(ref)
+	if err != nil {
+		return Kernel{}, fmt.Errorf("invalid kernel reference %q: %w", ref, err)
+	}
+
+	opts = append([]remote.Option{remote.WithContext(ctx)}, opts...)
+	img, err := arch.Default().Image(parsed, opts...)
+	if err != nil {
+		return Kernel{}, fmt.Errorf("failed to pull kernel %s: %w", ref, err)
+	}
+	manifest, err := img.Manifest()
+	if err != nil {
+		return Kernel{}, fmt.Errorf("failed to read manifest of %s: %w", ref, err)
+	}
+
+	k := Kernel{
+		Name:    manifest.Annotations[AnnotationName],
+		Version: manifest.Annotations[AnnotationVersion],
+		Arch:    manifest.Annotations[AnnotationArch],
+	}
+	if kernelName != "" {
+		k.Name = kernelName
+	}
+	if k.Arch == "" {
+		k.Arch = HostArch()
+	}
+	if !validName.MatchString(k.Name) {
+		return Kernel{}, fmt.Errorf("artifact %s has no valid %s annotation, pass a name", ref, AnnotationName)
+	}
+
+	kernelDir := filepath.Join(dir, k.Name)
+	if err := os.MkdirAll(kernelDir, 0755); err != nil {
+		return Kernel{}, fmt.Errorf("failed to create kernel directory: %w", err)
+	}
+
+	for _, desc := range manifest.Layers {
+		var path string
+		switch desc.MediaType {
+		case MediaTypeKernel:
+			path = filepath.Join(kernelDir, "vmlinux")
+			k.Path, k.SHA256 = path, desc.Digest.Hex
+		case MediaTypeInitrd:
+			path = filepath.Join(kernelDir, "initrd")
+			k.Initrd, k.InitrdSHA256 = path, desc.Digest.Hex
+		default:
+			continue
+		}
+		layer, err := img.LayerByDigest(desc.Digest)
+		if err != nil {
+			return Kernel{}, fmt.Errorf("failed to get layer %s: %w", desc.Digest, err)
+		}
+		if err := writeBlob(layer, path, desc.Digest.Hex); err != nil {
+			return Kernel{}, err
+		}
+	}
+	if k.Path == "" {
+		return Kernel{}, fmt.Errorf("artifact %s has no %s layer", ref, MediaTypeKernel)
+	}
+
+	log.Info().
+		Str("kernel", k.Name).
+		Str("version", k.Version).
+		Str("ref", ref).
+		Msg("Pulled kernel")
+	return k, k.Validate()
+}
+
+// writeBlob writes a layer's blob to path, checking it against its digest.
+func writeBlob(layer v1.Layer, path, sum string) error {
+	rc, err := layer.Compressed()
+	if err != nil {
+		return fmt.Errorf("failed to download %s: %w", filepath.Base(path), err)
+	}
+	defer rc.Close()
+
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", tmp, err)
+	}
+	h := sha256.New()
+	_, err = io.Copy(io.MultiWriter(f, h), rc)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && hex.EncodeToString(h.Sum(nil)) != sum {
+		err = fmt.Errorf("%w: downloaded %s does not match its digest", ErrChecksumMismatch, filepath.Base(path))
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to download %s: %w", filepath.Base(path), err)
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,124 @@
+package kernel
+
+import (
+	"context"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/static"
+	"github.com/restuhaqza/swarmcracker/pkg/arch"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// pushArtifact pushes a kernel artifact to a test registry and returns its
+// reference
+func pushArtifact(t *testing.T, annotations map[string]string, layers ...mutate.Addendum) string {
+	t.Helper()
+	srv := httptest.NewServer(registry.New())
+	t.Cleanup(srv.Close)
+
+	img, err := mutate.Append(empty.Image, layers...)
+	require.NoError(t, err)
+	img = mutate.Annotations(img, annotations).(v1.Image)
+
+	ref := strings.TrimPrefix(srv.URL, "http://") + "/kernels/lts:5.10"
+	parsed, err := name.ParseReference(ref)
+	require.NoError(t, err)
+	require.NoError(t, remote.Write(parsed, img))
+	return ref
+}
+
+func TestPull(t *testing.T) {
+	ref := pushArtifact(t,
+		map[string]string{AnnotationName: "5.10-lts", AnnotationVersion: "5.10.223"},
+		mutate.Addendum{Layer: static.NewLayer([]byte("vmlinux"), MediaTypeKernel)},
+		mutate.Addendum{Layer: static.NewLayer([]byte("initrd"), MediaTypeInitrd)},
+	)
+	dir := t.TempDir()
+
+	k, err := Pull(context.Background(), ref, dir, "")
+	require.NoError(t, err)
+	assert.Equal(t, "5.10-lts", k.Name)
+	assert.Equal(t, "5.10.223", k.Version)
+	assert.Equal(t, HostArch(), k.Arch)
+	assert.Equal(t, filepath.Join(dir, "5.10-lts", "vmlinux"), k.Path)
+	assert.Equal(t, filepath.Join(dir, "5.10-lts", "initrd"), k.Initrd)
+	assert.NoError(t, k.Verify())
+
+	data, err := os.ReadFile(k.Path)
+	require.NoError(t, err)
+	assert.Equal(t, "vmlinux", string(data))
+
+	renamed, err := Pull(context.Background(), ref, dir, "lts")
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "lts", "vmlinux"), renamed.Path)
+}
+
+func TestPull_Invalid(t *testing.T) {
+	t.Run("no kernel layer", func(t *testing.T) {
+		ref := pushArtifact(t,
+			map[string]string{AnnotationName: "5.10-lts"},
+			mutate.Addendum{Layer: static.NewLayer([]byte("initrd"), MediaTypeInitrd)},
+		)
+		_, err := Pull(context.Background(), ref, t.TempDir(), "")
+		assert.ErrorContains(t, err, "no application/vnd.swarmcracker.kernel.v1 layer")
+	})
+
+	t.Run("no name", func(t *testing.T) {
+		ref := pushArtifact(t, nil,
+			mutate.Addendum{Layer: static.NewLayer([]byte("vmlinux"), MediaTypeKernel)},
+		)
+		_, err := Pull(context.Background(), ref, t.TempDir(), "")
+		assert.ErrorContains(t, err, "pass a name")
+	})
+
+	t.Run("bad reference", func(t *testing.T) {
+		_, err := Pull(context.Background(), "UPPER/case::", t.TempDir(), "")
+		assert.Error(t, err)
+	})
+}
+
+func TestPull_MultiArch(t *testing.T) {
+	srv := httptest.NewServer(registry.New())
+	t.Cleanup(srv.Close)
+
+	idx := v1.ImageIndex(empty.Index)
+	for _, a := range arch.All {
+		img, err := mutate.Append(empty.Image,
+			mutate.Addendum{Layer: static.NewLayer([]byte("vmlinux-"+a.Machine), MediaTypeKernel)})
+		require.NoError(t, err)
+		img = mutate.Annotations(img, map[string]string{
+			AnnotationName: "6.1",
+			AnnotationArch: a.Machine,
+		}).(v1.Image)
+		platform := a.Platform()
+		idx = mutate.AppendManifests(idx, mutate.IndexAddendum{
+			Add:        img,
+			Descriptor: v1.Descriptor{Platform: &platform},
+		})
+	}
+
+	ref := strings.TrimPrefix(srv.URL, "http://") + "/kernels/lts:6.1"
+	parsed, err := name.ParseReference(ref)
+	require.NoError(t, err)
+	require.NoError(t, remote.WriteIndex(parsed, idx))
+
+	k, err := Pull(context.Background(), ref, t.TempDir(), "")
+	require.NoError(t, err)
+	host := arch.Default()
+	assert.Equal(t, host.Machine, k.Arch)
+
+	data, err := os.ReadFile(k.Path)
+	require.NoError(t, err)
+	assert.Equal(t, "vmlinux-"+host.Machine, string(data))
+}
@@ -6,6 +6,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net"
 	"net/http"
 	"os"
@@ -35,6 +36,12 @@ type ManagerConfig struct {
 	DefaultVCPUs    int
 	DefaultMemoryMB int
 	EnableJailer    bool
+	SeccompFilter   string // compiled BPF for --seccomp-filter, "" keeps Firecracker's filters
+
+	// ConsoleIn and ConsoleOut carry the guest serial console. Without
+	// them, the console goes to this process's stdout and takes no input.
+	ConsoleIn  io.Reader
+	ConsoleOut io.Writer
 }
 
 // VMInstance represents a running Firecracker VM.
@@ -162,8 +169,16 @@ func (vm *VMMManager) Start(ctx context.Context, task *types.Task, config interf
 	log.Debug().Str("binary", fcBinary).Msg("Using Firecracker binary")
 
 	// Start Firecracker process (without config file)
-	cmd := exec.Command(fcBinary, "--api-sock", socketPath)
+	args := []string{"--api-sock", socketPath}
+	if vm.config.SeccompFilter != "" {
+		args = append(args, "--seccomp-filter", vm.config.SeccompFilter)
+	}
+	cmd := exec.Command(fcBinary, args...)
+	cmd.Stdin = vm.config.ConsoleIn
 	cmd.Stdout = os.Stdout
+	if vm.config.ConsoleOut != nil {
+		cmd.Stdout = vm.config.ConsoleOut
+	}
 	cmd.Stderr = os.Stderr
 
 	var startErr error
@@ -363,6 +378,32 @@ func (vm *VMMManager) configureVM(ctx context.Context, socketPath string, config
 		}
 	}
 
+	// Configure the memory balloon if provided
+	if balloonCfg, ok := configMap["balloon"].(map[string]interface{}); ok {
+		balloonJSON, err := json.Marshal(balloonCfg)
+		if err != nil {
+			return fmt.Errorf("failed to marshal balloon: %w", err)
+		}
+		req, err := http.NewRequestWithContext(ctx, "PUT",
+			"http://localhost/balloon",
+			bytes.NewReader(balloonJSON),
+		)
+		if err != nil {
+			return fmt.Errorf("failed to create balloon request: %w", err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return fmt.Errorf("failed to set balloon: %w", err)
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("balloon returned status: %d", resp.StatusCode)
+		}
+	}
+
 	return nil
 }
 
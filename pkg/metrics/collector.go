@@ -32,6 +32,8 @@ type Collector struct {
 	cancelMu sync.Mutex            // Protects cancel field
 	metrics  map[string]*VMMetrics // taskID -> metrics
 	cancel   context.CancelFunc    // Cancel periodic collection
+
+	fcMetrics map[string]*MetricsFile // taskID -> Firecracker metrics file, guarded by mu
 }
 
 // NewCollector creates a new metrics collector.
@@ -47,13 +49,27 @@ func NewCollector(stateDir string) (*Collector, error) {
 	}
 
 	c := &Collector{
-		stateDir: stateDir,
-		metrics:  make(map[string]*VMMetrics),
+		stateDir:  stateDir,
+		metrics:   make(map[string]*VMMetrics),
+		fcMetrics: make(map[string]*MetricsFile),
 	}
 
 	return c, nil
 }
 
+// WatchFirecrackerMetrics makes Collect take a task's network counters from
+// the metrics file its Firecracker process writes, which counts only the
+// VM's own devices.
+func (c *Collector) WatchFirecrackerMetrics(taskID, path string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if f, ok := c.fcMetrics[taskID]; ok && f.Path() == path {
+		return
+	}
+	c.fcMetrics[taskID] = NewMetricsFile(path)
+}
+
 // Collect gathers metrics for a specific VM.
 func (c *Collector) Collect(taskID string, pid int) (*VMMetrics, error) {
 	// Check if process exists first
@@ -85,7 +101,7 @@ func (c *Collector) Collect(taskID string, pid int) (*VMMetrics, error) {
 	}
 
 	// Collect network metrics
-	rxBytes, txBytes, err := c.collectNetwork(pid)
+	rxBytes, txBytes, err := c.collectVMNetwork(taskID, pid)
 	if err != nil {
 		m.NetRxBytes = 0
 		m.NetTxBytes = 0
@@ -188,7 +204,28 @@ func (c *Collector) collectMemory(pid int) (uint64, error) {
 	return 0, fmt.Errorf("VmRSS not found in status file")
 }
 
+// collectVMNetwork returns the VM's network stats from its Firecracker
+// metrics file when one is watched, falling back to collectNetwork.
+func (c *Collector) collectVMNetwork(taskID string, pid int) (uint64, uint64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	f, ok := c.fcMetrics[taskID]
+	if !ok {
+		return c.collectNetwork(pid)
+	}
+
+	if _, err := f.Update(); err != nil {
+		return 0, 0, err
+	}
+	rx, tx := f.Totals().NetTotals()
+	return rx, tx, nil
+}
+
 // collectNetwork reads /proc/<pid>/net/dev and returns network stats.
+// This is the network namespace of the Firecracker process, so the numbers
+// are only the VM's own when it runs in a dedicated namespace; otherwise
+// they cover every TAP device on the host.
 func (c *Collector) collectNetwork(pid int) (uint64, uint64, error) {
 	netDevPath := fmt.Sprintf("/proc/%d/net/dev", pid)
 
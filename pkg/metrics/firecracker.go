@@ -0,0 +1,284 @@
+package metrics
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// OutputLimit is how much of the file Firecracker writes its log or metrics
+// to is kept; TrimOutput frees the rest.
+const OutputLimit = 1 << 20
+
+// NetDeviceMetrics are the counters Firecracker reports per network device.
+type NetDeviceMetrics struct {
+	RxBytes   uint64 `json:"rx_bytes_count"`
+	RxPackets uint64 `json:"rx_packets_count"`
+	RxFails   uint64 `json:"rx_fails"`
+	TxBytes   uint64 `json:"tx_bytes_count"`
+	TxPackets uint64 `json:"tx_packets_count"`
+	TxFails   uint64 `json:"tx_fails"`
+}
+
+// BlockDeviceMetrics are the counters Firecracker reports per block device.
+type BlockDeviceMetrics struct {
+	ReadBytes  uint64 `json:"read_bytes"`
+	WriteBytes uint64 `json:"write_bytes"`
+	ReadCount  uint64 `json:"read_count"`
+	WriteCount uint64 `json:"write_count"`
+	FlushCount uint64 `json:"flush_count"`
+}
+
+// VCPUMetrics are the vCPU exit and failure counters.
+type VCPUMetrics struct {
+	ExitIOIn      uint64 `json:"exit_io_in"`
+	ExitIOOut     uint64 `json:"exit_io_out"`
+	ExitMMIORead  uint64 `json:"exit_mmio_read"`
+	ExitMMIOWrite uint64 `json:"exit_mmio_write"`
+	Failures      uint64 `json:"failures"`
+}
+
+// BalloonMetrics are the balloon device counters.
+type BalloonMetrics struct {
+	InflateCount     uint64 `json:"inflate_count"`
+	DeflateCount     uint64 `json:"deflate_count"`
+	ActivateFails    uint64 `json:"activate_fails"`
+	StatsUpdateFails uint64 `json:"stats_update_fails"`
+	EventFails       uint64 `json:"event_fails"`
+}
+
+// SeccompMetrics count seccomp filter violations.
+type SeccompMetrics struct {
+	NumFaults uint64 `json:"num_faults"`
+}
+
+// FirecrackerMetrics is one flush of Firecracker's JSON metrics, or the sum
+// of several. Firecracker reports counters as the increase since the
+// previous flush, so flushes are summed to get totals.
+type FirecrackerMetrics struct {
+	Net     map[string]NetDeviceMetrics   // keyed by iface_id
+	Block   map[string]BlockDeviceMetrics // keyed by drive_id
+	VCPU    VCPUMetrics
+	Balloon BalloonMetrics
+	Seccomp SeccompMetrics
+}
+
+// NewFirecrackerMetrics returns empty metrics.
+func NewFirecrackerMetrics() *FirecrackerMetrics {
+	return &FirecrackerMetrics{
+		Net:   make(map[string]NetDeviceMetrics),
+		Block: make(map[string]BlockDeviceMetrics),
+	}
+}
+
+// ParseFirecrackerMetrics parses one line of Firecracker's metrics output.
+// Only per-device sections ("net_<iface_id>", "block_<drive_id>") are kept;
+// the aggregate "net" and "block" sections are their sum.
+func ParseFirecrackerMetrics(line []byte) (*FirecrackerMetrics, error) {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(line, &raw); err != nil {
+		return nil, fmt.Errorf("failed to parse firecracker metrics: %w", err)
+	}
+
+	m := NewFirecrackerMetrics()
+	for key, value := range raw {
+		var err error
+		switch {
+		case strings.HasPrefix(key, "net_"):
+			var dev NetDeviceMetrics
+			err = json.Unmarshal(value, &dev)
+			m.Net[strings.TrimPrefix(key, "net_")] = dev
+		case strings.HasPrefix(key, "block_"):
+			var dev BlockDeviceMetrics
+			err = json.Unmarshal(value, &dev)
+			m.Block[strings.TrimPrefix(key, "block_")] = dev
+		case key == "vcpu":
+			err = json.Unmarshal(value, &m.VCPU)
+		case key == "balloon":
+			err = json.Unmarshal(value, &m.Balloon)
+		case key == "seccomp":
+			err = json.Unmarshal(value, &m.Seccomp)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse firecracker metrics %q: %w", key, err)
+		}
+	}
+	return m, nil
+}
+
+// Add adds the counters of other to m.
+func (m *FirecrackerMetrics) Add(other *FirecrackerMetrics) {
+	for id, dev := range other.Net {
+		cur := m.Net[id]
+		cur.RxBytes += dev.RxBytes
+		cur.RxPackets += dev.RxPackets
+		cur.RxFails += dev.RxFails
+		cur.TxBytes += dev.TxBytes
+		cur.TxPackets += dev.TxPackets
+		cur.TxFails += dev.TxFails
+		m.Net[id] = cur
+	}
+	for id, dev := range other.Block {
+		cur := m.Block[id]
+		cur.ReadBytes += dev.ReadBytes
+		cur.WriteBytes += dev.WriteBytes
+		cur.ReadCount += dev.ReadCount
+		cur.WriteCount += dev.WriteCount
+		cur.FlushCount += dev.FlushCount
+		m.Block[id] = cur
+	}
+
+	m.VCPU.ExitIOIn += other.VCPU.ExitIOIn
+	m.VCPU.ExitIOOut += other.VCPU.ExitIOOut
+	m.VCPU.ExitMMIORead += other.VCPU.ExitMMIORead
+	m.VCPU.ExitMMIOWrite += other.VCPU.ExitMMIOWrite
+	m.VCPU.Failures += other.VCPU.Failures
+
+	m.Balloon.InflateCount += other.Balloon.InflateCount
+	m.Balloon.DeflateCount += other.Balloon.DeflateCount
+	m.Balloon.ActivateFails += other.Balloon.ActivateFails
+	m.Balloon.StatsUpdateFails += other.Balloon.StatsUpdateFails
+	m.Balloon.EventFails += other.Balloon.EventFails
+
+	m.Seccomp.NumFaults += other.Seccomp.NumFaults
+}
+
+// NetTotals returns the bytes received and transmitted over all devices.
+func (m *FirecrackerMetrics) NetTotals() (rx, tx uint64) {
+	for _, dev := range m.Net {
+		rx += dev.RxBytes
+		tx += dev.TxBytes
+	}
+	return rx, tx
+}
+
+// FirecrackerMetricsPath returns the metrics file of the VM listening on
+// socketPath ("<dir>/<task>.sock" becomes "<dir>/<task>.metrics").
+func FirecrackerMetricsPath(socketPath string) string {
+	return strings.TrimSuffix(socketPath, ".sock") + ".metrics"
+}
+
+// FirecrackerLogPath returns the log file of the VM listening on socketPath.
+func FirecrackerLogPath(socketPath string) string {
+	return strings.TrimSuffix(socketPath, ".sock") + ".log"
+}
+
+// TrimOutput frees all but the last keep bytes of f, a file Firecracker
+// writes its log or metrics to. Firecracker writes at its own offset rather
+// than appending, so the file cannot be truncated under it: the freed range
+// is punched out instead and reads back as NUL bytes, and the file keeps its
+// size.
+func TrimOutput(f *os.File, keep int64) error {
+	info, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat %s: %w", f.Name(), err)
+	}
+	end := info.Size() - keep
+	if end <= 0 {
+		return nil
+	}
+	if err := unix.Fallocate(int(f.Fd()), unix.FALLOC_FL_PUNCH_HOLE|unix.FALLOC_FL_KEEP_SIZE, 0, end); err != nil {
+		return fmt.Errorf("failed to trim %s: %w", f.Name(), err)
+	}
+	return nil
+}
+
+// MetricsFile follows the metrics file Firecracker appends a JSON line to
+// on every flush. Flushes TrimOutput freed before they were read are lost.
+type MetricsFile struct {
+	path    string
+	offset  int64
+	partial []byte // trailing line not yet terminated by a newline
+	totals  *FirecrackerMetrics
+}
+
+// NewMetricsFile returns a reader for the metrics file at path.
+func NewMetricsFile(path string) *MetricsFile {
+	return &MetricsFile{path: path, totals: NewFirecrackerMetrics()}
+}
+
+// Path returns the metrics file path.
+func (f *MetricsFile) Path() string {
+	return f.path
+}
+
+// Update reads the flushes written since the previous call and returns
+// their sum. A file that does not exist yet has no flushes.
+func (f *MetricsFile) Update() (*FirecrackerMetrics, error) {
+	delta := NewFirecrackerMetrics()
+
+	file, err := os.Open(f.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return delta, nil
+	}
+	if err != nil {
+		return delta, fmt.Errorf("failed to open metrics file: %w", err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return delta, fmt.Errorf("failed to stat metrics file: %w", err)
+	}
+	if info.Size() < f.offset {
+		// Truncated or replaced: start over, keeping the totals so far
+		f.offset = 0
+		f.partial = nil
+	}
+
+	// Skip the range TrimOutput punched out rather than read it as NULs; a
+	// line cut by the hole is incomplete
+	next, err := file.Seek(f.offset, unix.SEEK_DATA)
+	if errors.Is(err, unix.ENXIO) {
+		return delta, nil
+	}
+	if err != nil {
+		return delta, fmt.Errorf("failed to seek metrics file: %w", err)
+	}
+	if next > f.offset {
+		f.offset = next
+		f.partial = nil
+	}
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return delta, fmt.Errorf("failed to read metrics file: %w", err)
+	}
+	f.offset += int64(len(data))
+
+	data = append(f.partial, data...)
+	end := bytes.LastIndexByte(data, '\n')
+	if end < 0 {
+		f.partial = data
+		return delta, nil
+	}
+	f.partial = append([]byte(nil), data[end+1:]...)
+
+	for _, line := range bytes.Split(data[:end], []byte("\n")) {
+		line = bytes.TrimLeft(line, "\x00")
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		m, err := ParseFirecrackerMetrics(line)
+		if err != nil {
+			logDebug("Skipping malformed metrics line in %s: %v", f.path, err)
+			continue
+		}
+		delta.Add(m)
+	}
+
+	f.totals.Add(delta)
+	return delta, nil
+}
+
+// Totals returns the sum of all flushes read so far.
+func (f *MetricsFile) Totals() *FirecrackerMetrics {
+	totals := NewFirecrackerMetrics()
+	totals.Add(f.totals)
+	return totals
+}
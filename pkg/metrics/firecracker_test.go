@@ -0,0 +1,144 @@
+package metrics
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const fcFlush = `{"utc_timestamp_ms":1,"net":{"rx_bytes_count":150},` +
+	`"net_eth0":{"rx_bytes_count":100,"rx_packets_count":2,"tx_bytes_count":40,"tx_packets_count":1,"tx_fails":1},` +
+	`"net_eth1":{"rx_bytes_count":50},` +
+	`"block_rootfs":{"read_bytes":4096,"write_bytes":512,"read_count":1,"write_count":1,"flush_count":1},` +
+	`"vcpu":{"exit_io_in":3,"exit_io_out":4,"exit_mmio_read":5,"exit_mmio_write":6,"failures":0},` +
+	`"balloon":{"inflate_count":1,"activate_fails":1},"seccomp":{"num_faults":2},"uart":{"flush_count":9}}`
+
+func TestParseFirecrackerMetrics(t *testing.T) {
+	m, err := ParseFirecrackerMetrics([]byte(fcFlush))
+	require.NoError(t, err)
+
+	assert.Len(t, m.Net, 2, "aggregate net section is not a device")
+	assert.Equal(t, NetDeviceMetrics{RxBytes: 100, RxPackets: 2, TxBytes: 40, TxPackets: 1, TxFails: 1}, m.Net["eth0"])
+	assert.Equal(t, uint64(512), m.Block["rootfs"].WriteBytes)
+	assert.Equal(t, VCPUMetrics{ExitIOIn: 3, ExitIOOut: 4, ExitMMIORead: 5, ExitMMIOWrite: 6}, m.VCPU)
+	assert.Equal(t, uint64(1), m.Balloon.InflateCount)
+	assert.Equal(t, uint64(2), m.Seccomp.NumFaults)
+
+	rx, tx := m.NetTotals()
+	assert.Equal(t, uint64(150), rx)
+	assert.Equal(t, uint64(40), tx)
+
+	_, err = ParseFirecrackerMetrics([]byte("{"))
+	assert.Error(t, err)
+	_, err = ParseFirecrackerMetrics([]byte(`{"vcpu":"busy"}`))
+	assert.Error(t, err)
+}
+
+func TestFirecrackerPaths(t *testing.T) {
+	assert.Equal(t, "/run/fc/task-1.metrics", FirecrackerMetricsPath("/run/fc/task-1.sock"))
+	assert.Equal(t, "/run/fc/task-1.log", FirecrackerLogPath("/run/fc/task-1.sock"))
+}
+
+func TestMetricsFile_Update(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "task-1.metrics")
+	f := NewMetricsFile(path)
+
+	// Nothing flushed yet
+	delta, err := f.Update()
+	require.NoError(t, err)
+	assert.Empty(t, delta.Net)
+
+	appendTo := func(s string) {
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0640)
+		require.NoError(t, err)
+		_, err = file.WriteString(s)
+		require.NoError(t, err)
+		require.NoError(t, file.Close())
+	}
+
+	// A complete flush followed by half of the next one
+	appendTo(fcFlush + "\n" + fcFlush[:20])
+	delta, err = f.Update()
+	require.NoError(t, err)
+	assert.Equal(t, uint64(100), delta.Net["eth0"].RxBytes)
+
+	// The rest of the second flush and a malformed line
+	appendTo(fcFlush[20:] + "\nnot json\n")
+	delta, err = f.Update()
+	require.NoError(t, err)
+	assert.Equal(t, uint64(100), delta.Net["eth0"].RxBytes)
+	assert.Equal(t, uint64(200), f.Totals().Net["eth0"].RxBytes)
+
+	// Truncation restarts from the beginning without losing totals
+	require.NoError(t, os.WriteFile(path, []byte(fcFlush+"\n"), 0640))
+	_, err = f.Update()
+	require.NoError(t, err)
+	assert.Equal(t, uint64(300), f.Totals().Net["eth0"].RxBytes)
+}
+
+func TestTrimOutput(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "task-1.metrics")
+	flushes := strings.Repeat(fcFlush+"\n", 64)
+	require.NoError(t, os.WriteFile(path, []byte(flushes), 0640))
+
+	// A reader that is up to date keeps reading after the trim
+	seen := NewMetricsFile(path)
+	_, err := seen.Update()
+	require.NoError(t, err)
+
+	file, err := os.OpenFile(path, os.O_RDWR, 0)
+	require.NoError(t, err)
+	defer file.Close()
+
+	keep := int64(3 * (len(fcFlush) + 1))
+	err = TrimOutput(file, keep)
+	if errors.Is(err, syscall.EOPNOTSUPP) {
+		t.Skip("file system cannot punch holes")
+	}
+	require.NoError(t, err)
+
+	info, err := file.Stat()
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(flushes)), info.Size(), "trimming keeps the size Firecracker writes at")
+	used := info.Sys().(*syscall.Stat_t).Blocks * 512
+	assert.Less(t, used, int64(len(flushes))/2, "trimmed range is freed")
+
+	// Firecracker keeps writing at its offset
+	_, err = file.WriteAt([]byte(fcFlush+"\n"), info.Size())
+	require.NoError(t, err)
+
+	delta, err := seen.Update()
+	require.NoError(t, err)
+	assert.Equal(t, uint64(100), delta.Net["eth0"].RxBytes)
+	assert.Equal(t, uint64(65*100), seen.Totals().Net["eth0"].RxBytes)
+
+	// A new reader skips the freed range: the three kept flushes and the new one
+	fresh := NewMetricsFile(path)
+	delta, err = fresh.Update()
+	require.NoError(t, err)
+	assert.Equal(t, uint64(400), delta.Net["eth0"].RxBytes)
+
+	// Nothing to free in a file under the limit
+	require.NoError(t, TrimOutput(file, info.Size()*2))
+}
+
+func TestCollector_WatchFirecrackerMetrics(t *testing.T) {
+	c, err := NewCollector(t.TempDir())
+	require.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "task-1.metrics")
+	require.NoError(t, os.WriteFile(path, []byte(fcFlush+"\n"+fcFlush+"\n"), 0640))
+	c.WatchFirecrackerMetrics("task-1", path)
+	c.WatchFirecrackerMetrics("task-1", path) // idempotent
+
+	m, err := c.Collect("task-1", os.Getpid())
+	require.NoError(t, err)
+	assert.Equal(t, uint64(300), m.NetRxBytes)
+	assert.Equal(t, uint64(80), m.NetTxBytes)
+}
@@ -0,0 +1,277 @@
+package metrics
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// TaskLabels identify the task a VM belongs to in exported metrics.
+type TaskLabels struct {
+	Task    string
+	Service string
+}
+
+// Exporter exports per-VM Firecracker metrics and agent-level counters in
+// the Prometheus format. Every series carries a node label.
+//
+// A nil *Exporter is valid and records nothing.
+type Exporter struct {
+	registry *prometheus.Registry
+
+	mu  sync.Mutex
+	vms map[string]*trackedVM // taskID -> VM
+
+	netRxBytes      *prometheus.CounterVec
+	netTxBytes      *prometheus.CounterVec
+	netRxPackets    *prometheus.CounterVec
+	netTxPackets    *prometheus.CounterVec
+	netFailures     *prometheus.CounterVec
+	blockReadBytes  *prometheus.CounterVec
+	blockWriteBytes *prometheus.CounterVec
+	blockReadOps    *prometheus.CounterVec
+	blockWriteOps   *prometheus.CounterVec
+	blockFlushOps   *prometheus.CounterVec
+	vcpuExits       *prometheus.CounterVec
+	vcpuFailures    *prometheus.CounterVec
+	balloonInflates *prometheus.CounterVec
+	balloonDeflates *prometheus.CounterVec
+	balloonFailures *prometheus.CounterVec
+	seccompFaults   *prometheus.CounterVec
+
+	prepareDuration prometheus.Histogram
+	prepareFailures prometheus.Counter
+	bootDuration    prometheus.Histogram
+	bootFailures    prometheus.Counter
+	warmPoolClaims  *prometheus.CounterVec
+	warmPoolReady   *prometheus.GaugeVec
+}
+
+// trackedVM is a running VM whose metrics file is exported.
+type trackedVM struct {
+	labels TaskLabels
+	file   *MetricsFile
+}
+
+var (
+	vmLabels     = []string{"task", "service"}
+	deviceLabels = []string{"task", "service", "device"}
+)
+
+// NewExporter creates an exporter for the given node.
+func NewExporter(node string) *Exporter {
+	e := &Exporter{
+		registry: prometheus.NewRegistry(),
+		vms:      make(map[string]*trackedVM),
+	}
+	reg := prometheus.WrapRegistererWith(prometheus.Labels{"node": node}, e.registry)
+
+	counter := func(name, help string, labels []string) *prometheus.CounterVec {
+		c := prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "swarmcracker",
+			Name:      name,
+			Help:      help,
+		}, labels)
+		reg.MustRegister(c)
+		return c
+	}
+
+	e.netRxBytes = counter("vm_net_rx_bytes_total", "Bytes received by the VM's network device.", deviceLabels)
+	e.netTxBytes = counter("vm_net_tx_bytes_total", "Bytes transmitted by the VM's network device.", deviceLabels)
+	e.netRxPackets = counter("vm_net_rx_packets_total", "Packets received by the VM's network device.", deviceLabels)
+	e.netTxPackets = counter("vm_net_tx_packets_total", "Packets transmitted by the VM's network device.", deviceLabels)
+	e.netFailures = counter("vm_net_failures_total", "Failed rx or tx operations on the VM's network device.",
+		append(deviceLabels, "direction"))
+	e.blockReadBytes = counter("vm_block_read_bytes_total", "Bytes read from the VM's block device.", deviceLabels)
+	e.blockWriteBytes = counter("vm_block_write_bytes_total", "Bytes written to the VM's block device.", deviceLabels)
+	e.blockReadOps = counter("vm_block_read_ops_total", "Read operations on the VM's block device.", deviceLabels)
+	e.blockWriteOps = counter("vm_block_write_ops_total", "Write operations on the VM's block device.", deviceLabels)
+	e.blockFlushOps = counter("vm_block_flush_ops_total", "Flush operations on the VM's block device.", deviceLabels)
+	e.vcpuExits = counter("vm_vcpu_exits_total", "vCPU exits handled by the VMM, by reason.", append(vmLabels, "reason"))
+	e.vcpuFailures = counter("vm_vcpu_failures_total", "vCPU run failures.", vmLabels)
+	e.balloonInflates = counter("vm_balloon_inflates_total", "Balloon inflate operations.", vmLabels)
+	e.balloonDeflates = counter("vm_balloon_deflates_total", "Balloon deflate operations.", vmLabels)
+	e.balloonFailures = counter("vm_balloon_failures_total", "Failed balloon activations, stats updates and events.", vmLabels)
+	e.seccompFaults = counter("vm_seccomp_faults_total", "Seccomp filter violations by the VMM.", vmLabels)
+
+	e.prepareDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: "swarmcracker",
+		Name:      "task_prepare_duration_seconds",
+		Help:      "Time to prepare a task's image, network and secrets.",
+		Buckets:   prometheus.ExponentialBuckets(0.1, 2, 12),
+	})
+	e.prepareFailures = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "swarmcracker",
+		Name:      "task_prepare_failures_total",
+		Help:      "Tasks that failed to prepare.",
+	})
+	e.bootDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: "swarmcracker",
+		Name:      "vm_boot_duration_seconds",
+		Help:      "Time from launching Firecracker to a started VM.",
+		Buckets:   prometheus.ExponentialBuckets(0.05, 2, 10),
+	})
+	e.bootFailures = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "swarmcracker",
+		Name:      "vm_boot_failures_total",
+		Help:      "VMs that failed to boot.",
+	})
+	reg.MustRegister(e.prepareDuration, e.prepareFailures, e.bootDuration, e.bootFailures)
+
+	e.warmPoolClaims = counter("warm_pool_claims_total",
+		"Tasks that asked the warm pool of their image for a VM, by result (hit or miss).", []string{"image", "result"})
+	e.warmPoolReady = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "swarmcracker",
+		Name:      "warm_pool_ready_vms",
+		Help:      "Paused VMs waiting in the warm pool of an image.",
+	}, []string{"image"})
+	reg.MustRegister(e.warmPoolReady)
+
+	return e
+}
+
+// Track starts exporting the metrics Firecracker writes to metricsPath for
+// a task. Tracking a task again replaces its previous entry.
+func (e *Exporter) Track(labels TaskLabels, metricsPath string) {
+	if e == nil {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.vms[labels.Task] = &trackedVM{labels: labels, file: NewMetricsFile(metricsPath)}
+}
+
+// Untrack stops exporting a task's metrics and drops its series.
+func (e *Exporter) Untrack(taskID string) {
+	if e == nil {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	delete(e.vms, taskID)
+	match := prometheus.Labels{"task": taskID}
+	for _, vec := range e.vmVecs() {
+		vec.DeletePartialMatch(match)
+	}
+}
+
+// Scrape reads the new flushes of every tracked VM.
+func (e *Exporter) Scrape() {
+	if e == nil {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for taskID, vm := range e.vms {
+		delta, err := vm.file.Update()
+		if err != nil {
+			logDebug("Failed to read metrics for %s: %v", taskID, err)
+			continue
+		}
+		e.record(vm.labels, delta)
+	}
+}
+
+// record adds one VM's counter increments.
+func (e *Exporter) record(l TaskLabels, m *FirecrackerMetrics) {
+	for dev, n := range m.Net {
+		e.netRxBytes.WithLabelValues(l.Task, l.Service, dev).Add(float64(n.RxBytes))
+		e.netTxBytes.WithLabelValues(l.Task, l.Service, dev).Add(float64(n.TxBytes))
+		e.netRxPackets.WithLabelValues(l.Task, l.Service, dev).Add(float64(n.RxPackets))
+		e.netTxPackets.WithLabelValues(l.Task, l.Service, dev).Add(float64(n.TxPackets))
+		e.netFailures.WithLabelValues(l.Task, l.Service, dev, "rx").Add(float64(n.RxFails))
+		e.netFailures.WithLabelValues(l.Task, l.Service, dev, "tx").Add(float64(n.TxFails))
+	}
+	for dev, b := range m.Block {
+		e.blockReadBytes.WithLabelValues(l.Task, l.Service, dev).Add(float64(b.ReadBytes))
+		e.blockWriteBytes.WithLabelValues(l.Task, l.Service, dev).Add(float64(b.WriteBytes))
+		e.blockReadOps.WithLabelValues(l.Task, l.Service, dev).Add(float64(b.ReadCount))
+		e.blockWriteOps.WithLabelValues(l.Task, l.Service, dev).Add(float64(b.WriteCount))
+		e.blockFlushOps.WithLabelValues(l.Task, l.Service, dev).Add(float64(b.FlushCount))
+	}
+
+	e.vcpuExits.WithLabelValues(l.Task, l.Service, "io_in").Add(float64(m.VCPU.ExitIOIn))
+	e.vcpuExits.WithLabelValues(l.Task, l.Service, "io_out").Add(float64(m.VCPU.ExitIOOut))
+	e.vcpuExits.WithLabelValues(l.Task, l.Service, "mmio_read").Add(float64(m.VCPU.ExitMMIORead))
+	e.vcpuExits.WithLabelValues(l.Task, l.Service, "mmio_write").Add(float64(m.VCPU.ExitMMIOWrite))
+	e.vcpuFailures.WithLabelValues(l.Task, l.Service).Add(float64(m.VCPU.Failures))
+
+	e.balloonInflates.WithLabelValues(l.Task, l.Service).Add(float64(m.Balloon.InflateCount))
+	e.balloonDeflates.WithLabelValues(l.Task, l.Service).Add(float64(m.Balloon.DeflateCount))
+	e.balloonFailures.WithLabelValues(l.Task, l.Service).Add(
+		float64(m.Balloon.ActivateFails + m.Balloon.StatsUpdateFails + m.Balloon.EventFails))
+
+	e.seccompFaults.WithLabelValues(l.Task, l.Service).Add(float64(m.Seccomp.NumFaults))
+}
+
+// vmVecs returns the per-VM metric vectors.
+func (e *Exporter) vmVecs() []*prometheus.CounterVec {
+	return []*prometheus.CounterVec{
+		e.netRxBytes, e.netTxBytes, e.netRxPackets, e.netTxPackets, e.netFailures,
+		e.blockReadBytes, e.blockWriteBytes, e.blockReadOps, e.blockWriteOps, e.blockFlushOps,
+		e.vcpuExits, e.vcpuFailures,
+		e.balloonInflates, e.balloonDeflates, e.balloonFailures,
+		e.seccompFaults,
+	}
+}
+
+// ObservePrepare records a task preparation.
+func (e *Exporter) ObservePrepare(d time.Duration, err error) {
+	if e == nil {
+		return
+	}
+	if err != nil {
+		e.prepareFailures.Inc()
+		return
+	}
+	e.prepareDuration.Observe(d.Seconds())
+}
+
+// ObserveBoot records a VM boot.
+func (e *Exporter) ObserveBoot(d time.Duration, err error) {
+	if e == nil {
+		return
+	}
+	if err != nil {
+		e.bootFailures.Inc()
+		return
+	}
+	e.bootDuration.Observe(d.Seconds())
+}
+
+// ObserveWarmPoolClaim records a task asking the warm pool of its image for
+// a VM.
+func (e *Exporter) ObserveWarmPoolClaim(image string, hit bool) {
+	if e == nil {
+		return
+	}
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	e.warmPoolClaims.WithLabelValues(image, result).Inc()
+}
+
+// SetWarmPoolReady records the number of VMs waiting in the warm pool of
+// an image.
+func (e *Exporter) SetWarmPoolReady(image string, ready int) {
+	if e == nil {
+		return
+	}
+	e.warmPoolReady.WithLabelValues(image).Set(float64(ready))
+}
+
+// Handler returns the /metrics HTTP handler. Each request scrapes the
+// tracked VMs first, so values are as fresh as Firecracker's last flush.
+func (e *Exporter) Handler() http.Handler {
+	promHandler := promhttp.HandlerFor(e.registry, promhttp.HandlerOpts{})
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		e.Scrape()
+		promHandler.ServeHTTP(w, r)
+	})
+}
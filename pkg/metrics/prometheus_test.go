@@ -0,0 +1,82 @@
+package metrics
+
+import (
+	"errors"
+	"io"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExporter_VMMetrics(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "task-1.metrics")
+	require.NoError(t, os.WriteFile(path, []byte(fcFlush+"\n"), 0640))
+
+	e := NewExporter("node-1")
+	e.Track(TaskLabels{Task: "task-1", Service: "web"}, path)
+	e.Scrape()
+	e.Scrape() // no new flushes, no double counting
+
+	assert.Equal(t, 100.0, testutil.ToFloat64(e.netRxBytes.WithLabelValues("task-1", "web", "eth0")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(e.netFailures.WithLabelValues("task-1", "web", "eth0", "tx")))
+	assert.Equal(t, 4096.0, testutil.ToFloat64(e.blockReadBytes.WithLabelValues("task-1", "web", "rootfs")))
+	assert.Equal(t, 5.0, testutil.ToFloat64(e.vcpuExits.WithLabelValues("task-1", "web", "mmio_read")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(e.balloonFailures.WithLabelValues("task-1", "web")))
+	assert.Equal(t, 2.0, testutil.ToFloat64(e.seccompFaults.WithLabelValues("task-1", "web")))
+
+	e.Untrack("task-1")
+	assert.Zero(t, testutil.CollectAndCount(e.netRxBytes))
+	assert.Zero(t, testutil.CollectAndCount(e.seccompFaults))
+}
+
+func TestExporter_Handler(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "task-1.metrics")
+	e := NewExporter("node-1")
+	e.Track(TaskLabels{Task: "task-1", Service: "web"}, path)
+	e.ObservePrepare(2*time.Second, nil)
+	e.ObservePrepare(time.Second, errors.New("pull failed"))
+	e.ObserveBoot(150*time.Millisecond, nil)
+
+	// Written after Track: the handler scrapes before serving
+	require.NoError(t, os.WriteFile(path, []byte(fcFlush+"\n"), 0640))
+
+	rec := httptest.NewRecorder()
+	e.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body, err := io.ReadAll(rec.Body)
+	require.NoError(t, err)
+
+	out := string(body)
+	assert.Contains(t, out, `swarmcracker_vm_net_tx_bytes_total{device="eth0",node="node-1",service="web",task="task-1"} 40`)
+	assert.Contains(t, out, `swarmcracker_task_prepare_failures_total{node="node-1"} 1`)
+	assert.Contains(t, out, `swarmcracker_task_prepare_duration_seconds_count{node="node-1"} 1`)
+	assert.Contains(t, out, `swarmcracker_vm_boot_duration_seconds_count{node="node-1"} 1`)
+}
+
+func TestExporter_Nil(t *testing.T) {
+	var e *Exporter
+	e.Track(TaskLabels{Task: "task-1"}, "/nonexistent")
+	e.Scrape()
+	e.ObservePrepare(time.Second, nil)
+	e.ObserveBoot(time.Second, errors.New("boom"))
+	e.ObserveWarmPoolClaim("nginx:alpine", true)
+	e.SetWarmPoolReady("nginx:alpine", 2)
+	e.Untrack("task-1")
+}
+
+func TestExporter_WarmPool(t *testing.T) {
+	e := NewExporter("node-1")
+	e.ObserveWarmPoolClaim("nginx:alpine", false)
+	e.ObserveWarmPoolClaim("nginx:alpine", true)
+	e.ObserveWarmPoolClaim("nginx:alpine", true)
+	e.SetWarmPoolReady("nginx:alpine", 3)
+
+	assert.Equal(t, 2.0, testutil.ToFloat64(e.warmPoolClaims.WithLabelValues("nginx:alpine", "hit")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(e.warmPoolClaims.WithLabelValues("nginx:alpine", "miss")))
+	assert.Equal(t, 3.0, testutil.ToFloat64(e.warmPoolReady.WithLabelValues("nginx:alpine")))
+}
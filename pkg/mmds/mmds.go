@@ -0,0 +1,258 @@
+// Package mmds builds the metadata document served to guests by
+// Firecracker's microVM metadata service (MMDS) and manages it on a VM's
+// API socket.
+//
+// The document lives under the "swarmcracker" key of the metadata store.
+// Guests read it with the token-based MMDS v2 protocol:
+//
+//	TOKEN=$(curl -s -X PUT http://169.254.169.254/latest/api/token \
+//	    -H "X-metadata-token-ttl-seconds: 300")
+//	curl -s -H "X-metadata-token: $TOKEN" -H "Accept: application/json" \
+//	    http://169.254.169.254/swarmcracker
+package mmds
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/restuhaqza/swarmcracker/pkg/network"
+	"github.com/restuhaqza/swarmcracker/pkg/types"
+)
+
+// Label is the service label that turns the metadata service on ("true")
+// or off ("false") for a service, overriding the node default.
+const Label = "swarmcracker.mmds"
+
+// Address is the link-local address guests reach the metadata service on.
+const Address = "169.254.169.254"
+
+// Key is the top-level metadata store key holding the document.
+const Key = "swarmcracker"
+
+// Version is the document schema version. It changes only when fields are
+// removed or change meaning; new fields may be added within a version.
+const Version = 1
+
+// Document is the metadata served to a task's guest.
+type Document struct {
+	Version int     `json:"version"`
+	Task    Task    `json:"task"`
+	Service Service `json:"service"`
+	Node    Node    `json:"node"`
+	Network Network `json:"network"`
+	// Secrets and Configs are only set when the node includes them
+	Secrets []File `json:"secrets,omitempty"`
+	Configs []File `json:"configs,omitempty"`
+}
+
+// Task identifies the task.
+type Task struct {
+	ID    string `json:"id"`
+	Slot  uint64 `json:"slot,omitempty"`
+	Image string `json:"image,omitempty"`
+}
+
+// Service identifies the task's service.
+type Service struct {
+	ID     string            `json:"id"`
+	Name   string            `json:"name"`
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// Node identifies the node running the task.
+type Node struct {
+	ID       string `json:"id"`
+	Hostname string `json:"hostname,omitempty"`
+	// Peers are the node's VXLAN peers; they change while the task runs
+	Peers []string `json:"peers"`
+}
+
+// Network is the guest's network configuration.
+type Network struct {
+	Interfaces []Interface `json:"interfaces"`
+	Routes     []Route     `json:"routes"`
+}
+
+// Interface is a guest network interface.
+type Interface struct {
+	Name      string   `json:"name"`
+	MAC       string   `json:"mac"`
+	MTU       int      `json:"mtu"`
+	Addresses []string `json:"addresses"`
+}
+
+// Route is a guest route.
+type Route struct {
+	Destination string `json:"destination"`
+	Gateway     string `json:"gateway"`
+	Device      string `json:"device"`
+}
+
+// File is a secret or config. Data is base64 encoded in the document and
+// empty if the node has not received the payload.
+type File struct {
+	Name   string `json:"name"`
+	Target string `json:"target"`
+	Data   []byte `json:"data,omitempty"`
+}
+
+// Options are the node-level inputs of a document.
+type Options struct {
+	Hostname       string
+	Gateway        string
+	Peers          []string
+	IncludeSecrets bool
+	IncludeConfigs bool
+}
+
+// Enabled reports whether a service with the given labels gets the
+// metadata service. Services without the label use nodeDefault.
+func Enabled(nodeDefault bool, labels map[string]string) (bool, error) {
+	v, ok := labels[Label]
+	if !ok || v == "" {
+		return nodeDefault, nil
+	}
+	enabled, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, fmt.Errorf("label %s: invalid value %q, want true or false", Label, v)
+	}
+	return enabled, nil
+}
+
+// Build creates the document for a task whose networks are prepared.
+func Build(task *types.Task, opts Options) *Document {
+	doc := &Document{
+		Version: Version,
+		Task:    Task{ID: task.ID, Slot: task.Slot},
+		Service: Service{ID: task.ServiceID, Name: task.ServiceName, Labels: task.Labels},
+		Node:    Node{ID: task.NodeID, Hostname: opts.Hostname, Peers: []string{}},
+		Network: Network{Interfaces: []Interface{}, Routes: []Route{}},
+	}
+	if container, err := task.Spec.GetContainer(); err == nil {
+		doc.Task.Image = container.Image
+	}
+	doc.Node.Peers = append(doc.Node.Peers, opts.Peers...)
+
+	guest := network.BuildGuestNetworkConfig(task, opts.Gateway)
+	for _, iface := range guest.Interfaces {
+		addrs := append([]string{}, iface.Addresses...)
+		doc.Network.Interfaces = append(doc.Network.Interfaces, Interface{
+			Name: iface.Name, MAC: iface.MAC, MTU: iface.MTU, Addresses: addrs,
+		})
+	}
+	for _, r := range guest.Routes {
+		doc.Network.Routes = append(doc.Network.Routes, Route{
+			Destination: r.Destination, Gateway: r.Gateway, Device: r.Device,
+		})
+	}
+
+	if opts.IncludeSecrets {
+		for _, s := range task.Secrets {
+			doc.Secrets = append(doc.Secrets, File{Name: s.Name, Target: s.Target, Data: s.Data})
+		}
+	}
+	if opts.IncludeConfigs {
+		for _, c := range task.Configs {
+			doc.Configs = append(doc.Configs, File{Name: c.Name, Target: c.Target, Data: c.Data})
+		}
+	}
+	return doc
+}
+
+// Contents returns the metadata store contents holding doc (PUT /mmds).
+func Contents(doc *Document) map[string]interface{} {
+	return map[string]interface{}{Key: doc}
+}
+
+// Config returns the MMDS configuration (PUT /mmds/config) that serves
+// metadata with the v2 protocol on the given interfaces. It must be set
+// after the interfaces and before boot.
+func Config(ifaceIDs []string) map[string]interface{} {
+	return map[string]interface{}{
+		"version":            "V2",
+		"network_interfaces": ifaceIDs,
+		"ipv4_address":       Address,
+	}
+}
+
+// Client updates the metadata store of one VM's API socket.
+type Client struct {
+	http *http.Client
+}
+
+// NewClient creates a client for the Firecracker API at socketPath.
+func NewClient(socketPath string) *Client {
+	return &Client{http: &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", socketPath)
+			},
+		},
+		Timeout: 5 * time.Second,
+	}}
+}
+
+// Put replaces the VM's metadata with doc. It works before and after boot;
+// guests see the new document on their next request.
+func (c *Client) Put(ctx context.Context, doc *Document) error {
+	return c.do(ctx, http.MethodPut, Contents(doc), nil)
+}
+
+// Get returns the document currently served to the guest.
+func (c *Client) Get(ctx context.Context) (*Document, error) {
+	var contents struct {
+		Document *Document `json:"swarmcracker"`
+	}
+	if err := c.do(ctx, http.MethodGet, nil, &contents); err != nil {
+		return nil, err
+	}
+	if contents.Document == nil {
+		return nil, fmt.Errorf("metadata has no %s document", Key)
+	}
+	return contents.Document, nil
+}
+
+// do sends a request to /mmds and decodes the response into out, if set.
+func (c *Client) do(ctx context.Context, method string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to marshal metadata: %w", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, "http://localhost/mmds", reader)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s /mmds failed: %w", method, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("%s /mmds returned %d: %s", method, resp.StatusCode, bytes.TrimSpace(msg))
+	}
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return fmt.Errorf("failed to decode metadata: %w", err)
+		}
+	}
+	return nil
+}
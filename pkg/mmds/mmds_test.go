@@ -0,0 +1,182 @@
+package mmds
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/restuhaqza/swarmcracker/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEnabled(t *testing.T) {
+	tests := []struct {
+		name        string
+		nodeDefault bool
+		labels      map[string]string
+		want        bool
+		wantErr     bool
+	}{
+		{"node default off", false, nil, false, false},
+		{"node default on", true, nil, true, false},
+		{"label turns on", false, map[string]string{Label: "true"}, true, false},
+		{"label turns off", true, map[string]string{Label: "false"}, false, false},
+		{"empty label uses default", true, map[string]string{Label: ""}, true, false},
+		{"invalid label", true, map[string]string{Label: "maybe"}, false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Enabled(tt.nodeDefault, tt.labels)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func testTask() *types.Task {
+	return &types.Task{
+		ID:          "task-1",
+		ServiceID:   "svc-1",
+		ServiceName: "web",
+		Slot:        2,
+		NodeID:      "node-1",
+		Labels:      map[string]string{"tier": "frontend"},
+		Spec:        types.TaskSpec{Runtime: &types.Container{Image: "nginx:alpine"}},
+		Networks: []types.NetworkAttachment{{
+			Network:   types.Network{ID: "net-1", Spec: types.NetworkSpec{Driver: "bridge"}},
+			Addresses: []string{"192.168.127.5/24"},
+		}},
+		Secrets: []types.SecretRef{{ID: "s1", Name: "db_password", Target: "/run/secrets/db_password", Data: []byte("hunter2")}},
+		Configs: []types.ConfigRef{{ID: "c1", Name: "app", Target: "/config/app", Data: []byte("debug: true")}},
+	}
+}
+
+func TestBuild(t *testing.T) {
+	doc := Build(testTask(), Options{
+		Hostname: "worker-1",
+		Gateway:  "192.168.127.1",
+		Peers:    []string{"10.0.0.2"},
+	})
+
+	assert.Equal(t, Version, doc.Version)
+	assert.Equal(t, Task{ID: "task-1", Slot: 2, Image: "nginx:alpine"}, doc.Task)
+	assert.Equal(t, Service{ID: "svc-1", Name: "web", Labels: map[string]string{"tier": "frontend"}}, doc.Service)
+	assert.Equal(t, Node{ID: "node-1", Hostname: "worker-1", Peers: []string{"10.0.0.2"}}, doc.Node)
+
+	require.Len(t, doc.Network.Interfaces, 1)
+	iface := doc.Network.Interfaces[0]
+	assert.Equal(t, "eth0", iface.Name)
+	assert.Equal(t, []string{"192.168.127.5/24"}, iface.Addresses)
+	assert.NotEmpty(t, iface.MAC)
+	assert.Equal(t, []Route{{Destination: "default", Gateway: "192.168.127.1", Device: "eth0"}}, doc.Network.Routes)
+
+	// Payloads are left out unless the node includes them
+	assert.Nil(t, doc.Secrets)
+	assert.Nil(t, doc.Configs)
+}
+
+func TestBuild_Payloads(t *testing.T) {
+	doc := Build(testTask(), Options{IncludeSecrets: true, IncludeConfigs: true})
+
+	assert.Equal(t, []File{{Name: "db_password", Target: "/run/secrets/db_password", Data: []byte("hunter2")}}, doc.Secrets)
+	assert.Equal(t, []File{{Name: "app", Target: "/config/app", Data: []byte("debug: true")}}, doc.Configs)
+
+	// Payloads are base64 encoded in the document
+	data, err := json.Marshal(Contents(doc))
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"data":"aHVudGVyMg=="`)
+}
+
+func TestBuild_NoNetworks(t *testing.T) {
+	doc := Build(&types.Task{ID: "task-1"}, Options{})
+
+	// Lists are always present so guests need not handle nulls
+	data, err := json.Marshal(doc)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"peers":[]`)
+	assert.Contains(t, string(data), `"interfaces":[]`)
+	assert.Contains(t, string(data), `"routes":[]`)
+}
+
+func TestConfig(t *testing.T) {
+	assert.Equal(t, map[string]interface{}{
+		"version":            "V2",
+		"network_interfaces": []string{"eth0"},
+		"ipv4_address":       "169.254.169.254",
+	}, Config([]string{"eth0"}))
+}
+
+// startFirecracker serves a fake metadata store on a unix socket
+func startFirecracker(t *testing.T) string {
+	t.Helper()
+	var mu sync.Mutex
+	var store []byte
+
+	socketPath := filepath.Join(t.TempDir(), "fc.sock")
+	l, err := net.Listen("unix", socketPath)
+	require.NoError(t, err)
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch {
+		case r.URL.Path != "/mmds":
+			http.Error(w, `{"fault_message":"not found"}`, http.StatusBadRequest)
+		case r.Method == http.MethodPut:
+			store, _ = io.ReadAll(r.Body)
+			w.WriteHeader(http.StatusNoContent)
+		case r.Method == http.MethodGet:
+			if store == nil {
+				store = []byte("{}")
+			}
+			w.Write(store)
+		}
+	})}
+	go srv.Serve(l)
+	t.Cleanup(func() { srv.Close() })
+	return socketPath
+}
+
+func TestClient(t *testing.T) {
+	client := NewClient(startFirecracker(t))
+	ctx := context.Background()
+
+	_, err := client.Get(ctx)
+	assert.Error(t, err, "empty store has no document")
+
+	doc := Build(testTask(), Options{Peers: []string{"10.0.0.2"}})
+	require.NoError(t, client.Put(ctx, doc))
+
+	doc.Node.Peers = []string{"10.0.0.2", "10.0.0.3"}
+	require.NoError(t, client.Put(ctx, doc))
+
+	got, err := client.Get(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, doc, got)
+}
+
+func TestClient_Error(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "fc.sock")
+	l, err := net.Listen("unix", socketPath)
+	require.NoError(t, err)
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"fault_message":"MMDS not configured"}`, http.StatusBadRequest)
+	})}
+	go srv.Serve(l)
+	defer srv.Close()
+
+	err = NewClient(socketPath).Put(context.Background(), &Document{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "400")
+	assert.Contains(t, err.Error(), "not configured")
+}
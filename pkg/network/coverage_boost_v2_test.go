@@ -442,7 +442,7 @@ func TestPrepareNetworkWithCNI_EmptyNetworkName_UsesIDPrefix(t *testing.T) {
 		},
 	}
 
-	err := nm.prepareNetworkWithCNI(context.Background(), task)
+	err := nm.prepareNetworkWithCNI(context.Background(), task, nil, nil)
 	// Will fail because CNI binary doesn't exist, but covers the ID[:8] branch
 	require.Error(t, err)
 	assert.Contains(t, err.Error(), "CNI ADD failed")
@@ -467,7 +467,7 @@ func TestPrepareNetworkWithCNI_NoAddresses_UsesFallback(t *testing.T) {
 		},
 	}
 
-	err := nm.prepareNetworkWithCNI(context.Background(), task)
+	err := nm.prepareNetworkWithCNI(context.Background(), task, nil, nil)
 	// In test environment without TAP tools, expect TAP creation error
 	// In production with proper tools, this would succeed with fallback
 	if err != nil {
@@ -496,7 +496,7 @@ func TestPrepareNetworkWithCNI_AddNetworkFails_CoversErrorPath(t *testing.T) {
 		},
 	}
 
-	err := nm.prepareNetworkWithCNI(context.Background(), task)
+	err := nm.prepareNetworkWithCNI(context.Background(), task, nil, nil)
 	require.Error(t, err)
 	assert.Contains(t, err.Error(), "CNI ADD failed")
 }
@@ -528,7 +528,7 @@ func TestPrepareNetworkWithCNI_MultipleNetworks_CoversLoop(t *testing.T) {
 		},
 	}
 
-	err := nm.prepareNetworkWithCNI(context.Background(), task)
+	err := nm.prepareNetworkWithCNI(context.Background(), task, nil, nil)
 	// First network will fail, covering multiple iterations
 	require.Error(t, err)
 }
@@ -0,0 +1,612 @@
+// Package network provides the built-in DHCPv4 server for VM bridges.
+
+package network
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/restuhaqza/swarmcracker/pkg/statefile"
+	"github.com/rs/zerolog/log"
+)
+
+// DHCP message types (RFC 2132, option 53).
+const (
+	dhcpDiscover = 1
+	dhcpOffer    = 2
+	dhcpRequest  = 3
+	dhcpDecline  = 4
+	dhcpAck      = 5
+	dhcpNak      = 6
+	dhcpRelease  = 7
+	dhcpInform   = 8
+)
+
+// DHCP options used by the server.
+const (
+	optPad         = 0
+	optSubnetMask  = 1
+	optRouter      = 3
+	optDNS         = 6
+	optHostname    = 12
+	optMTU         = 26
+	optRequestedIP = 50
+	optLeaseTime   = 51
+	optMessageType = 53
+	optServerID    = 54
+	optRenewalT1   = 58
+	optRebindT2    = 59
+	optEnd         = 255
+)
+
+const (
+	dhcpServerPort = 67
+	dhcpClientPort = 68
+
+	// dhcpHeaderLen is the fixed BOOTP header before the magic cookie.
+	dhcpHeaderLen = 236
+
+	// DefaultLeaseTime is the lease duration handed to guests. Leases are
+	// static per task, so this only controls how often guests renew.
+	DefaultLeaseTime = 12 * time.Hour
+)
+
+var dhcpMagicCookie = []byte{99, 130, 83, 99}
+
+// dhcpMessage is a decoded DHCPv4 packet.
+type dhcpMessage struct {
+	Op      byte
+	Xid     uint32
+	Secs    uint16
+	Flags   uint16
+	CIAddr  net.IP
+	YIAddr  net.IP
+	SIAddr  net.IP
+	GIAddr  net.IP
+	CHAddr  net.HardwareAddr
+	Options map[byte][]byte
+}
+
+func (m *dhcpMessage) messageType() byte {
+	if v := m.Options[optMessageType]; len(v) == 1 {
+		return v[0]
+	}
+	return 0
+}
+
+// parseDHCPMessage decodes a DHCPv4 packet.
+func parseDHCPMessage(data []byte) (*dhcpMessage, error) {
+	if len(data) < dhcpHeaderLen+len(dhcpMagicCookie) {
+		return nil, fmt.Errorf("packet too short: %d bytes", len(data))
+	}
+	if string(data[dhcpHeaderLen:dhcpHeaderLen+4]) != string(dhcpMagicCookie) {
+		return nil, fmt.Errorf("missing DHCP magic cookie")
+	}
+
+	hlen := int(data[2])
+	if hlen > 16 {
+		return nil, fmt.Errorf("invalid hardware address length %d", hlen)
+	}
+
+	m := &dhcpMessage{
+		Op:      data[0],
+		Xid:     binary.BigEndian.Uint32(data[4:8]),
+		Secs:    binary.BigEndian.Uint16(data[8:10]),
+		Flags:   binary.BigEndian.Uint16(data[10:12]),
+		CIAddr:  net.IP(append([]byte(nil), data[12:16]...)),
+		YIAddr:  net.IP(append([]byte(nil), data[16:20]...)),
+		SIAddr:  net.IP(append([]byte(nil), data[20:24]...)),
+		GIAddr:  net.IP(append([]byte(nil), data[24:28]...)),
+		CHAddr:  net.HardwareAddr(append([]byte(nil), data[28:28+hlen]...)),
+		Options: make(map[byte][]byte),
+	}
+
+	opts := data[dhcpHeaderLen+4:]
+	for i := 0; i < len(opts); {
+		code := opts[i]
+		if code == optEnd {
+			break
+		}
+		if code == optPad {
+			i++
+			continue
+		}
+		if i+1 >= len(opts) {
+			return nil, fmt.Errorf("truncated option %d", code)
+		}
+		length := int(opts[i+1])
+		if i+2+length > len(opts) {
+			return nil, fmt.Errorf("truncated option %d", code)
+		}
+		m.Options[code] = append(m.Options[code], opts[i+2:i+2+length]...)
+		i += 2 + length
+	}
+
+	return m, nil
+}
+
+// marshal encodes the message. Options are written in ascending order with
+// the message type first, which some clients expect.
+func (m *dhcpMessage) marshal() []byte {
+	buf := make([]byte, dhcpHeaderLen, 548)
+	buf[0] = m.Op
+	buf[1] = 1 // Ethernet
+	buf[2] = byte(len(m.CHAddr))
+	binary.BigEndian.PutUint32(buf[4:8], m.Xid)
+	binary.BigEndian.PutUint16(buf[8:10], m.Secs)
+	binary.BigEndian.PutUint16(buf[10:12], m.Flags)
+	copy(buf[12:16], m.CIAddr.To4())
+	copy(buf[16:20], m.YIAddr.To4())
+	copy(buf[20:24], m.SIAddr.To4())
+	copy(buf[24:28], m.GIAddr.To4())
+	copy(buf[28:44], m.CHAddr)
+	buf = append(buf, dhcpMagicCookie...)
+
+	if t, ok := m.Options[optMessageType]; ok {
+		buf = append(buf, optMessageType, byte(len(t)))
+		buf = append(buf, t...)
+	}
+	codes := make([]int, 0, len(m.Options))
+	for code := range m.Options {
+		if code != optMessageType {
+			codes = append(codes, int(code))
+		}
+	}
+	sort.Ints(codes)
+	for _, code := range codes {
+		value := m.Options[byte(code)]
+		buf = append(buf, byte(code), byte(len(value)))
+		buf = append(buf, value...)
+	}
+	buf = append(buf, optEnd)
+
+	// BOOTP minimum message size
+	for len(buf) < 300 {
+		buf = append(buf, optPad)
+	}
+	return buf
+}
+
+// DHCPLease is a fixed address handed to one guest interface.
+type DHCPLease struct {
+	TaskID   string `json:"task_id"`
+	MAC      string `json:"mac"`
+	IP       string `json:"ip"`
+	Netmask  string `json:"netmask"`
+	Gateway  string `json:"gateway,omitempty"`
+	Hostname string `json:"hostname,omitempty"`
+	MTU      int    `json:"mtu,omitempty"`
+	Bridge   string `json:"bridge,omitempty"` // Empty serves the lease on any bridge
+}
+
+// DHCPServer answers DHCPv4 requests on the node bridge, and on the bridges
+// added with AddBridge, with the leases registered by the network manager.
+// It never allocates on its own: addresses come from IPAllocator (or
+// SwarmKit), so static and DHCP configuration always agree.
+type DHCPServer struct {
+	serverIP  net.IP
+	dns       []net.IP // Empty hands out each bridge's own address
+	leaseFile string   // Empty disables persistence
+	bridge    string   // The bridge Start serves as serverIP
+
+	mu     sync.RWMutex
+	leases map[string]*DHCPLease // keyed by lower-case MAC
+	ports  map[string]*dhcpPort  // keyed by bridge
+	saveMu sync.Mutex
+}
+
+// dhcpPort is a bridge the server answers on, as serverIP.
+type dhcpPort struct {
+	bridge   string
+	serverIP net.IP
+	cancel   context.CancelFunc
+	done     chan struct{}
+}
+
+// listenDHCP opens the server socket on a bridge - overridable for testing
+var listenDHCP = func(ctx context.Context, bridge string) (net.PacketConn, error) {
+	lc := net.ListenConfig{
+		Control: func(network, address string, c syscall.RawConn) error {
+			var sockErr error
+			err := c.Control(func(fd uintptr) {
+				if sockErr = syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_REUSEADDR, 1); sockErr != nil {
+					return
+				}
+				if sockErr = syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_BROADCAST, 1); sockErr != nil {
+					return
+				}
+				// Clients have no address yet, so bind to the device rather than an IP
+				sockErr = syscall.BindToDevice(int(fd), bridge)
+			})
+			if err != nil {
+				return err
+			}
+			return sockErr
+		},
+	}
+	return lc.ListenPacket(ctx, "udp4", fmt.Sprintf("0.0.0.0:%d", dhcpServerPort))
+}
+
+// NewDHCPServer creates a DHCP server answering as serverIP. DNS servers
+// default to the address the server answers as on each bridge, where the
+// DNS forwarder of the bridge listens.
+func NewDHCPServer(serverIP net.IP, dns []net.IP, leaseFile string) *DHCPServer {
+	return &DHCPServer{
+		serverIP:  serverIP.To4(),
+		dns:       dns,
+		leaseFile: leaseFile,
+		leases:    make(map[string]*DHCPLease),
+		ports:     make(map[string]*dhcpPort),
+	}
+}
+
+// AddLease registers or replaces the lease for a MAC address. Any other
+// lease holding the same IP is dropped, so a stale lease can never shadow a
+// fresh allocation.
+func (s *DHCPServer) AddLease(lease DHCPLease) error {
+	mac, err := net.ParseMAC(lease.MAC)
+	if err != nil {
+		return fmt.Errorf("invalid MAC %q: %w", lease.MAC, err)
+	}
+	if net.ParseIP(lease.IP).To4() == nil {
+		return fmt.Errorf("invalid IPv4 address %q", lease.IP)
+	}
+	if net.ParseIP(lease.Netmask).To4() == nil {
+		return fmt.Errorf("invalid netmask %q", lease.Netmask)
+	}
+	lease.MAC = mac.String()
+
+	s.mu.Lock()
+	for key, l := range s.leases {
+		if l.IP == lease.IP && key != lease.MAC {
+			delete(s.leases, key)
+		}
+	}
+	s.leases[lease.MAC] = &lease
+	s.mu.Unlock()
+
+	return s.save()
+}
+
+// RemoveTask drops every lease owned by a task.
+func (s *DHCPServer) RemoveTask(taskID string) error {
+	s.mu.Lock()
+	removed := false
+	for key, l := range s.leases {
+		if l.TaskID == taskID {
+			delete(s.leases, key)
+			removed = true
+		}
+	}
+	s.mu.Unlock()
+
+	if !removed {
+		return nil
+	}
+	return s.save()
+}
+
+// Prune drops the leases of tasks isRunning reports as gone and returns how
+// many it dropped.
+func (s *DHCPServer) Prune(isRunning func(taskID string) bool) (int, error) {
+	s.mu.Lock()
+	pruned := 0
+	for key, l := range s.leases {
+		if !isRunning(l.TaskID) {
+			delete(s.leases, key)
+			pruned++
+		}
+	}
+	s.mu.Unlock()
+
+	if pruned == 0 {
+		return 0, nil
+	}
+	return pruned, s.save()
+}
+
+// Leases returns a snapshot of the current leases sorted by IP.
+func (s *DHCPServer) Leases() []DHCPLease {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	leases := make([]DHCPLease, 0, len(s.leases))
+	for _, l := range s.leases {
+		leases = append(leases, *l)
+	}
+	sort.Slice(leases, func(i, j int) bool { return leases[i].IP < leases[j].IP })
+	return leases
+}
+
+// Load restores leases persisted by a previous run. A missing file is not an error.
+func (s *DHCPServer) Load() error {
+	if s.leaseFile == "" {
+		return nil
+	}
+	data, err := os.ReadFile(s.leaseFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read lease file: %w", err)
+	}
+
+	var leases []DHCPLease
+	if err := json.Unmarshal(data, &leases); err != nil {
+		return fmt.Errorf("failed to parse lease file: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range leases {
+		l := leases[i]
+		s.leases[l.MAC] = &l
+	}
+	return nil
+}
+
+// save writes the leases atomically.
+func (s *DHCPServer) save() error {
+	if s.leaseFile == "" {
+		return nil
+	}
+	s.saveMu.Lock()
+	defer s.saveMu.Unlock()
+
+	data, err := json.MarshalIndent(s.Leases(), "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal leases: %w", err)
+	}
+	return statefile.Write(s.leaseFile, data, 0640)
+}
+
+// Handle computes the reply to a request arriving on the node bridge, or
+// nil if the request should be ignored (unknown client, another server's
+// transaction, release).
+func (s *DHCPServer) Handle(req *dhcpMessage) *dhcpMessage {
+	return s.handle(req, &dhcpPort{bridge: s.bridge, serverIP: s.serverIP})
+}
+
+// handle computes the reply to a request arriving on port. Leases of other
+// bridges are not served there.
+func (s *DHCPServer) handle(req *dhcpMessage, port *dhcpPort) *dhcpMessage {
+	if req.Op != 1 || len(req.CHAddr) != 6 {
+		return nil
+	}
+
+	// Only answer the server the client selected
+	if id, ok := req.Options[optServerID]; ok && !net.IP(id).Equal(port.serverIP) {
+		return nil
+	}
+
+	s.mu.RLock()
+	lease, ok := s.leases[req.CHAddr.String()]
+	var l DHCPLease
+	if ok {
+		l = *lease
+		ok = l.Bridge == "" || l.Bridge == port.bridge
+	}
+	s.mu.RUnlock()
+
+	msgType := req.messageType()
+	switch msgType {
+	case dhcpDiscover:
+		if !ok {
+			return nil
+		}
+		return s.reply(req, port, dhcpOffer, &l)
+
+	case dhcpRequest:
+		if !ok {
+			return nil
+		}
+		requested := net.IP(req.Options[optRequestedIP])
+		if len(requested) != 4 {
+			requested = req.CIAddr
+		}
+		if !requested.Equal(net.ParseIP(l.IP)) {
+			return s.reply(req, port, dhcpNak, nil)
+		}
+		return s.reply(req, port, dhcpAck, &l)
+
+	case dhcpInform:
+		if !ok {
+			return nil
+		}
+		reply := s.reply(req, port, dhcpAck, &l)
+		reply.YIAddr = net.IPv4zero
+		delete(reply.Options, optLeaseTime)
+		delete(reply.Options, optRenewalT1)
+		delete(reply.Options, optRebindT2)
+		return reply
+
+	case dhcpRelease, dhcpDecline:
+		// Leases are tied to the task lifetime, not to the client
+		return nil
+	}
+
+	return nil
+}
+
+// reply builds a response of the given type sent from port.
+func (s *DHCPServer) reply(req *dhcpMessage, port *dhcpPort, msgType byte, lease *DHCPLease) *dhcpMessage {
+	reply := &dhcpMessage{
+		Op:     2,
+		Xid:    req.Xid,
+		Flags:  req.Flags,
+		CIAddr: req.CIAddr,
+		YIAddr: net.IPv4zero,
+		SIAddr: port.serverIP,
+		GIAddr: req.GIAddr,
+		CHAddr: req.CHAddr,
+		Options: map[byte][]byte{
+			optMessageType: {msgType},
+			optServerID:    port.serverIP,
+		},
+	}
+	if lease == nil {
+		reply.SIAddr = net.IPv4zero
+		return reply
+	}
+
+	reply.YIAddr = net.ParseIP(lease.IP).To4()
+	reply.Options[optSubnetMask] = net.ParseIP(lease.Netmask).To4()
+	if gw := net.ParseIP(lease.Gateway).To4(); gw != nil {
+		reply.Options[optRouter] = gw
+	}
+	servers := s.dns
+	if len(servers) == 0 {
+		servers = []net.IP{port.serverIP}
+	}
+	var dns []byte
+	for _, ip := range servers {
+		dns = append(dns, ip.To4()...)
+	}
+	if len(dns) > 0 {
+		reply.Options[optDNS] = dns
+	}
+	if lease.Hostname != "" {
+		reply.Options[optHostname] = []byte(lease.Hostname)
+	}
+	if lease.MTU > 0 {
+		reply.Options[optMTU] = binary.BigEndian.AppendUint16(nil, uint16(lease.MTU))
+	}
+	seconds := uint32(DefaultLeaseTime / time.Second)
+	reply.Options[optLeaseTime] = binary.BigEndian.AppendUint32(nil, seconds)
+	reply.Options[optRenewalT1] = binary.BigEndian.AppendUint32(nil, seconds/2)
+	reply.Options[optRebindT2] = binary.BigEndian.AppendUint32(nil, seconds/8*7)
+	return reply
+}
+
+// Start binds to the node bridge and serves requests until Stop is called.
+func (s *DHCPServer) Start(ctx context.Context, bridge string) error {
+	if err := s.Load(); err != nil {
+		log.Warn().Err(err).Msg("Failed to restore DHCP leases")
+	}
+
+	s.bridge = bridge
+	return s.AddBridge(ctx, bridge, s.serverIP)
+}
+
+// AddBridge serves the leases of another bridge on it, answering as
+// serverIP, the bridge's gateway, until RemoveBridge or Stop is called.
+// A bridge already served is left alone.
+func (s *DHCPServer) AddBridge(ctx context.Context, bridge string, serverIP net.IP) error {
+	s.mu.RLock()
+	_, ok := s.ports[bridge]
+	s.mu.RUnlock()
+	if ok {
+		return nil
+	}
+
+	conn, err := listenDHCP(ctx, bridge)
+	if err != nil {
+		return fmt.Errorf("failed to listen for DHCP on %s: %w", bridge, err)
+	}
+	s.serve(ctx, conn, &dhcpPort{bridge: bridge, serverIP: serverIP.To4()})
+	return nil
+}
+
+// RemoveBridge stops serving a bridge added with AddBridge.
+func (s *DHCPServer) RemoveBridge(bridge string) {
+	s.mu.Lock()
+	port, ok := s.ports[bridge]
+	delete(s.ports, bridge)
+	s.mu.Unlock()
+
+	if ok {
+		port.cancel()
+		<-port.done
+	}
+}
+
+// Serve answers requests arriving on conn, from the node bridge, in the
+// background.
+func (s *DHCPServer) Serve(ctx context.Context, conn net.PacketConn) error {
+	s.serve(ctx, conn, &dhcpPort{bridge: s.bridge, serverIP: s.serverIP})
+	return nil
+}
+
+// serve answers requests arriving on conn as port in the background.
+func (s *DHCPServer) serve(ctx context.Context, conn net.PacketConn, port *dhcpPort) {
+	ctx, port.cancel = context.WithCancel(ctx)
+	port.done = make(chan struct{})
+
+	s.mu.Lock()
+	s.ports[port.bridge] = port
+	s.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+
+	go func() {
+		defer close(port.done)
+		buf := make([]byte, 1500)
+		for {
+			n, _, err := conn.ReadFrom(buf)
+			if err != nil {
+				if ctx.Err() == nil {
+					log.Warn().Err(err).Str("bridge", port.bridge).Msg("DHCP server read failed")
+				}
+				return
+			}
+			s.serveOne(conn, port, buf[:n])
+		}
+	}()
+}
+
+func (s *DHCPServer) serveOne(conn net.PacketConn, port *dhcpPort, data []byte) {
+	req, err := parseDHCPMessage(data)
+	if err != nil {
+		log.Debug().Err(err).Msg("Ignoring malformed DHCP packet")
+		return
+	}
+
+	reply := s.handle(req, port)
+	if reply == nil {
+		return
+	}
+
+	// Clients without an address can only receive broadcasts
+	dest := &net.UDPAddr{IP: net.IPv4bcast, Port: dhcpClientPort}
+	if !req.CIAddr.Equal(net.IPv4zero) {
+		dest.IP = req.CIAddr
+	}
+
+	if _, err := conn.WriteTo(reply.marshal(), dest); err != nil {
+		log.Warn().Err(err).Str("mac", req.CHAddr.String()).Msg("Failed to send DHCP reply")
+		return
+	}
+
+	log.Debug().
+		Str("mac", req.CHAddr.String()).
+		Str("ip", reply.YIAddr.String()).
+		Uint8("type", reply.messageType()).
+		Msg("DHCP reply sent")
+}
+
+// Stop closes the sockets of every bridge and waits for the server loops
+// to exit.
+func (s *DHCPServer) Stop() {
+	s.mu.RLock()
+	bridges := make([]string, 0, len(s.ports))
+	for bridge := range s.ports {
+		bridges = append(bridges, bridge)
+	}
+	s.mu.RUnlock()
+
+	for _, bridge := range bridges {
+		s.RemoveBridge(bridge)
+	}
+}
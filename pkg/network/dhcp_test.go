@@ -0,0 +1,311 @@
+package network
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/restuhaqza/swarmcracker/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testMAC = "aa:fc:00:00:00:01"
+
+func testLease() DHCPLease {
+	return DHCPLease{
+		TaskID:   "task-1",
+		MAC:      testMAC,
+		IP:       "192.168.127.10",
+		Netmask:  "255.255.255.0",
+		Gateway:  "192.168.127.1",
+		Hostname: "task-1",
+		MTU:      1500,
+	}
+}
+
+func testRequest(msgType byte, mac string, opts map[byte][]byte) *dhcpMessage {
+	hw, _ := net.ParseMAC(mac)
+	req := &dhcpMessage{
+		Op:      1,
+		Xid:     0xdeadbeef,
+		CIAddr:  net.IPv4zero.To4(),
+		YIAddr:  net.IPv4zero.To4(),
+		SIAddr:  net.IPv4zero.To4(),
+		GIAddr:  net.IPv4zero.To4(),
+		CHAddr:  hw,
+		Options: map[byte][]byte{optMessageType: {msgType}},
+	}
+	for code, value := range opts {
+		req.Options[code] = value
+	}
+	return req
+}
+
+func newTestDHCPServer(t *testing.T) *DHCPServer {
+	s := NewDHCPServer(net.ParseIP("192.168.127.1"), nil, "")
+	require.NoError(t, s.AddLease(testLease()))
+	return s
+}
+
+func TestDHCPMessage_RoundTrip(t *testing.T) {
+	req := testRequest(dhcpDiscover, testMAC, map[byte][]byte{
+		optHostname: []byte("guest"),
+	})
+
+	data := req.marshal()
+	assert.GreaterOrEqual(t, len(data), 300)
+
+	got, err := parseDHCPMessage(data)
+	require.NoError(t, err)
+	assert.Equal(t, req.Xid, got.Xid)
+	assert.Equal(t, req.CHAddr, got.CHAddr)
+	assert.Equal(t, byte(dhcpDiscover), got.messageType())
+	assert.Equal(t, []byte("guest"), got.Options[optHostname])
+}
+
+func TestParseDHCPMessage_Invalid(t *testing.T) {
+	valid := testRequest(dhcpDiscover, testMAC, nil).marshal()
+
+	noCookie := append([]byte(nil), valid...)
+	noCookie[dhcpHeaderLen] = 0
+
+	truncated := append([]byte(nil), valid[:dhcpHeaderLen+4]...)
+	truncated = append(truncated, optHostname, 10, 'a')
+
+	badHlen := append([]byte(nil), valid...)
+	badHlen[2] = 32
+
+	for name, data := range map[string][]byte{
+		"too short":        valid[:100],
+		"no magic cookie":  noCookie,
+		"truncated option": truncated,
+		"bad hlen":         badHlen,
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := parseDHCPMessage(data)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestDHCPServer_Handle(t *testing.T) {
+	serverID := net.ParseIP("192.168.127.1").To4()
+	otherServer := net.ParseIP("192.168.127.254").To4()
+	leaseIP := net.ParseIP("192.168.127.10").To4()
+	wrongIP := net.ParseIP("192.168.127.99").To4()
+
+	tests := []struct {
+		name     string
+		req      *dhcpMessage
+		wantType byte // 0 means no reply
+		wantIP   net.IP
+	}{
+		{"discover known MAC", testRequest(dhcpDiscover, testMAC, nil), dhcpOffer, leaseIP},
+		{"discover unknown MAC", testRequest(dhcpDiscover, "aa:fc:00:00:00:02", nil), 0, nil},
+		{"request leased IP", testRequest(dhcpRequest, testMAC, map[byte][]byte{optRequestedIP: leaseIP, optServerID: serverID}), dhcpAck, leaseIP},
+		{"request other IP", testRequest(dhcpRequest, testMAC, map[byte][]byte{optRequestedIP: wrongIP}), dhcpNak, net.IPv4zero.To4()},
+		{"request for other server", testRequest(dhcpRequest, testMAC, map[byte][]byte{optRequestedIP: leaseIP, optServerID: otherServer}), 0, nil},
+		{"inform", testRequest(dhcpInform, testMAC, nil), dhcpAck, net.IPv4zero},
+		{"release", testRequest(dhcpRelease, testMAC, nil), 0, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestDHCPServer(t)
+
+			reply := s.Handle(tt.req)
+			if tt.wantType == 0 {
+				assert.Nil(t, reply)
+				return
+			}
+			require.NotNil(t, reply)
+			assert.Equal(t, tt.wantType, reply.messageType())
+			assert.Equal(t, tt.req.Xid, reply.Xid)
+			assert.True(t, tt.wantIP.Equal(reply.YIAddr), "yiaddr %s", reply.YIAddr)
+			assert.Equal(t, []byte(serverID), reply.Options[optServerID])
+		})
+	}
+}
+
+func TestDHCPServer_HandleOptions(t *testing.T) {
+	s := newTestDHCPServer(t)
+
+	reply := s.Handle(testRequest(dhcpDiscover, testMAC, nil))
+	require.NotNil(t, reply)
+
+	assert.Equal(t, []byte{255, 255, 255, 0}, reply.Options[optSubnetMask])
+	assert.Equal(t, []byte{192, 168, 127, 1}, reply.Options[optRouter])
+	assert.Equal(t, []byte{192, 168, 127, 1}, reply.Options[optDNS])
+	assert.Equal(t, []byte("task-1"), reply.Options[optHostname])
+	assert.Equal(t, uint16(1500), binary.BigEndian.Uint16(reply.Options[optMTU]))
+	assert.Equal(t, uint32(DefaultLeaseTime/time.Second), binary.BigEndian.Uint32(reply.Options[optLeaseTime]))
+
+	inform := s.Handle(testRequest(dhcpInform, testMAC, nil))
+	require.NotNil(t, inform)
+	assert.NotContains(t, inform.Options, byte(optLeaseTime))
+}
+
+func TestDHCPServer_AddLease(t *testing.T) {
+	s := newTestDHCPServer(t)
+
+	// A new MAC taking over the IP replaces the stale lease
+	moved := testLease()
+	moved.TaskID = "task-2"
+	moved.MAC = "AA:FC:00:00:00:02"
+	require.NoError(t, s.AddLease(moved))
+
+	leases := s.Leases()
+	require.Len(t, leases, 1)
+	assert.Equal(t, "task-2", leases[0].TaskID)
+	assert.Equal(t, "aa:fc:00:00:00:02", leases[0].MAC)
+
+	invalid := []func(l *DHCPLease){
+		func(l *DHCPLease) { l.MAC = "bogus" },
+		func(l *DHCPLease) { l.IP = "fd00::1" },
+		func(l *DHCPLease) { l.Netmask = "" },
+	}
+	for _, mutate := range invalid {
+		l := testLease()
+		mutate(&l)
+		assert.Error(t, s.AddLease(l))
+	}
+
+	require.NoError(t, s.RemoveTask("task-2"))
+	assert.Empty(t, s.Leases())
+}
+
+func TestDHCPServer_Prune(t *testing.T) {
+	leaseFile := filepath.Join(t.TempDir(), "dhcp-leases.json")
+	s := NewDHCPServer(net.ParseIP("192.168.127.1"), nil, leaseFile)
+	require.NoError(t, s.AddLease(testLease()))
+	gone := testLease()
+	gone.TaskID = "task-2"
+	gone.MAC = "AA:FC:00:00:00:02"
+	gone.IP = "192.168.127.11"
+	require.NoError(t, s.AddLease(gone))
+
+	pruned, err := s.Prune(func(taskID string) bool { return taskID == "task-1" })
+	require.NoError(t, err)
+	assert.Equal(t, 1, pruned)
+
+	restored := NewDHCPServer(net.ParseIP("192.168.127.1"), nil, leaseFile)
+	require.NoError(t, restored.Load())
+	leases := restored.Leases()
+	require.Len(t, leases, 1)
+	assert.Equal(t, "task-1", leases[0].TaskID)
+
+	pruned, err = s.Prune(func(string) bool { return true })
+	require.NoError(t, err)
+	assert.Zero(t, pruned)
+}
+
+func TestNetworkManager_ReconcileDHCP(t *testing.T) {
+	stateDir := t.TempDir()
+	s := NewDHCPServer(net.ParseIP("192.168.127.1"), nil, filepath.Join(stateDir, "dhcp-leases.json"))
+	require.NoError(t, s.AddLease(testLease()))
+
+	// The server has not started yet, so the persisted leases are pruned
+	nm := NewNetworkManager(types.NetworkConfig{BridgeName: "testbr0", StateDir: stateDir}).(*NetworkManager)
+	assert.Zero(t, nm.ReconcileDHCP(func(string) bool { return true }))
+	assert.Equal(t, 1, nm.ReconcileDHCP(func(string) bool { return false }))
+
+	restored := NewDHCPServer(net.ParseIP("192.168.127.1"), nil, filepath.Join(stateDir, "dhcp-leases.json"))
+	require.NoError(t, restored.Load())
+	assert.Empty(t, restored.Leases())
+
+	// Without a state directory there is nothing to prune
+	bare := NewNetworkManager(types.NetworkConfig{BridgeName: "testbr0"}).(*NetworkManager)
+	assert.Zero(t, bare.ReconcileDHCP(func(string) bool { return false }))
+}
+
+func TestDHCPServer_Persistence(t *testing.T) {
+	leaseFile := filepath.Join(t.TempDir(), "network", "dhcp-leases.json")
+
+	s := NewDHCPServer(net.ParseIP("192.168.127.1"), nil, leaseFile)
+	require.NoError(t, s.AddLease(testLease()))
+	_, err := os.Stat(leaseFile)
+	require.NoError(t, err)
+
+	restored := NewDHCPServer(net.ParseIP("192.168.127.1"), nil, leaseFile)
+	require.NoError(t, restored.Load())
+	assert.Equal(t, s.Leases(), restored.Leases())
+
+	require.NoError(t, restored.RemoveTask("task-1"))
+	again := NewDHCPServer(net.ParseIP("192.168.127.1"), nil, leaseFile)
+	require.NoError(t, again.Load())
+	assert.Empty(t, again.Leases())
+
+	// Missing file is not an error, corrupt file is
+	require.NoError(t, NewDHCPServer(net.ParseIP("192.168.127.1"), nil, leaseFile+".missing").Load())
+	require.NoError(t, os.WriteFile(leaseFile, []byte("{"), 0640))
+	assert.Error(t, again.Load())
+}
+
+// recordingConn captures replies written by the server.
+type recordingConn struct {
+	net.PacketConn
+	data []byte
+	dest net.Addr
+}
+
+func (c *recordingConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	c.data = append([]byte(nil), b...)
+	c.dest = addr
+	return len(b), nil
+}
+
+func TestDHCPServer_ServeOne(t *testing.T) {
+	tests := []struct {
+		name     string
+		ciaddr   net.IP
+		wantDest string
+	}{
+		{"unconfigured client gets broadcast", net.IPv4zero.To4(), "255.255.255.255:68"},
+		{"renewing client gets unicast", net.ParseIP("192.168.127.10").To4(), "192.168.127.10:68"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestDHCPServer(t)
+			conn := &recordingConn{}
+
+			req := testRequest(dhcpRequest, testMAC, nil)
+			req.CIAddr = tt.ciaddr
+			if tt.ciaddr.Equal(net.IPv4zero) {
+				req.Options[optRequestedIP] = net.ParseIP("192.168.127.10").To4()
+			}
+			s.serveOne(conn, &dhcpPort{serverIP: s.serverIP}, req.marshal())
+
+			require.NotNil(t, conn.dest)
+			assert.Equal(t, tt.wantDest, conn.dest.String())
+			reply, err := parseDHCPMessage(conn.data)
+			require.NoError(t, err)
+			assert.Equal(t, byte(dhcpAck), reply.messageType())
+		})
+	}
+
+	// Malformed packets are dropped
+	s := newTestDHCPServer(t)
+	conn := &recordingConn{}
+	s.serveOne(conn, &dhcpPort{serverIP: s.serverIP}, []byte("garbage"))
+	assert.Nil(t, conn.dest)
+}
+
+func TestDHCPServer_StartStop(t *testing.T) {
+	orig := listenDHCP
+	defer func() { listenDHCP = orig }()
+	listenDHCP = func(ctx context.Context, bridge string) (net.PacketConn, error) {
+		return net.ListenPacket("udp4", "127.0.0.1:0")
+	}
+
+	s := NewDHCPServer(net.ParseIP("192.168.127.1"), nil, "")
+	require.NoError(t, s.Start(context.Background(), "testbr0"))
+	s.Stop()
+	// Stopping twice is harmless
+	s.Stop()
+}
@@ -0,0 +1,312 @@
+// Package network provides the built-in DNS forwarder for VMs.
+
+package network
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+const (
+	// dnsRecordTTL is short because task addresses change with rescheduling.
+	dnsRecordTTL = 5
+
+	dnsForwardTimeout = 2 * time.Second
+)
+
+// listenDNS opens the forwarder socket - overridable for testing
+var listenDNS = func(ctx context.Context, addr string) (net.PacketConn, error) {
+	var lc net.ListenConfig
+	return lc.ListenPacket(ctx, "udp4", addr)
+}
+
+// DNSServer answers A queries for task and service names and forwards
+// everything else to the host's resolvers.
+type DNSServer struct {
+	upstreams []string
+
+	mu      sync.RWMutex
+	records map[string]map[string][]net.IP // name -> task ID -> addresses
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewDNSServer creates a forwarder. When upstreams is empty the nameservers
+// from /etc/resolv.conf are used.
+func NewDNSServer(upstreams []string) *DNSServer {
+	if len(upstreams) == 0 {
+		upstreams = resolvConfNameservers("/etc/resolv.conf")
+	}
+	return &DNSServer{
+		upstreams: upstreams,
+		records:   make(map[string]map[string][]net.IP),
+	}
+}
+
+// resolvConfNameservers returns "ip:53" for each nameserver in a resolv.conf.
+func resolvConfNameservers(path string) []string {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	var servers []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 && fields[0] == "nameserver" && net.ParseIP(fields[1]) != nil {
+			servers = append(servers, net.JoinHostPort(fields[1], "53"))
+		}
+	}
+	return servers
+}
+
+func normalizeDNSName(name string) string {
+	return strings.ToLower(strings.TrimSuffix(name, "."))
+}
+
+// AddRecords makes names resolve to a task's addresses. Several tasks may
+// share a name (a service), in which case all their addresses are returned.
+func (s *DNSServer) AddRecords(taskID string, names []string, ips []net.IP) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, name := range names {
+		name = normalizeDNSName(name)
+		if name == "" {
+			continue
+		}
+		if s.records[name] == nil {
+			s.records[name] = make(map[string][]net.IP)
+		}
+		s.records[name][taskID] = ips
+	}
+}
+
+// RemoveTask removes a task's addresses from every name.
+func (s *DNSServer) RemoveTask(taskID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for name, byTask := range s.records {
+		delete(byTask, taskID)
+		if len(byTask) == 0 {
+			delete(s.records, name)
+		}
+	}
+}
+
+// Lookup returns the addresses registered for a name, sorted, and whether
+// the name is known at all.
+func (s *DNSServer) Lookup(name string) ([]net.IP, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	byTask, ok := s.records[normalizeDNSName(name)]
+	if !ok {
+		return nil, false
+	}
+	var ips []net.IP
+	for _, addrs := range byTask {
+		ips = append(ips, addrs...)
+	}
+	sort.Slice(ips, func(i, j int) bool { return ips[i].String() < ips[j].String() })
+	return ips, true
+}
+
+// Answer builds a response for a query that can be answered locally. It
+// returns nil when the query must be forwarded.
+func (s *DNSServer) Answer(query []byte) ([]byte, error) {
+	var p dnsmessage.Parser
+	header, err := p.Start(query)
+	if err != nil {
+		return nil, fmt.Errorf("invalid DNS query: %w", err)
+	}
+	question, err := p.Question()
+	if err != nil {
+		return nil, fmt.Errorf("invalid DNS question: %w", err)
+	}
+
+	ips, ok := s.Lookup(question.Name.String())
+	if !ok || question.Class != dnsmessage.ClassINET {
+		return nil, nil
+	}
+
+	b := dnsmessage.NewBuilder(nil, dnsmessage.Header{
+		ID:                 header.ID,
+		Response:           true,
+		Authoritative:      true,
+		RecursionDesired:   header.RecursionDesired,
+		RecursionAvailable: true,
+	})
+	b.EnableCompression()
+	if err := b.StartQuestions(); err != nil {
+		return nil, err
+	}
+	if err := b.Question(question); err != nil {
+		return nil, err
+	}
+	if err := b.StartAnswers(); err != nil {
+		return nil, err
+	}
+
+	// Other record types get an empty NOERROR answer for known names
+	if question.Type == dnsmessage.TypeA || question.Type == dnsmessage.TypeALL {
+		for _, ip := range ips {
+			ip4 := ip.To4()
+			if ip4 == nil {
+				continue
+			}
+			var a dnsmessage.AResource
+			copy(a.A[:], ip4)
+			err := b.AResource(dnsmessage.ResourceHeader{
+				Name:  question.Name,
+				Class: dnsmessage.ClassINET,
+				TTL:   dnsRecordTTL,
+			}, a)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return b.Finish()
+}
+
+// forward relays a query to the first upstream that answers.
+func (s *DNSServer) forward(query []byte) ([]byte, error) {
+	if len(s.upstreams) == 0 {
+		return nil, fmt.Errorf("no upstream resolvers configured")
+	}
+
+	var lastErr error
+	buf := make([]byte, 65535)
+	for _, upstream := range s.upstreams {
+		conn, err := net.DialTimeout("udp", upstream, dnsForwardTimeout)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		conn.SetDeadline(time.Now().Add(dnsForwardTimeout))
+		if _, err := conn.Write(query); err != nil {
+			conn.Close()
+			lastErr = err
+			continue
+		}
+		n, err := conn.Read(buf)
+		conn.Close()
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		return append([]byte(nil), buf[:n]...), nil
+	}
+	return nil, fmt.Errorf("all upstream resolvers failed: %w", lastErr)
+}
+
+// servFail builds a SERVFAIL response for a query.
+func servFail(query []byte) []byte {
+	var p dnsmessage.Parser
+	header, err := p.Start(query)
+	if err != nil {
+		return nil
+	}
+	question, err := p.Question()
+	if err != nil {
+		return nil
+	}
+	b := dnsmessage.NewBuilder(nil, dnsmessage.Header{
+		ID:               header.ID,
+		Response:         true,
+		RecursionDesired: header.RecursionDesired,
+		RCode:            dnsmessage.RCodeServerFailure,
+	})
+	if b.StartQuestions() != nil || b.Question(question) != nil {
+		return nil
+	}
+	msg, err := b.Finish()
+	if err != nil {
+		return nil
+	}
+	return msg
+}
+
+// Resolve answers a query locally or via the upstream resolvers.
+func (s *DNSServer) Resolve(query []byte) []byte {
+	resp, err := s.Answer(query)
+	if err != nil {
+		log.Debug().Err(err).Msg("Ignoring malformed DNS query")
+		return nil
+	}
+	if resp != nil {
+		return resp
+	}
+
+	resp, err = s.forward(query)
+	if err != nil {
+		log.Debug().Err(err).Msg("DNS forwarding failed")
+		return servFail(query)
+	}
+	return resp
+}
+
+// Start listens on addr (usually the bridge IP) and serves until Stop.
+func (s *DNSServer) Start(ctx context.Context, addr string) error {
+	conn, err := listenDNS(ctx, addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen for DNS on %s: %w", addr, err)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	s.cancel = cancel
+	s.done = make(chan struct{})
+
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+
+	go func() {
+		defer close(s.done)
+		for {
+			buf := make([]byte, 512)
+			n, from, err := conn.ReadFrom(buf)
+			if err != nil {
+				if ctx.Err() == nil {
+					log.Warn().Err(err).Msg("DNS server read failed")
+				}
+				return
+			}
+			// Forwarding blocks on upstreams, so serve each query concurrently
+			go func(query []byte) {
+				if resp := s.Resolve(query); resp != nil {
+					conn.WriteTo(resp, from)
+				}
+			}(buf[:n])
+		}
+	}()
+
+	return nil
+}
+
+// Stop closes the socket and waits for the server loop to exit.
+func (s *DNSServer) Stop() {
+	if s.cancel == nil {
+		return
+	}
+	s.cancel()
+	<-s.done
+	s.cancel = nil
+}
@@ -0,0 +1,206 @@
+package network
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func buildDNSQuery(t *testing.T, name string, qtype dnsmessage.Type) []byte {
+	t.Helper()
+	b := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: 42, RecursionDesired: true})
+	require.NoError(t, b.StartQuestions())
+	require.NoError(t, b.Question(dnsmessage.Question{
+		Name:  dnsmessage.MustNewName(name),
+		Type:  qtype,
+		Class: dnsmessage.ClassINET,
+	}))
+	query, err := b.Finish()
+	require.NoError(t, err)
+	return query
+}
+
+func parseDNSResponse(t *testing.T, resp []byte) (dnsmessage.Header, []net.IP) {
+	t.Helper()
+	var msg dnsmessage.Message
+	require.NoError(t, msg.Unpack(resp))
+	var ips []net.IP
+	for _, answer := range msg.Answers {
+		if a, ok := answer.Body.(*dnsmessage.AResource); ok {
+			ips = append(ips, net.IP(a.A[:]))
+		}
+	}
+	return msg.Header, ips
+}
+
+// startFakeUpstream answers every query with a fixed A record.
+func startFakeUpstream(t *testing.T, answer net.IP) string {
+	t.Helper()
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, from, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			var p dnsmessage.Parser
+			header, err := p.Start(buf[:n])
+			if err != nil {
+				continue
+			}
+			q, err := p.Question()
+			if err != nil {
+				continue
+			}
+			b := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: header.ID, Response: true})
+			b.StartQuestions()
+			b.Question(q)
+			b.StartAnswers()
+			var a dnsmessage.AResource
+			copy(a.A[:], answer.To4())
+			b.AResource(dnsmessage.ResourceHeader{Name: q.Name, Class: dnsmessage.ClassINET, TTL: 60}, a)
+			resp, _ := b.Finish()
+			conn.WriteTo(resp, from)
+		}
+	}()
+
+	return conn.LocalAddr().String()
+}
+
+func TestDNSServer_LocalRecords(t *testing.T) {
+	s := NewDNSServer([]string{"127.0.0.1:1"})
+	s.AddRecords("task-1", []string{"web", "web.1"}, []net.IP{net.ParseIP("192.168.127.10")})
+	s.AddRecords("task-2", []string{"web", "web.2"}, []net.IP{net.ParseIP("192.168.127.11")})
+
+	tests := []struct {
+		name    string
+		query   string
+		qtype   dnsmessage.Type
+		wantIPs []string
+	}{
+		{"service returns every task", "web.", dnsmessage.TypeA, []string{"192.168.127.10", "192.168.127.11"}},
+		{"slot name", "web.2.", dnsmessage.TypeA, []string{"192.168.127.11"}},
+		{"case insensitive", "WEB.1.", dnsmessage.TypeA, []string{"192.168.127.10"}},
+		{"AAAA on known name is empty", "web.", dnsmessage.TypeAAAA, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := s.Answer(buildDNSQuery(t, tt.query, tt.qtype))
+			require.NoError(t, err)
+			require.NotNil(t, resp)
+
+			header, ips := parseDNSResponse(t, resp)
+			assert.Equal(t, uint16(42), header.ID)
+			assert.True(t, header.Authoritative)
+			assert.Equal(t, dnsmessage.RCodeSuccess, header.RCode)
+
+			var got []string
+			for _, ip := range ips {
+				got = append(got, ip.String())
+			}
+			assert.Equal(t, tt.wantIPs, got)
+		})
+	}
+
+	// Unknown names are left for the upstreams
+	resp, err := s.Answer(buildDNSQuery(t, "example.com.", dnsmessage.TypeA))
+	require.NoError(t, err)
+	assert.Nil(t, resp)
+
+	_, err = s.Answer([]byte{1, 2, 3})
+	assert.Error(t, err)
+}
+
+func TestDNSServer_RemoveTask(t *testing.T) {
+	s := NewDNSServer([]string{"127.0.0.1:1"})
+	s.AddRecords("task-1", []string{"web", "task-1"}, []net.IP{net.ParseIP("192.168.127.10")})
+	s.AddRecords("task-2", []string{"web"}, []net.IP{net.ParseIP("192.168.127.11")})
+
+	s.RemoveTask("task-1")
+
+	_, ok := s.Lookup("task-1")
+	assert.False(t, ok)
+	ips, ok := s.Lookup("web")
+	assert.True(t, ok)
+	assert.Equal(t, []net.IP{net.ParseIP("192.168.127.11")}, ips)
+}
+
+func TestDNSServer_Forward(t *testing.T) {
+	upstream := startFakeUpstream(t, net.ParseIP("93.184.216.34"))
+	s := NewDNSServer([]string{upstream})
+
+	resp := s.Resolve(buildDNSQuery(t, "example.com.", dnsmessage.TypeA))
+	require.NotNil(t, resp)
+	_, ips := parseDNSResponse(t, resp)
+	require.Len(t, ips, 1)
+	assert.Equal(t, "93.184.216.34", ips[0].String())
+}
+
+func TestDNSServer_ForwardFailure(t *testing.T) {
+	// Nothing listens here, so the query fails fast with ECONNREFUSED
+	s := NewDNSServer([]string{"127.0.0.1:1"})
+
+	resp := s.Resolve(buildDNSQuery(t, "example.com.", dnsmessage.TypeA))
+	require.NotNil(t, resp)
+	header, _ := parseDNSResponse(t, resp)
+	assert.Equal(t, dnsmessage.RCodeServerFailure, header.RCode)
+
+	assert.Nil(t, s.Resolve([]byte("garbage")))
+}
+
+func TestDNSServer_Serve(t *testing.T) {
+	upstream := startFakeUpstream(t, net.ParseIP("93.184.216.34"))
+	s := NewDNSServer([]string{upstream})
+	s.AddRecords("task-1", []string{"web"}, []net.IP{net.ParseIP("192.168.127.10")})
+
+	var serverAddr net.Addr
+	orig := listenDNS
+	defer func() { listenDNS = orig }()
+	listenDNS = func(ctx context.Context, addr string) (net.PacketConn, error) {
+		conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+		if err == nil {
+			serverAddr = conn.LocalAddr()
+		}
+		return conn, err
+	}
+
+	require.NoError(t, s.Start(context.Background(), "192.168.127.1:53"))
+	defer s.Stop()
+
+	client, err := net.Dial("udp4", serverAddr.String())
+	require.NoError(t, err)
+	defer client.Close()
+	client.SetDeadline(time.Now().Add(2 * time.Second))
+
+	for name, want := range map[string]string{"web.": "192.168.127.10", "example.com.": "93.184.216.34"} {
+		_, err = client.Write(buildDNSQuery(t, name, dnsmessage.TypeA))
+		require.NoError(t, err)
+		buf := make([]byte, 512)
+		n, err := client.Read(buf)
+		require.NoError(t, err)
+		_, ips := parseDNSResponse(t, buf[:n])
+		require.Len(t, ips, 1, name)
+		assert.Equal(t, want, ips[0].String(), name)
+	}
+}
+
+func TestResolvConfNameservers(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "resolv.conf")
+	content := "# generated\nnameserver 1.1.1.1\nsearch example.com\nnameserver fd00::53\nnameserver bogus\n"
+	require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+
+	assert.Equal(t, []string{"1.1.1.1:53", "[fd00::53]:53"}, resolvConfNameservers(path))
+	assert.Nil(t, resolvConfNameservers(filepath.Join(t.TempDir(), "missing")))
+}
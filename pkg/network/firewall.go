@@ -0,0 +1,820 @@
+// Package network provides the nftables firewall used for VM networking.
+
+package network
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/google/nftables"
+	"github.com/google/nftables/expr"
+	"github.com/restuhaqza/swarmcracker/pkg/statefile"
+	"github.com/restuhaqza/swarmcracker/pkg/types"
+	"github.com/rs/zerolog/log"
+	"golang.org/x/sys/unix"
+)
+
+// FirewallTableName is the nftables table owned by SwarmCracker. It exists
+// once in the inet family (NAT, port publishing) and once in the bridge
+// family (anti-spoofing and VM policies).
+const FirewallTableName = "swarmcracker"
+
+// Service labels carrying per-service network policies.
+//
+// The value is a comma-separated list of allow entries:
+//
+//	tcp:80              protocol and destination port
+//	udp:53@10.0.0.0/8   protocol, port and peer CIDR
+//	10.0.0.0/8          any traffic to or from the CIDR
+//	icmp                a protocol without port
+//	none                deny everything
+//
+// For ingress the CIDR matches the source, for egress the destination.
+// Replies to allowed connections are always accepted, which relies on bridge
+// connection tracking (nf_conntrack_bridge, Linux 5.3+).
+const (
+	IngressPolicyLabel = "swarmcracker.network.ingress"
+	EgressPolicyLabel  = "swarmcracker.network.egress"
+)
+
+// NFTablesConn is the subset of *nftables.Conn used by the firewall.
+// Operations are batched and committed atomically by Flush.
+type NFTablesConn interface {
+	AddTable(t *nftables.Table) *nftables.Table
+	DelTable(t *nftables.Table)
+	AddChain(c *nftables.Chain) *nftables.Chain
+	AddRule(r *nftables.Rule) *nftables.Rule
+	Flush() error
+}
+
+// newFirewallConn opens a netlink connection to nftables - overridable for testing
+var newFirewallConn = func() (NFTablesConn, error) {
+	return nftables.New()
+}
+
+// PolicyRule is a single allow entry of a network policy.
+type PolicyRule struct {
+	Protocol string     // "tcp", "udp", "icmp" or "" for any
+	Port     uint16     // Destination port, 0 for any
+	Peer     *net.IPNet // Remote CIDR, nil for any
+}
+
+// NetworkPolicy is an allow-list for one direction of VM traffic.
+// A nil policy allows everything; an empty one denies everything.
+type NetworkPolicy struct {
+	Rules []PolicyRule
+}
+
+// FirewallEndpoint is the firewall state for one VM interface.
+type FirewallEndpoint struct {
+	TaskID  string
+	Tap     string
+	IP      string // Allocated IPv4 address, empty if unknown
+	MAC     string
+	Ports   []types.PortConfig
+	Ingress *NetworkPolicy
+	Egress  *NetworkPolicy
+}
+
+// masquerade describes a NATed subnet behind a bridge.
+type masquerade struct {
+	subnet *net.IPNet
+	bridge string
+}
+
+// FirewallManager owns the swarmcracker nftables tables. It keeps the
+// desired state in memory and rewrites both tables in a single netlink
+// transaction on every change, so the kernel never holds a partial or stale
+// ruleset.
+type FirewallManager struct {
+	mu         sync.Mutex
+	connect    func() (NFTablesConn, error)
+	masquerade map[string]masquerade
+	gateways   map[string]string            // overlay bridge -> gateway MAC
+	endpoints  map[string]*FirewallEndpoint // keyed by TAP name
+	stateFile  string                       // Desired state is saved here when set
+}
+
+// firewallState is the persisted desired state of the firewall.
+type firewallState struct {
+	Masquerade []masqueradeState
+	Gateways   map[string]string
+	Endpoints  []*FirewallEndpoint
+}
+
+type masqueradeState struct {
+	Subnet string
+	Bridge string
+}
+
+// NewFirewallManager creates a firewall manager using the given connection factory.
+func NewFirewallManager(connect func() (NFTablesConn, error)) *FirewallManager {
+	return &FirewallManager{
+		connect:    connect,
+		masquerade: make(map[string]masquerade),
+		gateways:   make(map[string]string),
+		endpoints:  make(map[string]*FirewallEndpoint),
+	}
+}
+
+// Reconcile replaces whatever the kernel holds in the swarmcracker tables
+// with the current desired state. Called at startup it removes rules left
+// behind by a crash or a previous boot.
+func (f *FirewallManager) Reconcile() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.apply()
+}
+
+// Persist makes the firewall save its desired state to path after every
+// change and restores the state previously saved there, so a restarted
+// agent re-installs the rules of VMs that survived it.
+func (f *FirewallManager) Persist(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to read firewall state: %w", err)
+	}
+
+	var state firewallState
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &state); err != nil {
+			return fmt.Errorf("failed to parse firewall state %s: %w", path, err)
+		}
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.stateFile = path
+	for _, m := range state.Masquerade {
+		if _, ipNet, err := net.ParseCIDR(m.Subnet); err == nil {
+			f.masquerade[ipNet.String()] = masquerade{subnet: ipNet, bridge: m.Bridge}
+		}
+	}
+	for bridge, mac := range state.Gateways {
+		if _, err := net.ParseMAC(mac); err == nil {
+			f.gateways[bridge] = mac
+		}
+	}
+	for _, ep := range state.Endpoints {
+		if ep != nil && ep.Tap != "" {
+			f.endpoints[ep.Tap] = ep
+		}
+	}
+	return nil
+}
+
+// Prune forgets the endpoints of tasks that are no longer running and
+// returns how many were dropped. The kernel is updated on the next apply.
+func (f *FirewallManager) Prune(isRunning func(taskID string) bool) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	pruned := 0
+	for tap, ep := range f.endpoints {
+		if !isRunning(ep.TaskID) {
+			delete(f.endpoints, tap)
+			pruned++
+		}
+	}
+	return pruned
+}
+
+// AddMasquerade masquerades traffic from subnet leaving through any
+// interface other than bridge.
+func (f *FirewallManager) AddMasquerade(subnet, bridge string) error {
+	_, ipNet, err := net.ParseCIDR(subnet)
+	if err != nil {
+		return fmt.Errorf("invalid subnet %s: %w", subnet, err)
+	}
+	if ipNet.IP.To4() == nil {
+		return fmt.Errorf("masquerade subnet %s is not IPv4", subnet)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if existing, ok := f.masquerade[ipNet.String()]; ok && existing.bridge == bridge {
+		return nil
+	}
+	f.masquerade[ipNet.String()] = masquerade{subnet: ipNet, bridge: bridge}
+	return f.apply()
+}
+
+// AddGateway keeps the gateway of an overlay bridge local to the node. Every
+// node carries the gateway with the same MAC, so frames from that MAC that
+// arrive from the network are another node's copy and are dropped.
+func (f *FirewallManager) AddGateway(bridge, mac string) error {
+	if _, err := net.ParseMAC(mac); err != nil {
+		return fmt.Errorf("invalid gateway MAC for %s: %w", bridge, err)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.gateways[bridge] == mac {
+		return nil
+	}
+	f.gateways[bridge] = mac
+	return f.apply()
+}
+
+// RemoveBridge drops the masquerading and gateway rules of a bridge.
+func (f *FirewallManager) RemoveBridge(bridge string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	_, removed := f.gateways[bridge]
+	delete(f.gateways, bridge)
+	for key, m := range f.masquerade {
+		if m.bridge == bridge {
+			delete(f.masquerade, key)
+			removed = true
+		}
+	}
+	if !removed {
+		return nil
+	}
+	return f.apply()
+}
+
+// AddEndpoints installs anti-spoofing, port publishing and policy rules for
+// a set of VM interfaces.
+func (f *FirewallManager) AddEndpoints(endpoints ...*FirewallEndpoint) error {
+	for _, ep := range endpoints {
+		if _, err := net.ParseMAC(ep.MAC); err != nil {
+			return fmt.Errorf("invalid MAC for %s: %w", ep.Tap, err)
+		}
+		if ep.IP != "" && net.ParseIP(ep.IP).To4() == nil {
+			return fmt.Errorf("invalid IPv4 address for %s: %s", ep.Tap, ep.IP)
+		}
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, ep := range endpoints {
+		f.endpoints[ep.Tap] = ep
+	}
+	return f.apply()
+}
+
+// RemoveTask drops every rule installed for a task.
+func (f *FirewallManager) RemoveTask(taskID string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	removed := false
+	for tap, ep := range f.endpoints {
+		if ep.TaskID == taskID {
+			delete(f.endpoints, tap)
+			removed = true
+		}
+	}
+	if !removed {
+		return nil
+	}
+	return f.apply()
+}
+
+// apply rebuilds and commits both tables. Caller must hold f.mu.
+func (f *FirewallManager) apply() error {
+	conn, err := f.connect()
+	if err != nil {
+		return fmt.Errorf("failed to connect to nftables: %w", err)
+	}
+
+	inet := &nftables.Table{Name: FirewallTableName, Family: nftables.TableFamilyINet}
+	bridge := &nftables.Table{Name: FirewallTableName, Family: nftables.TableFamilyBridge}
+
+	for _, table := range []*nftables.Table{inet, bridge} {
+		// Adding first makes the delete valid when the table does not exist yet
+		conn.AddTable(table)
+		conn.DelTable(table)
+		conn.AddTable(table)
+	}
+
+	f.buildNAT(conn, inet)
+	f.buildIsolation(conn, inet)
+	f.buildBridge(conn, bridge)
+
+	if err := conn.Flush(); err != nil {
+		return fmt.Errorf("failed to commit nftables rules: %w", err)
+	}
+
+	log.Debug().
+		Int("masquerade", len(f.masquerade)).
+		Int("endpoints", len(f.endpoints)).
+		Msg("Firewall rules applied")
+
+	if err := f.saveLocked(); err != nil {
+		log.Warn().Err(err).Msg("Failed to save firewall state")
+	}
+	return nil
+}
+
+// saveLocked writes the desired state to the state file, if persistence is
+// enabled. Caller must hold f.mu.
+func (f *FirewallManager) saveLocked() error {
+	if f.stateFile == "" {
+		return nil
+	}
+
+	state := firewallState{Gateways: f.gateways, Endpoints: f.sortedEndpoints()}
+	for _, m := range f.masquerade {
+		state.Masquerade = append(state.Masquerade, masqueradeState{Subnet: m.subnet.String(), Bridge: m.bridge})
+	}
+	sort.Slice(state.Masquerade, func(i, j int) bool { return state.Masquerade[i].Subnet < state.Masquerade[j].Subnet })
+
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal firewall state: %w", err)
+	}
+	return statefile.Write(f.stateFile, data, 0640)
+}
+
+// sortedEndpoints returns endpoints in a stable order so rebuilds are deterministic.
+func (f *FirewallManager) sortedEndpoints() []*FirewallEndpoint {
+	eps := make([]*FirewallEndpoint, 0, len(f.endpoints))
+	for _, ep := range f.endpoints {
+		eps = append(eps, ep)
+	}
+	sort.Slice(eps, func(i, j int) bool { return eps[i].Tap < eps[j].Tap })
+	return eps
+}
+
+// buildNAT adds masquerading and port publishing to the inet table.
+func (f *FirewallManager) buildNAT(conn NFTablesConn, table *nftables.Table) {
+	accept := nftables.ChainPolicyAccept
+
+	postrouting := conn.AddChain(&nftables.Chain{
+		Name:     "postrouting",
+		Table:    table,
+		Type:     nftables.ChainTypeNAT,
+		Hooknum:  nftables.ChainHookPostrouting,
+		Priority: nftables.ChainPriorityNATSource,
+		Policy:   &accept,
+	})
+
+	subnets := make([]string, 0, len(f.masquerade))
+	for key := range f.masquerade {
+		subnets = append(subnets, key)
+	}
+	sort.Strings(subnets)
+
+	for _, key := range subnets {
+		m := f.masquerade[key]
+		exprs := matchNFProto(unix.NFPROTO_IPV4)
+		exprs = append(exprs, matchIPv4Net(ipv4SrcOffset, m.subnet)...)
+		exprs = append(exprs, matchIfname(expr.MetaKeyOIFNAME, m.bridge, expr.CmpOpNeq)...)
+		exprs = append(exprs, &expr.Counter{}, &expr.Masq{})
+		conn.AddRule(&nftables.Rule{Table: table, Chain: postrouting, Exprs: exprs})
+	}
+
+	prerouting := conn.AddChain(&nftables.Chain{
+		Name:     "prerouting",
+		Table:    table,
+		Type:     nftables.ChainTypeNAT,
+		Hooknum:  nftables.ChainHookPrerouting,
+		Priority: nftables.ChainPriorityNATDest,
+		Policy:   &accept,
+	})
+	// Connections from the node itself to its own address
+	output := conn.AddChain(&nftables.Chain{
+		Name:     "output",
+		Table:    table,
+		Type:     nftables.ChainTypeNAT,
+		Hooknum:  nftables.ChainHookOutput,
+		Priority: nftables.ChainPriorityNATDest,
+		Policy:   &accept,
+	})
+
+	for _, ep := range f.sortedEndpoints() {
+		if ep.IP == "" {
+			continue
+		}
+		for _, port := range ep.Ports {
+			proto, ok := l4Protocols[strings.ToLower(port.Protocol)]
+			if !ok || port.PublishedPort == 0 {
+				continue
+			}
+			target := port.TargetPort
+			if target == 0 {
+				target = port.PublishedPort
+			}
+			for _, chain := range []*nftables.Chain{prerouting, output} {
+				conn.AddRule(&nftables.Rule{
+					Table: table,
+					Chain: chain,
+					Exprs: dnatExprs(proto, uint16(port.PublishedPort), net.ParseIP(ep.IP).To4(), uint16(target)),
+				})
+			}
+		}
+	}
+}
+
+// buildIsolation keeps the networks behind different bridges apart. With
+// IP forwarding enabled every bridge gateway routes for its VMs, so without
+// these rules a VM could reach any other network on the node through it.
+// Traffic staying on its bridge and egress to the uplink are unaffected.
+func (f *FirewallManager) buildIsolation(conn NFTablesConn, table *nftables.Table) {
+	accept := nftables.ChainPolicyAccept
+
+	forward := conn.AddChain(&nftables.Chain{
+		Name:     "forward",
+		Table:    table,
+		Type:     nftables.ChainTypeFilter,
+		Hooknum:  nftables.ChainHookForward,
+		Priority: nftables.ChainPriorityFilter,
+		Policy:   &accept,
+	})
+
+	bridges := f.managedBridges()
+	for _, from := range bridges {
+		for _, to := range bridges {
+			if from == to {
+				continue
+			}
+			// iifname <from> oifname <to> drop
+			exprs := matchIfname(expr.MetaKeyIIFNAME, from, expr.CmpOpEq)
+			exprs = append(exprs, matchIfname(expr.MetaKeyOIFNAME, to, expr.CmpOpEq)...)
+			exprs = append(exprs, &expr.Counter{}, &expr.Verdict{Kind: expr.VerdictDrop})
+			conn.AddRule(&nftables.Rule{Table: table, Chain: forward, Exprs: exprs})
+		}
+	}
+}
+
+// managedBridges returns the sorted names of the bridges the firewall has
+// gateway or masquerading rules for.
+func (f *FirewallManager) managedBridges() []string {
+	seen := make(map[string]bool)
+	for bridge := range f.gateways {
+		seen[bridge] = true
+	}
+	for _, m := range f.masquerade {
+		seen[m.bridge] = true
+	}
+	bridges := make([]string, 0, len(seen))
+	for bridge := range seen {
+		bridges = append(bridges, bridge)
+	}
+	sort.Strings(bridges)
+	return bridges
+}
+
+// buildBridge adds anti-spoofing and per-VM policies to the bridge table.
+// Filtering at the bridge layer also covers traffic between VMs on the same
+// bridge, which never reaches the IP forward hook.
+func (f *FirewallManager) buildBridge(conn NFTablesConn, table *nftables.Table) {
+	accept := nftables.ChainPolicyAccept
+
+	prerouting := conn.AddChain(&nftables.Chain{
+		Name:     "prerouting",
+		Table:    table,
+		Type:     nftables.ChainTypeFilter,
+		Hooknum:  nftables.ChainHookPrerouting,
+		Priority: nftables.ChainPriorityFilter,
+		Policy:   &accept,
+	})
+	forward := conn.AddChain(&nftables.Chain{
+		Name:     "forward",
+		Table:    table,
+		Type:     nftables.ChainTypeFilter,
+		Hooknum:  nftables.ChainHookForward,
+		Priority: nftables.ChainPriorityFilter,
+		Policy:   &accept,
+	})
+	output := conn.AddChain(&nftables.Chain{
+		Name:     "output",
+		Table:    table,
+		Type:     nftables.ChainTypeFilter,
+		Hooknum:  nftables.ChainHookOutput,
+		Priority: nftables.ChainPriorityFilter,
+		Policy:   &accept,
+	})
+
+	bridges := make([]string, 0, len(f.gateways))
+	for bridge := range f.gateways {
+		bridges = append(bridges, bridge)
+	}
+	sort.Strings(bridges)
+	for _, bridge := range bridges {
+		// ether saddr <gateway mac> drop
+		mac, _ := net.ParseMAC(f.gateways[bridge])
+		conn.AddRule(&nftables.Rule{
+			Table: table,
+			Chain: prerouting,
+			Exprs: []expr.Any{
+				&expr.Payload{DestRegister: 1, Base: expr.PayloadBaseLLHeader, Offset: 6, Len: 6},
+				&expr.Cmp{Op: expr.CmpOpEq, Register: 1, Data: []byte(mac)},
+				&expr.Counter{},
+				&expr.Verdict{Kind: expr.VerdictDrop},
+			},
+		})
+	}
+
+	for _, ep := range f.sortedEndpoints() {
+		// Frames sent by the VM: anti-spoofing, then the egress policy
+		from := conn.AddChain(&nftables.Chain{Name: "from-" + ep.Tap, Table: table})
+		conn.AddRule(&nftables.Rule{
+			Table: table,
+			Chain: prerouting,
+			Exprs: append(matchIfname(expr.MetaKeyIIFNAME, ep.Tap, expr.CmpOpEq), jump(from.Name)),
+		})
+		for _, exprs := range antiSpoofRules(ep) {
+			conn.AddRule(&nftables.Rule{Table: table, Chain: from, Exprs: exprs})
+		}
+		if ep.Egress != nil {
+			for _, exprs := range policyRules(ep.Egress, ipv4DstOffset) {
+				conn.AddRule(&nftables.Rule{Table: table, Chain: from, Exprs: exprs})
+			}
+		}
+
+		// Frames delivered to the VM, either bridged or from the node itself
+		if ep.Ingress != nil {
+			to := conn.AddChain(&nftables.Chain{Name: "to-" + ep.Tap, Table: table})
+			for _, chain := range []*nftables.Chain{forward, output} {
+				conn.AddRule(&nftables.Rule{
+					Table: table,
+					Chain: chain,
+					Exprs: append(matchIfname(expr.MetaKeyOIFNAME, ep.Tap, expr.CmpOpEq), jump(to.Name)),
+				})
+			}
+			for _, exprs := range policyRules(ep.Ingress, ipv4SrcOffset) {
+				conn.AddRule(&nftables.Rule{Table: table, Chain: to, Exprs: exprs})
+			}
+		}
+	}
+}
+
+// antiSpoofRules only lets the allocated MAC and IPv4 address leave a TAP.
+// Guests never have IPv6 addresses (see CheckGuestAddresses), so IPv6,
+// neighbour discovery included, is dropped along with any other protocol
+// but IPv4 and ARP; that also keeps VLAN-tagged frames from slipping past
+// the address checks.
+func antiSpoofRules(ep *FirewallEndpoint) [][]expr.Any {
+	mac, _ := net.ParseMAC(ep.MAC)
+
+	rules := [][]expr.Any{
+		// ether saddr != <mac> drop
+		{
+			&expr.Payload{DestRegister: 1, Base: expr.PayloadBaseLLHeader, Offset: 6, Len: 6},
+			&expr.Cmp{Op: expr.CmpOpNeq, Register: 1, Data: []byte(mac)},
+			&expr.Counter{},
+			&expr.Verdict{Kind: expr.VerdictDrop},
+		},
+		// meta protocol != ip meta protocol != arp drop
+		{
+			&expr.Meta{Key: expr.MetaKeyPROTOCOL, Register: 1},
+			&expr.Cmp{Op: expr.CmpOpNeq, Register: 1, Data: binary.BigEndian.AppendUint16(nil, unix.ETH_P_IP)},
+			&expr.Cmp{Op: expr.CmpOpNeq, Register: 1, Data: binary.BigEndian.AppendUint16(nil, unix.ETH_P_ARP)},
+			&expr.Counter{},
+			&expr.Verdict{Kind: expr.VerdictDrop},
+		},
+	}
+
+	if ep.IP == "" {
+		return rules
+	}
+	ip := net.ParseIP(ep.IP).To4()
+
+	// DHCP discovery is sent before the guest has an address
+	dhcp := matchEtherType(unix.ETH_P_IP)
+	dhcp = append(dhcp,
+		&expr.Payload{DestRegister: 1, Base: expr.PayloadBaseNetworkHeader, Offset: ipv4SrcOffset, Len: 4},
+		&expr.Cmp{Op: expr.CmpOpEq, Register: 1, Data: net.IPv4zero.To4()},
+	)
+	dhcp = append(dhcp, matchL4Port(unix.IPPROTO_UDP, 67)...)
+	dhcp = append(dhcp, &expr.Verdict{Kind: expr.VerdictReturn})
+
+	// ip saddr != <ip> drop
+	ipSpoof := matchEtherType(unix.ETH_P_IP)
+	ipSpoof = append(ipSpoof,
+		&expr.Payload{DestRegister: 1, Base: expr.PayloadBaseNetworkHeader, Offset: ipv4SrcOffset, Len: 4},
+		&expr.Cmp{Op: expr.CmpOpNeq, Register: 1, Data: ip},
+		&expr.Counter{},
+		&expr.Verdict{Kind: expr.VerdictDrop},
+	)
+
+	// arp saddr ip != <ip> drop, arp saddr ether != <mac> drop
+	arpIP := matchEtherType(unix.ETH_P_ARP)
+	arpIP = append(arpIP,
+		&expr.Payload{DestRegister: 1, Base: expr.PayloadBaseNetworkHeader, Offset: 14, Len: 4},
+		&expr.Cmp{Op: expr.CmpOpNeq, Register: 1, Data: ip},
+		&expr.Counter{},
+		&expr.Verdict{Kind: expr.VerdictDrop},
+	)
+	arpMAC := matchEtherType(unix.ETH_P_ARP)
+	arpMAC = append(arpMAC,
+		&expr.Payload{DestRegister: 1, Base: expr.PayloadBaseNetworkHeader, Offset: 8, Len: 6},
+		&expr.Cmp{Op: expr.CmpOpNeq, Register: 1, Data: []byte(mac)},
+		&expr.Counter{},
+		&expr.Verdict{Kind: expr.VerdictDrop},
+	)
+
+	return append(rules, dhcp, ipSpoof, arpIP, arpMAC)
+}
+
+// policyRules renders an allow-list followed by a drop. peerOffset selects
+// the IPv4 header field matched against the rule's CIDR.
+func policyRules(policy *NetworkPolicy, peerOffset uint32) [][]expr.Any {
+	rules := [][]expr.Any{
+		// ct state established,related accept
+		{
+			&expr.Ct{Register: 1, Key: expr.CtKeySTATE},
+			&expr.Bitwise{
+				SourceRegister: 1,
+				DestRegister:   1,
+				Len:            4,
+				Mask:           binary.NativeEndian.AppendUint32(nil, expr.CtStateBitESTABLISHED|expr.CtStateBitRELATED),
+				Xor:            make([]byte, 4),
+			},
+			&expr.Cmp{Op: expr.CmpOpNeq, Register: 1, Data: make([]byte, 4)},
+			&expr.Verdict{Kind: expr.VerdictAccept},
+		},
+		// Address resolution is covered by anti-spoofing
+		append(matchEtherType(unix.ETH_P_ARP), &expr.Verdict{Kind: expr.VerdictAccept}),
+	}
+
+	for _, r := range policy.Rules {
+		exprs := matchEtherType(unix.ETH_P_IP)
+		if r.Peer != nil {
+			exprs = append(exprs, matchIPv4Net(peerOffset, r.Peer)...)
+		}
+		if proto, ok := l4Protocols[r.Protocol]; ok {
+			if r.Port != 0 {
+				exprs = append(exprs, matchL4Port(proto, r.Port)...)
+			} else {
+				exprs = append(exprs, matchL4Proto(proto)...)
+			}
+		}
+		exprs = append(exprs, &expr.Verdict{Kind: expr.VerdictAccept})
+		rules = append(rules, exprs)
+	}
+
+	return append(rules, []expr.Any{&expr.Counter{}, &expr.Verdict{Kind: expr.VerdictDrop}})
+}
+
+// IPv4 header offsets.
+const (
+	ipv4SrcOffset = 12
+	ipv4DstOffset = 16
+)
+
+// l4Protocols maps protocol names to IP protocol numbers.
+var l4Protocols = map[string]byte{
+	"tcp":  unix.IPPROTO_TCP,
+	"udp":  unix.IPPROTO_UDP,
+	"sctp": unix.IPPROTO_SCTP,
+	"icmp": unix.IPPROTO_ICMP,
+}
+
+func jump(chain string) expr.Any {
+	return &expr.Verdict{Kind: expr.VerdictJump, Chain: chain}
+}
+
+func matchNFProto(proto byte) []expr.Any {
+	return []expr.Any{
+		&expr.Meta{Key: expr.MetaKeyNFPROTO, Register: 1},
+		&expr.Cmp{Op: expr.CmpOpEq, Register: 1, Data: []byte{proto}},
+	}
+}
+
+func matchEtherType(ethType uint16) []expr.Any {
+	return []expr.Any{
+		&expr.Meta{Key: expr.MetaKeyPROTOCOL, Register: 1},
+		&expr.Cmp{Op: expr.CmpOpEq, Register: 1, Data: binary.BigEndian.AppendUint16(nil, ethType)},
+	}
+}
+
+func matchIfname(key expr.MetaKey, name string, op expr.CmpOp) []expr.Any {
+	data := make([]byte, unix.IFNAMSIZ)
+	copy(data, name)
+	return []expr.Any{
+		&expr.Meta{Key: key, Register: 1},
+		&expr.Cmp{Op: op, Register: 1, Data: data},
+	}
+}
+
+func matchIPv4Net(offset uint32, ipNet *net.IPNet) []expr.Any {
+	return []expr.Any{
+		&expr.Payload{DestRegister: 1, Base: expr.PayloadBaseNetworkHeader, Offset: offset, Len: 4},
+		&expr.Bitwise{
+			SourceRegister: 1,
+			DestRegister:   1,
+			Len:            4,
+			Mask:           []byte(ipNet.Mask)[len(ipNet.Mask)-4:],
+			Xor:            make([]byte, 4),
+		},
+		&expr.Cmp{Op: expr.CmpOpEq, Register: 1, Data: ipNet.IP.To4()},
+	}
+}
+
+func matchL4Proto(proto byte) []expr.Any {
+	return []expr.Any{
+		&expr.Meta{Key: expr.MetaKeyL4PROTO, Register: 1},
+		&expr.Cmp{Op: expr.CmpOpEq, Register: 1, Data: []byte{proto}},
+	}
+}
+
+func matchL4Port(proto byte, port uint16) []expr.Any {
+	return append(matchL4Proto(proto),
+		&expr.Payload{DestRegister: 1, Base: expr.PayloadBaseTransportHeader, Offset: 2, Len: 2},
+		&expr.Cmp{Op: expr.CmpOpEq, Register: 1, Data: binary.BigEndian.AppendUint16(nil, port)},
+	)
+}
+
+// dnatExprs renders "fib daddr type local <proto> dport <port> dnat to <ip>:<target>".
+func dnatExprs(proto byte, port uint16, ip net.IP, target uint16) []expr.Any {
+	exprs := []expr.Any{
+		&expr.Fib{Register: 1, FlagDADDR: true, ResultADDRTYPE: true},
+		&expr.Cmp{Op: expr.CmpOpEq, Register: 1, Data: binary.NativeEndian.AppendUint32(nil, uint32(unix.RTN_LOCAL))},
+	}
+	exprs = append(exprs, matchNFProto(unix.NFPROTO_IPV4)...)
+	exprs = append(exprs, matchL4Port(proto, port)...)
+	return append(exprs,
+		&expr.Immediate{Register: 1, Data: ip},
+		&expr.Immediate{Register: 2, Data: binary.BigEndian.AppendUint16(nil, target)},
+		&expr.NAT{
+			Type:        expr.NATTypeDestNAT,
+			Family:      unix.NFPROTO_IPV4,
+			RegAddrMin:  1,
+			RegProtoMin: 2,
+			Specified:   true,
+		},
+	)
+}
+
+// ParseNetworkPolicy parses a policy label value. An empty value yields a
+// nil policy (allow everything).
+func ParseNetworkPolicy(value string) (*NetworkPolicy, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil, nil
+	}
+	policy := &NetworkPolicy{}
+	if value == "none" {
+		return policy, nil
+	}
+
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		var rule PolicyRule
+		spec, peer, hasPeer := strings.Cut(entry, "@")
+		if !hasPeer && strings.Contains(entry, "/") {
+			spec, peer, hasPeer = "", entry, true
+		}
+		if hasPeer {
+			_, ipNet, err := net.ParseCIDR(peer)
+			if err != nil || ipNet.IP.To4() == nil {
+				return nil, fmt.Errorf("invalid IPv4 CIDR %q in policy entry %q", peer, entry)
+			}
+			rule.Peer = ipNet
+		}
+
+		if spec != "" {
+			proto, port, hasPort := strings.Cut(strings.ToLower(spec), ":")
+			if _, ok := l4Protocols[proto]; !ok {
+				return nil, fmt.Errorf("unknown protocol %q in policy entry %q", proto, entry)
+			}
+			rule.Protocol = proto
+			if hasPort {
+				if proto == "icmp" {
+					return nil, fmt.Errorf("icmp does not take a port in policy entry %q", entry)
+				}
+				n, err := strconv.ParseUint(port, 10, 16)
+				if err != nil || n == 0 {
+					return nil, fmt.Errorf("invalid port %q in policy entry %q", port, entry)
+				}
+				rule.Port = uint16(n)
+			}
+		}
+
+		policy.Rules = append(policy.Rules, rule)
+	}
+
+	return policy, nil
+}
+
+// PoliciesFromLabels returns the ingress and egress policies declared on a service.
+func PoliciesFromLabels(labels map[string]string) (ingress, egress *NetworkPolicy, err error) {
+	if ingress, err = ParseNetworkPolicy(labels[IngressPolicyLabel]); err != nil {
+		return nil, nil, fmt.Errorf("label %s: %w", IngressPolicyLabel, err)
+	}
+	if egress, err = ParseNetworkPolicy(labels[EgressPolicyLabel]); err != nil {
+		return nil, nil, fmt.Errorf("label %s: %w", EgressPolicyLabel, err)
+	}
+	return ingress, egress, nil
+}
@@ -0,0 +1,355 @@
+package network
+
+import (
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/nftables"
+	"github.com/google/nftables/expr"
+	"github.com/restuhaqza/swarmcracker/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestFirewall() (*FirewallManager, *FakeNFTablesConn) {
+	conn := NewFakeNFTablesConn()
+	return NewFirewallManager(conn.Connect), conn
+}
+
+func testEndpoint(taskID, tap, ip string) *FirewallEndpoint {
+	return &FirewallEndpoint{
+		TaskID: taskID,
+		Tap:    tap,
+		IP:     ip,
+		MAC:    GuestMAC(taskID, "net-1", 0),
+	}
+}
+
+func TestFirewallManager_ReconcileRemovesStaleRules(t *testing.T) {
+	fw, conn := newTestFirewall()
+
+	// Simulate rules left behind by a previous run
+	stale := &nftables.Table{Name: FirewallTableName, Family: nftables.TableFamilyBridge}
+	conn.AddTable(stale)
+	chain := conn.AddChain(&nftables.Chain{Name: "from-tap-stale-0", Table: stale})
+	conn.AddRule(&nftables.Rule{Table: stale, Chain: chain, Exprs: []expr.Any{&expr.Verdict{Kind: expr.VerdictDrop}}})
+	require.NoError(t, conn.Flush())
+
+	require.NoError(t, fw.Reconcile())
+
+	assert.True(t, conn.HasTable(nftables.TableFamilyINet, FirewallTableName))
+	assert.True(t, conn.HasTable(nftables.TableFamilyBridge, FirewallTableName))
+	assert.NotContains(t, conn.Chains(nftables.TableFamilyBridge, FirewallTableName), "from-tap-stale-0")
+	assert.Empty(t, conn.Rules(nftables.TableFamilyBridge, FirewallTableName, "prerouting"))
+}
+
+func TestFirewallManager_AddMasquerade(t *testing.T) {
+	fw, conn := newTestFirewall()
+
+	require.NoError(t, fw.AddMasquerade("192.168.127.0/24", "swarm-br0"))
+	// Same subnet and bridge is a no-op
+	require.NoError(t, fw.AddMasquerade("192.168.127.0/24", "swarm-br0"))
+
+	rules := conn.Rules(nftables.TableFamilyINet, FirewallTableName, "postrouting")
+	require.Len(t, rules, 1)
+	assert.IsType(t, &expr.Masq{}, rules[0].Exprs[len(rules[0].Exprs)-1])
+	assert.Equal(t, 1, conn.Flushes)
+
+	assert.Error(t, fw.AddMasquerade("not-a-subnet", "swarm-br0"))
+	assert.Error(t, fw.AddMasquerade("fd00::/64", "swarm-br0"))
+}
+
+func TestFirewallManager_Gateway(t *testing.T) {
+	fw, conn := newTestFirewall()
+
+	require.NoError(t, fw.AddMasquerade("10.0.9.1/24", "br-001001"))
+	require.NoError(t, fw.AddGateway("br-001001", "02:53:43:00:10:01"))
+	require.NoError(t, fw.AddGateway("br-001001", "02:53:43:00:10:01"))
+	assert.Equal(t, 2, conn.Flushes)
+
+	rules := conn.Rules(nftables.TableFamilyBridge, FirewallTableName, "prerouting")
+	require.Len(t, rules, 1)
+	assert.IsType(t, &expr.Verdict{}, rules[0].Exprs[len(rules[0].Exprs)-1])
+
+	require.NoError(t, fw.RemoveBridge("br-001001"))
+	assert.Empty(t, conn.Rules(nftables.TableFamilyBridge, FirewallTableName, "prerouting"))
+	assert.Empty(t, conn.Rules(nftables.TableFamilyINet, FirewallTableName, "postrouting"))
+
+	assert.Error(t, fw.AddGateway("br-001001", "bogus"))
+}
+
+func TestFirewallManager_BridgeIsolation(t *testing.T) {
+	fw, conn := newTestFirewall()
+
+	require.NoError(t, fw.AddMasquerade("192.168.127.0/24", "swarm-br0"))
+	assert.Empty(t, conn.Rules(nftables.TableFamilyINet, FirewallTableName, "forward"))
+
+	require.NoError(t, fw.AddGateway("br-001001", "02:53:43:00:10:01"))
+	rules := conn.Rules(nftables.TableFamilyINet, FirewallTableName, "forward")
+	require.Len(t, rules, 2)
+
+	ifname := func(name string) []byte {
+		data := make([]byte, 16)
+		copy(data, name)
+		return data
+	}
+	// Each direction between the two bridges is dropped
+	pairs := [][2]string{{"br-001001", "swarm-br0"}, {"swarm-br0", "br-001001"}}
+	for i, pair := range pairs {
+		exprs := rules[i].Exprs
+		assert.Equal(t, expr.MetaKeyIIFNAME, exprs[0].(*expr.Meta).Key)
+		assert.Equal(t, ifname(pair[0]), exprs[1].(*expr.Cmp).Data)
+		assert.Equal(t, expr.MetaKeyOIFNAME, exprs[2].(*expr.Meta).Key)
+		assert.Equal(t, ifname(pair[1]), exprs[3].(*expr.Cmp).Data)
+		assert.Equal(t, expr.VerdictDrop, exprs[len(exprs)-1].(*expr.Verdict).Kind)
+	}
+
+	require.NoError(t, fw.RemoveBridge("br-001001"))
+	assert.Empty(t, conn.Rules(nftables.TableFamilyINet, FirewallTableName, "forward"))
+}
+
+func TestFirewallManager_AntiSpoofing(t *testing.T) {
+	tests := []struct {
+		name      string
+		ip        string
+		wantRules int
+	}{
+		{"MAC and IP", "192.168.127.10", 6},
+		{"MAC only without allocated IP", "", 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fw, conn := newTestFirewall()
+			ep := testEndpoint("task-1", "tap-abc-0", tt.ip)
+
+			require.NoError(t, fw.AddEndpoints(ep))
+
+			jumps := conn.Rules(nftables.TableFamilyBridge, FirewallTableName, "prerouting")
+			require.Len(t, jumps, 1)
+			verdict := jumps[0].Exprs[len(jumps[0].Exprs)-1].(*expr.Verdict)
+			assert.Equal(t, expr.VerdictJump, verdict.Kind)
+			assert.Equal(t, "from-tap-abc-0", verdict.Chain)
+
+			rules := conn.Rules(nftables.TableFamilyBridge, FirewallTableName, "from-tap-abc-0")
+			assert.Len(t, rules, tt.wantRules)
+
+			mac, _ := net.ParseMAC(ep.MAC)
+			first := rules[0].Exprs[1].(*expr.Cmp)
+			assert.Equal(t, expr.CmpOpNeq, first.Op)
+			assert.Equal(t, []byte(mac), first.Data)
+
+			// Only IPv4 and ARP leave the TAP
+			protocols := rules[1].Exprs
+			assert.Equal(t, expr.MetaKeyPROTOCOL, protocols[0].(*expr.Meta).Key)
+			assert.Equal(t, []byte{0x08, 0x00}, protocols[1].(*expr.Cmp).Data)
+			assert.Equal(t, []byte{0x08, 0x06}, protocols[2].(*expr.Cmp).Data)
+			assert.Equal(t, expr.VerdictDrop, protocols[len(protocols)-1].(*expr.Verdict).Kind)
+		})
+	}
+}
+
+func TestFirewallManager_PortPublishing(t *testing.T) {
+	fw, conn := newTestFirewall()
+
+	ep := testEndpoint("task-1", "tap-abc-0", "192.168.127.10")
+	ep.Ports = []types.PortConfig{
+		{Protocol: "tcp", TargetPort: 80, PublishedPort: 8080},
+		{Protocol: "udp", TargetPort: 53, PublishedPort: 5353},
+		{Protocol: "tcp", TargetPort: 9000}, // not published
+	}
+	noIP := testEndpoint("task-2", "tap-def-0", "")
+	noIP.Ports = []types.PortConfig{{Protocol: "tcp", TargetPort: 80, PublishedPort: 8081}}
+
+	require.NoError(t, fw.AddEndpoints(ep, noIP))
+
+	for _, chain := range []string{"prerouting", "output"} {
+		rules := conn.Rules(nftables.TableFamilyINet, FirewallTableName, chain)
+		require.Len(t, rules, 2, chain)
+		nat := rules[0].Exprs[len(rules[0].Exprs)-1].(*expr.NAT)
+		assert.Equal(t, expr.NATTypeDestNAT, nat.Type)
+	}
+}
+
+func TestFirewallManager_Policies(t *testing.T) {
+	fw, conn := newTestFirewall()
+
+	ingress, err := ParseNetworkPolicy("tcp:80,tcp:5432@10.0.0.0/8")
+	require.NoError(t, err)
+	egress, err := ParseNetworkPolicy("none")
+	require.NoError(t, err)
+
+	ep := testEndpoint("task-1", "tap-abc-0", "192.168.127.10")
+	ep.Ingress = ingress
+	ep.Egress = egress
+	require.NoError(t, fw.AddEndpoints(ep))
+
+	// established + arp + two allow entries + drop
+	to := conn.Rules(nftables.TableFamilyBridge, FirewallTableName, "to-tap-abc-0")
+	require.Len(t, to, 5)
+	last := to[len(to)-1].Exprs[len(to[len(to)-1].Exprs)-1].(*expr.Verdict)
+	assert.Equal(t, expr.VerdictDrop, last.Kind)
+
+	// anti-spoofing + established + arp + drop
+	from := conn.Rules(nftables.TableFamilyBridge, FirewallTableName, "from-tap-abc-0")
+	assert.Len(t, from, 6+3)
+
+	assert.Len(t, conn.Rules(nftables.TableFamilyBridge, FirewallTableName, "forward"), 1)
+	assert.Len(t, conn.Rules(nftables.TableFamilyBridge, FirewallTableName, "output"), 1)
+}
+
+func TestFirewallManager_RemoveTask(t *testing.T) {
+	fw, conn := newTestFirewall()
+
+	require.NoError(t, fw.AddEndpoints(
+		testEndpoint("task-1", "tap-abc-0", "192.168.127.10"),
+		testEndpoint("task-1", "tap-abc-1", "10.0.9.4"),
+		testEndpoint("task-2", "tap-def-0", "192.168.127.11"),
+	))
+	require.Len(t, conn.Rules(nftables.TableFamilyBridge, FirewallTableName, "prerouting"), 3)
+
+	require.NoError(t, fw.RemoveTask("task-1"))
+	assert.Len(t, conn.Rules(nftables.TableFamilyBridge, FirewallTableName, "prerouting"), 1)
+	assert.NotContains(t, conn.Chains(nftables.TableFamilyBridge, FirewallTableName), "from-tap-abc-0")
+
+	// Unknown tasks do not trigger a commit
+	flushes := conn.Flushes
+	require.NoError(t, fw.RemoveTask("task-unknown"))
+	assert.Equal(t, flushes, conn.Flushes)
+}
+
+func TestFirewallManager_PersistRestoresRules(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "firewall.json")
+
+	fw, _ := newTestFirewall()
+	require.NoError(t, fw.Persist(path))
+	require.NoError(t, fw.AddMasquerade("192.168.127.0/24", "swarm-br0"))
+	ingress, err := ParseNetworkPolicy("tcp:80@10.0.0.0/8")
+	require.NoError(t, err)
+	ep := testEndpoint("task-1", "tap-abc-0", "192.168.127.10")
+	ep.Ingress = ingress
+	ep.Ports = []types.PortConfig{{Protocol: "tcp", TargetPort: 80, PublishedPort: 8080}}
+	require.NoError(t, fw.AddEndpoints(ep, testEndpoint("task-2", "tap-def-0", "192.168.127.11")))
+
+	// A restarted agent starts from an empty kernel ruleset
+	restarted, conn := newTestFirewall()
+	require.NoError(t, restarted.Persist(path))
+	require.NoError(t, restarted.Reconcile())
+
+	assert.Len(t, conn.Rules(nftables.TableFamilyBridge, FirewallTableName, "prerouting"), 2)
+	assert.NotEmpty(t, conn.Rules(nftables.TableFamilyBridge, FirewallTableName, "to-tap-abc-0"))
+	assert.Len(t, conn.Rules(nftables.TableFamilyINet, FirewallTableName, "prerouting"), 1)
+	assert.Len(t, conn.Rules(nftables.TableFamilyINet, FirewallTableName, "postrouting"), 1)
+
+	assert.Equal(t, 1, restarted.Prune(func(taskID string) bool { return taskID == "task-1" }))
+	require.NoError(t, restarted.Reconcile())
+	assert.Len(t, conn.Rules(nftables.TableFamilyBridge, FirewallTableName, "prerouting"), 1)
+	assert.NotContains(t, conn.Chains(nftables.TableFamilyBridge, FirewallTableName), "from-tap-def-0")
+
+	// A missing file is an empty state, a corrupt one an error
+	fresh, _ := newTestFirewall()
+	assert.NoError(t, fresh.Persist(filepath.Join(t.TempDir(), "missing.json")))
+	require.NoError(t, os.WriteFile(path, []byte("{"), 0640))
+	assert.Error(t, fresh.Persist(path))
+}
+
+func TestNetworkManager_ReconcileFirewall(t *testing.T) {
+	conn := NewFakeNFTablesConn()
+	nm := NewNetworkManager(types.NetworkConfig{BridgeName: "test-br0", StateDir: t.TempDir()}).(*NetworkManager)
+	nm.firewall.connect = conn.Connect
+	require.NoError(t, nm.firewall.AddEndpoints(testEndpoint("task-1", "tap-abc-0", "192.168.127.10")))
+
+	assert.Zero(t, nm.ReconcileFirewall(func(string) bool { return true }))
+	assert.Equal(t, 1, nm.ReconcileFirewall(func(string) bool { return false }))
+	assert.Empty(t, conn.Rules(nftables.TableFamilyBridge, FirewallTableName, "prerouting"))
+	_, err := os.Stat(filepath.Join(nm.config.StateDir, "firewall.json"))
+	assert.NoError(t, err)
+}
+
+func TestFirewallManager_FlushFailureKeepsRuleset(t *testing.T) {
+	fw, conn := newTestFirewall()
+	require.NoError(t, fw.AddEndpoints(testEndpoint("task-1", "tap-abc-0", "192.168.127.10")))
+
+	conn.FlushErr = errors.New("operation not permitted")
+	err := fw.AddEndpoints(testEndpoint("task-2", "tap-def-0", "192.168.127.11"))
+	assert.Error(t, err)
+
+	conn.FlushErr = nil
+	assert.Len(t, conn.Rules(nftables.TableFamilyBridge, FirewallTableName, "prerouting"), 1)
+}
+
+func TestFirewallManager_InvalidEndpoint(t *testing.T) {
+	fw, _ := newTestFirewall()
+
+	assert.Error(t, fw.AddEndpoints(&FirewallEndpoint{TaskID: "t", Tap: "tap-0", MAC: "bogus"}))
+	assert.Error(t, fw.AddEndpoints(&FirewallEndpoint{TaskID: "t", Tap: "tap-0", MAC: "AA:FC:00:00:00:01", IP: "fd00::1"}))
+}
+
+func TestParseNetworkPolicy(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    *NetworkPolicy
+		wantErr bool
+	}{
+		{name: "empty allows all", value: "", want: nil},
+		{name: "none denies all", value: "none", want: &NetworkPolicy{}},
+		{
+			name:  "protocol and port",
+			value: "tcp:80, udp:53",
+			want: &NetworkPolicy{Rules: []PolicyRule{
+				{Protocol: "tcp", Port: 80},
+				{Protocol: "udp", Port: 53},
+			}},
+		},
+		{
+			name:  "cidr only",
+			value: "10.0.0.0/8",
+			want: &NetworkPolicy{Rules: []PolicyRule{
+				{Peer: &net.IPNet{IP: net.IPv4(10, 0, 0, 0).To4(), Mask: net.CIDRMask(8, 32)}},
+			}},
+		},
+		{
+			name:  "protocol with peer",
+			value: "TCP:5432@192.168.0.0/16,icmp",
+			want: &NetworkPolicy{Rules: []PolicyRule{
+				{Protocol: "tcp", Port: 5432, Peer: &net.IPNet{IP: net.IPv4(192, 168, 0, 0).To4(), Mask: net.CIDRMask(16, 32)}},
+				{Protocol: "icmp"},
+			}},
+		},
+		{name: "unknown protocol", value: "gre", wantErr: true},
+		{name: "bad port", value: "tcp:http", wantErr: true},
+		{name: "zero port", value: "tcp:0", wantErr: true},
+		{name: "icmp with port", value: "icmp:8", wantErr: true},
+		{name: "bad cidr", value: "tcp:80@10.0.0.0/40", wantErr: true},
+		{name: "ipv6 cidr", value: "fd00::/64", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseNetworkPolicy(tt.value)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestPoliciesFromLabels(t *testing.T) {
+	ingress, egress, err := PoliciesFromLabels(map[string]string{
+		IngressPolicyLabel: "tcp:443",
+	})
+	require.NoError(t, err)
+	require.NotNil(t, ingress)
+	assert.Len(t, ingress.Rules, 1)
+	assert.Nil(t, egress)
+
+	_, _, err = PoliciesFromLabels(map[string]string{EgressPolicyLabel: "tcp:99999"})
+	assert.ErrorContains(t, err, EgressPolicyLabel)
+}
@@ -0,0 +1,247 @@
+// Package network provides guest-side network configuration for Firecracker VMs.
+package network
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/restuhaqza/swarmcracker/pkg/types"
+)
+
+// Kernel command line keys used to hand the guest its network configuration.
+// The names contain a dot so the kernel treats them as (unknown) module
+// parameters and does not forward them to init as argv or environment.
+const (
+	GuestInterfaceArg = "swarmcracker.if"
+	GuestRouteArg     = "swarmcracker.route"
+)
+
+// Default MTUs for guest interfaces.
+const (
+	DefaultBridgeMTU  = 1500
+	DefaultOverlayMTU = 1450 // 50 bytes of VXLAN encapsulation overhead
+)
+
+// GuestInterface describes how the guest should configure one NIC.
+type GuestInterface struct {
+	Name      string   // Guest device name (eth0, eth1, ...)
+	MAC       string   // Guest MAC address
+	MTU       int      // Interface MTU
+	Addresses []string // IPv4 addresses in CIDR notation
+}
+
+// GuestRoute describes a route the guest should install.
+type GuestRoute struct {
+	Destination string // "default" or a CIDR
+	Gateway     string // Next hop; empty for a route to a directly attached subnet
+	Device      string
+}
+
+// GuestNetworkConfig is the full network configuration handed to the guest.
+type GuestNetworkConfig struct {
+	Interfaces []GuestInterface
+	Routes     []GuestRoute
+}
+
+// TapName returns the host TAP device name for a task's interface index.
+// Format: tap-<sha256(taskID)[:12]>-<index>.
+func TapName(taskID string, index int) string {
+	hash := sha256.Sum256([]byte(taskID))
+	return fmt.Sprintf("tap-%s-%d", hex.EncodeToString(hash[:])[:12], index)
+}
+
+// GuestMAC returns a stable, locally administered unicast MAC address for a
+// task's interface. The address is derived from the task ID, the network ID
+// and the interface index so that every VM on a shared bridge gets a
+// distinct MAC and restarts of the same task keep the same one.
+func GuestMAC(taskID, networkID string, index int) string {
+	h := sha256.New()
+	h.Write([]byte(taskID))
+	h.Write([]byte{0})
+	h.Write([]byte(networkID))
+	h.Write([]byte{0})
+	h.Write([]byte(strconv.Itoa(index)))
+	sum := h.Sum(nil)
+
+	// AA:FC is the prefix Firecracker uses in its own examples; 0xAA has the
+	// locally administered bit set and the multicast bit clear.
+	return fmt.Sprintf("AA:FC:%02X:%02X:%02X:%02X", sum[0], sum[1], sum[2], sum[3])
+}
+
+// GuestMTU returns the MTU a guest interface should use on the given driver.
+func GuestMTU(driver string) int {
+	if IsOverlay(driver) {
+		return DefaultOverlayMTU
+	}
+	return DefaultBridgeMTU
+}
+
+// AttachmentGateway returns the gateway guests on an attachment route
+// through: the network's own gateway on overlays, and gateway, the node
+// bridge's address, otherwise.
+func AttachmentGateway(attachment types.NetworkAttachment, gateway string) string {
+	if !IsOverlay(attachment.Network.Spec.Driver) {
+		return gateway
+	}
+	gw, _, _ := strings.Cut(OverlayGateway(attachment), "/")
+	return gw
+}
+
+// CheckGuestAddresses returns an error if an attachment of the task has an
+// address other than an IPv4 CIDR. Bridges, overlays, DHCP and the
+// anti-spoofing rules only handle IPv4, so a task with IPv6 addresses is
+// refused rather than started with half its addressing.
+func CheckGuestAddresses(task *types.Task) error {
+	if task == nil {
+		return nil
+	}
+	for _, attachment := range task.Networks {
+		for _, addr := range attachment.Addresses {
+			ip, _, err := net.ParseCIDR(addr)
+			if err != nil {
+				return fmt.Errorf("network %s: invalid address %q", attachment.Network.ID, addr)
+			}
+			if ip.To4() == nil {
+				return fmt.Errorf("network %s: IPv6 address %s is not supported", attachment.Network.ID, addr)
+			}
+		}
+	}
+	return nil
+}
+
+// BuildGuestNetworkConfig builds the guest configuration for every network
+// attachment of a task. The primary (first addressed) interface gets the
+// default route, through gateway on the node bridge or the network's own
+// gateway on overlays. Every later interface gets a route to its network's
+// subnet, unless an earlier interface is already attached to it. Addresses
+// that CheckGuestAddresses rejects are left out.
+func BuildGuestNetworkConfig(task *types.Task, gateway string) *GuestNetworkConfig {
+	cfg := &GuestNetworkConfig{}
+	if task == nil {
+		return cfg
+	}
+
+	var attached []*net.IPNet
+	for i, attachment := range task.Networks {
+		iface := GuestInterface{
+			Name: fmt.Sprintf("eth%d", i),
+			MAC:  GuestMAC(task.ID, attachment.Network.ID, i),
+			MTU:  GuestMTU(attachment.Network.Spec.Driver),
+		}
+		var subnets []*net.IPNet
+		for _, addr := range attachment.Addresses {
+			if ip, ipNet, err := net.ParseCIDR(addr); err == nil && ip.To4() != nil {
+				iface.Addresses = append(iface.Addresses, addr)
+				subnets = append(subnets, ipNet)
+			}
+		}
+		cfg.Interfaces = append(cfg.Interfaces, iface)
+		if len(iface.Addresses) == 0 {
+			continue
+		}
+
+		hasDefault := false
+		for _, r := range cfg.Routes {
+			if r.Destination == "default" {
+				hasDefault = true
+			}
+		}
+		if gw := AttachmentGateway(attachment, gateway); !hasDefault && gw != "" {
+			cfg.Routes = append(cfg.Routes, GuestRoute{
+				Destination: "default",
+				Gateway:     gw,
+				Device:      iface.Name,
+			})
+		} else if hasDefault {
+			// The network's subnet may be wider than the address's prefix
+			if _, ipNet, err := net.ParseCIDR(attachment.Network.Subnet); err == nil && ipNet.IP.To4() != nil {
+				subnets = []*net.IPNet{ipNet}
+			}
+			for _, subnet := range subnets {
+				if overlapsAny(subnet, attached) {
+					continue
+				}
+				cfg.Routes = append(cfg.Routes, GuestRoute{
+					Destination: subnet.String(),
+					Device:      iface.Name,
+				})
+				attached = append(attached, subnet)
+			}
+		}
+		attached = append(attached, subnets...)
+	}
+
+	return cfg
+}
+
+// overlapsAny reports whether subnet overlaps one of nets.
+func overlapsAny(subnet *net.IPNet, nets []*net.IPNet) bool {
+	for _, n := range nets {
+		if n.Contains(subnet.IP) || subnet.Contains(n.IP) {
+			return true
+		}
+	}
+	return false
+}
+
+// BootArgs encodes the configuration as kernel command line arguments:
+//
+//	swarmcracker.if=<dev>,<mac>,<mtu>[,<cidr>...]
+//	swarmcracker.route=<dest>,[<gateway>],<dev>
+//
+// Interfaces are emitted before routes so the guest can apply them in order.
+func (c *GuestNetworkConfig) BootArgs() []string {
+	var args []string
+	for _, iface := range c.Interfaces {
+		fields := []string{iface.Name, iface.MAC, strconv.Itoa(iface.MTU)}
+		fields = append(fields, iface.Addresses...)
+		args = append(args, GuestInterfaceArg+"="+strings.Join(fields, ","))
+	}
+	for _, r := range c.Routes {
+		args = append(args, fmt.Sprintf("%s=%s,%s,%s", GuestRouteArg, r.Destination, r.Gateway, r.Device))
+	}
+	return args
+}
+
+// ParseGuestBootArgs decodes the configuration from a kernel command line.
+// Unrelated arguments are ignored.
+func ParseGuestBootArgs(cmdline string) (*GuestNetworkConfig, error) {
+	cfg := &GuestNetworkConfig{}
+	for _, arg := range strings.Fields(cmdline) {
+		key, value, ok := strings.Cut(arg, "=")
+		if !ok {
+			continue
+		}
+		fields := strings.Split(value, ",")
+		switch key {
+		case GuestInterfaceArg:
+			if len(fields) < 3 {
+				return nil, fmt.Errorf("malformed %s argument: %q", GuestInterfaceArg, value)
+			}
+			mtu, err := strconv.Atoi(fields[2])
+			if err != nil {
+				return nil, fmt.Errorf("invalid MTU in %q: %w", value, err)
+			}
+			cfg.Interfaces = append(cfg.Interfaces, GuestInterface{
+				Name:      fields[0],
+				MAC:       fields[1],
+				MTU:       mtu,
+				Addresses: fields[3:],
+			})
+		case GuestRouteArg:
+			if len(fields) != 3 {
+				return nil, fmt.Errorf("malformed %s argument: %q", GuestRouteArg, value)
+			}
+			cfg.Routes = append(cfg.Routes, GuestRoute{
+				Destination: fields[0],
+				Gateway:     fields[1],
+				Device:      fields[2],
+			})
+		}
+	}
+	return cfg, nil
+}
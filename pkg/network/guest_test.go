@@ -0,0 +1,160 @@
+package network
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/restuhaqza/swarmcracker/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTapName(t *testing.T) {
+	name := TapName("task-1", 0)
+	assert.True(t, strings.HasPrefix(name, "tap-"))
+	assert.True(t, strings.HasSuffix(name, "-0"))
+	assert.Equal(t, name, TapName("task-1", 0))
+	assert.NotEqual(t, name, TapName("task-1", 1))
+	assert.NotEqual(t, name, TapName("task-2", 0))
+}
+
+func TestGuestMAC(t *testing.T) {
+	tests := []struct {
+		name      string
+		taskA     string
+		netA      string
+		indexA    int
+		taskB     string
+		netB      string
+		indexB    int
+		wantEqual bool
+	}{
+		{"same inputs are stable", "task-1", "net-1", 0, "task-1", "net-1", 0, true},
+		{"different tasks on same network", "task-1", "net-1", 0, "task-2", "net-1", 0, false},
+		{"same task on different networks", "task-1", "net-1", 0, "task-1", "net-2", 0, false},
+		{"same network at different index", "task-1", "net-1", 0, "task-1", "net-1", 1, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := GuestMAC(tt.taskA, tt.netA, tt.indexA)
+			b := GuestMAC(tt.taskB, tt.netB, tt.indexB)
+			assert.Len(t, a, 17)
+			assert.True(t, strings.HasPrefix(a, "AA:FC:"))
+			assert.Equal(t, tt.wantEqual, a == b)
+		})
+	}
+}
+
+func TestGuestMTU(t *testing.T) {
+	assert.Equal(t, DefaultOverlayMTU, GuestMTU("overlay"))
+	assert.Equal(t, DefaultBridgeMTU, GuestMTU("bridge"))
+	assert.Equal(t, DefaultBridgeMTU, GuestMTU(""))
+}
+
+func TestBuildGuestNetworkConfig(t *testing.T) {
+	task := &types.Task{
+		ID: "task-1",
+		Networks: []types.NetworkAttachment{
+			{
+				Network:   types.Network{ID: "net-a", Spec: types.NetworkSpec{Driver: "bridge"}},
+				Addresses: []string{"192.168.127.5/24", "fd00::5/64", "garbage"},
+			},
+			{
+				Network:   types.Network{ID: "net-b", Spec: types.NetworkSpec{Driver: "overlay"}},
+				Addresses: []string{"10.0.1.7/24"},
+			},
+		},
+	}
+
+	cfg := BuildGuestNetworkConfig(task, "192.168.127.1")
+	require.Len(t, cfg.Interfaces, 2)
+
+	assert.Equal(t, "eth0", cfg.Interfaces[0].Name)
+	assert.Equal(t, []string{"192.168.127.5/24"}, cfg.Interfaces[0].Addresses)
+	assert.Equal(t, DefaultBridgeMTU, cfg.Interfaces[0].MTU)
+	assert.Equal(t, GuestMAC("task-1", "net-a", 0), cfg.Interfaces[0].MAC)
+
+	assert.Equal(t, "eth1", cfg.Interfaces[1].Name)
+	assert.Equal(t, DefaultOverlayMTU, cfg.Interfaces[1].MTU)
+
+	// The primary interface carries the default route, the others a route
+	// to their network's subnet
+	assert.Equal(t, []GuestRoute{
+		{Destination: "default", Gateway: "192.168.127.1", Device: "eth0"},
+		{Destination: "10.0.1.0/24", Device: "eth1"},
+	}, cfg.Routes)
+}
+
+func TestBuildGuestNetworkConfig_SecondaryRoutes(t *testing.T) {
+	task := &types.Task{
+		ID: "task-1",
+		Networks: []types.NetworkAttachment{
+			{Network: types.Network{ID: "net-a"}, Addresses: []string{"192.168.127.5/24"}},
+			{Network: types.Network{ID: "net-b", Subnet: "10.1.0.0/16"}, Addresses: []string{"10.1.2.7/24"}},
+			{Network: types.Network{ID: "net-c"}, Addresses: []string{"192.168.127.9/24"}},
+		},
+	}
+
+	cfg := BuildGuestNetworkConfig(task, "192.168.127.1")
+	assert.Equal(t, []GuestRoute{
+		{Destination: "default", Gateway: "192.168.127.1", Device: "eth0"},
+		{Destination: "10.1.0.0/16", Device: "eth1"},
+	}, cfg.Routes, "the network's whole subnet is routed, and eth0's subnet is not moved to eth2")
+}
+
+func TestCheckGuestAddresses(t *testing.T) {
+	attach := func(addrs ...string) *types.Task {
+		return &types.Task{Networks: []types.NetworkAttachment{{Network: types.Network{ID: "net-a"}, Addresses: addrs}}}
+	}
+	assert.NoError(t, CheckGuestAddresses(nil))
+	assert.NoError(t, CheckGuestAddresses(attach("10.0.0.2/24")))
+	assert.ErrorContains(t, CheckGuestAddresses(attach("10.0.0.2/24", "fd00::2/64")), "IPv6 address fd00::2/64 is not supported")
+	assert.ErrorContains(t, CheckGuestAddresses(attach("10.0.0.2")), "invalid address")
+}
+
+func TestBuildGuestNetworkConfig_NoGateway(t *testing.T) {
+	task := &types.Task{
+		ID:       "task-1",
+		Networks: []types.NetworkAttachment{{Network: types.Network{ID: "net-a"}, Addresses: []string{"10.0.0.2/24"}}},
+	}
+	cfg := BuildGuestNetworkConfig(task, "")
+	assert.Len(t, cfg.Interfaces, 1)
+	assert.Empty(t, cfg.Routes)
+
+	assert.Empty(t, BuildGuestNetworkConfig(nil, "10.0.0.1").Interfaces)
+}
+
+func TestGuestBootArgs_RoundTrip(t *testing.T) {
+	cfg := &GuestNetworkConfig{
+		Interfaces: []GuestInterface{
+			{Name: "eth0", MAC: "AA:FC:01:02:03:04", MTU: 1500, Addresses: []string{"192.168.127.5/24"}},
+			{Name: "eth1", MAC: "AA:FC:05:06:07:08", MTU: 1450, Addresses: []string{"10.0.1.7/24", "10.0.2.7/24"}},
+		},
+		Routes: []GuestRoute{
+			{Destination: "default", Gateway: "192.168.127.1", Device: "eth0"},
+			{Destination: "10.0.0.0/16", Device: "eth1"},
+		},
+	}
+
+	args := cfg.BootArgs()
+	assert.Equal(t, "swarmcracker.if=eth0,AA:FC:01:02:03:04,1500,192.168.127.5/24", args[0])
+	assert.Equal(t, "swarmcracker.route=default,192.168.127.1,eth0", args[2])
+	assert.Equal(t, "swarmcracker.route=10.0.0.0/16,,eth1", args[3])
+
+	cmdline := "console=ttyS0 reboot=k ip=dhcp " + strings.Join(args, " ") + " -- /bin/sh"
+	parsed, err := ParseGuestBootArgs(cmdline)
+	require.NoError(t, err)
+	assert.Equal(t, cfg, parsed)
+}
+
+func TestParseGuestBootArgs_Malformed(t *testing.T) {
+	_, err := ParseGuestBootArgs("swarmcracker.if=eth0")
+	assert.Error(t, err)
+
+	_, err = ParseGuestBootArgs("swarmcracker.if=eth0,AA:FC:00:00:00:01,big")
+	assert.Error(t, err)
+
+	_, err = ParseGuestBootArgs("swarmcracker.route=default,10.0.0.1")
+	assert.Error(t, err)
+}
@@ -8,6 +8,7 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/google/nftables"
 	"github.com/restuhaqza/swarmcracker/pkg/network/testhelpers"
 	"github.com/restuhaqza/swarmcracker/pkg/types"
 	"github.com/stretchr/testify/assert"
@@ -287,10 +288,7 @@ func TestIntegration_NetworkManager_SetupNAT(t *testing.T) {
 	subnet := "10.99.5.0/24"
 
 	t.Cleanup(func() {
-		// Clean up iptables rules
-		testhelpers.CleanupIptablesRule(t, "nat", "POSTROUTING", "-s", subnet, "-j", "MASQUERADE")
-		testhelpers.CleanupIptablesRule(t, "filter", "FORWARD", "-i", bridgeName, "-j", "ACCEPT")
-		testhelpers.CleanupIptablesRule(t, "filter", "FORWARD", "-o", bridgeName, "-j", "ACCEPT")
+		cleanupFirewallTables(t)
 		testhelpers.CleanupLink(t, bridgeName)
 	})
 
@@ -307,10 +305,53 @@ func TestIntegration_NetworkManager_SetupNAT(t *testing.T) {
 	err := nm.setupNAT(t.Context())
 	assert.NoError(t, err)
 
-	// Verify iptables rules
-	assert.True(t, testhelpers.IptablesRuleExists(t, "nat", "POSTROUTING", "-s", subnet, "-j", "MASQUERADE"))
-	assert.True(t, testhelpers.IptablesRuleExists(t, "filter", "FORWARD", "-i", bridgeName, "-j", "ACCEPT"))
-	assert.True(t, testhelpers.IptablesRuleExists(t, "filter", "FORWARD", "-o", bridgeName, "-j", "ACCEPT"))
+	// Verify the masquerade rule landed in our nftables table
+	conn, err := nftables.New()
+	require.NoError(t, err)
+	table := &nftables.Table{Name: FirewallTableName, Family: nftables.TableFamilyINet}
+	rules, err := conn.GetRules(table, &nftables.Chain{Name: "postrouting", Table: table})
+	require.NoError(t, err)
+	assert.Len(t, rules, 1)
+}
+
+// cleanupFirewallTables removes the swarmcracker nftables tables.
+func cleanupFirewallTables(t *testing.T) {
+	t.Helper()
+	conn, err := nftables.New()
+	if err != nil {
+		return
+	}
+	for _, family := range []nftables.TableFamily{nftables.TableFamilyINet, nftables.TableFamilyBridge} {
+		table := &nftables.Table{Name: FirewallTableName, Family: family}
+		conn.AddTable(table)
+		conn.DelTable(table)
+	}
+	if err := conn.Flush(); err != nil {
+		t.Logf("failed to remove firewall tables: %v", err)
+	}
+}
+
+// TestIntegration_Firewall_Endpoints tests that the kernel accepts NAT,
+// port publishing and anti-spoofing rules. Policies are left out because
+// they need bridge conntrack (nf_conntrack_bridge), which minimal kernels lack.
+func TestIntegration_Firewall_Endpoints(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+	testhelpers.RequireRoot(t)
+	t.Cleanup(func() { cleanupFirewallTables(t) })
+
+	fw := NewFirewallManager(newFirewallConn)
+	require.NoError(t, fw.Reconcile())
+	require.NoError(t, fw.AddMasquerade("10.99.8.0/24", "test-br-fw"))
+	require.NoError(t, fw.AddEndpoints(&FirewallEndpoint{
+		TaskID: "task-fw",
+		Tap:    TapName("task-fw", 0),
+		IP:     "10.99.8.10",
+		MAC:    GuestMAC("task-fw", "net-1", 0),
+		Ports:  []types.PortConfig{{Protocol: "tcp", TargetPort: 80, PublishedPort: 18080}},
+	}))
+	require.NoError(t, fw.RemoveTask("task-fw"))
 }
 
 // TestIntegration_NetworkManager_CreateTapDevice tests TAP device creation.
@@ -435,11 +476,7 @@ func TestIntegration_NetworkManager_FullPrepareCleanup(t *testing.T) {
 
 	bridgeName := testhelpers.RandomName("test-br")
 	t.Cleanup(func() {
-		// Clean up iptables rules
-		subnet := "10.99.7.0/24"
-		testhelpers.CleanupIptablesRule(t, "nat", "POSTROUTING", "-s", subnet, "-j", "MASQUERADE")
-		testhelpers.CleanupIptablesRule(t, "filter", "FORWARD", "-i", bridgeName, "-j", "ACCEPT")
-		testhelpers.CleanupIptablesRule(t, "filter", "FORWARD", "-o", bridgeName, "-j", "ACCEPT")
+		cleanupFirewallTables(t)
 
 		// Clean up TAP devices
 		output, _ := testhelpers.RunOutput(t, "ip", "link", "show", "type", "tap")
@@ -450,9 +487,6 @@ func TestIntegration_NetworkManager_FullPrepareCleanup(t *testing.T) {
 			}
 		}
 		testhelpers.CleanupLink(t, bridgeName)
-
-		// Kill dnsmasq for this bridge
-		testhelpers.RunCombined(t, "pkill", "-f", fmt.Sprintf("dnsmasq.*%s", bridgeName))
 	})
 
 	config := defaultNetworkConfig()
@@ -462,7 +496,10 @@ func TestIntegration_NetworkManager_FullPrepareCleanup(t *testing.T) {
 	config.IPMode = "static"
 	config.NATEnabled = true
 
+	config.StateDir = t.TempDir()
+
 	nm := NewNetworkManager(config).(*NetworkManager)
+	defer nm.Shutdown()
 
 	task := &types.Task{
 		ID: "integration-vm-1",
@@ -502,6 +539,12 @@ func TestIntegration_NetworkManager_FullPrepareCleanup(t *testing.T) {
 	// Verify network attachment was updated
 	assert.NotEmpty(t, task.Networks[0].Addresses)
 
+	// Verify the built-in DHCP server serves the allocated address
+	require.NotNil(t, nm.dhcpServer)
+	leases := nm.dhcpServer.Leases()
+	require.Len(t, leases, 1)
+	assert.Equal(t, tapIP, leases[0].IP)
+
 	// Cleanup
 	err = nm.CleanupNetwork(t.Context(), task)
 	require.NoError(t, err)
@@ -513,4 +556,5 @@ func TestIntegration_NetworkManager_FullPrepareCleanup(t *testing.T) {
 	// Verify IP was released
 	_, err = nm.GetTapIP("integration-vm-1")
 	assert.Error(t, err)
+	assert.Empty(t, nm.dhcpServer.Leases())
 }
@@ -0,0 +1,111 @@
+// Package network provides persistence for the node IP allocator.
+
+package network
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+
+	"github.com/restuhaqza/swarmcracker/pkg/statefile"
+	"github.com/restuhaqza/swarmcracker/pkg/types"
+	"github.com/rs/zerolog/log"
+)
+
+// LoadIPAMState reads an IPAM state file. A missing file yields an empty state.
+func LoadIPAMState(path string) (*types.IPAMState, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return &types.IPAMState{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read IPAM state: %w", err)
+	}
+
+	var state types.IPAMState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("failed to parse IPAM state %s: %w", path, err)
+	}
+	return &state, nil
+}
+
+// Persist makes the allocator save every change to path and restores the
+// allocations previously saved there for the same subnet.
+func (a *IPAllocator) Persist(path string) error {
+	state, err := LoadIPAMState(path)
+	if err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.stateFile = path
+	for _, pool := range state.Pools {
+		if pool.Subnet != a.subnet.String() {
+			continue
+		}
+		for ip, owner := range pool.Allocations {
+			if a.subnet.Contains(net.ParseIP(ip)) {
+				a.allocated[ip] = owner
+			}
+		}
+	}
+	return nil
+}
+
+// Pool returns a snapshot of the allocator's pool.
+func (a *IPAllocator) Pool() types.IPAMPool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.poolLocked()
+}
+
+func (a *IPAllocator) poolLocked() types.IPAMPool {
+	pool := types.IPAMPool{
+		Subnet:      a.subnet.String(),
+		Gateway:     a.gateway.String(),
+		Reserved:    []string{a.gateway.String()},
+		Allocations: make(map[string]string, len(a.allocated)),
+	}
+	for ip, owner := range a.allocated {
+		pool.Allocations[ip] = owner
+	}
+	return pool
+}
+
+// saveLocked writes the allocations to the state file, if persistence is enabled.
+func (a *IPAllocator) saveLocked() error {
+	if a.stateFile == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(types.IPAMState{Pools: []types.IPAMPool{a.poolLocked()}}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal IPAM state: %w", err)
+	}
+	return statefile.Write(a.stateFile, data, 0640)
+}
+
+// Reconcile releases allocations whose owner is no longer running and
+// returns how many were released.
+func (a *IPAllocator) Reconcile(isRunning func(owner string) bool) int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	released := 0
+	for ip, owner := range a.allocated {
+		if !isRunning(owner) {
+			delete(a.allocated, ip)
+			released++
+		}
+	}
+
+	if released > 0 {
+		if err := a.saveLocked(); err != nil {
+			log.Warn().Err(err).Msg("Failed to save IPAM state")
+		}
+	}
+	return released
+}
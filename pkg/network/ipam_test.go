@@ -0,0 +1,119 @@
+package network
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/restuhaqza/swarmcracker/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIPAllocator_Persist(t *testing.T) {
+	stateFile := filepath.Join(t.TempDir(), "network", "ipam.json")
+
+	a, err := NewIPAllocator("192.168.127.0/24", "192.168.127.1")
+	require.NoError(t, err)
+	require.NoError(t, a.Persist(stateFile))
+
+	ip1, err := a.Allocate("task-1")
+	require.NoError(t, err)
+	ip2, err := a.Allocate("task-2")
+	require.NoError(t, err)
+
+	// A restarted allocator gets the same addresses back
+	restored, err := NewIPAllocator("192.168.127.0/24", "192.168.127.1")
+	require.NoError(t, err)
+	require.NoError(t, restored.Persist(stateFile))
+
+	pool := restored.Pool()
+	assert.Equal(t, "192.168.127.0/24", pool.Subnet)
+	assert.Equal(t, "192.168.127.1", pool.Gateway)
+	assert.Equal(t, map[string]string{ip1: "task-1", ip2: "task-2"}, pool.Allocations)
+
+	got, err := restored.Allocate("task-1")
+	require.NoError(t, err)
+	assert.Equal(t, ip1, got)
+
+	// Releases are persisted too
+	restored.Release(ip2)
+	state, err := LoadIPAMState(stateFile)
+	require.NoError(t, err)
+	require.Len(t, state.Pools, 1)
+	assert.Equal(t, map[string]string{ip1: "task-1"}, state.Pools[0].Allocations)
+
+	// Allocations for another subnet are ignored
+	other, err := NewIPAllocator("10.0.0.0/24", "10.0.0.1")
+	require.NoError(t, err)
+	require.NoError(t, other.Persist(stateFile))
+	assert.Empty(t, other.Pool().Allocations)
+}
+
+func TestIPAllocator_PersistErrors(t *testing.T) {
+	dir := t.TempDir()
+	corrupt := filepath.Join(dir, "ipam.json")
+	require.NoError(t, os.WriteFile(corrupt, []byte("{"), 0640))
+
+	a, err := NewIPAllocator("192.168.127.0/24", "192.168.127.1")
+	require.NoError(t, err)
+	assert.Error(t, a.Persist(corrupt))
+
+	// A state file that cannot be written rolls the allocation back
+	blocker := filepath.Join(dir, "blocker")
+	require.NoError(t, os.WriteFile(blocker, nil, 0640))
+	a.stateFile = filepath.Join(blocker, "ipam.json")
+
+	_, err = a.Allocate("task-1")
+	assert.Error(t, err)
+	assert.Empty(t, a.Pool().Allocations)
+}
+
+func TestIPAllocator_Reconcile(t *testing.T) {
+	stateFile := filepath.Join(t.TempDir(), "ipam.json")
+
+	a, err := NewIPAllocator("192.168.127.0/24", "192.168.127.1")
+	require.NoError(t, err)
+	require.NoError(t, a.Persist(stateFile))
+
+	live, err := a.Allocate("task-live")
+	require.NoError(t, err)
+	_, err = a.Allocate("task-gone")
+	require.NoError(t, err)
+
+	released := a.Reconcile(func(owner string) bool { return owner == "task-live" })
+	assert.Equal(t, 1, released)
+	assert.Equal(t, map[string]string{live: "task-live"}, a.Pool().Allocations)
+
+	state, err := LoadIPAMState(stateFile)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{live: "task-live"}, state.Pools[0].Allocations)
+
+	assert.Zero(t, a.Reconcile(func(string) bool { return true }))
+}
+
+func TestLoadIPAMState_Missing(t *testing.T) {
+	state, err := LoadIPAMState(filepath.Join(t.TempDir(), "missing.json"))
+	require.NoError(t, err)
+	assert.Equal(t, &types.IPAMState{}, state)
+}
+
+func TestNetworkManager_ReconcileIPAM(t *testing.T) {
+	nm := NewNetworkManager(types.NetworkConfig{
+		BridgeName: "test-br0",
+		Subnet:     "192.168.127.0/24",
+		BridgeIP:   "192.168.127.1/24",
+		StateDir:   t.TempDir(),
+	}).(*NetworkManager)
+
+	_, err := nm.ipAllocator.Allocate("task-1")
+	require.NoError(t, err)
+
+	assert.Equal(t, 1, nm.ReconcileIPAM(func(string) bool { return false }))
+	_, err = os.Stat(filepath.Join(nm.config.StateDir, "ipam.json"))
+	assert.NoError(t, err)
+
+	// Without an allocator there is nothing to reconcile
+	empty := NewNetworkManager(types.NetworkConfig{BridgeName: "test-br0"}).(*NetworkManager)
+	assert.Zero(t, empty.ReconcileIPAM(func(string) bool { return false }))
+}
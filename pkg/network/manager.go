@@ -5,14 +5,14 @@ import (
 	"context"
 	"crypto/sha256"
 	"encoding/binary"
-	"encoding/hex"
 	"fmt"
 	"net"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"sort"
 	"strings"
 	"sync"
-	"time"
 
 	"github.com/restuhaqza/swarmcracker/pkg/types"
 	"github.com/rs/zerolog/log"
@@ -40,9 +40,13 @@ type NetworkManager struct {
 	vxlanMgr      *VXLANManager
 	peerDiscovery bool
 	peerCancel    context.CancelFunc
-	nodeDiscovery types.NodeDiscovery // SwarmKit node discovery provider
-	cniClient     *CNIClient          // CNI client for SwarmKit network attachments
-	pendingPeers  []string            // Peers queued before VXLAN init
+	nodeDiscovery types.NodeDiscovery       // SwarmKit node discovery provider
+	cniClient     *CNIClient                // CNI client for SwarmKit network attachments
+	pendingPeers  []string                  // Peers queued before VXLAN init
+	firewall      *FirewallManager          // nftables rules for NAT, anti-spoofing and policies
+	dhcpServer    *DHCPServer               // Built-in DHCP server on the bridges
+	dnsServer     *DNSServer                // Built-in DNS forwarder on the node bridge
+	networks      map[string]*networkBridge // Per-network bridges of overlay networks, by network ID
 }
 
 // TapDevice represents a TAP device.
@@ -53,6 +57,8 @@ type TapDevice struct {
 	Netmask string
 	Gateway string
 	Subnet  string
+	MAC     string // Guest MAC address assigned to the interface
+	MTU     int
 }
 
 // IPAllocator handles static IP allocation.
@@ -60,6 +66,7 @@ type IPAllocator struct {
 	subnet    *net.IPNet
 	gateway   net.IP
 	allocated map[string]string // Track allocated IPs (IP -> VM ID)
+	stateFile string            // Empty keeps allocations in memory only
 	mu        sync.Mutex
 }
 
@@ -120,6 +127,10 @@ func (a *IPAllocator) Allocate(vmID string) (string, error) {
 		if !isGateway && !isAllocated {
 			// Found free IP
 			a.allocated[ipStr] = vmID
+			if err := a.saveLocked(); err != nil {
+				delete(a.allocated, ipStr)
+				return "", err
+			}
 			return ipStr, nil
 		}
 
@@ -224,7 +235,13 @@ func incIP(ip net.IP) net.IP {
 func (a *IPAllocator) Release(ip string) {
 	a.mu.Lock()
 	defer a.mu.Unlock()
+	if _, ok := a.allocated[ip]; !ok {
+		return
+	}
 	delete(a.allocated, ip)
+	if err := a.saveLocked(); err != nil {
+		log.Warn().Err(err).Str("ip", ip).Msg("Failed to save IPAM state")
+	}
 }
 
 // NewNetworkManager creates a new NetworkManager.
@@ -233,6 +250,17 @@ func NewNetworkManager(config types.NetworkConfig) types.NetworkManager {
 		config:     config,
 		bridges:    make(map[string]bool),
 		tapDevices: make(map[string]*TapDevice),
+		networks:   make(map[string]*networkBridge),
+		firewall: NewFirewallManager(func() (NFTablesConn, error) {
+			return newFirewallConn()
+		}),
+	}
+
+	// Keep firewall rules across restarts so running VMs stay protected
+	if config.StateDir != "" {
+		if err := nm.firewall.Persist(filepath.Join(config.StateDir, "firewall.json")); err != nil {
+			log.Warn().Err(err).Msg("Failed to restore firewall rules")
+		}
 	}
 
 	// Initialize IP allocator if subnet and bridge IP are configured
@@ -243,6 +271,12 @@ func NewNetworkManager(config types.NetworkConfig) types.NetworkManager {
 		if err != nil {
 			log.Error().Err(err).Msg("Failed to initialize IP allocator")
 		} else {
+			// Keep allocations across restarts so running VMs never lose their IP
+			if config.StateDir != "" {
+				if err := allocator.Persist(filepath.Join(config.StateDir, "ipam.json")); err != nil {
+					log.Warn().Err(err).Msg("Failed to restore IP allocations")
+				}
+			}
 			nm.ipAllocator = allocator
 		}
 	}
@@ -270,6 +304,14 @@ func (nm *NetworkManager) Init(ctx context.Context) error {
 		return fmt.Errorf("failed to setup bridge: %w", err)
 	}
 
+	// Replace whatever a crash or previous boot left in the kernel with the
+	// persisted desired state; ReconcileFirewall later drops dead tasks
+	if nm.firewall != nil {
+		if err := nm.firewall.Reconcile(); err != nil {
+			log.Warn().Err(err).Msg("Failed to reconcile firewall rules")
+		}
+	}
+
 	// Setup bridge IP if configured
 	if nm.config.BridgeIP != "" {
 		if err := nm.setupBridgeIP(ctx); err != nil {
@@ -295,6 +337,12 @@ func (nm *NetworkManager) PrepareNetwork(ctx context.Context, task *types.Task)
 		Int("networks", len(task.Networks)).
 		Msg("Preparing network interfaces")
 
+	// Reject bad policies before any device is created
+	ingress, egress, err := PoliciesFromLabels(task.Labels)
+	if err != nil {
+		return fmt.Errorf("invalid network policy: %w", err)
+	}
+
 	// Ensure bridge exists and is configured
 	if err := nm.ensureBridge(ctx); err != nil {
 		return fmt.Errorf("failed to ensure bridge: %w", err)
@@ -318,7 +366,7 @@ func (nm *NetworkManager) PrepareNetwork(ctx context.Context, task *types.Task)
 	// Use CNI when: task has network attachments AND CNI is configured
 	if len(task.Networks) > 0 && nm.cniClient != nil {
 		// Use CNI plugin for SwarmKit network attachments
-		return nm.prepareNetworkWithCNI(ctx, task)
+		return nm.prepareNetworkWithCNI(ctx, task, ingress, egress)
 	}
 
 	// If no networks attached (and CNI not used), create default TAP
@@ -394,6 +442,12 @@ func (nm *NetworkManager) PrepareNetwork(ctx context.Context, task *types.Task)
 			Msg("TAP device created")
 	}
 
+	nm.registerTask(task)
+
+	if err := nm.applyFirewall(task, ingress, egress); err != nil {
+		return err
+	}
+
 	log.Info().
 		Str("task_id", task.ID).
 		Msg("Network preparation completed")
@@ -401,8 +455,46 @@ func (nm *NetworkManager) PrepareNetwork(ctx context.Context, task *types.Task)
 	return nil
 }
 
+// applyFirewall installs anti-spoofing, published ports and service
+// policies for the task's TAP devices.
+func (nm *NetworkManager) applyFirewall(task *types.Task, ingress, egress *NetworkPolicy) error {
+	if nm.firewall == nil {
+		return nil
+	}
+
+	nm.mu.RLock()
+	var endpoints []*FirewallEndpoint
+	for key, tap := range nm.tapDevices {
+		if !strings.HasPrefix(key, task.ID+"-") || tap.MAC == "" {
+			continue
+		}
+		endpoints = append(endpoints, &FirewallEndpoint{
+			TaskID:  task.ID,
+			Tap:     tap.Name,
+			IP:      tap.IP,
+			MAC:     tap.MAC,
+			Ingress: ingress,
+			Egress:  egress,
+		})
+	}
+	nm.mu.RUnlock()
+
+	if len(endpoints) == 0 {
+		return nil
+	}
+
+	// Published ports go to the primary interface
+	sort.Slice(endpoints, func(i, j int) bool { return endpoints[i].Tap < endpoints[j].Tap })
+	endpoints[0].Ports = task.Ports
+
+	if err := nm.firewall.AddEndpoints(endpoints...); err != nil {
+		return fmt.Errorf("failed to apply firewall rules: %w", err)
+	}
+	return nil
+}
+
 // prepareNetworkWithCNI uses CNI plugin for SwarmKit network attachments.
-func (nm *NetworkManager) prepareNetworkWithCNI(ctx context.Context, task *types.Task) error {
+func (nm *NetworkManager) prepareNetworkWithCNI(ctx context.Context, task *types.Task, ingress, egress *NetworkPolicy) error {
 	log.Info().
 		Str("task_id", task.ID).
 		Int("networks", len(task.Networks)).
@@ -415,12 +507,14 @@ func (nm *NetworkManager) prepareNetworkWithCNI(ctx context.Context, task *types
 			networkName = attachment.Network.ID[:8]
 		}
 
-		// If no SwarmKit-assigned IP, fall back to DHCP/TAP allocation
-		if len(attachment.Addresses) == 0 {
+		// Overlays get their own bridge from the network manager, and
+		// attachments without a SwarmKit-assigned IP fall back to DHCP/TAP
+		// allocation
+		if len(attachment.Addresses) == 0 || IsOverlay(attachment.Network.Spec.Driver) {
 			log.Info().
 				Str("task_id", task.ID).
 				Str("network", networkName).
-				Msg("No SwarmKit-assigned IP, falling back to TAP/DHCP allocation")
+				Msg("Creating TAP device directly")
 
 			tap, err := nm.createTapDevice(ctx, attachment, i, task.ID)
 			if err != nil {
@@ -462,6 +556,8 @@ func (nm *NetworkManager) prepareNetworkWithCNI(ctx context.Context, task *types
 				Bridge:  nm.config.BridgeName, // CNI handles bridge internally
 				IP:      ip.Address.IP.String(),
 				Netmask: net.IP(ip.Address.Mask).String(),
+				MAC:     GuestMAC(task.ID, attachment.Network.ID, i),
+				MTU:     GuestMTU(attachment.Network.Spec.Driver),
 			}
 
 			nm.mu.Lock()
@@ -478,6 +574,12 @@ func (nm *NetworkManager) prepareNetworkWithCNI(ctx context.Context, task *types
 		}
 	}
 
+	nm.registerTask(task)
+
+	if err := nm.applyFirewall(task, ingress, egress); err != nil {
+		return err
+	}
+
 	log.Info().
 		Str("task_id", task.ID).
 		Msg("CNI network preparation completed")
@@ -515,6 +617,26 @@ func (nm *NetworkManager) CleanupNetwork(ctx context.Context, task *types.Task)
 			delete(nm.tapDevices, key)
 		}
 	}
+	nm.releaseNetworkBridges(task.ID)
+
+	if nm.dhcpServer != nil {
+		if err := nm.dhcpServer.RemoveTask(task.ID); err != nil {
+			log.Warn().Err(err).
+				Str("task_id", task.ID).
+				Msg("Failed to remove DHCP leases")
+		}
+	}
+	if nm.dnsServer != nil {
+		nm.dnsServer.RemoveTask(task.ID)
+	}
+
+	if nm.firewall != nil {
+		if err := nm.firewall.RemoveTask(task.ID); err != nil {
+			log.Warn().Err(err).
+				Str("task_id", task.ID).
+				Msg("Failed to remove firewall rules")
+		}
+	}
 
 	// Clean up CNI network attachments if any (prevents IPAM leaks)
 	if nm.cniClient != nil && len(task.Networks) > 0 {
@@ -536,6 +658,73 @@ func (nm *NetworkManager) CleanupNetwork(ctx context.Context, task *types.Task)
 	return nil
 }
 
+// ReconcileIPAM releases persisted IP allocations of tasks that are no
+// longer running. It should be called once at startup, before new tasks
+// are prepared.
+func (nm *NetworkManager) ReconcileIPAM(isRunning func(taskID string) bool) int {
+	if nm.ipAllocator == nil {
+		return 0
+	}
+	released := nm.ipAllocator.Reconcile(isRunning)
+	if released > 0 {
+		log.Info().Int("released", released).Msg("Released IP allocations of stopped tasks")
+	}
+	return released
+}
+
+// ReconcileFirewall drops the persisted firewall rules of tasks that are no
+// longer running. Like ReconcileIPAM it should be called once at startup.
+func (nm *NetworkManager) ReconcileFirewall(isRunning func(taskID string) bool) int {
+	if nm.firewall == nil {
+		return 0
+	}
+	pruned := nm.firewall.Prune(isRunning)
+	if pruned == 0 {
+		return 0
+	}
+	if err := nm.firewall.Reconcile(); err != nil {
+		log.Warn().Err(err).Msg("Failed to reconcile firewall rules")
+	}
+	log.Info().Int("removed", pruned).Msg("Removed firewall rules of stopped tasks")
+	return pruned
+}
+
+// ReconcileDHCP drops the persisted DHCP leases of tasks that are no longer
+// running. Like ReconcileIPAM it should be called once at startup; the
+// server itself only starts with the first task.
+func (nm *NetworkManager) ReconcileDHCP(isRunning func(taskID string) bool) int {
+	nm.mu.RLock()
+	server := nm.dhcpServer
+	nm.mu.RUnlock()
+	if server == nil {
+		if nm.leaseFile() == "" {
+			return 0
+		}
+		server = NewDHCPServer(nil, nil, nm.leaseFile())
+		if err := server.Load(); err != nil {
+			log.Warn().Err(err).Msg("Failed to read DHCP leases")
+			return 0
+		}
+	}
+	pruned, err := server.Prune(isRunning)
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to save DHCP leases")
+	}
+	if pruned > 0 {
+		log.Info().Int("removed", pruned).Msg("Removed DHCP leases of stopped tasks")
+	}
+	return pruned
+}
+
+// leaseFile returns where the DHCP server persists its leases, or "" when
+// they are not persisted.
+func (nm *NetworkManager) leaseFile() string {
+	if nm.config.StateDir == "" {
+		return ""
+	}
+	return filepath.Join(nm.config.StateDir, "dhcp-leases.json")
+}
+
 // GetTapIP returns the allocated IP for a task.
 func (nm *NetworkManager) GetTapIP(taskID string) (string, error) {
 	nm.mu.RLock()
@@ -674,185 +863,165 @@ func (nm *NetworkManager) setupNAT(ctx context.Context) error {
 		return fmt.Errorf("failed to enable IP forwarding: %w", err)
 	}
 
-	// Setup iptables masquerade rule
-	subnet := nm.config.Subnet
-	cmd := execCommand("iptables", "-t", "nat", "-C", "POSTROUTING", "-s", subnet, "-j", "MASQUERADE")
-	if err := cmd.Run(); err != nil {
-		// Rule doesn't exist, add it
-		cmd = execCommand("iptables", "-t", "nat", "-A", "POSTROUTING", "-s", subnet, "-j", "MASQUERADE")
-		if err := cmd.Run(); err != nil {
-			return fmt.Errorf("failed to add NAT rule: %w", err)
-		}
-		log.Info().Msg("NAT masquerade rule added")
-	}
-
-	// Allow forwarding from bridge
-	cmd = execCommand("iptables", "-C", "FORWARD", "-i", nm.config.BridgeName, "-j", "ACCEPT")
-	if err := cmd.Run(); err != nil {
-		cmd = execCommand("iptables", "-A", "FORWARD", "-i", nm.config.BridgeName, "-j", "ACCEPT")
-		if err := cmd.Run(); err != nil {
-			return fmt.Errorf("failed to add forward rule: %w", err)
-		}
+	if nm.firewall == nil {
+		return fmt.Errorf("firewall not initialized")
 	}
-
-	// Allow forwarding to bridge
-	cmd = execCommand("iptables", "-C", "FORWARD", "-o", nm.config.BridgeName, "-j", "ACCEPT")
-	if err := cmd.Run(); err != nil {
-		cmd = execCommand("iptables", "-A", "FORWARD", "-o", nm.config.BridgeName, "-j", "ACCEPT")
-		if err := cmd.Run(); err != nil {
-			return fmt.Errorf("failed to add forward rule: %w", err)
-		}
+	if err := nm.firewall.AddMasquerade(nm.config.Subnet, nm.config.BridgeName); err != nil {
+		return fmt.Errorf("failed to add NAT rule: %w", err)
 	}
 
+	log.Info().Msg("NAT masquerade rule installed")
 	return nil
 }
 
-// setupDHCP configures a minimal DHCP server using dnsmasq.
+// setupDHCP starts the built-in DHCP server and DNS forwarder on the bridge.
+// Both run in-process for the lifetime of the manager and only hand out
+// addresses registered by PrepareNetwork.
 func (nm *NetworkManager) setupDHCP(ctx context.Context) error {
 	if nm.config.Subnet == "" || nm.config.BridgeIP == "" {
 		return fmt.Errorf("subnet and bridge IP must be configured for DHCP")
 	}
 
-	// Check if dnsmasq is available
-	if _, err := execLookPath("dnsmasq"); err != nil {
-		log.Warn().Msg("dnsmasq not found, DHCP will not be available")
-		return nil //nolint:nilerr
-		// Not fatal - VMs can use static IPs
+	gatewayIP := net.ParseIP(strings.Split(nm.config.BridgeIP, "/")[0]).To4()
+	if gatewayIP == nil {
+		return fmt.Errorf("invalid bridge IP")
 	}
 
-	// Parse subnet to get DHCP range
-	_, subnet, err := net.ParseCIDR(nm.config.Subnet)
-	if err != nil {
-		return fmt.Errorf("invalid subnet: %w", err)
-	}
+	nm.mu.Lock()
+	defer nm.mu.Unlock()
 
-	// Parse gateway IP
-	gatewayIP, _, err := net.ParseCIDR(nm.config.BridgeIP)
-	if err != nil {
-		gatewayIP = net.ParseIP(nm.config.BridgeIP)
-		if gatewayIP == nil {
-			return fmt.Errorf("invalid bridge IP")
-		}
+	// Already serving this bridge
+	if nm.dhcpServer != nil {
+		return nil
 	}
 
-	// Calculate DHCP range (exclude gateway)
-	// Configurable range, defaults to .50-.200 of the subnet
-	subnetIP := binary.BigEndian.Uint32(subnet.IP.To4())
-	dhcpRangeStart := nm.config.DHCPRangeStart
-	dhcpRangeEnd := nm.config.DHCPRangeEnd
-	if dhcpRangeStart == 0 {
-		dhcpRangeStart = 50
-	}
-	if dhcpRangeEnd == 0 {
-		dhcpRangeEnd = 200
+	// The servers outlive the task that triggered their start
+	serveCtx := context.WithoutCancel(ctx)
+
+	dhcpServer := NewDHCPServer(gatewayIP, nil, nm.leaseFile())
+	if err := dhcpServer.Start(serveCtx, nm.config.BridgeName); err != nil {
+		return err
 	}
-	dhcpStart := subnetIP + uint32(dhcpRangeStart)
-	dhcpEnd := subnetIP + uint32(dhcpRangeEnd)
+	nm.dhcpServer = dhcpServer
 
-	startIP := make(net.IP, 4)
-	endIP := make(net.IP, 4)
-	binary.BigEndian.PutUint32(startIP, dhcpStart)
-	binary.BigEndian.PutUint32(endIP, dhcpEnd)
+	// DNS is best effort: guests fall back to whatever resolver they have
+	dnsServer := NewDNSServer(nil)
+	dnsAddr := net.JoinHostPort(gatewayIP.String(), "53")
+	if err := dnsServer.Start(serveCtx, dnsAddr); err != nil {
+		log.Warn().Err(err).Msg("Failed to start DNS forwarder, guests will not resolve task names")
+	} else {
+		nm.dnsServer = dnsServer
+	}
 
 	log.Info().
 		Str("bridge", nm.config.BridgeName).
-		Str("start", startIP.String()).
-		Str("end", endIP.String()).
-		Str("gateway", gatewayIP.String()).
-		Msg("Setting up DHCP server")
-
-	// Kill any existing dnsmasq for this bridge via PID file (safe, no shell injection)
-	nm.killDnsmasqByPID()
-	time.Sleep(100 * time.Millisecond) // Brief pause to ensure process is killed
-
-	// Create log file with proper permissions for dnsmasq (runs as nobody)
-	logFile := "/tmp/dnsmasq.log"
-	osRemove(logFile) // Remove old file first
-	if err := osWriteFile(logFile, []byte{}, 0666); err != nil {
-		log.Warn().Err(err).Msg("Could not create dnsmasq log file")
-	}
-
-	// Start dnsmasq for this bridge
-	// Arguments:
-	// --interface: bind to bridge
-	// --bind-interfaces: only bind to specified interface
-	// --dhcp-range: define DHCP pool
-	// --dhcp-option=3: set gateway
-	// --dhcp-option=6: set DNS (use gateway as DNS proxy)
-	cmd := execCommand("dnsmasq",
-		"--interface", nm.config.BridgeName,
-		"--bind-interfaces",
-		"--dhcp-range", fmt.Sprintf("%s,%s,12h", startIP.String(), endIP.String()),
-		"--dhcp-option", fmt.Sprintf("3,%s", gatewayIP.String()),
-		"--dhcp-option", fmt.Sprintf("6,%s", gatewayIP.String()),
-		"--log-queries",
-		"--log-dhcp",
-		"--log-facility=/tmp/dnsmasq.log",
-		"--pid-file=/tmp/dnsmasq.pid",
-	)
-
-	if output, err := cmd.CombinedOutput(); err != nil {
-		log.Error().Str("output", string(output)).Msg("dnsmasq failed to start")
-		return fmt.Errorf("failed to start dnsmasq: %w (output: %s)", err, string(output))
-	}
-
-	log.Info().Msg("DHCP server (dnsmasq) started")
+		Str("server", gatewayIP.String()).
+		Int("leases", len(dhcpServer.Leases())).
+		Msg("DHCP server started")
 	return nil
 }
 
-// Shutdown cleans up all network resources including dnsmasq.
-func (nm *NetworkManager) Shutdown() error {
-	log.Info().Msg("Shutting down network manager")
-
-	// Kill all dnsmasq instances started by swarmcracker
-	if err := nm.cleanupDnsmasq(); err != nil {
-		log.Warn().Err(err).Msg("Failed to cleanup dnsmasq")
+// registerTask publishes DHCP leases and DNS records for each of the task's
+// interfaces that has an address, whether on the default bridge, a
+// network's own bridge or a CNI network. Each bridge's DNS forwarder gets
+// the task's addresses on that bridge only.
+func (nm *NetworkManager) registerTask(task *types.Task) {
+	nm.mu.RLock()
+	dhcpServer := nm.dhcpServer
+	dnsServers := map[string]*DNSServer{nm.config.BridgeName: nm.dnsServer}
+	for _, nb := range nm.networks {
+		dnsServers[nb.name] = nb.dns
 	}
+	var taps []*TapDevice
+	for key, tap := range nm.tapDevices {
+		if strings.HasPrefix(key, task.ID+"-") && tap.IP != "" {
+			taps = append(taps, tap)
+		}
+	}
+	nm.mu.RUnlock()
 
-	// Stop VXLAN peer discovery if running
-	nm.StopPeerDiscovery()
-
-	log.Info().Msg("Network manager shutdown complete")
-	return nil
-}
+	if len(taps) == 0 {
+		return
+	}
+	sort.Slice(taps, func(i, j int) bool { return taps[i].Name < taps[j].Name })
 
-// cleanupDnsmasq kills dnsmasq instances related to swarmcracker via PID file.
-func (nm *NetworkManager) cleanupDnsmasq() error {
-	// Kill by pid file (safe, no shell injection)
-	pidFile := "/tmp/dnsmasq.pid"
-	if data, err := os.ReadFile(pidFile); err == nil {
-		pid := strings.TrimSpace(string(data))
-		if pid != "" {
-			nm.killByPID(pid)
-			osRemove(pidFile)
+	ips := make(map[string][]net.IP)
+	for _, tap := range taps {
+		ips[tap.Bridge] = append(ips[tap.Bridge], net.ParseIP(tap.IP))
+		if dhcpServer == nil {
+			continue
+		}
+		err := dhcpServer.AddLease(DHCPLease{
+			TaskID:   task.ID,
+			MAC:      tap.MAC,
+			IP:       tap.IP,
+			Netmask:  tap.Netmask,
+			Gateway:  tap.Gateway,
+			Hostname: task.ID,
+			MTU:      tap.MTU,
+			Bridge:   tap.Bridge,
+		})
+		if err != nil {
+			log.Warn().Err(err).
+				Str("task_id", task.ID).
+				Str("tap", tap.Name).
+				Msg("Failed to register DHCP lease")
 		}
 	}
 
-	log.Info().Msg("dnsmasq cleaned up")
-	return nil
+	for bridge, bridgeIPs := range ips {
+		if dnsServer := dnsServers[bridge]; dnsServer != nil {
+			dnsServer.AddRecords(task.ID, TaskDNSNames(task), bridgeIPs)
+		}
+	}
 }
 
-// killDnsmasqByPID reads the dnsmasq PID file and sends SIGTERM.
-func (nm *NetworkManager) killDnsmasqByPID() {
-	pidFile := "/tmp/dnsmasq.pid"
-	data, err := os.ReadFile(pidFile)
-	if err != nil {
-		return
+// TaskDNSNames returns the names a task answers to: its ID, its service
+// name and, like Docker Swarm, "<service>.<slot>" and "<service>.<slot>.<id>".
+func TaskDNSNames(task *types.Task) []string {
+	names := []string{task.ID}
+	if task.ServiceName == "" {
+		return names
 	}
-	pid := strings.TrimSpace(string(data))
-	if pid == "" {
-		return
+	names = append(names, task.ServiceName)
+	if task.Slot > 0 {
+		slotName := fmt.Sprintf("%s.%d", task.ServiceName, task.Slot)
+		names = append(names, slotName, slotName+"."+task.ID)
 	}
-	nm.killByPID(pid)
-	osRemove(pidFile)
+	return names
 }
 
-// killByPID sends SIGTERM to a process by its PID string.
-func (nm *NetworkManager) killByPID(pid string) {
-	cmd := exec.Command("kill", pid)
-	if err := cmd.Run(); err != nil {
-		log.Warn().Str("pid", pid).Err(err).Msg("Failed to kill process by PID")
+// Shutdown cleans up all network resources including the DHCP and DNS servers.
+func (nm *NetworkManager) Shutdown() error {
+	log.Info().Msg("Shutting down network manager")
+
+	// Leases stay on disk so a restarted daemon keeps serving running VMs
+	nm.mu.Lock()
+	dhcpServer, dnsServer := nm.dhcpServer, nm.dnsServer
+	nm.dhcpServer, nm.dnsServer = nil, nil
+	var networkDNS []*DNSServer
+	for _, nb := range nm.networks {
+		if nb.dns != nil {
+			networkDNS = append(networkDNS, nb.dns)
+			nb.dns = nil
+		}
 	}
+	nm.mu.Unlock()
+	if dhcpServer != nil {
+		dhcpServer.Stop()
+	}
+	if dnsServer != nil {
+		dnsServer.Stop()
+	}
+	for _, dns := range networkDNS {
+		dns.Stop()
+	}
+
+	// Stop VXLAN peer discovery if running
+	nm.StopPeerDiscovery()
+
+	log.Info().Msg("Network manager shutdown complete")
+	return nil
 }
 
 // validateBridgeName validates that a bridge name is safe and within IFNAMSIZ limits.
@@ -875,7 +1044,7 @@ func validateBridgeName(name string) error {
 // setupVXLANOverlay sets up VXLAN overlay networking for cross-node VM communication.
 func (nm *NetworkManager) setupVXLANOverlay(ctx context.Context) error {
 	bridgeName := nm.config.BridgeName
-	vxlanID := 100 // Default VXLAN ID
+	vxlanID := defaultVXLANID
 
 	// Discover physical interface and local IP
 	physInterface, localIP, err := nm.getPhysicalInterface()
@@ -985,6 +1154,8 @@ func (nm *NetworkManager) discoverPeerWorkers() []string {
 
 // UpdatePeers updates the VXLAN peer list.
 func (nm *NetworkManager) UpdatePeers(peers []string) error {
+	nm.updateNetworkPeers(peers)
+
 	if nm.vxlanMgr == nil {
 		// Queue peers for later when VXLAN is initialized
 		nm.mu.Lock()
@@ -1063,11 +1234,9 @@ func (nm *NetworkManager) SetNodeDiscovery(discovery types.NodeDiscovery) {
 
 // createTapDevice creates a TAP device for a network attachment.
 func (nm *NetworkManager) createTapDevice(ctx context.Context, network types.NetworkAttachment, index int, taskID string) (*TapDevice, error) {
-	// Generate TAP name: tap-<hash[:12]>-<index>
-	// Must match logic in translator
-	hash := sha256.Sum256([]byte(taskID))
-	hashStr := hex.EncodeToString(hash[:])
-	tapName := fmt.Sprintf("tap-%s-%d", hashStr[:12], index)
+	// Shared with the translators so the VM config references this device
+	tapName := TapName(taskID, index)
+	mtu := GuestMTU(network.Network.Spec.Driver)
 
 	// Allocate IP address for this TAP
 	// Priority: SwarmKit-provided IP > Local allocation
@@ -1094,8 +1263,9 @@ func (nm *NetworkManager) createTapDevice(ctx context.Context, network types.Net
 			Str("ip", ipAddr).
 			Str("network", network.Network.Spec.Name).
 			Msg("Using SwarmKit-provided IP from network attachment")
-	} else if nm.ipAllocator != nil && nm.config.IPMode == "static" {
-		// Local allocation only when no SwarmKit network attachment
+	} else if nm.ipAllocator != nil && (nm.config.IPMode == "static" || nm.config.IPMode == "dhcp") {
+		// Local allocation only when no SwarmKit network attachment.
+		// DHCP mode serves the same address, so both modes agree.
 		var err error
 		ipAddr, err = nm.ipAllocator.Allocate(taskID)
 		if err != nil {
@@ -1111,6 +1281,11 @@ func (nm *NetworkManager) createTapDevice(ctx context.Context, network types.Net
 		return nil, fmt.Errorf("failed to create TAP device: %w", err)
 	}
 
+	// Match the guest MTU so overlay traffic is not fragmented on the host side
+	if err := execCommand("ip", "link", "set", tapName, "mtu", fmt.Sprintf("%d", mtu)).Run(); err != nil {
+		log.Warn().Err(err).Str("tap", tapName).Int("mtu", mtu).Msg("Failed to set TAP MTU")
+	}
+
 	// Bring TAP up
 	if err := execCommand("ip", "link", "set", tapName, "up").Run(); err != nil {
 		// Cleanup on failure
@@ -1126,39 +1301,33 @@ func (nm *NetworkManager) createTapDevice(ctx context.Context, network types.Net
 		network.Network.Spec.DriverConfig.Bridge != nil &&
 		network.Network.Spec.DriverConfig.Bridge.Name != "" {
 		bridgeName = network.Network.Spec.DriverConfig.Bridge.Name
-	} else if network.Network.Spec.Driver == "overlay" {
-		// For overlay networks, Docker Swarm typically creates a bridge named "br-<network-id-prefix>"
-		// We attempt to attach to that bridge.
-		if len(network.Network.ID) >= 12 {
-			bridgeName = "br-" + network.Network.ID[:12]
-		}
 
-		log.Info().
-			Str("network_id", network.Network.ID).
-			Str("derived_bridge", bridgeName).
-			Msg("Detected overlay network, using derived bridge name")
-	}
-
-	// Ensure bridge exists (especially for overlay, it should already be there)
-	if err := execCommand("ip", "link", "show", bridgeName).Run(); err != nil {
-		// If it's our default bridge, we might be able to create it (logic in ensureBridge)
-		// But for overlay, we expect it to exist.
-		if network.Network.Spec.Driver == "overlay" {
-			// Try to cleanup
-			execCommand("ip", "link", "delete", tapName).Run()
-			return nil, fmt.Errorf("overlay bridge %s not found: %w", bridgeName, err)
+		// Bridges other than ours are expected to be managed externally
+		if bridgeName != nm.config.BridgeName {
+			if err := execCommand("ip", "link", "show", bridgeName).Run(); err != nil {
+				execCommand("ip", "link", "delete", tapName).Run()
+				return nil, fmt.Errorf("bridge %s not found: %w", bridgeName, err)
+			}
 		}
-		// Fallback to default behavior (ensureBridge) if it's the default bridge
-		if bridgeName == nm.config.BridgeName {
-			// ensureBridge is called in PrepareNetwork, but that only checks nm.config.BridgeName
-			// If we switched to a different bridgeName here, we might be in trouble if it doesn't exist.
-			_ = bridgeName // no-op: just documenting the fallback case
+	} else if IsOverlay(network.Network.Spec.Driver) {
+		// Every overlay gets its own bridge and VNI so tasks only share a
+		// broadcast domain with tasks on the same network
+		var err error
+		bridgeName, err = nm.ensureNetworkBridge(ctx, network, taskID)
+		if err != nil {
+			execCommand("ip", "link", "delete", tapName).Run()
+			return nil, fmt.Errorf("failed to setup bridge for network %s: %w", network.Network.ID, err)
 		}
 	}
 
 	if err := execCommand("ip", "link", "set", tapName, "master", bridgeName).Run(); err != nil {
 		// Cleanup on failure
 		execCommand("ip", "link", "delete", tapName).Run()
+		if IsOverlay(network.Network.Spec.Driver) {
+			nm.mu.Lock()
+			nm.releaseNetworkBridges(taskID)
+			nm.mu.Unlock()
+		}
 		return nil, fmt.Errorf("failed to add TAP to bridge: %w", err)
 	}
 
@@ -1181,7 +1350,12 @@ func (nm *NetworkManager) createTapDevice(ctx context.Context, network types.Net
 			}
 		}
 	}
-	if nm.config.BridgeIP != "" {
+	if IsOverlay(network.Network.Spec.Driver) {
+		// Overlay guests route through the network's own gateway
+		if gw := OverlayGateway(network); gw != "" {
+			gateway = strings.Split(gw, "/")[0]
+		}
+	} else if nm.config.BridgeIP != "" {
 		gateway = strings.Split(nm.config.BridgeIP, "/")[0]
 	}
 
@@ -1192,6 +1366,8 @@ func (nm *NetworkManager) createTapDevice(ctx context.Context, network types.Net
 		Netmask: netmask,
 		Gateway: gateway,
 		Subnet:  subnet,
+		MAC:     GuestMAC(taskID, network.Network.ID, index),
+		MTU:     mtu,
 	}
 
 	return tap, nil
@@ -12,6 +12,7 @@ import (
 	"sync"
 	"testing"
 
+	"github.com/google/nftables"
 	"github.com/restuhaqza/swarmcracker/pkg/types"
 	"github.com/stretchr/testify/assert"
 )
@@ -22,6 +23,9 @@ var (
 	origOsRemoveAll  func(string) error
 	origOsWriteFile  func(string, []byte, os.FileMode) error
 	origOsRemove     func(string) error
+	origFirewallConn func() (NFTablesConn, error)
+	origListenDHCP   func(context.Context, string) (net.PacketConn, error)
+	origListenDNS    func(context.Context, string) (net.PacketConn, error)
 )
 
 func init() {
@@ -31,6 +35,9 @@ func init() {
 	origOsRemoveAll = osRemoveAll
 	origOsWriteFile = osWriteFile
 	origOsRemove = osRemove
+	origFirewallConn = newFirewallConn
+	origListenDHCP = listenDHCP
+	origListenDNS = listenDNS
 }
 
 // Mock state for tests
@@ -40,6 +47,7 @@ type mockState struct {
 	outputs      map[string]string
 	shouldFail   map[string]bool
 	bridgeExists bool
+	firewall     *FakeNFTablesConn
 }
 
 func newMockState() *mockState {
@@ -158,12 +166,32 @@ func setupMocksForTest(state *mockState) func() {
 	osWriteFile = mockOsWriteFileWithState(state)
 	osRemove = mockOsRemoveWithState(state)
 	osRemoveAll = mockOsRemoveAllWithState(state)
+	state.firewall = NewFakeNFTablesConn()
+	newFirewallConn = state.firewall.Connect
+	// DHCP and DNS bind to loopback instead of the (fake) bridge
+	listenDHCP = func(ctx context.Context, bridge string) (net.PacketConn, error) {
+		if state.shouldCmdFail("listen:dhcp") {
+			return nil, fmt.Errorf("mock listen failure on %s", bridge)
+		}
+		var lc net.ListenConfig
+		return lc.ListenPacket(ctx, "udp4", "127.0.0.1:0")
+	}
+	listenDNS = func(ctx context.Context, addr string) (net.PacketConn, error) {
+		if state.shouldCmdFail("listen:dns") {
+			return nil, fmt.Errorf("mock listen failure on %s", addr)
+		}
+		var lc net.ListenConfig
+		return lc.ListenPacket(ctx, "udp4", "127.0.0.1:0")
+	}
 	return func() {
 		execCommand = origExecCommand
 		execLookPath = origExecLookPath
 		osWriteFile = origOsWriteFile
 		osRemove = origOsRemove
 		osRemoveAll = origOsRemoveAll
+		newFirewallConn = origFirewallConn
+		listenDHCP = origListenDHCP
+		listenDNS = origListenDNS
 	}
 }
 
@@ -312,7 +340,6 @@ func TestSetupNAT_IPForwardFail_Injectable(t *testing.T) {
 
 func TestSetupNAT_AddRules(t *testing.T) {
 	state := newMockState()
-	state.setFail("iptables -t nat -C", true)
 	restore := setupMocksForTest(state)
 	defer restore()
 
@@ -323,21 +350,27 @@ func TestSetupNAT_AddRules(t *testing.T) {
 	if err != nil {
 		t.Fatalf("setupNAT failed: %v", err)
 	}
+
+	rules := state.firewall.Rules(nftables.TableFamilyINet, FirewallTableName, "postrouting")
+	assert.Len(t, rules, 1, "expected one masquerade rule")
+
+	for _, call := range state.calls {
+		assert.NotContains(t, call, "iptables")
+	}
 }
 
-func TestSetupNAT_ForwardFail(t *testing.T) {
+func TestSetupNAT_FirewallFail(t *testing.T) {
 	state := newMockState()
-	state.setFail("iptables -C FORWARD", true)
-	state.setFail("iptables -A FORWARD", true)
 	restore := setupMocksForTest(state)
 	defer restore()
+	state.firewall.FlushErr = fmt.Errorf("operation not permitted")
 
 	config := types.NetworkConfig{BridgeName: "testbr0", Subnet: "10.0.0.0/24"}
 	nm := NewNetworkManager(config).(*NetworkManager)
 
 	err := nm.setupNAT(context.Background())
 	if err == nil {
-		t.Fatal("Expected error when forward rule fails")
+		t.Fatal("Expected error when the firewall commit fails")
 	}
 }
 
@@ -484,7 +517,8 @@ func TestCreateTapDevice_LinkUpFail(t *testing.T) {
 
 func TestCreateTapDevice_OverlayNetwork(t *testing.T) {
 	state := newMockState()
-	state.setFail("ip link show br-testnetwork", true)
+	state.setFail("ip link show br-", true)
+	state.setFail("ip link add br-", true)
 	restore := setupMocksForTest(state)
 	defer restore()
 
@@ -496,7 +530,10 @@ func TestCreateTapDevice_OverlayNetwork(t *testing.T) {
 	}
 	_, err := nm.createTapDevice(context.Background(), network, 0, "test-task-123")
 	if err == nil {
-		t.Fatal("Expected error when overlay bridge doesn't exist")
+		t.Fatal("Expected error when overlay bridge cannot be created")
+	}
+	if len(nm.networks) != 0 {
+		t.Errorf("Expected no network bridge to be recorded, got %d", len(nm.networks))
 	}
 }
 
@@ -515,10 +552,15 @@ func TestCreateTapDevice_OverlayBridgeExists(t *testing.T) {
 	if err != nil {
 		t.Fatalf("createTapDevice failed: %v", err)
 	}
-	expectedBridge := "br-123456789abc"
+	expectedBridge := NetworkBridgeName(NetworkVNI(network.Network))
 	if tap.Bridge != expectedBridge {
 		t.Errorf("Expected bridge %s, got %s", expectedBridge, tap.Bridge)
 	}
+	for _, call := range state.calls {
+		if strings.HasPrefix(call, "ip link add "+expectedBridge) {
+			t.Errorf("Existing bridge should be reused, got %q", call)
+		}
+	}
 }
 
 func TestRemoveTapDevice_Injectable(t *testing.T) {
@@ -564,11 +606,23 @@ func TestSetupDHCP_Injectable(t *testing.T) {
 	if err != nil {
 		t.Fatalf("setupDHCP failed: %v", err)
 	}
+	defer nm.Shutdown()
+
+	if nm.dhcpServer == nil || nm.dnsServer == nil {
+		t.Fatal("Expected DHCP and DNS servers to be running")
+	}
+
+	// A second call keeps the running servers
+	dhcpServer := nm.dhcpServer
+	if err := nm.setupDHCP(context.Background()); err != nil {
+		t.Fatalf("setupDHCP failed: %v", err)
+	}
+	assert.Same(t, dhcpServer, nm.dhcpServer)
 }
 
-func TestSetupDHCP_NoDnsmasq(t *testing.T) {
+func TestSetupDHCP_ListenFail(t *testing.T) {
 	state := newMockState()
-	state.setFail("lookpath:dnsmasq", true)
+	state.setFail("listen:dhcp", true)
 	restore := setupMocksForTest(state)
 	defer restore()
 
@@ -576,9 +630,10 @@ func TestSetupDHCP_NoDnsmasq(t *testing.T) {
 	nm := NewNetworkManager(config).(*NetworkManager)
 
 	err := nm.setupDHCP(context.Background())
-	if err != nil {
-		t.Fatalf("setupDHCP should not fail when dnsmasq unavailable: %v", err)
+	if err == nil {
+		t.Fatal("Expected error when the DHCP socket cannot be opened")
 	}
+	assert.Nil(t, nm.dhcpServer)
 }
 
 func TestSetupDHCP_NoSubnet_Injectable(t *testing.T) {
@@ -694,7 +749,7 @@ func TestPrepareNetworkWithCNI_Injectable(t *testing.T) {
 		},
 	}
 
-	err := nm.prepareNetworkWithCNI(context.Background(), task)
+	err := nm.prepareNetworkWithCNI(context.Background(), task, nil, nil)
 	if err != nil {
 		t.Logf("prepareNetworkWithCNI error: %v (expected in mock env)", err)
 	}
@@ -716,7 +771,7 @@ func TestPrepareNetworkWithCNI_NoIP_UsesFallback(t *testing.T) {
 		},
 	}
 
-	err := nm.prepareNetworkWithCNI(context.Background(), task)
+	err := nm.prepareNetworkWithCNI(context.Background(), task, nil, nil)
 	// With CVR fix, empty IP now triggers TAP/DHCP fallback instead of error
 	// In test environment, TAP creation may fail (expected) or succeed with mock
 	if err != nil {
@@ -926,17 +981,70 @@ func TestCreateTapDevice_MasterFail_Injectable(t *testing.T) {
 	}
 }
 
-func TestSetupDHCP_WriteFileFail(t *testing.T) {
+func TestSetupDHCP_DNSListenFail(t *testing.T) {
 	state := newMockState()
-	state.setFail("writefile:/tmp/dnsmasq.log", true)
+	state.setFail("listen:dns", true)
 	restore := setupMocksForTest(state)
 	defer restore()
 
 	config := types.NetworkConfig{BridgeName: "testbr0", BridgeIP: "10.0.0.1/24", Subnet: "10.0.0.0/24"}
 	nm := NewNetworkManager(config).(*NetworkManager)
 
+	// DNS is optional, DHCP still starts
 	err := nm.setupDHCP(context.Background())
-	t.Logf("setupDHCP result: %v", err)
+	if err != nil {
+		t.Fatalf("setupDHCP should not fail without DNS: %v", err)
+	}
+	defer nm.Shutdown()
+
+	assert.NotNil(t, nm.dhcpServer)
+	assert.Nil(t, nm.dnsServer)
+}
+
+func TestPrepareNetwork_RegistersLeasesAndDNS(t *testing.T) {
+	state := newMockState()
+	restore := setupMocksForTest(state)
+	defer restore()
+
+	config := types.NetworkConfig{
+		BridgeName: "testbr0",
+		BridgeIP:   "10.0.0.1/24",
+		Subnet:     "10.0.0.0/24",
+		IPMode:     "dhcp",
+		StateDir:   t.TempDir(),
+	}
+	nm := NewNetworkManager(config).(*NetworkManager)
+	defer nm.Shutdown()
+
+	task := &types.Task{ID: "task-dns-1", ServiceName: "web", Slot: 2}
+	if err := nm.PrepareNetwork(context.Background(), task); err != nil {
+		t.Fatalf("PrepareNetwork failed: %v", err)
+	}
+
+	leases := nm.dhcpServer.Leases()
+	if len(leases) != 1 {
+		t.Fatalf("Expected 1 lease, got %d", len(leases))
+	}
+	tapIP, err := nm.GetTapIP(task.ID)
+	if err != nil {
+		t.Fatalf("GetTapIP failed: %v", err)
+	}
+	assert.Equal(t, tapIP, leases[0].IP)
+	assert.Equal(t, "10.0.0.1", leases[0].Gateway)
+	assert.Equal(t, task.ID, leases[0].Hostname)
+
+	for _, name := range []string{"web", "web.2", "web.2.task-dns-1", "task-dns-1"} {
+		ips, ok := nm.dnsServer.Lookup(name)
+		assert.True(t, ok, name)
+		assert.Equal(t, []net.IP{net.ParseIP(tapIP)}, ips, name)
+	}
+
+	if err := nm.CleanupNetwork(context.Background(), task); err != nil {
+		t.Fatalf("CleanupNetwork failed: %v", err)
+	}
+	assert.Empty(t, nm.dhcpServer.Leases())
+	_, ok := nm.dnsServer.Lookup("web")
+	assert.False(t, ok)
 }
 
 func TestStartPeerDiscovery_InterfaceFail(t *testing.T) {
@@ -1052,6 +1160,104 @@ func TestPrepareNetwork_NoNetworks(t *testing.T) {
 	}
 }
 
+func TestPrepareNetwork_FirewallRules(t *testing.T) {
+	state := newMockState()
+	restore := setupMocksForTest(state)
+	defer restore()
+
+	config := types.NetworkConfig{BridgeName: "testbr0", Subnet: "10.0.0.0/24", BridgeIP: "10.0.0.1/24"}
+	nm := NewNetworkManager(config).(*NetworkManager)
+	nm.natSetup = true
+	nm.cniClient = nil
+
+	task := &types.Task{
+		ID: "task-fw",
+		Networks: []types.NetworkAttachment{
+			{Network: types.Network{ID: "net1"}, Addresses: []string{"10.0.0.5/24"}},
+		},
+		Labels: map[string]string{IngressPolicyLabel: "tcp:80"},
+		Ports:  []types.PortConfig{{Protocol: "tcp", TargetPort: 80, PublishedPort: 8080}},
+	}
+
+	err := nm.PrepareNetwork(context.Background(), task)
+	assert.NoError(t, err)
+
+	tap := TapName(task.ID, 0)
+	assert.NotEmpty(t, state.firewall.Rules(nftables.TableFamilyBridge, FirewallTableName, "from-"+tap))
+	assert.NotEmpty(t, state.firewall.Rules(nftables.TableFamilyBridge, FirewallTableName, "to-"+tap))
+	assert.Len(t, state.firewall.Rules(nftables.TableFamilyINet, FirewallTableName, "prerouting"), 1)
+
+	err = nm.CleanupNetwork(context.Background(), task)
+	assert.NoError(t, err)
+	assert.Empty(t, state.firewall.Rules(nftables.TableFamilyBridge, FirewallTableName, "from-"+tap))
+	assert.Empty(t, state.firewall.Rules(nftables.TableFamilyINet, FirewallTableName, "prerouting"))
+}
+
+func TestPrepareNetwork_FirewallRulesWithAttachments(t *testing.T) {
+	state := newMockState()
+	restore := setupMocksForTest(state)
+	defer restore()
+
+	// Fake CNI plugin that hands back a TAP for the requested address
+	binDir, confDir := t.TempDir(), t.TempDir()
+	plugin := `#!/bin/sh
+cat >/dev/null
+echo '{"interfaces":[{"name":"cni-tap0"}],"ips":[{"address":{"IP":"10.0.5.2","Mask":"////AA=="}}]}'
+`
+	assert.NoError(t, os.WriteFile(binDir+"/swarmcracker-cni", []byte(plugin), 0755))
+	assert.NoError(t, os.WriteFile(confDir+"/10-test.conf", []byte(`{"cniVersion":"1.0.0","name":"frontend","type":"swarmcracker-cni"}`), 0644))
+
+	config := types.NetworkConfig{BridgeName: "testbr0", Subnet: "10.0.0.0/24", BridgeIP: "10.0.0.1/24"}
+	nm := NewNetworkManager(config).(*NetworkManager)
+	nm.natSetup = true
+	nm.cniClient = NewCNIClient(CNIConfig{BinDir: binDir, ConfDir: confDir})
+
+	task := &types.Task{
+		ID: "task-cni",
+		Networks: []types.NetworkAttachment{
+			{Network: types.Network{ID: "net-frontend", Spec: types.NetworkSpec{Name: "frontend", Driver: "bridge"}}, Addresses: []string{"10.0.5.2/24"}},
+			{Network: types.Network{ID: "net-backend1", Spec: types.NetworkSpec{Name: "backend", Driver: "overlay"}}, Addresses: []string{"10.0.9.3/24"}},
+		},
+		Labels: map[string]string{IngressPolicyLabel: "tcp:80"},
+		Ports:  []types.PortConfig{{Protocol: "tcp", TargetPort: 80, PublishedPort: 8080}},
+	}
+
+	err := nm.PrepareNetwork(context.Background(), task)
+	assert.NoError(t, err)
+
+	for _, tap := range []string{"cni-tap0", TapName(task.ID, 1)} {
+		assert.NotEmpty(t, state.firewall.Rules(nftables.TableFamilyBridge, FirewallTableName, "from-"+tap), tap)
+		assert.NotEmpty(t, state.firewall.Rules(nftables.TableFamilyBridge, FirewallTableName, "to-"+tap), tap)
+	}
+	assert.Len(t, state.firewall.Rules(nftables.TableFamilyINet, FirewallTableName, "prerouting"), 1)
+
+	err = nm.CleanupNetwork(context.Background(), task)
+	assert.NoError(t, err)
+	assert.Empty(t, state.firewall.Rules(nftables.TableFamilyBridge, FirewallTableName, "from-cni-tap0"))
+}
+
+func TestPrepareNetwork_InvalidPolicyLabel(t *testing.T) {
+	state := newMockState()
+	restore := setupMocksForTest(state)
+	defer restore()
+
+	config := types.NetworkConfig{BridgeName: "testbr0", Subnet: "10.0.0.0/24", BridgeIP: "10.0.0.1/24"}
+	nm := NewNetworkManager(config).(*NetworkManager)
+	nm.natSetup = true
+	nm.cniClient = nil
+
+	task := &types.Task{
+		ID: "task-bad-policy",
+		Networks: []types.NetworkAttachment{
+			{Network: types.Network{ID: "net1"}, Addresses: []string{"10.0.0.6/24"}},
+		},
+		Labels: map[string]string{EgressPolicyLabel: "gre:1"},
+	}
+
+	err := nm.PrepareNetwork(context.Background(), task)
+	assert.Error(t, err)
+}
+
 func TestInit_Injectable(t *testing.T) {
 	state := newMockState()
 	restore := setupMocksForTest(state)
@@ -0,0 +1,174 @@
+// Package network provides an in-memory nftables fake for testing.
+
+package network
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/google/nftables"
+)
+
+// FakeNFTablesConn is an in-memory NFTablesConn. Like the kernel it queues
+// operations until Flush and applies them as a single transaction, so tests
+// can inspect the committed ruleset without CAP_NET_ADMIN.
+type FakeNFTablesConn struct {
+	mu       sync.Mutex
+	pending  []func(map[fakeTableKey]*fakeTable) error
+	tables   map[fakeTableKey]*fakeTable
+	FlushErr error // Returned by Flush when set; the batch is discarded
+	Flushes  int   // Number of committed batches
+}
+
+type fakeTableKey struct {
+	family nftables.TableFamily
+	name   string
+}
+
+type fakeTable struct {
+	chains map[string]*fakeChain
+}
+
+type fakeChain struct {
+	chain *nftables.Chain
+	rules []*nftables.Rule
+}
+
+// NewFakeNFTablesConn creates an empty fake ruleset.
+func NewFakeNFTablesConn() *FakeNFTablesConn {
+	return &FakeNFTablesConn{tables: make(map[fakeTableKey]*fakeTable)}
+}
+
+// Connect returns the fake itself, for use as a connection factory.
+func (c *FakeNFTablesConn) Connect() (NFTablesConn, error) {
+	return c, nil
+}
+
+func (c *FakeNFTablesConn) queue(op func(map[fakeTableKey]*fakeTable) error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.pending = append(c.pending, op)
+}
+
+func (c *FakeNFTablesConn) AddTable(t *nftables.Table) *nftables.Table {
+	key := fakeTableKey{t.Family, t.Name}
+	c.queue(func(tables map[fakeTableKey]*fakeTable) error {
+		if _, ok := tables[key]; !ok {
+			tables[key] = &fakeTable{chains: make(map[string]*fakeChain)}
+		}
+		return nil
+	})
+	return t
+}
+
+func (c *FakeNFTablesConn) DelTable(t *nftables.Table) {
+	key := fakeTableKey{t.Family, t.Name}
+	c.queue(func(tables map[fakeTableKey]*fakeTable) error {
+		if _, ok := tables[key]; !ok {
+			return fmt.Errorf("table %s not found", t.Name)
+		}
+		delete(tables, key)
+		return nil
+	})
+}
+
+func (c *FakeNFTablesConn) AddChain(ch *nftables.Chain) *nftables.Chain {
+	key := fakeTableKey{ch.Table.Family, ch.Table.Name}
+	c.queue(func(tables map[fakeTableKey]*fakeTable) error {
+		table, ok := tables[key]
+		if !ok {
+			return fmt.Errorf("table %s not found", ch.Table.Name)
+		}
+		if _, ok := table.chains[ch.Name]; !ok {
+			table.chains[ch.Name] = &fakeChain{chain: ch}
+		}
+		return nil
+	})
+	return ch
+}
+
+func (c *FakeNFTablesConn) AddRule(r *nftables.Rule) *nftables.Rule {
+	key := fakeTableKey{r.Table.Family, r.Table.Name}
+	c.queue(func(tables map[fakeTableKey]*fakeTable) error {
+		table, ok := tables[key]
+		if !ok {
+			return fmt.Errorf("table %s not found", r.Table.Name)
+		}
+		chain, ok := table.chains[r.Chain.Name]
+		if !ok {
+			return fmt.Errorf("chain %s not found", r.Chain.Name)
+		}
+		chain.rules = append(chain.rules, r)
+		return nil
+	})
+	return r
+}
+
+// Flush commits queued operations atomically.
+func (c *FakeNFTablesConn) Flush() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	pending := c.pending
+	c.pending = nil
+	if c.FlushErr != nil {
+		return c.FlushErr
+	}
+
+	// Work on a copy so a failing operation leaves the ruleset untouched
+	staged := make(map[fakeTableKey]*fakeTable, len(c.tables))
+	for key, table := range c.tables {
+		chains := make(map[string]*fakeChain, len(table.chains))
+		for name, chain := range table.chains {
+			chains[name] = &fakeChain{chain: chain.chain, rules: append([]*nftables.Rule(nil), chain.rules...)}
+		}
+		staged[key] = &fakeTable{chains: chains}
+	}
+	for _, op := range pending {
+		if err := op(staged); err != nil {
+			return err
+		}
+	}
+
+	c.tables = staged
+	c.Flushes++
+	return nil
+}
+
+// HasTable reports whether a table is committed.
+func (c *FakeNFTablesConn) HasTable(family nftables.TableFamily, name string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, ok := c.tables[fakeTableKey{family, name}]
+	return ok
+}
+
+// Chains returns the committed chain names of a table.
+func (c *FakeNFTablesConn) Chains(family nftables.TableFamily, table string) []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t, ok := c.tables[fakeTableKey{family, table}]
+	if !ok {
+		return nil
+	}
+	names := make([]string, 0, len(t.chains))
+	for name := range t.chains {
+		names = append(names, name)
+	}
+	return names
+}
+
+// Rules returns the committed rules of a chain.
+func (c *FakeNFTablesConn) Rules(family nftables.TableFamily, table, chain string) []*nftables.Rule {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t, ok := c.tables[fakeTableKey{family, table}]
+	if !ok {
+		return nil
+	}
+	ch, ok := t.chains[chain]
+	if !ok {
+		return nil
+	}
+	return append([]*nftables.Rule(nil), ch.rules...)
+}
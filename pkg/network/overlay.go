@@ -0,0 +1,290 @@
+package network
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	"github.com/restuhaqza/swarmcracker/pkg/cni"
+	"github.com/restuhaqza/swarmcracker/pkg/types"
+	"github.com/rs/zerolog/log"
+)
+
+// defaultVXLANID is the VNI of the node bridge's own VXLAN overlay.
+const defaultVXLANID = 100
+
+// networkBridge is the bridge, and VXLAN device when VXLAN is enabled, that
+// carries one SwarmKit overlay network on this node.
+type networkBridge struct {
+	name  string
+	vni   uint32
+	vxlan *VXLANManager
+	dns   *DNSServer      // DNS forwarder on the network's gateway
+	tasks map[string]bool // tasks with an interface on the bridge
+}
+
+// IsOverlay reports whether driver names a multi-host overlay network.
+// SwarmKit reports "overlay"; the CNI allocator records "vxlan".
+func IsOverlay(driver string) bool {
+	return driver == "overlay" || driver == "vxlan"
+}
+
+// NetworkVNI returns the VXLAN network identifier of a SwarmKit network:
+// the one the allocator recorded in its driver state or, failing that, one
+// derived from the network ID, so every node picks the same VNI.
+func NetworkVNI(n types.Network) uint32 {
+	if n.VNI != 0 {
+		return n.VNI
+	}
+	vni := cni.GenerateVXLANID(n.ID, 0)
+	if vni == defaultVXLANID {
+		// Keep clear of the node bridge's overlay
+		vni = cni.GenerateVXLANID(n.ID, 1)
+	}
+	return vni
+}
+
+// NetworkBridgeName returns the name of the bridge for the network with
+// the given VNI. It leaves room for the "-vxlan" suffix of the VXLAN device
+// within IFNAMSIZ.
+func NetworkBridgeName(vni uint32) string {
+	return fmt.Sprintf("br-%06x", vni&0xffffff)
+}
+
+// OverlayGateway returns the gateway of an overlay attachment's network in
+// CIDR notation (e.g. "10.0.9.1/24"): the one from the network's IPAM config
+// or, without one, the first address of the subnet. It returns "" if neither
+// the network nor the attachment has an IPv4 subnet.
+func OverlayGateway(attachment types.NetworkAttachment) string {
+	subnet := attachment.Network.Subnet
+	if subnet == "" && len(attachment.Addresses) > 0 {
+		subnet = attachment.Addresses[0]
+	}
+	_, ipNet, err := net.ParseCIDR(subnet)
+	if err != nil || ipNet.IP.To4() == nil {
+		return ""
+	}
+
+	gw := net.ParseIP(attachment.Network.Gateway).To4()
+	if gw == nil || !ipNet.Contains(gw) {
+		gw = incIP(ipNet.IP.To4())
+	}
+	ones, _ := ipNet.Mask.Size()
+	return fmt.Sprintf("%s/%d", gw, ones)
+}
+
+// networkGatewayMAC returns the MAC every node gives the gateway of the
+// network with the given VNI.
+func networkGatewayMAC(vni uint32) string {
+	return fmt.Sprintf("02:53:43:%02X:%02X:%02X", byte(vni>>16), byte(vni>>8), byte(vni))
+}
+
+// ensureNetworkBridge returns the bridge of the task's overlay network,
+// creating it and its VXLAN device on first use, and records that the task
+// has an interface on it.
+func (nm *NetworkManager) ensureNetworkBridge(ctx context.Context, attachment types.NetworkAttachment, taskID string) (string, error) {
+	nm.mu.Lock()
+	defer nm.mu.Unlock()
+
+	network := attachment.Network
+
+	if nb, ok := nm.networks[network.ID]; ok {
+		nb.tasks[taskID] = true
+		return nb.name, nil
+	}
+
+	vni := NetworkVNI(network)
+	nb := &networkBridge{
+		name:  NetworkBridgeName(vni),
+		vni:   vni,
+		tasks: map[string]bool{taskID: true},
+	}
+
+	// A bridge left behind by a previous run is reused as is
+	if err := execCommand("ip", "link", "show", nb.name).Run(); err != nil {
+		log.Info().
+			Str("network_id", network.ID).
+			Str("bridge", nb.name).
+			Uint32("vni", vni).
+			Msg("Creating network bridge")
+
+		if err := execCommand("ip", "link", "add", nb.name, "type", "bridge").Run(); err != nil {
+			return "", fmt.Errorf("failed to create bridge %s: %w", nb.name, err)
+		}
+	}
+	if err := execCommand("ip", "link", "set", nb.name, "up").Run(); err != nil {
+		execCommand("ip", "link", "delete", nb.name).Run()
+		return "", fmt.Errorf("failed to bring bridge %s up: %w", nb.name, err)
+	}
+
+	if nm.config.VXLANEnabled {
+		// Without VXLAN the network still isolates tasks on this node, so
+		// a failure here only costs reachability from other nodes
+		if err := nm.setupNetworkVXLAN(nb); err != nil {
+			log.Warn().Err(err).
+				Str("network_id", network.ID).
+				Str("bridge", nb.name).
+				Msg("Failed to setup VXLAN for network, tasks are reachable from this node only")
+		}
+	}
+
+	// Every node carries the network's gateway, so guests leave through the
+	// node they run on
+	if gw := OverlayGateway(attachment); gw != "" {
+		if err := nm.setupNetworkGateway(nb, gw); err != nil {
+			log.Warn().Err(err).
+				Str("network_id", network.ID).
+				Str("bridge", nb.name).
+				Str("gateway", gw).
+				Msg("Failed to setup network gateway, tasks on the network have no egress")
+		} else {
+			nm.serveNetwork(ctx, nb, gw)
+		}
+	}
+
+	if nm.networks == nil {
+		nm.networks = make(map[string]*networkBridge)
+	}
+	nm.networks[network.ID] = nb
+	return nb.name, nil
+}
+
+// setupNetworkVXLAN attaches a VXLAN device with the network's VNI to its
+// bridge and floods it to the node's peers. nm.mu must be held.
+func (nm *NetworkManager) setupNetworkVXLAN(nb *networkBridge) error {
+	physInterface, localIP, err := nm.getPhysicalInterface()
+	if err != nil {
+		return fmt.Errorf("failed to discover physical interface: %w", err)
+	}
+
+	var peers []string
+	if nm.vxlanMgr != nil {
+		peers = nm.vxlanMgr.GetPeers()
+	} else {
+		peers = append(peers, nm.pendingPeers...)
+		peers = append(peers, nm.config.VXLANPeers...)
+	}
+
+	v := NewVXLANManager(nb.name, int(nb.vni), "", NewStaticPeerStore(peers))
+	if err := v.SetupL2(physInterface, localIP); err != nil {
+		return err
+	}
+	nb.vxlan = v
+	return nil
+}
+
+// setupNetworkGateway gives the bridge the network's gateway address and
+// masquerades the network's traffic leaving the node. The gateway has the
+// same MAC on every node and the firewall keeps it off the VXLAN, so each
+// guest reaches the gateway of its own node.
+func (nm *NetworkManager) setupNetworkGateway(nb *networkBridge, gateway string) error {
+	mac := networkGatewayMAC(nb.vni)
+	if err := execCommand("ip", "link", "set", nb.name, "address", mac).Run(); err != nil {
+		return fmt.Errorf("failed to set bridge MAC: %w", err)
+	}
+	if err := execCommand("ip", "addr", "replace", gateway, "dev", nb.name).Run(); err != nil {
+		return fmt.Errorf("failed to add gateway address: %w", err)
+	}
+
+	if nm.firewall == nil {
+		return nil
+	}
+	if err := nm.firewall.AddGateway(nb.name, mac); err != nil {
+		return err
+	}
+	if !nm.config.NATEnabled {
+		return nil
+	}
+	if err := execCommand("sysctl", "-w", "net.ipv4.ip_forward=1").Run(); err != nil {
+		return fmt.Errorf("failed to enable IP forwarding: %w", err)
+	}
+	return nm.firewall.AddMasquerade(gateway, nb.name)
+}
+
+// serveNetwork serves DHCP and DNS on a network's bridge as its gateway.
+// The bridge's DNS forwarder only knows the tasks on the network, so names
+// of other networks do not resolve there. Both are best effort, like on the
+// node bridge. nm.mu must be held.
+func (nm *NetworkManager) serveNetwork(ctx context.Context, nb *networkBridge, gateway string) {
+	gwIP, _, err := net.ParseCIDR(gateway)
+	if err != nil {
+		return
+	}
+
+	// The servers outlive the task that triggered their start
+	serveCtx := context.WithoutCancel(ctx)
+
+	if nm.dhcpServer != nil {
+		if err := nm.dhcpServer.AddBridge(serveCtx, nb.name, gwIP); err != nil {
+			log.Warn().Err(err).Str("bridge", nb.name).Msg("Failed to serve DHCP on network bridge")
+		}
+	}
+
+	dns := NewDNSServer(nil)
+	if err := dns.Start(serveCtx, net.JoinHostPort(gwIP.String(), "53")); err != nil {
+		log.Warn().Err(err).Str("bridge", nb.name).Msg("Failed to start DNS forwarder on network bridge, guests will not resolve task names")
+		return
+	}
+	nb.dns = dns
+}
+
+// releaseNetworkBridges drops the task from the networks it was on and
+// deletes the bridges and VXLAN devices no task uses any more. nm.mu must
+// be held.
+func (nm *NetworkManager) releaseNetworkBridges(taskID string) {
+	for id, nb := range nm.networks {
+		if !nb.tasks[taskID] {
+			continue
+		}
+		delete(nb.tasks, taskID)
+		if nb.dns != nil {
+			nb.dns.RemoveTask(taskID)
+		}
+		if len(nb.tasks) > 0 {
+			continue
+		}
+
+		log.Info().
+			Str("network_id", id).
+			Str("bridge", nb.name).
+			Msg("Removing unused network bridge")
+
+		if nm.dhcpServer != nil {
+			nm.dhcpServer.RemoveBridge(nb.name)
+		}
+		if nb.dns != nil {
+			nb.dns.Stop()
+		}
+		if nb.vxlan != nil {
+			execCommand("ip", "link", "delete", nb.name+"-vxlan").Run()
+		}
+		if nm.firewall != nil {
+			if err := nm.firewall.RemoveBridge(nb.name); err != nil {
+				log.Warn().Err(err).Str("bridge", nb.name).Msg("Failed to remove network gateway rules")
+			}
+		}
+		if err := execCommand("ip", "link", "delete", nb.name).Run(); err != nil {
+			log.Warn().Err(err).Str("bridge", nb.name).Msg("Failed to delete network bridge")
+		}
+		delete(nm.networks, id)
+	}
+}
+
+// updateNetworkPeers refreshes the flooding entries of every network's
+// VXLAN device.
+func (nm *NetworkManager) updateNetworkPeers(peers []string) {
+	nm.mu.RLock()
+	defer nm.mu.RUnlock()
+
+	for id, nb := range nm.networks {
+		if nb.vxlan == nil {
+			continue
+		}
+		if err := nb.vxlan.UpdatePeers(peers); err != nil {
+			log.Warn().Err(err).
+				Str("network_id", id).
+				Uint32("vni", nb.vni).
+				Msg("Failed to update VXLAN peers of network")
+		}
+	}
+}
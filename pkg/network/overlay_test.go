@@ -0,0 +1,287 @@
+//go:build !integration
+
+package network
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/google/nftables"
+	"github.com/restuhaqza/swarmcracker/pkg/cni"
+	"github.com/restuhaqza/swarmcracker/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNetworkVNI(t *testing.T) {
+	assert.Equal(t, uint32(4097), NetworkVNI(types.Network{ID: "net-a", VNI: 4097}))
+
+	derived := NetworkVNI(types.Network{ID: "net-a"})
+	assert.Equal(t, cni.GenerateVXLANID("net-a", 0), derived)
+	assert.Equal(t, derived, NetworkVNI(types.Network{ID: "net-a"}), "VNI must be stable across nodes")
+	assert.NotEqual(t, derived, NetworkVNI(types.Network{ID: "net-b"}))
+}
+
+func TestNetworkBridgeName(t *testing.T) {
+	assert.Equal(t, "br-001001", NetworkBridgeName(4097))
+	assert.Equal(t, "br-ffffff", NetworkBridgeName(1<<24-1))
+
+	// The VXLAN device is named after the bridge
+	assert.NoError(t, validateBridgeName(NetworkBridgeName(1<<24-1)+"-vxlan"))
+}
+
+func TestIsOverlay(t *testing.T) {
+	assert.True(t, IsOverlay("overlay"))
+	assert.True(t, IsOverlay("vxlan"))
+	assert.False(t, IsOverlay("bridge"))
+	assert.False(t, IsOverlay(""))
+}
+
+func TestOverlayGateway(t *testing.T) {
+	overlay := types.Network{ID: "net-a", Spec: types.NetworkSpec{Driver: "overlay"}}
+	withIPAM := overlay
+	withIPAM.Subnet, withIPAM.Gateway = "10.0.9.0/24", "10.0.9.254"
+	outside := withIPAM
+	outside.Gateway = "10.0.10.1"
+
+	tests := []struct {
+		name       string
+		attachment types.NetworkAttachment
+		want       string
+	}{
+		{"from IPAM", types.NetworkAttachment{Network: withIPAM, Addresses: []string{"10.0.9.4/24"}}, "10.0.9.254/24"},
+		{"first address of the subnet", types.NetworkAttachment{Network: overlay, Addresses: []string{"10.0.9.4/24"}}, "10.0.9.1/24"},
+		{"gateway outside the subnet", types.NetworkAttachment{Network: outside}, "10.0.9.1/24"},
+		{"no subnet", types.NetworkAttachment{Network: overlay}, ""},
+		{"IPv6 only", types.NetworkAttachment{Network: overlay, Addresses: []string{"fd00::4/64"}}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, OverlayGateway(tt.attachment))
+		})
+	}
+
+	// Bridge networks route through the node bridge
+	bridge := types.NetworkAttachment{Network: types.Network{ID: "net-b", Spec: types.NetworkSpec{Driver: "bridge"}}, Addresses: []string{"10.0.9.4/24"}}
+	assert.Equal(t, "192.168.127.1", AttachmentGateway(bridge, "192.168.127.1"))
+	assert.Equal(t, "10.0.9.254", AttachmentGateway(types.NetworkAttachment{Network: withIPAM}, "192.168.127.1"))
+}
+
+func overlayTask(id string, networks ...string) *types.Task {
+	task := &types.Task{ID: id}
+	for i, n := range networks {
+		task.Networks = append(task.Networks, types.NetworkAttachment{
+			Network:   types.Network{ID: n, Spec: types.NetworkSpec{Name: n, Driver: "overlay"}},
+			Addresses: []string{fmt.Sprintf("10.0.9.%d/24", 2+i)},
+		})
+	}
+	return task
+}
+
+func TestPrepareNetwork_PerNetworkBridges(t *testing.T) {
+	state := newMockState()
+	restore := setupMocksForTest(state)
+	defer restore()
+
+	nm := NewNetworkManager(types.NetworkConfig{BridgeName: "testbr0"}).(*NetworkManager)
+	ctx := context.Background()
+
+	front := overlayTask("task-front", "frontend")
+	back := overlayTask("task-back", "backend-net")
+	both := overlayTask("task-both", "frontend", "backend-net")
+	for _, task := range []*types.Task{front, back, both} {
+		require.NoError(t, nm.PrepareNetwork(ctx, task))
+	}
+
+	bridges := map[string]map[string]bool{}
+	for _, tap := range nm.ListTapDevices() {
+		if bridges[tap.Bridge] == nil {
+			bridges[tap.Bridge] = map[string]bool{}
+		}
+		bridges[tap.Bridge][tap.Name] = true
+	}
+
+	frontBridge := NetworkBridgeName(NetworkVNI(front.Networks[0].Network))
+	backBridge := NetworkBridgeName(NetworkVNI(back.Networks[0].Network))
+	assert.NotEqual(t, frontBridge, backBridge)
+	assert.NotContains(t, bridges, "testbr0", "overlay taps must not join the node bridge")
+
+	// Only the task on both networks shares a bridge with each of the others
+	assert.Equal(t, map[string]bool{
+		TapName("task-front", 0): true,
+		TapName("task-both", 0):  true,
+	}, bridges[frontBridge])
+	assert.Equal(t, map[string]bool{
+		TapName("task-back", 0): true,
+		TapName("task-both", 1): true,
+	}, bridges[backBridge])
+}
+
+func TestCleanupNetwork_RemovesUnusedNetworkBridges(t *testing.T) {
+	state := newMockState()
+	state.setFail("ip link show br-", true)
+	restore := setupMocksForTest(state)
+	defer restore()
+
+	nm := NewNetworkManager(types.NetworkConfig{BridgeName: "testbr0"}).(*NetworkManager)
+	ctx := context.Background()
+
+	first := overlayTask("task-1", "frontend")
+	second := overlayTask("task-2", "frontend")
+	require.NoError(t, nm.PrepareNetwork(ctx, first))
+	require.NoError(t, nm.PrepareNetwork(ctx, second))
+
+	bridge := NetworkBridgeName(NetworkVNI(first.Networks[0].Network))
+	assert.Equal(t, 1, countCalls(state, "ip link add "+bridge+" type bridge"), "bridge is created once")
+
+	require.NoError(t, nm.CleanupNetwork(ctx, first))
+	assert.Zero(t, countCalls(state, "ip link delete "+bridge), "bridge still in use")
+	assert.Contains(t, nm.networks, "frontend")
+
+	require.NoError(t, nm.CleanupNetwork(ctx, second))
+	assert.Equal(t, 1, countCalls(state, "ip link delete "+bridge))
+	assert.NotContains(t, nm.networks, "frontend")
+}
+
+func TestPrepareNetwork_NetworkGateway(t *testing.T) {
+	state := newMockState()
+	restore := setupMocksForTest(state)
+	defer restore()
+
+	nm := NewNetworkManager(types.NetworkConfig{BridgeName: "testbr0", NATEnabled: true}).(*NetworkManager)
+	nm.natSetup = true
+	ctx := context.Background()
+
+	task := overlayTask("task-1", "frontend")
+	require.NoError(t, nm.PrepareNetwork(ctx, task))
+
+	vni := NetworkVNI(task.Networks[0].Network)
+	bridge := NetworkBridgeName(vni)
+	assert.Equal(t, 1, countCalls(state, "ip addr replace 10.0.9.1/24 dev "+bridge))
+	assert.Equal(t, 1, countCalls(state, "ip link set "+bridge+" address "+networkGatewayMAC(vni)))
+	assert.Len(t, state.firewall.Rules(nftables.TableFamilyINet, FirewallTableName, "postrouting"), 1)
+	assert.Len(t, state.firewall.Rules(nftables.TableFamilyBridge, FirewallTableName, "prerouting"), 2)
+
+	// DHCP hands out the same gateway as the boot arguments
+	taps := nm.ListTapDevices()
+	require.Len(t, taps, 1)
+	assert.Equal(t, "10.0.9.1", taps[0].Gateway)
+
+	require.NoError(t, nm.CleanupNetwork(ctx, task))
+	assert.Empty(t, state.firewall.Rules(nftables.TableFamilyINet, FirewallTableName, "postrouting"))
+	assert.Empty(t, state.firewall.Rules(nftables.TableFamilyBridge, FirewallTableName, "prerouting"))
+}
+
+func TestPrepareNetwork_OverlayLeases(t *testing.T) {
+	state := newMockState()
+	restore := setupMocksForTest(state)
+	defer restore()
+
+	nm := NewNetworkManager(types.NetworkConfig{
+		BridgeName: "testbr0",
+		BridgeIP:   "192.168.127.1/24",
+		Subnet:     "192.168.127.0/24",
+	}).(*NetworkManager)
+	defer nm.Shutdown()
+	ctx := context.Background()
+
+	task := overlayTask("task-1", "frontend", "backend-net")
+	require.NoError(t, nm.PrepareNetwork(ctx, task))
+
+	// Every interface gets a lease, not only those on the default bridge
+	leases := nm.dhcpServer.Leases()
+	require.Len(t, leases, 2)
+	for i, lease := range leases {
+		assert.Equal(t, task.ID, lease.TaskID)
+		assert.Equal(t, fmt.Sprintf("10.0.9.%d", 2+i), lease.IP)
+		assert.Equal(t, "10.0.9.1", lease.Gateway)
+		assert.Equal(t, strings.ToLower(GuestMAC(task.ID, task.Networks[i].Network.ID, i)), lease.MAC)
+	}
+
+	require.NoError(t, nm.CleanupNetwork(ctx, task))
+	assert.Empty(t, nm.dhcpServer.Leases())
+}
+
+func TestPrepareNetwork_NetworkDHCPAndDNS(t *testing.T) {
+	state := newMockState()
+	restore := setupMocksForTest(state)
+	defer restore()
+
+	nm := NewNetworkManager(types.NetworkConfig{
+		BridgeName: "testbr0",
+		BridgeIP:   "192.168.127.1/24",
+		Subnet:     "192.168.127.0/24",
+		IPMode:     "static",
+	}).(*NetworkManager)
+	defer nm.Shutdown()
+	ctx := context.Background()
+
+	node := &types.Task{ID: "task-node", ServiceName: "cache"}
+	front := overlayTask("task-front", "frontend")
+	front.ServiceName = "web"
+	back := overlayTask("task-back", "backend-net")
+	back.ServiceName = "db"
+	back.Networks[0].Addresses = []string{"10.0.9.3/24"}
+	for _, task := range []*types.Task{node, front, back} {
+		require.NoError(t, nm.PrepareNetwork(ctx, task))
+	}
+
+	frontBridge := NetworkBridgeName(NetworkVNI(front.Networks[0].Network))
+	backBridge := NetworkBridgeName(NetworkVNI(back.Networks[0].Network))
+	frontNet, backNet := nm.networks["frontend"], nm.networks["backend-net"]
+	require.NotNil(t, frontNet.dns)
+	require.NotNil(t, backNet.dns)
+
+	// Each network's names resolve on its own bridge only
+	_, ok := frontNet.dns.Lookup("web")
+	assert.True(t, ok)
+	_, ok = frontNet.dns.Lookup("db")
+	assert.False(t, ok)
+	_, ok = backNet.dns.Lookup("db")
+	assert.True(t, ok)
+	_, ok = backNet.dns.Lookup("web")
+	assert.False(t, ok)
+	_, ok = nm.dnsServer.Lookup("cache")
+	assert.True(t, ok)
+	_, ok = nm.dnsServer.Lookup("web")
+	assert.False(t, ok)
+
+	// DHCP answers on every bridge, as its gateway, with its own leases
+	assert.ElementsMatch(t, []string{"testbr0", frontBridge, backBridge}, dhcpBridges(nm.dhcpServer))
+	frontMAC := GuestMAC(front.ID, "frontend", 0)
+	port := &dhcpPort{bridge: frontBridge, serverIP: net.ParseIP("10.0.9.1").To4()}
+	offer := nm.dhcpServer.handle(testRequest(dhcpDiscover, frontMAC, nil), port)
+	require.NotNil(t, offer)
+	assert.Equal(t, "10.0.9.2", offer.YIAddr.String())
+	assert.Equal(t, []byte(port.serverIP), offer.Options[optDNS])
+	port.bridge = backBridge
+	assert.Nil(t, nm.dhcpServer.handle(testRequest(dhcpDiscover, frontMAC, nil), port), "lease of another bridge")
+
+	require.NoError(t, nm.CleanupNetwork(ctx, front))
+	assert.ElementsMatch(t, []string{"testbr0", backBridge}, dhcpBridges(nm.dhcpServer))
+}
+
+func dhcpBridges(s *DHCPServer) []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var bridges []string
+	for bridge := range s.ports {
+		bridges = append(bridges, bridge)
+	}
+	return bridges
+}
+
+func countCalls(state *mockState, call string) int {
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	n := 0
+	for _, c := range state.calls {
+		if c == call {
+			n++
+		}
+	}
+	return n
+}
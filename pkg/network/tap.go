@@ -0,0 +1,63 @@
+package network
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// sysClassNet is the sysfs network device root - overridable for testing
+var sysClassNet = "/sys/class/net"
+
+// CreateTap creates a TAP device that is down and on no bridge, for a VM
+// that is not attached to a task's networks yet (see AdoptTap).
+func CreateTap(name string) error {
+	execCommand("ip", "link", "delete", name).Run()
+	if err := execCommand("ip", "tuntap", "add", name, "mode", "tap").Run(); err != nil {
+		return fmt.Errorf("failed to create TAP device %s: %w", name, err)
+	}
+	return nil
+}
+
+// DeleteTap deletes a TAP device.
+func DeleteTap(name string) error {
+	if err := execCommand("ip", "link", "delete", name).Run(); err != nil {
+		return fmt.Errorf("failed to delete TAP device %s: %w", name, err)
+	}
+	return nil
+}
+
+// AdoptTap moves a task's network attachment onto another TAP device: tap
+// takes over the name, MTU and bridge of the task's device, which is
+// deleted. It lets a VM created before its task, and so holding a TAP
+// device of its own, serve the task's interface.
+func AdoptTap(tap, name string) error {
+	dev := filepath.Join(sysClassNet, name)
+	mtu, err := os.ReadFile(filepath.Join(dev, "mtu"))
+	if err != nil {
+		return fmt.Errorf("failed to read TAP device %s: %w", name, err)
+	}
+	var bridge string
+	if master, err := os.Readlink(filepath.Join(dev, "master")); err == nil {
+		bridge = filepath.Base(master)
+	}
+
+	steps := [][]string{
+		{"link", "set", tap, "down"},
+		{"link", "delete", name},
+		{"link", "set", tap, "name", name},
+		{"link", "set", name, "mtu", strings.TrimSpace(string(mtu))},
+	}
+	if bridge != "" {
+		steps = append(steps, []string{"link", "set", name, "master", bridge})
+	}
+	steps = append(steps, []string{"link", "set", name, "up"})
+
+	for _, args := range steps {
+		if err := execCommand("ip", args...).Run(); err != nil {
+			return fmt.Errorf("failed to move %s onto %s (ip %s): %w", name, tap, strings.Join(args, " "), err)
+		}
+	}
+	return nil
+}
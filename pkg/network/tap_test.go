@@ -0,0 +1,82 @@
+//go:build !integration
+
+package network
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeTap points sysClassNet at a temp dir holding a TAP device with the
+// given MTU, on bridge unless it is empty.
+func fakeTap(t *testing.T, name, mtu, bridge string) {
+	t.Helper()
+	dir := t.TempDir()
+	dev := filepath.Join(dir, name)
+	require.NoError(t, os.MkdirAll(dev, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dev, "mtu"), []byte(mtu+"\n"), 0644))
+	if bridge != "" {
+		require.NoError(t, os.Symlink("../"+bridge, filepath.Join(dev, "master")))
+	}
+
+	orig := sysClassNet
+	sysClassNet = dir
+	t.Cleanup(func() { sysClassNet = orig })
+}
+
+func TestAdoptTap(t *testing.T) {
+	state := newMockState()
+	defer setupMocksForTest(state)()
+	fakeTap(t, "tap-task-0", "1450", "swarm-br0")
+
+	require.NoError(t, AdoptTap("wp-pool-0", "tap-task-0"))
+	assert.Equal(t, []string{
+		"ip link set wp-pool-0 down",
+		"ip link delete tap-task-0",
+		"ip link set wp-pool-0 name tap-task-0",
+		"ip link set tap-task-0 mtu 1450",
+		"ip link set tap-task-0 master swarm-br0",
+		"ip link set tap-task-0 up",
+	}, state.calls)
+}
+
+func TestAdoptTap_NoBridge(t *testing.T) {
+	state := newMockState()
+	defer setupMocksForTest(state)()
+	fakeTap(t, "tap-task-0", "1500", "")
+
+	require.NoError(t, AdoptTap("wp-pool-0", "tap-task-0"))
+	assert.NotContains(t, state.calls, "ip link set tap-task-0 master swarm-br0")
+}
+
+func TestAdoptTap_Errors(t *testing.T) {
+	state := newMockState()
+	defer setupMocksForTest(state)()
+	fakeTap(t, "tap-task-0", "1500", "swarm-br0")
+
+	// The task has no device to adopt
+	assert.Error(t, AdoptTap("wp-pool-0", "tap-missing-0"))
+
+	state.setFail("ip link set wp-pool-0 name", true)
+	assert.Error(t, AdoptTap("wp-pool-0", "tap-task-0"))
+}
+
+func TestCreateDeleteTap(t *testing.T) {
+	state := newMockState()
+	defer setupMocksForTest(state)()
+
+	require.NoError(t, CreateTap("wp-pool-0"))
+	require.NoError(t, DeleteTap("wp-pool-0"))
+	assert.Equal(t, []string{
+		"ip link delete wp-pool-0",
+		"ip tuntap add wp-pool-0 mode tap",
+		"ip link delete wp-pool-0",
+	}, state.calls)
+
+	state.setFail("ip tuntap add", true)
+	assert.Error(t, CreateTap("wp-pool-1"))
+}
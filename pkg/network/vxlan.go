@@ -13,7 +13,6 @@ import (
 
 	"github.com/rs/zerolog/log"
 	"github.com/vishvananda/netlink"
-	"os/exec"
 )
 
 // PeerStore defines the interface for storing and retrieving VXLAN peer information.
@@ -150,6 +149,30 @@ func (v *VXLANManager) SetupVXLAN(physInterface, localIP string) error {
 	return nil
 }
 
+// SetupL2 creates the VXLAN interface, attaches it to the bridge and
+// floods to the known peers, without giving the host an address on the
+// overlay. It is used for per-network bridges that only carry guest
+// traffic.
+func (v *VXLANManager) SetupL2(physInterface, localIP string) error {
+	vxlanName := v.BridgeName + "-vxlan"
+
+	if err := v.createVXLANInterface(vxlanName, physInterface, localIP); err != nil {
+		return fmt.Errorf("failed to create VXLAN interface: %w", err)
+	}
+
+	if err := v.attachVXLANToBridge(vxlanName); err != nil {
+		return fmt.Errorf("failed to attach VXLAN to bridge: %w", err)
+	}
+
+	for _, peer := range v.peerStore.GetPeers() {
+		if err := v.addPeerForwarding(vxlanName, peer); err != nil {
+			return fmt.Errorf("failed to add peer %s: %w", peer, err)
+		}
+	}
+
+	return nil
+}
+
 // createVXLANInterface creates the VXLAN network interface.
 // If VXLAN already exists and is configured correctly, it reuses it.
 func (v *VXLANManager) createVXLANInterface(name, physInterface, localIP string) error {
@@ -280,7 +303,7 @@ func (v *VXLANManager) addPeerForwarding(vxlanName, peerIP string) error {
 
 	// Use bridge fdb append command for VXLAN FDB entries
 	// 'append' allows multiple destinations for the same MAC (required for broadcast flooding)
-	cmd := exec.Command("bridge", "fdb", "append", "00:00:00:00:00:00", "dev", vxlanName, "dst", peerIP, "self", "permanent")
+	cmd := execCommand("bridge", "fdb", "append", "00:00:00:00:00:00", "dev", vxlanName, "dst", peerIP, "self", "permanent")
 	if output, err := cmd.CombinedOutput(); err != nil {
 		// Ignore "file exists" error (entry already present)
 		if !strings.Contains(string(output), "exists") {
@@ -385,8 +408,11 @@ func (v *VXLANManager) UpdatePeers(newPeers []string) error {
 		delete(currentPeers, peer)
 	}
 
-	// Remove old peers
+	// Remove old peers and their flooding entries
 	for peer := range currentPeers {
+		if output, err := execCommand("bridge", "fdb", "del", "00:00:00:00:00:00", "dev", vxlanName, "dst", peer, "self").CombinedOutput(); err != nil {
+			log.Debug().Err(err).Str("peer", peer).Str("output", string(output)).Msg("Failed to remove VXLAN FDB entry")
+		}
 		v.peerStore.RemovePeer(peer)
 		log.Info().Str("peer", peer).Msg("Removed VXLAN peer")
 	}
@@ -451,20 +451,21 @@ func TestSeccompWriteAndValidate_CoverageBoost(t *testing.T) {
 
 	t.Run("validate invalid default action", func(t *testing.T) {
 		tmpFile := filepath.Join(t.TempDir(), "invalid_action.json")
-		content := `{"defaultAction":"INVALID","architectures":["SCMP_ARCH_X86_64"],"syscalls":[]}`
+		filter := `{"default_action":"INVALID","filter_action":"allow","filter":[]}`
+		content := `{"vmm":` + filter + `,"api":` + filter + `,"vcpu":` + filter + `}`
 		require.NoError(t, os.WriteFile(tmpFile, []byte(content), 0644))
 		err := ValidateSeccompProfile(tmpFile)
 		assert.Error(t, err)
 		assert.Contains(t, err.Error(), "invalid default action")
 	})
 
-	t.Run("validate invalid architecture", func(t *testing.T) {
-		tmpFile := filepath.Join(t.TempDir(), "invalid_arch.json")
-		content := `{"defaultAction":"SCMP_ACT_ERRNO","architectures":["SCMP_ARCH_INVALID"],"syscalls":[]}`
+	t.Run("validate missing thread category", func(t *testing.T) {
+		tmpFile := filepath.Join(t.TempDir(), "missing_thread.json")
+		content := `{"vmm":{"default_action":"trap","filter_action":"allow","filter":[]}}`
 		require.NoError(t, os.WriteFile(tmpFile, []byte(content), 0644))
 		err := ValidateSeccompProfile(tmpFile)
 		assert.Error(t, err)
-		assert.Contains(t, err.Error(), "invalid architecture")
+		assert.Contains(t, err.Error(), "missing filter")
 	})
 
 	t.Run("write to nested directory", func(t *testing.T) {
@@ -477,28 +478,11 @@ func TestSeccompWriteAndValidate_CoverageBoost(t *testing.T) {
 	})
 }
 
-// TestRestrictiveSeccompFilter_CoverageBoost covers seccomp.go RestrictiveSeccompFilter
-func TestRestrictiveSeccompFilter_CoverageBoost(t *testing.T) {
-	filter := RestrictiveSeccompFilter()
-	assert.NotNil(t, filter)
-	assert.Equal(t, "SCMP_ACT_ERRNO", filter.DefaultAction)
-	assert.NotEmpty(t, filter.Syscalls)
-
-	// Verify dangerous syscalls are removed
-	for _, rule := range filter.Syscalls {
-		for _, name := range rule.Names {
-			assert.NotEqual(t, "mount", name)
-			assert.NotEqual(t, "reboot", name)
-			assert.NotEqual(t, "kexec_load", name)
-		}
-	}
-}
-
 // TestDefaultSeccompFilter_CoverageBoost
 func TestDefaultSeccompFilter_CoverageBoost(t *testing.T) {
-	filter := DefaultSeccompFilter()
-	assert.NotNil(t, filter)
-	assert.Equal(t, "SCMP_ACT_ERRNO", filter.DefaultAction)
-	assert.Contains(t, filter.Architectures, "SCMP_ARCH_X86_64")
-	assert.True(t, len(filter.Syscalls) > 10)
+	profile, err := DefaultSeccompFilter(SeccompArchX86_64)
+	require.NoError(t, err)
+	require.NotNil(t, profile[SeccompThreadVMM])
+	assert.Equal(t, SeccompActTrap, profile[SeccompThreadVMM].DefaultAction)
+	assert.True(t, len(profile[SeccompThreadVMM].Filter) > 10)
 }
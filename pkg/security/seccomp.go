@@ -1,110 +1,380 @@
 package security
 
 import (
+	"bufio"
+	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
 
+	"github.com/restuhaqza/swarmcracker/pkg/arch"
 	"github.com/rs/zerolog/log"
 )
 
-// SeccompFilter defines a seccomp filter for Firecracker VMs
+// Firecracker thread categories. Firecracker installs one seccomp filter per
+// category on startup; a profile must define all three.
+const (
+	SeccompThreadVMM  = "vmm"
+	SeccompThreadAPI  = "api"
+	SeccompThreadVCPU = "vcpu"
+)
+
+// Target architectures understood by seccompiler-bin.
+const (
+	SeccompArchX86_64  = "x86_64"
+	SeccompArchAarch64 = "aarch64"
+)
+
+// SeccompCompilerBinary is the Firecracker tool that compiles JSON filters to BPF.
+const SeccompCompilerBinary = "seccompiler-bin"
+
+// SeccompProfile is a Firecracker seccompiler filter file: one filter per
+// thread category.
+type SeccompProfile map[string]*SeccompFilter
+
+// SeccompFilter is the filter installed on one Firecracker thread category.
+// Syscalls matching a rule get FilterAction, all others get DefaultAction.
 type SeccompFilter struct {
-	DefaultAction string        `json:"defaultAction"`
-	Architectures []string      `json:"architectures"`
-	Syscalls      []SyscallRule `json:"syscalls"`
+	DefaultAction SeccompAction `json:"default_action"`
+	FilterAction  SeccompAction `json:"filter_action"`
+	Filter        []SyscallRule `json:"filter"`
 }
 
-// SyscallRule defines a rule for system calls
+// SyscallRule matches a syscall, optionally only when all of its argument
+// conditions hold. Several rules for the same syscall are OR-ed.
 type SyscallRule struct {
-	Names  []string `json:"names"`
-	Action string   `json:"action"`
-	Args   []Arg    `json:"args,omitempty"`
-}
-
-// Arg defines argument constraints for syscalls
-type Arg struct {
-	Index    uint   `json:"index"`
-	Value    uint64 `json:"value"`
-	ValueTwo uint64 `json:"valueTwo,omitempty"`
-	Op       string `json:"op"`
-}
-
-// DefaultSeccompFilter returns a restrictive seccomp profile for container workloads
-func DefaultSeccompFilter() *SeccompFilter {
-	return &SeccompFilter{
-		DefaultAction: "SCMP_ACT_ERRNO",
-		Architectures: []string{"SCMP_ARCH_X86_64", "SCMP_ARCH_X86"},
-		Syscalls: []SyscallRule{
-			// Basic I/O operations
-			{Names: []string{"read", "write", "open", "close", "stat", "fstat", "lstat", "poll"}, Action: "SCMP_ACT_ALLOW"},
-			{Names: []string{"lseek", "mmap", "mprotect", "munmap", "brk"}, Action: "SCMP_ACT_ALLOW"},
-			{Names: []string{"rt_sigaction", "rt_sigprocmask", "rt_sigreturn"}, Action: "SCMP_ACT_ALLOW"},
-			{Names: []string{"ioctl", "pread64", "pwrite64", "readv", "writev"}, Action: "SCMP_ACT_ALLOW"},
-			{Names: []string{"access", "pipe", "select", "sched_yield", "mremap"}, Action: "SCMP_ACT_ALLOW"},
-			{Names: []string{"msync", "mincore", "madvise"}, Action: "SCMP_ACT_ALLOW"},
-			{Names: []string{"dup", "dup2", "pause", "nanosleep", "getitimer", "alarm"}, Action: "SCMP_ACT_ALLOW"},
-			{Names: []string{"setitimer", "getpid", "sendfile", "socket", "connect"}, Action: "SCMP_ACT_ALLOW"},
-			{Names: []string{"accept", "sendto", "recvfrom", "sendmsg", "recvmsg"}, Action: "SCMP_ACT_ALLOW"},
-			{Names: []string{"shutdown", "bind", "listen", "getsockname", "getpeername"}, Action: "SCMP_ACT_ALLOW"},
-			{Names: []string{"socketpair", "setsockopt", "getsockopt", "clone"}, Action: "SCMP_ACT_ALLOW"},
-			{Names: []string{"fork", "vfork", "execve", "exit", "wait4", "kill", "uname"}, Action: "SCMP_ACT_ALLOW"},
-			{Names: []string{"fcntl", "flock", "fsync", "fdatasync", "truncate", "ftruncate"}, Action: "SCMP_ACT_ALLOW"},
-			{Names: []string{"getdents", "getcwd", "chdir", "fchdir", "rename", "mkdir", "rmdir"}, Action: "SCMP_ACT_ALLOW"},
-			{Names: []string{"creat", "link", "unlink", "symlink", "readlink", "chmod", "fchmod"}, Action: "SCMP_ACT_ALLOW"},
-			{Names: []string{"chown", "fchown", "lchown", "umask", "gettimeofday", "getrlimit"}, Action: "SCMP_ACT_ALLOW"},
-			{Names: []string{"getrusage", "sysinfo", "times", "getuid", "getgid", "setuid", "setgid"}, Action: "SCMP_ACT_ALLOW"},
-			{Names: []string{"geteuid", "getegid", "setpgid", "getppid", "getpgrp", "setsid"}, Action: "SCMP_ACT_ALLOW"},
-			{Names: []string{"setreuid", "setregid", "getgroups", "setgroups", "setresuid", "setresgid"}, Action: "SCMP_ACT_ALLOW"},
-			{Names: []string{"getresuid", "getresgid", "getpgid", "setfsuid", "setfsgid", "getsid"}, Action: "SCMP_ACT_ALLOW"},
-			{Names: []string{"capget", "capset", "rt_sigpending", "rt_sigtimedwait", "rt_sigqueueinfo"}, Action: "SCMP_ACT_ALLOW"},
-			{Names: []string{"sigaltstack", "utime", "mknod", "uselib", "personality"}, Action: "SCMP_ACT_ALLOW"},
-			{Names: []string{"ustat", "statfs", "fstatfs", "sysfs", "getpriority", "setpriority"}, Action: "SCMP_ACT_ALLOW"},
-			{Names: []string{"sched_setparam", "sched_getparam", "sched_setscheduler", "sched_getscheduler"}, Action: "SCMP_ACT_ALLOW"},
-			{Names: []string{"sched_get_priority_max", "sched_get_priority_min", "sched_rr_get_interval"}, Action: "SCMP_ACT_ALLOW"},
-			{Names: []string{"mlock", "munlock", "mlockall", "munlockall", "mprotect", "sigprocmask"}, Action: "SCMP_ACT_ALLOW"},
-			{Names: []string{"getuid32", "getgid32", "setuid32", "setgid32", "geteuid32", "getegid32"}, Action: "SCMP_ACT_ALLOW"},
-			{Names: []string{"setreuid32", "setregid32", "getgroups32", "setgroups32", "fchown32"}, Action: "SCMP_ACT_ALLOW"},
-			{Names: []string{"setresuid32", "getresuid32", "setresgid32", "getresgid32", "chown32"}, Action: "SCMP_ACT_ALLOW"},
-			{Names: []string{"setuid32", "setgid32", "setfsuid32", "setfsgid32"}, Action: "SCMP_ACT_ALLOW"},
-			{Names: []string{"prctl", "arch_prctl", "adjtimex", "setrlimit"}, Action: "SCMP_ACT_ALLOW"},
-			// Blocked privileged syscalls: mount, umount2, pivot_root, chroot,
-			// swapon, swapoff, reboot, iopl, ioperm, init_module,
-			// delete_module, acct, settimeofday, clock_settime, sethostname
-			{Names: []string{"quotactl", "gettid", "readahead", "setxattr", "lsetxattr", "fsetxattr"}, Action: "SCMP_ACT_ALLOW"},
-			{Names: []string{"getxattr", "lgetxattr", "fgetxattr", "listxattr", "llistxattr", "flistxattr"}, Action: "SCMP_ACT_ALLOW"},
-			{Names: []string{"removexattr", "lremovexattr", "fremovexattr", "tkill", "time", "futex"}, Action: "SCMP_ACT_ALLOW"},
-			{Names: []string{"sched_setaffinity", "sched_getaffinity", "set_thread_area", "io_setup"}, Action: "SCMP_ACT_ALLOW"},
-			{Names: []string{"io_destroy", "io_getevents", "io_submit", "io_cancel", "get_thread_area"}, Action: "SCMP_ACT_ALLOW"},
-			{Names: []string{"epoll_create", "epoll_ctl", "epoll_wait", "remap_file_pages", "getdents64"}, Action: "SCMP_ACT_ALLOW"},
-			{Names: []string{"set_tid_address", "restart_syscall", "semtimedop", "fadvise64", "timer_create"}, Action: "SCMP_ACT_ALLOW"},
-			{Names: []string{"timer_settime", "timer_gettime", "timer_getoverrun", "timer_delete", "clock_settime"}, Action: "SCMP_ACT_ALLOW"},
-			{Names: []string{"clock_gettime", "clock_getres", "clock_nanosleep", "exit_group", "epoll_wait"}, Action: "SCMP_ACT_ALLOW"},
-			{Names: []string{"epoll_ctl", "tgkill", "utimes", "mbind", "set_mempolicy"}, Action: "SCMP_ACT_ALLOW"},
-			{Names: []string{"get_mempolicy", "mq_open", "mq_unlink", "mq_timedsend", "mq_timedreceive"}, Action: "SCMP_ACT_ALLOW"},
-			{Names: []string{"mq_notify", "mq_getsetattr", "waitid"}, Action: "SCMP_ACT_ALLOW"},
-			{Names: []string{"ioprio_set", "ioprio_get", "inotify_init"}, Action: "SCMP_ACT_ALLOW"},
-			{Names: []string{"inotify_add_watch", "inotify_rm_watch", "migrate_pages", "openat", "mkdirat"}, Action: "SCMP_ACT_ALLOW"},
-			{Names: []string{"mknodat", "fchownat", "futimesat", "newfstatat", "unlinkat"}, Action: "SCMP_ACT_ALLOW"},
-			{Names: []string{"renameat", "linkat", "symlinkat", "readlinkat", "fchmodat", "faccessat"}, Action: "SCMP_ACT_ALLOW"},
-			{Names: []string{"pselect6", "ppoll", "unshare", "set_robust_list", "get_robust_list"}, Action: "SCMP_ACT_ALLOW"},
-			{Names: []string{"splice", "tee", "sync_file_range", "vmsplice", "move_pages"}, Action: "SCMP_ACT_ALLOW"},
-			{Names: []string{"utimensat", "epoll_pwait", "signalfd", "timerfd_create", "eventfd"}, Action: "SCMP_ACT_ALLOW"},
-			{Names: []string{"fallocate", "timerfd_settime", "timerfd_gettime", "accept4", "signalfd4"}, Action: "SCMP_ACT_ALLOW"},
-			{Names: []string{"epoll_create2", "epoll_ctl", "epoll_wait", "dup3", "pipe2"}, Action: "SCMP_ACT_ALLOW"},
-			{Names: []string{"inotify_init1", "preadv", "pwritev", "rt_tgsigqueueinfo", "perf_event_open"}, Action: "SCMP_ACT_ALLOW"},
-			{Names: []string{"recvmmsg", "sendmmsg", "setns", "getcpu", "process_vm_readv"}, Action: "SCMP_ACT_ALLOW"},
-			{Names: []string{"process_vm_writev"}, Action: "SCMP_ACT_ALLOW"},
-		},
-	}
-}
-
-// WriteSeccompProfile writes a seccomp profile to a file for Firecracker
+	Syscall string       `json:"syscall"`
+	Args    []SyscallArg `json:"args,omitempty"`
+	Comment string       `json:"comment,omitempty"`
+}
+
+// SyscallArg is a condition on one syscall argument.
+type SyscallArg struct {
+	Index   uint8  `json:"index"`
+	Type    string `json:"type"`
+	Op      ArgOp  `json:"op"`
+	Val     uint64 `json:"val"`
+	Comment string `json:"comment,omitempty"`
+}
+
+// SeccompAction is a seccompiler action: "allow", "trap", "log",
+// "kill_thread", "kill_process" or {"errno": N}.
+type SeccompAction struct {
+	Name  string
+	Errno uint32
+}
+
+// Seccomp actions.
+var (
+	SeccompActAllow       = SeccompAction{Name: "allow"}
+	SeccompActTrap        = SeccompAction{Name: "trap"}
+	SeccompActLog         = SeccompAction{Name: "log"}
+	SeccompActKillThread  = SeccompAction{Name: "kill_thread"}
+	SeccompActKillProcess = SeccompAction{Name: "kill_process"}
+)
+
+// SeccompActErrno fails the syscall with errno.
+func SeccompActErrno(errno uint32) SeccompAction {
+	return SeccompAction{Name: "errno", Errno: errno}
+}
+
+// MarshalJSON implements json.Marshaler.
+func (a SeccompAction) MarshalJSON() ([]byte, error) {
+	if a.Name == "errno" {
+		return json.Marshal(map[string]uint32{"errno": a.Errno})
+	}
+	return json.Marshal(a.Name)
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (a *SeccompAction) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err == nil {
+		*a = SeccompAction{Name: name}
+		return nil
+	}
+	var obj map[string]uint32
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return fmt.Errorf("invalid action %s", data)
+	}
+	errno, ok := obj["errno"]
+	if !ok || len(obj) != 1 {
+		return fmt.Errorf("invalid action %s", data)
+	}
+	*a = SeccompActErrno(errno)
+	return nil
+}
+
+func (a SeccompAction) valid() bool {
+	switch a.Name {
+	case "allow", "trap", "log", "kill_thread", "kill_process", "errno":
+		return true
+	}
+	return false
+}
+
+func (a SeccompAction) String() string {
+	if a.Name == "errno" {
+		return fmt.Sprintf("errno(%d)", a.Errno)
+	}
+	return a.Name
+}
+
+// ArgOp is an argument comparison: "eq", "ne", "lt", "le", "gt", "ge" or
+// {"masked_eq": mask}, which compares arg&mask with the value.
+type ArgOp struct {
+	Name string
+	Mask uint64
+}
+
+// Argument comparisons.
+var (
+	ArgOpEq = ArgOp{Name: "eq"}
+	ArgOpNe = ArgOp{Name: "ne"}
+	ArgOpLt = ArgOp{Name: "lt"}
+	ArgOpLe = ArgOp{Name: "le"}
+	ArgOpGt = ArgOp{Name: "gt"}
+	ArgOpGe = ArgOp{Name: "ge"}
+)
+
+// ArgOpMaskedEq compares the argument masked with mask.
+func ArgOpMaskedEq(mask uint64) ArgOp {
+	return ArgOp{Name: "masked_eq", Mask: mask}
+}
+
+// MarshalJSON implements json.Marshaler.
+func (o ArgOp) MarshalJSON() ([]byte, error) {
+	if o.Name == "masked_eq" {
+		return json.Marshal(map[string]uint64{"masked_eq": o.Mask})
+	}
+	return json.Marshal(o.Name)
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (o *ArgOp) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err == nil {
+		*o = ArgOp{Name: name}
+		return nil
+	}
+	var obj map[string]uint64
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return fmt.Errorf("invalid op %s", data)
+	}
+	mask, ok := obj["masked_eq"]
+	if !ok || len(obj) != 1 {
+		return fmt.Errorf("invalid op %s", data)
+	}
+	*o = ArgOpMaskedEq(mask)
+	return nil
+}
+
+func (o ArgOp) valid() bool {
+	switch o.Name {
+	case "eq", "ne", "lt", "le", "gt", "ge", "masked_eq":
+		return true
+	}
+	return false
+}
+
+// SeccompArch maps an architecture name (amd64, aarch64, ...) to the
+// seccompiler target architecture.
+func SeccompArch(name string) (string, error) {
+	a, err := arch.Lookup(name)
+	if err != nil {
+		return "", fmt.Errorf("seccomp filters are not supported on %s", name)
+	}
+	return a.Machine, nil
+}
+
+// ioctl request types (bits 8-15 of the request number) Firecracker uses.
+const (
+	ioctlTypeTTY  = 0x54 // TCGETS/TCSETS on the serial console, FIONBIO, TUN
+	ioctlTypeUFFD = 0xaa // userfaultfd, for snapshot restore
+	ioctlTypeKVM  = 0xae
+)
+
+// syscalls allowed on every thread category
+var seccompCommonSyscalls = []string{
+	"brk", "clock_gettime", "close", "exit", "exit_group", "fstat",
+	"futex", "getpid", "getrandom", "gettid", "lseek", "madvise", "mmap",
+	"mprotect", "mremap", "munmap", "read", "readv", "rt_sigprocmask",
+	"rt_sigreturn", "sched_yield", "sigaltstack", "tkill", "write", "writev",
+}
+
+// extra syscalls per thread category
+var seccompThreadSyscalls = map[string][]string{
+	SeccompThreadVMM: {
+		"accept4", "clock_nanosleep", "connect", "dup", "epoll_ctl",
+		"epoll_pwait", "eventfd2", "fallocate", "fcntl", "fdatasync", "fsync",
+		"ftruncate", "io_uring_enter", "io_uring_register", "io_uring_setup",
+		"msync", "nanosleep", "newfstatat", "openat", "pipe2", "pread64",
+		"preadv", "pwrite64", "pwritev", "recvfrom", "recvmsg",
+		"restart_syscall", "rt_sigaction", "sched_getaffinity", "sendmsg",
+		"statx", "tgkill", "timerfd_create", "timerfd_settime", "userfaultfd",
+	},
+	SeccompThreadAPI: {
+		"accept4", "epoll_ctl", "epoll_pwait", "fcntl", "newfstatat", "openat",
+		"recvfrom", "recvmsg", "sendmsg", "statx",
+	},
+	SeccompThreadVCPU: {
+		"fsync", "pread64", "pwrite64", "recvfrom", "sendmsg", "tgkill",
+		"timerfd_settime",
+	},
+}
+
+// syscalls that only exist on x86_64
+var seccompX86Syscalls = map[string][]string{
+	SeccompThreadVMM: {"epoll_wait", "open"},
+	SeccompThreadAPI: {"epoll_wait", "open"},
+}
+
+// ioctl request types allowed per thread category
+var seccompThreadIoctls = map[string][]uint64{
+	SeccompThreadVMM:  {ioctlTypeKVM, ioctlTypeTTY, ioctlTypeUFFD},
+	SeccompThreadAPI:  {ioctlTypeTTY},
+	SeccompThreadVCPU: {ioctlTypeKVM},
+}
+
+// DefaultSeccompFilter returns the Firecracker seccompiler profile for arch
+// (x86_64 or aarch64). Each thread category may only make the syscalls it
+// needs after boot; ioctl is limited to the KVM, TTY/TUN and userfaultfd
+// request types and socket to AF_UNIX. Other syscalls trap, which
+// Firecracker logs and counts in its seccomp metrics before exiting.
+func DefaultSeccompFilter(arch string) (SeccompProfile, error) {
+	if arch != SeccompArchX86_64 && arch != SeccompArchAarch64 {
+		return nil, fmt.Errorf("unsupported seccomp architecture: %s", arch)
+	}
+
+	profile := SeccompProfile{}
+	for _, thread := range []string{SeccompThreadVMM, SeccompThreadAPI, SeccompThreadVCPU} {
+		names := append([]string{}, seccompCommonSyscalls...)
+		names = append(names, seccompThreadSyscalls[thread]...)
+		if arch == SeccompArchX86_64 {
+			names = append(names, seccompX86Syscalls[thread]...)
+		}
+		sort.Strings(names)
+
+		filter := &SeccompFilter{
+			DefaultAction: SeccompActTrap,
+			FilterAction:  SeccompActAllow,
+		}
+		for _, name := range names {
+			filter.Filter = append(filter.Filter, SyscallRule{Syscall: name})
+		}
+		for _, ioctlType := range seccompThreadIoctls[thread] {
+			filter.Filter = append(filter.Filter, SyscallRule{
+				Syscall: "ioctl",
+				Args: []SyscallArg{{
+					Index: 1,
+					Type:  "dword",
+					Op:    ArgOpMaskedEq(0xff00),
+					Val:   ioctlType << 8,
+				}},
+				Comment: fmt.Sprintf("ioctl type 0x%02x", ioctlType),
+			})
+		}
+		if thread == SeccompThreadVMM {
+			filter.Filter = append(filter.Filter, SyscallRule{
+				Syscall: "socket",
+				Args:    []SyscallArg{{Index: 0, Type: "dword", Op: ArgOpEq, Val: 1}},
+				Comment: "AF_UNIX only, for vsock",
+			})
+		}
+		profile[thread] = filter
+	}
+	return profile, nil
+}
+
+// x86_64 syscalls without an aarch64 counterpart; aarch64 only has the
+// *at and newer variants.
+var seccompX86OnlySyscalls = map[string]bool{
+	"access": true, "alarm": true, "arch_prctl": true, "chmod": true,
+	"chown": true, "creat": true, "dup2": true, "epoll_create": true,
+	"epoll_wait": true, "eventfd": true, "fork": true, "getdents": true,
+	"getpgrp": true, "inotify_init": true, "iopl": true, "ioperm": true,
+	"lchown": true, "link": true, "lstat": true, "mkdir": true,
+	"modify_ldt": true, "open": true, "pause": true, "pipe": true,
+	"poll": true, "readlink": true, "rename": true, "rmdir": true,
+	"select": true, "signalfd": true, "stat": true, "symlink": true,
+	"time": true, "unlink": true, "utime": true, "utimes": true,
+	"vfork": true,
+}
+
+// Validate checks the profile the way seccompiler-bin would for arch. An
+// empty arch skips the architecture-specific syscall checks.
+func (p SeccompProfile) Validate(arch string) error {
+	for _, thread := range []string{SeccompThreadVMM, SeccompThreadAPI, SeccompThreadVCPU} {
+		if p[thread] == nil {
+			return fmt.Errorf("missing filter for %q threads", thread)
+		}
+	}
+
+	for thread, filter := range p {
+		switch thread {
+		case SeccompThreadVMM, SeccompThreadAPI, SeccompThreadVCPU:
+		default:
+			return fmt.Errorf("invalid thread category: %s", thread)
+		}
+		if !filter.DefaultAction.valid() {
+			return fmt.Errorf("%s: invalid default action: %s", thread, filter.DefaultAction)
+		}
+		if !filter.FilterAction.valid() {
+			return fmt.Errorf("%s: invalid filter action: %s", thread, filter.FilterAction)
+		}
+		if filter.DefaultAction == filter.FilterAction {
+			return fmt.Errorf("%s: default action and filter action are both %s", thread, filter.DefaultAction)
+		}
+
+		for _, rule := range filter.Filter {
+			if rule.Syscall == "" {
+				return fmt.Errorf("%s: rule without a syscall", thread)
+			}
+			if arch == SeccompArchAarch64 && seccompX86OnlySyscalls[rule.Syscall] {
+				return fmt.Errorf("%s: syscall %s does not exist on %s", thread, rule.Syscall, arch)
+			}
+			for _, arg := range rule.Args {
+				if arg.Index > 5 {
+					return fmt.Errorf("%s: %s: invalid argument index %d", thread, rule.Syscall, arg.Index)
+				}
+				if !arg.Op.valid() {
+					return fmt.Errorf("%s: %s: invalid op %q", thread, rule.Syscall, arg.Op.Name)
+				}
+				switch arg.Type {
+				case "qword":
+				case "dword":
+					if arg.Val > 0xffffffff || arg.Op.Mask > 0xffffffff {
+						return fmt.Errorf("%s: %s: value does not fit a dword argument", thread, rule.Syscall)
+					}
+				default:
+					return fmt.Errorf("%s: %s: invalid argument type %q", thread, rule.Syscall, arg.Type)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// WriteSeccompProfile writes the default Firecracker seccompiler profile for
+// the host architecture to a file
 func WriteSeccompProfile(vmID, profilePath string) error {
-	filter := DefaultSeccompFilter()
+	arch, err := SeccompArch(runtime.GOARCH)
+	if err != nil {
+		return err
+	}
+	profile, err := DefaultSeccompFilter(arch)
+	if err != nil {
+		return err
+	}
 
-	data, err := json.MarshalIndent(filter, "", "  ")
+	data, err := json.MarshalIndent(profile, "", "  ")
 	if err != nil {
 		return fmt.Errorf("failed to marshal seccomp filter: %w", err)
 	}
@@ -121,89 +391,158 @@ func WriteSeccompProfile(vmID, profilePath string) error {
 	log.Info().
 		Str("vm_id", vmID).
 		Str("profile_path", profilePath).
+		Str("arch", arch).
 		Msg("Seccomp profile written")
 
 	return nil
 }
 
-// ValidateSeccompProfile checks if a seccomp profile is valid
+// ValidateSeccompProfile checks if a seccompiler profile is valid for the
+// host architecture
 func ValidateSeccompProfile(profilePath string) error {
 	data, err := os.ReadFile(profilePath)
 	if err != nil {
 		return fmt.Errorf("failed to read seccomp profile: %w", err)
 	}
 
-	var filter SeccompFilter
-	if err := json.Unmarshal(data, &filter); err != nil {
+	var profile SeccompProfile
+	if err := json.Unmarshal(data, &profile); err != nil {
 		return fmt.Errorf("failed to parse seccomp profile: %w", err)
 	}
 
-	// Validate default action
-	if filter.DefaultAction != "SCMP_ACT_ALLOW" &&
-		filter.DefaultAction != "SCMP_ACT_DENY" &&
-		filter.DefaultAction != "SCMP_ACT_ERRNO" &&
-		filter.DefaultAction != "SCMP_ACT_KILL" {
-		return fmt.Errorf("invalid default action: %s", filter.DefaultAction)
+	arch, _ := SeccompArch(runtime.GOARCH)
+	if err := profile.Validate(arch); err != nil {
+		return fmt.Errorf("invalid seccomp profile: %w", err)
 	}
 
-	// Validate architectures
-	validArchs := map[string]bool{
-		"SCMP_ARCH_X86_64":  true,
-		"SCMP_ARCH_X86":     true,
-		"SCMP_ARCH_ARM":     true,
-		"SCMP_ARCH_AARCH64": true,
+	log.Debug().Str("profile_path", profilePath).Msg("Seccomp profile validated")
+	return nil
+}
+
+// CompileSeccompFilter compiles a seccompiler JSON profile to the BPF file
+// Firecracker loads with --seccomp-filter. With basic set, argument
+// conditions are dropped and only syscall numbers are filtered.
+func CompileSeccompFilter(ctx context.Context, profilePath, arch, outputPath string, basic bool) error {
+	compiler, err := exec.LookPath(SeccompCompilerBinary)
+	if err != nil {
+		return fmt.Errorf("%s not found in PATH: %w", SeccompCompilerBinary, err)
 	}
-	for _, arch := range filter.Architectures {
-		if !validArchs[arch] {
-			return fmt.Errorf("invalid architecture: %s", arch)
-		}
+
+	args := []string{
+		"--input-file", profilePath,
+		"--target-arch", arch,
+		"--output-file", outputPath,
+	}
+	if basic {
+		args = append(args, "--basic")
 	}
 
-	log.Debug().Str("profile_path", profilePath).Msg("Seccomp profile validated")
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, compiler, args...)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to compile seccomp filter %s: %w: %s", profilePath, err, strings.TrimSpace(stderr.String()))
+	}
+
+	log.Debug().
+		Str("profile_path", profilePath).
+		Str("output", outputPath).
+		Str("arch", arch).
+		Msg("Seccomp filter compiled")
 	return nil
 }
 
-// RestrictiveSeccompFilter returns a more restrictive filter for high-security scenarios
-func RestrictiveSeccompFilter() *SeccompFilter {
-	filter := DefaultSeccompFilter()
+// PrepareSeccompFilter resolves the seccomp_filter setting to a compiled BPF
+// file for --seccomp-filter, compiling into dir when needed:
+//   - "" keeps Firecracker's built-in filters and returns ""
+//   - "default" compiles the profile from DefaultSeccompFilter
+//   - a .json file is validated and compiled
+//   - any other path is used as an already compiled filter
+func PrepareSeccompFilter(ctx context.Context, setting, dir string) (string, error) {
+	if setting == "" {
+		return "", nil
+	}
 
-	// Block dangerous syscalls even if in default list
-	blockedSyscalls := []string{
-		"mount", "umount2", "pivot_root", "chroot",
-		"init_module", "delete_module", "kexec_load",
-		"swapon", "swapoff", "reboot",
-		"setuid", "setgid", "setreuid", "setregid",
-		"setresuid", "setresgid", "setfsuid", "setfsgid",
+	arch, err := SeccompArch(runtime.GOARCH)
+	if err != nil {
+		return "", err
 	}
 
-	// Remove blocked syscalls from allowed list
-	var filteredRules []SyscallRule
-	for _, rule := range filter.Syscalls {
-		if rule.Action != "SCMP_ACT_ALLOW" {
-			filteredRules = append(filteredRules, rule)
-			continue
+	profilePath := setting
+	switch {
+	case setting == "default":
+		profilePath = filepath.Join(dir, "seccomp.json")
+		if err := WriteSeccompProfile("", profilePath); err != nil {
+			return "", err
 		}
-
-		var allowedNames []string
-		for _, name := range rule.Names {
-			blocked := false
-			for _, blockedName := range blockedSyscalls {
-				if name == blockedName {
-					blocked = true
-					break
-				}
-			}
-			if !blocked {
-				allowedNames = append(allowedNames, name)
-			}
+	case strings.HasSuffix(setting, ".json"):
+		if err := ValidateSeccompProfile(setting); err != nil {
+			return "", err
+		}
+	default:
+		if _, err := os.Stat(setting); err != nil {
+			return "", fmt.Errorf("seccomp filter not found: %w", err)
 		}
+		return setting, nil
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create seccomp filter directory: %w", err)
+	}
+	outputPath := filepath.Join(dir, strings.TrimSuffix(filepath.Base(profilePath), ".json")+".bpf")
+	if err := CompileSeccompFilter(ctx, profilePath, arch, outputPath, false); err != nil {
+		return "", err
+	}
+	return outputPath, nil
+}
 
-		if len(allowedNames) > 0 {
-			rule.Names = allowedNames
-			filteredRules = append(filteredRules, rule)
+// procDir is the proc filesystem root, overridden in tests
+var procDir = "/proc"
+
+// UnfilteredThreads returns the names of the threads of pid that run
+// without a seccomp filter (Seccomp mode other than 2 in their status).
+func UnfilteredThreads(pid int) ([]string, error) {
+	taskDir := filepath.Join(procDir, strconv.Itoa(pid), "task")
+	entries, err := os.ReadDir(taskDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list threads of %d: %w", pid, err)
+	}
+
+	var unfiltered []string
+	for _, entry := range entries {
+		name, mode, err := threadSeccompMode(filepath.Join(taskDir, entry.Name(), "status"))
+		if err != nil {
+			// The thread exited
+			continue
+		}
+		if mode != "2" {
+			unfiltered = append(unfiltered, name)
 		}
 	}
+	return unfiltered, nil
+}
+
+// threadSeccompMode reads the thread name and Seccomp mode from a status file
+func threadSeccompMode(statusPath string) (string, string, error) {
+	f, err := os.Open(statusPath)
+	if err != nil {
+		return "", "", err
+	}
+	defer f.Close()
 
-	filter.Syscalls = filteredRules
-	return filter
+	var name, mode string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "Name":
+			name = strings.TrimSpace(value)
+		case "Seccomp":
+			mode = strings.TrimSpace(value)
+		}
+	}
+	return name, mode, scanner.Err()
 }
@@ -1,165 +1,308 @@
 package security
 
 import (
+	"context"
 	"encoding/json"
 	"os"
 	"path/filepath"
+	"runtime"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
-func TestDefaultSeccompFilter(t *testing.T) {
-	filter := DefaultSeccompFilter()
-
-	assert.NotNil(t, filter)
-	assert.Equal(t, "SCMP_ACT_ERRNO", filter.DefaultAction)
-	assert.NotEmpty(t, filter.Architectures)
-	assert.NotEmpty(t, filter.Syscalls)
-
-	// Verify architectures contain common ones
-	found := false
-	for _, arch := range filter.Architectures {
-		if arch == "SCMP_ARCH_X86_64" || arch == "SCMP_ARCH_X86" {
-			found = true
-			break
+// allowedSyscalls returns the syscalls a filter allows without conditions
+func allowedSyscalls(filter *SeccompFilter) map[string]bool {
+	allowed := make(map[string]bool)
+	for _, rule := range filter.Filter {
+		if len(rule.Args) == 0 {
+			allowed[rule.Syscall] = true
 		}
 	}
-	assert.True(t, found, "Should contain x86 architecture")
-
-	// Verify some syscalls are allowed
-	allowedSyscalls := []string{"read", "write", "open", "close", "socket"}
-	syscallMap := make(map[string]bool)
-	for _, rule := range filter.Syscalls {
-		if rule.Action == "SCMP_ACT_ALLOW" {
-			for _, name := range rule.Names {
-				syscallMap[name] = true
+	return allowed
+}
+
+func TestDefaultSeccompFilter(t *testing.T) {
+	for _, arch := range []string{SeccompArchX86_64, SeccompArchAarch64} {
+		t.Run(arch, func(t *testing.T) {
+			profile, err := DefaultSeccompFilter(arch)
+			require.NoError(t, err)
+			require.NoError(t, profile.Validate(arch))
+
+			assert.Len(t, profile, 3)
+			for _, thread := range []string{SeccompThreadVMM, SeccompThreadAPI, SeccompThreadVCPU} {
+				filter := profile[thread]
+				require.NotNil(t, filter, thread)
+				assert.Equal(t, SeccompActTrap, filter.DefaultAction)
+				assert.Equal(t, SeccompActAllow, filter.FilterAction)
+
+				allowed := allowedSyscalls(filter)
+				for _, name := range []string{"read", "write", "futex", "exit"} {
+					assert.True(t, allowed[name], "%s should allow %s", thread, name)
+				}
+				for _, name := range []string{"execve", "clone", "mount", "ptrace", "init_module"} {
+					assert.False(t, allowed[name], "%s should not allow %s", thread, name)
+				}
+				assert.False(t, allowed["ioctl"], "%s ioctl must be restricted", thread)
 			}
-		}
-	}
 
-	for _, syscall := range allowedSyscalls {
-		assert.True(t, syscallMap[syscall], "Should allow %s syscall", syscall)
+			// Only x86_64 has the legacy open syscall
+			assert.Equal(t, arch == SeccompArchX86_64, allowedSyscalls(profile[SeccompThreadVMM])["open"])
+		})
 	}
-}
 
-func TestRestrictiveSeccompFilter(t *testing.T) {
-	filter := RestrictiveSeccompFilter()
+	_, err := DefaultSeccompFilter("riscv64")
+	assert.Error(t, err)
+}
 
-	assert.NotNil(t, filter)
-	assert.Equal(t, "SCMP_ACT_ERRNO", filter.DefaultAction)
+func TestDefaultSeccompFilter_Ioctl(t *testing.T) {
+	profile, err := DefaultSeccompFilter(SeccompArchX86_64)
+	require.NoError(t, err)
 
-	// Verify dangerous syscalls are blocked
-	blockedSyscalls := []string{"mount", "umount2", "chroot", "init_module"}
-	syscallMap := make(map[string]bool)
-	for _, rule := range filter.Syscalls {
-		if rule.Action == "SCMP_ACT_ALLOW" {
-			for _, name := range rule.Names {
-				syscallMap[name] = true
+	ioctlTypes := func(thread string) []uint64 {
+		var types []uint64
+		for _, rule := range profile[thread].Filter {
+			if rule.Syscall != "ioctl" {
+				continue
 			}
+			require.Len(t, rule.Args, 1)
+			assert.Equal(t, uint8(1), rule.Args[0].Index)
+			assert.Equal(t, ArgOpMaskedEq(0xff00), rule.Args[0].Op)
+			types = append(types, rule.Args[0].Val>>8)
 		}
+		return types
 	}
 
-	for _, syscall := range blockedSyscalls {
-		assert.False(t, syscallMap[syscall], "Should block %s syscall", syscall)
-	}
+	assert.ElementsMatch(t, []uint64{0xae, 0x54, 0xaa}, ioctlTypes(SeccompThreadVMM))
+	assert.ElementsMatch(t, []uint64{0x54}, ioctlTypes(SeccompThreadAPI))
+	assert.ElementsMatch(t, []uint64{0xae}, ioctlTypes(SeccompThreadVCPU))
 }
 
-func TestWriteSeccompProfile(t *testing.T) {
-	vmID := "test-vm-seccomp"
-	profilePath := filepath.Join(t.TempDir(), "seccomp.json")
+func TestSeccompFilter_JSON(t *testing.T) {
+	profile, err := DefaultSeccompFilter(SeccompArchAarch64)
+	require.NoError(t, err)
 
-	err := WriteSeccompProfile(vmID, profilePath)
-	assert.NoError(t, err)
+	data, err := json.Marshal(profile)
+	require.NoError(t, err)
 
-	// Verify file exists
-	assert.FileExists(t, profilePath)
+	// The seccompiler-bin input format
+	var raw map[string]map[string]interface{}
+	require.NoError(t, json.Unmarshal(data, &raw))
+	assert.Equal(t, "trap", raw["vcpu"]["default_action"])
+	assert.Equal(t, "allow", raw["vcpu"]["filter_action"])
+	assert.Contains(t, string(data), `"op":{"masked_eq":65280}`)
 
-	// Verify file is valid JSON
-	data, err := os.ReadFile(profilePath)
-	assert.NoError(t, err)
+	var restored SeccompProfile
+	require.NoError(t, json.Unmarshal(data, &restored))
+	assert.Equal(t, profile, restored)
 
+	// errno actions and plain ops
+	rule := `{"default_action":{"errno":1},"filter_action":"allow",` +
+		`"filter":[{"syscall":"socket","args":[{"index":0,"type":"dword","op":"eq","val":1}]}]}`
 	var filter SeccompFilter
-	err = json.Unmarshal(data, &filter)
-	assert.NoError(t, err)
-	assert.NotNil(t, filter)
+	require.NoError(t, json.Unmarshal([]byte(rule), &filter))
+	assert.Equal(t, SeccompActErrno(1), filter.DefaultAction)
+	assert.Equal(t, ArgOpEq, filter.Filter[0].Args[0].Op)
+
+	out, err := json.Marshal(filter)
+	require.NoError(t, err)
+	assert.JSONEq(t, rule, string(out))
+
+	assert.Error(t, json.Unmarshal([]byte(`{"kill":1}`), &filter.DefaultAction))
+	assert.Error(t, json.Unmarshal([]byte(`{"masked_eq":1,"eq":2}`), &filter.Filter[0].Args[0].Op))
 }
 
-func TestValidateSeccompProfile(t *testing.T) {
-	// Create a valid profile
-	vmID := "test-vm-validate"
-	profilePath := filepath.Join(t.TempDir(), "seccomp.json")
+func TestSeccompProfile_Validate(t *testing.T) {
+	filter := func() *SeccompFilter {
+		return &SeccompFilter{
+			DefaultAction: SeccompActTrap,
+			FilterAction:  SeccompActAllow,
+			Filter:        []SyscallRule{{Syscall: "read"}},
+		}
+	}
+	profile := func(edit func(*SeccompFilter)) SeccompProfile {
+		vcpu := filter()
+		if edit != nil {
+			edit(vcpu)
+		}
+		return SeccompProfile{
+			SeccompThreadVMM:  filter(),
+			SeccompThreadAPI:  filter(),
+			SeccompThreadVCPU: vcpu,
+		}
+	}
+	arg := func(a SyscallArg) func(*SeccompFilter) {
+		return func(f *SeccompFilter) {
+			f.Filter = []SyscallRule{{Syscall: "ioctl", Args: []SyscallArg{a}}}
+		}
+	}
+
+	tests := []struct {
+		name        string
+		profile     SeccompProfile
+		arch        string
+		errContains string
+	}{
+		{"valid", profile(nil), SeccompArchX86_64, ""},
+		{"valid args", profile(arg(SyscallArg{Index: 1, Type: "dword", Op: ArgOpMaskedEq(0xff00), Val: 0xae00})), SeccompArchAarch64, ""},
+		{"missing thread", SeccompProfile{SeccompThreadVMM: filter(), SeccompThreadAPI: filter()}, "", "missing filter"},
+		{"unknown thread", func() SeccompProfile { p := profile(nil); p["main"] = filter(); return p }(), "", "invalid thread category"},
+		{"invalid default action", profile(func(f *SeccompFilter) { f.DefaultAction = SeccompAction{Name: "deny"} }), "", "invalid default action"},
+		{"invalid filter action", profile(func(f *SeccompFilter) { f.FilterAction = SeccompAction{Name: "SCMP_ACT_ALLOW"} }), "", "invalid filter action"},
+		{"same actions", profile(func(f *SeccompFilter) { f.DefaultAction = SeccompActAllow }), "", "both allow"},
+		{"empty syscall", profile(func(f *SeccompFilter) { f.Filter = []SyscallRule{{}} }), "", "rule without a syscall"},
+		{"x86 syscall on aarch64", profile(func(f *SeccompFilter) { f.Filter = []SyscallRule{{Syscall: "open"}} }), SeccompArchAarch64, "does not exist"},
+		{"bad index", profile(arg(SyscallArg{Index: 6, Type: "dword", Op: ArgOpEq})), "", "invalid argument index"},
+		{"bad op", profile(arg(SyscallArg{Index: 1, Type: "dword", Op: ArgOp{Name: "between"}})), "", "invalid op"},
+		{"bad type", profile(arg(SyscallArg{Index: 1, Type: "byte", Op: ArgOpEq})), "", "invalid argument type"},
+		{"dword overflow", profile(arg(SyscallArg{Index: 1, Type: "dword", Op: ArgOpEq, Val: 1 << 32})), "", "does not fit"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.profile.Validate(tt.arch)
+			if tt.errContains == "" {
+				assert.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.errContains)
+		})
+	}
+}
 
-	err := WriteSeccompProfile(vmID, profilePath)
+func TestSeccompArch(t *testing.T) {
+	arch, err := SeccompArch("amd64")
 	require.NoError(t, err)
+	assert.Equal(t, SeccompArchX86_64, arch)
 
-	// Validate
-	err = ValidateSeccompProfile(profilePath)
-	assert.NoError(t, err)
+	arch, err = SeccompArch("arm64")
+	require.NoError(t, err)
+	assert.Equal(t, SeccompArchAarch64, arch)
 
-	// Test invalid profile
-	invalidPath := filepath.Join(t.TempDir(), "invalid.json")
-	err = os.WriteFile(invalidPath, []byte("{invalid json"), 0644)
+	arch, err = SeccompArch("aarch64")
 	require.NoError(t, err)
+	assert.Equal(t, SeccompArchAarch64, arch)
 
-	err = ValidateSeccompProfile(invalidPath)
+	_, err = SeccompArch("386")
 	assert.Error(t, err)
 }
 
-func TestValidateSeccompProfile_InvalidAction(t *testing.T) {
-	// Create profile with invalid action
-	filter := &SeccompFilter{
-		DefaultAction: "INVALID_ACTION",
-		Architectures: []string{"SCMP_ARCH_X86_64"},
-		Syscalls:      []SyscallRule{},
+func TestWriteSeccompProfile(t *testing.T) {
+	if _, err := SeccompArch(runtime.GOARCH); err != nil {
+		t.Skip("seccomp filters are not supported on this architecture")
 	}
 
-	data, err := json.Marshal(filter)
-	require.NoError(t, err)
+	profilePath := filepath.Join(t.TempDir(), "seccomp.json")
+	require.NoError(t, WriteSeccompProfile("test-vm-seccomp", profilePath))
 
-	profilePath := filepath.Join(t.TempDir(), "invalid-action.json")
-	err = os.WriteFile(profilePath, data, 0644)
+	data, err := os.ReadFile(profilePath)
 	require.NoError(t, err)
 
-	err = ValidateSeccompProfile(profilePath)
-	assert.Error(t, err)
-	assert.Contains(t, err.Error(), "invalid default action")
+	var profile SeccompProfile
+	require.NoError(t, json.Unmarshal(data, &profile))
+	assert.Len(t, profile, 3)
 }
 
-func TestValidateSeccompProfile_InvalidArchitecture(t *testing.T) {
-	// Create profile with invalid architecture
-	filter := &SeccompFilter{
-		DefaultAction: "SCMP_ACT_ALLOW",
-		Architectures: []string{"INVALID_ARCH"},
-		Syscalls:      []SyscallRule{},
+func TestValidateSeccompProfile(t *testing.T) {
+	if _, err := SeccompArch(runtime.GOARCH); err != nil {
+		t.Skip("seccomp filters are not supported on this architecture")
 	}
 
-	data, err := json.Marshal(filter)
+	profilePath := filepath.Join(t.TempDir(), "seccomp.json")
+	require.NoError(t, WriteSeccompProfile("test-vm-validate", profilePath))
+	assert.NoError(t, ValidateSeccompProfile(profilePath))
+
+	invalidPath := filepath.Join(t.TempDir(), "invalid.json")
+	require.NoError(t, os.WriteFile(invalidPath, []byte("{invalid json"), 0644))
+	assert.Error(t, ValidateSeccompProfile(invalidPath))
+
+	// A Docker-style profile is not a Firecracker filter
+	dockerPath := filepath.Join(t.TempDir(), "docker.json")
+	require.NoError(t, os.WriteFile(dockerPath, []byte(`{"defaultAction":"SCMP_ACT_ERRNO","syscalls":[]}`), 0644))
+	assert.Error(t, ValidateSeccompProfile(dockerPath))
+
+	assert.Error(t, ValidateSeccompProfile(filepath.Join(t.TempDir(), "missing.json")))
+}
+
+func TestPrepareSeccompFilter(t *testing.T) {
+	if _, err := SeccompArch(runtime.GOARCH); err != nil {
+		t.Skip("seccomp filters are not supported on this architecture")
+	}
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	path, err := PrepareSeccompFilter(ctx, "", dir)
 	require.NoError(t, err)
+	assert.Empty(t, path, "Firecracker's built-in filters")
 
-	profilePath := filepath.Join(t.TempDir(), "invalid-arch.json")
-	err = os.WriteFile(profilePath, data, 0644)
+	bpfPath := filepath.Join(dir, "custom.bpf")
+	require.NoError(t, os.WriteFile(bpfPath, []byte{0}, 0644))
+	path, err = PrepareSeccompFilter(ctx, bpfPath, dir)
 	require.NoError(t, err)
+	assert.Equal(t, bpfPath, path, "compiled filters are used as is")
+
+	_, err = PrepareSeccompFilter(ctx, filepath.Join(dir, "missing.bpf"), dir)
+	assert.Error(t, err)
 
-	err = ValidateSeccompProfile(profilePath)
+	invalidPath := filepath.Join(dir, "invalid.json")
+	require.NoError(t, os.WriteFile(invalidPath, []byte(`{"vmm":{}}`), 0644))
+	_, err = PrepareSeccompFilter(ctx, invalidPath, dir)
 	assert.Error(t, err)
-	assert.Contains(t, err.Error(), "invalid architecture")
+
+	// Compiling needs seccompiler-bin; a fake one records its arguments
+	binDir := t.TempDir()
+	argsFile := filepath.Join(binDir, "args")
+	script := "#!/bin/sh\necho \"$@\" > " + argsFile + "\n"
+	require.NoError(t, os.WriteFile(filepath.Join(binDir, SeccompCompilerBinary), []byte(script), 0755))
+	t.Setenv("PATH", binDir)
+
+	path, err = PrepareSeccompFilter(ctx, "default", dir)
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "seccomp.bpf"), path)
+	assert.NoError(t, ValidateSeccompProfile(filepath.Join(dir, "seccomp.json")))
+
+	args, err := os.ReadFile(argsFile)
+	require.NoError(t, err)
+	arch, _ := SeccompArch(runtime.GOARCH)
+	assert.Contains(t, string(args), "--target-arch "+arch)
+	assert.Contains(t, string(args), "--output-file "+path)
 }
 
-func TestSeccompFilter_JSONRoundtrip(t *testing.T) {
-	// Create filter, marshal, unmarshal
-	original := DefaultSeccompFilter()
+func TestCompileSeccompFilter_Errors(t *testing.T) {
+	t.Setenv("PATH", t.TempDir())
+	err := CompileSeccompFilter(context.Background(), "in.json", SeccompArchX86_64, "out.bpf", false)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "not found")
+
+	binDir := t.TempDir()
+	script := "#!/bin/sh\necho 'unknown syscall' >&2\nexit 1\n"
+	require.NoError(t, os.WriteFile(filepath.Join(binDir, SeccompCompilerBinary), []byte(script), 0755))
+	t.Setenv("PATH", binDir)
+	err = CompileSeccompFilter(context.Background(), "in.json", SeccompArchX86_64, "out.bpf", true)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "unknown syscall")
+}
 
-	data, err := json.Marshal(original)
-	assert.NoError(t, err)
+func TestUnfilteredThreads(t *testing.T) {
+	oldProcDir := procDir
+	procDir = t.TempDir()
+	defer func() { procDir = oldProcDir }()
 
-	var restored SeccompFilter
-	err = json.Unmarshal(data, &restored)
-	assert.NoError(t, err)
+	writeStatus := func(tid, name, mode string) {
+		dir := filepath.Join(procDir, "42", "task", tid)
+		require.NoError(t, os.MkdirAll(dir, 0755))
+		status := "Name:\t" + name + "\nState:\tS (sleeping)\nSeccomp:\t" + mode + "\n"
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "status"), []byte(status), 0644))
+	}
+	writeStatus("42", "firecracker", "2")
+	writeStatus("43", "fc_api", "2")
+	writeStatus("44", "fc_vcpu 0", "0")
 
-	// Verify key fields match
-	assert.Equal(t, original.DefaultAction, restored.DefaultAction)
-	assert.Equal(t, len(original.Architectures), len(restored.Architectures))
-	assert.Equal(t, len(original.Syscalls), len(restored.Syscalls))
+	threads, err := UnfilteredThreads(42)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"fc_vcpu 0"}, threads)
+
+	_, err = UnfilteredThreads(7)
+	assert.Error(t, err)
 }
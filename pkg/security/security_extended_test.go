@@ -489,9 +489,9 @@ func TestValidateSeccompProfile_Extended(t *testing.T) {
 	t.Run("invalid default action", func(t *testing.T) {
 		tempFile := filepath.Join(t.TempDir(), "invalid-action.json")
 		invalidProfile := `{
-			"defaultAction": "INVALID_ACTION",
-			"architectures": ["SCMP_ARCH_X86_64"],
-			"syscalls": []
+			"vmm": {"default_action": "INVALID_ACTION", "filter_action": "allow", "filter": []},
+			"api": {"default_action": "trap", "filter_action": "allow", "filter": []},
+			"vcpu": {"default_action": "trap", "filter_action": "allow", "filter": []}
 		}`
 		if err := os.WriteFile(tempFile, []byte(invalidProfile), 0644); err != nil {
 			t.Fatalf("Failed to create temp file: %v", err)
@@ -503,12 +503,14 @@ func TestValidateSeccompProfile_Extended(t *testing.T) {
 		}
 	})
 
-	t.Run("invalid architecture", func(t *testing.T) {
-		tempFile := filepath.Join(t.TempDir(), "invalid-arch.json")
+	t.Run("invalid argument type", func(t *testing.T) {
+		tempFile := filepath.Join(t.TempDir(), "invalid-arg.json")
 		invalidProfile := `{
-			"defaultAction": "SCMP_ACT_ALLOW",
-			"architectures": ["INVALID_ARCH"],
-			"syscalls": []
+			"vmm": {"default_action": "trap", "filter_action": "allow", "filter": [
+				{"syscall": "ioctl", "args": [{"index": 1, "type": "byte", "op": "eq", "val": 1}]}
+			]},
+			"api": {"default_action": "trap", "filter_action": "allow", "filter": []},
+			"vcpu": {"default_action": "trap", "filter_action": "allow", "filter": []}
 		}`
 		if err := os.WriteFile(tempFile, []byte(invalidProfile), 0644); err != nil {
 			t.Fatalf("Failed to create temp file: %v", err)
@@ -516,100 +518,49 @@ func TestValidateSeccompProfile_Extended(t *testing.T) {
 
 		err := ValidateSeccompProfile(tempFile)
 		if err == nil {
-			t.Error("ValidateSeccompProfile should fail for invalid architecture")
+			t.Error("ValidateSeccompProfile should fail for invalid argument type")
 		}
 	})
 }
 
 // TestDefaultSeccompFilter_Extended tests default seccomp filter creation
 func TestDefaultSeccompFilter_Extended(t *testing.T) {
-	filter := DefaultSeccompFilter()
-
-	if filter == nil {
-		t.Fatal("DefaultSeccompFilter returned nil")
-	}
-
-	// Check default action
-	if filter.DefaultAction != "SCMP_ACT_ERRNO" {
-		t.Errorf("DefaultAction should be SCMP_ACT_ERRNO, got: %s", filter.DefaultAction)
-	}
-
-	// Check architectures are present
-	if len(filter.Architectures) == 0 {
-		t.Error("Architectures should not be empty")
+	profile, err := DefaultSeccompFilter(SeccompArchX86_64)
+	if err != nil {
+		t.Fatalf("DefaultSeccompFilter failed: %v", err)
 	}
 
-	validArchs := map[string]bool{
-		"SCMP_ARCH_X86_64":  true,
-		"SCMP_ARCH_X86":     true,
-		"SCMP_ARCH_ARM":     true,
-		"SCMP_ARCH_AARCH64": true,
-	}
-	for _, arch := range filter.Architectures {
-		if !validArchs[arch] {
-			t.Errorf("Invalid architecture: %s", arch)
+	// Every Firecracker thread category has a filter
+	for _, thread := range []string{SeccompThreadVMM, SeccompThreadAPI, SeccompThreadVCPU} {
+		filter := profile[thread]
+		if filter == nil {
+			t.Fatalf("Missing filter for %s threads", thread)
 		}
-	}
-
-	// Check syscalls are present
-	if len(filter.Syscalls) == 0 {
-		t.Error("Syscalls should not be empty")
-	}
 
-	// Verify at least some common syscalls are allowed
-	syscallMap := make(map[string]bool)
-	for _, rule := range filter.Syscalls {
-		if rule.Action == "SCMP_ACT_ALLOW" {
-			for _, name := range rule.Names {
-				syscallMap[name] = true
-			}
+		if filter.DefaultAction != SeccompActTrap {
+			t.Errorf("%s DefaultAction should be trap, got: %s", thread, filter.DefaultAction)
 		}
-	}
-
-	// Check for essential syscalls
-	essentialSyscalls := []string{"read", "write", "open", "close", "exit"}
-	for _, syscallName := range essentialSyscalls {
-		if !syscallMap[syscallName] {
-			t.Errorf("Essential syscall %s not found in allowed list", syscallName)
+		if filter.FilterAction != SeccompActAllow {
+			t.Errorf("%s FilterAction should be allow, got: %s", thread, filter.FilterAction)
 		}
-	}
-}
-
-// TestRestrictiveSeccompFilter_Extended tests restrictive seccomp filter
-func TestRestrictiveSeccompFilter_Extended(t *testing.T) {
-	filter := RestrictiveSeccompFilter()
-
-	if filter == nil {
-		t.Fatal("RestrictiveSeccompFilter returned nil")
-	}
 
-	// Verify dangerous syscalls are blocked
-	dangerousSyscalls := []string{
-		"mount", "umount2", "pivot_root", "chroot",
-		"init_module", "delete_module", "kexec_load",
-		"swapon", "swapoff", "reboot",
-	}
-
-	syscallMap := make(map[string]bool)
-	for _, rule := range filter.Syscalls {
-		if rule.Action == "SCMP_ACT_ALLOW" {
-			for _, name := range rule.Names {
-				syscallMap[name] = true
-			}
+		syscallMap := make(map[string]bool)
+		for _, rule := range filter.Filter {
+			syscallMap[rule.Syscall] = true
 		}
-	}
 
-	for _, syscallName := range dangerousSyscalls {
-		if syscallMap[syscallName] {
-			t.Errorf("Dangerous syscall %s should be blocked in restrictive filter", syscallName)
+		// Check for essential syscalls
+		for _, syscallName := range []string{"read", "write", "close", "exit"} {
+			if !syscallMap[syscallName] {
+				t.Errorf("Essential syscall %s not allowed for %s threads", syscallName, thread)
+			}
 		}
-	}
 
-	// Verify essential syscalls are still allowed
-	essentialSyscalls := []string{"read", "write", "open", "close"}
-	for _, syscallName := range essentialSyscalls {
-		if !syscallMap[syscallName] {
-			t.Errorf("Essential syscall %s should be allowed even in restrictive filter", syscallName)
+		// Verify dangerous syscalls are blocked
+		for _, syscallName := range []string{"mount", "umount2", "pivot_root", "chroot", "init_module", "kexec_load", "reboot", "execve"} {
+			if syscallMap[syscallName] {
+				t.Errorf("Dangerous syscall %s should be blocked for %s threads", syscallName, thread)
+			}
 		}
 	}
 }
@@ -772,34 +723,32 @@ func TestResourceLimits(t *testing.T) {
 func TestSeccompFilterStructures(t *testing.T) {
 	t.Run("create SeccompFilter", func(t *testing.T) {
 		filter := &SeccompFilter{
-			DefaultAction: "SCMP_ACT_ALLOW",
-			Architectures: []string{"SCMP_ARCH_X86_64"},
-			Syscalls: []SyscallRule{
-				{
-					Names:  []string{"read", "write"},
-					Action: "SCMP_ACT_ALLOW",
-				},
+			DefaultAction: SeccompActTrap,
+			FilterAction:  SeccompActAllow,
+			Filter: []SyscallRule{
+				{Syscall: "read"},
+				{Syscall: "write"},
 			},
 		}
 
-		if filter.DefaultAction != "SCMP_ACT_ALLOW" {
+		if filter.DefaultAction != SeccompActTrap {
 			t.Errorf("DefaultAction mismatch")
 		}
 
-		if len(filter.Syscalls) != 1 {
-			t.Errorf("Should have 1 syscall rule")
+		if len(filter.Filter) != 2 {
+			t.Errorf("Should have 2 syscall rules")
 		}
 	})
 
 	t.Run("create SyscallRule with args", func(t *testing.T) {
 		rule := SyscallRule{
-			Names:  []string{"ioctl"},
-			Action: "SCMP_ACT_ERRNO",
-			Args: []Arg{
+			Syscall: "ioctl",
+			Args: []SyscallArg{
 				{
 					Index: 1,
-					Value: 0x5401,
-					Op:    "SCMP_CMP_EQ",
+					Type:  "dword",
+					Op:    ArgOpEq,
+					Val:   0x5401,
 				},
 			},
 		}
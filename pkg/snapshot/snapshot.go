@@ -26,6 +26,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/restuhaqza/swarmcracker/pkg/events"
 	"github.com/rs/zerolog/log"
 )
 
@@ -136,6 +137,28 @@ type Manager struct {
 	config            SnapshotConfig
 	mu                sync.Mutex
 	restoredProcesses map[string]*os.Process // taskID -> process for restored VMs
+	events            events.Publisher       // nil disables events
+}
+
+// SetEventPublisher makes the manager publish snapshot create and restore
+// events to p.
+func (m *Manager) SetEventPublisher(p events.Publisher) {
+	m.events = p
+}
+
+// publish sends a snapshot event if events are enabled.
+func (m *Manager) publish(typ events.Type, info *SnapshotInfo, taskID, serviceID, message string, err error) {
+	if m.events == nil {
+		return
+	}
+	e := events.Event{Type: typ, TaskID: taskID, ServiceID: serviceID, Message: message}
+	if info != nil {
+		e.Attributes = map[string]string{"snapshot_id": info.ID}
+	}
+	if err != nil {
+		e.Error = err.Error()
+	}
+	m.events.Publish(e)
 }
 
 // TrackRestoredProcess registers a restored VM process for lifecycle tracking.
@@ -185,6 +208,20 @@ func (m *Manager) CreateSnapshot(
 	ctx context.Context,
 	taskID, socketPath string,
 	opts CreateOptions,
+) (*SnapshotInfo, error) {
+	info, err := m.createSnapshot(ctx, taskID, socketPath, opts)
+	if err != nil {
+		m.publish(events.SnapshotCreate, nil, taskID, opts.ServiceID, "Snapshot failed", err)
+	} else {
+		m.publish(events.SnapshotCreate, info, taskID, opts.ServiceID, "Snapshot created", nil)
+	}
+	return info, err
+}
+
+func (m *Manager) createSnapshot(
+	ctx context.Context,
+	taskID, socketPath string,
+	opts CreateOptions,
 ) (*SnapshotInfo, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
@@ -301,6 +338,23 @@ func (m *Manager) RestoreFromSnapshot(
 	ctx context.Context,
 	info *SnapshotInfo,
 	socketPath string,
+) error {
+	err := m.restoreFromSnapshot(ctx, info, socketPath)
+	if info == nil {
+		return err
+	}
+	if err != nil {
+		m.publish(events.SnapshotRestore, info, info.TaskID, info.ServiceID, "Snapshot restore failed", err)
+	} else {
+		m.publish(events.SnapshotRestore, info, info.TaskID, info.ServiceID, "VM restored from snapshot", nil)
+	}
+	return err
+}
+
+func (m *Manager) restoreFromSnapshot(
+	ctx context.Context,
+	info *SnapshotInfo,
+	socketPath string,
 ) error {
 	if info == nil {
 		return fmt.Errorf("snapshot info is required")
@@ -9,6 +9,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/restuhaqza/swarmcracker/pkg/events"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -539,3 +540,32 @@ func createTestSnapshot(t *testing.T, baseDir string, info *SnapshotInfo) {
 		require.NoError(t, os.WriteFile(filepath.Join(snapshotDir, "vm.mem"), make([]byte, info.SizeBytes/2), 0644))
 	}
 }
+
+type recordingPublisher struct {
+	events []events.Event
+}
+
+func (r *recordingPublisher) Publish(e events.Event) {
+	r.events = append(r.events, e)
+}
+
+func TestSnapshotEvents(t *testing.T) {
+	mgr, err := NewManager(SnapshotConfig{SnapshotDir: t.TempDir()})
+	require.NoError(t, err)
+	rec := &recordingPublisher{}
+	mgr.SetEventPublisher(rec)
+
+	_, err = mgr.CreateSnapshot(context.Background(), "task-1", "/nonexistent.sock", CreateOptions{ServiceID: "svc-1"})
+	require.Error(t, err)
+
+	info := &SnapshotInfo{ID: "snap-1", TaskID: "task-1", StatePath: "/nonexistent/vm.state"}
+	require.Error(t, mgr.RestoreFromSnapshot(context.Background(), info, "/tmp/restore.sock"))
+	require.Error(t, mgr.RestoreFromSnapshot(context.Background(), nil, "/tmp/restore.sock"))
+
+	require.Len(t, rec.events, 2)
+	assert.Equal(t, events.SnapshotCreate, rec.events[0].Type)
+	assert.Equal(t, "svc-1", rec.events[0].ServiceID)
+	assert.Contains(t, rec.events[0].Error, "socket not found")
+	assert.Equal(t, events.SnapshotRestore, rec.events[1].Type)
+	assert.Equal(t, "snap-1", rec.events[1].Attributes["snapshot_id"])
+}
@@ -0,0 +1,32 @@
+package statefile
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "network", "state.json")
+
+	require.NoError(t, Write(path, []byte(`{"a":1}`), 0640))
+	require.NoError(t, Write(path, []byte(`{"a":2}`), 0640))
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, `{"a":2}`, string(data))
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0640), info.Mode().Perm())
+	assert.NoFileExists(t, path+".tmp")
+}
+
+func TestWrite_Error(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "file")
+	require.NoError(t, os.WriteFile(file, nil, 0640))
+
+	assert.ErrorContains(t, Write(filepath.Join(file, "state.json"), nil, 0640), "failed to create state directory")
+}
@@ -4,9 +4,9 @@ package storage
 
 import (
 	"context"
+	"errors"
 	"io"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"testing"
 
@@ -15,32 +15,16 @@ import (
 	"github.com/stretchr/testify/require"
 )
 
-// TestInjectSecrets_DebugfsFail tests InjectSecrets when debugfs command fails
-// Note: debugfs exits with code 0 even for errors like missing ext4 file,
-// so we mock execCommand to simulate actual failure
-func TestInjectSecrets_DebugfsFail(t *testing.T) {
-	origCommand := execCommand
-	origMkdirTemp := osMkdirTemp
-	origRemoveAll := osRemoveAllStore
+// TestInjectSecrets_WriteFail tests InjectSecrets when writing into the image fails
+func TestInjectSecrets_WriteFail(t *testing.T) {
+	origWriteFile := ext4WriteFile
 	defer func() {
-		execCommand = origCommand
-		osMkdirTemp = origMkdirTemp
-		osRemoveAllStore = origRemoveAll
+		ext4WriteFile = origWriteFile
 	}()
 
-	// Create temp dir for test
-	tmpDir := t.TempDir()
-	osMkdirTemp = func(dir string, pattern string) (string, error) {
-		return tmpDir, nil
-	}
-	osRemoveAllStore = func(path string) error { return nil }
-
-	// Mock execCommand to fail for debugfs
-	execCommand = func(name string, args ...string) *exec.Cmd {
-		if name == "debugfs" {
-			return exec.Command("false") // Will fail with exit code 1
-		}
-		return exec.Command(name, args...)
+	// Mock the image write to fail
+	ext4WriteFile = func(_, _ string, _ []byte, _ os.FileMode, _, _ int) error {
+		return errors.New("no space left in image")
 	}
 
 	sm := NewSecretManager("", "")
@@ -50,34 +34,23 @@ func TestInjectSecrets_DebugfsFail(t *testing.T) {
 		{Name: "secret1", Target: "/run/secrets/s1", Data: []byte("data")},
 	}
 
-	err := sm.InjectSecrets(ctx, "task-123", secrets, "/nonexistent/rootfs.ext4")
-	assert.Error(t, err, "InjectSecrets should fail when debugfs fails")
-	assert.Contains(t, err.Error(), "debugfs")
+	err := sm.InjectSecrets(ctx, "task-123", secrets, "/tmp/rootfs.ext4")
+	assert.Error(t, err, "InjectSecrets should fail when the image write fails")
+	assert.Contains(t, err.Error(), "no space left in image")
 }
 
-// TestInjectSecrets_DebugfsSuccess tests InjectSecrets with single secret using mock
-func TestInjectSecrets_DebugfsSuccess(t *testing.T) {
-	origCommand := execCommand
-	origMkdirTemp := osMkdirTemp
-	origRemoveAll := osRemoveAllStore
+// TestInjectSecrets_WriteSuccess tests InjectSecrets with single secret using mock
+func TestInjectSecrets_WriteSuccess(t *testing.T) {
+	origWriteFile := ext4WriteFile
 	defer func() {
-		execCommand = origCommand
-		osMkdirTemp = origMkdirTemp
-		osRemoveAllStore = origRemoveAll
+		ext4WriteFile = origWriteFile
 	}()
 
-	tmpDir := t.TempDir()
-	osMkdirTemp = func(dir string, pattern string) (string, error) {
-		return tmpDir, nil
-	}
-	osRemoveAllStore = func(path string) error { return nil }
-
-	// Mock execCommand to succeed for debugfs
-	execCommand = func(name string, args ...string) *exec.Cmd {
-		if name == "debugfs" {
-			return exec.Command("echo", "Allocated inode")
-		}
-		return exec.Command(name, args...)
+	var gotTarget string
+	var gotMode os.FileMode
+	ext4WriteFile = func(_, name string, _ []byte, perm os.FileMode, _, _ int) error {
+		gotTarget, gotMode = name, perm
+		return nil
 	}
 
 	sm := NewSecretManager("", "")
@@ -87,32 +60,23 @@ func TestInjectSecrets_DebugfsSuccess(t *testing.T) {
 	}
 
 	err := sm.InjectSecrets(ctx, "task-success", secrets, "/tmp/rootfs.ext4")
-	assert.NoError(t, err, "InjectSecrets should succeed with mock debugfs")
+	assert.NoError(t, err, "InjectSecrets should succeed with mock image write")
+	assert.Equal(t, "/secrets/s1", gotTarget)
+	assert.Equal(t, os.FileMode(0400), gotMode)
 }
 
-// TestInjectConfigs_DebugfsSuccess tests InjectConfigs with single config using mock
-func TestInjectConfigs_DebugfsSuccess(t *testing.T) {
-	origCommand := execCommand
-	origMkdirTemp := osMkdirTemp
-	origRemoveAll := osRemoveAllStore
+// TestInjectConfigs_WriteSuccess tests InjectConfigs with single config using mock
+func TestInjectConfigs_WriteSuccess(t *testing.T) {
+	origWriteFile := ext4WriteFile
 	defer func() {
-		execCommand = origCommand
-		osMkdirTemp = origMkdirTemp
-		osRemoveAllStore = origRemoveAll
+		ext4WriteFile = origWriteFile
 	}()
 
-	tmpDir := t.TempDir()
-	osMkdirTemp = func(dir string, pattern string) (string, error) {
-		return tmpDir, nil
-	}
-	osRemoveAllStore = func(path string) error { return nil }
-
-	// Mock execCommand to succeed for debugfs
-	execCommand = func(name string, args ...string) *exec.Cmd {
-		if name == "debugfs" {
-			return exec.Command("echo", "Allocated inode")
-		}
-		return exec.Command(name, args...)
+	var gotTarget string
+	var gotMode os.FileMode
+	ext4WriteFile = func(_, name string, _ []byte, perm os.FileMode, _, _ int) error {
+		gotTarget, gotMode = name, perm
+		return nil
 	}
 
 	sm := NewSecretManager("", "")
@@ -122,32 +86,56 @@ func TestInjectConfigs_DebugfsSuccess(t *testing.T) {
 	}
 
 	err := sm.InjectConfigs(ctx, "task-success", configs, "/tmp/rootfs.ext4")
-	assert.NoError(t, err, "InjectConfigs should succeed with mock debugfs")
+	assert.NoError(t, err, "InjectConfigs should succeed with mock image write")
+	assert.Equal(t, "/config/c1", gotTarget)
+	assert.Equal(t, os.FileMode(0444), gotMode)
 }
 
-// TestInjectConfigs_DebugfsFail tests InjectConfigs when debugfs fails
-func TestInjectConfigs_DebugfsFail(t *testing.T) {
-	origCommand := execCommand
-	origMkdirTemp := osMkdirTemp
-	origRemoveAll := osRemoveAllStore
+// TestInjectSecrets_Ownership tests that a secret's uid, gid and mode reach the image
+func TestInjectSecrets_Ownership(t *testing.T) {
+	origWriteFile := ext4WriteFile
 	defer func() {
-		execCommand = origCommand
-		osMkdirTemp = origMkdirTemp
-		osRemoveAllStore = origRemoveAll
+		ext4WriteFile = origWriteFile
 	}()
 
-	tmpDir := t.TempDir()
-	osMkdirTemp = func(dir string, pattern string) (string, error) {
-		return tmpDir, nil
+	var gotMode os.FileMode
+	var gotUID, gotGID int
+	ext4WriteFile = func(_, _ string, _ []byte, perm os.FileMode, uid, gid int) error {
+		gotMode, gotUID, gotGID = perm, uid, gid
+		return nil
+	}
+
+	sm := NewSecretManager("", "")
+	secrets := []types.SecretRef{
+		{Name: "db", Target: "/run/secrets/db", UID: "70", GID: "70", Mode: 0440, Data: []byte("pw")},
 	}
-	osRemoveAllStore = func(path string) error { return nil }
-
-	// Mock execCommand to fail for debugfs
-	execCommand = func(name string, args ...string) *exec.Cmd {
-		if name == "debugfs" {
-			return exec.Command("false")
-		}
-		return exec.Command(name, args...)
+	require.NoError(t, sm.InjectSecrets(context.Background(), "task-1", secrets, "/tmp/rootfs.ext4"))
+	assert.Equal(t, os.FileMode(0440), gotMode)
+	assert.Equal(t, 70, gotUID)
+	assert.Equal(t, 70, gotGID)
+
+	configs := []types.ConfigRef{
+		{Name: "app", Target: "/etc/app.yaml", GID: "1000", Data: []byte("a: 1")},
+	}
+	require.NoError(t, sm.InjectConfigs(context.Background(), "task-1", configs, "/tmp/rootfs.ext4"))
+	assert.Equal(t, os.FileMode(0444), gotMode)
+	assert.Equal(t, 0, gotUID)
+	assert.Equal(t, 1000, gotGID)
+
+	secrets[0].UID = "postgres"
+	err := sm.InjectSecrets(context.Background(), "task-1", secrets, "/tmp/rootfs.ext4")
+	assert.ErrorContains(t, err, "not a numeric ID")
+}
+
+// TestInjectConfigs_WriteFail tests InjectConfigs when writing into the image fails
+func TestInjectConfigs_WriteFail(t *testing.T) {
+	origWriteFile := ext4WriteFile
+	defer func() {
+		ext4WriteFile = origWriteFile
+	}()
+
+	ext4WriteFile = func(_, _ string, _ []byte, _ os.FileMode, _, _ int) error {
+		return errors.New("no space left in image")
 	}
 
 	sm := NewSecretManager("", "")
@@ -156,9 +144,9 @@ func TestInjectConfigs_DebugfsFail(t *testing.T) {
 		{Name: "config1", Target: "/config/c1", Data: []byte("data")},
 	}
 
-	err := sm.InjectConfigs(ctx, "task-123", configs, "/nonexistent/rootfs.ext4")
-	assert.Error(t, err, "InjectConfigs should fail when debugfs fails")
-	assert.Contains(t, err.Error(), "debugfs")
+	err := sm.InjectConfigs(ctx, "task-123", configs, "/tmp/rootfs.ext4")
+	assert.Error(t, err, "InjectConfigs should fail when the image write fails")
+	assert.Contains(t, err.Error(), "rootfs image")
 }
 
 // TestMountRootfs_DeprecatedStub tests mountRootfs deprecated stub behavior
@@ -166,7 +154,7 @@ func TestMountRootfs_DeprecatedStub(t *testing.T) {
 	sm := NewSecretManager("", "")
 
 	// mountRootfs is now a deprecated stub that just creates a temp dir
-	// (replaced by injectFileViaDebugfs for CVR-1.6 fix)
+	// (replaced by injectFile for CVR-1.6 fix)
 	tmpFile := filepath.Join(t.TempDir(), "not-ext4.img")
 	require.NoError(t, os.WriteFile(tmpFile, []byte("not an ext4 image"), 0644))
 
@@ -988,58 +976,6 @@ func TestBlockDriver_Export_NonExistent(t *testing.T) {
 	assert.Error(t, err, "Export should fail for non-existent volume")
 }
 
-// TestClearDirectory_CoverageExtra tests clearDirectory function
-func TestClearDirectory_CoverageExtra(t *testing.T) {
-	tmpDir := t.TempDir()
-
-	// Create some files
-	require.NoError(t, os.WriteFile(filepath.Join(tmpDir, "file1.txt"), []byte("data1"), 0644))
-	require.NoError(t, os.WriteFile(filepath.Join(tmpDir, "file2.txt"), []byte("data2"), 0644))
-	require.NoError(t, os.Mkdir(filepath.Join(tmpDir, "subdir"), 0755))
-
-	err := clearDirectory(tmpDir)
-	assert.NoError(t, err, "clearDirectory should succeed")
-
-	// Verify directory is empty
-	entries, err := os.ReadDir(tmpDir)
-	require.NoError(t, err)
-	assert.Empty(t, entries, "Directory should be empty after clear")
-}
-
-// TestClearDirectory_NonExistent_CoverageExtra tests clearDirectory with non-existent directory
-func TestClearDirectory_NonExistent_CoverageExtra(t *testing.T) {
-	err := clearDirectory("/nonexistent/directory")
-	assert.Error(t, err, "clearDirectory should fail for non-existent directory")
-}
-
-// TestCreateSparseFile_CoverageExtra tests createSparseFile function
-func TestCreateSparseFile_CoverageExtra(t *testing.T) {
-	tmpFile := filepath.Join(t.TempDir(), "sparse.img")
-
-	err := createSparseFile(tmpFile, 1024*1024) // 1 MB
-	assert.NoError(t, err, "createSparseFile should succeed")
-
-	// Verify file exists and has correct size
-	info, err := os.Stat(tmpFile)
-	require.NoError(t, err)
-	assert.Equal(t, int64(1024*1024), info.Size())
-}
-
-// TestCreateSparseFile_InvalidPath_CoverageExtra tests createSparseFile with invalid path
-func TestCreateSparseFile_InvalidPath_CoverageExtra(t *testing.T) {
-	if os.Getuid() == 0 {
-		t.Skip("Skipping: running as root can create files anywhere")
-	}
-
-	// Create a read-only parent
-	tmpDir := t.TempDir()
-	readOnlyParent := filepath.Join(tmpDir, "readonly")
-	require.NoError(t, os.Mkdir(readOnlyParent, 0555))
-
-	err := createSparseFile(filepath.Join(readOnlyParent, "sparse.img"), 1024)
-	assert.Error(t, err, "createSparseFile should fail in read-only directory")
-}
-
 // TestMetaStore_Write tests MetaStore Write
 func TestMetaStore_Write(t *testing.T) {
 	meta, err := NewMetaStore(t.TempDir())
@@ -10,7 +10,6 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
-	"strings"
 	"testing"
 
 	"github.com/restuhaqza/swarmcracker/pkg/types"
@@ -32,60 +31,42 @@ func (m *mockCmd) Run() error {
 	return m.err
 }
 
-// TestInjectSecrets_MockMount tests InjectSecrets with mocked mount/unmount
+// mockImageWrite replaces the ext4 image write with one that writes the
+// file under dir instead.
+func mockImageWrite(t *testing.T, dir string) {
+	t.Helper()
+	ext4WriteFile = func(_, name string, data []byte, perm os.FileMode, _, _ int) error {
+		dst := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+			return err
+		}
+		return os.WriteFile(dst, data, perm)
+	}
+}
+
+// TestInjectSecrets_MockMount tests InjectSecrets with a mocked image write
 func TestInjectSecrets_MockMount(t *testing.T) {
-	origMkdirTemp := osMkdirTemp
-	origCommand := execCommand
-	origRemoveAll := osRemoveAllStore
+	origWriteFile := ext4WriteFile
 	defer func() {
-		osMkdirTemp = origMkdirTemp
-		execCommand = origCommand
-		osRemoveAllStore = origRemoveAll
+		ext4WriteFile = origWriteFile
 	}()
 
-	t.Run("debugfs_fails", func(t *testing.T) {
-		tmpDir := t.TempDir()
-		osMkdirTemp = func(_ string, _ string) (string, error) {
-			return tmpDir, nil
-		}
-		execCommand = func(_ string, _ ...string) *exec.Cmd {
-			// Return a cmd that will fail when CombinedOutput is called
-			return exec.Command("false")
+	t.Run("write_fails", func(t *testing.T) {
+		ext4WriteFile = func(_, _ string, _ []byte, _ os.FileMode, _, _ int) error {
+			return errors.New("bad superblock magic")
 		}
-		osRemoveAllStore = func(_ string) error { return nil }
 
 		sm := NewSecretManager("", "")
 		secrets := []types.SecretRef{{Name: "s1", Data: []byte("data")}}
 
 		err := sm.InjectSecrets(context.Background(), "task-1", secrets, "/tmp/rootfs.ext4")
 		assert.Error(t, err)
-		assert.Contains(t, err.Error(), "debugfs")
+		assert.Contains(t, err.Error(), "rootfs image")
 	})
 
 	t.Run("full_injection_success", func(t *testing.T) {
 		tmpDir := t.TempDir()
-
-		osMkdirTemp = func(_ string, _ string) (string, error) {
-			return tmpDir, nil
-		}
-		// Mock debugfs to write file to the expected target location
-		execCommand = func(name string, args ...string) *exec.Cmd {
-			if name == "debugfs" && len(args) >= 3 {
-				// args: ["-w", "-R", "write <src> <target>", "<ext4>"]
-				parts := strings.Fields(args[2])
-				if len(parts) >= 3 {
-					srcFile := parts[1]
-					dstFile := filepath.Join(tmpDir, parts[2])
-					if data, err := os.ReadFile(srcFile); err == nil {
-						os.MkdirAll(filepath.Dir(dstFile), 0755)
-						os.WriteFile(dstFile, data, 0600)
-					}
-				}
-				return exec.Command("echo", "File created")
-			}
-			return exec.Command(name, args...)
-		}
-		osRemoveAllStore = func(_ string) error { return nil }
+		mockImageWrite(t, tmpDir)
 
 		sm := NewSecretManager("", "")
 		secrets := []types.SecretRef{
@@ -101,58 +82,29 @@ func TestInjectSecrets_MockMount(t *testing.T) {
 	})
 }
 
-// TestInjectConfigs_MockMount tests InjectConfigs with mocked debugfs (post-CVR-1.6)
+// TestInjectConfigs_MockMount tests InjectConfigs with a mocked image write
 func TestInjectConfigs_MockMount(t *testing.T) {
-	origMkdirTemp := osMkdirTemp
-	origCommand := execCommand
-	origRemoveAll := osRemoveAllStore
+	origWriteFile := ext4WriteFile
 	defer func() {
-		osMkdirTemp = origMkdirTemp
-		execCommand = origCommand
-		osRemoveAllStore = origRemoveAll
+		ext4WriteFile = origWriteFile
 	}()
 
-	t.Run("debugfs_fails", func(t *testing.T) {
-		tmpDir := t.TempDir()
-		osMkdirTemp = func(_ string, _ string) (string, error) {
-			return tmpDir, nil
-		}
-		execCommand = func(_ string, _ ...string) *exec.Cmd {
-			return exec.Command("false")
+	t.Run("write_fails", func(t *testing.T) {
+		ext4WriteFile = func(_, _ string, _ []byte, _ os.FileMode, _, _ int) error {
+			return errors.New("bad superblock magic")
 		}
-		osRemoveAllStore = func(_ string) error { return nil }
 
 		sm := NewSecretManager("", "")
 		configs := []types.ConfigRef{{Name: "c1", Data: []byte("data")}}
 
 		err := sm.InjectConfigs(context.Background(), "task-1", configs, "/tmp/rootfs.ext4")
 		assert.Error(t, err)
-		assert.Contains(t, err.Error(), "debugfs")
+		assert.Contains(t, err.Error(), "rootfs image")
 	})
 
 	t.Run("full_injection_success", func(t *testing.T) {
 		tmpDir := t.TempDir()
-
-		osMkdirTemp = func(_ string, _ string) (string, error) {
-			return tmpDir, nil
-		}
-		// Mock debugfs to write file to the expected target location
-		execCommand = func(name string, args ...string) *exec.Cmd {
-			if name == "debugfs" && len(args) >= 3 {
-				parts := strings.Fields(args[2])
-				if len(parts) >= 3 {
-					srcFile := parts[1]
-					dstFile := filepath.Join(tmpDir, parts[2])
-					if data, err := os.ReadFile(srcFile); err == nil {
-						os.MkdirAll(filepath.Dir(dstFile), 0755)
-						os.WriteFile(dstFile, data, 0600)
-					}
-				}
-				return exec.Command("echo", "File created")
-			}
-			return exec.Command(name, args...)
-		}
-		osRemoveAllStore = func(_ string) error { return nil }
+		mockImageWrite(t, tmpDir)
 
 		sm := NewSecretManager("", "")
 		configs := []types.ConfigRef{
@@ -389,35 +341,12 @@ func TestNewSecretManager_Mock(t *testing.T) {
 func TestInjectSecrets_MultipleWithMock(t *testing.T) {
 	tmpDir := t.TempDir()
 
-	origMkdirTemp := osMkdirTemp
-	origCommand := execCommand
-	origRemoveAll := osRemoveAllStore
+	origWriteFile := ext4WriteFile
 	defer func() {
-		osMkdirTemp = origMkdirTemp
-		execCommand = origCommand
-		osRemoveAllStore = origRemoveAll
+		ext4WriteFile = origWriteFile
 	}()
 
-	osMkdirTemp = func(_ string, _ string) (string, error) {
-		return tmpDir, nil
-	}
-	// Mock debugfs to copy files to the right location (post CVR-1.6)
-	execCommand = func(name string, args ...string) *exec.Cmd {
-		if name == "debugfs" && len(args) >= 3 {
-			parts := strings.Fields(args[2])
-			if len(parts) >= 3 {
-				srcFile := parts[1]
-				dstFile := filepath.Join(tmpDir, parts[2])
-				if data, err := os.ReadFile(srcFile); err == nil {
-					os.MkdirAll(filepath.Dir(dstFile), 0755)
-					os.WriteFile(dstFile, data, 0600)
-				}
-			}
-			return exec.Command("echo", "File created")
-		}
-		return exec.Command(name, args...)
-	}
-	osRemoveAllStore = func(_ string) error { return nil }
+	mockImageWrite(t, tmpDir)
 
 	sm := NewSecretManager("", "")
 	secrets := []types.SecretRef{
@@ -439,35 +368,12 @@ func TestInjectSecrets_MultipleWithMock(t *testing.T) {
 func TestInjectConfigs_MultipleWithMock(t *testing.T) {
 	tmpDir := t.TempDir()
 
-	origMkdirTemp := osMkdirTemp
-	origCommand := execCommand
-	origRemoveAll := osRemoveAllStore
+	origWriteFile := ext4WriteFile
 	defer func() {
-		osMkdirTemp = origMkdirTemp
-		execCommand = origCommand
-		osRemoveAllStore = origRemoveAll
+		ext4WriteFile = origWriteFile
 	}()
 
-	osMkdirTemp = func(_ string, _ string) (string, error) {
-		return tmpDir, nil
-	}
-	// Mock debugfs to copy files to the right location (post CVR-1.6)
-	execCommand = func(name string, args ...string) *exec.Cmd {
-		if name == "debugfs" && len(args) >= 3 {
-			parts := strings.Fields(args[2])
-			if len(parts) >= 3 {
-				srcFile := parts[1]
-				dstFile := filepath.Join(tmpDir, parts[2])
-				if data, err := os.ReadFile(srcFile); err == nil {
-					os.MkdirAll(filepath.Dir(dstFile), 0755)
-					os.WriteFile(dstFile, data, 0600)
-				}
-			}
-			return exec.Command("echo", "File created")
-		}
-		return exec.Command(name, args...)
-	}
-	osRemoveAllStore = func(_ string) error { return nil }
+	mockImageWrite(t, tmpDir)
 
 	sm := NewSecretManager("", "")
 	configs := []types.ConfigRef{
@@ -1277,15 +1183,8 @@ func TestCreateOptions_Default_V2(t *testing.T) {
 	assert.Equal(t, 0, opts.SizeMB)
 }
 
-// TestBlockDriver_Mount_CommandFails tests Mount when mount fails
-func TestBlockDriver_Mount_CommandFails_V2(t *testing.T) {
-	origCommand := execCommandBlock
-	origMkdirAll := osMkdirAllBlock
-	defer func() {
-		execCommandBlock = origCommand
-		osMkdirAllBlock = origMkdirAll
-	}()
-
+// TestBlockDriver_Mount_InvalidImage tests Mount when the image is not ext4
+func TestBlockDriver_Mount_InvalidImage_V2(t *testing.T) {
 	tmpDir := t.TempDir()
 	bd, err := NewBlockDriver(tmpDir)
 	require.NoError(t, err)
@@ -1296,24 +1195,13 @@ func TestBlockDriver_Mount_CommandFails_V2(t *testing.T) {
 	imgPath := filepath.Join(volDir, "image.ext4")
 	require.NoError(t, os.WriteFile(imgPath, []byte("fake"), 0644))
 
-	execCommandBlock = func(_ string, _ ...string) *exec.Cmd {
-		return exec.Command("false") // will fail
-	}
-
-	err = bd.Mount(context.Background(), "test-vol", "/tmp/rootfs", "/data")
+	err = bd.Mount(context.Background(), "test-vol", t.TempDir(), "/data")
 	assert.Error(t, err)
-	assert.Contains(t, err.Error(), "mount")
+	assert.Contains(t, err.Error(), "open volume image")
 }
 
-// TestBlockDriver_Unmount_CommandFails tests Unmount when mount fails
-func TestBlockDriver_Unmount_CommandFails_V2(t *testing.T) {
-	origCommand := execCommandBlock
-	origMkdirAll := osMkdirAllBlock
-	defer func() {
-		execCommandBlock = origCommand
-		osMkdirAllBlock = origMkdirAll
-	}()
-
+// TestBlockDriver_Unmount_SyncFails tests Unmount when the source is missing
+func TestBlockDriver_Unmount_SyncFails_V2(t *testing.T) {
 	tmpDir := t.TempDir()
 	bd, err := NewBlockDriver(tmpDir)
 	require.NoError(t, err)
@@ -1328,13 +1216,15 @@ func TestBlockDriver_Unmount_CommandFails_V2(t *testing.T) {
 	metaContent := `{"name":"test-vol","type":"block","size_mb":100,"created_at":"2024-01-01T00:00:00Z"}`
 	require.NoError(t, os.WriteFile(metaPath, []byte(metaContent), 0644))
 
-	execCommandBlock = func(_ string, _ ...string) *exec.Cmd {
-		return exec.Command("false") // will fail
-	}
-
-	err = bd.Unmount(context.Background(), "test-vol", "/tmp/rootfs", "/data", false)
+	err = bd.Unmount(context.Background(), "test-vol", t.TempDir(), "/data", false)
 	assert.Error(t, err)
-	assert.Contains(t, err.Error(), "mount")
+	assert.Contains(t, err.Error(), "sync data")
+
+	// The old image is left in place
+	data, err := os.ReadFile(imgPath)
+	require.NoError(t, err)
+	assert.Equal(t, "fake", string(data))
+	assert.NoFileExists(t, imgPath+".sync")
 }
 
 // TestBlockDriver_Snapshot_MkdirFails tests Snapshot when MkdirAll fails
@@ -1361,49 +1251,6 @@ func TestBlockDriver_Snapshot_MkdirFails_V2(t *testing.T) {
 	assert.Contains(t, err.Error(), "snapshots")
 }
 
-// TestBlockDriver_ensureUnmounted_Active tests ensureUnmounted active case
-func TestBlockDriver_ensureUnmounted_Active_V2(t *testing.T) {
-	origCommand := execCommandBlock
-	defer func() { execCommandBlock = origCommand }()
-
-	tmpDir := t.TempDir()
-	bd, err := NewBlockDriver(tmpDir)
-	require.NoError(t, err)
-
-	// Mountpoint command succeeds (returns 0) -> volume is mounted
-	execCommandBlock = func(cmd string, _ ...string) *exec.Cmd {
-		if cmd == "mountpoint" {
-			return exec.Command("true") // succeeds -> volume mounted
-		}
-		return exec.Command("true") // umount also succeeds
-	}
-
-	err = bd.ensureUnmounted("test-vol")
-	assert.NoError(t, err)
-}
-
-// TestBlockDriver_ensureUnmounted_UmountFails tests ensureUnmounted when umount fails
-func TestBlockDriver_ensureUnmounted_UmountFails_V2(t *testing.T) {
-	origCommand := execCommandBlock
-	defer func() { execCommandBlock = origCommand }()
-
-	tmpDir := t.TempDir()
-	bd, err := NewBlockDriver(tmpDir)
-	require.NoError(t, err)
-
-	// Mountpoint succeeds (mounted), but umount fails
-	execCommandBlock = func(cmd string, _ ...string) *exec.Cmd {
-		if cmd == "mountpoint" {
-			return exec.Command("true") // succeeds -> volume mounted
-		}
-		return exec.Command("false") // umount fails
-	}
-
-	err = bd.ensureUnmounted("test-vol")
-	assert.Error(t, err)
-	assert.Contains(t, err.Error(), "umount")
-}
-
 // TestBlockDriver_Restore_SnapshotNil tests Restore with nil snapshot
 func TestBlockDriver_Restore_SnapshotNil_V2(t *testing.T) {
 	tmpDir := t.TempDir()
@@ -1433,30 +1280,12 @@ func TestBlockDriver_Create_MkdirFails_V2(t *testing.T) {
 	assert.Contains(t, err.Error(), "volume dir")
 }
 
-// TestBlockDriver_Create_CreateFails tests Create when createSparseFile fails
+// TestBlockDriver_Create_CreateFails tests Create when the image cannot be written
 func TestBlockDriver_Create_CreateFails_V2(t *testing.T) {
-	origCreate := osCreateBlock
-	defer func() { osCreateBlock = origCreate }()
-
-	tmpDir := t.TempDir()
-	bd, err := NewBlockDriver(tmpDir)
-	require.NoError(t, err)
-
-	osCreateBlock = func(_ string) (*os.File, error) {
-		return nil, errors.New("create failed")
-	}
-
-	_, err = bd.Create(context.Background(), "test-vol", CreateOptions{SizeMB: 100})
-	assert.Error(t, err)
-	assert.Contains(t, err.Error(), "image file")
-}
-
-// TestBlockDriver_Create_MkfsFails tests Create when mkfs.ext4 fails
-func TestBlockDriver_Create_MkfsFails_V2(t *testing.T) {
-	origCommand := execCommandBlock
+	origMkdirAll := osMkdirAllBlock
 	origRemoveAll := osRemoveAllBlock
 	defer func() {
-		execCommandBlock = origCommand
+		osMkdirAllBlock = origMkdirAll
 		osRemoveAllBlock = origRemoveAll
 	}()
 
@@ -1464,14 +1293,13 @@ func TestBlockDriver_Create_MkfsFails_V2(t *testing.T) {
 	bd, err := NewBlockDriver(tmpDir)
 	require.NoError(t, err)
 
-	execCommandBlock = func(_ string, _ ...string) *exec.Cmd {
-		return exec.Command("false") // will fail
-	}
+	// Skip creating the volume dir so the image file cannot be created
+	osMkdirAllBlock = func(_ string, _ os.FileMode) error { return nil }
 	osRemoveAllBlock = func(_ string) error { return nil }
 
 	_, err = bd.Create(context.Background(), "test-vol", CreateOptions{SizeMB: 100})
 	assert.Error(t, err)
-	assert.Contains(t, err.Error(), "mkfs")
+	assert.Contains(t, err.Error(), "image file")
 }
 
 // TestBlockDriver_Mount_ImageNotFound tests Mount with missing image
@@ -1487,76 +1315,45 @@ func TestBlockDriver_Mount_ImageNotFound_V2(t *testing.T) {
 
 // TestBlockDriver_Mount_MkdirTargetFails tests Mount when target MkdirAll fails
 func TestBlockDriver_Mount_MkdirTargetFails_V2(t *testing.T) {
-	origCommand := execCommandBlock
 	origMkdirAll := osMkdirAllBlock
 	defer func() {
-		execCommandBlock = origCommand
 		osMkdirAllBlock = origMkdirAll
 	}()
 
 	tmpDir := t.TempDir()
 	bd, err := NewBlockDriver(tmpDir)
 	require.NoError(t, err)
+	_, err = bd.Create(context.Background(), "test-vol", CreateOptions{SizeMB: 10})
+	require.NoError(t, err)
 
-	// Create fake image
-	volDir := filepath.Join(tmpDir, "test-vol")
-	require.NoError(t, os.MkdirAll(volDir, 0755))
-	imgPath := filepath.Join(volDir, "image.ext4")
-	require.NoError(t, os.WriteFile(imgPath, []byte("fake"), 0644))
-
-	// Mount succeeds, but target MkdirAll fails
-	callCount := 0
-	execCommandBlock = func(cmd string, _ ...string) *exec.Cmd {
-		callCount++
-		if cmd == "mount" && callCount == 1 {
-			return exec.Command("true") // mount succeeds
-		}
-		return exec.Command("true") // umount succeeds
-	}
 	osMkdirAllBlock = func(path string, _ os.FileMode) error {
 		if filepath.Base(path) == "data" {
 			return errors.New("mkdir target failed")
 		}
-		return os.MkdirAll(path, 0755) // use real MkdirAll for mount point
+		return os.MkdirAll(path, 0755)
 	}
 
-	err = bd.Mount(context.Background(), "test-vol", "/tmp/rootfs", "/data")
+	err = bd.Mount(context.Background(), "test-vol", t.TempDir(), "/data")
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "target dir")
 }
 
-// TestBlockDriver_Mount_CopyDirFails tests Mount when copyDirectory fails
+// TestBlockDriver_Mount_CopyDirFails tests Mount when copying out of the image fails
 func TestBlockDriver_Mount_CopyDirFails_V2(t *testing.T) {
-	origCommand := execCommandBlock
-	origMkdirAll := osMkdirAllBlock
-	defer func() {
-		execCommandBlock = origCommand
-		osMkdirAllBlock = origMkdirAll
-	}()
-
 	tmpDir := t.TempDir()
 	bd, err := NewBlockDriver(tmpDir)
 	require.NoError(t, err)
+	_, err = bd.Create(context.Background(), "test-vol", CreateOptions{SizeMB: 10})
+	require.NoError(t, err)
 
-	// Create fake image
-	volDir := filepath.Join(tmpDir, "test-vol")
-	require.NoError(t, os.MkdirAll(volDir, 0755))
-	imgPath := filepath.Join(volDir, "image.ext4")
-	require.NoError(t, os.WriteFile(imgPath, []byte("fake"), 0644))
-
-	execCommandBlock = func(cmd string, _ ...string) *exec.Cmd {
-		return exec.Command("true") // mount/umount succeed
-	}
-	osMkdirAllBlock = os.MkdirAll // use real MkdirAll
-
-	// Create a mount point dir that can't be copied from
-	mountsDir := filepath.Join(tmpDir, ".mounts")
-	require.NoError(t, os.MkdirAll(filepath.Join(mountsDir, "test-vol", "subdir"), 0755))
+	// A file where the image has lost+found blocks the copy
+	rootfs := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(rootfs, "data"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(rootfs, "data", "lost+found"), []byte("x"), 0644))
 
-	err = bd.Mount(context.Background(), "test-vol", "/nonexistent/rootfs", "/data")
-	// Will fail trying to copy from non-existent rootfs path
-	// Or succeed depending on copyDirectory implementation
-	t.Logf("Mount result: %v", err)
+	err = bd.Mount(context.Background(), "test-vol", rootfs, "/data")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "copy data")
 }
 
 // TestBlockDriver_Unmount_ImageNotFound tests Unmount with missing image
@@ -1629,34 +1426,16 @@ func TestBlockDriver_Restore_CpFails_V2(t *testing.T) {
 	assert.Contains(t, err.Error(), "restore")
 }
 
-// TestBlockDriver_Import_FsckFails tests Import when fsck fails
-func TestBlockDriver_Import_FsckFails_V2(t *testing.T) {
-	origCommand := execCommandBlock
-	origCreate := osCreateBlock
-	defer func() {
-		execCommandBlock = origCommand
-		osCreateBlock = origCreate
-	}()
-
+// TestBlockDriver_Import_InvalidImage tests Import with data that is not ext4
+func TestBlockDriver_Import_InvalidImage_V2(t *testing.T) {
 	tmpDir := t.TempDir()
 	bd, err := NewBlockDriver(tmpDir)
 	require.NoError(t, err)
 
-	osCreateBlock = func(_ string) (*os.File, error) {
-		// Return a temp file that will succeed for io.Copy
-		return os.CreateTemp(tmpDir, "import")
-	}
-	execCommandBlock = func(cmd string, _ ...string) *exec.Cmd {
-		if cmd == "e2fsck" {
-			return exec.Command("false") // fsck fails
-		}
-		return exec.Command("true") // mkfs.ext4 succeeds
-	}
-
-	var buf bytes.Buffer
-	err = bd.Import(context.Background(), "test-vol", &buf, 50)
+	buf := bytes.NewReader(make([]byte, 64*1024))
+	err = bd.Import(context.Background(), "test-vol", buf, 50)
 	assert.Error(t, err)
-	assert.Contains(t, err.Error(), "fsck")
+	assert.Contains(t, err.Error(), "verify imported image")
 }
 
 // TestBlockDriver_Stat_ImageNotFound tests Stat with missing image
@@ -1715,57 +1494,14 @@ func TestBlockDriver_Create_EmptyName_V2(t *testing.T) {
 
 // TestBlockDriver_Create_DefaultSize tests Create with default size
 func TestBlockDriver_Create_DefaultSize_V2(t *testing.T) {
-	origCommand := execCommandBlock
-	origCreate := osCreateBlock
-	origRemoveAll := osRemoveAllBlock
-	defer func() {
-		execCommandBlock = origCommand
-		osCreateBlock = origCreate
-		osRemoveAllBlock = origRemoveAll
-	}()
-
 	tmpDir := t.TempDir()
 	bd, err := NewBlockDriver(tmpDir)
 	require.NoError(t, err)
 
-	osCreateBlock = func(_ string) (*os.File, error) {
-		return os.CreateTemp(tmpDir, "image")
-	}
-	execCommandBlock = func(_ string, _ ...string) *exec.Cmd {
-		return exec.Command("true") // mkfs.ext4 succeeds
-	}
-	osRemoveAllBlock = func(_ string) error { return nil }
-
 	_, err = bd.Create(context.Background(), "test-vol", CreateOptions{SizeMB: 0}) // default size
 	require.NoError(t, err)
-}
-
-// TestNewBlockDriver_MetaStoreFails tests NewBlockDriver when MetaStore fails
-func TestNewBlockDriver_MetaStoreFails_V2(t *testing.T) {
-	origMkdirAll := osMkdirAllBlock
-	defer func() { osMkdirAllBlock = origMkdirAll }()
 
-	osMkdirAllBlock = func(_ string, _ os.FileMode) error {
-		return errors.New("mkdir failed")
-	}
-
-	_, err := NewBlockDriver("/tmp/test")
-	assert.Error(t, err)
-}
-
-// TestClearDirectory_ReadDirFails tests clearDirectory error
-func TestClearDirectory_ReadDirFails_V2(t *testing.T) {
-	err := clearDirectory("/nonexistent/dir")
-	assert.Error(t, err)
-}
-
-// TestCreateSparseFile_TruncateFails tests createSparseFile error
-func TestCreateSparseFile_TruncateFails_V2(t *testing.T) {
-	tmpDir := t.TempDir()
-	f, err := os.Create(filepath.Join(tmpDir, "test.sparse"))
+	info, err := os.Stat(bd.imagePath("test-vol"))
 	require.NoError(t, err)
-	f.Close()
-
-	// Can't test truncate failure easily, but the function exists
-	assert.FileExists(t, filepath.Join(tmpDir, "test.sparse"))
+	assert.Equal(t, int64(1024*1024*1024), info.Size())
 }
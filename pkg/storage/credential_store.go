@@ -7,9 +7,11 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
 
+	"github.com/restuhaqza/swarmcracker/pkg/ext4"
 	"github.com/restuhaqza/swarmcracker/pkg/types"
 	"github.com/rs/zerolog/log"
 )
@@ -17,6 +19,7 @@ import (
 // Injectable function variables for testing
 var (
 	execCommand      = exec.Command
+	ext4WriteFile    = ext4.WriteFileOwned
 	osMkdirTemp      = os.MkdirTemp
 	osMkdirAllStore  = os.MkdirAll
 	osWriteFileStore = os.WriteFile
@@ -40,11 +43,6 @@ func NewSecretManager(secretsDir, configsDir string) *SecretManager {
 		osMkdirAllStore(configsDir, 0755)
 	}
 
-	// Check that debugfs is available for secret/config injection
-	if _, err := exec.LookPath("debugfs"); err != nil {
-		log.Warn().Msg("debugfs not found in PATH — secret/config injection will fail. Install e2fsprogs.")
-	}
-
 	return &SecretManager{
 		secretsDir: secretsDir,
 		configsDir: configsDir,
@@ -67,7 +65,7 @@ func (sm *SecretManager) InjectSecrets(ctx context.Context, taskID string, secre
 		Msg("Injecting secrets into rootfs")
 
 	for _, secret := range secrets {
-		if err := sm.injectFileViaDebugfs(rootfsPath, secret.Target, "/run/secrets/"+secret.Name, secret.Data, 0400); err != nil {
+		if err := sm.injectFile(rootfsPath, secret.Target, "/run/secrets/"+secret.Name, secret.Data, fileMode(secret.Mode, 0400), secret.UID, secret.GID); err != nil {
 			log.Error().
 				Str("task_id", taskID).
 				Str("secret", secret.Name).
@@ -107,7 +105,7 @@ func (sm *SecretManager) InjectConfigs(ctx context.Context, taskID string, confi
 		Msg("Injecting configs into rootfs")
 
 	for _, config := range configs {
-		if err := sm.injectFileViaDebugfs(rootfsPath, config.Target, "/config/"+config.Name, config.Data, 0444); err != nil {
+		if err := sm.injectFile(rootfsPath, config.Target, "/config/"+config.Name, config.Data, fileMode(config.Mode, 0444), config.UID, config.GID); err != nil {
 			log.Error().
 				Str("task_id", taskID).
 				Str("config", config.Name).
@@ -213,9 +211,10 @@ func (sm *SecretManager) injectConfig(mountDir string, config types.ConfigRef) e
 	return nil
 }
 
-// injectFileViaDebugfs writes a file into an ext4 image using debugfs.
-// This avoids requiring root privileges for mount -o loop.
-func (sm *SecretManager) injectFileViaDebugfs(ext4Path, target, defaultName string, data []byte, mode os.FileMode) error {
+// injectFile writes a file into an ext4 image without mounting it, so
+// injection works without root privileges or loop devices. uid and gid
+// are numeric IDs inside the guest; empty means root.
+func (sm *SecretManager) injectFile(ext4Path, target, defaultName string, data []byte, mode os.FileMode, uid, gid string) error {
 	targetPath := target
 	if targetPath == "" {
 		targetPath = defaultName
@@ -226,50 +225,54 @@ func (sm *SecretManager) injectFileViaDebugfs(ext4Path, target, defaultName stri
 		return fmt.Errorf("invalid target path: %w", err)
 	}
 
-	// Write to temp file first
-	tmpFile, err := osMkdirTemp("", "swarmcracker-inject-")
+	owner, err := parseFileOwner(uid)
 	if err != nil {
-		return fmt.Errorf("failed to create temp file: %w", err)
-	}
-	defer osRemoveAllStore(tmpFile)
-
-	filePath := filepath.Join(tmpFile, filepath.Base(targetPath))
-	if err := osWriteFileStore(filePath, data, mode); err != nil {
-		return fmt.Errorf("failed to write temp file: %w", err)
+		return fmt.Errorf("invalid uid: %w", err)
 	}
-
-	// Use debugfs to write into ext4 without mounting
-	cmd := execCommand("debugfs", "-w", "-R",
-		fmt.Sprintf("write %s %s", filePath, targetPath),
-		ext4Path)
-	output, err := cmd.CombinedOutput()
+	group, err := parseFileOwner(gid)
 	if err != nil {
-		return fmt.Errorf("debugfs write failed: %s: %w", string(output), err)
+		return fmt.Errorf("invalid gid: %w", err)
 	}
 
-	// debugfs exits with code 0 even for certain errors (quirk)
-	// Check output for error indicators
-	outputStr := string(output)
-	if strings.Contains(outputStr, "Filesystem not open") ||
-		strings.Contains(outputStr, "No such file or directory") ||
-		strings.Contains(outputStr, "while trying to open") {
-		return fmt.Errorf("debugfs write failed: %s", outputStr)
+	if err := ext4WriteFile(ext4Path, targetPath, data, mode, owner, group); err != nil {
+		return fmt.Errorf("failed to write %s into rootfs image: %w", targetPath, err)
 	}
 
 	log.Debug().
 		Str("target", targetPath).
 		Int("size", len(data)).
-		Msg("File injected via debugfs")
+		Msg("File injected into rootfs image")
 
 	return nil
 }
 
-// mountRootfs is deprecated — use injectFileViaDebugfs instead.
+// fileMode returns the permission bits of mode, or def when none are set.
+func fileMode(mode, def os.FileMode) os.FileMode {
+	if mode.Perm() == 0 {
+		return def
+	}
+	return mode.Perm()
+}
+
+// parseFileOwner parses a numeric user or group ID. The guest's passwd and
+// group files are not consulted, so names are rejected.
+func parseFileOwner(id string) (int, error) {
+	if id == "" {
+		return 0, nil
+	}
+	n, err := strconv.ParseUint(id, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not a numeric ID", id)
+	}
+	return int(n), nil
+}
+
+// mountRootfs is deprecated — use injectFile instead.
 func (sm *SecretManager) mountRootfs(rootfsPath string) (string, error) {
 	return osMkdirTemp("", "swarmcracker-deprecated-mount-")
 }
 
-// unmountRootfs is deprecated — use injectFileViaDebugfs instead.
+// unmountRootfs is deprecated — use injectFile instead.
 func (sm *SecretManager) unmountRootfs(mountDir string) {
 	osRemoveAllStore(mountDir)
 }
@@ -8,6 +8,7 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/restuhaqza/swarmcracker/pkg/ext4"
 	"github.com/restuhaqza/swarmcracker/pkg/types"
 )
 
@@ -111,7 +112,18 @@ func TestInjectSecrets(t *testing.T) {
 			wantErr: false,
 		},
 		{
-			name: "single secret - needs root",
+			name: "rootfs is not an image",
+			secrets: []types.SecretRef{
+				{Name: "s1", Target: "/run/secrets/s1", Data: []byte("data")},
+			},
+			setupRootfs: func(t *testing.T) string {
+				return createFakeRootfs(t)
+			},
+			wantErr:     true,
+			errContains: "rootfs image",
+		},
+		{
+			name: "single secret",
 			secrets: []types.SecretRef{
 				{
 					ID:     "secret-1",
@@ -120,14 +132,10 @@ func TestInjectSecrets(t *testing.T) {
 					Data:   []byte("secret data"),
 				},
 			},
-			setupRootfs: func(t *testing.T) string {
-				return createFakeRootfs(t)
-			},
-			wantErr:     true,
-			errContains: "debugfs",
+			setupRootfs: createTestImage,
 		},
 		{
-			name: "multiple secrets - needs root",
+			name: "multiple secrets",
 			secrets: []types.SecretRef{
 				{
 					ID:     "secret-1",
@@ -142,14 +150,10 @@ func TestInjectSecrets(t *testing.T) {
 					Data:   []byte("key-xyz-789"),
 				},
 			},
-			setupRootfs: func(t *testing.T) string {
-				return createFakeRootfs(t)
-			},
-			wantErr:     true,
-			errContains: "debugfs",
+			setupRootfs: createTestImage,
 		},
 		{
-			name: "secret with default target - needs root",
+			name: "secret with default target",
 			secrets: []types.SecretRef{
 				{
 					ID:   "secret-1",
@@ -157,14 +161,10 @@ func TestInjectSecrets(t *testing.T) {
 					Data: []byte("data"),
 				},
 			},
-			setupRootfs: func(t *testing.T) string {
-				return createFakeRootfs(t)
-			},
-			wantErr:     true,
-			errContains: "debugfs",
+			setupRootfs: createTestImage,
 		},
 		{
-			name: "secret with nested path - needs root",
+			name: "secret with nested path",
 			secrets: []types.SecretRef{
 				{
 					ID:     "secret-1",
@@ -173,11 +173,7 @@ func TestInjectSecrets(t *testing.T) {
 					Data:   []byte("nested data"),
 				},
 			},
-			setupRootfs: func(t *testing.T) string {
-				return createFakeRootfs(t)
-			},
-			wantErr:     true,
-			errContains: "debugfs",
+			setupRootfs: createTestImage,
 		},
 	}
 
@@ -212,15 +208,7 @@ func TestInjectSecrets(t *testing.T) {
 						targetPath = filepath.Join("/run/secrets", secret.Name)
 					}
 
-					// Since we're using a fake rootfs with directories, check if file exists
-					// In real scenario, this would be in the mounted rootfs
-					if !isMockedRootfs(rootfsPath) {
-						// Only verify for real filesystems
-						fullPath := filepath.Join(rootfsPath, targetPath)
-						if _, err := os.Stat(fullPath); err != nil {
-							t.Errorf("Secret file not created at %s: %v", fullPath, err)
-						}
-					}
+					verifyImageFile(t, rootfsPath, targetPath, secret.Data, 0400)
 				}
 			}
 		})
@@ -245,7 +233,18 @@ func TestInjectConfigs(t *testing.T) {
 			wantErr: false,
 		},
 		{
-			name: "single config - needs root",
+			name: "rootfs is not an image",
+			configs: []types.ConfigRef{
+				{Name: "s1", Target: "/config/c1", Data: []byte("data")},
+			},
+			setupRootfs: func(t *testing.T) string {
+				return createFakeRootfs(t)
+			},
+			wantErr:     true,
+			errContains: "rootfs image",
+		},
+		{
+			name: "single config",
 			configs: []types.ConfigRef{
 				{
 					ID:     "config-1",
@@ -254,14 +253,10 @@ func TestInjectConfigs(t *testing.T) {
 					Data:   []byte("key: value\n"),
 				},
 			},
-			setupRootfs: func(t *testing.T) string {
-				return createFakeRootfs(t)
-			},
-			wantErr:     true,
-			errContains: "debugfs",
+			setupRootfs: createTestImage,
 		},
 		{
-			name: "multiple configs - needs root",
+			name: "multiple configs",
 			configs: []types.ConfigRef{
 				{
 					ID:     "config-1",
@@ -276,14 +271,10 @@ func TestInjectConfigs(t *testing.T) {
 					Data:   []byte("app:\n  port: 8080\n"),
 				},
 			},
-			setupRootfs: func(t *testing.T) string {
-				return createFakeRootfs(t)
-			},
-			wantErr:     true,
-			errContains: "debugfs",
+			setupRootfs: createTestImage,
 		},
 		{
-			name: "config with default target - needs root",
+			name: "config with default target",
 			configs: []types.ConfigRef{
 				{
 					ID:   "config-1",
@@ -291,14 +282,10 @@ func TestInjectConfigs(t *testing.T) {
 					Data: []byte("default data"),
 				},
 			},
-			setupRootfs: func(t *testing.T) string {
-				return createFakeRootfs(t)
-			},
-			wantErr:     true,
-			errContains: "debugfs",
+			setupRootfs: createTestImage,
 		},
 		{
-			name: "config with nested path - needs root",
+			name: "config with nested path",
 			configs: []types.ConfigRef{
 				{
 					ID:     "config-1",
@@ -307,11 +294,7 @@ func TestInjectConfigs(t *testing.T) {
 					Data:   []byte("db.host=localhost\n"),
 				},
 			},
-			setupRootfs: func(t *testing.T) string {
-				return createFakeRootfs(t)
-			},
-			wantErr:     true,
-			errContains: "debugfs",
+			setupRootfs: createTestImage,
 		},
 	}
 
@@ -346,12 +329,7 @@ func TestInjectConfigs(t *testing.T) {
 						targetPath = filepath.Join("/config", config.Name)
 					}
 
-					if !isMockedRootfs(rootfsPath) {
-						fullPath := filepath.Join(rootfsPath, targetPath)
-						if _, err := os.Stat(fullPath); err != nil {
-							t.Errorf("Config file not created at %s: %v", fullPath, err)
-						}
-					}
+					verifyImageFile(t, rootfsPath, targetPath, config.Data, 0444)
 				}
 			}
 		})
@@ -936,16 +914,49 @@ func createFakeRootfs(t *testing.T) string {
 	return tmpDir
 }
 
+// createTestImage creates an empty ext4 rootfs image for testing.
+func createTestImage(t *testing.T) string {
+	t.Helper()
+	imagePath := filepath.Join(t.TempDir(), "rootfs.ext4")
+	e, err := ext4.Create(imagePath, ext4.Options{Size: 4 << 20})
+	if err != nil {
+		t.Fatalf("Failed to create test image: %v", err)
+	}
+	if err := e.Close(); err != nil {
+		t.Fatalf("Failed to write test image: %v", err)
+	}
+	return imagePath
+}
+
+// verifyImageFile checks the contents and mode of a file in an ext4 image.
+func verifyImageFile(t *testing.T, imagePath, name string, want []byte, mode os.FileMode) {
+	t.Helper()
+	img, err := ext4.Open(imagePath)
+	if err != nil {
+		t.Fatalf("Failed to open image: %v", err)
+	}
+	defer img.Close()
+
+	data, err := img.ReadFile(name)
+	if err != nil {
+		t.Errorf("File not written at %s: %v", name, err)
+		return
+	}
+	if string(data) != string(want) {
+		t.Errorf("%s = %q, want %q", name, data, want)
+	}
+	info, err := img.Stat(name)
+	if err != nil {
+		t.Fatalf("Failed to stat %s: %v", name, err)
+	}
+	if info.Mode() != mode {
+		t.Errorf("%s mode = %v, want %v", name, info.Mode(), mode)
+	}
+}
+
 // cleanupFakeRootfs cleans up a fake rootfs directory.
 func cleanupFakeRootfs(t *testing.T, rootfsPath string) {
 	t.Helper()
 	// TempDir is automatically cleaned up by t.TempDir()
 	// This function exists for API compatibility
 }
-
-// isMockedRootfs checks if the rootfs is a fake/mocked one.
-func isMockedRootfs(rootfsPath string) bool {
-	markerPath := filepath.Join(rootfsPath, ".fake-rootfs")
-	_, err := os.Stat(markerPath)
-	return err == nil
-}
@@ -42,14 +42,14 @@ func TestInjectSecrets_NonexistentRootfs(t *testing.T) {
 		{Name: "secret1", Target: "/run/secrets/secret1", Data: []byte("secret data")},
 	}
 
-	// With CVR-1.6 debugfs write, nonexistent ext4 should fail with debugfs error
+	// Writing into a nonexistent ext4 image should fail
 	err := sm.InjectSecrets(ctx, "task-123", secrets, "/nonexistent/rootfs.ext4")
 	if err == nil {
 		t.Error("Expected error for nonexistent rootfs")
 	}
-	// Error should contain "debugfs" (not "mount")
-	if err != nil && !strings.Contains(err.Error(), "debugfs") {
-		t.Errorf("Error should contain 'debugfs', got: %v", err)
+	// Error should name the image write (not "mount")
+	if err != nil && !strings.Contains(err.Error(), "rootfs image") {
+		t.Errorf("Error should contain 'rootfs image', got: %v", err)
 	}
 }
 
@@ -62,7 +62,7 @@ func TestInjectConfigs_NonexistentRootfs(t *testing.T) {
 		{Name: "config1", Target: "/config/config1", Data: []byte("config data")},
 	}
 
-	// With CVR-1.6 debugfs write, nonexistent ext4 should fail
+	// Writing into a nonexistent ext4 image should fail
 	err := sm.InjectConfigs(ctx, "task-123", configs, "/nonexistent/rootfs.ext4")
 	if err == nil {
 		t.Error("Expected error for nonexistent rootfs")
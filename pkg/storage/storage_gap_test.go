@@ -6,7 +6,6 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
-	"strings"
 	"testing"
 	"time"
 )
@@ -599,6 +598,20 @@ func TestQuotaEnforcer_EnforceDirLimit_Extended(t *testing.T) {
 	}
 }
 
+// testImageData returns the bytes of a small, empty ext4 image.
+func testImageData(t *testing.T) []byte {
+	t.Helper()
+	imgPath := filepath.Join(t.TempDir(), "src.ext4")
+	if err := formatImage(imgPath, 4, ""); err != nil {
+		t.Fatalf("formatImage() = %v", err)
+	}
+	data, err := os.ReadFile(imgPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
 // TestBlockDriver_Import_Extended tests additional cases for the Import method (0% coverage).
 func TestBlockDriver_Import_Extended(t *testing.T) {
 	tmpDir := t.TempDir()
@@ -611,21 +624,14 @@ func TestBlockDriver_Import_Extended(t *testing.T) {
 	volName := "import-test"
 	sizeMB := 50
 
-	// Prepare test data (1MB of data)
-	testData := make([]byte, 1024*1024)
-	for i := range testData {
-		testData[i] = byte(i % 256)
-	}
+	// Prepare test data (a small ext4 image)
+	testData := testImageData(t)
 
 	reader := bytes.NewReader(testData)
 
 	// Test import (will create the volume)
 	err = d.Import(ctx, volName, reader, sizeMB)
 	if err != nil {
-		// Import requires e2fsck which may not be available
-		if strings.Contains(err.Error(), "fsck") {
-			t.Skipf("Skipping import test (requires e2fsck): %v", err)
-		}
 		t.Fatalf("Import() error = %v", err)
 	}
 
@@ -677,15 +683,12 @@ func TestBlockDriver_ImportOverwrite(t *testing.T) {
 	}
 
 	// Prepare test data
-	testData := []byte("imported data")
+	testData := testImageData(t)
 	reader := bytes.NewReader(testData)
 
 	// Import (should overwrite existing)
 	err = d.Import(ctx, volName, reader, 50)
 	if err != nil {
-		if strings.Contains(err.Error(), "fsck") {
-			t.Skipf("Skipping import test (requires e2fsck): %v", err)
-		}
 		t.Fatalf("Import() error = %v", err)
 	}
 
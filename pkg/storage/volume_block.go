@@ -8,6 +8,7 @@ import (
 	"os/exec"
 	"path/filepath"
 
+	"github.com/restuhaqza/swarmcracker/pkg/ext4"
 	"github.com/rs/zerolog/log"
 )
 
@@ -21,18 +22,18 @@ var (
 	osCreateBlock    = os.Create
 )
 
-// BlockDriver stores volume data in an ext4 loopback image file.
+// BlockDriver stores volume data in an ext4 image file.
 //
 // Advantages over DirectoryDriver:
 //   - Native filesystem quotas via ext4 reserved blocks
 //   - Full POSIX filesystem semantics inside the VM (symlinks, permissions, xattrs)
 //   - Efficient copy via block-level operations
 //
-// Requires root for mkfs, mount/umount.
+// Images are built and read with pkg/ext4, so no root privileges, mkfs or
+// loop devices are needed.
 type BlockDriver struct {
-	meta     *MetaStore
-	quota    *QuotaEnforcer
-	mountDir string // base dir for temporary mount points
+	meta  *MetaStore
+	quota *QuotaEnforcer
 }
 
 // NewBlockDriver creates a driver that stores volume data in ext4 images.
@@ -41,14 +42,9 @@ func NewBlockDriver(baseDir string) (*BlockDriver, error) {
 	if err != nil {
 		return nil, err
 	}
-	mountDir := filepath.Join(baseDir, ".mounts")
-	if err := osMkdirAllBlock(mountDir, 0750); err != nil {
-		return nil, fmt.Errorf("create mount base dir: %w", err)
-	}
 	return &BlockDriver{
-		meta:     meta,
-		quota:    NewQuotaEnforcer(),
-		mountDir: mountDir,
+		meta:  meta,
+		quota: NewQuotaEnforcer(),
 	}, nil
 }
 
@@ -60,12 +56,7 @@ func (d *BlockDriver) imagePath(name string) string {
 	return filepath.Join(d.meta.volumeDir(name), blockImageFile)
 }
 
-// mountPoint returns the mount path for a volume.
-func (d *BlockDriver) mountPoint(name string) string {
-	return filepath.Join(d.mountDir, sanitizeVolumeName(name))
-}
-
-// Create creates an ext4 loopback image for the volume.
+// Create creates an empty ext4 image for the volume.
 // If opts.SizeMB is 0, defaults to 1024 MB.
 func (d *BlockDriver) Create(ctx context.Context, name string, opts CreateOptions) (string, error) {
 	if name == "" {
@@ -87,20 +78,11 @@ func (d *BlockDriver) Create(ctx context.Context, name string, opts CreateOption
 	}
 
 	imgPath := d.imagePath(name)
-	sizeBytes := int64(sizeMB) * 1024 * 1024
-
-	// Create sparse image file
-	if err := createSparseFile(imgPath, sizeBytes); err != nil {
+	if err := formatImage(imgPath, sizeMB, ""); err != nil {
 		osRemoveAllBlock(dir)
 		return "", fmt.Errorf("create image file: %w", err)
 	}
 
-	// Format as ext4
-	if output, err := execCommandBlock("mkfs.ext4", "-F", "-q", imgPath).CombinedOutput(); err != nil {
-		osRemoveAllBlock(dir)
-		return "", fmt.Errorf("mkfs.ext4: %s: %w", string(output), err)
-	}
-
 	m := &volumeMeta{
 		Name:      name,
 		Type:      VolumeTypeBlock,
@@ -119,9 +101,6 @@ func (d *BlockDriver) Create(ctx context.Context, name string, opts CreateOption
 
 // Delete removes the image file and volume directory.
 func (d *BlockDriver) Delete(ctx context.Context, name string) error {
-	// Ensure unmounted first
-	_ = d.ensureUnmounted(name)
-
 	if err := d.meta.RemoveVolumeDir(name); err != nil {
 		return err
 	}
@@ -129,47 +108,36 @@ func (d *BlockDriver) Delete(ctx context.Context, name string) error {
 	return nil
 }
 
-// Mount mounts the ext4 image and copies data into rootfs at target.
+// Mount copies the contents of the ext4 image into rootfs at target.
 func (d *BlockDriver) Mount(ctx context.Context, name, rootfsPath, target string) error {
 	imgPath := d.imagePath(name)
 	if _, err := os.Stat(imgPath); err != nil {
 		return fmt.Errorf("volume image not found: %s", name)
 	}
 
-	mnt := d.mountPoint(name)
-	if err := osMkdirAllBlock(mnt, 0750); err != nil {
-		return fmt.Errorf("create mount point: %w", err)
-	}
-
-	// Mount the ext4 image
-	if output, err := execCommandBlock("mount", "-o", "loop", imgPath, mnt).CombinedOutput(); err != nil {
-		return fmt.Errorf("mount image: %s: %w", string(output), err)
+	img, err := ext4.Open(imgPath)
+	if err != nil {
+		return fmt.Errorf("open volume image: %w", err)
 	}
+	defer img.Close()
 
 	targetPath := ensureAbsolutePath(target)
 	dest := filepath.Join(rootfsPath, targetPath)
 	if err := osMkdirAllBlock(dest, 0755); err != nil {
-		_ = execCommandBlock("umount", mnt).Run()
 		return fmt.Errorf("create target dir: %w", err)
 	}
 
-	if err := copyDirectory(mnt, dest); err != nil {
-		_ = execCommandBlock("umount", mnt).Run()
+	if err := img.Extract(".", dest); err != nil {
 		return fmt.Errorf("copy data from block volume: %w", err)
 	}
 
-	// Unmount after copy
-	if output, err := execCommandBlock("umount", mnt).CombinedOutput(); err != nil {
-		log.Warn().Str("output", string(output)).Err(err).Msg("Failed to unmount after mount copy")
-	}
-
 	_ = d.meta.TouchLastUsed(ctx, name)
 
 	log.Info().Str("volume", name).Str("target", targetPath).Msg("Block volume mounted")
 	return nil
 }
 
-// Unmount mounts the ext4 image and syncs data back from rootfs.
+// Unmount syncs data back from rootfs by rebuilding the ext4 image from it.
 func (d *BlockDriver) Unmount(ctx context.Context, name, rootfsPath, target string, readOnly bool) error {
 	if readOnly {
 		log.Debug().Str("volume", name).Msg("Skipping unmount sync for read-only block volume")
@@ -194,35 +162,16 @@ func (d *BlockDriver) Unmount(ctx context.Context, name, rootfsPath, target stri
 		return err
 	}
 
-	mnt := d.mountPoint(name)
-	if err := osMkdirAllBlock(mnt, 0750); err != nil {
-		return fmt.Errorf("create mount point: %w", err)
-	}
-
-	// Mount the ext4 image for writing
-	if output, err := execCommandBlock("mount", "-o", "loop", imgPath, mnt).CombinedOutput(); err != nil {
-		return fmt.Errorf("mount image: %s: %w", string(output), err)
-	}
-
-	// Clear existing content and copy new data
-	if err := clearDirectory(mnt); err != nil {
-		_ = execCommandBlock("umount", mnt).Run()
-		return fmt.Errorf("clear block volume: %w", err)
-	}
-
-	if err := copyDirectory(src, mnt); err != nil {
-		_ = execCommandBlock("umount", mnt).Run()
+	// Build the new image next to the old one so a failed sync leaves the
+	// volume untouched.
+	tmpPath := imgPath + ".sync"
+	if err := formatImage(tmpPath, m.SizeMB, src); err != nil {
+		os.Remove(tmpPath)
 		return fmt.Errorf("sync data to block volume: %w", err)
 	}
-
-	// Unmount
-	if output, err := execCommandBlock("umount", mnt).CombinedOutput(); err != nil {
-		return fmt.Errorf("unmount image: %s: %w", string(output), err)
-	}
-
-	// Run fsck to ensure filesystem integrity
-	if output, err := execCommandBlock("e2fsck", "-p", "-f", imgPath).CombinedOutput(); err != nil {
-		log.Warn().Str("output", string(output)).Err(err).Msg("fsck reported issues")
+	if err := os.Rename(tmpPath, imgPath); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("replace volume image: %w", err)
 	}
 
 	log.Info().Str("volume", name).Str("target", targetPath).Msg("Block volume unmounted (data synced)")
@@ -316,8 +265,6 @@ func (d *BlockDriver) Restore(ctx context.Context, name string, snap *Snapshot)
 		return fmt.Errorf("snapshot cannot be nil")
 	}
 
-	_ = d.ensureUnmounted(name)
-
 	imgPath := d.imagePath(name)
 	if output, err := execCommandBlock("cp", snap.Path, imgPath).CombinedOutput(); err != nil {
 		return fmt.Errorf("restore image: %s: %w", string(output), err)
@@ -348,10 +295,8 @@ func (d *BlockDriver) Export(ctx context.Context, name string, w io.Writer) erro
 // Import reads a raw ext4 image from r and writes it as the volume image.
 func (d *BlockDriver) Import(ctx context.Context, name string, r io.Reader, sizeMB int) error {
 	opts := CreateOptions{Type: VolumeTypeBlock, SizeMB: sizeMB}
-	if _, err := d.Create(ctx, name, opts); err != nil {
-		// May already exist
-		_ = d.ensureUnmounted(name)
-	}
+	// The volume may already exist
+	_, _ = d.Create(ctx, name, opts)
 
 	imgPath := d.imagePath(name)
 	f, err := osCreateBlock(imgPath)
@@ -364,56 +309,27 @@ func (d *BlockDriver) Import(ctx context.Context, name string, r io.Reader, size
 		return fmt.Errorf("write image data: %w", err)
 	}
 
-	// Verify filesystem
-	if output, err := execCommandBlock("e2fsck", "-p", "-f", imgPath).CombinedOutput(); err != nil {
-		return fmt.Errorf("fsck on imported image: %s: %w", string(output), err)
+	// Verify the data is an ext4 image we can read
+	img, err := ext4.Open(imgPath)
+	if err != nil {
+		return fmt.Errorf("verify imported image: %w", err)
 	}
+	img.Close()
 
 	log.Info().Str("volume", name).Msg("Block volume imported")
 	return nil
 }
 
-// ensureUnmounted unmounts the volume image if currently mounted.
-func (d *BlockDriver) ensureUnmounted(name string) error {
-	mnt := d.mountPoint(name)
-	// Check if mount point is active
-	output, err := execCommandBlock("mountpoint", "-q", mnt).CombinedOutput()
-	if err != nil {
-		return nil //nolint:nilerr
-		// not mounted
+// formatImage writes a new ext4 image of sizeMB at path, holding a copy of
+// the tree under srcDir when it is set.
+func formatImage(path string, sizeMB int, srcDir string) error {
+	opts := ext4.Options{Size: int64(sizeMB) * 1024 * 1024}
+	if srcDir != "" {
+		return ext4.CreateFromDir(path, srcDir, opts)
 	}
-	_ = output
-	if output, err := execCommandBlock("umount", mnt).CombinedOutput(); err != nil {
-		return fmt.Errorf("umount %s: %s: %w", mnt, string(output), err)
-	}
-	return nil
-}
-
-// createSparseFile creates a sparse file of the given size.
-func createSparseFile(path string, sizeBytes int64) error {
-	f, err := osCreateBlock(path)
+	e, err := ext4.Create(path, opts)
 	if err != nil {
 		return err
 	}
-	defer f.Close()
-
-	if err := f.Truncate(sizeBytes); err != nil {
-		return err
-	}
-	return f.Sync()
-}
-
-// clearDirectory removes all contents of a directory without removing the directory itself.
-func clearDirectory(dir string) error {
-	entries, err := os.ReadDir(dir)
-	if err != nil {
-		return err
-	}
-	for _, e := range entries {
-		p := filepath.Join(dir, e.Name())
-		if err := os.RemoveAll(p); err != nil {
-			return err
-		}
-	}
-	return nil
+	return e.Close()
 }
@@ -0,0 +1,169 @@
+package swarmkit
+
+import (
+	"slices"
+	"time"
+
+	"github.com/restuhaqza/swarmcracker/pkg/arch"
+	"github.com/restuhaqza/swarmcracker/pkg/config"
+	zerolog_log "github.com/rs/zerolog/log"
+)
+
+const (
+	defaultImageCleanupInterval  = 24 * time.Hour
+	defaultOrphanCleanupInterval = 5 * time.Minute
+)
+
+// ConfigFrom converts the unified SwarmCracker configuration into the
+// executor configuration. hostname overrides agent.hostname when set, and
+// {arch} in the kernel path becomes the node's architecture.
+func ConfigFrom(cfg *config.Config, hostname string) *Config {
+	if hostname == "" {
+		hostname = cfg.Agent.Hostname
+	}
+
+	enableCgroups := true
+	if cfg.Executor.Jailer.EnableCgroups != nil {
+		enableCgroups = *cfg.Executor.Jailer.EnableCgroups
+	}
+
+	deflateOnOOM := true
+	if cfg.Executor.Balloon.DeflateOnOOM != nil {
+		deflateOnOOM = *cfg.Executor.Balloon.DeflateOnOOM
+	}
+
+	return &Config{
+		FirecrackerPath:  cfg.Executor.FirecrackerPath,
+		KernelPath:       arch.Default().ExpandPath(cfg.Executor.KernelPath),
+		RootfsDir:        cfg.Executor.RootfsDir,
+		SocketDir:        cfg.Executor.SocketDir,
+		DefaultVCPUs:     cfg.Executor.DefaultVCPUs,
+		DefaultMemoryMB:  cfg.Executor.DefaultMemoryMB,
+		BridgeName:       cfg.Network.BridgeName,
+		Subnet:           cfg.Network.Subnet,
+		BridgeIP:         cfg.Network.BridgeIP,
+		IPMode:           cfg.Network.IPMode,
+		NATEnabled:       cfg.Network.NATEnabled,
+		VXLANEnabled:     cfg.Network.VXLANEnabled,
+		VXLANPeers:       cfg.Network.VXLANStaticPeers,
+		Debug:            cfg.Logging.Level == "debug" || cfg.Logging.Level == "trace",
+		MaxImageAgeDays:  cfg.Cleanup.MaxImageAgeDays,
+		StateDir:         cfg.Agent.StateDir,
+		EnableRateLimit:  cfg.Network.EnableRateLimit,
+		MaxPacketsPerSec: cfg.Network.MaxPacketsPerSec,
+
+		EnableBalloon:        cfg.Executor.Balloon.Enabled,
+		BalloonDeflateOnOOM:  deflateOnOOM,
+		BalloonStatsInterval: cfg.Executor.Balloon.StatsInterval.ToDuration(),
+
+		EnableMMDS:         cfg.Executor.MMDS.Enabled,
+		MMDSIncludeSecrets: cfg.Executor.MMDS.IncludeSecrets,
+		MMDSIncludeConfigs: cfg.Executor.MMDS.IncludeConfigs,
+
+		CPUTemplate:         cfg.Executor.CPU.Template,
+		CustomCPUTemplates:  cfg.Executor.CPU.CustomTemplates,
+		CPUPinning:          cfg.Executor.CPU.Pinning,
+		PinningReservedCPUs: cfg.Executor.CPU.Reserved,
+
+		HugePages:     cfg.Executor.HugePages,
+		KernelCatalog: cfg.Executor.KernelCatalog,
+		VMOverheadMB:  cfg.Executor.VMOverheadMB,
+		MaxVMs:        cfg.Executor.MaxVMs,
+
+		WarmPool:              cfg.Executor.WarmPool.Enabled,
+		WarmPoolDir:           cfg.Executor.WarmPool.Dir,
+		WarmPoolSizes:         cfg.Executor.WarmPool.Sizes,
+		WarmPoolGoldenTimeout: cfg.Executor.WarmPool.GoldenTimeout.ToDuration(),
+
+		SeccompFilter: cfg.Executor.SeccompFilter,
+
+		ImageCleanupInterval:  cfg.Cleanup.ImageInterval.ToDuration(),
+		OrphanCleanupInterval: cfg.Cleanup.OrphanInterval.ToDuration(),
+
+		EnableJailer:    cfg.Executor.EnableJailer,
+		JailerPath:      cfg.Executor.Jailer.Path,
+		JailerUID:       cfg.Executor.Jailer.UID,
+		JailerGID:       cfg.Executor.Jailer.GID,
+		JailerChrootDir: cfg.Executor.Jailer.ChrootBaseDir,
+		ParentCgroup:    cfg.Executor.Jailer.ParentCgroup,
+		CgroupVersion:   cfg.Executor.Jailer.CgroupVersion,
+		EnableCgroups:   enableCgroups,
+
+		Hostname:      hostname,
+		JoinAddr:      cfg.Agent.JoinAddr,
+		AdvertiseAddr: cfg.Agent.AdvertiseRemoteAPI,
+		ConsulEnabled: cfg.Agent.Consul.Enabled,
+		ConsulAddress: cfg.Agent.Consul.Address,
+	}
+}
+
+// RuntimeSettings are the executor settings that can change without
+// restarting the agent or its VMs.
+type RuntimeSettings struct {
+	EnableRateLimit       bool
+	MaxPacketsPerSec      int
+	VXLANPeers            []string
+	ImageCleanupInterval  time.Duration
+	OrphanCleanupInterval time.Duration
+	MaxImageAgeDays       int
+}
+
+// RuntimeSettingsFrom extracts the reloadable settings of a configuration.
+func RuntimeSettingsFrom(cfg *config.Config) RuntimeSettings {
+	return RuntimeSettings{
+		EnableRateLimit:       cfg.Network.EnableRateLimit,
+		MaxPacketsPerSec:      cfg.Network.MaxPacketsPerSec,
+		VXLANPeers:            cfg.Network.VXLANStaticPeers,
+		ImageCleanupInterval:  cfg.Cleanup.ImageInterval.ToDuration(),
+		OrphanCleanupInterval: cfg.Cleanup.OrphanInterval.ToDuration(),
+		MaxImageAgeDays:       cfg.Cleanup.MaxImageAgeDays,
+	}
+}
+
+// Reload applies new runtime settings. Running VMs are left alone: rate
+// limits apply to VMs started afterwards, VXLAN peers are updated in place
+// and the cleanup tickers are reset.
+func (e *Executor) Reload(settings RuntimeSettings) error {
+	e.configMu.Lock()
+	peersChanged := !slices.Equal(e.config.VXLANPeers, settings.VXLANPeers)
+	e.config.EnableRateLimit = settings.EnableRateLimit
+	e.config.MaxPacketsPerSec = settings.MaxPacketsPerSec
+	e.config.VXLANPeers = settings.VXLANPeers
+	e.config.ImageCleanupInterval = settings.ImageCleanupInterval
+	e.config.OrphanCleanupInterval = settings.OrphanCleanupInterval
+	e.config.MaxImageAgeDays = settings.MaxImageAgeDays
+	vxlanEnabled := e.config.VXLANEnabled
+	e.configMu.Unlock()
+
+	// Wake the cleanup loop without blocking if a reset is already pending
+	select {
+	case e.reloadCh <- struct{}{}:
+	default:
+	}
+
+	if peersChanged && vxlanEnabled && e.networkMgr != nil {
+		if err := e.networkMgr.UpdateVXLANPeers(settings.VXLANPeers); err != nil {
+			return err
+		}
+		zerolog_log.Info().Strs("peers", settings.VXLANPeers).Msg("VXLAN peers reloaded")
+		e.setPeers(settings.VXLANPeers)
+	}
+
+	return nil
+}
+
+// cleanupIntervals returns the image and orphaned VM cleanup intervals.
+func (e *Executor) cleanupIntervals() (image, orphan time.Duration) {
+	e.configMu.RLock()
+	defer e.configMu.RUnlock()
+
+	image = defaultImageCleanupInterval
+	if e.config.ImageCleanupInterval > 0 {
+		image = e.config.ImageCleanupInterval
+	}
+	orphan = defaultOrphanCleanupInterval
+	if e.config.OrphanCleanupInterval > 0 {
+		orphan = e.config.OrphanCleanupInterval
+	}
+	return image, orphan
+}
@@ -0,0 +1,134 @@
+package swarmkit
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/restuhaqza/swarmcracker/pkg/config"
+	"github.com/restuhaqza/swarmcracker/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfigFrom(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Logging.Level = "debug"
+	cfg.Network.MaxPacketsPerSec = 5000
+	cfg.Agent.Hostname = "from-config"
+	disabled := false
+	cfg.Executor.Jailer.EnableCgroups = &disabled
+	cfg.Executor.MMDS.IncludeSecrets = true
+	cfg.Executor.HugePages = "2M"
+	cfg.Executor.WarmPool.Sizes = map[string]int{"nginx:alpine": 2}
+	cfg.Executor.SeccompFilter = "default"
+	cfg.SetDefaults()
+
+	c := ConfigFrom(cfg, "")
+	assert.Equal(t, "from-config", c.Hostname)
+	assert.True(t, c.Debug)
+	assert.False(t, c.EnableCgroups)
+	assert.Equal(t, 5000, c.MaxPacketsPerSec)
+	assert.Equal(t, "/var/lib/swarmkit", c.StateDir)
+	assert.Equal(t, "/usr/local/bin/jailer", c.JailerPath)
+	assert.Equal(t, 24*time.Hour, c.ImageCleanupInterval)
+	assert.False(t, c.EnableMMDS)
+	assert.True(t, c.MMDSIncludeSecrets)
+	assert.Equal(t, "0", c.PinningReservedCPUs)
+	assert.Equal(t, "2M", c.HugePages)
+	assert.Equal(t, "/var/lib/firecracker/kernels/catalog.yaml", c.KernelCatalog)
+	assert.False(t, c.WarmPool)
+	assert.Equal(t, "/var/lib/firecracker/warmpool", c.WarmPoolDir)
+	assert.Equal(t, map[string]int{"nginx:alpine": 2}, c.WarmPoolSizes)
+	assert.Equal(t, time.Minute, c.WarmPoolGoldenTimeout)
+	assert.Equal(t, "default", c.SeccompFilter)
+
+	assert.Equal(t, "override", ConfigFrom(cfg, "override").Hostname)
+}
+
+func TestExecutor_Reload(t *testing.T) {
+	var gotPeers []string
+	exec := &Executor{
+		config:   &Config{VXLANEnabled: true, VXLANPeers: []string{"10.0.0.2"}},
+		reloadCh: make(chan struct{}, 1),
+		networkMgr: &MockNetworkManager{UpdateVXLANPeersFunc: func(peers []string) error {
+			gotPeers = peers
+			return nil
+		}},
+	}
+
+	image, orphan := exec.cleanupIntervals()
+	assert.Equal(t, defaultImageCleanupInterval, image)
+	assert.Equal(t, defaultOrphanCleanupInterval, orphan)
+
+	require.NoError(t, exec.Reload(RuntimeSettings{
+		EnableRateLimit:       true,
+		MaxPacketsPerSec:      1000,
+		VXLANPeers:            []string{"10.0.0.3"},
+		ImageCleanupInterval:  time.Hour,
+		OrphanCleanupInterval: time.Minute,
+		MaxImageAgeDays:       3,
+	}))
+
+	assert.Equal(t, []string{"10.0.0.3"}, gotPeers)
+	assert.Equal(t, []string{"10.0.0.3"}, exec.peers)
+	assert.Equal(t, 1000, exec.config.MaxPacketsPerSec)
+	assert.Equal(t, 3, exec.config.MaxImageAgeDays)
+	image, orphan = exec.cleanupIntervals()
+	assert.Equal(t, time.Hour, image)
+	assert.Equal(t, time.Minute, orphan)
+	assert.Len(t, exec.reloadCh, 1)
+
+	// A second reload does not block on the pending signal, and unchanged
+	// peers are not pushed again
+	gotPeers = nil
+	require.NoError(t, exec.Reload(RuntimeSettings{VXLANPeers: []string{"10.0.0.3"}}))
+	assert.Nil(t, gotPeers)
+
+	exec.networkMgr = &MockNetworkManager{UpdateVXLANPeersFunc: func([]string) error {
+		return errors.New("boom")
+	}}
+	assert.Error(t, exec.Reload(RuntimeSettings{VXLANPeers: []string{"10.0.0.4"}}))
+}
+
+func TestTranslator_PacketRateLimit(t *testing.T) {
+	task := &types.Task{
+		ID: "task-1",
+		Networks: []types.NetworkAttachment{
+			{Network: types.Network{ID: "net-1"}},
+		},
+	}
+
+	tr, err := newConfiguredTranslator(&Config{KernelPath: "/vmlinux", EnableRateLimit: true, MaxPacketsPerSec: 2000})
+	require.NoError(t, err)
+	ifaces := tr.buildNetworkInterfaces(task)
+	require.Len(t, ifaces, 1)
+	want := map[string]interface{}{
+		"ops": map[string]interface{}{"size": 2000, "refill_time": 1000},
+	}
+	assert.Equal(t, want, ifaces[0]["rx_rate_limiter"])
+	assert.Equal(t, want, ifaces[0]["tx_rate_limiter"])
+
+	tr, err = newConfiguredTranslator(&Config{KernelPath: "/vmlinux", MaxPacketsPerSec: 2000})
+	require.NoError(t, err)
+	ifaces = tr.buildNetworkInterfaces(task)
+	assert.NotContains(t, ifaces[0], "rx_rate_limiter")
+}
+
+func TestTranslator_FirecrackerOutputs(t *testing.T) {
+	tr, err := newConfiguredTranslator(&Config{KernelPath: "/vmlinux", SocketDir: "/run/fc"})
+	require.NoError(t, err)
+
+	out, err := tr.Translate(&types.Task{ID: "task-1"})
+	require.NoError(t, err)
+	cfg := out.(map[string]interface{})
+	assert.Equal(t, map[string]interface{}{"log_path": "/run/fc/task-1.log", "level": "Info"}, cfg["logger"])
+	assert.Equal(t, map[string]interface{}{"metrics_path": "/run/fc/task-1.metrics"}, cfg["metrics"])
+
+	// Without a socket directory Firecracker's outputs stay unconfigured
+	tr, err = newConfiguredTranslator(&Config{KernelPath: "/vmlinux"})
+	require.NoError(t, err)
+	out, err = tr.Translate(&types.Task{ID: "task-1"})
+	require.NoError(t, err)
+	assert.NotContains(t, out, "metrics")
+}
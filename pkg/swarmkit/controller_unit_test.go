@@ -2,15 +2,36 @@ package swarmkit
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
 	"os/exec"
+	"path/filepath"
 	"sync"
 	"testing"
+	"time"
 
+	gogotypes "github.com/gogo/protobuf/types"
+	swarmkit_configs "github.com/moby/swarmkit/v2/agent/configs"
+	swarmkit_secrets "github.com/moby/swarmkit/v2/agent/secrets"
 	"github.com/moby/swarmkit/v2/api"
+	"github.com/restuhaqza/swarmcracker/pkg/events"
+	"github.com/restuhaqza/swarmcracker/pkg/healthcheck"
+	"github.com/restuhaqza/swarmcracker/pkg/metrics"
+	"github.com/restuhaqza/swarmcracker/pkg/mmds"
+	"github.com/restuhaqza/swarmcracker/pkg/tracing"
 	"github.com/restuhaqza/swarmcracker/pkg/types"
+	"github.com/restuhaqza/swarmcracker/pkg/vmexit"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace/noop"
 )
 
 // TestController_Prepare tests the Prepare method with mocks
@@ -235,11 +256,12 @@ func TestController_Terminate(t *testing.T) {
 		mockVMMMgr := &mockVMMManagerSuccess{}
 
 		ctrl := &Controller{
-			task:    &api.Task{ID: "task-term-2"},
-			config:  &Config{},
-			vmmMgr:  mockVMMMgr,
-			mu:      sync.Mutex{},
-			started: true,
+			task:       &api.Task{ID: "task-term-2"},
+			config:     &Config{},
+			vmmMgr:     mockVMMMgr,
+			networkMgr: &MockNetworkManager{},
+			mu:         sync.Mutex{},
+			started:    true,
 		}
 
 		ctx := context.Background()
@@ -302,6 +324,27 @@ func TestController_Wait(t *testing.T) {
 		err := ctrl.Wait(ctx)
 		assert.Error(t, err)
 	})
+
+	t.Run("wait reports the exit code", func(t *testing.T) {
+		exitErr := &ExitError{Code: 3, Err: errors.New("workload exited with status 3")}
+		ctrl := &Controller{
+			task:    &api.Task{ID: "task-wait-3"},
+			config:  &Config{},
+			started: true,
+			vmmMgr: &MockVMMManager{WaitFunc: func(context.Context, *types.Task) (*types.TaskStatus, error) {
+				return &types.TaskStatus{State: types.TaskStateFailed, Err: exitErr, Message: exitErr.Error(), ExitCode: 3}, nil
+			}},
+		}
+
+		err := ctrl.Wait(context.Background())
+		var coder interface{ ExitCode() int }
+		require.ErrorAs(t, err, &coder)
+		assert.Equal(t, 3, coder.ExitCode())
+
+		status, err := ctrl.ContainerStatus(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, int32(3), status.ExitCode)
+	})
 }
 
 // TestExecutor_Controller_New tests creating new controllers
@@ -374,9 +417,11 @@ func TestController_ConvertTask(t *testing.T) {
 	t.Run("convert with container spec", func(t *testing.T) {
 		ctrl := &Controller{
 			task: &api.Task{
-				ID:        "task-convert-1",
-				ServiceID: "service-1",
-				NodeID:    "node-1",
+				ID:                 "task-convert-1",
+				ServiceID:          "service-1",
+				NodeID:             "node-1",
+				Slot:               3,
+				ServiceAnnotations: api.Annotations{Name: "web"},
 				Spec: api.TaskSpec{
 					Runtime: &api.TaskSpec_Container{
 						Container: &api.ContainerSpec{
@@ -410,6 +455,8 @@ func TestController_ConvertTask(t *testing.T) {
 		assert.Equal(t, "task-convert-1", task.ID)
 		assert.Equal(t, "service-1", task.ServiceID)
 		assert.Equal(t, "node-1", task.NodeID)
+		assert.Equal(t, "web", task.ServiceName)
+		assert.Equal(t, uint64(3), task.Slot)
 
 		container, ok := task.Spec.Runtime.(*types.Container)
 		assert.True(t, ok)
@@ -578,3 +625,491 @@ func (m *mockVMMManagerError) GetRunningProcesses() map[string]*exec.Cmd {
 }
 
 func (m *mockVMMManagerError) RemoveProcess(taskID string) {}
+
+// TestController_Metrics tests that prepare and boot timings are exported
+func TestController_Metrics(t *testing.T) {
+	exporter := metrics.NewExporter("node-1")
+	trans, err := newConfiguredTranslator(&Config{KernelPath: "/vmlinux", SocketDir: t.TempDir()})
+	require.NoError(t, err)
+
+	ctrl := &Controller{
+		task: &api.Task{
+			ID:                 "task-metrics-1",
+			ServiceAnnotations: api.Annotations{Name: "web"},
+			Spec: api.TaskSpec{
+				Runtime: &api.TaskSpec_Container{Container: &api.ContainerSpec{Image: "nginx"}},
+			},
+		},
+		config:     &Config{RootfsDir: "/tmp"},
+		imagePrep:  &mockImagePrepSuccess{},
+		networkMgr: &mockNetworkManagerFull{},
+		vmmMgr:     &mockVMMManagerError{startErr: errors.New("boot failed")},
+		trans:      trans,
+		metrics:    exporter,
+	}
+
+	ctx := context.Background()
+	require.NoError(t, ctrl.Prepare(ctx))
+	require.Error(t, ctrl.Start(ctx))
+
+	ctrl.vmmMgr = &mockVMMManagerSuccess{}
+	require.NoError(t, ctrl.Start(ctx))
+
+	rec := httptest.NewRecorder()
+	exporter.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	out := rec.Body.String()
+	assert.Contains(t, out, `swarmcracker_task_prepare_duration_seconds_count{node="node-1"} 1`)
+	assert.Contains(t, out, `swarmcracker_vm_boot_failures_total{node="node-1"} 1`)
+	assert.Contains(t, out, `swarmcracker_vm_boot_duration_seconds_count{node="node-1"} 1`)
+}
+
+type recordingPublisher struct {
+	mu     sync.Mutex
+	events []events.Event
+}
+
+func (r *recordingPublisher) Publish(e events.Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, e)
+}
+
+func (r *recordingPublisher) types() []events.Type {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var out []events.Type
+	for _, e := range r.events {
+		out = append(out, e.Type)
+	}
+	return out
+}
+
+func (r *recordingPublisher) last() events.Event {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.events[len(r.events)-1]
+}
+
+func TestController_Events(t *testing.T) {
+	trans, err := newConfiguredTranslator(&Config{KernelPath: "/vmlinux"})
+	require.NoError(t, err)
+
+	newCtrl := func(vmm VMMManagerInterface) (*Controller, *recordingPublisher) {
+		rec := &recordingPublisher{}
+		return &Controller{
+			task: &api.Task{
+				ID:                 "task-events-1",
+				ServiceID:          "svc-1",
+				ServiceAnnotations: api.Annotations{Name: "web"},
+				Spec: api.TaskSpec{
+					Runtime: &api.TaskSpec_Container{Container: &api.ContainerSpec{Image: "nginx"}},
+				},
+				Networks: []*api.NetworkAttachment{{Network: &api.Network{ID: "net-1"}}},
+			},
+			config:     &Config{RootfsDir: "/tmp"},
+			imagePrep:  &mockImagePrepSuccess{},
+			networkMgr: &mockNetworkManagerFull{},
+			vmmMgr:     vmm,
+			trans:      trans,
+			events:     rec,
+		}, rec
+	}
+	waitHealthy := func(rec *recordingPublisher) {
+		require.Eventually(t, func() bool {
+			for _, typ := range rec.types() {
+				if typ == events.VMHealthy {
+					return true
+				}
+			}
+			return false
+		}, 5*time.Second, 10*time.Millisecond)
+	}
+	ctx := context.Background()
+
+	t.Run("boot and shutdown", func(t *testing.T) {
+		ctrl, rec := newCtrl(&MockVMMManager{})
+		require.NoError(t, ctrl.Prepare(ctx))
+		require.NoError(t, ctrl.Start(ctx))
+		waitHealthy(rec)
+		require.NoError(t, ctrl.Shutdown(ctx))
+
+		// The exit after a requested stop is not reported again
+		require.NoError(t, ctrl.Wait(ctx))
+
+		assert.Equal(t, []events.Type{events.NetworkAttach, events.VMBoot, events.VMHealthy, events.VMStop}, rec.types())
+		assert.Equal(t, "web", rec.last().Service)
+		assert.Equal(t, "svc-1", rec.last().ServiceID)
+	})
+
+	t.Run("crash", func(t *testing.T) {
+		ctrl, rec := newCtrl(&MockVMMManager{WaitFunc: func(context.Context, *types.Task) (*types.TaskStatus, error) {
+			return &types.TaskStatus{State: types.TaskStateFailed, Err: errors.New("exit status 1"), Message: "exit status 1"}, nil
+		}})
+		require.NoError(t, ctrl.Prepare(ctx))
+		require.NoError(t, ctrl.Start(ctx))
+		waitHealthy(rec)
+		require.Error(t, ctrl.Wait(ctx))
+
+		e := rec.last()
+		assert.Equal(t, events.VMCrash, e.Type)
+		assert.Equal(t, "exit status 1", e.Attributes["exit_reason"])
+	})
+
+	t.Run("oom", func(t *testing.T) {
+		oomErr := fmt.Errorf("%w: signal: killed", ErrOOMKilled)
+		ctrl, rec := newCtrl(&MockVMMManager{WaitFunc: func(context.Context, *types.Task) (*types.TaskStatus, error) {
+			return &types.TaskStatus{State: types.TaskStateFailed, Err: oomErr, Message: oomErr.Error()}, nil
+		}})
+		require.Error(t, ctrl.Wait(ctx))
+		assert.Equal(t, events.VMOOM, rec.last().Type)
+	})
+
+	t.Run("guest oom", func(t *testing.T) {
+		oomErr := &ExitError{Code: 137, Err: ErrGuestOOMKilled}
+		ctrl, rec := newCtrl(&MockVMMManager{WaitFunc: func(context.Context, *types.Task) (*types.TaskStatus, error) {
+			return &types.TaskStatus{State: types.TaskStateFailed, Err: oomErr, Message: oomErr.Error(), ExitCode: 137}, nil
+		}})
+		require.Error(t, ctrl.Wait(ctx))
+		assert.Equal(t, events.VMOOM, rec.last().Type)
+	})
+
+	t.Run("boot failure", func(t *testing.T) {
+		ctrl, rec := newCtrl(&MockVMMManager{StartFunc: func(context.Context, *types.Task, interface{}) error {
+			return errors.New("boot failed")
+		}})
+		require.NoError(t, ctrl.Prepare(ctx))
+		require.Error(t, ctrl.Start(ctx))
+
+		e := rec.last()
+		assert.Equal(t, events.VMBoot, e.Type)
+		assert.Equal(t, "boot failed", e.Error)
+	})
+}
+
+// TestController_HealthyEvent verifies that the healthy event waits for the
+// guest to come up rather than for the Firecracker API
+func TestController_HealthyEvent(t *testing.T) {
+	oldInterval := healthyPollInterval
+	healthyPollInterval = time.Millisecond
+	defer func() { healthyPollInterval = oldInterval }()
+
+	watch := func(hc *types.HealthConfig, statuses ...vmexit.Status) (*recordingPublisher, int) {
+		polls := 0
+		vmm := &MockVMMManager{
+			CheckVMAPIHealthFunc: func(context.Context, string) bool { return true },
+			GuestStatusFunc: func(string) vmexit.Status {
+				status := statuses[min(polls, len(statuses)-1)]
+				polls++
+				return status
+			},
+		}
+		rec := &recordingPublisher{}
+		ctrl := &Controller{vmmMgr: vmm, events: rec}
+		task := &types.Task{
+			ID: "task-healthy-1",
+			Spec: types.TaskSpec{
+				Runtime: &types.Container{Image: "nginx", Healthcheck: hc},
+			},
+		}
+		ctrl.watchHealthy(task, time.Now())
+		return rec, polls
+	}
+	curl := &types.HealthConfig{Test: []string{"CMD-SHELL", "curl -f localhost"}, Interval: time.Second}
+
+	t.Run("userspace ready", func(t *testing.T) {
+		rec, polls := watch(nil, vmexit.Status{}, vmexit.Status{}, vmexit.Status{Ready: true})
+		assert.Equal(t, []events.Type{events.VMHealthy}, rec.types())
+		assert.Equal(t, 3, polls, "published before the guest was up")
+		assert.NotEmpty(t, rec.last().Attributes["after"])
+	})
+
+	t.Run("healthcheck passes", func(t *testing.T) {
+		rec, polls := watch(curl, vmexit.Status{Ready: true}, vmexit.Status{Ready: true, Health: healthcheck.Healthy})
+		assert.Equal(t, []events.Type{events.VMHealthy}, rec.types())
+		assert.Equal(t, 2, polls, "published before the healthcheck passed")
+	})
+
+	t.Run("workload exits first", func(t *testing.T) {
+		rec, _ := watch(nil, vmexit.Status{}, vmexit.Status{Reported: true, Code: 1})
+		assert.Empty(t, rec.types())
+	})
+
+	t.Run("kernel panic", func(t *testing.T) {
+		rec, _ := watch(curl, vmexit.Status{Panic: "VFS: Unable to mount root fs"})
+		assert.Empty(t, rec.types())
+	})
+}
+
+// TestController_Tracing verifies the launch span tree and that the trace is
+// handed to the guest on the kernel command line
+func TestController_Tracing(t *testing.T) {
+	rec := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec)))
+	defer otel.SetTracerProvider(noop.NewTracerProvider())
+
+	trans, err := newConfiguredTranslator(&Config{KernelPath: "/vmlinux"})
+	require.NoError(t, err)
+
+	var bootArgs string
+	vmm := &MockVMMManager{
+		StartFunc: func(ctx context.Context, task *types.Task, config interface{}) error {
+			bootArgs = config.(map[string]interface{})["boot-source"].(map[string]interface{})["boot_args"].(string)
+			return nil
+		},
+	}
+	ctrl := &Controller{
+		task: &api.Task{
+			ID:                 "task-trace-1",
+			ServiceID:          "svc-1",
+			ServiceAnnotations: api.Annotations{Name: "web"},
+			Spec: api.TaskSpec{
+				Runtime: &api.TaskSpec_Container{Container: &api.ContainerSpec{Image: "nginx"}},
+			},
+		},
+		config:     &Config{RootfsDir: "/tmp"},
+		imagePrep:  &mockImagePrepSuccess{},
+		networkMgr: &mockNetworkManagerFull{},
+		vmmMgr:     vmm,
+		trans:      trans,
+	}
+
+	ctx := context.Background()
+	require.NoError(t, ctrl.Prepare(ctx))
+	require.NoError(t, ctrl.Start(ctx))
+
+	spans := map[string]sdktrace.ReadOnlySpan{}
+	for _, s := range rec.Ended() {
+		spans[s.Name()] = s
+	}
+	launch, ok := spans["task.launch"]
+	require.True(t, ok, "launch span not ended by Start")
+	for _, name := range []string{"task.prepare", "network.prepare", "task.start", "task.translate"} {
+		s, ok := spans[name]
+		require.True(t, ok, "missing span %s", name)
+		assert.Equal(t, launch.SpanContext().TraceID(), s.SpanContext().TraceID(), name)
+	}
+	assert.Contains(t, launch.Attributes(), attribute.String("service.name", "web"))
+
+	traceID := launch.SpanContext().TraceID().String()
+	assert.Contains(t, bootArgs, tracing.BootArg+"=00-"+traceID+"-")
+}
+
+// TestController_Metadata verifies the guest's metadata follows peer and
+// label changes while the task runs
+func TestController_Metadata(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "task-mmds-1.sock")
+	listener, err := net.Listen("unix", socketPath)
+	require.NoError(t, err)
+
+	var mu sync.Mutex
+	var puts []mmds.Document
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var contents map[string]mmds.Document
+		json.NewDecoder(r.Body).Decode(&contents)
+		mu.Lock()
+		puts = append(puts, contents[mmds.Key])
+		mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	})}
+	go server.Serve(listener)
+	defer server.Close()
+
+	trans, err := newConfiguredTranslator(&Config{KernelPath: "/vmlinux", EnableMMDS: true, VXLANPeers: []string{"10.0.0.2"}})
+	require.NoError(t, err)
+
+	task := &api.Task{
+		ID:                 "task-mmds-1",
+		ServiceAnnotations: api.Annotations{Name: "web", Labels: map[string]string{"tier": "frontend"}},
+		Spec: api.TaskSpec{
+			Runtime: &api.TaskSpec_Container{Container: &api.ContainerSpec{Image: "nginx"}},
+		},
+		Networks: []*api.NetworkAttachment{{
+			Network:   &api.Network{ID: "net-1"},
+			Addresses: []string{"192.168.127.7/24"},
+		}},
+	}
+	ctrl := &Controller{
+		task:       task,
+		config:     &Config{RootfsDir: "/tmp"},
+		imagePrep:  &mockImagePrepSuccess{},
+		networkMgr: &mockNetworkManagerFull{},
+		vmmMgr:     &MockVMMManager{},
+		trans:      trans,
+		socketPath: socketPath,
+	}
+
+	ctx := context.Background()
+	require.NoError(t, ctrl.Prepare(ctx))
+	require.NoError(t, ctrl.Start(ctx))
+	require.NotNil(t, ctrl.metadata)
+	assert.Equal(t, []string{"10.0.0.2"}, ctrl.metadata.Node.Peers)
+
+	e := &Executor{config: &Config{KernelPath: "/vmlinux"}, controllers: map[string]*Controller{task.ID: ctrl}}
+	e.setPeers([]string{"10.0.0.2", "10.0.0.3"})
+
+	updated := *task
+	updated.ServiceAnnotations = api.Annotations{Name: "web", Labels: map[string]string{"tier": "backend"}}
+	require.NoError(t, ctrl.Update(ctx, &updated))
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Len(t, puts, 2)
+	assert.Equal(t, []string{"10.0.0.2", "10.0.0.3"}, puts[0].Node.Peers)
+	assert.Equal(t, map[string]string{"tier": "frontend"}, puts[0].Service.Labels)
+	assert.Equal(t, []string{"10.0.0.2", "10.0.0.3"}, puts[1].Node.Peers)
+	assert.Equal(t, map[string]string{"tier": "backend"}, puts[1].Service.Labels)
+
+	// New controllers see the current peers
+	e.peers = []string{"10.0.0.4"}
+	next, err := e.Controller(&api.Task{ID: "task-mmds-2"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"10.0.0.4"}, next.(*Controller).config.VXLANPeers)
+}
+
+// TestController_SecretPayloads verifies secret and config payloads come
+// from the stores the agent fills
+func TestController_SecretPayloads(t *testing.T) {
+	task := &api.Task{
+		ID: "task-secrets-1",
+		Spec: api.TaskSpec{
+			Runtime: &api.TaskSpec_Container{Container: &api.ContainerSpec{
+				Image:   "nginx",
+				Secrets: []*api.SecretReference{{SecretID: "s1", SecretName: "db_password"}, {SecretID: "s2", SecretName: "missing"}},
+				Configs: []*api.ConfigReference{{ConfigID: "c1", ConfigName: "app"}},
+			}},
+		},
+	}
+
+	e := &Executor{
+		config:      &Config{KernelPath: "/vmlinux"},
+		controllers: map[string]*Controller{},
+		secrets:     swarmkit_secrets.NewManager(),
+		configs:     swarmkit_configs.NewManager(),
+	}
+	e.Secrets().Add(
+		api.Secret{ID: "s1", Spec: api.SecretSpec{Data: []byte("hunter2")}},
+		api.Secret{ID: "s3", Spec: api.SecretSpec{Data: []byte("not for this task")}},
+	)
+	e.Configs().Add(api.Config{ID: "c1", Spec: api.ConfigSpec{Data: []byte("debug: true")}})
+
+	ctrl, err := e.Controller(task)
+	require.NoError(t, err)
+	converted := ctrl.(*Controller).convertTask()
+
+	require.Len(t, converted.Secrets, 2)
+	assert.Equal(t, []byte("hunter2"), converted.Secrets[0].Data)
+	assert.Nil(t, converted.Secrets[1].Data)
+	require.Len(t, converted.Configs, 1)
+	assert.Equal(t, []byte("debug: true"), converted.Configs[0].Data)
+
+	// Controllers without stores leave payloads empty
+	bare := &Controller{task: task}
+	assert.Nil(t, bare.convertTask().Secrets[0].Data)
+
+	// Prepare refuses tasks whose payloads were not delivered
+	err = ctrl.Prepare(context.Background())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "secret missing is not available")
+	assert.Error(t, bare.checkPayloads(bare.convertTask()))
+
+	e.Secrets().Add(api.Secret{ID: "s2", Spec: api.SecretSpec{Data: []byte("found")}})
+	assert.NoError(t, ctrl.(*Controller).checkPayloads(ctrl.(*Controller).convertTask()))
+}
+
+// TestController_StartWaitsForHealthyGuest verifies that a task with a
+// healthcheck is only started once its guest reports healthy
+func TestController_StartWaitsForHealthyGuest(t *testing.T) {
+	oldInterval := healthyPollInterval
+	healthyPollInterval = time.Millisecond
+	defer func() { healthyPollInterval = oldInterval }()
+
+	trans, err := newConfiguredTranslator(&Config{KernelPath: "/vmlinux"})
+	require.NoError(t, err)
+
+	newCtrl := func(hc *api.HealthConfig, statuses ...vmexit.Status) (*Controller, *MockVMMManager, *int) {
+		polls := 0
+		stops := 0
+		vmm := &MockVMMManager{
+			GuestStatusFunc: func(string) vmexit.Status {
+				status := statuses[min(polls, len(statuses)-1)]
+				polls++
+				return status
+			},
+			StopFunc: func(context.Context, *types.Task) error {
+				stops++
+				return nil
+			},
+		}
+		ctrl := &Controller{
+			task: &api.Task{
+				ID: "task-health-1",
+				Spec: api.TaskSpec{
+					Runtime: &api.TaskSpec_Container{Container: &api.ContainerSpec{Image: "nginx", Healthcheck: hc}},
+				},
+			},
+			config:     &Config{RootfsDir: "/tmp"},
+			imagePrep:  &mockImagePrepSuccess{},
+			networkMgr: &mockNetworkManagerFull{},
+			vmmMgr:     vmm,
+			trans:      trans,
+		}
+		return ctrl, vmm, &stops
+	}
+	curl := &api.HealthConfig{Test: []string{"CMD-SHELL", "curl -f localhost"}, Interval: gogotypes.DurationProto(time.Second)}
+	ctx := context.Background()
+
+	t.Run("becomes healthy", func(t *testing.T) {
+		ctrl, _, stops := newCtrl(curl, vmexit.Status{}, vmexit.Status{}, vmexit.Status{Health: healthcheck.Healthy})
+		require.NoError(t, ctrl.Prepare(ctx))
+		require.NoError(t, ctrl.Start(ctx))
+		assert.True(t, ctrl.started)
+		assert.Zero(t, *stops)
+	})
+
+	t.Run("unhealthy", func(t *testing.T) {
+		ctrl, _, stops := newCtrl(curl, vmexit.Status{}, vmexit.Status{Health: healthcheck.Unhealthy})
+		cleanups := 0
+		ctrl.networkMgr = &MockNetworkManager{CleanupNetworkFunc: func(context.Context, *types.Task) error {
+			cleanups++
+			return nil
+		}}
+		require.NoError(t, ctrl.Prepare(ctx))
+		err := ctrl.Start(ctx)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "healthcheck failed")
+		assert.False(t, ctrl.started, "the VM is stopped")
+		assert.Equal(t, 1, *stops)
+		assert.Equal(t, 1, cleanups, "the VM's network is released")
+	})
+
+	t.Run("workload exits first", func(t *testing.T) {
+		ctrl, _, _ := newCtrl(curl, vmexit.Status{Reported: true, Code: 2})
+		require.NoError(t, ctrl.Prepare(ctx))
+		err := ctrl.Start(ctx)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "status 2")
+	})
+
+	t.Run("canceled", func(t *testing.T) {
+		ctrl, _, _ := newCtrl(curl, vmexit.Status{})
+		require.NoError(t, ctrl.Prepare(ctx))
+		cctx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+		defer cancel()
+		assert.ErrorIs(t, ctrl.Start(cctx), context.DeadlineExceeded)
+	})
+
+	for name, hc := range map[string]*api.HealthConfig{
+		"no healthcheck":       nil,
+		"disabled healthcheck": {Test: []string{"NONE"}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			ctrl, vmm, _ := newCtrl(hc, vmexit.Status{})
+			vmm.GuestStatusFunc = func(string) vmexit.Status {
+				t.Error("guest status polled without a healthcheck")
+				return vmexit.Status{}
+			}
+			require.NoError(t, ctrl.Prepare(ctx))
+			require.NoError(t, ctrl.Start(ctx))
+		})
+	}
+}
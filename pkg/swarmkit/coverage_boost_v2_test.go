@@ -14,6 +14,8 @@ import (
 	"testing"
 	"time"
 
+	swarmkit_configs "github.com/moby/swarmkit/v2/agent/configs"
+	swarmkit_secrets "github.com/moby/swarmkit/v2/agent/secrets"
 	"github.com/moby/swarmkit/v2/api"
 	"github.com/restuhaqza/swarmcracker/pkg/storage"
 	"github.com/restuhaqza/swarmcracker/pkg/types"
@@ -266,33 +268,6 @@ func TestController_SyncVolumeData_EmptyRootfsV2(t *testing.T) {
 	assert.NoError(t, err)
 }
 
-// TestController_MountRootfs_Nonexistent tests mountRootfs with nonexistent path
-func TestController_MountRootfs_NonexistentV2(t *testing.T) {
-	ctrl := &Controller{
-		task:   &api.Task{ID: "task-1"},
-		config: &Config{},
-		mu:     sync.Mutex{},
-	}
-	_, err := ctrl.mountRootfs("/nonexistent/path.ext4")
-	assert.Error(t, err)
-}
-
-// TestController_UnmountRootfs tests unmountRootfs cleanup
-func TestController_UnmountRootfsV2(t *testing.T) {
-	tmpDir := t.TempDir()
-	mountDir := filepath.Join(tmpDir, "mount-point")
-	os.MkdirAll(mountDir, 0755)
-	ctrl := &Controller{
-		task:   &api.Task{ID: "task-1"},
-		config: &Config{},
-		mu:     sync.Mutex{},
-	}
-	err := ctrl.unmountRootfs(mountDir)
-	assert.NoError(t, err)
-	_, err = os.Stat(mountDir)
-	assert.True(t, os.IsNotExist(err))
-}
-
 // TestExecutor_NewExecutor_NilConfig tests NewExecutor with nil config
 func TestExecutor_NewExecutor_NilConfigV2(t *testing.T) {
 	exec, err := NewExecutor(nil)
@@ -592,6 +567,8 @@ func TestExecutor_runCleanupV2(t *testing.T) {
 
 // TestController_Prepare_WithSecrets tests Prepare with secret references
 func TestController_Prepare_WithSecretsV2(t *testing.T) {
+	secrets := swarmkit_secrets.NewManager()
+	secrets.Add(api.Secret{ID: "secret-1", Spec: api.SecretSpec{Data: []byte("s3cr3t")}})
 	ctrl := &Controller{
 		task: &api.Task{
 			ID: "task-secrets",
@@ -612,6 +589,7 @@ func TestController_Prepare_WithSecretsV2(t *testing.T) {
 				},
 			},
 		},
+		secrets:    secrets,
 		config:     &Config{},
 		imagePrep:  &MockImagePreparer{},
 		networkMgr: &MockNetworkManager{},
@@ -623,6 +601,8 @@ func TestController_Prepare_WithSecretsV2(t *testing.T) {
 
 // TestController_Prepare_WithConfigs tests Prepare with config references
 func TestController_Prepare_WithConfigsV2(t *testing.T) {
+	configs := swarmkit_configs.NewManager()
+	configs.Add(api.Config{ID: "config-1", Spec: api.ConfigSpec{Data: []byte("debug: true")}})
 	ctrl := &Controller{
 		task: &api.Task{
 			ID: "task-configs",
@@ -643,6 +623,7 @@ func TestController_Prepare_WithConfigsV2(t *testing.T) {
 				},
 			},
 		},
+		configs:    configs,
 		config:     &Config{},
 		imagePrep:  &MockImagePreparer{},
 		networkMgr: &MockNetworkManager{},
@@ -1336,7 +1317,8 @@ func TestController_Terminate_WithVMMError(t *testing.T) {
 				return errors.New("force stop error")
 			},
 		},
-		started: true,
+		networkMgr: &MockNetworkManager{},
+		started:    true,
 	}
 	err := ctrl.Terminate(context.Background())
 	assert.NoError(t, err) // Terminate doesn't return error
@@ -1406,7 +1388,8 @@ func TestController_Remove_WithVMMRemoveError(t *testing.T) {
 // TestController_Remove_WithRootfsCleanup tests Remove with rootfs cleanup
 func TestController_Remove_WithRootfsCleanup(t *testing.T) {
 	tmpDir := t.TempDir()
-	rootfsPath := filepath.Join(tmpDir, "task-rootfs.ext4")
+	rootfsPath := filepath.Join(tmpDir, "tasks", "task-rootfs.ext4")
+	os.MkdirAll(filepath.Dir(rootfsPath), 0755)
 	os.WriteFile(rootfsPath, []byte("fake rootfs"), 0644)
 	ctrl := &Controller{
 		task:       &api.Task{ID: "task-rootfs"},
@@ -134,8 +134,8 @@ func TestSyncVolumeData_MultipleMounts(t *testing.T) {
 	assert.NoError(t, err)
 }
 
-// TestSyncVolumeData_MountRootfsError tests mountRootfs returning error
-func TestSyncVolumeData_MountRootfsError(t *testing.T) {
+// TestSyncVolumeData_OpenRootfsError tests a rootfs image that cannot be opened
+func TestSyncVolumeData_OpenRootfsError(t *testing.T) {
 	ctrl := &Controller{
 		task:      &api.Task{ID: "task-6"},
 		config:    &Config{},
@@ -155,6 +155,30 @@ func TestSyncVolumeData_MountRootfsError(t *testing.T) {
 	assert.NoError(t, err)
 }
 
+// TestSyncVolumeData_UnreadableRootfs tests that a rootfs which exists but
+// cannot be read fails the sync instead of dropping the volume data
+func TestSyncVolumeData_UnreadableRootfs(t *testing.T) {
+	ctrl := &Controller{
+		task:      &api.Task{ID: "task-7"},
+		config:    &Config{},
+		volumeMgr: nil,
+		mu:        sync.Mutex{},
+		logger:    zerolog.Nop(),
+	}
+
+	rootfs := filepath.Join(t.TempDir(), "rootfs.ext4")
+	require.NoError(t, os.WriteFile(rootfs, make([]byte, 8192), 0644))
+	task := &types.Task{
+		Annotations: map[string]string{"rootfs": rootfs},
+	}
+	mounts := []types.Mount{
+		{Source: "volume://test-vol", Target: "/data", ReadOnly: false},
+	}
+
+	err := ctrl.syncVolumeData(context.Background(), task, mounts)
+	assert.ErrorContains(t, err, "failed to open rootfs for volume sync")
+}
+
 // ============================================================================
 // periodicCleanup Tests (46.7% -> target 70%+)
 // ============================================================================
@@ -598,8 +622,9 @@ func TestRemove_WithInternalTask(t *testing.T) {
 // TestRemove_WithExistingFiles tests Remove cleans up existing files
 func TestRemove_WithExistingFiles(t *testing.T) {
 	tmpDir := t.TempDir()
-	rootfsPath := filepath.Join(tmpDir, "cleanup-task.ext4")
+	rootfsPath := filepath.Join(tmpDir, "tasks", "cleanup-task.ext4")
 	socketPath := filepath.Join(tmpDir, "cleanup-task.sock")
+	os.MkdirAll(filepath.Dir(rootfsPath), 0755)
 	os.WriteFile(rootfsPath, []byte("fake rootfs"), 0644)
 	os.WriteFile(socketPath, []byte("fake socket"), 0644)
 
@@ -777,40 +802,6 @@ func TestGetCPUs_DefaultReserved(t *testing.T) {
 	assert.GreaterOrEqual(t, result, int64(1e9))
 }
 
-// ============================================================================
-// mountRootfs Tests (66.7% -> target 80%+)
-// ============================================================================
-
-// TestMountRootfs_NonexistentFile tests with nonexistent file
-func TestMountRootfs_NonexistentFile(t *testing.T) {
-	ctrl := &Controller{
-		task:   &api.Task{ID: "mount-test"},
-		config: &Config{},
-		mu:     sync.Mutex{},
-		logger: zerolog.Nop(),
-	}
-
-	_, err := ctrl.mountRootfs("/nonexistent/path.ext4")
-	assert.Error(t, err)
-}
-
-// TestUnmountRootfs_ValidPath tests unmountRootfs cleanup
-func TestUnmountRootfs_ValidPath(t *testing.T) {
-	tmpDir := t.TempDir()
-	mountDir := filepath.Join(tmpDir, "mount-test")
-	os.MkdirAll(mountDir, 0755)
-
-	ctrl := &Controller{
-		task:   &api.Task{ID: "unmount-test"},
-		config: &Config{},
-		mu:     sync.Mutex{},
-		logger: zerolog.Nop(),
-	}
-
-	err := ctrl.unmountRootfs(mountDir)
-	assert.NoError(t, err)
-}
-
 // ============================================================================
 // Update Tests
 // ============================================================================
@@ -1053,12 +1044,13 @@ func TestShutdown_VMMError(t *testing.T) {
 // TestTerminate_Success tests successful terminate
 func TestTerminate_Success(t *testing.T) {
 	ctrl := &Controller{
-		task:    &api.Task{ID: "terminate-success-task"},
-		config:  &Config{},
-		vmmMgr:  &MockVMMManager{},
-		mu:      sync.Mutex{},
-		started: true,
-		logger:  zerolog.Nop(),
+		task:       &api.Task{ID: "terminate-success-task"},
+		config:     &Config{},
+		vmmMgr:     &MockVMMManager{},
+		mu:         sync.Mutex{},
+		networkMgr: &MockNetworkManager{},
+		started:    true,
+		logger:     zerolog.Nop(),
 	}
 
 	err := ctrl.Terminate(context.Background())
@@ -47,8 +47,8 @@ func TestSyncVolumeData_Push_GetVolumeError(t *testing.T) {
 	assert.NoError(t, err)
 }
 
-// TestSyncVolumeData_Push_MountRootfsFail tests mountRootfs failing
-func TestSyncVolumeData_Push_MountRootfsFail(t *testing.T) {
+// TestSyncVolumeData_Push_OpenRootfsFail tests opening the rootfs image failing
+func TestSyncVolumeData_Push_OpenRootfsFail(t *testing.T) {
 	ctrl := &Controller{
 		task:      &api.Task{ID: "task-mount-fail-push"},
 		config:    &Config{},
@@ -651,23 +651,6 @@ func TestGetMemory_Push_ReadMeminfoZero(t *testing.T) {
 	assert.Greater(t, result, int64(512*1024*1024))
 }
 
-// ============================================================================
-// mountRootfs Tests (66.7% -> target 80%+)
-// ============================================================================
-
-// TestMountRootfs_Push_TempDirError tests temp dir creation error
-func TestMountRootfs_Push_TempDirError(t *testing.T) {
-	ctrl := &Controller{
-		task:   &api.Task{ID: "mount-temp-error-push"},
-		config: &Config{},
-		mu:     sync.Mutex{},
-		logger: zerolog.Nop(),
-	}
-
-	_, err := ctrl.mountRootfs("/nonexistent/path.ext4")
-	assert.Error(t, err)
-}
-
 // ============================================================================
 // getCPUs Tests
 // ============================================================================
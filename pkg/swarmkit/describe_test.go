@@ -4,6 +4,9 @@ import (
 	"context"
 	"testing"
 
+	"github.com/moby/swarmkit/v2/api/genericresource"
+	"github.com/restuhaqza/swarmcracker/pkg/hostinfo"
+	"github.com/restuhaqza/swarmcracker/pkg/kernel"
 	"github.com/restuhaqza/swarmcracker/pkg/types"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -71,3 +74,34 @@ func TestExecutor_Describe(t *testing.T) {
 		assert.NotZero(t, desc.Resources.MemoryBytes)
 	}
 }
+
+// TestExecutor_Describe_EngineLabels tests the capability labels and slots
+func TestExecutor_Describe_EngineLabels(t *testing.T) {
+	e := &Executor{
+		config:      &Config{ReservedCPUs: 1, MaxVMs: 3, KernelCatalog: t.TempDir() + "/catalog.yaml"},
+		controllers: make(map[string]*Controller),
+	}
+	e.hostInfoOnce.Do(func() {
+		e.hostInfo = hostinfo.Info{KVM: true, FirecrackerVersion: "1.7.0", CPUFeatures: []string{"avx2"}}
+	})
+
+	desc, err := e.Describe(context.Background())
+	require.NoError(t, err)
+	require.NotNil(t, desc.Engine)
+
+	labels := desc.Engine.Labels
+	assert.Equal(t, "1.7.0", labels[hostinfo.LabelFirecrackerVersion])
+	assert.Equal(t, "true", labels[hostinfo.LabelCPUFeaturePrefix+"avx2"])
+	assert.Equal(t, "false", labels[hostinfo.LabelJailer])
+	for k := range labels {
+		assert.NotContains(t, k, kernel.NodeLabelPrefix, "empty catalog advertises no kernels")
+	}
+
+	slots := genericresource.GetResource(hostinfo.SlotResourceKind, desc.Resources.Generic)
+	if e.kvmAvailable() && e.archSupported() {
+		require.Len(t, slots, 1)
+		assert.LessOrEqual(t, slots[0].GetDiscreteResourceSpec().Value, int64(3), "capped at max VMs")
+	} else {
+		assert.Empty(t, slots, "nodes that cannot boot VMs report no slots")
+	}
+}
@@ -7,28 +7,49 @@ package swarmkit
 import (
 	"bufio"
 	"context"
+	"errors"
 	"fmt"
 	"net"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"runtime"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
+	gogotypes "github.com/gogo/protobuf/types"
+	swarmkit_configs "github.com/moby/swarmkit/v2/agent/configs"
 	swarmkit_exec "github.com/moby/swarmkit/v2/agent/exec"
+	swarmkit_secrets "github.com/moby/swarmkit/v2/agent/secrets"
 	"github.com/moby/swarmkit/v2/api"
+	"github.com/moby/swarmkit/v2/api/genericresource"
 	"github.com/moby/swarmkit/v2/log"
+	"github.com/restuhaqza/swarmcracker/pkg/arch"
+	"github.com/restuhaqza/swarmcracker/pkg/balloon"
+	"github.com/restuhaqza/swarmcracker/pkg/cpu"
 	"github.com/restuhaqza/swarmcracker/pkg/discovery"
+	"github.com/restuhaqza/swarmcracker/pkg/events"
+	"github.com/restuhaqza/swarmcracker/pkg/ext4"
+	"github.com/restuhaqza/swarmcracker/pkg/healthcheck"
+	"github.com/restuhaqza/swarmcracker/pkg/hostinfo"
+	"github.com/restuhaqza/swarmcracker/pkg/hugepages"
 	"github.com/restuhaqza/swarmcracker/pkg/image"
+	"github.com/restuhaqza/swarmcracker/pkg/kernel"
+	"github.com/restuhaqza/swarmcracker/pkg/metrics"
+	"github.com/restuhaqza/swarmcracker/pkg/mmds"
 	"github.com/restuhaqza/swarmcracker/pkg/network"
 	"github.com/restuhaqza/swarmcracker/pkg/storage"
+	"github.com/restuhaqza/swarmcracker/pkg/tracing"
 	"github.com/restuhaqza/swarmcracker/pkg/types"
+	"github.com/restuhaqza/swarmcracker/pkg/vmexit"
 	"github.com/rs/zerolog"
 	zerolog_log "github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // Executor implements SwarmKit's executor interface backed by SwarmCracker.
@@ -45,6 +66,16 @@ type Executor struct {
 	cleanupDone   chan struct{}
 	networkKeys   []*api.EncryptionKey // VXLAN network encryption keys (set via SetNetworkBootstrapKeys; used when VXLAN encryption is enabled)
 	cleanupMu     sync.Mutex
+	configMu      sync.RWMutex  // guards the reloadable fields of config
+	reloadCh      chan struct{} // wakes periodicCleanup after a Reload
+	metrics       *metrics.Exporter
+	events        events.Publisher
+	reclaimer     *balloon.Reclaimer
+	peers         []string // current VXLAN peers, static or from Consul; guarded by configMu
+	secrets       swarmkit_exec.SecretsManager
+	configs       swarmkit_exec.ConfigsManager
+	hostInfo      hostinfo.Info // probed once, by the first Describe
+	hostInfoOnce  sync.Once
 }
 
 // Config holds the SwarmKit integration configuration.
@@ -68,6 +99,56 @@ type Config struct {
 	MaxImageAgeDays  int      `yaml:"max_image_age_days"`
 	StateDir         string   `yaml:"state_dir"`
 
+	// Network rate limiting, applied to the interfaces of VMs started afterwards
+	EnableRateLimit  bool `yaml:"enable_rate_limit"`
+	MaxPacketsPerSec int  `yaml:"max_packets_per_sec"`
+
+	// Memory balloon for services without the swarmcracker.balloon label
+	EnableBalloon        bool          `yaml:"enable_balloon"`
+	BalloonDeflateOnOOM  bool          `yaml:"balloon_deflate_on_oom"`
+	BalloonStatsInterval time.Duration `yaml:"balloon_stats_interval"`
+
+	// Metadata service for services without the swarmcracker.mmds label
+	EnableMMDS         bool `yaml:"enable_mmds"`
+	MMDSIncludeSecrets bool `yaml:"mmds_include_secrets"`
+	MMDSIncludeConfigs bool `yaml:"mmds_include_configs"`
+
+	// CPU template for services without the swarmcracker.cpu.template
+	// label, and exclusive cores for services asking for them
+	CPUTemplate         string            `yaml:"cpu_template"`
+	CustomCPUTemplates  map[string]string `yaml:"custom_cpu_templates"`
+	CPUPinning          bool              `yaml:"cpu_pinning"`
+	PinningReservedCPUs string            `yaml:"pinning_reserved_cpus"`
+
+	// Guest memory page size for services without the
+	// swarmcracker.hugepages label ("None" or "2M")
+	HugePages string `yaml:"huge_pages"`
+
+	// Kernel catalog services pick kernels from with the
+	// swarmcracker.kernel label; empty disables it
+	KernelCatalog string `yaml:"kernel_catalog"`
+
+	// Host memory each VM costs beyond its guest memory, and a cap on the
+	// VMs the node runs, which size its "microvm" slots (zero uses
+	// hostinfo.DefaultVMOverheadMiB and no cap)
+	VMOverheadMB int `yaml:"vm_overhead_mb"`
+	MaxVMs       int `yaml:"max_vms"`
+
+	// Warm pools of paused VMs for hot images, sized per image; services
+	// override the size with the swarmcracker.warmpool label
+	WarmPool              bool           `yaml:"warm_pool"`
+	WarmPoolDir           string         `yaml:"warm_pool_dir"`
+	WarmPoolSizes         map[string]int `yaml:"warm_pool_sizes"`
+	WarmPoolGoldenTimeout time.Duration  `yaml:"warm_pool_golden_timeout"`
+
+	// Background cleanup intervals (zero uses the defaults)
+	ImageCleanupInterval  time.Duration `yaml:"image_cleanup_interval"`
+	OrphanCleanupInterval time.Duration `yaml:"orphan_cleanup_interval"`
+
+	// Firecracker seccomp filter: "" keeps the built-in filters, "default"
+	// compiles the generated profile, or a JSON profile or compiled BPF file
+	SeccompFilter string `yaml:"seccomp_filter"`
+
 	// Jailer configuration
 	EnableJailer    bool   `yaml:"enable_jailer"`
 	JailerPath      string `yaml:"jailer_path"`
@@ -93,6 +174,14 @@ func NewExecutor(config *Config) (*Executor, error) {
 		return nil, fmt.Errorf("config cannot be nil")
 	}
 
+	// A bad node default would fail every task, so refuse to start
+	if _, err := cpu.ResolveTemplate(config.CPUTemplate, config.CustomCPUTemplates, nil); err != nil {
+		return nil, fmt.Errorf("invalid CPU template: %w", err)
+	}
+	if err := hugepages.Validate(config.HugePages); err != nil {
+		return nil, err
+	}
+
 	// Set defaults
 	if config.FirecrackerPath == "" {
 		config.FirecrackerPath = "firecracker"
@@ -132,6 +221,10 @@ func NewExecutor(config *Config) (*Executor, error) {
 	imagePrep := image.NewImagePreparer(imageCfg)
 
 	// Create network manager
+	var netStateDir string
+	if config.StateDir != "" {
+		netStateDir = filepath.Join(config.StateDir, "network")
+	}
 	netCfg := types.NetworkConfig{
 		BridgeName:   config.BridgeName,
 		Subnet:       config.Subnet,
@@ -140,6 +233,7 @@ func NewExecutor(config *Config) (*Executor, error) {
 		NATEnabled:   boolPtrVal(config.NATEnabled, true),
 		VXLANEnabled: config.VXLANEnabled,
 		VXLANPeers:   config.VXLANPeers,
+		StateDir:     netStateDir,
 	}
 	networkMgr := network.NewNetworkManager(netCfg)
 
@@ -151,7 +245,21 @@ func NewExecutor(config *Config) (*Executor, error) {
 		zerolog_log.Info().Msg("Network infrastructure initialized (bridge, VXLAN)")
 	}
 
+	// Free IPs, firewall rules and DHCP leases persisted for VMs that did
+	// not survive the restart.
+	if reconciler, ok := networkMgr.(interface {
+		ReconcileIPAM(isRunning func(taskID string) bool) int
+		ReconcileFirewall(isRunning func(taskID string) bool) int
+		ReconcileDHCP(isRunning func(taskID string) bool) int
+	}); ok {
+		isRunning := vmRunning(config.SocketDir)
+		reconciler.ReconcileIPAM(isRunning)
+		reconciler.ReconcileFirewall(isRunning)
+		reconciler.ReconcileDHCP(isRunning)
+	}
+
 	// Setup Consul service discovery if enabled
+	var peerWatcher *discovery.ConsulClient
 	if config.ConsulEnabled {
 		// Determine local IP for Consul registration
 		localIP := config.AdvertiseAddr
@@ -182,14 +290,7 @@ func NewExecutor(config *Config) (*Executor, error) {
 				zerolog_log.Info().Str("address", config.ConsulAddress).Msg("Registered in Consul for VXLAN discovery")
 				// Set Consul as node discovery provider
 				networkMgr.SetNodeDiscovery(consulClient)
-				// Watch for peer changes
-				go consulClient.WatchPeers(context.Background(), func(peers []string) {
-					if err := networkMgr.UpdateVXLANPeers(peers); err != nil {
-						zerolog_log.Warn().Err(err).Strs("peers", peers).Msg("Failed to update VXLAN peers from Consul")
-					} else {
-						zerolog_log.Info().Strs("peers", peers).Msg("VXLAN peers updated from Consul")
-					}
-				})
+				peerWatcher = consulClient
 			}
 		}
 	}
@@ -222,6 +323,11 @@ func NewExecutor(config *Config) (*Executor, error) {
 			ParentCgroup:    config.ParentCgroup,
 			CgroupVersion:   config.CgroupVersion,
 			EnableCgroups:   config.EnableCgroups,
+			CPUPinning:      config.CPUPinning,
+			ReservedCPUs:    config.PinningReservedCPUs,
+			StateDir:        config.StateDir,
+			WarmPool:        config.WarmPool,
+			SeccompFilter:   config.SeccompFilter,
 		}
 		vmmMgr, err = NewVMMManagerWithConfig(vmmCfg)
 		if err != nil {
@@ -229,12 +335,25 @@ func NewExecutor(config *Config) (*Executor, error) {
 		}
 	} else {
 		// Use legacy direct mode
-		vmmMgr, err = NewVMMManager(config.FirecrackerPath, config.SocketDir)
+		vmmMgr, err = NewVMMManagerWithConfig(&VMMManagerConfig{
+			FirecrackerPath:       config.FirecrackerPath,
+			SocketDir:             config.SocketDir,
+			CPUPinning:            config.CPUPinning,
+			ReservedCPUs:          config.PinningReservedCPUs,
+			StateDir:              config.StateDir,
+			WarmPool:              config.WarmPool,
+			WarmPoolDir:           config.WarmPoolDir,
+			WarmPoolGoldenTimeout: config.WarmPoolGoldenTimeout,
+			SeccompFilter:         config.SeccompFilter,
+		})
 		if err != nil {
 			return nil, fmt.Errorf("failed to create VMM manager: %w", err)
 		}
 	}
 
+	// Free cores persisted for VMs that did not survive the restart
+	vmmMgr.ReconcileCPUs(vmRunning(config.SocketDir))
+
 	// Create context for cleanup goroutine
 	cleanupCtx, cleanupCancel := context.WithCancel(context.Background())
 
@@ -248,6 +367,22 @@ func NewExecutor(config *Config) (*Executor, error) {
 		controllers:   make(map[string]*Controller),
 		cleanupCancel: cleanupCancel,
 		cleanupDone:   make(chan struct{}),
+		reloadCh:      make(chan struct{}, 1),
+		peers:         config.VXLANPeers,
+		secrets:       swarmkit_secrets.NewManager(),
+		configs:       swarmkit_configs.NewManager(),
+	}
+
+	// Watch for peer changes
+	if peerWatcher != nil {
+		go peerWatcher.WatchPeers(context.Background(), func(peers []string) {
+			if err := networkMgr.UpdateVXLANPeers(peers); err != nil {
+				zerolog_log.Warn().Err(err).Strs("peers", peers).Msg("Failed to update VXLAN peers from Consul")
+				return
+			}
+			zerolog_log.Info().Strs("peers", peers).Msg("VXLAN peers updated from Consul")
+			exec.setPeers(peers)
+		})
 	}
 
 	// Start periodic cleanup goroutine
@@ -256,19 +391,22 @@ func NewExecutor(config *Config) (*Executor, error) {
 	return exec, nil
 }
 
-// periodicCleanup runs image cleanup every 24 hours and orphaned VM cleanup every 5 minutes.
+// periodicCleanup runs image cleanup (every 24 hours by default) and orphaned
+// VM cleanup (every 5 minutes by default). Reload resets both tickers.
 func (e *Executor) periodicCleanup(ctx context.Context) {
 	defer close(e.cleanupDone)
 
-	imageTicker := time.NewTicker(24 * time.Hour)
+	imageInterval, vmInterval := e.cleanupIntervals()
+
+	imageTicker := time.NewTicker(imageInterval)
 	defer imageTicker.Stop()
 
-	vmTicker := time.NewTicker(5 * time.Minute)
+	vmTicker := time.NewTicker(vmInterval)
 	defer vmTicker.Stop()
 
 	// Run initial cleanup after a short delay (to avoid startup churn)
 	select {
-	case <-time.After(5 * time.Minute):
+	case <-time.After(vmInterval):
 		e.runCleanup(ctx)
 		e.cleanupOrphanedVMs(ctx)
 	case <-ctx.Done():
@@ -281,6 +419,10 @@ func (e *Executor) periodicCleanup(ctx context.Context) {
 			e.runCleanup(ctx)
 		case <-vmTicker.C:
 			e.cleanupOrphanedVMs(ctx)
+		case <-e.reloadCh:
+			imageInterval, vmInterval = e.cleanupIntervals()
+			imageTicker.Reset(imageInterval)
+			vmTicker.Reset(vmInterval)
 		case <-ctx.Done():
 			zerolog_log.Debug().Msg("Periodic cleanup goroutine stopping")
 			return
@@ -294,9 +436,11 @@ func (e *Executor) runCleanup(ctx context.Context) {
 
 	// Get MaxImageAgeDays from config, default to 7
 	maxAgeDays := 7
+	e.configMu.RLock()
 	if e.config.MaxImageAgeDays > 0 {
 		maxAgeDays = e.config.MaxImageAgeDays
 	}
+	e.configMu.RUnlock()
 
 	// Cleanup now returns filesRemoved and bytesFreed
 	filesRemoved, bytesFreed, err := e.imagePrep.Cleanup(ctx, maxAgeDays)
@@ -416,6 +560,46 @@ func (e *Executor) Describe(ctx context.Context) (*api.NodeDescription, error) {
 			Msg("Firecracker not available: KVM or architecture not supported")
 	}
 
+	// Report the 2M huge page pool that guest memory can be backed with
+	if pool, err := hugepages.ReadPool(hugepages.Size2M); err != nil {
+		zerolog_log.Warn().Err(err).Msg("Could not read huge page pool")
+	} else if pool.Total > 0 {
+		genericResources = append(genericResources, genericresource.NewDiscrete(hugepages.ResourceKind, int64(pool.Total)))
+		zerolog_log.Info().
+			Int("total_mib", pool.TotalMiB()).
+			Int("free_mib", pool.FreeMiB()).
+			Msg("Reporting huge page capacity")
+	}
+
+	// Count the VMs the node has room for. Services reserve a slot per
+	// task, so nodes that cannot boot VMs get none of them.
+	if e.kvmAvailable() && e.archSupported() {
+		slots := hostinfo.Slots(memoryBytes, e.config.VMOverheadMB, e.config.MaxVMs)
+		genericResources = append(genericResources, genericresource.NewDiscrete(hostinfo.SlotResourceKind, slots))
+	}
+
+	// Advertise the host's capabilities and installed kernels as engine
+	// labels for placement constraints
+	e.hostInfoOnce.Do(func() {
+		e.hostInfo = hostinfo.Probe(e.config.FirecrackerPath, e.config.JailerPath)
+		zerolog_log.Info().
+			Str("firecracker", e.hostInfo.FirecrackerVersion).
+			Str("cpu_vendor", e.hostInfo.CPUVendor).
+			Strs("cpu_features", e.hostInfo.CPUFeatures).
+			Str("host_kernel", e.hostInfo.HostKernel).
+			Msg("Probed host capabilities")
+	})
+	engine := &api.EngineDescription{Labels: e.hostInfo.Labels()}
+	if e.config.KernelCatalog != "" {
+		if catalog, err := kernel.Load(e.config.KernelCatalog); err != nil {
+			zerolog_log.Warn().Err(err).Msg("Could not read kernel catalog")
+		} else {
+			for k, v := range kernel.NodeLabels(catalog.Installed()) {
+				engine.Labels[k] = v
+			}
+		}
+	}
+
 	return &api.NodeDescription{
 		Hostname: hostname(),
 		Platform: &api.Platform{
@@ -427,13 +611,20 @@ func (e *Executor) Describe(ctx context.Context) (*api.NodeDescription, error) {
 			MemoryBytes: memoryBytes,
 			Generic:     genericResources,
 		},
+		Engine: engine,
 	}, nil
 }
 
 // Configure configures the executor with node state.
 func (e *Executor) Configure(ctx context.Context, node *api.Node) error {
 	log.G(ctx).WithField("node.id", node.ID).Debug("Configuring executor")
-	// Nothing to configure for now
+
+	// The scheduler keeps tasks off a node without slots, but say why
+	if node.Spec.Availability == api.NodeAvailabilityActive && !(e.kvmAvailable() && e.archSupported()) {
+		zerolog_log.Warn().
+			Str("node_id", node.ID).
+			Msg("Node is active but cannot boot microVMs (no KVM or unsupported architecture); it gets no tasks")
+	}
 	return nil
 }
 
@@ -447,8 +638,16 @@ func (e *Executor) Controller(t *api.Task) (swarmkit_exec.Controller, error) {
 		return ctrl, nil
 	}
 
-	// Create new controller
-	ctrl, err := NewController(t, e.config, e.imagePrep, e.networkMgr, e.vmmMgr, e.volumeMgr, e.secretMgr)
+	// Create new controller with a snapshot of the config, so a later
+	// Reload does not change a task mid-flight
+	e.configMu.RLock()
+	cfg := *e.config
+	if e.peers != nil {
+		cfg.VXLANPeers = slices.Clone(e.peers) // served to the guest
+	}
+	e.configMu.RUnlock()
+
+	ctrl, err := NewController(t, &cfg, e.imagePrep, e.networkMgr, e.vmmMgr, e.volumeMgr, e.secretMgr)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create controller: %w", err)
 	}
@@ -461,10 +660,84 @@ func (e *Executor) Controller(t *api.Task) (swarmkit_exec.Controller, error) {
 		zerolog_log.Debug().Str("task_id", t.ID).Msg("Controller deregistered from executor")
 	}
 
+	ctrl.metrics = e.metrics
+	ctrl.events = e.events
+	ctrl.reclaimer = e.reclaimer
+	if e.secrets != nil {
+		ctrl.secrets = swarmkit_secrets.Restrict(e.secrets, t)
+	}
+	if e.configs != nil {
+		ctrl.configs = swarmkit_configs.Restrict(e.configs, t)
+	}
 	e.controllers[t.ID] = ctrl
 	return ctrl, nil
 }
 
+// Secrets returns the store the agent keeps the secrets of assigned tasks
+// in. Controllers read secret payloads from it.
+func (e *Executor) Secrets() swarmkit_exec.SecretsManager {
+	return e.secrets
+}
+
+// Configs returns the store the agent keeps the configs of assigned tasks
+// in. Controllers read config payloads from it.
+func (e *Executor) Configs() swarmkit_exec.ConfigsManager {
+	return e.configs
+}
+
+// setPeers records the node's current VXLAN peers and serves them to the
+// guests of running tasks with the metadata service.
+func (e *Executor) setPeers(peers []string) {
+	e.configMu.Lock()
+	e.peers = slices.Clone(peers)
+	e.configMu.Unlock()
+
+	e.executorMu.RLock()
+	ctrls := make([]*Controller, 0, len(e.controllers))
+	for _, c := range e.controllers {
+		ctrls = append(ctrls, c)
+	}
+	e.executorMu.RUnlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	for _, c := range ctrls {
+		c.setMetadataPeers(ctx, peers)
+	}
+}
+
+// SetMetricsExporter makes controllers created afterwards export their VM's
+// metrics and their prepare and boot timings.
+func (e *Executor) SetMetricsExporter(exporter *metrics.Exporter) {
+	e.executorMu.Lock()
+	defer e.executorMu.Unlock()
+	e.metrics = exporter
+	if vmm, ok := e.vmmMgr.(*VMMManager); ok && exporter != nil {
+		vmm.SetWarmPoolMetrics(exporter)
+	}
+}
+
+// SetBalloonReclaimer puts the balloons of VMs started by controllers
+// created afterwards under r's control.
+func (e *Executor) SetBalloonReclaimer(r *balloon.Reclaimer) {
+	e.executorMu.Lock()
+	defer e.executorMu.Unlock()
+	e.reclaimer = r
+}
+
+// SetEventPublisher makes the executor publish task lifecycle events to p:
+// image pulls and rootfs builds via the image preparer if it supports it,
+// and network, boot, health and exit events from controllers created
+// afterwards.
+func (e *Executor) SetEventPublisher(p events.Publisher) {
+	e.executorMu.Lock()
+	defer e.executorMu.Unlock()
+	e.events = p
+	if ep, ok := e.imagePrep.(interface{ SetEventPublisher(events.Publisher) }); ok {
+		ep.SetEventPublisher(p)
+	}
+}
+
 // SetNetworkBootstrapKeys sets network encryption keys.
 // These keys are used for VXLAN encryption in the overlay network.
 func (e *Executor) SetNetworkBootstrapKeys(keys []*api.EncryptionKey) error {
@@ -491,12 +764,40 @@ func (e *Executor) SetNetworkBootstrapKeys(keys []*api.EncryptionKey) error {
 	return nil
 }
 
+// vmRunning returns a check of whether a task's Firecracker is still
+// running, made by connecting to its API socket: a socket file left behind
+// by a Firecracker that crashed refuses the connection.
+func vmRunning(socketDir string) func(taskID string) bool {
+	return func(taskID string) bool {
+		conn, err := net.DialTimeout("unix", filepath.Join(socketDir, taskID+".sock"), time.Second)
+		if err != nil {
+			return false
+		}
+		conn.Close()
+		return true
+	}
+}
+
+// GuestStatusReporter is an optional interface of VMM managers that watch
+// their guests' consoles. Controllers use it to wait for a guest's
+// healthcheck to pass before reporting the task running.
+type GuestStatusReporter interface {
+	GuestStatus(taskID string) vmexit.Status
+}
+
 // NetworkKeySetter is an optional interface that network managers can implement
 // to receive encryption keys from SwarmKit.
 type NetworkKeySetter interface {
 	SetEncryptionKeys(keys []*api.EncryptionKey) error
 }
 
+// How long and how often a controller polls a booted VM's guest status
+// before publishing the healthy event.
+var (
+	healthyTimeout      = 60 * time.Second
+	healthyPollInterval = 500 * time.Millisecond
+)
+
 // Controller implements SwarmKit's controller interface for a single task.
 type Controller struct {
 	task       *api.Task
@@ -518,6 +819,30 @@ type Controller struct {
 	socketPath string
 	cancel     context.CancelFunc
 	logger     zerolog.Logger
+	metrics    *metrics.Exporter  // nil disables metrics
+	events     events.Publisher   // nil disables events
+	reclaimer  *balloon.Reclaimer // nil leaves balloons at their boot size
+
+	// Secret and config payloads of the task; nil leaves them empty
+	secrets swarmkit_exec.SecretGetter
+	configs swarmkit_exec.ConfigGetter
+
+	// metadata is the document served to a running guest, nil without
+	// the metadata service
+	metadata *mmds.Document
+
+	// stopRequested is set by Shutdown and Terminate so Wait does not
+	// report the exit as a crash
+	stopRequested atomic.Bool
+
+	// exitCode is the workload's exit status, set once Wait saw the VM
+	// exit (exited)
+	exited   atomic.Bool
+	exitCode atomic.Int32
+
+	// launchSpan is the root span of the task's trace, from Prepare until
+	// Start returns
+	launchSpan trace.Span
 
 	// OnRemove is called when the controller is removed from the executor
 	OnRemove func()
@@ -533,7 +858,7 @@ func NewController(
 	volumeMgr *storage.VolumeManager,
 	secretMgr *storage.SecretManager,
 ) (*Controller, error) {
-	trans, err := NewTaskTranslator(config.KernelPath, config.BridgeIP)
+	trans, err := newConfiguredTranslator(config)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create translator: %w", err)
 	}
@@ -568,14 +893,35 @@ func (c *Controller) Update(ctx context.Context, t *api.Task) error {
 		return nil
 	}
 
-	// Task already started - SwarmKit will create a new task for rolling updates
-	// Return nil to indicate we've seen the update (no-op for running tasks)
+	// Task already started - SwarmKit will create a new task for rolling
+	// updates, so only the guest's metadata follows the new service labels
 	c.logger.Debug().Msg("Task already started, skipping update (SwarmKit will create new task)")
+	if c.metadata != nil {
+		c.metadata.Service.Labels = t.ServiceAnnotations.Labels
+		if err := mmds.NewClient(c.socketPath).Put(ctx, c.metadata); err != nil {
+			c.logger.Warn().Err(err).Msg("Failed to update guest metadata")
+		}
+	}
 	return nil
 }
 
+// setMetadataPeers serves new VXLAN peers to a running guest with the
+// metadata service.
+func (c *Controller) setMetadataPeers(ctx context.Context, peers []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.started || c.metadata == nil {
+		return
+	}
+	c.metadata.Node.Peers = slices.Clone(peers)
+	if err := mmds.NewClient(c.socketPath).Put(ctx, c.metadata); err != nil {
+		c.logger.Warn().Err(err).Msg("Failed to update guest metadata")
+	}
+}
+
 // Prepare prepares the task for execution.
-func (c *Controller) Prepare(ctx context.Context) error {
+func (c *Controller) Prepare(ctx context.Context) (err error) {
 	c.logger.Info().Msg("Preparing task")
 
 	c.mu.Lock()
@@ -585,18 +931,42 @@ func (c *Controller) Prepare(ctx context.Context) error {
 		return nil // Already prepared
 	}
 
+	start := time.Now()
+	defer func() { c.metrics.ObservePrepare(time.Since(start), err) }()
+
 	// Convert SwarmKit task to internal type
 	task := c.convertTask()
 
+	ctx, span := c.startSpan(ctx, task, "task.prepare")
+	defer func() {
+		tracing.End(span, err)
+		if err != nil {
+			c.endLaunchSpan(err)
+		}
+	}()
+
+	// Without its payload a secret or config would be injected as an empty file
+	if err := c.checkPayloads(task); err != nil {
+		return err
+	}
+
 	// Prepare image
 	if err := c.imagePrep.Prepare(ctx, task); err != nil {
 		return fmt.Errorf("image preparation failed: %w", err)
 	}
 
 	// Prepare network (modifies task.Networks - must be done before storing internalTask)
-	if err := c.networkMgr.PrepareNetwork(ctx, task); err != nil {
+	netCtx, netSpan := tracing.Start(ctx, "network.prepare")
+	err = c.networkMgr.PrepareNetwork(netCtx, task)
+	tracing.End(netSpan, err)
+	if err != nil {
+		c.publish(events.TaskEvent(events.NetworkAttach, task, "Network attach failed", err))
 		return fmt.Errorf("network preparation failed: %w", err)
 	}
+	if len(task.Networks) > 0 {
+		c.publish(events.TaskEvent(events.NetworkAttach, task,
+			fmt.Sprintf("Attached %d network(s)", len(task.Networks)), nil))
+	}
 
 	// Debug: Log network count before storing
 	c.logger.Info().
@@ -612,12 +982,12 @@ func (c *Controller) Prepare(ctx context.Context) error {
 	if rootfsPath != "" && c.secretMgr != nil {
 		if len(task.Secrets) > 0 {
 			if err := c.secretMgr.InjectSecrets(ctx, c.task.ID, task.Secrets, rootfsPath); err != nil {
-				c.logger.Warn().Err(err).Msg("Failed to inject secrets")
+				return fmt.Errorf("failed to inject secrets: %w", err)
 			}
 		}
 		if len(task.Configs) > 0 {
 			if err := c.secretMgr.InjectConfigs(ctx, c.task.ID, task.Configs, rootfsPath); err != nil {
-				c.logger.Warn().Err(err).Msg("Failed to inject configs")
+				return fmt.Errorf("failed to inject configs: %w", err)
 			}
 		}
 	}
@@ -627,25 +997,46 @@ func (c *Controller) Prepare(ctx context.Context) error {
 	return nil
 }
 
-// Start starts the task.
+// Start starts the task. A task whose service has a healthcheck is only
+// reported started, and so running, once its guest reports healthy: that
+// is what start-first rolling updates wait for before stopping the task
+// it replaces.
 func (c *Controller) Start(ctx context.Context) error {
+	task, err := c.boot(ctx)
+	if err != nil || task == nil {
+		return err
+	}
+
+	if err := c.waitHealthy(ctx, task); err != nil {
+		// The task fails; don't leave its VM running
+		if stopErr := c.Terminate(context.Background()); stopErr != nil {
+			c.logger.Warn().Err(stopErr).Msg("Failed to stop VM that did not become healthy")
+		}
+		return err
+	}
+	return nil
+}
+
+// boot boots the task's VM. It returns the task it booted, or nil if the
+// VM was already running.
+func (c *Controller) boot(ctx context.Context) (_ *types.Task, err error) {
 	c.logger.Info().Msg("Starting task")
 
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
 	if !c.prepared {
-		return fmt.Errorf("task not prepared")
+		return nil, fmt.Errorf("task not prepared")
 	}
 
 	if c.started {
-		return nil // Already started
+		return nil, nil // Already started
 	}
 
 	// Use the prepared internal task (has annotations like rootfs path)
 	task := c.internalTask
 	if task == nil {
-		return fmt.Errorf("internal task not prepared")
+		return nil, fmt.Errorf("internal task not prepared")
 	}
 
 	// Debug: Log networks before translation
@@ -654,20 +1045,99 @@ func (c *Controller) Start(ctx context.Context) error {
 		Int("networks_in_internal_task", len(task.Networks)).
 		Msg("Start: task.Networks count")
 
-	// Translate to VM config
+	ctx, span := c.startSpan(ctx, task, "task.start")
+	defer func() {
+		tracing.End(span, err)
+		c.endLaunchSpan(err)
+	}()
+
+	// Translate to VM config, passing the trace on to the guest
+	_, transSpan := tracing.Start(ctx, "task.translate")
 	vmConfig, err := c.trans.Translate(task)
+	tracing.End(transSpan, err)
 	if err != nil {
-		return fmt.Errorf("translation failed: %w", err)
+		return nil, fmt.Errorf("translation failed: %w", err)
 	}
+	appendBootArg(vmConfig, tracing.KernelArg(ctx))
 
 	// Start VM
-	if err := c.vmmMgr.Start(ctx, task, vmConfig); err != nil {
-		return fmt.Errorf("failed to start VM: %w", err)
+	bootStart := time.Now()
+	err = c.vmmMgr.Start(ctx, task, vmConfig)
+	bootTime := time.Since(bootStart)
+	c.metrics.ObserveBoot(bootTime, err)
+	if err != nil {
+		c.publish(events.TaskEvent(events.VMBoot, task, "VM failed to boot", err))
+		return nil, fmt.Errorf("failed to start VM: %w", err)
+	}
+	c.metrics.Track(metrics.TaskLabels{Task: task.ID, Service: task.ServiceName},
+		metrics.FirecrackerMetricsPath(c.socketPath))
+	if memMiB, ok := balloonMemory(vmConfig); ok {
+		c.reclaimer.Track(task.ID, c.socketPath, memMiB)
+	}
+	if doc, ok := metadataDocument(vmConfig); ok {
+		c.metadata = doc
+	}
+
+	boot := events.TaskEvent(events.VMBoot, task, "VM booted", nil)
+	boot.Attributes = map[string]string{"duration": bootTime.Round(time.Millisecond).String()}
+	c.publish(boot)
+	if c.events != nil {
+		go c.watchHealthy(task, bootStart)
 	}
 
+	c.stopRequested.Store(false)
 	c.started = true
 	c.logger.Info().Msg("Task started")
-	return nil
+	return task, nil
+}
+
+// waitHealthy waits for the guest of a just booted task to report its
+// healthcheck passing. Tasks without a healthcheck, and VMM managers that
+// don't watch guest consoles, don't wait.
+func (c *Controller) waitHealthy(ctx context.Context, task *types.Task) error {
+	container, err := task.Spec.GetContainer()
+	if err != nil {
+		return nil
+	}
+	if _, ok := healthcheck.Command(container.Healthcheck); !ok {
+		return nil
+	}
+	guest, ok := c.vmmMgr.(GuestStatusReporter)
+	if !ok {
+		return nil
+	}
+
+	timeout := healthcheck.ReadyTimeout(container.Healthcheck)
+	waitCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	ticker := time.NewTicker(healthyPollInterval)
+	defer ticker.Stop()
+
+	c.logger.Info().Dur("timeout", timeout).Msg("Waiting for guest healthcheck")
+	for {
+		status := guest.GuestStatus(task.ID)
+		switch {
+		case status.Health == healthcheck.Healthy:
+			c.logger.Info().Msg("Guest is healthy")
+			return nil
+		case status.Health == healthcheck.Unhealthy:
+			return fmt.Errorf("guest healthcheck failed")
+		case status.Reported:
+			return fmt.Errorf("workload exited with status %d before becoming healthy", status.Code)
+		case status.Panic != "":
+			return fmt.Errorf("guest kernel panicked before becoming healthy: %s", status.Panic)
+		}
+
+		select {
+		case <-waitCtx.Done():
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return fmt.Errorf("guest not healthy after %s", timeout)
+		case <-ticker.C:
+		}
+	}
 }
 
 // Wait waits for the task to exit.
@@ -680,6 +1150,9 @@ func (c *Controller) Wait(ctx context.Context) error {
 	if err != nil {
 		return err
 	}
+	c.exitCode.Store(int32(status.ExitCode))
+	c.exited.Store(true)
+	c.publishExit(task, status)
 
 	if status.Err != nil {
 		return status.Err
@@ -688,6 +1161,112 @@ func (c *Controller) Wait(ctx context.Context) error {
 	return nil
 }
 
+// publishExit reports how the VM exited. Exits caused by Shutdown or
+// Terminate were already reported as stops.
+func (c *Controller) publishExit(task *types.Task, status *types.TaskStatus) {
+	if c.events == nil || c.stopRequested.Load() {
+		return
+	}
+
+	switch {
+	case status.Err == nil:
+		c.publish(events.TaskEvent(events.VMStop, task, "VM exited", nil))
+	case errors.Is(status.Err, ErrOOMKilled):
+		c.publish(events.TaskEvent(events.VMOOM, task, "VM was killed by the OOM killer", status.Err))
+	case errors.Is(status.Err, ErrGuestOOMKilled):
+		c.publish(events.TaskEvent(events.VMOOM, task, "Workload was killed by the guest's OOM killer", status.Err))
+	default:
+		e := events.TaskEvent(events.VMCrash, task, "VM exited unexpectedly", status.Err)
+		e.Attributes = map[string]string{
+			"exit_reason": status.Message,
+			"exit_code":   strconv.Itoa(status.ExitCode),
+		}
+		c.publish(e)
+	}
+}
+
+// watchHealthy watches the guest of a booted VM and publishes a healthy
+// event once it is up: when its healthcheck first passes or, for tasks
+// without one, when the init wrapper reports userspace ready. VMM managers
+// that don't watch guest consoles can't tell, so no event is published.
+func (c *Controller) watchHealthy(task *types.Task, bootStart time.Time) {
+	guest, ok := c.vmmMgr.(GuestStatusReporter)
+	if !ok {
+		return
+	}
+	timeout, hasHealthcheck := healthyTimeout, false
+	if container, err := task.Spec.GetContainer(); err == nil {
+		if _, hasHealthcheck = healthcheck.Command(container.Healthcheck); hasHealthcheck {
+			timeout = healthcheck.ReadyTimeout(container.Healthcheck)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	ticker := time.NewTicker(healthyPollInterval)
+	defer ticker.Stop()
+
+	for {
+		if c.stopRequested.Load() {
+			return
+		}
+		status := guest.GuestStatus(task.ID)
+		if (hasHealthcheck && status.Health == healthcheck.Healthy) || (!hasHealthcheck && status.Ready) {
+			e := events.TaskEvent(events.VMHealthy, task, "VM is healthy", nil)
+			e.Attributes = map[string]string{"after": time.Since(bootStart).Round(time.Millisecond).String()}
+			c.publish(e)
+			return
+		}
+		if status.Reported || status.Panic != "" {
+			return
+		}
+		select {
+		case <-ctx.Done():
+			c.logger.Warn().Dur("timeout", timeout).Msg("VM did not become healthy")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// startSpan starts a span for a launch phase under the task's launch span,
+// starting that first if needed.
+func (c *Controller) startSpan(ctx context.Context, task *types.Task, name string) (context.Context, trace.Span) {
+	if c.launchSpan == nil {
+		_, c.launchSpan = tracing.Start(ctx, "task.launch",
+			attribute.String("task.id", task.ID),
+			attribute.String("service.id", task.ServiceID),
+			attribute.String("service.name", task.ServiceName),
+			attribute.String("image", taskImage(task)),
+		)
+	}
+	return tracing.Start(trace.ContextWithSpan(ctx, c.launchSpan), name)
+}
+
+// endLaunchSpan ends the task's launch span, if one is open.
+func (c *Controller) endLaunchSpan(err error) {
+	if c.launchSpan != nil {
+		tracing.End(c.launchSpan, err)
+		c.launchSpan = nil
+	}
+}
+
+// taskImage returns the task's container image, if any.
+func taskImage(task *types.Task) string {
+	if container, err := task.Spec.GetContainer(); err == nil {
+		return container.Image
+	}
+	return ""
+}
+
+// publish sends a lifecycle event if events are enabled.
+func (c *Controller) publish(e events.Event) {
+	if c.events != nil {
+		c.events.Publish(e)
+	}
+}
+
 // Shutdown gracefully shuts down the task.
 func (c *Controller) Shutdown(ctx context.Context) error {
 	c.logger.Info().Msg("Shutting down task gracefully")
@@ -707,10 +1286,12 @@ func (c *Controller) Shutdown(ctx context.Context) error {
 	defer cancel()
 
 	// Attempt graceful shutdown via VMM manager
+	c.stopRequested.Store(true)
 	if err := c.vmmMgr.Stop(shutdownCtx, task); err != nil {
 		c.logger.Error().Err(err).Msg("Graceful shutdown failed")
 		return fmt.Errorf("failed to shutdown VM: %w", err)
 	}
+	c.publish(events.TaskEvent(events.VMStop, task, "VM shut down", nil))
 
 	// Cleanup network after VM stops
 	if err := c.networkMgr.CleanupNetwork(shutdownCtx, task); err != nil {
@@ -739,10 +1320,17 @@ func (c *Controller) Terminate(ctx context.Context) error {
 	task := c.convertTask()
 
 	// Force kill immediately without grace period
+	c.stopRequested.Store(true)
 	if err := c.vmmMgr.Stop(ctx, task); err != nil {
 		c.logger.Error().Err(err).Msg("Force terminate failed")
 		return fmt.Errorf("failed to force terminate VM: %w", err)
 	}
+	c.publish(events.TaskEvent(events.VMStop, task, "VM terminated", nil))
+
+	// Cleanup network after VM stops
+	if err := c.networkMgr.CleanupNetwork(ctx, task); err != nil {
+		c.logger.Warn().Err(err).Msg("Failed to cleanup network after terminate")
+	}
 
 	// Mark as not started
 	c.started = false
@@ -770,7 +1358,7 @@ func (c *Controller) Remove(ctx context.Context) error {
 		}
 	}
 
-	// Cleanup network (includes dnsmasq entries)
+	// Cleanup network (includes DHCP leases and DNS records)
 	if err := c.networkMgr.CleanupNetwork(ctx, task); err != nil {
 		c.logger.Error().Err(err).Msg("Failed to cleanup network")
 	}
@@ -780,8 +1368,8 @@ func (c *Controller) Remove(ctx context.Context) error {
 		c.logger.Error().Err(err).Msg("Failed to remove VM")
 	}
 
-	// Clean up rootfs image
-	rootfsPath := filepath.Join(c.config.RootfsDir, task.ID+".ext4")
+	// Clean up the task's private rootfs copy, if it has one
+	rootfsPath := image.TaskRootfsPath(c.config.RootfsDir, task.ID)
 	if err := os.Remove(rootfsPath); err != nil && !os.IsNotExist(err) {
 		c.logger.Warn().Err(err).Str("path", rootfsPath).Msg("Failed to remove rootfs image")
 	} else if err == nil {
@@ -789,9 +1377,14 @@ func (c *Controller) Remove(ctx context.Context) error {
 	}
 
 	// Clean up socket file (should be removed by vmmMgr.Remove, but ensure it)
+	// and the Firecracker log and metrics files next to it
+	c.metrics.Untrack(task.ID)
+	c.reclaimer.Untrack(task.ID)
 	socketPath := filepath.Join(c.config.SocketDir, task.ID+".sock")
-	if err := os.Remove(socketPath); err != nil && !os.IsNotExist(err) {
-		c.logger.Warn().Err(err).Str("path", socketPath).Msg("Failed to remove socket file")
+	for _, path := range []string{socketPath, metrics.FirecrackerLogPath(socketPath), metrics.FirecrackerMetricsPath(socketPath)} {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			c.logger.Warn().Err(err).Str("path", path).Msg("Failed to remove VM file")
+		}
 	}
 
 	c.started = false
@@ -817,14 +1410,26 @@ func (c *Controller) syncVolumeData(ctx context.Context, task *types.Task, mount
 		return nil
 	}
 
-	// Temporarily mount the rootfs to access files
-	mountDir, err := c.mountRootfs(rootfsPath)
-	if err != nil {
-		c.logger.Warn().Err(err).Msg("Could not mount rootfs for volume sync (may require privileges)")
-		// Continue without sync - non-critical
+	// Read the guest's copy of each volume straight from the ext4 image
+	// ext4.Open replays the journal of a guest that was stopped uncleanly;
+	// any other failure to open would lose the volume data.
+	img, err := ext4.Open(rootfsPath)
+	if errors.Is(err, os.ErrNotExist) {
+		c.logger.Warn().Err(err).Msg("Rootfs is gone, skipping volume sync")
 		return nil
 	}
-	defer c.unmountRootfs(mountDir)
+	if err != nil {
+		return fmt.Errorf("failed to open rootfs for volume sync: %w", err)
+	}
+	defer img.Close()
+
+	// Volume data is copied out into a scratch directory laid out like the
+	// rootfs, which UnmountVolume then syncs back to the host.
+	syncDir, err := os.MkdirTemp("", "swarmcracker-sync-")
+	if err != nil {
+		return fmt.Errorf("failed to create sync directory: %w", err)
+	}
+	defer os.RemoveAll(syncDir)
 
 	// Process each mount
 	for _, mount := range mounts {
@@ -858,8 +1463,16 @@ func (c *Controller) syncVolumeData(ctx context.Context, task *types.Task, mount
 			continue
 		}
 
+		if err := img.Extract(mount.Target, filepath.Join(syncDir, mount.Target)); err != nil {
+			c.logger.Error().Err(err).
+				Str("volume", volumeName).
+				Str("target", mount.Target).
+				Msg("Failed to read volume data from rootfs")
+			continue
+		}
+
 		// Unmount volume (sync data back)
-		if err := c.volumeMgr.UnmountVolume(ctx, vol, mountDir, mount.Target, mount.ReadOnly); err != nil {
+		if err := c.volumeMgr.UnmountVolume(ctx, vol, syncDir, mount.Target, mount.ReadOnly); err != nil {
 			c.logger.Error().Err(err).
 				Str("volume", volumeName).
 				Str("target", mount.Target).
@@ -872,41 +1485,6 @@ func (c *Controller) syncVolumeData(ctx context.Context, task *types.Task, mount
 	return nil
 }
 
-// mountRootfs mounts an ext4 rootfs for volume sync. Requires root.
-// TODO: Replace with debugfs-based read/write to avoid mount dependency.
-// Currently needed by volume sync (UnmountVolume requires a mounted directory).
-func (c *Controller) mountRootfs(imagePath string) (string, error) {
-	// Create temp mount point
-	mountDir, err := os.MkdirTemp("", "swarmcracker-sync-")
-	if err != nil {
-		return "", err
-	}
-
-	// Try to mount the image
-	// This requires root privileges or user namespace setup
-	cmd := exec.Command("mount", "-o", "loop", imagePath, mountDir)
-	if output, err := cmd.CombinedOutput(); err != nil {
-		os.RemoveAll(mountDir)
-		return "", fmt.Errorf("mount failed: %s: %w", string(output), err)
-	}
-
-	c.logger.Debug().Str("path", mountDir).Msg("Rootfs mounted for sync")
-	return mountDir, nil
-}
-
-// unmountRootfs unmounts a temporary rootfs mount point.
-func (c *Controller) unmountRootfs(mountDir string) error {
-	// Unmount
-	cmd := exec.Command("umount", mountDir)
-	_ = cmd.Run() // Ignore errors
-
-	// Cleanup temp dir
-	os.RemoveAll(mountDir)
-
-	c.logger.Debug().Str("path", mountDir).Msg("Rootfs unmounted")
-	return nil
-}
-
 // Close closes ephemeral resources.
 func (c *Controller) Close() error {
 	c.logger.Debug().Msg("Closing controller")
@@ -924,10 +1502,13 @@ func (c *Controller) ContainerStatus(ctx context.Context) (*api.ContainerStatus,
 		return status, nil
 	}
 
-	if c.vmmMgr.IsRunning(c.task.ID) {
+	switch {
+	case c.vmmMgr.IsRunning(c.task.ID):
 		status.PID = int32(c.vmmMgr.GetPID(c.task.ID))
 		status.ExitCode = 0
-	} else {
+	case c.exited.Load():
+		status.ExitCode = c.exitCode.Load()
+	default:
 		status.ExitCode = 1
 	}
 
@@ -961,6 +1542,16 @@ func (c *Controller) convertTask() *types.Task {
 		Env:     containerSpec.Container.Env,
 	}
 
+	if hc := containerSpec.Container.Healthcheck; hc != nil {
+		container.Healthcheck = &types.HealthConfig{
+			Test:    hc.Test,
+			Retries: int(hc.Retries),
+		}
+		container.Healthcheck.Interval, _ = gogotypes.DurationFromProto(hc.Interval)
+		container.Healthcheck.Timeout, _ = gogotypes.DurationFromProto(hc.Timeout)
+		container.Healthcheck.StartPeriod, _ = gogotypes.DurationFromProto(hc.StartPeriod)
+	}
+
 	// Convert mounts
 	var mounts []types.Mount
 	for _, m := range containerSpec.Container.Mounts {
@@ -1013,35 +1604,138 @@ func (c *Controller) convertTask() *types.Task {
 			DriverConfig: driverConfig,
 		}
 
+		// The allocator records the overlay's VNI so every node agrees on it
+		var vni uint32
+		if n.Network.DriverState != nil {
+			if v, err := strconv.ParseUint(n.Network.DriverState.Options["vxlan_vni"], 10, 32); err == nil {
+				vni = uint32(v)
+			}
+		}
+
+		subnet, gateway := ipv4IPAMConfig(n.Network)
 		networks = append(networks, types.NetworkAttachment{
 			Network: types.Network{
-				ID:   n.Network.ID,
-				Spec: netSpec,
+				ID:      n.Network.ID,
+				Spec:    netSpec,
+				VNI:     vni,
+				Subnet:  subnet,
+				Gateway: gateway,
 			},
 			Addresses: n.Addresses,
 		})
 	}
 
+	// Payloads come from the stores the agent fills for assigned tasks
+	secrets := convertSecrets(c.task)
+	if c.secrets != nil {
+		for i := range secrets {
+			if secret, err := c.secrets.Get(secrets[i].ID); err == nil {
+				secrets[i].Data = secret.Spec.Data
+			}
+		}
+	}
+	configs := convertConfigs(c.task)
+	if c.configs != nil {
+		for i := range configs {
+			if config, err := c.configs.Get(configs[i].ID); err == nil {
+				configs[i].Data = config.Spec.Data
+			}
+		}
+	}
+
 	return &types.Task{
-		ID:        c.task.ID,
-		ServiceID: c.task.ServiceID,
-		NodeID:    c.task.NodeID,
+		ID:          c.task.ID,
+		ServiceID:   c.task.ServiceID,
+		ServiceName: c.task.ServiceAnnotations.Name,
+		Slot:        c.task.Slot,
+		NodeID:      c.task.NodeID,
 		Spec: types.TaskSpec{
 			Runtime:   container,
 			Resources: *resources,
+			Placement: convertPlacement(c.task),
 		},
 		Networks: networks,
-		Secrets:  convertSecrets(c.task),
-		Configs:  convertConfigs(c.task),
+		Secrets:  secrets,
+		Configs:  configs,
+		Labels:   c.task.ServiceAnnotations.Labels,
+		Ports:    convertPorts(c.task),
 	}
 }
 
+// checkPayloads makes sure the agent delivered every secret and config the
+// task references.
+func (c *Controller) checkPayloads(task *types.Task) error {
+	for _, secret := range task.Secrets {
+		if c.secrets == nil {
+			return fmt.Errorf("secret %s is not available: no secret store", secret.Name)
+		}
+		if _, err := c.secrets.Get(secret.ID); err != nil {
+			return fmt.Errorf("secret %s is not available: %w", secret.Name, err)
+		}
+	}
+	for _, config := range task.Configs {
+		if c.configs == nil {
+			return fmt.Errorf("config %s is not available: no config store", config.Name)
+		}
+		if _, err := c.configs.Get(config.ID); err != nil {
+			return fmt.Errorf("config %s is not available: %w", config.Name, err)
+		}
+	}
+	return nil
+}
+
 // Helper functions
 
+// convertPlacement copies the task's placement constraints, which the
+// scheduler has already matched against this node.
+func convertPlacement(task *api.Task) types.Placement {
+	if task.Spec.Placement == nil {
+		return types.Placement{}
+	}
+	return types.Placement{Constraints: task.Spec.Placement.Constraints}
+}
+
+// convertPorts converts the task's published endpoint ports.
+func convertPorts(task *api.Task) []types.PortConfig {
+	if task.Endpoint == nil {
+		return nil
+	}
+
+	var ports []types.PortConfig
+	for _, p := range task.Endpoint.Ports {
+		if p == nil || p.PublishedPort == 0 {
+			continue
+		}
+		ports = append(ports, types.PortConfig{
+			Name:          p.Name,
+			Protocol:      strings.ToLower(p.Protocol.String()),
+			TargetPort:    p.TargetPort,
+			PublishedPort: p.PublishedPort,
+		})
+	}
+	return ports
+}
+
+// ipv4IPAMConfig returns the subnet and gateway the allocator assigned to a
+// network's first IPv4 pool.
+func ipv4IPAMConfig(n *api.Network) (subnet, gateway string) {
+	if n.IPAM == nil {
+		return "", ""
+	}
+	for _, cfg := range n.IPAM.Configs {
+		if cfg == nil {
+			continue
+		}
+		if _, ipNet, err := net.ParseCIDR(cfg.Subnet); err == nil && ipNet.IP.To4() != nil {
+			return ipNet.String(), cfg.Gateway
+		}
+	}
+	return "", ""
+}
+
 // convertSecrets converts SwarmKit secret references to internal SecretRef types.
-// Note: Secret data is not available at the executor level in SwarmKit —
-// the agent must fetch it from the manager's secret store. For now, we
-// just convert the references so they can be injected during Prepare.
+// The task only carries references; convertTask fills in the data from the
+// secrets the agent stored in the executor.
 func convertSecrets(task *api.Task) []types.SecretRef {
 	var secrets []types.SecretRef
 
@@ -1052,25 +1746,28 @@ func convertSecrets(task *api.Task) []types.SecretRef {
 
 	for _, sr := range containerSpec.Container.Secrets {
 		target := "/run/secrets/" + sr.SecretName
+		ref := types.SecretRef{
+			ID:   sr.SecretID,
+			Name: sr.SecretName,
+		}
 		if fileTarget, ok := sr.Target.(*api.SecretReference_File); ok && fileTarget.File != nil {
 			if fileTarget.File.Name != "" {
 				target = fileTarget.File.Name
 			}
+			ref.UID = fileTarget.File.UID
+			ref.GID = fileTarget.File.GID
+			ref.Mode = fileTarget.File.Mode
 		}
-		secrets = append(secrets, types.SecretRef{
-			ID:     sr.SecretID,
-			Name:   sr.SecretName,
-			Target: target,
-			// Data will be fetched by the agent from the manager's secret store
-		})
+		ref.Target = target
+		secrets = append(secrets, ref)
 	}
 
 	return secrets
 }
 
 // convertConfigs converts SwarmKit config references to internal ConfigRef types.
-// Note: Config data is not available at the executor level in SwarmKit —
-// the agent must fetch it from the manager's config store.
+// The task only carries references; convertTask fills in the data from the
+// configs the agent stored in the executor.
 func convertConfigs(task *api.Task) []types.ConfigRef {
 	var configs []types.ConfigRef
 
@@ -1081,17 +1778,20 @@ func convertConfigs(task *api.Task) []types.ConfigRef {
 
 	for _, cr := range containerSpec.Container.Configs {
 		target := "/config/" + cr.ConfigName
+		ref := types.ConfigRef{
+			ID:   cr.ConfigID,
+			Name: cr.ConfigName,
+		}
 		if fileTarget, ok := cr.Target.(*api.ConfigReference_File); ok && fileTarget.File != nil {
 			if fileTarget.File.Name != "" {
 				target = fileTarget.File.Name
 			}
+			ref.UID = fileTarget.File.UID
+			ref.GID = fileTarget.File.GID
+			ref.Mode = fileTarget.File.Mode
 		}
-		configs = append(configs, types.ConfigRef{
-			ID:     cr.ConfigID,
-			Name:   cr.ConfigName,
-			Target: target,
-			// Data will be fetched by the agent from the manager's config store
-		})
+		ref.Target = target
+		configs = append(configs, ref)
 	}
 
 	return configs
@@ -1104,7 +1804,7 @@ func hostname() string {
 	return "localhost"
 }
 
-// Close cleans up executor resources (dnsmasq, VXLAN peer discovery).
+// Close cleans up executor resources (DHCP/DNS servers, VXLAN peer discovery).
 func (e *Executor) Close() error {
 	zerolog_log.Info().Msg("Closing SwarmKit executor")
 
@@ -1117,7 +1817,12 @@ func (e *Executor) Close() error {
 		}
 	}
 
-	// Shutdown network manager (kills dnsmasq, stops VXLAN discovery)
+	// Destroy the pooled VMs, which no task owns
+	if vmm, ok := e.vmmMgr.(*VMMManager); ok {
+		vmm.Close()
+	}
+
+	// Shutdown network manager (stops DHCP/DNS, stops VXLAN discovery)
 	if nm, ok := e.networkMgr.(*network.NetworkManager); ok {
 		if err := nm.Shutdown(); err != nil {
 			zerolog_log.Warn().Err(err).Msg("Failed to shutdown network manager")
@@ -1136,13 +1841,8 @@ func (e *Executor) kvmAvailable() bool {
 
 // archSupported checks if the architecture is supported by Firecracker
 func (e *Executor) archSupported() bool {
-	// Firecracker supports x86_64 and aarch64
-	switch runtime.GOARCH {
-	case "amd64", "arm64":
-		return true
-	default:
-		return false
-	}
+	_, err := arch.Host()
+	return err == nil
 }
 
 // getCPUs returns the available CPU count in nanocpus (SwarmKit format)
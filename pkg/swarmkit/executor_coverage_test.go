@@ -9,8 +9,12 @@ import (
 	"testing"
 
 	"github.com/moby/swarmkit/v2/api"
+	"github.com/restuhaqza/swarmcracker/pkg/ext4"
+	"github.com/restuhaqza/swarmcracker/pkg/storage"
 	"github.com/restuhaqza/swarmcracker/pkg/types"
+	"github.com/rs/zerolog"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 // TestExecutor_Configure tests Configure method
@@ -422,38 +426,37 @@ func TestController_syncVolumeData(t *testing.T) {
 	})
 }
 
-// TestController_mountRootfs tests mountRootfs errors
-func TestController_mountRootfs(t *testing.T) {
-	t.Run("mount non-existent image", func(t *testing.T) {
-		ctrl := &Controller{
-			task:   &api.Task{ID: "task-1"},
-			config: &Config{},
-			mu:     sync.Mutex{},
-		}
-
-		_, err := ctrl.mountRootfs("/nonexistent/path.ext4")
-		assert.Error(t, err)
-	})
-}
-
-// TestController_unmountRootfs tests unmountRootfs
-func TestController_unmountRootfs(t *testing.T) {
-	t.Run("unmount cleans up directory", func(t *testing.T) {
-		tmpDir := t.TempDir()
-		mountDir := filepath.Join(tmpDir, "mount-test")
-		os.MkdirAll(mountDir, 0755)
-
-		ctrl := &Controller{
-			task:   &api.Task{ID: "task-1"},
-			config: &Config{},
-			mu:     sync.Mutex{},
-		}
-
-		err := ctrl.unmountRootfs(mountDir)
-		assert.NoError(t, err)
-		_, err = os.Stat(mountDir)
-		assert.True(t, os.IsNotExist(err))
-	})
+// TestController_syncVolumeData_FromImage tests that volume data written
+// inside the rootfs image is synced back to the host volume
+func TestController_syncVolumeData_FromImage(t *testing.T) {
+	ctx := context.Background()
+	vm, err := storage.NewVolumeManager(t.TempDir())
+	require.NoError(t, err)
+	vol, err := vm.CreateVolume(ctx, "appdata", "task-1", 0)
+	require.NoError(t, err)
+
+	src := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(src, "data"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(src, "data", "out.txt"), []byte("written by guest"), 0644))
+	rootfs := filepath.Join(t.TempDir(), "rootfs.ext4")
+	require.NoError(t, ext4.CreateFromDir(rootfs, src, ext4.Options{Size: 8 << 20}))
+
+	ctrl := &Controller{
+		task:      &api.Task{ID: "task-1"},
+		config:    &Config{},
+		volumeMgr: vm,
+		logger:    zerolog.Nop(),
+	}
+	task := &types.Task{Annotations: map[string]string{"rootfs": rootfs}}
+	mounts := []types.Mount{{Source: "appdata", Target: "/data"}}
+	require.NoError(t, ctrl.syncVolumeData(ctx, task, mounts))
+
+	// Mounting the volume elsewhere shows the synced data
+	check := t.TempDir()
+	require.NoError(t, vm.MountVolume(ctx, vol, check, "/data"))
+	data, err := os.ReadFile(filepath.Join(check, "data", "out.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "written by guest", string(data))
 }
 
 // mockNetworkManagerFull implements full NetworkManager interface
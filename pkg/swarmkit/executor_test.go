@@ -1,10 +1,17 @@
 package swarmkit
 
 import (
+	"net"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
+	gogotypes "github.com/gogo/protobuf/types"
 	"github.com/moby/swarmkit/v2/api"
+	"github.com/restuhaqza/swarmcracker/pkg/types"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestController_convertTask_NetworkDriver(t *testing.T) {
@@ -54,7 +61,14 @@ func TestController_convertTask_NetworkDriver(t *testing.T) {
 						Annotations: api.Annotations{Name: "my-bridge"},
 					},
 					DriverState: &api.Driver{
-						Name: "bridge",
+						Name:    "bridge",
+						Options: map[string]string{"vxlan_vni": "4097"},
+					},
+					IPAM: &api.IPAMOptions{
+						Configs: []*api.IPAMConfig{
+							{Subnet: "fd00:9::/64"},
+							{Subnet: "192.168.1.0/24", Gateway: "192.168.1.1"},
+						},
 					},
 				},
 				Addresses: []string{"192.168.1.2/24"},
@@ -77,6 +91,9 @@ func TestController_convertTask_NetworkDriver(t *testing.T) {
 	assert.Equal(t, 1, len(internalTask2.Networks))
 	assert.Equal(t, "bridge", internalTask2.Networks[0].Network.Spec.Driver)
 	assert.Equal(t, "my-bridge", internalTask2.Networks[0].Network.Spec.Name)
+	assert.Equal(t, uint32(4097), internalTask2.Networks[0].Network.VNI)
+	assert.Equal(t, "192.168.1.0/24", internalTask2.Networks[0].Network.Subnet)
+	assert.Equal(t, "192.168.1.1", internalTask2.Networks[0].Network.Gateway)
 
 	// Default fallback
 	skTask3 := &api.Task{
@@ -108,4 +125,74 @@ func TestController_convertTask_NetworkDriver(t *testing.T) {
 	internalTask3 := ctrl3.convertTask()
 	assert.Equal(t, 1, len(internalTask3.Networks))
 	assert.Equal(t, "bridge", internalTask3.Networks[0].Network.Spec.Driver, "Should default to bridge")
+	assert.Zero(t, internalTask3.Networks[0].Network.VNI)
+}
+
+func TestConvertTask_Healthcheck(t *testing.T) {
+	ctrl := &Controller{task: &api.Task{
+		ID: "test-task-health",
+		Spec: api.TaskSpec{
+			Runtime: &api.TaskSpec_Container{
+				Container: &api.ContainerSpec{
+					Image: "nginx",
+					Healthcheck: &api.HealthConfig{
+						Test:        []string{"CMD", "curl", "-f", "localhost"},
+						Interval:    gogotypes.DurationProto(10 * time.Second),
+						StartPeriod: gogotypes.DurationProto(time.Minute),
+						Retries:     5,
+					},
+				},
+			},
+		},
+	}}
+
+	container, err := ctrl.convertTask().Spec.GetContainer()
+	require.NoError(t, err)
+	assert.Equal(t, &types.HealthConfig{
+		Test:        []string{"CMD", "curl", "-f", "localhost"},
+		Interval:    10 * time.Second,
+		StartPeriod: time.Minute,
+		Retries:     5,
+	}, container.Healthcheck)
+}
+
+func TestConvertTask_Placement(t *testing.T) {
+	ctrl := &Controller{task: &api.Task{
+		ID: "test-task-placement",
+		Spec: api.TaskSpec{
+			Runtime: &api.TaskSpec_Container{Container: &api.ContainerSpec{Image: "nginx"}},
+			Placement: &api.Placement{
+				Constraints: []string{"node.labels.kvm==true"},
+				MaxReplicas: 2,
+			},
+		},
+	}}
+	assert.Equal(t, []string{"node.labels.kvm==true"}, ctrl.convertTask().Spec.Placement.Constraints)
+
+	ctrl.task.Spec.Placement = nil
+	assert.Empty(t, ctrl.convertTask().Spec.Placement.Constraints)
+}
+
+func TestVMRunning(t *testing.T) {
+	// Unix socket paths are short, so keep the directory out of t.TempDir()
+	dir, err := os.MkdirTemp("", "sc-sock")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	isRunning := vmRunning(dir)
+
+	live, err := net.Listen("unix", filepath.Join(dir, "live.sock"))
+	require.NoError(t, err)
+	defer live.Close()
+	assert.True(t, isRunning("live"))
+
+	// A crashed Firecracker leaves its socket file behind
+	crashed, err := net.ListenUnix("unix", &net.UnixAddr{Name: filepath.Join(dir, "crashed.sock"), Net: "unix"})
+	require.NoError(t, err)
+	crashed.SetUnlinkOnClose(false)
+	require.NoError(t, crashed.Close())
+	_, err = os.Stat(filepath.Join(dir, "crashed.sock"))
+	require.NoError(t, err)
+	assert.False(t, isRunning("crashed"))
+
+	assert.False(t, isRunning("missing"))
 }
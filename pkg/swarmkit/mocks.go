@@ -6,7 +6,9 @@ import (
 	"context"
 	"os/exec"
 
+	"github.com/restuhaqza/swarmcracker/pkg/healthcheck"
 	"github.com/restuhaqza/swarmcracker/pkg/types"
+	"github.com/restuhaqza/swarmcracker/pkg/vmexit"
 )
 
 // MockVMMManager is a mock implementation for testing.
@@ -22,6 +24,7 @@ type MockVMMManager struct {
 	DescribeFunc            func(ctx context.Context, task *types.Task) (*types.TaskStatus, error)
 	GetRunningProcessesFunc func() map[string]*exec.Cmd
 	RemoveProcessFunc       func(taskID string)
+	GuestStatusFunc         func(taskID string) vmexit.Status
 	processes               map[string]*exec.Cmd
 }
 
@@ -74,6 +77,13 @@ func (m *MockVMMManager) CheckVMAPIHealth(ctx context.Context, taskID string) bo
 	return true
 }
 
+func (m *MockVMMManager) GuestStatus(taskID string) vmexit.Status {
+	if m.GuestStatusFunc != nil {
+		return m.GuestStatusFunc(taskID)
+	}
+	return vmexit.Status{Ready: true, Health: healthcheck.Healthy}
+}
+
 func (m *MockVMMManager) IsRunning(taskID string) bool {
 	if m.IsRunningFunc != nil {
 		return m.IsRunningFunc(taskID)
@@ -13,7 +13,6 @@ import (
 	"github.com/restuhaqza/swarmcracker/pkg/network"
 	"github.com/restuhaqza/swarmcracker/pkg/storage"
 	"github.com/restuhaqza/swarmcracker/pkg/types"
-	"github.com/rs/zerolog"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -1130,33 +1129,6 @@ func TestController_NilSecretManager(t *testing.T) {
 	assert.True(t, err == nil || ctrl.internalTask != nil)
 }
 
-// TestMountRootfs_ErrorHandling tests mountRootfs error handling
-func TestMountRootfs_ErrorHandling(t *testing.T) {
-	ctrl := &Controller{
-		logger: zerolog.Nop(),
-	}
-
-	// Test with non-existent image
-	_, err := ctrl.mountRootfs("/nonexistent/path.ext4")
-	assert.Error(t, err, "Should fail with non-existent image")
-
-	// Test with invalid path
-	_, err = ctrl.mountRootfs("/dev/null")
-	assert.Error(t, err, "Should fail with invalid image")
-}
-
-// TestUnmountRootfs_ErrorHandling tests unmountRootfs error handling
-func TestUnmountRootfs_ErrorHandling(t *testing.T) {
-	ctrl := &Controller{
-		logger: zerolog.Nop(),
-	}
-
-	// Test with non-existent directory
-	err := ctrl.unmountRootfs("/nonexistent/mount-point")
-	// Should not error, just logs warning
-	assert.NoError(t, err, "Unmount should not error on non-existent path")
-}
-
 // TestPrepare_WithSecretsOnly tests Prepare with only secrets (no configs)
 func TestPrepare_WithSecretsOnly(t *testing.T) {
 	if testing.Short() {
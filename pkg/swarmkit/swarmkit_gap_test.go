@@ -835,8 +835,9 @@ func TestControllerRemove(t *testing.T) {
 	ctrl, err := NewController(task, cfg, imagePrep, networkMgr, vmmMgr, volumeMgr, secretMgr)
 	require.NoError(t, err)
 
-	// Create test rootfs file
-	rootfsPath := filepath.Join(rootfsDir, taskID+".ext4")
+	// Create the task's rootfs copy
+	rootfsPath := filepath.Join(rootfsDir, "tasks", taskID+".ext4")
+	require.NoError(t, os.MkdirAll(filepath.Dir(rootfsPath), 0755))
 	err = os.WriteFile(rootfsPath, []byte("test rootfs"), 0644)
 	require.NoError(t, err)
 
@@ -860,73 +861,6 @@ func TestControllerRemove(t *testing.T) {
 	assert.False(t, ctrl.prepared, "Prepared flag should be false")
 }
 
-// TestMountRootfsUnmount tests the mountRootfs and unmountRootfs methods
-func TestMountRootfsUnmount(t *testing.T) {
-	tempDir := t.TempDir()
-	stateDir := filepath.Join(tempDir, "state")
-
-	cfg := &Config{
-		FirecrackerPath: "firecracker",
-		KernelPath:      "/usr/share/firecracker/vmlinux",
-		RootfsDir:       filepath.Join(tempDir, "rootfs"),
-		SocketDir:       filepath.Join(tempDir, "sockets"),
-		StateDir:        stateDir,
-		DefaultVCPUs:    1,
-		DefaultMemoryMB: 512,
-		BridgeName:      "swarm-br0",
-		Subnet:          "192.168.127.0/24",
-		BridgeIP:        "192.168.127.1/24",
-	}
-
-	imageCfg := &image.PreparerConfig{
-		RootfsDir: cfg.RootfsDir,
-	}
-	imagePrep := image.NewImagePreparer(imageCfg)
-
-	netCfg := types.NetworkConfig{
-		BridgeName: cfg.BridgeName,
-		Subnet:     cfg.Subnet,
-		BridgeIP:   cfg.BridgeIP,
-	}
-	networkMgr := network.NewNetworkManager(netCfg)
-
-	secretMgr := storage.NewSecretManager(
-		filepath.Join(stateDir, "secrets"),
-		filepath.Join(stateDir, "configs"),
-	)
-
-	vmmMgr, err := NewVMMManager(cfg.FirecrackerPath, cfg.SocketDir)
-	require.NoError(t, err)
-
-	task := &api.Task{
-		ID:        "test-task-mount",
-		ServiceID: "test-service",
-		NodeID:    "test-node",
-		Spec: api.TaskSpec{
-			Runtime: &api.TaskSpec_Container{
-				Container: &api.ContainerSpec{
-					Image: "nginx:latest",
-				},
-			},
-		},
-	}
-
-	ctrl, err := NewController(task, cfg, imagePrep, networkMgr, vmmMgr, nil, secretMgr)
-	require.NoError(t, err)
-
-	// Test with non-existent image path (should fail gracefully)
-	imagePath := filepath.Join(tempDir, "nonexistent.ext4")
-
-	mountDir, err := ctrl.mountRootfs(imagePath)
-	assert.Error(t, err, "Mount should fail for non-existent image")
-	assert.Empty(t, mountDir, "Mount dir should be empty on error")
-
-	// Test unmountRootfs with non-existent directory (should not panic)
-	err = ctrl.unmountRootfs("/tmp/nonexistent-mount-xyz123")
-	// This should not crash, even if umount fails
-	assert.NoError(t, err, "Unmount should not return error even if directory doesn't exist")
-}
-
 // TestConvertSecrets tests the convertSecrets function
 func TestConvertSecrets(t *testing.T) {
 	tests := []struct {
@@ -1099,6 +1033,33 @@ func TestConvertConfigs(t *testing.T) {
 	}
 }
 
+// TestConvertSecrets_FileTarget tests that file ownership and mode are carried over
+func TestConvertSecrets_FileTarget(t *testing.T) {
+	file := &api.FileTarget{Name: "/run/secrets/pg_pass", UID: "70", GID: "71", Mode: 0440}
+	task := &api.Task{
+		Spec: api.TaskSpec{
+			Runtime: &api.TaskSpec_Container{
+				Container: &api.ContainerSpec{
+					Secrets: []*api.SecretReference{
+						{SecretID: "secret-1", SecretName: "db", Target: &api.SecretReference_File{File: file}},
+					},
+					Configs: []*api.ConfigReference{
+						{ConfigID: "config-1", ConfigName: "app", Target: &api.ConfigReference_File{File: file}},
+					},
+				},
+			},
+		},
+	}
+
+	secrets := convertSecrets(task)
+	require.Len(t, secrets, 1)
+	assert.Equal(t, types.SecretRef{ID: "secret-1", Name: "db", Target: "/run/secrets/pg_pass", UID: "70", GID: "71", Mode: 0440}, secrets[0])
+
+	configs := convertConfigs(task)
+	require.Len(t, configs, 1)
+	assert.Equal(t, types.ConfigRef{ID: "config-1", Name: "app", Target: "/run/secrets/pg_pass", UID: "70", GID: "71", Mode: 0440}, configs[0])
+}
+
 // TestNewExecutorNilConfig tests NewExecutor with nil config
 func TestNewExecutorNilConfig(t *testing.T) {
 	exec, err := NewExecutor(nil)
@@ -2,18 +2,68 @@
 package swarmkit
 
 import (
-	"crypto/sha256"
-	"encoding/hex"
 	"fmt"
+	"path/filepath"
 	"strings"
+	"time"
 
+	"github.com/restuhaqza/swarmcracker/pkg/arch"
+	"github.com/restuhaqza/swarmcracker/pkg/balloon"
+	"github.com/restuhaqza/swarmcracker/pkg/cpu"
+	"github.com/restuhaqza/swarmcracker/pkg/healthcheck"
+	"github.com/restuhaqza/swarmcracker/pkg/hugepages"
+	"github.com/restuhaqza/swarmcracker/pkg/kernel"
+	"github.com/restuhaqza/swarmcracker/pkg/metrics"
+	"github.com/restuhaqza/swarmcracker/pkg/mmds"
+	"github.com/restuhaqza/swarmcracker/pkg/network"
 	"github.com/restuhaqza/swarmcracker/pkg/types"
+	"github.com/restuhaqza/swarmcracker/pkg/warmpool"
 )
 
 // taskTranslatorImpl translates SwarmKit tasks to Firecracker VM configs.
 type taskTranslatorImpl struct {
 	kernelPath string
 	bridgeIP   string
+
+	// maxPacketsPerSec limits each interface's rx and tx packet rate; 0 disables it
+	maxPacketsPerSec int
+
+	// socketDir holds each VM's API socket, log and metrics files; empty
+	// leaves Firecracker's logger and metrics unconfigured
+	socketDir string
+
+	// Memory balloon defaults; the swarmcracker.balloon label overrides
+	// balloonEnabled per service
+	balloonEnabled       bool
+	balloonDeflateOnOOM  bool
+	balloonStatsInterval time.Duration
+
+	// Metadata service default, overridden per service by the
+	// swarmcracker.mmds label, and the node details put in the document
+	mmdsEnabled bool
+	mmdsOptions mmds.Options
+
+	// CPU template default, overridden per service by the
+	// swarmcracker.cpu.template label; cpuPinning allows exclusive cores
+	cpuTemplate        string
+	customCPUTemplates map[string]string
+	cpuPinning         bool
+
+	// Guest memory page size default, overridden per service by the
+	// swarmcracker.hugepages label
+	hugePages string
+
+	// Kernel catalog file; services pick its kernels with the
+	// swarmcracker.kernel label
+	kernelCatalog string
+
+	// Warm pool sizes per image, overridden per service by the
+	// swarmcracker.warmpool label; warmPool enables the pools
+	warmPool      bool
+	warmPoolSizes map[string]int
+
+	// Guest architecture; the zero value is the host's
+	arch arch.Arch
 }
 
 // NewTaskTranslator creates a new task translator.
@@ -28,6 +78,46 @@ func NewTaskTranslator(kernelPath, bridgeIP string) (types.TaskTranslator, error
 	}, nil
 }
 
+// newConfiguredTranslator creates a task translator from the executor
+// config, including the network rate limit.
+func newConfiguredTranslator(config *Config) (*taskTranslatorImpl, error) {
+	if config.KernelPath == "" {
+		return nil, fmt.Errorf("kernel path cannot be empty")
+	}
+
+	t := &taskTranslatorImpl{
+		kernelPath: config.KernelPath,
+		bridgeIP:   config.BridgeIP,
+		socketDir:  config.SocketDir,
+
+		balloonEnabled:       config.EnableBalloon,
+		balloonDeflateOnOOM:  config.BalloonDeflateOnOOM,
+		balloonStatsInterval: config.BalloonStatsInterval,
+
+		mmdsEnabled: config.EnableMMDS,
+		mmdsOptions: mmds.Options{
+			Hostname:       config.Hostname,
+			Peers:          config.VXLANPeers,
+			IncludeSecrets: config.MMDSIncludeSecrets,
+			IncludeConfigs: config.MMDSIncludeConfigs,
+		},
+
+		cpuTemplate:        config.CPUTemplate,
+		customCPUTemplates: config.CustomCPUTemplates,
+		cpuPinning:         config.CPUPinning,
+
+		hugePages:     config.HugePages,
+		kernelCatalog: config.KernelCatalog,
+
+		warmPool:      config.WarmPool && !config.EnableJailer,
+		warmPoolSizes: config.WarmPoolSizes,
+	}
+	if config.EnableRateLimit && config.MaxPacketsPerSec > 0 {
+		t.maxPacketsPerSec = config.MaxPacketsPerSec
+	}
+	return t, nil
+}
+
 // Translate converts a task to Firecracker VM configuration.
 func (t *taskTranslatorImpl) Translate(task *types.Task) (interface{}, error) {
 	// Validate task ID to prevent path traversal and injection
@@ -63,6 +153,10 @@ func (t *taskTranslatorImpl) Translate(task *types.Task) (interface{}, error) {
 		}
 	}
 
+	if err := network.CheckGuestAddresses(task); err != nil {
+		return nil, err
+	}
+
 	// Build boot args with network config if available
 	bootArgs := t.buildBootArgs(task)
 
@@ -87,18 +181,223 @@ func (t *taskTranslatorImpl) Translate(task *types.Task) (interface{}, error) {
 		"network-interfaces": t.buildNetworkInterfaces(task),
 	}
 
+	if err := t.applyKernel(task, config); err != nil {
+		return nil, err
+	}
+
+	template, err := cpu.ResolveTemplate(t.cpuTemplate, t.customCPUTemplates, task.Labels)
+	if err != nil {
+		return nil, err
+	}
+	if template.Static != "" {
+		config["machine-config"].(map[string]interface{})["cpu_template"] = template.Static
+	}
+	if template.CustomPath != "" {
+		config["cpu-config"] = template.CustomPath
+	}
+
+	exclusive, err := cpu.Exclusive(task.Labels)
+	if err != nil {
+		return nil, err
+	}
+	if exclusive {
+		if !t.cpuPinning {
+			return nil, fmt.Errorf("service asks for exclusive CPUs (%s) but CPU pinning is disabled on this node", cpu.ExclusiveLabel)
+		}
+		// One dedicated core per vCPU, allocated when the VM starts
+		config["cpu-exclusive"] = true
+	}
+
+	pageSize, err := hugepages.Resolve(t.hugePages, task.Labels)
+	if err != nil {
+		return nil, err
+	}
+	if pageSize != "" {
+		if _, withInitrd := config["boot-source"].(map[string]interface{})["initrd_path"]; withInitrd {
+			return nil, fmt.Errorf("huge pages cannot be used with an initrd")
+		}
+		// Checked against the host pool when the VM starts
+		machineConfig := config["machine-config"].(map[string]interface{})
+		machineConfig["huge_pages"] = pageSize
+		machineConfig["mem_size_mib"] = hugepages.Align(pageSize, memoryMB)
+	}
+
+	withBalloon, err := balloon.Enabled(t.balloonEnabled, task.Labels)
+	if err != nil {
+		return nil, err
+	}
+	// Firecracker cannot balloon huge page backed memory
+	if withBalloon && pageSize == "" {
+		// Starts deflated; the reclaimer inflates it under host memory pressure
+		config["balloon"] = map[string]interface{}{
+			"amount_mib":               0,
+			"deflate_on_oom":           t.balloonDeflateOnOOM,
+			"stats_polling_interval_s": int(t.balloonStatsInterval / time.Second),
+		}
+	}
+
+	withMMDS, err := mmds.Enabled(t.mmdsEnabled, task.Labels)
+	if err != nil {
+		return nil, err
+	}
+	if withMMDS && len(task.Networks) > 0 {
+		// Guests reach the metadata service through their first interface
+		opts := t.mmdsOptions
+		opts.Gateway = t.gateway()
+		config["mmds-config"] = mmds.Config([]string{"eth0"})
+		config["mmds"] = mmds.Contents(mmds.Build(task, opts))
+	}
+
+	if t.warmPool {
+		size, err := warmpool.Size(t.warmPoolSizes, taskImage(task), task.Labels)
+		if err != nil {
+			return nil, err
+		}
+		// Pooled VMs get their network configuration from the metadata
+		// service; exclusive cores and huge pages are set up at boot.
+		// Secrets, configs and volumes are written into the rootfs on the
+		// host, which a pooled guest has already mounted.
+		if size > 0 && withMMDS && len(task.Networks) > 0 && !exclusive && pageSize == "" && !writesRootfs(task) {
+			config["warm-pool"] = size
+		}
+	}
+
+	if t.socketDir != "" {
+		socketPath := filepath.Join(t.socketDir, task.ID+".sock")
+		config["logger"] = map[string]interface{}{
+			"log_path": metrics.FirecrackerLogPath(socketPath),
+			"level":    "Info",
+		}
+		config["metrics"] = map[string]interface{}{
+			"metrics_path": metrics.FirecrackerMetricsPath(socketPath),
+		}
+	}
+
 	return config, nil
 }
 
+// writesRootfs reports whether preparing the task writes data into its
+// rootfs image on the host.
+func writesRootfs(task *types.Task) bool {
+	if len(task.Secrets) > 0 || len(task.Configs) > 0 {
+		return true
+	}
+	container, ok := task.Spec.Runtime.(*types.Container)
+	return ok && len(container.Mounts) > 0
+}
+
+// applyKernel boots the catalog kernel a service asks for, and records the
+// catalog checksums of the VM's kernel and initrd for verification before
+// boot. The node's default kernel is only verified if it is in the catalog.
+func (t *taskTranslatorImpl) applyKernel(task *types.Task, config map[string]interface{}) error {
+	if t.kernelCatalog == "" {
+		if name := task.Labels[kernel.Label]; name != "" {
+			return fmt.Errorf("service asks for kernel %q but this node has no kernel catalog", name)
+		}
+		return nil
+	}
+	catalog, err := kernel.Load(t.kernelCatalog)
+	if err != nil {
+		return err
+	}
+
+	k, ok, err := catalog.Resolve(task.Labels)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		if k, ok = catalog.Lookup(t.kernelPath); !ok {
+			return nil
+		}
+	}
+
+	bootSource := config["boot-source"].(map[string]interface{})
+	bootSource["kernel_image_path"] = k.Path
+	config["kernel-sha256"] = k.SHA256
+	if k.Initrd != "" {
+		bootSource["initrd_path"] = k.Initrd
+		config["initrd-sha256"] = k.InitrdSHA256
+	}
+	return nil
+}
+
+// appendBootArg adds arg to the kernel command line of a translated VM
+// config. Configs without a boot source are left alone.
+func appendBootArg(config interface{}, arg string) {
+	cfg, ok := config.(map[string]interface{})
+	if !ok || arg == "" {
+		return
+	}
+	bootSource, ok := cfg["boot-source"].(map[string]interface{})
+	if !ok {
+		return
+	}
+	args, _ := bootSource["boot_args"].(string)
+	bootSource["boot_args"] = strings.TrimSpace(args + " " + arg)
+}
+
+// balloonMemory returns the memory size of a translated VM config that has
+// a balloon device.
+func balloonMemory(config interface{}) (memMiB int, ok bool) {
+	cfg, ok := config.(map[string]interface{})
+	if !ok {
+		return 0, false
+	}
+	if _, ok := cfg["balloon"].(map[string]interface{}); !ok {
+		return 0, false
+	}
+	machine, _ := cfg["machine-config"].(map[string]interface{})
+	memMiB, ok = machine["mem_size_mib"].(int)
+	return memMiB, ok
+}
+
+// metadataDocument returns the metadata document of a translated VM config
+// that has the metadata service enabled.
+func metadataDocument(config interface{}) (*mmds.Document, bool) {
+	cfg, ok := config.(map[string]interface{})
+	if !ok {
+		return nil, false
+	}
+	contents, _ := cfg["mmds"].(map[string]interface{})
+	doc, ok := contents[mmds.Key].(*mmds.Document)
+	return doc, ok
+}
+
+// gateway returns the guests' default gateway: the bridge IP without its
+// prefix length.
+func (t *taskTranslatorImpl) gateway() string {
+	gw := t.bridgeIP
+	if idx := strings.Index(gw, "/"); idx > 0 {
+		gw = gw[:idx]
+	}
+	return gw
+}
+
+// guestArch returns the architecture guests boot as, the host's unless a
+// test set another.
+func (t *taskTranslatorImpl) guestArch() arch.Arch {
+	if t.arch.Name == "" {
+		return arch.Default()
+	}
+	return t.arch
+}
+
 // buildBootArgs builds kernel boot arguments with network config.
 func (t *taskTranslatorImpl) buildBootArgs(task *types.Task) string {
 	// Use /sbin/init (wrapper that calls tini with entrypoint)
 	// The preparer creates /sbin/init as a wrapper script
 	initPath := "/sbin/init"
-	baseArgs := fmt.Sprintf("console=ttyS0 reboot=k panic=1 pci=off nomodules init=%s", initPath)
+	baseArgs := fmt.Sprintf("%s nomodules init=%s", t.guestArch().KernelArgs(), initPath)
+
+	// Gateway is bridge IP from config
+	gw := t.gateway()
 
-	// Add network config if task has IP addresses
+	// Kernel-level config for eth0, kept so images that bring their own
+	// init (and never run our wrapper) still come up with an address
 	if len(task.Networks) > 0 && len(task.Networks[0].Addresses) > 0 {
+		// Overlays route through the network's own gateway
+		eth0Gateway := network.AttachmentGateway(task.Networks[0], gw)
+
 		// Parse IP from Addresses (format: "192.168.127.2/24")
 		addr := task.Networks[0].Addresses[0]
 		ipPart := addr
@@ -107,17 +406,25 @@ func (t *taskTranslatorImpl) buildBootArgs(task *types.Task) string {
 		}
 
 		// Kernel IP config format: ip=<ip>::<gw>:<netmask>::<iface>:off
-		// Gateway is bridge IP from config
-		gw := t.bridgeIP
-		if idx := strings.Index(gw, "/"); idx > 0 {
-			gw = gw[:idx] // Remove CIDR if present
-		}
 		mask := "255.255.255.0"
 
-		ipArg := fmt.Sprintf("ip=%s::%s:%s::eth0:off", ipPart, gw, mask)
+		ipArg := fmt.Sprintf("ip=%s::%s:%s::eth0:off", ipPart, eth0Gateway, mask)
 		baseArgs = baseArgs + " " + ipArg
 	}
 
+	// Full per-interface configuration (addresses, routes, MTU), applied by
+	// the init wrapper for every attachment
+	if guestArgs := network.BuildGuestNetworkConfig(task, gw).BootArgs(); len(guestArgs) > 0 {
+		baseArgs = baseArgs + " " + strings.Join(guestArgs, " ")
+	}
+
+	// The service's healthcheck, run in the guest by the init wrapper
+	if container, err := task.Spec.GetContainer(); err == nil {
+		if arg, ok := healthcheck.KernelArg(container.Healthcheck); ok {
+			baseArgs = baseArgs + " " + arg
+		}
+	}
+
 	return baseArgs
 }
 
@@ -125,18 +432,15 @@ func (t *taskTranslatorImpl) buildBootArgs(task *types.Task) string {
 func (t *taskTranslatorImpl) buildNetworkInterfaces(task *types.Task) []map[string]interface{} {
 	interfaces := []map[string]interface{}{}
 
-	// Generate TAP name hash (must match network manager logic)
-	hash := sha256.Sum256([]byte(task.ID))
-	hashStr := hex.EncodeToString(hash[:])
-
-	for i := range task.Networks {
-		ifaceID := fmt.Sprintf("eth%d", i)
-		tapName := fmt.Sprintf("tap-%s-%d", hashStr[:12], i)
-
+	for i, attachment := range task.Networks {
 		iface := map[string]interface{}{
-			"iface_id":      ifaceID,
-			"host_dev_name": tapName,
-			"guest_mac":     generateMAC(i),
+			"iface_id":      fmt.Sprintf("eth%d", i),
+			"host_dev_name": network.TapName(task.ID, i),
+			"guest_mac":     network.GuestMAC(task.ID, attachment.Network.ID, i),
+		}
+		if t.maxPacketsPerSec > 0 {
+			iface["rx_rate_limiter"] = t.packetRateLimiter()
+			iface["tx_rate_limiter"] = t.packetRateLimiter()
 		}
 
 		interfaces = append(interfaces, iface)
@@ -145,15 +449,15 @@ func (t *taskTranslatorImpl) buildNetworkInterfaces(task *types.Task) []map[stri
 	return interfaces
 }
 
-// generateMAC creates a MAC address for a network interface.
-func generateMAC(index int) string {
-	// Generate a unique MAC address based on index
-	// Format: AA:FC:XX:XX:XX:XX where XX is derived from index
-	return fmt.Sprintf("AA:FC:%02X:%02X:%02X:%02X",
-		(byte(index)>>4)&0xFF,
-		byte(index)&0xFF,
-		(byte(index)>>2)&0xFF,
-		(byte(index)*3)&0xFF)
+// packetRateLimiter returns a Firecracker rate limiter allowing
+// maxPacketsPerSec operations (packets) per second.
+func (t *taskTranslatorImpl) packetRateLimiter() map[string]interface{} {
+	return map[string]interface{}{
+		"ops": map[string]interface{}{
+			"size":        t.maxPacketsPerSec,
+			"refill_time": 1000, // milliseconds
+		},
+	}
 }
 
 // getRootfsPath returns the rootfs path for a task.
@@ -1,9 +1,16 @@
 package swarmkit
 
 import (
+	"os"
+	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/restuhaqza/swarmcracker/pkg/arch"
+	"github.com/restuhaqza/swarmcracker/pkg/healthcheck"
+	"github.com/restuhaqza/swarmcracker/pkg/kernel"
 	"github.com/restuhaqza/swarmcracker/pkg/types"
 )
 
@@ -454,6 +461,7 @@ func TestBuildBootArgs(t *testing.T) {
 			if err != nil {
 				t.Fatalf("NewTaskTranslator() failed: %v", err)
 			}
+			translator.(*taskTranslatorImpl).arch = arch.AMD64
 
 			result, err := translator.Translate(tt.task)
 			if err != nil {
@@ -576,67 +584,168 @@ func TestBuildNetworkInterfaces(t *testing.T) {
 	}
 }
 
-func TestGenerateMAC(t *testing.T) {
+func TestBuildNetworkInterfaces_UniqueMACs(t *testing.T) {
+	translator, err := NewTaskTranslator("/test/kernel", "192.168.127.1/24")
+	if err != nil {
+		t.Fatalf("NewTaskTranslator() failed: %v", err)
+	}
+	impl := translator.(*taskTranslatorImpl)
+
+	newTask := func(id string) *types.Task {
+		return &types.Task{
+			ID: id,
+			Networks: []types.NetworkAttachment{
+				{Network: types.Network{ID: "net-frontend"}, Addresses: []string{"10.0.1.5/24"}},
+				{Network: types.Network{ID: "net-backend"}, Addresses: []string{"10.0.2.5/24"}},
+			},
+		}
+	}
+
+	seen := map[string]string{}
+	for _, id := range []string{"task-a", "task-b"} {
+		for _, iface := range impl.buildNetworkInterfaces(newTask(id)) {
+			mac := iface["guest_mac"].(string)
+			key := id + "/" + iface["iface_id"].(string)
+			if other, ok := seen[mac]; ok {
+				t.Errorf("MAC %s assigned to both %s and %s", mac, other, key)
+			}
+			seen[mac] = key
+		}
+	}
+
+	// Same task must keep the same MACs across translations
+	first := impl.buildNetworkInterfaces(newTask("task-a"))
+	second := impl.buildNetworkInterfaces(newTask("task-a"))
+	for i := range first {
+		if first[i]["guest_mac"] != second[i]["guest_mac"] {
+			t.Errorf("interface %d MAC not stable: %v vs %v", i, first[i]["guest_mac"], second[i]["guest_mac"])
+		}
+	}
+}
+
+// TestBuildBootArgs_Arch tests the base boot args follow the guest
+// architecture, whatever the host
+func TestBuildBootArgs_Arch(t *testing.T) {
 	tests := []struct {
-		name     string
-		index    int
-		expected string // optional exact value for deterministic cases
+		arch      arch.Arch
+		prefix    string
+		notInArgs []string
 	}{
-		{
-			name:  "index 0",
-			index: 0,
-		},
-		{
-			name:  "index 1",
-			index: 1,
-		},
-		{
-			name:  "index 2",
-			index: 2,
-		},
-		{
-			name:  "index 255",
-			index: 255,
-		},
+		{arch.AMD64, "console=ttyS0 reboot=k panic=1 pci=off nomodules init=/sbin/init", nil},
+		{arch.ARM64, "keep_bootcon console=ttyS0 reboot=k panic=1 nomodules init=/sbin/init", []string{"pci=off"}},
 	}
 
+	task := &types.Task{ID: "task-arch", Spec: types.TaskSpec{Runtime: &types.Container{}}}
 	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			mac := generateMAC(tt.index)
+		t.Run(tt.arch.Name, func(t *testing.T) {
+			translator := &taskTranslatorImpl{kernelPath: "/test/kernel", arch: tt.arch}
 
-			// Check format: AA:FC:XX:XX:XX:XX
-			if len(mac) != 17 {
-				t.Errorf("MAC length = %d, want 17", len(mac))
+			bootArgs := translator.buildBootArgs(task)
+			if !strings.HasPrefix(bootArgs, tt.prefix) {
+				t.Errorf("boot args = %q, want prefix %q", bootArgs, tt.prefix)
 			}
-
-			// Check prefix
-			if mac[:5] != "AA:FC" {
-				t.Errorf("MAC prefix = %s, want AA:FC", mac[:5])
+			for _, notExpected := range tt.notInArgs {
+				if contains(bootArgs, notExpected) {
+					t.Errorf("boot args contain %q: %s", notExpected, bootArgs)
+				}
 			}
+		})
+	}
+}
 
-			// Check colons
-			parts := strings.Split(mac, ":")
-			if len(parts) != 6 {
-				t.Errorf("MAC has %d parts, want 6", len(parts))
-			}
+func TestBuildBootArgs_AllInterfaces(t *testing.T) {
+	translator, err := NewTaskTranslator("/test/kernel", "192.168.127.1/24")
+	if err != nil {
+		t.Fatalf("NewTaskTranslator() failed: %v", err)
+	}
+	impl := translator.(*taskTranslatorImpl)
+
+	task := &types.Task{
+		ID: "task-multi",
+		Networks: []types.NetworkAttachment{
+			{Network: types.Network{ID: "net-1", Spec: types.NetworkSpec{Driver: "bridge"}}, Addresses: []string{"192.168.127.10/24"}},
+			{Network: types.Network{ID: "net-2", Spec: types.NetworkSpec{Driver: "overlay"}}, Addresses: []string{"10.0.9.4/24"}},
+		},
+	}
 
-			// Check deterministic: same index produces same MAC
-			mac2 := generateMAC(tt.index)
-			if mac != mac2 {
-				t.Errorf("generateMAC(%d) not deterministic: %s vs %s", tt.index, mac, mac2)
+	bootArgs := impl.buildBootArgs(task)
+	for _, want := range []string{
+		"swarmcracker.if=eth0,",
+		",1500,192.168.127.10/24",
+		"swarmcracker.if=eth1,",
+		",1450,10.0.9.4/24",
+		"swarmcracker.route=default,192.168.127.1,eth0",
+	} {
+		if !strings.Contains(bootArgs, want) {
+			t.Errorf("boot_args missing %q: %s", want, bootArgs)
+		}
+	}
+}
+
+func TestBuildBootArgs_OverlayGateway(t *testing.T) {
+	translator, err := NewTaskTranslator("/test/kernel", "192.168.127.1/24")
+	if err != nil {
+		t.Fatalf("NewTaskTranslator() failed: %v", err)
+	}
+	impl := translator.(*taskTranslatorImpl)
+
+	tests := []struct {
+		name    string
+		network types.Network
+		want    string
+	}{
+		{"gateway from IPAM", types.Network{ID: "net-1", Spec: types.NetworkSpec{Driver: "overlay"}, Subnet: "10.0.9.0/24", Gateway: "10.0.9.254"}, "10.0.9.254"},
+		{"first address of the subnet", types.Network{ID: "net-1", Spec: types.NetworkSpec{Driver: "overlay"}}, "10.0.9.1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			task := &types.Task{
+				ID:       "task-overlay",
+				Networks: []types.NetworkAttachment{{Network: tt.network, Addresses: []string{"10.0.9.4/24"}}},
 			}
 
-			// Check different indices produce different MACs (for small indices)
-			if tt.index < 10 {
-				macDiff := generateMAC(tt.index + 1)
-				if mac == macDiff {
-					t.Errorf("generateMAC(%d) == generateMAC(%d), want different", tt.index, tt.index+1)
+			bootArgs := impl.buildBootArgs(task)
+			for _, want := range []string{
+				"ip=10.0.9.4::" + tt.want + ":",
+				"swarmcracker.route=default," + tt.want + ",eth0",
+			} {
+				if !strings.Contains(bootArgs, want) {
+					t.Errorf("boot_args missing %q: %s", want, bootArgs)
 				}
 			}
+			if strings.Contains(bootArgs, "192.168.127.1") {
+				t.Errorf("boot_args route through the node bridge: %s", bootArgs)
+			}
 		})
 	}
 }
 
+func TestBuildBootArgs_Healthcheck(t *testing.T) {
+	translator, err := NewTaskTranslator("/test/kernel", "192.168.127.1/24")
+	if err != nil {
+		t.Fatalf("NewTaskTranslator() failed: %v", err)
+	}
+	impl := translator.(*taskTranslatorImpl)
+
+	task := &types.Task{
+		ID: "task-health",
+		Spec: types.TaskSpec{Runtime: &types.Container{
+			Image:       "nginx",
+			Healthcheck: &types.HealthConfig{Test: []string{"CMD-SHELL", "curl -f localhost"}},
+		}},
+	}
+	want, _ := healthcheck.KernelArg(task.Spec.Runtime.(*types.Container).Healthcheck)
+	if bootArgs := impl.buildBootArgs(task); !strings.HasSuffix(bootArgs, " "+want) {
+		t.Errorf("boot_args missing %q: %s", want, bootArgs)
+	}
+
+	task.Spec.Runtime.(*types.Container).Healthcheck.Test = []string{"NONE"}
+	if bootArgs := impl.buildBootArgs(task); strings.Contains(bootArgs, healthcheck.BootArg) {
+		t.Errorf("disabled healthcheck passed to the guest: %s", bootArgs)
+	}
+}
+
 func TestGetRootfsPath(t *testing.T) {
 	tests := []struct {
 		name         string
@@ -696,3 +805,538 @@ func TestGetRootfsPath(t *testing.T) {
 func contains(s, substr string) bool {
 	return strings.Contains(s, substr)
 }
+
+func TestAppendBootArg(t *testing.T) {
+	tests := []struct {
+		name   string
+		config interface{}
+		arg    string
+		want   string
+	}{
+		{"appends", map[string]interface{}{"boot-source": map[string]interface{}{"boot_args": "console=ttyS0"}}, "a=b", "console=ttyS0 a=b"},
+		{"empty args", map[string]interface{}{"boot-source": map[string]interface{}{}}, "a=b", "a=b"},
+		{"empty arg", map[string]interface{}{"boot-source": map[string]interface{}{"boot_args": "console=ttyS0"}}, "", "console=ttyS0"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			appendBootArg(tt.config, tt.arg)
+			got := tt.config.(map[string]interface{})["boot-source"].(map[string]interface{})["boot_args"]
+			if got != tt.want && !(tt.want == "" && got == nil) {
+				t.Errorf("boot_args = %v, want %q", got, tt.want)
+			}
+		})
+	}
+
+	// Configs without a boot source are left alone
+	appendBootArg("not a map", "a=b")
+	appendBootArg(map[string]interface{}{}, "a=b")
+}
+
+func TestTranslate_Balloon(t *testing.T) {
+	tests := []struct {
+		name        string
+		nodeDefault bool
+		labels      map[string]string
+		want        bool
+		wantErr     bool
+	}{
+		{"off by default", false, nil, false, false},
+		{"node default", true, nil, true, false},
+		{"label enables", false, map[string]string{"swarmcracker.balloon": "true"}, true, false},
+		{"label disables", true, map[string]string{"swarmcracker.balloon": "false"}, false, false},
+		{"invalid label", false, map[string]string{"swarmcracker.balloon": "yes please"}, false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			trans, err := newConfiguredTranslator(&Config{
+				KernelPath:           "/test/kernel",
+				EnableBalloon:        tt.nodeDefault,
+				BalloonDeflateOnOOM:  true,
+				BalloonStatsInterval: 5 * time.Second,
+			})
+			if err != nil {
+				t.Fatalf("newConfiguredTranslator() failed: %v", err)
+			}
+
+			task := &types.Task{
+				ID:     "task-balloon",
+				Labels: tt.labels,
+				Spec:   types.TaskSpec{Runtime: &types.Container{Image: "nginx:latest"}},
+			}
+			config, err := trans.Translate(task)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("Translate() expected error for invalid label")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Translate() failed: %v", err)
+			}
+
+			device, ok := config.(map[string]interface{})["balloon"].(map[string]interface{})
+			if ok != tt.want {
+				t.Fatalf("balloon present = %v, want %v", ok, tt.want)
+			}
+			memMiB, tracked := balloonMemory(config)
+			if tracked != tt.want {
+				t.Errorf("balloonMemory() ok = %v, want %v", tracked, tt.want)
+			}
+			if !tt.want {
+				return
+			}
+			if memMiB != 512 {
+				t.Errorf("balloonMemory() = %d, want 512", memMiB)
+			}
+			if device["amount_mib"] != 0 || device["deflate_on_oom"] != true || device["stats_polling_interval_s"] != 5 {
+				t.Errorf("unexpected balloon device: %v", device)
+			}
+		})
+	}
+}
+
+func TestTranslate_MMDS(t *testing.T) {
+	network := []types.NetworkAttachment{{
+		Network:   types.Network{ID: "net-1", Spec: types.NetworkSpec{Driver: "bridge"}},
+		Addresses: []string{"192.168.127.9/24"},
+	}}
+
+	tests := []struct {
+		name        string
+		nodeDefault bool
+		labels      map[string]string
+		networks    []types.NetworkAttachment
+		want        bool
+		wantErr     bool
+	}{
+		{"off by default", false, nil, network, false, false},
+		{"node default", true, nil, network, true, false},
+		{"label enables", false, map[string]string{"swarmcracker.mmds": "true"}, network, true, false},
+		{"label disables", true, map[string]string{"swarmcracker.mmds": "false"}, network, false, false},
+		{"needs a network", true, nil, nil, false, false},
+		{"invalid label", false, map[string]string{"swarmcracker.mmds": "on"}, network, false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			trans, err := newConfiguredTranslator(&Config{
+				KernelPath:         "/test/kernel",
+				BridgeIP:           "192.168.127.1/24",
+				Hostname:           "worker-1",
+				VXLANPeers:         []string{"10.0.0.2"},
+				EnableMMDS:         tt.nodeDefault,
+				MMDSIncludeSecrets: true,
+			})
+			if err != nil {
+				t.Fatalf("newConfiguredTranslator() failed: %v", err)
+			}
+
+			task := &types.Task{
+				ID:          "task-mmds",
+				ServiceName: "web",
+				Labels:      tt.labels,
+				Networks:    tt.networks,
+				Secrets:     []types.SecretRef{{Name: "token", Target: "/run/secrets/token", Data: []byte("s3cret")}},
+				Spec:        types.TaskSpec{Runtime: &types.Container{Image: "nginx:latest"}},
+			}
+			config, err := trans.Translate(task)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("Translate() expected error for invalid label")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Translate() failed: %v", err)
+			}
+
+			mmdsConfig, ok := config.(map[string]interface{})["mmds-config"].(map[string]interface{})
+			if ok != tt.want {
+				t.Fatalf("mmds-config present = %v, want %v", ok, tt.want)
+			}
+			doc, ok := metadataDocument(config)
+			if ok != tt.want {
+				t.Fatalf("metadataDocument() ok = %v, want %v", ok, tt.want)
+			}
+			if !tt.want {
+				return
+			}
+			if mmdsConfig["version"] != "V2" {
+				t.Errorf("mmds-config version = %v, want V2", mmdsConfig["version"])
+			}
+			if doc.Task.ID != "task-mmds" || doc.Service.Name != "web" || doc.Node.Hostname != "worker-1" {
+				t.Errorf("unexpected identity in document: %+v", doc)
+			}
+			if len(doc.Node.Peers) != 1 || doc.Node.Peers[0] != "10.0.0.2" {
+				t.Errorf("peers = %v, want [10.0.0.2]", doc.Node.Peers)
+			}
+			if len(doc.Network.Routes) != 1 || doc.Network.Routes[0].Gateway != "192.168.127.1" {
+				t.Errorf("routes = %+v, want default via 192.168.127.1", doc.Network.Routes)
+			}
+			if len(doc.Secrets) != 1 || string(doc.Secrets[0].Data) != "s3cret" {
+				t.Errorf("secrets = %+v, want the token payload", doc.Secrets)
+			}
+			if doc.Configs != nil {
+				t.Errorf("configs = %+v, want none", doc.Configs)
+			}
+		})
+	}
+}
+
+func TestTranslate_CPU(t *testing.T) {
+	tests := []struct {
+		name          string
+		nodeTemplate  string
+		pinning       bool
+		labels        map[string]string
+		wantTemplate  interface{}
+		wantCustom    interface{}
+		wantExclusive bool
+		wantErr       bool
+	}{
+		{"no template", "", false, nil, nil, nil, false, false},
+		{"node default", "T2S", false, nil, "T2S", nil, false, false},
+		{"label overrides", "T2S", false, map[string]string{"swarmcracker.cpu.template": "C3"}, "C3", nil, false, false},
+		{"label turns off", "T2S", false, map[string]string{"swarmcracker.cpu.template": "None"}, nil, nil, false, false},
+		{"custom template", "", false, map[string]string{"swarmcracker.cpu.template": "fleet"}, nil, "/etc/swarmcracker/fleet.json", false, false},
+		{"unknown template", "", false, map[string]string{"swarmcracker.cpu.template": "T9"}, nil, nil, false, true},
+		{"exclusive", "", true, map[string]string{"swarmcracker.cpu.exclusive": "true"}, nil, nil, true, false},
+		{"exclusive without pinning", "", false, map[string]string{"swarmcracker.cpu.exclusive": "true"}, nil, nil, false, true},
+		{"invalid exclusive", "", true, map[string]string{"swarmcracker.cpu.exclusive": "all"}, nil, nil, false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			trans, err := newConfiguredTranslator(&Config{
+				KernelPath:         "/test/kernel",
+				CPUTemplate:        tt.nodeTemplate,
+				CustomCPUTemplates: map[string]string{"fleet": "/etc/swarmcracker/fleet.json"},
+				CPUPinning:         tt.pinning,
+			})
+			if err != nil {
+				t.Fatalf("newConfiguredTranslator() failed: %v", err)
+			}
+
+			task := &types.Task{
+				ID:     "task-cpu",
+				Labels: tt.labels,
+				Spec:   types.TaskSpec{Runtime: &types.Container{Image: "nginx:latest"}},
+			}
+			config, err := trans.Translate(task)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("Translate() expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Translate() failed: %v", err)
+			}
+
+			cfg := config.(map[string]interface{})
+			machineConfig := cfg["machine-config"].(map[string]interface{})
+			if got := machineConfig["cpu_template"]; got != tt.wantTemplate {
+				t.Errorf("cpu_template = %v, want %v", got, tt.wantTemplate)
+			}
+			if got := cfg["cpu-config"]; got != tt.wantCustom {
+				t.Errorf("cpu-config = %v, want %v", got, tt.wantCustom)
+			}
+			if got := toBool(cfg["cpu-exclusive"]); got != tt.wantExclusive {
+				t.Errorf("cpu-exclusive = %v, want %v", got, tt.wantExclusive)
+			}
+		})
+	}
+}
+
+func TestTranslate_HugePages(t *testing.T) {
+	tests := []struct {
+		name        string
+		nodeDefault string
+		labels      map[string]string
+		wantPages   interface{}
+		wantMemMiB  int
+		wantBalloon bool
+		wantErr     bool
+	}{
+		{"off by default", "", nil, nil, 513, true, false},
+		{"node default", "2M", nil, "2M", 514, false, false},
+		{"label enables", "", map[string]string{"swarmcracker.hugepages": "2M"}, "2M", 514, false, false},
+		{"label disables", "2M", map[string]string{"swarmcracker.hugepages": "None"}, nil, 513, true, false},
+		{"invalid label", "", map[string]string{"swarmcracker.hugepages": "1G"}, nil, 0, false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			trans, err := newConfiguredTranslator(&Config{
+				KernelPath:    "/test/kernel",
+				HugePages:     tt.nodeDefault,
+				EnableBalloon: true,
+			})
+			if err != nil {
+				t.Fatalf("newConfiguredTranslator() failed: %v", err)
+			}
+
+			task := &types.Task{
+				ID:     "task-hugepages",
+				Labels: tt.labels,
+				Spec: types.TaskSpec{
+					Runtime:   &types.Container{Image: "nginx:latest"},
+					Resources: types.ResourceRequirements{Reservations: &types.Resources{MemoryBytes: 513 * 1024 * 1024}},
+				},
+			}
+			config, err := trans.Translate(task)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("Translate() expected error for invalid label")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Translate() failed: %v", err)
+			}
+
+			cfg := config.(map[string]interface{})
+			machineConfig := cfg["machine-config"].(map[string]interface{})
+			if got := machineConfig["huge_pages"]; got != tt.wantPages {
+				t.Errorf("huge_pages = %v, want %v", got, tt.wantPages)
+			}
+			if got := toInt(machineConfig["mem_size_mib"]); got != tt.wantMemMiB {
+				t.Errorf("mem_size_mib = %d, want %d", got, tt.wantMemMiB)
+			}
+			if _, got := cfg["balloon"]; got != tt.wantBalloon {
+				t.Errorf("balloon present = %v, want %v", got, tt.wantBalloon)
+			}
+		})
+	}
+}
+
+func TestTranslate_Kernel(t *testing.T) {
+	dir := t.TempDir()
+	writeFile := func(name, content string) (string, string) {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		sum, err := kernel.Checksum(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return path, sum
+	}
+	defaultPath, defaultSum := writeFile("vmlinux", "default")
+	ltsPath, ltsSum := writeFile("vmlinux-5.10", "lts")
+	initrdPath, initrdSum := writeFile("initrd-5.10", "initrd")
+
+	catalog, err := kernel.Load(filepath.Join(dir, "catalog.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, k := range []kernel.Kernel{
+		{Name: "default", Arch: kernel.HostArch(), Path: defaultPath, SHA256: defaultSum},
+		{Name: "5.10-lts", Arch: kernel.HostArch(), Path: ltsPath, SHA256: ltsSum, Initrd: initrdPath, InitrdSHA256: initrdSum},
+	} {
+		if err := catalog.Add(k); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := catalog.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		catalog    string
+		kernelPath string
+		labels     map[string]string
+		wantKernel string
+		wantInitrd interface{}
+		wantSums   []interface{}
+		wantErr    bool
+	}{
+		{"no catalog", "", "/test/kernel", nil, "/test/kernel", nil, []interface{}{nil, nil}, false},
+		{"label without catalog", "", "/test/kernel", map[string]string{"swarmcracker.kernel": "5.10-lts"}, "", nil, nil, true},
+		{"default kernel not in catalog", catalog.Path(), "/test/kernel", nil, "/test/kernel", nil, []interface{}{nil, nil}, false},
+		{"default kernel in catalog", catalog.Path(), defaultPath, nil, defaultPath, nil, []interface{}{defaultSum, nil}, false},
+		{"label picks kernel", catalog.Path(), defaultPath, map[string]string{"swarmcracker.kernel": "5.10-lts"}, ltsPath, initrdPath, []interface{}{ltsSum, initrdSum}, false},
+		{"unknown kernel", catalog.Path(), defaultPath, map[string]string{"swarmcracker.kernel": "4.14"}, "", nil, nil, true},
+		{"huge pages with initrd", catalog.Path(), defaultPath, map[string]string{"swarmcracker.kernel": "5.10-lts", "swarmcracker.hugepages": "2M"}, "", nil, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			trans, err := newConfiguredTranslator(&Config{
+				KernelPath:    tt.kernelPath,
+				KernelCatalog: tt.catalog,
+			})
+			if err != nil {
+				t.Fatalf("newConfiguredTranslator() failed: %v", err)
+			}
+
+			task := &types.Task{
+				ID:     "task-kernel",
+				Labels: tt.labels,
+				Spec:   types.TaskSpec{Runtime: &types.Container{Image: "nginx:latest"}},
+			}
+			config, err := trans.Translate(task)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("Translate() expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Translate() failed: %v", err)
+			}
+
+			cfg := config.(map[string]interface{})
+			bootSource := cfg["boot-source"].(map[string]interface{})
+			if got := bootSource["kernel_image_path"]; got != tt.wantKernel {
+				t.Errorf("kernel_image_path = %v, want %v", got, tt.wantKernel)
+			}
+			if got := bootSource["initrd_path"]; got != tt.wantInitrd {
+				t.Errorf("initrd_path = %v, want %v", got, tt.wantInitrd)
+			}
+			if got := []interface{}{cfg["kernel-sha256"], cfg["initrd-sha256"]}; !reflect.DeepEqual(got, tt.wantSums) {
+				t.Errorf("checksums = %v, want %v", got, tt.wantSums)
+			}
+		})
+	}
+}
+
+func TestTranslate_WarmPool(t *testing.T) {
+	network := []types.NetworkAttachment{{
+		Network:   types.Network{ID: "net-1", Spec: types.NetworkSpec{Driver: "bridge"}},
+		Addresses: []string{"192.168.127.9/24"},
+	}}
+
+	tests := []struct {
+		name     string
+		enabled  bool
+		mmds     bool
+		labels   map[string]string
+		networks []types.NetworkAttachment
+		modify   func(task *types.Task)
+		want     interface{}
+		wantErr  bool
+	}{
+		{"node size", true, true, nil, network, nil, 2, false},
+		{"pools disabled", false, true, nil, network, nil, nil, false},
+		{"label sets size", true, true, map[string]string{"swarmcracker.warmpool": "5"}, network, nil, 5, false},
+		{"label turns off", true, true, map[string]string{"swarmcracker.warmpool": "0"}, network, nil, nil, false},
+		{"needs the metadata service", true, false, nil, network, nil, nil, false},
+		{"needs a network", true, true, nil, nil, nil, nil, false},
+		{"no huge pages", true, true, map[string]string{"swarmcracker.hugepages": "2M"}, network, nil, nil, false},
+		{"invalid label", true, true, map[string]string{"swarmcracker.warmpool": "lots"}, network, nil, nil, true},
+		{"no secrets", true, true, nil, network, func(task *types.Task) {
+			task.Secrets = []types.SecretRef{{ID: "s1", Name: "db-password"}}
+		}, nil, false},
+		{"no configs", true, true, nil, network, func(task *types.Task) {
+			task.Configs = []types.ConfigRef{{ID: "c1", Name: "nginx.conf"}}
+		}, nil, false},
+		{"no volume mounts", true, true, nil, network, func(task *types.Task) {
+			task.Spec.Runtime.(*types.Container).Mounts = []types.Mount{{Source: "data", Target: "/data"}}
+		}, nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			trans, err := newConfiguredTranslator(&Config{
+				KernelPath:    "/test/kernel",
+				BridgeIP:      "192.168.127.1/24",
+				EnableMMDS:    tt.mmds,
+				WarmPool:      tt.enabled,
+				WarmPoolSizes: map[string]int{"nginx:latest": 2},
+			})
+			if err != nil {
+				t.Fatalf("newConfiguredTranslator() failed: %v", err)
+			}
+
+			task := &types.Task{
+				ID:       "task-warm",
+				Labels:   tt.labels,
+				Networks: tt.networks,
+				Spec:     types.TaskSpec{Runtime: &types.Container{Image: "nginx:latest"}},
+			}
+			if tt.modify != nil {
+				tt.modify(task)
+			}
+			config, err := trans.Translate(task)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("Translate() expected error for invalid label")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Translate() failed: %v", err)
+			}
+
+			if got := config.(map[string]interface{})["warm-pool"]; got != tt.want {
+				t.Errorf("warm-pool = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGoldenConfig(t *testing.T) {
+	trans, err := newConfiguredTranslator(&Config{
+		KernelPath:    "/test/kernel",
+		BridgeIP:      "192.168.127.1/24",
+		SocketDir:     "/run/firecracker",
+		EnableMMDS:    true,
+		WarmPool:      true,
+		WarmPoolSizes: map[string]int{"nginx:latest": 1},
+	})
+	if err != nil {
+		t.Fatalf("newConfiguredTranslator() failed: %v", err)
+	}
+	task := &types.Task{
+		ID: "task-golden",
+		Networks: []types.NetworkAttachment{{
+			Network:   types.Network{ID: "net-1", Spec: types.NetworkSpec{Driver: "bridge"}},
+			Addresses: []string{"192.168.127.9/24"},
+		}},
+		Spec: types.TaskSpec{Runtime: &types.Container{Image: "nginx:latest"}},
+	}
+	config, err := trans.Translate(task)
+	if err != nil {
+		t.Fatalf("Translate() failed: %v", err)
+	}
+	cfg := config.(map[string]interface{})
+	appendBootArg(cfg, "swarmcracker.traceparent=00-abc-def-01")
+
+	golden := goldenConfig(cfg)
+	for _, key := range []string{"logger", "metrics", "warm-pool"} {
+		if _, ok := golden[key]; ok {
+			t.Errorf("golden config has %s", key)
+		}
+	}
+	if mmds := golden["mmds"].(map[string]interface{}); len(mmds) != 0 {
+		t.Errorf("golden mmds = %v, want empty", mmds)
+	}
+	args := golden["boot-source"].(map[string]interface{})["boot_args"].(string)
+	if !strings.HasSuffix(args, " swarmcracker.warm") {
+		t.Errorf("golden boot_args = %q, want swarmcracker.warm", args)
+	}
+	for _, arg := range []string{"ip=", "swarmcracker.if=", "swarmcracker.route=", "swarmcracker.traceparent="} {
+		if strings.Contains(args, arg) {
+			t.Errorf("golden boot_args = %q, has %s", args, arg)
+		}
+	}
+
+	// The task's config is left alone
+	taskArgs := cfg["boot-source"].(map[string]interface{})["boot_args"].(string)
+	if !strings.Contains(taskArgs, "swarmcracker.if=") {
+		t.Errorf("task boot_args = %q, lost its network config", taskArgs)
+	}
+
+	spec := warmSpec(task, cfg)
+	if spec.Image != "nginx:latest" || spec.Kernel != "/test/kernel" || spec.Interfaces != 1 || spec.MemMiB != 512 {
+		t.Errorf("warmSpec() = %+v", spec)
+	}
+	if len(warmTap("warm-0123456789ab-1", 0)) > 15 {
+		t.Errorf("warmTap() = %q, longer than an interface name may be", warmTap("warm-0123456789ab-1", 0))
+	}
+}
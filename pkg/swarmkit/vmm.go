@@ -5,6 +5,7 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net"
@@ -17,12 +18,51 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/restuhaqza/swarmcracker/pkg/cpu"
+	"github.com/restuhaqza/swarmcracker/pkg/hugepages"
 	"github.com/restuhaqza/swarmcracker/pkg/jailer"
+	"github.com/restuhaqza/swarmcracker/pkg/kernel"
+	"github.com/restuhaqza/swarmcracker/pkg/metrics"
+	"github.com/restuhaqza/swarmcracker/pkg/security"
+	"github.com/restuhaqza/swarmcracker/pkg/tracing"
 	"github.com/restuhaqza/swarmcracker/pkg/types"
+	"github.com/restuhaqza/swarmcracker/pkg/vmexit"
+	"github.com/restuhaqza/swarmcracker/pkg/warmpool"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/attribute"
 )
 
+// ErrOOMKilled is wrapped by the error of a VM that exited because its
+// cgroup ran out of memory.
+var ErrOOMKilled = errors.New("VM was killed by the OOM killer")
+
+// ErrGuestOOMKilled is wrapped by the error of a workload killed by the
+// guest kernel's OOM killer.
+var ErrGuestOOMKilled = errors.New("workload was killed by the guest's OOM killer")
+
+// ErrKernelPanic is wrapped by the error of a VM whose guest kernel
+// panicked.
+var ErrKernelPanic = errors.New("guest kernel panicked")
+
+// ExitError is the error of a task whose workload did not exit cleanly. It
+// carries the workload's exit status, which SwarmKit reports as the
+// container's exit code.
+type ExitError struct {
+	Code int
+	Err  error
+}
+
+func (e *ExitError) Error() string { return e.Err.Error() }
+func (e *ExitError) Unwrap() error { return e.Err }
+
+// ExitCode implements SwarmKit's exec.ExitCoder.
+func (e *ExitError) ExitCode() int { return e.Code }
+
+// guestReadyTimeout bounds the guest.userspace span of a traced boot whose
+// init never reports ready.
+const guestReadyTimeout = 60 * time.Second
+
 // VMMManager manages Firecracker VM processes.
 type VMMManager struct {
 	firecrackerPath string
@@ -32,7 +72,11 @@ type VMMManager struct {
 	jailerConfig    *jailer.Config
 	jailer          *jailer.Jailer
 	cgroupMgr       *jailer.CgroupManager
+	cpuMgr          *cpu.Manager   // nil disables CPU pinning
+	pool            *warmpool.Pool // nil disables warm pools
+	seccompFilter   string         // compiled BPF for --seccomp-filter, "" keeps Firecracker's filters
 	processes       map[string]*exec.Cmd
+	consoles        map[string]*vmexit.Watcher // guest consoles by task, for exit statuses
 	processMutex    sync.Mutex
 	logger          zerolog.Logger
 }
@@ -50,6 +94,31 @@ type VMMManagerConfig struct {
 	CgroupVersion   string
 	EnableCgroups   bool
 	ResourceLimits  jailer.ResourceLimits
+
+	// CPU pinning: exclusive cores for VMs that ask for them, never taken
+	// from ReservedCPUs; allocations are kept in StateDir if set
+	CPUPinning   bool
+	ReservedCPUs string
+	StateDir     string
+
+	// Warm pools of VMs restored from golden snapshots kept in WarmPoolDir;
+	// not supported with the jailer
+	WarmPool              bool
+	WarmPoolDir           string
+	WarmPoolGoldenTimeout time.Duration
+
+	// Seccomp filter setting, see security.PrepareSeccompFilter; compiled
+	// filters are kept in StateDir, or SocketDir without one
+	SeccompFilter string
+}
+
+// firecrackerArgs returns the arguments of a directly started Firecracker.
+func (v *VMMManager) firecrackerArgs(socketPath, id string) []string {
+	args := []string{"--api-sock", socketPath, "--id", id}
+	if v.seccompFilter != "" {
+		args = append(args, "--seccomp-filter", v.seccompFilter)
+	}
+	return args
 }
 
 // toInt converts an interface{} value to int, handling both int and float64.
@@ -106,6 +175,41 @@ func NewVMMManagerWithConfig(cfg *VMMManagerConfig) (*VMMManager, error) {
 		logger:          log.With().Str("component", "vmm-manager").Logger(),
 	}
 
+	if cfg.SeccompFilter != "" {
+		dir := cfg.StateDir
+		if dir == "" {
+			dir = cfg.SocketDir
+		}
+		filter, err := security.PrepareSeccompFilter(context.Background(), cfg.SeccompFilter, dir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to prepare seccomp filter: %w", err)
+		}
+		v.seccompFilter = filter
+		v.logger.Info().Str("filter", filter).Msg("Custom seccomp filter enabled")
+	}
+
+	if cfg.CPUPinning {
+		topo, err := cpu.ReadTopology()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CPU topology: %w", err)
+		}
+		reserved, err := cpu.Parse(cfg.ReservedCPUs)
+		if err != nil {
+			return nil, fmt.Errorf("invalid reserved CPUs: %w", err)
+		}
+		v.cpuMgr = cpu.NewManager(topo, reserved)
+		if cfg.StateDir != "" {
+			if err := v.cpuMgr.Persist(filepath.Join(cfg.StateDir, "cpus.json")); err != nil {
+				return nil, err
+			}
+		}
+		v.logger.Info().
+			Str("cpus", topo.CPUs().String()).
+			Int("numa_nodes", len(topo.Nodes)).
+			Str("reserved", reserved.String()).
+			Msg("CPU pinning enabled")
+	}
+
 	// Initialize jailer if enabled
 	if cfg.UseJailer {
 		v.logger.Info().Msg("Jailer mode enabled")
@@ -140,14 +244,15 @@ func NewVMMManagerWithConfig(cfg *VMMManagerConfig) (*VMMManager, error) {
 		}
 
 		v.jailerConfig = &jailer.Config{
-			FirecrackerPath: firecrackerPath,
-			JailerPath:      jailerPath,
-			ChrootBaseDir:   jailerChrootDir,
-			UID:             jailerUID,
-			GID:             jailerGID,
-			ParentCgroup:    cfg.ParentCgroup,
-			CgroupVersion:   cgroupVersion,
-			EnableSeccomp:   true,
+			FirecrackerPath:   firecrackerPath,
+			JailerPath:        jailerPath,
+			ChrootBaseDir:     jailerChrootDir,
+			UID:               jailerUID,
+			GID:               jailerGID,
+			ParentCgroup:      cfg.ParentCgroup,
+			CgroupVersion:     cgroupVersion,
+			EnableSeccomp:     true,
+			SeccompPolicyPath: v.seccompFilter,
 		}
 
 		// Create jailer instance
@@ -172,22 +277,111 @@ func NewVMMManagerWithConfig(cfg *VMMManagerConfig) (*VMMManager, error) {
 			Msg("Jailer initialized")
 	}
 
+	if cfg.WarmPool {
+		if cfg.UseJailer {
+			v.logger.Warn().Msg("Warm pools are not supported with the jailer, disabling them")
+		} else {
+			pool, err := warmpool.New(warmpool.Config{
+				Dir:           cfg.WarmPoolDir,
+				GoldenTimeout: cfg.WarmPoolGoldenTimeout,
+			}, &warmDriver{v: v})
+			if err != nil {
+				return nil, err
+			}
+			v.pool = pool
+			v.logger.Info().Str("dir", cfg.WarmPoolDir).Msg("Warm pools enabled")
+		}
+	}
+
 	return v, nil
 }
 
 // Start starts a Firecracker VM for the given task.
-func (v *VMMManager) Start(ctx context.Context, task *types.Task, config interface{}) error {
+func (v *VMMManager) Start(ctx context.Context, task *types.Task, config interface{}) (err error) {
 	v.logger.Info().
 		Str("task_id", task.ID).
 		Bool("jailer", v.useJailer).
 		Msg("Starting Firecracker VM")
 
+	ctx, span := tracing.Start(ctx, "vm.start", attribute.Bool("jailer", v.useJailer))
+	defer func() { tracing.End(span, err) }()
+
+	if cfg, ok := config.(map[string]interface{}); ok {
+		// Refuse VMs whose huge page backed memory the host pool cannot hold
+		machineConfig, _ := cfg["machine-config"].(map[string]interface{})
+		if pageSize, _ := machineConfig["huge_pages"].(string); pageSize != "" && pageSize != hugepages.None {
+			if err := hugepages.Check(pageSize, toInt(machineConfig["mem_size_mib"])); err != nil {
+				return err
+			}
+		}
+
+		// Boot only kernels that match their catalog checksums
+		if err := verifyBootFiles(cfg); err != nil {
+			return err
+		}
+	}
+
+	// Dedicated cores are taken before the VM exists and given back if it
+	// fails to start
+	if cfg, ok := config.(map[string]interface{}); ok && toBool(cfg["cpu-exclusive"]) {
+		machineConfig, _ := cfg["machine-config"].(map[string]interface{})
+		alloc, allocErr := v.cpuMgr.Allocate(task.ID, toInt(machineConfig["vcpu_count"]))
+		if allocErr != nil {
+			return fmt.Errorf("failed to allocate CPUs: %w", allocErr)
+		}
+		v.logger.Info().
+			Str("task_id", task.ID).
+			Str("cpus", alloc.CPUs.String()).
+			Int("numa_node", alloc.Node).
+			Msg("Allocated exclusive CPUs")
+		defer func() {
+			if err != nil {
+				v.cpuMgr.Release(task.ID)
+				return
+			}
+			v.rebalanceShared()
+		}()
+	}
+
 	if v.useJailer {
 		return v.startWithJailer(ctx, task, config)
 	}
+
+	// A pooled VM skips the boot; one that cannot be handed over is
+	// destroyed and the task boots cold
+	if cfg, ok := config.(map[string]interface{}); ok {
+		if vm := v.claimWarm(task, cfg); vm != nil {
+			driver := &warmDriver{v: v}
+			if err := v.releaseWarm(ctx, task, cfg, vm); err != nil {
+				driver.Destroy(vm)
+				v.logger.Warn().Err(err).Str("task_id", task.ID).Msg("Failed to release warm VM, booting cold")
+			} else {
+				if err := v.attachWarm(ctx, task, vm); err != nil {
+					driver.Destroy(vm)
+					return fmt.Errorf("failed to attach warm VM: %w", err)
+				}
+				span.SetAttributes(attribute.Bool("warm", true))
+				v.logger.Info().
+					Str("task_id", task.ID).
+					Str("vm", vm.ID).
+					Msg("Firecracker VM started from warm pool")
+				return nil
+			}
+		}
+	}
 	return v.startDirect(ctx, task, config)
 }
 
+// SetWarmPoolMetrics makes the warm pool record claims and sizes to m.
+func (v *VMMManager) SetWarmPoolMetrics(m warmpool.Metrics) {
+	v.pool.SetMetrics(m)
+}
+
+// Close stops filling the warm pool and destroys its VMs.
+func (v *VMMManager) Close() {
+	v.pool.Close()
+}
+
 // startDirect starts Firecracker without jailer (legacy mode).
 func (v *VMMManager) startDirect(ctx context.Context, task *types.Task, config interface{}) error {
 	// Create socket directory
@@ -206,15 +400,18 @@ func (v *VMMManager) startDirect(ctx context.Context, task *types.Task, config i
 	}()
 
 	// Start Firecracker process with caller's context for proper cancellation
-	cmd := exec.CommandContext(ctx, v.firecrackerPath,
-		"--api-sock", socketPath,
-		"--id", task.ID,
-	)
+	cmd := exec.CommandContext(ctx, v.firecrackerPath, v.firecrackerArgs(socketPath, task.ID)...)
 
-	cmd.Stdout = &logWriter{logger: v.logger}
+	// Stdout carries the guest console, where init reports userspace ready
+	// and the workload's exit
+	guest := tracing.NewGuestWatcher()
+	console := vmexit.NewWatcher()
+	cmd.Stdout = io.MultiWriter(&logWriter{logger: v.logger}, guest, console)
 	cmd.Stderr = &logWriter{logger: v.logger}
 
+	_, spawnSpan := tracing.Start(ctx, "firecracker.spawn")
 	if err := cmd.Start(); err != nil {
+		tracing.End(spawnSpan, err)
 		socketCleanupNeeded = true
 		return fmt.Errorf("failed to start firecracker: %w", err)
 	}
@@ -222,10 +419,22 @@ func (v *VMMManager) startDirect(ctx context.Context, task *types.Task, config i
 	// Store process reference
 	v.processMutex.Lock()
 	v.processes[task.ID] = cmd
+	v.setConsole(task.ID, console)
 	v.processMutex.Unlock()
 
+	// Place the VM before its vCPU threads exist, so they inherit it
+	cpus, _ := v.cpuPlacement(task.ID)
+	if err := v.pinThreads(task.ID, cmd.Process.Pid, cpus); err != nil {
+		tracing.End(spawnSpan, err)
+		cmd.Process.Kill()
+		socketCleanupNeeded = true
+		return err
+	}
+
 	// Wait for socket to be created
-	if err := v.waitForSocket(ctx, socketPath, 10*time.Second); err != nil {
+	err := v.waitForSocket(ctx, socketPath, 10*time.Second)
+	tracing.End(spawnSpan, err)
+	if err != nil {
 		cmd.Process.Kill()
 		socketCleanupNeeded = true
 		return fmt.Errorf("socket not created: %w", err)
@@ -237,6 +446,7 @@ func (v *VMMManager) startDirect(ctx context.Context, task *types.Task, config i
 		socketCleanupNeeded = true
 		return fmt.Errorf("failed to configure VM: %w", err)
 	}
+	tracing.TraceGuest(ctx, guest, time.Now(), guestReadyTimeout)
 
 	v.logger.Info().
 		Str("task_id", task.ID).
@@ -295,15 +505,20 @@ func (v *VMMManager) startWithJailer(ctx context.Context, task *types.Task, conf
 		return fmt.Errorf("rootfs path not found in drives")
 	}
 
+	initrdPath, _ := bootSource["initrd_path"].(string)
+
 	// Build jailer VM config
+	console := vmexit.NewWatcher()
 	jailerCfg := jailer.VMConfig{
 		TaskID:     task.ID,
 		VcpuCount:  toInt(machineConfig["vcpu_count"]),
 		MemoryMB:   toInt(machineConfig["mem_size_mib"]),
 		KernelPath: bootSource["kernel_image_path"].(string),
+		InitrdPath: initrdPath,
 		RootfsPath: rootfsPath,
 		BootArgs:   bootSource["boot_args"].(string),
 		HtEnabled:  toBool(machineConfig["smt"]), // Extract SMT from machine config
+		Console:    console,
 	}
 
 	// Start jailed VM
@@ -313,6 +528,8 @@ func (v *VMMManager) startWithJailer(ctx context.Context, task *types.Task, conf
 	}
 
 	// Apply cgroup limits if enabled
+	cpus, mems := v.cpuPlacement(task.ID)
+	placed := false
 	if v.cgroupMgr != nil && v.jailerConfig != nil {
 		// Create cgroup with resource limits
 		limits := jailer.ResourceLimits{
@@ -320,6 +537,8 @@ func (v *VMMManager) startWithJailer(ctx context.Context, task *types.Task, conf
 			MemoryMax:  int64(jailerCfg.MemoryMB) * 1024 * 1024,
 			MemoryHigh: int64(jailerCfg.MemoryMB) * 1024 * 1024 * 90 / 100, // 90% of max
 			IOWeight:   100,
+			CPUs:       cpus.String(),
+			Mems:       mems.String(),
 		}
 
 		if err := v.cgroupMgr.CreateCgroup(task.ID, limits); err != nil {
@@ -328,9 +547,17 @@ func (v *VMMManager) startWithJailer(ctx context.Context, task *types.Task, conf
 			// Add jailer process to cgroup
 			if err := v.cgroupMgr.AddProcess(task.ID, process.Pid); err != nil {
 				v.logger.Warn().Err(err).Msg("Failed to add process to cgroup")
+			} else {
+				placed = true
 			}
 		}
 	}
+	if !placed {
+		if err := v.pinThreads(task.ID, process.Pid, cpus); err != nil {
+			v.jailer.Stop(ctx, task.ID)
+			return err
+		}
+	}
 
 	// Store process reference (use jailer PID as proxy)
 	v.processMutex.Lock()
@@ -339,23 +566,14 @@ func (v *VMMManager) startWithJailer(ctx context.Context, task *types.Task, conf
 		Process: &os.Process{Pid: process.Pid},
 	}
 	v.processes[task.ID] = wrapperCmd
+	v.setConsole(task.ID, console)
 	v.processMutex.Unlock()
 
 	// Configure VM via API with chroot-relative paths
-	jailerConfig := map[string]interface{}{
-		"machine-config": machineConfig,
-		"boot-source": map[string]interface{}{
-			"kernel_image_path": "/kernel/vmlinux",
-			"boot_args":         bootSource["boot_args"],
-		},
-		"drives": []interface{}{
-			map[string]interface{}{
-				"drive_id":       "rootfs",
-				"path_on_host":   "/drives/rootfs.ext4",
-				"is_root_device": true,
-				"is_read_only":   false,
-			},
-		},
+	jailerConfig, err := jailedConfig(cfg, process.ChrootDir)
+	if err != nil {
+		v.jailer.Stop(ctx, task.ID)
+		return err
 	}
 
 	if err := v.configureVM(ctx, task, process.SocketPath, jailerConfig); err != nil {
@@ -374,13 +592,29 @@ func (v *VMMManager) startWithJailer(ctx context.Context, task *types.Task, conf
 }
 
 // configureVM configures the VM via Firecracker HTTP API
-func (v *VMMManager) configureVM(ctx context.Context, task *types.Task, socketPath string, config interface{}) error {
+func (v *VMMManager) configureVM(ctx context.Context, task *types.Task, socketPath string, config interface{}) (err error) {
+	ctx, span := tracing.Start(ctx, "firecracker.configure")
+	defer func() { tracing.End(span, err) }()
+
 	// Parse config from translator
 	cfg, ok := config.(map[string]interface{})
 	if !ok {
 		return fmt.Errorf("invalid config type: %T", config)
 	}
 
+	// Logger and metrics must be set before anything else so boot is covered
+	jailDir, _ := cfg["jail-dir"].(string)
+	if logger, ok := cfg["logger"].(map[string]interface{}); ok {
+		if err := v.configureOutput(ctx, socketPath, "/logger", logger, "log_path", jailDir); err != nil {
+			return fmt.Errorf("failed to set logger: %w", err)
+		}
+	}
+	if metricsCfg, ok := cfg["metrics"].(map[string]interface{}); ok {
+		if err := v.configureOutput(ctx, socketPath, "/metrics", metricsCfg, "metrics_path", jailDir); err != nil {
+			return fmt.Errorf("failed to set metrics: %w", err)
+		}
+	}
+
 	// 1. Set machine configuration
 	machineConfig, ok := cfg["machine-config"].(map[string]interface{})
 	if !ok {
@@ -389,6 +623,16 @@ func (v *VMMManager) configureVM(ctx context.Context, task *types.Task, socketPa
 	if err := v.putAPI(ctx, socketPath, "/machine-config", machineConfig); err != nil {
 		return fmt.Errorf("failed to set machine config: %w", err)
 	}
+	// A custom CPU template replaces the static one of the machine config
+	if templatePath, ok := cfg["cpu-config"].(string); ok {
+		template, err := cpu.LoadCustomTemplate(templatePath)
+		if err != nil {
+			return err
+		}
+		if err := v.putAPI(ctx, socketPath, "/cpu-config", template); err != nil {
+			return fmt.Errorf("failed to set CPU template: %w", err)
+		}
+	}
 
 	// 2. Set boot source
 	bootSource, ok := cfg["boot-source"].(map[string]interface{})
@@ -462,7 +706,25 @@ func (v *VMMManager) configureVM(ctx context.Context, task *types.Task, socketPa
 		v.logger.Warn().Msg("No network interfaces in config")
 	}
 
-	// 5. Start the VM
+	// 5. Add the memory balloon (if any)
+	if balloonCfg, ok := cfg["balloon"].(map[string]interface{}); ok {
+		if err := v.putAPI(ctx, socketPath, "/balloon", balloonCfg); err != nil {
+			return fmt.Errorf("failed to set balloon: %w", err)
+		}
+	}
+
+	// 6. Serve the metadata document (if any); the MMDS config names
+	// interfaces, so it must follow them
+	if mmdsCfg, ok := cfg["mmds-config"].(map[string]interface{}); ok {
+		if err := v.putAPI(ctx, socketPath, "/mmds/config", mmdsCfg); err != nil {
+			return fmt.Errorf("failed to configure MMDS: %w", err)
+		}
+		if err := v.putAPI(ctx, socketPath, "/mmds", cfg["mmds"]); err != nil {
+			return fmt.Errorf("failed to set MMDS metadata: %w", err)
+		}
+	}
+
+	// 7. Start the VM
 	action := Action{
 		ActionType: "InstanceStart",
 	}
@@ -477,6 +739,131 @@ func (v *VMMManager) configureVM(ctx context.Context, task *types.Task, socketPa
 	return nil
 }
 
+// configureOutput creates the file named by body[pathKey], which Firecracker
+// requires to exist, and PUTs body to the given endpoint. The file is then
+// kept bounded until it is removed. A jailed Firecracker's path is inside
+// its chroot at jailDir, and the file is created for the jail's user.
+func (v *VMMManager) configureOutput(ctx context.Context, socketPath, endpoint string, body map[string]interface{}, pathKey, jailDir string) error {
+	path, _ := body[pathKey].(string)
+	if path == "" {
+		return fmt.Errorf("missing %s", pathKey)
+	}
+	path = filepath.Join(jailDir, path)
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0640)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", path, err)
+	}
+	if jailDir != "" && v.jailerConfig != nil {
+		if err := f.Chown(v.jailerConfig.UID, v.jailerConfig.GID); err != nil {
+			f.Close()
+			return fmt.Errorf("failed to chown %s: %w", path, err)
+		}
+	}
+
+	if err := v.putAPI(ctx, socketPath, endpoint, body); err != nil {
+		f.Close()
+		return err
+	}
+	go v.boundOutput(f, outputTrimInterval)
+	return nil
+}
+
+// jailedConfig returns the config of a VM jailed in chrootDir: the
+// translator's sections, their host paths replaced by the chroot-relative
+// ones the jailer put the files at. The agent reads custom CPU templates, so
+// their paths stay host paths.
+func jailedConfig(cfg map[string]interface{}, chrootDir string) (map[string]interface{}, error) {
+	jailed := make(map[string]interface{}, len(cfg)+1)
+	for key, val := range cfg {
+		jailed[key] = val
+	}
+
+	bootSource, _ := cfg["boot-source"].(map[string]interface{})
+	jailedBoot := map[string]interface{}{
+		"kernel_image_path": "/kernel/vmlinux",
+		"boot_args":         bootSource["boot_args"],
+	}
+	if initrd, _ := bootSource["initrd_path"].(string); initrd != "" {
+		jailedBoot["initrd_path"] = "/kernel/initrd"
+	}
+	jailed["boot-source"] = jailedBoot
+	jailed["drives"] = []interface{}{
+		map[string]interface{}{
+			"drive_id":       "rootfs",
+			"path_on_host":   "/drives/rootfs.ext4",
+			"is_root_device": true,
+			"is_read_only":   false,
+		},
+	}
+
+	// Firecracker writes its log and metrics inside the chroot, which
+	// configureVM finds at jail-dir; the host paths link to them
+	for key, pathKey := range map[string]string{"logger": "log_path", "metrics": "metrics_path"} {
+		section, ok := cfg[key].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		out, err := jailOutput(section, pathKey, chrootDir)
+		if err != nil {
+			return nil, err
+		}
+		jailed[key] = out
+	}
+	jailed["jail-dir"] = chrootDir
+	return jailed, nil
+}
+
+// jailOutput returns the logger or metrics section of a jailed VM, which
+// writes the file section[pathKey] names under /run/firecracker in its
+// chroot instead, and links the host path to it for the file's readers.
+func jailOutput(section map[string]interface{}, pathKey, chrootDir string) (map[string]interface{}, error) {
+	hostPath, _ := section[pathKey].(string)
+	if hostPath == "" {
+		return nil, fmt.Errorf("missing %s", pathKey)
+	}
+	jailPath := filepath.Join("/run/firecracker", filepath.Base(hostPath))
+
+	os.Remove(hostPath)
+	if err := os.Symlink(filepath.Join(chrootDir, jailPath), hostPath); err != nil {
+		return nil, fmt.Errorf("failed to link %s into the jail: %w", hostPath, err)
+	}
+
+	jailed := make(map[string]interface{}, len(section))
+	for key, val := range section {
+		jailed[key] = val
+	}
+	jailed[pathKey] = jailPath
+	return jailed, nil
+}
+
+// outputTrimInterval is how often the files Firecracker writes its log and
+// metrics to are trimmed.
+const outputTrimInterval = 30 * time.Second
+
+// boundOutput trims f to metrics.OutputLimit every interval, so a VM's log
+// and metrics do not fill the tmpfs they live on, and closes f once it is
+// removed. Holding f open follows it when a claimed warm VM's files are
+// renamed.
+func (v *VMMManager) boundOutput(f *os.File, interval time.Duration) {
+	defer f.Close()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		info, err := f.Stat()
+		if err != nil {
+			return
+		}
+		if st, ok := info.Sys().(*syscall.Stat_t); ok && st.Nlink == 0 {
+			return
+		}
+		if err := metrics.TrimOutput(f, metrics.OutputLimit); err != nil {
+			v.logger.Warn().Err(err).Msg("Failed to trim Firecracker output, leaving it unbounded")
+			return
+		}
+	}
+}
+
 // waitForSocket waits for the Firecracker socket to be created.
 func (v *VMMManager) waitForSocket(ctx context.Context, socketPath string, timeout time.Duration) error {
 	ctx, cancel := context.WithTimeout(ctx, timeout)
@@ -597,10 +984,45 @@ func (v *VMMManager) Wait(ctx context.Context, task *types.Task) (*types.TaskSta
 	// Wait for process
 	err := cmd.Wait()
 
+	v.processMutex.Lock()
+	console := v.consoles[task.ID]
+	delete(v.consoles, task.ID)
+	v.processMutex.Unlock()
+
+	return exitStatus(err, console.Status(), v.oomKilled(task.ID)), nil
+}
+
+// exitStatus turns how a VM exited into its task's status: the exit the
+// guest reported if any, else the Firecracker process's. A host OOM kill
+// (oomKilled) or a guest kernel panic override both.
+func exitStatus(err error, exit vmexit.Status, oomKilled bool) *types.TaskStatus {
 	status := &types.TaskStatus{
 		Timestamp: time.Now().Unix(),
 	}
 
+	switch {
+	case err != nil && oomKilled:
+		err = &ExitError{Code: 137, Err: fmt.Errorf("%w: %v", ErrOOMKilled, err)}
+	case exit.Reported && exit.Signal() == 9 && exit.OOM:
+		err = &ExitError{Code: exit.Code, Err: ErrGuestOOMKilled}
+	case exit.Reported && exit.Signal() > 0:
+		err = &ExitError{Code: exit.Code, Err: fmt.Errorf("workload was killed by signal %d (%s)", exit.Signal(), syscall.Signal(exit.Signal()))}
+	case exit.Reported && exit.Code != 0:
+		err = &ExitError{Code: exit.Code, Err: fmt.Errorf("workload exited with status %d", exit.Code)}
+	case exit.Reported:
+		err = nil
+	case exit.Panic != "":
+		err = &ExitError{Code: 1, Err: fmt.Errorf("%w: %s", ErrKernelPanic, exit.Panic)}
+	}
+	// A VM that failed without an exit status exits 1, as it always did
+	var exitErr *ExitError
+	switch {
+	case errors.As(err, &exitErr):
+		status.ExitCode = exitErr.Code
+	case err != nil:
+		status.ExitCode = 1
+	}
+
 	if err != nil {
 		status.State = types.TaskStateFailed
 		status.Err = err
@@ -610,7 +1032,33 @@ func (v *VMMManager) Wait(ctx context.Context, task *types.Task) (*types.TaskSta
 		status.Message = "Task completed successfully"
 	}
 
-	return status, nil
+	return status
+}
+
+// setConsole records the console watcher of a task's VM.
+// v.processMutex must be held.
+func (v *VMMManager) setConsole(taskID string, console *vmexit.Watcher) {
+	if v.consoles == nil {
+		v.consoles = make(map[string]*vmexit.Watcher)
+	}
+	v.consoles[taskID] = console
+}
+
+// GuestStatus returns what the console of a task's VM has told so far,
+// including the health the init wrapper reports.
+func (v *VMMManager) GuestStatus(taskID string) vmexit.Status {
+	v.processMutex.Lock()
+	defer v.processMutex.Unlock()
+	return v.consoles[taskID].Status()
+}
+
+// oomKilled reports whether the task's cgroup recorded an OOM kill.
+func (v *VMMManager) oomKilled(taskID string) bool {
+	if v.cgroupMgr == nil {
+		return false
+	}
+	stats, err := v.cgroupMgr.GetStats(taskID)
+	return err == nil && stats.OOMKills > 0
 }
 
 // GetPID returns the PID of the Firecracker process for the given task.
@@ -731,11 +1179,107 @@ func (v *VMMManager) Remove(ctx context.Context, task *types.Task) error {
 
 	v.processMutex.Lock()
 	delete(v.processes, task.ID)
+	delete(v.consoles, task.ID)
 	v.processMutex.Unlock()
 
+	// Hand the VM's dedicated cores back to the shared VMs
+	if v.cpuMgr.Release(task.ID) {
+		v.rebalanceShared()
+	}
+
+	return nil
+}
+
+// verifyBootFiles checks a VM's kernel and initrd against the checksums
+// the translator took from the kernel catalog.
+func verifyBootFiles(cfg map[string]interface{}) error {
+	bootSource, _ := cfg["boot-source"].(map[string]interface{})
+	for _, f := range []struct{ pathKey, sumKey string }{
+		{"kernel_image_path", "kernel-sha256"},
+		{"initrd_path", "initrd-sha256"},
+	} {
+		sum, _ := cfg[f.sumKey].(string)
+		if sum == "" {
+			continue
+		}
+		path, _ := bootSource[f.pathKey].(string)
+		if err := kernel.VerifyFile(path, sum); err != nil {
+			return fmt.Errorf("refusing to boot: %w", err)
+		}
+	}
+	return nil
+}
+
+// ReconcileCPUs releases persisted CPU allocations of tasks that are no
+// longer running. It should be called once at startup.
+func (v *VMMManager) ReconcileCPUs(isRunning func(taskID string) bool) int {
+	released := v.cpuMgr.Reconcile(isRunning)
+	if released > 0 {
+		v.logger.Info().Int("released", released).Msg("Released CPU allocations of stopped tasks")
+	}
+	return released
+}
+
+// cpuPlacement returns the cores a VM runs on, and the NUMA node of its
+// memory for VMs with exclusive cores. Both are empty without pinning.
+func (v *VMMManager) cpuPlacement(taskID string) (cpus, mems cpu.Set) {
+	if alloc, ok := v.cpuMgr.Get(taskID); ok {
+		return alloc.CPUs, alloc.Mems()
+	}
+	return v.cpuMgr.Shared(), nil
+}
+
+// pinThreads confines a VM without a cgroup to cpus through thread
+// affinity. Failing to pin an exclusive VM is an error; a shared one only
+// loses its placement.
+func (v *VMMManager) pinThreads(taskID string, pid int, cpus cpu.Set) error {
+	if len(cpus) == 0 {
+		return nil
+	}
+	err := cpu.SetAffinity(pid, cpus)
+	if err == nil {
+		return nil
+	}
+	if _, exclusive := v.cpuMgr.Get(taskID); exclusive {
+		return fmt.Errorf("failed to pin VM to CPUs %s: %w", cpus, err)
+	}
+	v.logger.Warn().Err(err).Str("task_id", taskID).Msg("Failed to place VM on shared CPUs")
 	return nil
 }
 
+// rebalanceShared moves the VMs without exclusive cores to the current
+// shared pool after cores were allocated or released.
+func (v *VMMManager) rebalanceShared() {
+	if v.cpuMgr == nil {
+		return
+	}
+	shared := v.cpuMgr.Shared()
+
+	v.processMutex.Lock()
+	pids := make(map[string]int, len(v.processes))
+	for taskID, cmd := range v.processes {
+		if cmd.Process != nil {
+			pids[taskID] = cmd.Process.Pid
+		}
+	}
+	v.processMutex.Unlock()
+
+	for taskID, pid := range pids {
+		if _, exclusive := v.cpuMgr.Get(taskID); exclusive {
+			continue
+		}
+		var err error
+		if v.cgroupMgr != nil {
+			err = v.cgroupMgr.SetCPUs(taskID, shared.String())
+		} else {
+			err = cpu.SetAffinity(pid, shared)
+		}
+		if err != nil {
+			v.logger.Warn().Err(err).Str("task_id", taskID).Msg("Failed to move VM to shared CPUs")
+		}
+	}
+}
+
 // Describe returns the current status of the VM.
 func (v *VMMManager) Describe(ctx context.Context, task *types.Task) (*types.TaskStatus, error) {
 	v.processMutex.Lock()
@@ -812,6 +1356,22 @@ func createFirecrackerHTTPClient(socketPath string) *http.Client {
 
 // putAPI sends a PUT request to the Firecracker API
 func (v *VMMManager) putAPI(ctx context.Context, socketPath, path string, data interface{}) error {
+	return v.sendAPI(ctx, "PUT", socketPath, path, data)
+}
+
+// patchAPI sends a PATCH request to the Firecracker API
+func (v *VMMManager) patchAPI(ctx context.Context, socketPath, path string, data interface{}) error {
+	return v.sendAPI(ctx, "PATCH", socketPath, path, data)
+}
+
+// sendAPI sends a request with a JSON body to the Firecracker API
+func (v *VMMManager) sendAPI(ctx context.Context, method, socketPath, path string, data interface{}) (err error) {
+	ctx, span := tracing.Start(ctx, "firecracker.api",
+		attribute.String("http.request.method", method),
+		attribute.String("firecracker.endpoint", path),
+	)
+	defer func() { tracing.End(span, err) }()
+
 	client := createFirecrackerHTTPClient(socketPath)
 
 	jsonData, err := json.Marshal(data)
@@ -820,7 +1380,7 @@ func (v *VMMManager) putAPI(ctx context.Context, socketPath, path string, data i
 	}
 
 	url := fmt.Sprintf("http://localhost%s", path)
-	req, err := http.NewRequestWithContext(ctx, "PUT", url, bytes.NewReader(jsonData))
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(jsonData))
 	if err != nil {
 		return fmt.Errorf("failed to create request: %w", err)
 	}
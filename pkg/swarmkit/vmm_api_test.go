@@ -4,16 +4,28 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"sync"
+	"syscall"
 	"testing"
 	"time"
 
+	"github.com/restuhaqza/swarmcracker/pkg/cpu"
+	"github.com/restuhaqza/swarmcracker/pkg/hugepages"
+	"github.com/restuhaqza/swarmcracker/pkg/jailer"
+	"github.com/restuhaqza/swarmcracker/pkg/kernel"
+	"github.com/restuhaqza/swarmcracker/pkg/metrics"
+	"github.com/restuhaqza/swarmcracker/pkg/mmds"
 	"github.com/restuhaqza/swarmcracker/pkg/types"
+	"github.com/restuhaqza/swarmcracker/pkg/vmexit"
+	"github.com/restuhaqza/swarmcracker/pkg/warmpool"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -352,6 +364,40 @@ func TestVMMManager_waitForSocket(t *testing.T) {
 }
 
 // TestVMMManager_GetPID_VMM tests GetPID method
+func TestVMMManager_boundOutput(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "task-1.log")
+	size := 4 * metrics.OutputLimit
+	require.NoError(t, os.WriteFile(path, bytes.Repeat([]byte("x"), size), 0640))
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	require.NoError(t, err)
+
+	used := func() int64 {
+		var st syscall.Stat_t
+		require.NoError(t, syscall.Stat(path, &st))
+		return st.Blocks * 512
+	}
+
+	vmm := &VMMManager{processes: make(map[string]*exec.Cmd)}
+	done := make(chan struct{})
+	go func() {
+		vmm.boundOutput(f, 10*time.Millisecond)
+		close(done)
+	}()
+
+	require.Eventually(t, func() bool { return used() <= 2*metrics.OutputLimit }, 2*time.Second, 10*time.Millisecond)
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, int64(size), info.Size())
+
+	// Removing the file ends trimming
+	require.NoError(t, os.Remove(path))
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("boundOutput did not stop after the file was removed")
+	}
+}
+
 func TestVMMManager_GetPID_VMM(t *testing.T) {
 	t.Run("returns pid for existing process", func(t *testing.T) {
 		tmpDir := t.TempDir()
@@ -695,3 +741,387 @@ func TestLogWriterVMM(t *testing.T) {
 		assert.Equal(t, 0, n)
 	})
 }
+
+// TestVMMManager_configureVM_Balloon verifies the balloon is added before the VM starts
+func TestVMMManager_configureVM_Balloon(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "fc.sock")
+	listener, err := net.Listen("unix", socketPath)
+	require.NoError(t, err)
+
+	var mu sync.Mutex
+	var paths []string
+	var balloonBody map[string]interface{}
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		paths = append(paths, r.URL.Path)
+		if r.URL.Path == "/balloon" {
+			json.NewDecoder(r.Body).Decode(&balloonBody)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})}
+	go server.Serve(listener)
+	defer server.Close()
+
+	vmm := &VMMManager{socketDir: filepath.Dir(socketPath), processes: make(map[string]*exec.Cmd)}
+	config := map[string]interface{}{
+		"machine-config": map[string]interface{}{"vcpu_count": 1, "mem_size_mib": 512},
+		"boot-source":    map[string]interface{}{"kernel_image_path": "/vmlinux"},
+		"drives": []map[string]interface{}{
+			{"drive_id": "rootfs", "path_on_host": "/rootfs.ext4", "is_root_device": true},
+		},
+		"balloon": map[string]interface{}{"amount_mib": 0, "deflate_on_oom": true, "stats_polling_interval_s": 5},
+	}
+
+	require.NoError(t, vmm.configureVM(context.Background(), &types.Task{ID: "task-1"}, socketPath, config))
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []string{"/machine-config", "/boot-source", "/drives/rootfs", "/balloon", "/actions"}, paths)
+	assert.Equal(t, true, balloonBody["deflate_on_oom"])
+	assert.Equal(t, float64(5), balloonBody["stats_polling_interval_s"])
+}
+
+// TestVMMManager_configureVM_MMDS verifies the metadata service is set up
+// after the network interfaces and before the VM starts
+func TestVMMManager_configureVM_MMDS(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "fc.sock")
+	listener, err := net.Listen("unix", socketPath)
+	require.NoError(t, err)
+
+	var mu sync.Mutex
+	var paths []string
+	var mmdsBody map[string]map[string]interface{}
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		paths = append(paths, r.URL.Path)
+		if r.URL.Path == "/mmds" {
+			json.NewDecoder(r.Body).Decode(&mmdsBody)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})}
+	go server.Serve(listener)
+	defer server.Close()
+
+	vmm := &VMMManager{socketDir: filepath.Dir(socketPath), processes: make(map[string]*exec.Cmd)}
+	config := map[string]interface{}{
+		"machine-config": map[string]interface{}{"vcpu_count": 1, "mem_size_mib": 512},
+		"boot-source":    map[string]interface{}{"kernel_image_path": "/vmlinux"},
+		"drives": []map[string]interface{}{
+			{"drive_id": "rootfs", "path_on_host": "/rootfs.ext4", "is_root_device": true},
+		},
+		"network-interfaces": []map[string]interface{}{
+			{"iface_id": "eth0", "host_dev_name": "tap-task-1"},
+		},
+		"mmds-config": mmds.Config([]string{"eth0"}),
+		"mmds":        mmds.Contents(&mmds.Document{Version: mmds.Version, Task: mmds.Task{ID: "task-1"}}),
+	}
+
+	require.NoError(t, vmm.configureVM(context.Background(), &types.Task{ID: "task-1"}, socketPath, config))
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []string{"/machine-config", "/boot-source", "/drives/rootfs",
+		"/network-interfaces/eth0", "/mmds/config", "/mmds", "/actions"}, paths)
+	assert.Equal(t, map[string]interface{}{"id": "task-1"}, mmdsBody["swarmcracker"]["task"])
+}
+
+// TestVMMManager_configureVM_Jailed verifies a jailed VM gets every section
+// of the translated config, with its files at chroot-relative paths
+func TestVMMManager_configureVM_Jailed(t *testing.T) {
+	dir := t.TempDir()
+	socketDir := filepath.Join(dir, "run")
+	chrootDir := filepath.Join(dir, "jail", "root")
+	require.NoError(t, os.MkdirAll(socketDir, 0755))
+	require.NoError(t, os.MkdirAll(filepath.Join(chrootDir, "run", "firecracker"), 0755))
+
+	socketPath := filepath.Join(socketDir, "fc.sock")
+	listener, err := net.Listen("unix", socketPath)
+	require.NoError(t, err)
+
+	var mu sync.Mutex
+	var paths []string
+	bodies := make(map[string]map[string]interface{})
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		paths = append(paths, r.URL.Path)
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		bodies[r.URL.Path] = body
+		w.WriteHeader(http.StatusNoContent)
+	})}
+	go server.Serve(listener)
+	defer server.Close()
+
+	config := map[string]interface{}{
+		"machine-config": map[string]interface{}{"vcpu_count": 1, "mem_size_mib": 512},
+		"boot-source":    map[string]interface{}{"kernel_image_path": "/host/vmlinux", "initrd_path": "/host/initrd", "boot_args": "console=ttyS0"},
+		"drives": []map[string]interface{}{
+			{"drive_id": "task-1", "path_on_host": "/host/rootfs.ext4", "is_root_device": true},
+		},
+		"network-interfaces": []map[string]interface{}{
+			{"iface_id": "eth0", "host_dev_name": "tap-task-1"},
+		},
+		"balloon":     map[string]interface{}{"amount_mib": 0},
+		"mmds-config": mmds.Config([]string{"eth0"}),
+		"mmds":        mmds.Contents(&mmds.Document{Version: mmds.Version, Task: mmds.Task{ID: "task-1"}}),
+		"logger":      map[string]interface{}{"log_path": filepath.Join(socketDir, "task-1.log"), "level": "Info"},
+		"metrics":     map[string]interface{}{"metrics_path": filepath.Join(socketDir, "task-1.metrics")},
+	}
+
+	jailed, err := jailedConfig(config, chrootDir)
+	require.NoError(t, err)
+
+	vmm := &VMMManager{
+		socketDir:    socketDir,
+		processes:    make(map[string]*exec.Cmd),
+		jailerConfig: &jailer.Config{UID: os.Getuid(), GID: os.Getgid()},
+	}
+	require.NoError(t, vmm.configureVM(context.Background(), &types.Task{ID: "task-1"}, socketPath, jailed))
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []string{"/logger", "/metrics", "/machine-config", "/boot-source", "/drives/rootfs",
+		"/network-interfaces/eth0", "/balloon", "/mmds/config", "/mmds", "/actions"}, paths)
+	assert.Equal(t, "/kernel/vmlinux", bodies["/boot-source"]["kernel_image_path"])
+	assert.Equal(t, "/kernel/initrd", bodies["/boot-source"]["initrd_path"])
+	assert.Equal(t, "/drives/rootfs.ext4", bodies["/drives/rootfs"]["path_on_host"])
+	assert.Equal(t, "/run/firecracker/task-1.log", bodies["/logger"]["log_path"])
+	assert.Equal(t, "/run/firecracker/task-1.metrics", bodies["/metrics"]["metrics_path"])
+
+	// The output files are created in the chroot and read through the host paths
+	require.NoError(t, os.WriteFile(filepath.Join(chrootDir, "run", "firecracker", "task-1.metrics"), []byte("{}\n"), 0640))
+	data, err := os.ReadFile(filepath.Join(socketDir, "task-1.metrics"))
+	require.NoError(t, err)
+	assert.Equal(t, "{}\n", string(data))
+	assert.FileExists(t, filepath.Join(socketDir, "task-1.log"))
+}
+
+func TestVMMManager_configureVM_CPUTemplate(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "fc.sock")
+	listener, err := net.Listen("unix", socketPath)
+	require.NoError(t, err)
+
+	var mu sync.Mutex
+	var paths []string
+	var template map[string]interface{}
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		paths = append(paths, r.URL.Path)
+		if r.URL.Path == "/cpu-config" {
+			json.NewDecoder(r.Body).Decode(&template)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})}
+	go server.Serve(listener)
+	defer server.Close()
+
+	templatePath := filepath.Join(t.TempDir(), "fleet.json")
+	require.NoError(t, os.WriteFile(templatePath, []byte(`{"cpuid_modifiers": []}`), 0644))
+
+	vmm := &VMMManager{socketDir: filepath.Dir(socketPath), processes: make(map[string]*exec.Cmd)}
+	config := map[string]interface{}{
+		"machine-config": map[string]interface{}{"vcpu_count": 1, "mem_size_mib": 512},
+		"boot-source":    map[string]interface{}{"kernel_image_path": "/vmlinux"},
+		"drives": []map[string]interface{}{
+			{"drive_id": "rootfs", "path_on_host": "/rootfs.ext4", "is_root_device": true},
+		},
+		"cpu-config": templatePath,
+	}
+
+	require.NoError(t, vmm.configureVM(context.Background(), &types.Task{ID: "task-1"}, socketPath, config))
+
+	mu.Lock()
+	assert.Equal(t, []string{"/machine-config", "/cpu-config", "/boot-source", "/drives/rootfs", "/actions"}, paths)
+	assert.Equal(t, map[string]interface{}{"cpuid_modifiers": []interface{}{}}, template)
+	mu.Unlock()
+
+	// A broken template fails before the VM boots
+	config["cpu-config"] = filepath.Join(t.TempDir(), "missing.json")
+	assert.Error(t, vmm.configureVM(context.Background(), &types.Task{ID: "task-1"}, socketPath, config))
+}
+
+func TestVMMManager_Start_ExclusiveCPUs(t *testing.T) {
+	vmm := &VMMManager{
+		firecrackerPath: "/nonexistent/firecracker",
+		socketDir:       t.TempDir(),
+		processes:       make(map[string]*exec.Cmd),
+		cpuMgr:          cpu.NewManager(cpu.Topology{Nodes: map[int]cpu.Set{0: {0, 1, 2, 3}}}, cpu.Set{0}),
+	}
+	config := map[string]interface{}{
+		"machine-config": map[string]interface{}{"vcpu_count": 2, "mem_size_mib": 512},
+		"cpu-exclusive":  true,
+	}
+
+	// Cores are given back when the VM fails to start
+	err := vmm.Start(context.Background(), &types.Task{ID: "task-1"}, config)
+	require.Error(t, err)
+	_, ok := vmm.cpuMgr.Get("task-1")
+	assert.False(t, ok)
+
+	// A VM needing more cores than are free never starts
+	config["machine-config"] = map[string]interface{}{"vcpu_count": 4, "mem_size_mib": 512}
+	err = vmm.Start(context.Background(), &types.Task{ID: "task-2"}, config)
+	assert.ErrorIs(t, err, cpu.ErrInsufficientCPUs)
+
+	// Without pinning there is nothing to allocate from
+	vmm.cpuMgr = nil
+	err = vmm.Start(context.Background(), &types.Task{ID: "task-3"}, config)
+	assert.ErrorContains(t, err, "CPU pinning is not enabled")
+}
+
+func TestVMMManager_Start_HugePagesUnavailable(t *testing.T) {
+	vmm := &VMMManager{
+		firecrackerPath: "/nonexistent/firecracker",
+		socketDir:       t.TempDir(),
+		processes:       make(map[string]*exec.Cmd),
+	}
+	config := map[string]interface{}{
+		"machine-config": map[string]interface{}{"vcpu_count": 1, "mem_size_mib": 1 << 30, "huge_pages": "2M"},
+	}
+
+	// No host has a pool this large
+	err := vmm.Start(context.Background(), &types.Task{ID: "task-1"}, config)
+	assert.ErrorIs(t, err, hugepages.ErrUnavailable)
+
+	vmm.processMutex.Lock()
+	defer vmm.processMutex.Unlock()
+	assert.Empty(t, vmm.processes)
+}
+
+func TestVMMManager_Start_KernelChecksum(t *testing.T) {
+	vmm := &VMMManager{
+		firecrackerPath: "/nonexistent/firecracker",
+		socketDir:       t.TempDir(),
+		processes:       make(map[string]*exec.Cmd),
+	}
+	kernelPath := filepath.Join(t.TempDir(), "vmlinux")
+	require.NoError(t, os.WriteFile(kernelPath, []byte("kernel"), 0644))
+	sum, err := kernel.Checksum(kernelPath)
+	require.NoError(t, err)
+
+	// The kernel changed on disk after it was added to the catalog
+	require.NoError(t, os.WriteFile(kernelPath, []byte("tampered"), 0644))
+	config := map[string]interface{}{
+		"boot-source":   map[string]interface{}{"kernel_image_path": kernelPath},
+		"kernel-sha256": sum,
+	}
+
+	err = vmm.Start(context.Background(), &types.Task{ID: "task-1"}, config)
+	assert.ErrorIs(t, err, kernel.ErrChecksumMismatch)
+
+	vmm.processMutex.Lock()
+	defer vmm.processMutex.Unlock()
+	assert.Empty(t, vmm.processes)
+}
+
+// TestVMMManager_releaseWarm verifies a claimed VM takes the task's socket
+// and gets the task's kernel arguments through the metadata service
+func TestVMMManager_releaseWarm(t *testing.T) {
+	socketDir := t.TempDir()
+	warmSocket := filepath.Join(socketDir, "warm-0123456789ab-1.sock")
+	listener, err := net.Listen("unix", warmSocket)
+	require.NoError(t, err)
+
+	var mu sync.Mutex
+	var mmdsBody map[string]map[string]interface{}
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.URL.Path == "/mmds" {
+			json.NewDecoder(r.Body).Decode(&mmdsBody)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})}
+	go server.Serve(listener)
+	defer server.Close()
+
+	vmm := &VMMManager{socketDir: socketDir, processes: make(map[string]*exec.Cmd)}
+	vm := &warmpool.VM{ID: "warm-0123456789ab-1", SocketPath: warmSocket}
+	config := map[string]interface{}{
+		"boot-source": map[string]interface{}{"boot_args": "console=ttyS0 swarmcracker.if=eth0,02:00:00:00:00:01,1500"},
+		"mmds":        mmds.Contents(&mmds.Document{Version: mmds.Version, Task: mmds.Task{ID: "task-1"}}),
+	}
+
+	require.NoError(t, vmm.releaseWarm(context.Background(), &types.Task{ID: "task-1"}, config, vm))
+
+	taskSocket := filepath.Join(socketDir, "task-1.sock")
+	assert.Equal(t, taskSocket, vm.SocketPath)
+	assert.FileExists(t, taskSocket)
+	assert.NoFileExists(t, warmSocket)
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, "console=ttyS0 swarmcracker.if=eth0,02:00:00:00:00:01,1500", mmdsBody["warmpool"]["cmdline"])
+	assert.Equal(t, map[string]interface{}{"id": "task-1"}, mmdsBody["swarmcracker"]["task"])
+
+	// The task's own document is left alone
+	_, ok := config["mmds"].(map[string]interface{})["warmpool"]
+	assert.False(t, ok)
+}
+
+func TestVMMManager_Start_NoWarmPool(t *testing.T) {
+	vmm := &VMMManager{
+		firecrackerPath: "/nonexistent/firecracker",
+		socketDir:       t.TempDir(),
+		processes:       make(map[string]*exec.Cmd),
+	}
+	config := map[string]interface{}{
+		"machine-config": map[string]interface{}{"vcpu_count": 1, "mem_size_mib": 512},
+		"warm-pool":      2,
+	}
+
+	// Without a pool the task boots cold
+	assert.Nil(t, vmm.claimWarm(&types.Task{ID: "task-1"}, config))
+	err := vmm.Start(context.Background(), &types.Task{ID: "task-1"}, config)
+	assert.ErrorContains(t, err, "failed to start firecracker")
+}
+
+func TestExitStatus(t *testing.T) {
+	processErr := errors.New("exit status 1")
+
+	tests := []struct {
+		name      string
+		err       error
+		exit      vmexit.Status
+		oomKilled bool
+		wantState types.TaskState
+		wantCode  int
+		wantErrIs error
+		wantMsg   string
+	}{
+		{"clean exit", nil, vmexit.Status{Reported: true}, false, types.TaskStateComplete, 0, nil, "Task completed successfully"},
+		{"workload failed", nil, vmexit.Status{Reported: true, Code: 3}, false, types.TaskStateFailed, 3, nil, "workload exited with status 3"},
+		{"workload killed", nil, vmexit.Status{Reported: true, Code: 143}, false, types.TaskStateFailed, 143, nil, "workload was killed by signal 15 (terminated)"},
+		{"guest oom", nil, vmexit.Status{Reported: true, Code: 137, OOM: true}, false, types.TaskStateFailed, 137, ErrGuestOOMKilled, ""},
+		{"kernel panic", nil, vmexit.Status{Panic: "VFS: Unable to mount root fs"}, false, types.TaskStateFailed, 1, ErrKernelPanic, ""},
+		{"panic after report", nil, vmexit.Status{Reported: true, Panic: "Attempted to kill init!"}, false, types.TaskStateComplete, 0, nil, ""},
+		{"host oom", processErr, vmexit.Status{}, true, types.TaskStateFailed, 137, ErrOOMKilled, ""},
+		{"no report", processErr, vmexit.Status{}, false, types.TaskStateFailed, 1, processErr, ""},
+		{"no report, clean", nil, vmexit.Status{}, false, types.TaskStateComplete, 0, nil, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status := exitStatus(tt.err, tt.exit, tt.oomKilled)
+			assert.Equal(t, tt.wantState, status.State)
+			assert.Equal(t, tt.wantCode, status.ExitCode)
+			if tt.wantErrIs != nil {
+				assert.ErrorIs(t, status.Err, tt.wantErrIs)
+			}
+			if tt.wantState == types.TaskStateComplete {
+				assert.NoError(t, status.Err)
+			}
+			if tt.wantMsg != "" {
+				assert.Equal(t, tt.wantMsg, status.Message)
+			}
+			var exitErr *ExitError
+			if errors.As(status.Err, &exitErr) {
+				assert.Equal(t, tt.wantCode, exitErr.ExitCode())
+			}
+		})
+	}
+}
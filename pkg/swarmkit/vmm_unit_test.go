@@ -5,6 +5,7 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"reflect"
 	"sync"
 	"testing"
 	"time"
@@ -357,6 +358,48 @@ func TestNewVMMManagerWithMissingJailer(t *testing.T) {
 	}
 }
 
+// TestNewVMMManagerWithSeccompFilter tests that a custom seccomp filter is
+// passed to Firecracker.
+func TestNewVMMManagerWithSeccompFilter(t *testing.T) {
+	tempDir := t.TempDir()
+	filterPath := filepath.Join(tempDir, "custom.bpf")
+	if err := os.WriteFile(filterPath, []byte("bpf"), 0644); err != nil {
+		t.Fatalf("Failed to write filter: %v", err)
+	}
+
+	vmm, err := NewVMMManagerWithConfig(&VMMManagerConfig{
+		FirecrackerPath: "/usr/bin/firecracker",
+		SocketDir:       tempDir,
+		SeccompFilter:   filterPath,
+	})
+	if err != nil {
+		t.Fatalf("NewVMMManagerWithConfig() error = %v", err)
+	}
+
+	want := []string{"--api-sock", "/tmp/vm.sock", "--id", "vm", "--seccomp-filter", filterPath}
+	if got := vmm.firecrackerArgs("/tmp/vm.sock", "vm"); !reflect.DeepEqual(got, want) {
+		t.Errorf("firecrackerArgs() = %v, want %v", got, want)
+	}
+
+	// Firecracker's built-in filters without the setting
+	vmm, err = NewVMMManagerWithConfig(&VMMManagerConfig{FirecrackerPath: "/usr/bin/firecracker", SocketDir: tempDir})
+	if err != nil {
+		t.Fatalf("NewVMMManagerWithConfig() error = %v", err)
+	}
+	if got := vmm.firecrackerArgs("/tmp/vm.sock", "vm"); len(got) != 4 {
+		t.Errorf("firecrackerArgs() = %v, want no --seccomp-filter", got)
+	}
+
+	_, err = NewVMMManagerWithConfig(&VMMManagerConfig{
+		FirecrackerPath: "/usr/bin/firecracker",
+		SocketDir:       tempDir,
+		SeccompFilter:   filepath.Join(tempDir, "missing.bpf"),
+	})
+	if err == nil {
+		t.Error("Expected error for a missing seccomp filter")
+	}
+}
+
 // TestDescribe tests the Describe method
 func TestDescribe(t *testing.T) {
 	vmm := newTestVMMManager(t, false)
@@ -0,0 +1,328 @@
+package swarmkit
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/restuhaqza/swarmcracker/pkg/metrics"
+	"github.com/restuhaqza/swarmcracker/pkg/network"
+	"github.com/restuhaqza/swarmcracker/pkg/tracing"
+	"github.com/restuhaqza/swarmcracker/pkg/types"
+	"github.com/restuhaqza/swarmcracker/pkg/vmexit"
+	"github.com/restuhaqza/swarmcracker/pkg/warmpool"
+)
+
+// warmSpec returns the warm pool spec of a translated VM config.
+func warmSpec(task *types.Task, cfg map[string]interface{}) warmpool.Spec {
+	bootSource, _ := cfg["boot-source"].(map[string]interface{})
+	machineConfig, _ := cfg["machine-config"].(map[string]interface{})
+	spec := warmpool.Spec{
+		Image:  taskImage(task),
+		VCPUs:  toInt(machineConfig["vcpu_count"]),
+		MemMiB: toInt(machineConfig["mem_size_mib"]),
+	}
+	spec.Kernel, _ = bootSource["kernel_image_path"].(string)
+	spec.Initrd, _ = bootSource["initrd_path"].(string)
+	if drives, _ := cfg["drives"].([]map[string]interface{}); len(drives) > 0 {
+		spec.Rootfs, _ = drives[0]["path_on_host"].(string)
+	}
+	spec.CPUTemplate, _ = machineConfig["cpu_template"].(string)
+	if custom, ok := cfg["cpu-config"].(string); ok {
+		spec.CPUTemplate = custom
+	}
+	_, spec.Balloon = cfg["balloon"].(map[string]interface{})
+	ifaces, _ := cfg["network-interfaces"].([]map[string]interface{})
+	spec.Interfaces = len(ifaces)
+	if len(ifaces) > 0 {
+		limiter, _ := ifaces[0]["rx_rate_limiter"].(map[string]interface{})
+		ops, _ := limiter["ops"].(map[string]interface{})
+		spec.RateLimit = toInt(ops["size"])
+	}
+	return spec
+}
+
+// goldenConfig returns the config a pool's golden VM boots from: the task's
+// VM without its network configuration, logger, metrics or metadata, made
+// to wait for a workload.
+func goldenConfig(cfg map[string]interface{}) map[string]interface{} {
+	golden := make(map[string]interface{}, len(cfg))
+	for k, val := range cfg {
+		switch k {
+		case "logger", "metrics", "warm-pool":
+			continue
+		}
+		golden[k] = val
+	}
+
+	bootSource := make(map[string]interface{})
+	for k, val := range cfg["boot-source"].(map[string]interface{}) {
+		bootSource[k] = val
+	}
+	args, _ := bootSource["boot_args"].(string)
+	bootSource["boot_args"] = warmBootArgs(args)
+	golden["boot-source"] = bootSource
+	golden["mmds"] = map[string]interface{}{}
+	return golden
+}
+
+// warmBootArgs drops the task's network configuration and trace from a
+// kernel command line and adds warmpool.BootArg.
+func warmBootArgs(args string) string {
+	var kept []string
+	for _, arg := range strings.Fields(args) {
+		switch {
+		case strings.HasPrefix(arg, "ip="),
+			strings.HasPrefix(arg, network.GuestInterfaceArg+"="),
+			strings.HasPrefix(arg, network.GuestRouteArg+"="),
+			strings.HasPrefix(arg, tracing.BootArg+"="):
+			continue
+		}
+		kept = append(kept, arg)
+	}
+	return strings.Join(append(kept, warmpool.BootArg), " ")
+}
+
+// warmTap returns the host TAP device name of a pooled VM's interface.
+// Format: wp-<sha256(vmID)[:8]>-<index>.
+func warmTap(vmID string, index int) string {
+	hash := sha256.Sum256([]byte(vmID))
+	return fmt.Sprintf("wp-%s-%d", hex.EncodeToString(hash[:])[:8], index)
+}
+
+// warmDriver creates the VMs of the warm pool with Firecracker, without
+// the jailer.
+type warmDriver struct {
+	v *VMMManager
+}
+
+// Golden boots a VM, waits for its guest to wait for a workload, and
+// snapshots it into dir.
+func (d *warmDriver) Golden(ctx context.Context, dir string, config map[string]interface{}) error {
+	v := d.v
+	id := "golden-" + filepath.Base(dir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create golden snapshot dir: %w", err)
+	}
+
+	// The golden VM's interfaces are on no bridge
+	golden := make(map[string]interface{}, len(config))
+	for k, val := range config {
+		golden[k] = val
+	}
+	ifaces, _ := config["network-interfaces"].([]map[string]interface{})
+	var goldenIfaces []map[string]interface{}
+	for i, iface := range ifaces {
+		tap := warmTap(id, i)
+		if err := network.CreateTap(tap); err != nil {
+			return err
+		}
+		defer network.DeleteTap(tap)
+
+		copied := make(map[string]interface{}, len(iface))
+		for k, val := range iface {
+			copied[k] = val
+		}
+		copied["host_dev_name"] = tap
+		goldenIfaces = append(goldenIfaces, copied)
+	}
+	golden["network-interfaces"] = goldenIfaces
+
+	socketPath := filepath.Join(dir, "golden.sock")
+	defer os.Remove(socketPath)
+
+	cmd := exec.CommandContext(ctx, v.firecrackerPath, v.firecrackerArgs(socketPath, id)...)
+	ready := tracing.NewMarkerWatcher(warmpool.ReadyMarker)
+	cmd.Stdout = io.MultiWriter(&logWriter{logger: v.logger}, ready)
+	cmd.Stderr = &logWriter{logger: v.logger}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start firecracker: %w", err)
+	}
+	defer func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	}()
+
+	if err := v.waitForSocket(ctx, socketPath, 10*time.Second); err != nil {
+		return fmt.Errorf("socket not created: %w", err)
+	}
+	if err := v.configureVM(ctx, &types.Task{ID: id}, socketPath, golden); err != nil {
+		return fmt.Errorf("failed to configure VM: %w", err)
+	}
+
+	select {
+	case <-ready.Ready():
+	case <-ctx.Done():
+		return fmt.Errorf("guest never waited for a workload (does the image have curl?): %w", ctx.Err())
+	}
+
+	if err := v.patchAPI(ctx, socketPath, "/vm", map[string]interface{}{"state": "Paused"}); err != nil {
+		return fmt.Errorf("failed to pause VM: %w", err)
+	}
+	snapshot := map[string]interface{}{
+		"snapshot_type": "Full",
+		"snapshot_path": filepath.Join(dir, "vm.state"),
+		"mem_file_path": filepath.Join(dir, "vm.mem"),
+	}
+	if err := v.putAPI(ctx, socketPath, "/snapshot/create", snapshot); err != nil {
+		return fmt.Errorf("failed to create snapshot: %w", err)
+	}
+	return nil
+}
+
+// Restore starts a VM, paused, from the golden snapshot in dir. Its
+// interfaces get TAP devices of their own until a task claims it.
+func (d *warmDriver) Restore(ctx context.Context, dir string, vm *warmpool.VM) (err error) {
+	v := d.v
+	defer func() {
+		if err != nil {
+			d.Destroy(vm)
+		}
+	}()
+
+	var overrides []map[string]interface{}
+	for i := 0; i < vm.Spec.Interfaces; i++ {
+		tap := warmTap(vm.ID, i)
+		if err := network.CreateTap(tap); err != nil {
+			return err
+		}
+		vm.Taps = append(vm.Taps, tap)
+		overrides = append(overrides, map[string]interface{}{
+			"iface_id":      fmt.Sprintf("eth%d", i),
+			"host_dev_name": tap,
+		})
+	}
+
+	if err := os.MkdirAll(v.socketDir, 0755); err != nil {
+		return fmt.Errorf("failed to create socket dir: %w", err)
+	}
+	socketPath := filepath.Join(v.socketDir, vm.ID+".sock")
+
+	// Not bound to ctx: the VM outlives the fill that restored it
+	cmd := exec.Command(v.firecrackerPath, v.firecrackerArgs(socketPath, vm.ID)...)
+	console := vmexit.NewWatcher()
+	cmd.Stdout = io.MultiWriter(&logWriter{logger: v.logger}, console)
+	cmd.Stderr = &logWriter{logger: v.logger}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start firecracker: %w", err)
+	}
+	vm.Cmd = cmd
+	vm.SocketPath = socketPath
+	v.processMutex.Lock()
+	v.setConsole(vm.ID, console)
+	v.processMutex.Unlock()
+
+	if err := v.waitForSocket(ctx, socketPath, 10*time.Second); err != nil {
+		return fmt.Errorf("socket not created: %w", err)
+	}
+
+	// The logger and metrics are not part of the snapshot; their files are
+	// renamed with the socket when a task claims the VM
+	logger := map[string]interface{}{"log_path": metrics.FirecrackerLogPath(socketPath), "level": "Info"}
+	if err := v.configureOutput(ctx, socketPath, "/logger", logger, "log_path", ""); err != nil {
+		return fmt.Errorf("failed to set logger: %w", err)
+	}
+	metricsCfg := map[string]interface{}{"metrics_path": metrics.FirecrackerMetricsPath(socketPath)}
+	if err := v.configureOutput(ctx, socketPath, "/metrics", metricsCfg, "metrics_path", ""); err != nil {
+		return fmt.Errorf("failed to set metrics: %w", err)
+	}
+
+	load := map[string]interface{}{
+		"snapshot_path": filepath.Join(dir, "vm.state"),
+		"mem_backend": map[string]interface{}{
+			"backend_type": "File",
+			"backend_path": filepath.Join(dir, "vm.mem"),
+		},
+		"resume_vm":         false,
+		"network_overrides": overrides,
+	}
+	if err := v.putAPI(ctx, socketPath, "/snapshot/load", load); err != nil {
+		return fmt.Errorf("failed to load snapshot: %w", err)
+	}
+	return nil
+}
+
+// Destroy stops a pooled VM and removes its TAP devices and files.
+func (d *warmDriver) Destroy(vm *warmpool.VM) {
+	if vm.Cmd != nil && vm.Cmd.Process != nil {
+		vm.Cmd.Process.Kill()
+		vm.Cmd.Wait()
+	}
+	for _, tap := range vm.Taps {
+		network.DeleteTap(tap)
+	}
+	d.v.processMutex.Lock()
+	delete(d.v.consoles, vm.ID)
+	d.v.processMutex.Unlock()
+	if vm.SocketPath != "" {
+		os.Remove(vm.SocketPath)
+		os.Remove(metrics.FirecrackerLogPath(vm.SocketPath))
+		os.Remove(metrics.FirecrackerMetricsPath(vm.SocketPath))
+	}
+}
+
+// claimWarm takes a VM for a task from the warm pool, if the translator
+// made the task eligible and the pool of its spec has one.
+func (v *VMMManager) claimWarm(task *types.Task, cfg map[string]interface{}) *warmpool.VM {
+	size := toInt(cfg["warm-pool"])
+	if v.pool == nil || size < 1 {
+		return nil
+	}
+	return v.pool.Claim(warmSpec(task, cfg), size, goldenConfig(cfg))
+}
+
+// releaseWarm makes a claimed VM the task's: its socket and output files
+// take the task's names, and the task's kernel arguments are served to
+// the guest, which still waits for them.
+func (v *VMMManager) releaseWarm(ctx context.Context, task *types.Task, cfg map[string]interface{}, vm *warmpool.VM) error {
+	socketPath := filepath.Join(v.socketDir, task.ID+".sock")
+	if err := os.Rename(vm.SocketPath, socketPath); err != nil {
+		return fmt.Errorf("failed to rename socket: %w", err)
+	}
+	os.Rename(metrics.FirecrackerLogPath(vm.SocketPath), metrics.FirecrackerLogPath(socketPath))
+	os.Rename(metrics.FirecrackerMetricsPath(vm.SocketPath), metrics.FirecrackerMetricsPath(socketPath))
+	vm.SocketPath = socketPath
+
+	contents := map[string]interface{}{}
+	if m, ok := cfg["mmds"].(map[string]interface{}); ok {
+		for k, val := range m {
+			contents[k] = val
+		}
+	}
+	bootSource, _ := cfg["boot-source"].(map[string]interface{})
+	contents[warmpool.ReleaseKey] = map[string]interface{}{"cmdline": bootSource["boot_args"]}
+	if err := v.putAPI(ctx, socketPath, "/mmds", contents); err != nil {
+		return fmt.Errorf("failed to set MMDS metadata: %w", err)
+	}
+	return nil
+}
+
+// attachWarm moves a released VM onto the task's TAP devices and resumes
+// it. The task's devices are gone once the first one is adopted, so the
+// task cannot start cold after a failure here.
+func (v *VMMManager) attachWarm(ctx context.Context, task *types.Task, vm *warmpool.VM) error {
+	for i, tap := range vm.Taps {
+		if err := network.AdoptTap(tap, network.TapName(task.ID, i)); err != nil {
+			return err
+		}
+	}
+	if err := v.patchAPI(ctx, vm.SocketPath, "/vm", map[string]interface{}{"state": "Resumed"}); err != nil {
+		return fmt.Errorf("failed to resume VM: %w", err)
+	}
+
+	v.processMutex.Lock()
+	v.processes[task.ID] = vm.Cmd
+	v.setConsole(task.ID, v.consoles[vm.ID])
+	delete(v.consoles, vm.ID)
+	v.processMutex.Unlock()
+
+	cpus, _ := v.cpuPlacement(task.ID)
+	return v.pinThreads(task.ID, vm.Cmd.Process.Pid, cpus)
+}
@@ -0,0 +1,85 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// GuestWatcher scans a VM's console output for ReadyMarker. Attach it to the
+// Firecracker process's stdout, which carries the guest serial console.
+type GuestWatcher struct {
+	marker []byte
+	mu     sync.Mutex
+	tail   []byte // end of the previous write, in case the marker is split
+	once   sync.Once
+	ready  chan struct{}
+}
+
+// NewGuestWatcher creates a watcher that has not seen the marker yet.
+func NewGuestWatcher() *GuestWatcher {
+	return NewMarkerWatcher(ReadyMarker)
+}
+
+// NewMarkerWatcher creates a watcher for another console marker.
+func NewMarkerWatcher(marker string) *GuestWatcher {
+	return &GuestWatcher{marker: []byte(marker), ready: make(chan struct{})}
+}
+
+// Write implements io.Writer. It never fails.
+func (w *GuestWatcher) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	select {
+	case <-w.ready:
+		return len(p), nil
+	default:
+	}
+
+	buf := append(w.tail, p...)
+	if bytes.Contains(buf, w.marker) {
+		w.once.Do(func() { close(w.ready) })
+		w.tail = nil
+		return len(p), nil
+	}
+
+	keep := len(w.marker) - 1
+	if len(buf) > keep {
+		buf = buf[len(buf)-keep:]
+	}
+	w.tail = append([]byte(nil), buf...)
+	return len(p), nil
+}
+
+// Ready is closed once the marker has been seen.
+func (w *GuestWatcher) Ready() <-chan struct{} {
+	return w.ready
+}
+
+// TraceGuest records a "guest.userspace" span, starting at start, as a child
+// of the span in ctx. The span ends when w sees the ready marker, or with an
+// error after timeout. It returns immediately; cancelling ctx does not end
+// the span early.
+func TraceGuest(ctx context.Context, w *GuestWatcher, start time.Time, timeout time.Duration) {
+	if !trace.SpanContextFromContext(ctx).IsSampled() {
+		return
+	}
+	parent := trace.ContextWithSpan(context.Background(), trace.SpanFromContext(ctx))
+	_, span := otel.Tracer(instrumentation).Start(parent, "guest.userspace", trace.WithTimestamp(start))
+
+	go func() {
+		select {
+		case <-w.Ready():
+			span.End()
+		case <-time.After(timeout):
+			span.SetStatus(codes.Error, "guest did not report userspace ready")
+			span.End()
+		}
+	}()
+}
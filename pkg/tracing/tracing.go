@@ -0,0 +1,116 @@
+// Package tracing provides OpenTelemetry tracing of the task start path:
+// the exporter setup, the tracer used by the executor, and propagation of
+// the trace into the guest through the kernel command line.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ServiceName is the service.name of spans exported by the agent.
+const ServiceName = "swarmd-firecracker"
+
+// instrumentation is the name of the tracer.
+const instrumentation = "github.com/restuhaqza/swarmcracker"
+
+// BootArg is the kernel argument carrying the W3C traceparent of a task's
+// launch into the guest.
+const BootArg = "swarmcracker.traceparent"
+
+// ReadyMarker is written to the serial console by the guest init wrapper
+// once userspace is up, followed by " traceparent=<value>" when the VM was
+// booted with BootArg.
+const ReadyMarker = "swarmcracker: userspace ready"
+
+// Options configures the exporter.
+type Options struct {
+	// Endpoint is the OTLP/HTTP collector URL, e.g. http://127.0.0.1:4318.
+	// Spans are posted to <Endpoint>/v1/traces.
+	Endpoint string
+	// SampleRatio is the fraction of task launches traced, in (0, 1].
+	SampleRatio float64
+	// Node is recorded as host.name on every span.
+	Node string
+}
+
+// Setup installs a global tracer provider exporting to opts.Endpoint. Until
+// it is called spans are no-ops. The returned function flushes and stops the
+// exporter.
+func Setup(ctx context.Context, opts Options) (shutdown func(context.Context) error, err error) {
+	if opts.Endpoint == "" {
+		return nil, fmt.Errorf("tracing endpoint is required")
+	}
+	exporter, err := otlptracehttp.New(ctx, otlptracehttp.WithEndpointURL(strings.TrimSuffix(opts.Endpoint, "/")+"/v1/traces"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OTLP exporter: %w", err)
+	}
+
+	res := resource.NewWithAttributes(semconv.SchemaURL,
+		semconv.ServiceName(ServiceName),
+		semconv.HostName(opts.Node),
+	)
+
+	ratio := opts.SampleRatio
+	if ratio <= 0 || ratio > 1 {
+		ratio = 1
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter, sdktrace.WithBatchTimeout(5*time.Second)),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio))),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	return provider.Shutdown, nil
+}
+
+// Start starts a span named name as a child of the span in ctx.
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(instrumentation).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// End records err on span, if any, and ends it.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// Traceparent returns the W3C traceparent of the span in ctx, or "" if the
+// span is not sampled.
+func Traceparent(ctx context.Context) string {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.IsValid() || !sc.IsSampled() {
+		return ""
+	}
+	carrier := propagation.MapCarrier{}
+	propagation.TraceContext{}.Inject(ctx, carrier)
+	return carrier.Get("traceparent")
+}
+
+// KernelArg returns the BootArg kernel argument for the span in ctx, or ""
+// if the span is not sampled.
+func KernelArg(ctx context.Context) string {
+	tp := Traceparent(ctx)
+	if tp == "" {
+		return ""
+	}
+	return BootArg + "=" + tp
+}
@@ -0,0 +1,210 @@
+package tracing
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+	collectortrace "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+// collector is a stand-in OTLP/HTTP collector recording exported span names.
+type collector struct {
+	mu    sync.Mutex
+	spans []string
+	hosts []string
+}
+
+func (c *collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/v1/traces" {
+		http.NotFound(w, r)
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var req collectortrace.ExportTraceServiceRequest
+	if err := proto.Unmarshal(body, &req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, rs := range req.ResourceSpans {
+		for _, attr := range rs.Resource.Attributes {
+			if attr.Key == "host.name" {
+				c.hosts = append(c.hosts, attr.Value.GetStringValue())
+			}
+		}
+		for _, ss := range rs.ScopeSpans {
+			for _, span := range ss.Spans {
+				c.spans = append(c.spans, span.Name)
+			}
+		}
+	}
+
+	out, _ := proto.Marshal(&collectortrace.ExportTraceServiceResponse{})
+	w.Header().Set("Content-Type", "application/x-protobuf")
+	w.Write(out)
+}
+
+// useRecorder installs an in-memory tracer provider for the test
+func useRecorder(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+	rec := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec)))
+	t.Cleanup(func() { otel.SetTracerProvider(noop.NewTracerProvider()) })
+	return rec
+}
+
+func TestSetup_ExportsToCollector(t *testing.T) {
+	c := &collector{}
+	srv := httptest.NewServer(c)
+	defer srv.Close()
+
+	shutdown, err := Setup(context.Background(), Options{Endpoint: srv.URL, SampleRatio: 1, Node: "node-1"})
+	require.NoError(t, err)
+	t.Cleanup(func() { otel.SetTracerProvider(noop.NewTracerProvider()) })
+
+	ctx, root := Start(context.Background(), "task.launch")
+	_, child := Start(ctx, "image.pull")
+	End(child, nil)
+	End(root, nil)
+
+	require.NoError(t, shutdown(context.Background()))
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	assert.ElementsMatch(t, []string{"task.launch", "image.pull"}, c.spans)
+	assert.Contains(t, c.hosts, "node-1")
+}
+
+func TestSetup_RequiresEndpoint(t *testing.T) {
+	_, err := Setup(context.Background(), Options{})
+	assert.Error(t, err)
+}
+
+func TestKernelArg(t *testing.T) {
+	assert.Empty(t, KernelArg(context.Background()), "no span means no argument")
+
+	useRecorder(t)
+	ctx, span := Start(context.Background(), "task.launch")
+	defer span.End()
+
+	arg := KernelArg(ctx)
+	sc := span.SpanContext()
+	assert.Equal(t, BootArg+"=00-"+sc.TraceID().String()+"-"+sc.SpanID().String()+"-01", arg)
+	assert.NotContains(t, arg, " ", "kernel arguments are space separated")
+}
+
+func TestEnd_RecordsError(t *testing.T) {
+	rec := useRecorder(t)
+	_, span := Start(context.Background(), "firecracker.configure")
+	End(span, assert.AnError)
+
+	spans := rec.Ended()
+	require.Len(t, spans, 1)
+	assert.Equal(t, "Error", spans[0].Status().Code.String())
+	assert.Equal(t, assert.AnError.Error(), spans[0].Status().Description)
+}
+
+func TestGuestWatcher(t *testing.T) {
+	tests := []struct {
+		name   string
+		writes []string
+		ready  bool
+	}{
+		{"single write", []string{"[    1.0] init\n" + ReadyMarker + " traceparent=00-abc\n"}, true},
+		{"split marker", []string{"boot\nswarmcracker: user", "space ready\n"}, true},
+		{"split into bytes", strings.Split(ReadyMarker, ""), true},
+		{"no marker", []string{"boot\n", "swarmcracker: userspace\n"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := NewGuestWatcher()
+			for _, s := range tt.writes {
+				n, err := w.Write([]byte(s))
+				require.NoError(t, err)
+				assert.Equal(t, len(s), n)
+			}
+			select {
+			case <-w.Ready():
+				assert.True(t, tt.ready, "unexpected ready")
+			default:
+				assert.False(t, tt.ready, "marker not seen")
+			}
+		})
+	}
+}
+
+func TestNewMarkerWatcher(t *testing.T) {
+	w := NewMarkerWatcher("warm ready")
+	w.Write([]byte(ReadyMarker + "\n"))
+	select {
+	case <-w.Ready():
+		t.Fatal("matched the default marker")
+	default:
+	}
+
+	w.Write([]byte("swarmcracker: warm"))
+	w.Write([]byte(" ready\n"))
+	select {
+	case <-w.Ready():
+	default:
+		t.Fatal("marker not seen")
+	}
+}
+
+func TestTraceGuest(t *testing.T) {
+	rec := useRecorder(t)
+
+	ctx, launch := Start(context.Background(), "task.launch")
+	defer launch.End()
+
+	w := NewGuestWatcher()
+	start := time.Now().Add(-time.Second)
+	TraceGuest(ctx, w, start, time.Minute)
+	w.Write([]byte(ReadyMarker + "\n"))
+
+	require.Eventually(t, func() bool { return len(rec.Ended()) == 1 }, time.Second, 10*time.Millisecond)
+	span := rec.Ended()[0]
+	assert.Equal(t, "guest.userspace", span.Name())
+	assert.Equal(t, launch.SpanContext().SpanID(), span.Parent().SpanID())
+	assert.Equal(t, start, span.StartTime())
+}
+
+func TestTraceGuest_Timeout(t *testing.T) {
+	rec := useRecorder(t)
+
+	ctx, launch := Start(context.Background(), "task.launch")
+	defer launch.End()
+
+	TraceGuest(ctx, NewGuestWatcher(), time.Now(), 20*time.Millisecond)
+
+	require.Eventually(t, func() bool { return len(rec.Ended()) == 1 }, time.Second, 10*time.Millisecond)
+	assert.Equal(t, "Error", rec.Ended()[0].Status().Code.String())
+}
+
+func TestTraceGuest_NotSampled(t *testing.T) {
+	rec := useRecorder(t)
+	TraceGuest(trace.ContextWithSpanContext(context.Background(), trace.SpanContext{}), NewGuestWatcher(), time.Now(), time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+	assert.Empty(t, rec.Ended())
+}
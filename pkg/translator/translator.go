@@ -1,8 +1,6 @@
 package translator
 
 import (
-	"crypto/sha256"
-	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"net"
@@ -10,7 +8,11 @@ import (
 
 	"github.com/rs/zerolog/log"
 
+	"github.com/restuhaqza/swarmcracker/pkg/arch"
+	"github.com/restuhaqza/swarmcracker/pkg/balloon"
+	"github.com/restuhaqza/swarmcracker/pkg/hugepages"
 	"github.com/restuhaqza/swarmcracker/pkg/lifecycle"
+	"github.com/restuhaqza/swarmcracker/pkg/network"
 	"github.com/restuhaqza/swarmcracker/pkg/types"
 )
 
@@ -23,6 +25,9 @@ type TaskTranslator struct {
 	initSystem    string // "none", "tini", "dumb-init"
 	initPath      string // Path to init binary
 	networkConfig types.NetworkConfig
+	balloon       *balloon.Device // nil: no balloon unless a service label asks for one
+	hugePages     string          // guest memory page size unless a service label says otherwise
+	arch          arch.Arch       // guest architecture, the host's
 }
 
 // Config holds translator configuration.
@@ -33,6 +38,15 @@ type Config struct {
 	DefaultMemMB  int
 	InitSystem    string
 	NetworkConfig types.NetworkConfig
+
+	// EnableBalloon gives VMs a memory balloon configured like Balloon,
+	// unless their service's swarmcracker.balloon label says otherwise
+	EnableBalloon bool
+	Balloon       balloon.Device
+
+	// HugePages backs guest memory with huge pages of this size ("2M"),
+	// unless their service's swarmcracker.hugepages label says otherwise
+	HugePages string
 }
 
 // NewTaskTranslator creates a new TaskTranslator.
@@ -45,6 +59,7 @@ func NewTaskTranslator(config interface{}) *TaskTranslator {
 		defaultMemMB: 512,
 		initSystem:   "tini",
 		initPath:     getInitPath("tini"),
+		arch:         arch.Default(),
 	}
 
 	// Try to extract from translator.Config (preferred)
@@ -56,6 +71,11 @@ func NewTaskTranslator(config interface{}) *TaskTranslator {
 		tt.initSystem = cfg.InitSystem
 		tt.initPath = getInitPath(cfg.InitSystem)
 		tt.networkConfig = cfg.NetworkConfig
+		if cfg.EnableBalloon {
+			device := cfg.Balloon
+			tt.balloon = &device
+		}
+		tt.hugePages = cfg.HugePages
 	} else if cfg, ok := config.(*lifecycle.ManagerConfig); ok {
 		// Fallback for legacy calls (though we should migrate)
 		tt.kernelPath = cfg.KernelPath
@@ -86,6 +106,7 @@ type VMMConfig struct {
 	NetworkInterfaces []NetworkInterface `json:"network-interfaces"`
 	Drives            []Drive            `json:"drives"`
 	Vsock             *VsockConfig       `json:"vsock,omitempty"`
+	Balloon           *balloon.Device    `json:"balloon,omitempty"`
 }
 
 // BootSourceConfig specifies boot configuration.
@@ -97,16 +118,17 @@ type BootSourceConfig struct {
 
 // MachineConfig specifies VM resources.
 type MachineConfig struct {
-	VcpuCount  int  `json:"vcpu_count"`
-	MemSizeMib int  `json:"mem_size_mib"`
-	Smt        bool `json:"smt"`
+	VcpuCount  int    `json:"vcpu_count"`
+	MemSizeMib int    `json:"mem_size_mib"`
+	Smt        bool   `json:"smt"`
+	HugePages  string `json:"huge_pages,omitempty"`
 }
 
 // NetworkInterface specifies network configuration.
 type NetworkInterface struct {
 	IfaceID     string `json:"iface_id"`
 	HostDevName string `json:"host_dev_name"`
-	MacAddress  string `json:"mac_address,omitempty"`
+	MacAddress  string `json:"guest_mac,omitempty"`
 	RxQueueSize int    `json:"rx_queue_size"`
 	TxQueueSize int    `json:"tx_queue_size"`
 }
@@ -141,6 +163,9 @@ func (tt *TaskTranslator) Translate(task *types.Task) (interface{}, error) {
 	if err != nil {
 		return nil, fmt.Errorf("task runtime is not a container: %w", err)
 	}
+	if err := network.CheckGuestAddresses(task); err != nil {
+		return nil, err
+	}
 
 	config := &VMMConfig{
 		MachineConfig: MachineConfig{
@@ -162,15 +187,43 @@ func (tt *TaskTranslator) Translate(task *types.Task) (interface{}, error) {
 		tt.applyResources(config, task.Spec.Resources.Limits)
 	}
 
+	// Back guest memory with huge pages
+	pageSize, err := hugepages.Resolve(tt.hugePages, task.Labels)
+	if err != nil {
+		return nil, err
+	}
+	if pageSize != "" {
+		if tt.initrdPath != "" {
+			return nil, fmt.Errorf("huge pages cannot be used with an initrd")
+		}
+		config.MachineConfig.HugePages = pageSize
+		config.MachineConfig.MemSizeMib = hugepages.Align(pageSize, config.MachineConfig.MemSizeMib)
+	}
+
+	// Add the memory balloon, starting deflated. Firecracker cannot
+	// balloon huge page backed memory.
+	withBalloon, err := balloon.Enabled(tt.balloon != nil, task.Labels)
+	if err != nil {
+		return nil, err
+	}
+	if withBalloon && pageSize == "" {
+		device := balloon.Device{DeflateOnOOM: true, StatsPollingIntervalS: 5}
+		if tt.balloon != nil {
+			device = *tt.balloon
+		}
+		device.AmountMiB = 0
+		config.Balloon = &device
+	}
+
 	// Add network interfaces
-	for i, network := range task.Networks {
+	for i, attachment := range task.Networks {
 		log.Info().
 			Str("task_id", task.ID).
 			Int("index", i).
-			Str("network_id", network.Network.ID).
-			Int("addresses", len(network.Addresses)).
+			Str("network_id", attachment.Network.ID).
+			Int("addresses", len(attachment.Addresses)).
 			Msg("Building network interface from task.Networks")
-		iface := tt.buildNetworkInterface(network, i, task.ID)
+		iface := tt.buildNetworkInterface(attachment, i, task.ID)
 		config.NetworkInterfaces = append(config.NetworkInterfaces, iface)
 	}
 
@@ -227,26 +280,23 @@ func (tt *TaskTranslator) buildBootArgs(task *types.Task) string {
 	container, err := task.Spec.GetContainer()
 	if err != nil {
 		log.Warn().Str("task_id", task.ID).Msg("task runtime is not a Container, using default boot args")
-		return "console=ttyS0 reboot=k panic=1 pci=off init=/init"
+		return tt.arch.KernelArgs() + " init=/init"
 	}
-	args := []string{
-		"console=ttyS0",
-		"reboot=k",
-		"panic=1",
-		"pci=off",
+	args := append(append([]string{}, tt.arch.BootArgs...),
 		"random.trust_cpu=on",
 		"init=/init", // Use custom init script at root
-	}
+	)
 
 	// Check if we have an allocated IP address
 	ipArg := "ip=dhcp"
-	mtu := 1500
+	mtu := network.DefaultBridgeMTU
 
 	// Check for overlay network to adjust MTU
-	if len(task.Networks) > 0 && task.Networks[0].Network.Spec.Driver == "overlay" {
-		mtu = 1450
+	if len(task.Networks) > 0 {
+		mtu = network.GuestMTU(task.Networks[0].Network.Spec.Driver)
 	}
 
+	var gateway string
 	if len(task.Networks) > 0 && len(task.Networks[0].Addresses) > 0 {
 		// Parse IP/Mask from "192.168.1.2/24"
 		// Format: ip=<client-ip>:<server-ip>:<gw-ip>:<netmask>:<hostname>:<device>:<autoconf>
@@ -260,38 +310,26 @@ func (tt *TaskTranslator) buildBootArgs(task *types.Task) string {
 			mask := net.IP(ipNet.Mask)
 			netmask := fmt.Sprintf("%d.%d.%d.%d", mask[0], mask[1], mask[2], mask[3])
 
-			// Determine gateway
-			gateway := ""
-			if tt.networkConfig.BridgeIP != "" {
-				// Use configured bridge IP as gateway
-				gwIP, _, err := net.ParseCIDR(tt.networkConfig.BridgeIP)
-				if err == nil {
-					gateway = gwIP.String()
-				}
-			}
-
-			// Fallback gateway logic if config missing
-			if gateway == "" {
-				// Assume .1
-				ipParts := strings.Split(clientIP, ".")
-				if len(ipParts) == 4 {
-					gateway = fmt.Sprintf("%s.%s.%s.1", ipParts[0], ipParts[1], ipParts[2])
-				}
-			}
+			gateway = tt.gatewayFor(clientIP)
 
 			// ip=<client-ip>:<server-ip>:<gw-ip>:<netmask>:<hostname>:<device>:<autoconf>
 			// server-ip is empty (no NFS root)
 			// hostname is empty (allow kernel to set or use task ID?)
 			// device is eth0
 			// autoconf is off
-			ipArg = fmt.Sprintf("ip=%s::%s:%s::eth0:off", clientIP, gateway, netmask)
+			ipArg = fmt.Sprintf("ip=%s::%s:%s::eth0:off", clientIP, network.AttachmentGateway(task.Networks[0], gateway), netmask)
 		}
 	}
+	// The kernel ip= argument only covers eth0 and is kept for images whose
+	// own init never runs our wrapper; the wrapper applies the full config.
 	args = append(args, ipArg)
 
 	// Pass MTU as a kernel argument (can be used by init scripts)
 	args = append(args, fmt.Sprintf("mtu=%d", mtu))
 
+	// Per-interface addresses, routes and MTU for every attachment
+	args = append(args, network.BuildGuestNetworkConfig(task, gateway).BootArgs()...)
+
 	// Build container command line
 	var containerCmd []string
 	if len(container.Command) > 0 {
@@ -319,6 +357,22 @@ func (tt *TaskTranslator) buildBootArgs(task *types.Task) string {
 	return strings.Join(args, " ")
 }
 
+// gatewayFor returns the default gateway for a guest address: the configured
+// bridge IP if set, otherwise the .1 address of the guest's /24.
+func (tt *TaskTranslator) gatewayFor(clientIP string) string {
+	if tt.networkConfig.BridgeIP != "" {
+		if gwIP, _, err := net.ParseCIDR(tt.networkConfig.BridgeIP); err == nil {
+			return gwIP.String()
+		}
+	}
+
+	ipParts := strings.Split(clientIP, ".")
+	if len(ipParts) == 4 {
+		return fmt.Sprintf("%s.%s.%s.1", ipParts[0], ipParts[1], ipParts[2])
+	}
+	return ""
+}
+
 // buildInitArgs builds init arguments wrapping the container command.
 func (tt *TaskTranslator) buildInitArgs(containerCmd []string) []string {
 	switch tt.initSystem {
@@ -356,18 +410,11 @@ func (tt *TaskTranslator) applyResources(config *VMMConfig, limits *types.Resour
 }
 
 // buildNetworkInterface creates a network interface configuration.
-func (tt *TaskTranslator) buildNetworkInterface(_ types.NetworkAttachment, index int, taskID string) NetworkInterface {
-	ifaceID := fmt.Sprintf("eth%d", index)
-
-	// Generate TAP name: tap-<hash[:12]>-<index>
-	hash := sha256.Sum256([]byte(taskID))
-	hashStr := hex.EncodeToString(hash[:])
-	tapName := fmt.Sprintf("tap-%s-%d", hashStr[:12], index)
-
+func (tt *TaskTranslator) buildNetworkInterface(attachment types.NetworkAttachment, index int, taskID string) NetworkInterface {
 	return NetworkInterface{
-		IfaceID:     ifaceID,
-		HostDevName: tapName,
-		MacAddress:  "", // Will be generated by Firecracker
+		IfaceID:     fmt.Sprintf("eth%d", index),
+		HostDevName: network.TapName(taskID, index),
+		MacAddress:  network.GuestMAC(taskID, attachment.Network.ID, index),
 		RxQueueSize: 256,
 		TxQueueSize: 256,
 	}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"testing"
 
+	"github.com/restuhaqza/swarmcracker/pkg/arch"
 	"github.com/restuhaqza/swarmcracker/pkg/lifecycle"
 	"github.com/restuhaqza/swarmcracker/pkg/types"
 	"github.com/stretchr/testify/assert"
@@ -432,6 +433,7 @@ func TestTaskTranslator_BuildBootArgs_IPParsingErrorHandling(t *testing.T) {
 	for _, tc := range tests {
 		t.Run(tc.name, func(t *testing.T) {
 			tt := NewTaskTranslator(nil)
+			tt.arch = arch.AMD64
 			result := tt.buildBootArgs(tc.task)
 
 			if tc.expectDHCP {
@@ -4,6 +4,9 @@ import (
 	"encoding/json"
 	"testing"
 
+	"github.com/restuhaqza/swarmcracker/pkg/arch"
+	"github.com/restuhaqza/swarmcracker/pkg/balloon"
+	"github.com/restuhaqza/swarmcracker/pkg/hugepages"
 	"github.com/restuhaqza/swarmcracker/pkg/types"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -204,6 +207,152 @@ func TestTaskTranslator_Translate(t *testing.T) {
 	}
 }
 
+func TestTaskTranslator_Translate_Balloon(t *testing.T) {
+	newTask := func(labels map[string]string) *types.Task {
+		return &types.Task{
+			ID:          "task-balloon",
+			Labels:      labels,
+			Annotations: map[string]string{"rootfs": "/var/lib/firecracker/rootfs/nginx.ext4"},
+			Spec:        types.TaskSpec{Runtime: &types.Container{Image: "nginx:latest"}},
+		}
+	}
+	device := balloon.Device{AmountMiB: 128, DeflateOnOOM: true, StatsPollingIntervalS: 10}
+
+	tests := []struct {
+		name    string
+		config  *Config
+		labels  map[string]string
+		want    map[string]interface{}
+		wantErr bool
+	}{
+		{
+			name:   "disabled",
+			config: &Config{KernelPath: "/vmlinux", DefaultVCPUs: 1, DefaultMemMB: 512},
+		},
+		{
+			name:   "node default starts deflated",
+			config: &Config{KernelPath: "/vmlinux", DefaultVCPUs: 1, DefaultMemMB: 512, EnableBalloon: true, Balloon: device},
+			want:   map[string]interface{}{"amount_mib": float64(0), "deflate_on_oom": true, "stats_polling_interval_s": float64(10)},
+		},
+		{
+			name:   "label without node settings",
+			config: &Config{KernelPath: "/vmlinux", DefaultVCPUs: 1, DefaultMemMB: 512},
+			labels: map[string]string{balloon.Label: "true"},
+			want:   map[string]interface{}{"amount_mib": float64(0), "deflate_on_oom": true, "stats_polling_interval_s": float64(5)},
+		},
+		{
+			name:   "label opts out",
+			config: &Config{KernelPath: "/vmlinux", DefaultVCPUs: 1, DefaultMemMB: 512, EnableBalloon: true, Balloon: device},
+			labels: map[string]string{balloon.Label: "false"},
+		},
+		{
+			name:    "invalid label",
+			config:  &Config{KernelPath: "/vmlinux", DefaultVCPUs: 1, DefaultMemMB: 512},
+			labels:  map[string]string{balloon.Label: "sometimes"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := NewTaskTranslator(tt.config).Translate(newTask(tt.labels))
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+
+			got, ok := result.(map[string]interface{})["balloon"]
+			if tt.want == nil {
+				assert.False(t, ok, "unexpected balloon: %v", got)
+				return
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestTaskTranslator_Translate_HugePages(t *testing.T) {
+	newTask := func(labels map[string]string) *types.Task {
+		return &types.Task{
+			ID:          "task-hugepages",
+			Labels:      labels,
+			Annotations: map[string]string{"rootfs": "/var/lib/firecracker/rootfs/nginx.ext4"},
+			Spec:        types.TaskSpec{Runtime: &types.Container{Image: "nginx:latest"}},
+		}
+	}
+
+	tests := []struct {
+		name        string
+		config      *Config
+		labels      map[string]string
+		wantPages   interface{}
+		wantMemMiB  float64
+		wantBalloon bool
+		wantErr     bool
+	}{
+		{
+			name:       "disabled",
+			config:     &Config{KernelPath: "/vmlinux", DefaultVCPUs: 1, DefaultMemMB: 513},
+			wantMemMiB: 513,
+		},
+		{
+			name:       "node default rounds memory to whole pages",
+			config:     &Config{KernelPath: "/vmlinux", DefaultVCPUs: 1, DefaultMemMB: 513, HugePages: "2M"},
+			wantPages:  "2M",
+			wantMemMiB: 514,
+		},
+		{
+			name:       "label opts out",
+			config:     &Config{KernelPath: "/vmlinux", DefaultVCPUs: 1, DefaultMemMB: 512, HugePages: "2M"},
+			labels:     map[string]string{hugepages.Label: "None"},
+			wantMemMiB: 512,
+		},
+		{
+			name:       "label replaces the balloon",
+			config:     &Config{KernelPath: "/vmlinux", DefaultVCPUs: 1, DefaultMemMB: 512, EnableBalloon: true},
+			labels:     map[string]string{hugepages.Label: "2M"},
+			wantPages:  "2M",
+			wantMemMiB: 512,
+		},
+		{
+			name:        "balloon without huge pages",
+			config:      &Config{KernelPath: "/vmlinux", DefaultVCPUs: 1, DefaultMemMB: 512, EnableBalloon: true},
+			wantMemMiB:  512,
+			wantBalloon: true,
+		},
+		{
+			name:    "initrd",
+			config:  &Config{KernelPath: "/vmlinux", InitrdPath: "/initrd", DefaultVCPUs: 1, DefaultMemMB: 512, HugePages: "2M"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid label",
+			config:  &Config{KernelPath: "/vmlinux", DefaultVCPUs: 1, DefaultMemMB: 512},
+			labels:  map[string]string{hugepages.Label: "1G"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := NewTaskTranslator(tt.config).Translate(newTask(tt.labels))
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+
+			config := result.(map[string]interface{})
+			machineConfig := config["machine-config"].(map[string]interface{})
+			assert.Equal(t, tt.wantPages, machineConfig["huge_pages"])
+			assert.Equal(t, tt.wantMemMiB, machineConfig["mem_size_mib"])
+			_, hasBalloon := config["balloon"]
+			assert.Equal(t, tt.wantBalloon, hasBalloon)
+		})
+	}
+}
+
 func TestTaskTranslator_buildBootArgs(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -305,6 +454,7 @@ func TestTaskTranslator_buildBootArgs(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			translator := NewTaskTranslator(nil)
+			translator.arch = arch.AMD64
 			got := translator.buildBootArgs(tt.task)
 
 			// Check that all expected args are present
@@ -315,6 +465,46 @@ func TestTaskTranslator_buildBootArgs(t *testing.T) {
 	}
 }
 
+func TestTaskTranslator_buildBootArgs_Arch(t *testing.T) {
+	task := &types.Task{
+		ID:   "test-task",
+		Spec: types.TaskSpec{Runtime: &types.Container{}},
+	}
+	tests := []struct {
+		arch      arch.Arch
+		wantArgs  []string
+		notInArgs []string
+	}{
+		{
+			arch:     arch.AMD64,
+			wantArgs: []string{"console=ttyS0", "reboot=k", "panic=1", "pci=off", "init=/init"},
+		},
+		{
+			arch:      arch.ARM64,
+			wantArgs:  []string{"keep_bootcon", "console=ttyS0", "reboot=k", "panic=1", "init=/init"},
+			notInArgs: []string{"pci=off"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.arch.Name, func(t *testing.T) {
+			translator := NewTaskTranslator(nil)
+			translator.arch = tt.arch
+
+			got := translator.buildBootArgs(task)
+			for _, arg := range tt.wantArgs {
+				assert.Contains(t, got, arg)
+			}
+			for _, arg := range tt.notInArgs {
+				assert.NotContains(t, got, arg)
+			}
+
+			fallback := translator.buildBootArgs(&types.Task{ID: "test-task"})
+			assert.Equal(t, tt.arch.KernelArgs()+" init=/init", fallback)
+		})
+	}
+}
+
 func TestTaskTranslator_applyResources(t *testing.T) {
 	tests := []struct {
 		name      string
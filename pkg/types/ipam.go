@@ -0,0 +1,36 @@
+package types
+
+import "net"
+
+// IPAMState is the on-disk form of an IP allocator. The node allocator and
+// the CNI IPAM share it so tools can inspect either file.
+type IPAMState struct {
+	Pools []IPAMPool `json:"pools"`
+}
+
+// IPAMPool is one subnet and its allocations.
+type IPAMPool struct {
+	Subnet      string            `json:"subnet"`
+	Gateway     string            `json:"gateway,omitempty"`
+	Reserved    []string          `json:"reserved,omitempty"`
+	Allocations map[string]string `json:"allocations"` // IP -> owner ID
+}
+
+// Capacity returns the number of assignable addresses in the pool,
+// excluding the network, broadcast and reserved addresses.
+func (p IPAMPool) Capacity() int {
+	_, subnet, err := net.ParseCIDR(p.Subnet)
+	if err != nil {
+		return 0
+	}
+	ones, bits := subnet.Mask.Size()
+	if bits-ones >= 31 {
+		// Avoid overflowing int for huge (IPv6) pools
+		return int(^uint(0) >> 1)
+	}
+	total := 1<<(bits-ones) - 2 - len(p.Reserved)
+	if total < 0 {
+		return 0
+	}
+	return total
+}
@@ -4,28 +4,38 @@ package types
 import (
 	"context"
 	"fmt"
+	"os"
+	"time"
 )
 
 // SecretRef represents a SwarmKit secret reference with data.
 type SecretRef struct {
-	ID     string // Secret ID from SwarmKit
-	Name   string // Secret name
-	Target string // File path inside VM (e.g., "/run/secrets/my_secret")
-	Data   []byte // Secret data content
+	ID     string      // Secret ID from SwarmKit
+	Name   string      // Secret name
+	Target string      // File path inside VM (e.g., "/run/secrets/my_secret")
+	UID    string      // Numeric owner of the file, root if empty
+	GID    string      // Numeric group of the file, root if empty
+	Mode   os.FileMode // File permissions, 0400 if zero
+	Data   []byte      // Secret data content
 }
 
 // ConfigRef represents a SwarmKit config reference with data.
 type ConfigRef struct {
-	ID     string // Config ID from SwarmKit
-	Name   string // Config name
-	Target string // File path inside VM (e.g., "/config/app.yaml")
-	Data   []byte // Config data content
+	ID     string      // Config ID from SwarmKit
+	Name   string      // Config name
+	Target string      // File path inside VM (e.g., "/config/app.yaml")
+	UID    string      // Numeric owner of the file, root if empty
+	GID    string      // Numeric group of the file, root if empty
+	Mode   os.FileMode // File permissions, 0444 if zero
+	Data   []byte      // Config data content
 }
 
 // Task represents a SwarmKit task (simplified).
 type Task struct {
 	ID          string
 	ServiceID   string
+	ServiceName string // Service name, resolvable by guests via the built-in DNS
+	Slot        uint64 // Replica slot, 0 for global services
 	NodeID      string
 	Spec        TaskSpec
 	Status      TaskStatus
@@ -33,6 +43,16 @@ type Task struct {
 	Secrets     []SecretRef // Secrets to inject into the container
 	Configs     []ConfigRef // Configs to inject into the container
 	Annotations map[string]string
+	Labels      map[string]string // Service labels
+	Ports       []PortConfig      // Ports published on the node
+}
+
+// PortConfig describes a port published by a task.
+type PortConfig struct {
+	Name          string
+	Protocol      string // "tcp", "udp" or "sctp"
+	TargetPort    uint32 // Port inside the VM
+	PublishedPort uint32 // Port on the node
 }
 
 // TaskSpec defines the task specification.
@@ -77,6 +97,20 @@ type Container struct {
 	Args    []string
 	Env     []string
 	Mounts  []Mount
+
+	// Healthcheck is run in the guest; nil leaves it to the image
+	Healthcheck *HealthConfig
+}
+
+// HealthConfig is a container healthcheck, as in Docker: Test is
+// ["CMD", args...], ["CMD-SHELL", command] or ["NONE"]. Zero durations and
+// retries take the defaults.
+type HealthConfig struct {
+	Test        []string
+	Interval    time.Duration
+	Timeout     time.Duration
+	StartPeriod time.Duration
+	Retries     int
 }
 
 // Mount specifies a volume mount.
@@ -125,6 +159,7 @@ type TaskStatus struct {
 	Timestamp     int64
 	Message       string
 	Err           error
+	ExitCode      int // workload exit status, as reported by the guest
 }
 
 // TaskState represents the current state of a task.
@@ -153,8 +188,11 @@ type NetworkAttachment struct {
 
 // Network represents a network.
 type Network struct {
-	ID   string
-	Spec NetworkSpec
+	ID      string
+	Spec    NetworkSpec
+	VNI     uint32 // VXLAN network identifier from the allocator's driver state, if any
+	Subnet  string // IPv4 subnet from the network's IPAM config (e.g. "10.0.9.0/24"), if any
+	Gateway string // Gateway address from the network's IPAM config, if any
 }
 
 // NetworkSpec specifies network configuration.
@@ -185,8 +223,9 @@ type NetworkConfig struct {
 	BridgeIP        string `yaml:"bridge_ip"`         // e.g., "192.168.127.1/24"
 	IPMode          string `yaml:"ip_mode"`           // "static" or "dhcp"
 	NATEnabled      bool   `yaml:"nat_enabled"`       // Enable masquerading for internet access
-	DHCPRangeStart  int    `yaml:"dhcp_range_start"`  // DHCP range start offset in subnet (default: 50)
-	DHCPRangeEnd    int    `yaml:"dhcp_range_end"`    // DHCP range end offset in subnet (default: 200)
+	DHCPRangeStart  int    `yaml:"dhcp_range_start"`  // Deprecated: DHCP serves the allocator's addresses
+	DHCPRangeEnd    int    `yaml:"dhcp_range_end"`    // Deprecated: DHCP serves the allocator's addresses
+	StateDir        string `yaml:"state_dir"`         // Persistent network state such as DHCP leases
 
 	// VXLAN overlay settings
 	VXLANEnabled  bool     `yaml:"vxlan_enabled"`   // Enable VXLAN overlay for cross-node networking
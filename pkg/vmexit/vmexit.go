@@ -0,0 +1,142 @@
+// Package vmexit reads how a VM's workload exited from the guest's serial
+// console.
+//
+// The init wrapper runs the workload as a child, reports its exit status
+// on the console as "<Marker><code>" and powers the VM off. Guests that
+// never report (images with their own init, or VMs killed by the host)
+// leave only the Firecracker process's exit to go by. The guest kernel's
+// panic and OOM killer messages, and the userspace ready and health reports
+// of the init wrapper (see tracing.ReadyMarker and healthcheck.Marker), are
+// picked up too.
+package vmexit
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/restuhaqza/swarmcracker/pkg/healthcheck"
+	"github.com/restuhaqza/swarmcracker/pkg/tracing"
+)
+
+// Marker starts the console line on which the init wrapper reports the
+// workload's exit status, e.g. "swarmcracker: exit status=3". Statuses
+// above 128 mean the workload was killed by signal status-128.
+const Marker = "swarmcracker: exit status="
+
+const (
+	panicMarker = "Kernel panic - not syncing: "
+	oomMarker   = "Out of memory: Killed process"
+
+	// maxLine bounds the console line kept while waiting for its end
+	maxLine = 4096
+)
+
+// Status is what the guest console told about the workload's exit.
+type Status struct {
+	// Reported is set once the init wrapper reported the exit; Code is
+	// only valid then
+	Reported bool
+	Code     int
+
+	// Panic is the guest kernel's panic message, if it panicked
+	Panic string
+
+	// OOM is set if the guest kernel's OOM killer killed a process
+	OOM bool
+
+	// Ready is set once the init wrapper reported userspace up, right
+	// before it starts the workload
+	Ready bool
+
+	// Health is the guest's last reported health (healthcheck.Healthy or
+	// healthcheck.Unhealthy), empty until the first report
+	Health string
+}
+
+// Signal returns the signal that killed the workload, or 0 if it exited.
+func (s Status) Signal() int {
+	if s.Reported && s.Code > 128 {
+		return s.Code - 128
+	}
+	return 0
+}
+
+// Watcher scans a VM's console output for the workload's exit. Attach it
+// to the Firecracker process's stdout, which carries the guest serial
+// console.
+//
+// A nil *Watcher is valid and never sees anything.
+type Watcher struct {
+	mu     sync.Mutex
+	line   []byte
+	status Status
+}
+
+// NewWatcher creates a watcher that has not seen any exit yet.
+func NewWatcher() *Watcher {
+	return &Watcher{}
+}
+
+// Write implements io.Writer. It never fails.
+func (w *Watcher) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	rest := p
+	for len(rest) > 0 {
+		i := bytes.IndexByte(rest, '\n')
+		if i < 0 {
+			w.line = append(w.line, rest...)
+			if len(w.line) > maxLine {
+				w.line = w.line[len(w.line)-maxLine:]
+			}
+			break
+		}
+		w.line = append(w.line, rest[:i]...)
+		w.scan(string(bytes.TrimRight(w.line, "\r")))
+		w.line = w.line[:0]
+		rest = rest[i+1:]
+	}
+	return len(p), nil
+}
+
+// scan records what a complete console line says. w.mu must be held.
+func (w *Watcher) scan(line string) {
+	if i := strings.Index(line, Marker); i >= 0 {
+		if code, err := strconv.Atoi(strings.TrimSpace(line[i+len(Marker):])); err == nil {
+			w.status.Reported = true
+			w.status.Code = code
+		}
+		return
+	}
+	if i := strings.Index(line, healthcheck.Marker); i >= 0 {
+		switch health := strings.TrimSpace(line[i+len(healthcheck.Marker):]); health {
+		case healthcheck.Healthy, healthcheck.Unhealthy:
+			w.status.Health = health
+		}
+		return
+	}
+	if strings.Contains(line, tracing.ReadyMarker) {
+		w.status.Ready = true
+		return
+	}
+	if i := strings.Index(line, panicMarker); i >= 0 && w.status.Panic == "" {
+		w.status.Panic = strings.TrimSpace(line[i+len(panicMarker):])
+		return
+	}
+	if strings.Contains(line, oomMarker) {
+		w.status.OOM = true
+	}
+}
+
+// Status returns what the watcher has seen so far.
+func (w *Watcher) Status() Status {
+	if w == nil {
+		return Status{}
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.status
+}
@@ -0,0 +1,105 @@
+package vmexit
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWatcher(t *testing.T) {
+	tests := []struct {
+		name    string
+		console []string
+		want    Status
+	}{
+		{
+			name:    "clean exit",
+			console: []string{"booting\r\n", "swarmcracker: exit status=0\r\n"},
+			want:    Status{Reported: true, Code: 0},
+		},
+		{
+			name:    "marker split across writes",
+			console: []string{"swarmcracker: ex", "it status=", "3\n"},
+			want:    Status{Reported: true, Code: 3},
+		},
+		{
+			name:    "unterminated line",
+			console: []string{"swarmcracker: exit status=3"},
+			want:    Status{},
+		},
+		{
+			name: "guest OOM kill",
+			console: []string{
+				"[   12.345] Out of memory: Killed process 42 (java) total-vm:2097152kB\n",
+				"swarmcracker: exit status=137\n",
+			},
+			want: Status{Reported: true, Code: 137, OOM: true},
+		},
+		{
+			name:    "kernel panic",
+			console: []string{"[    0.912] Kernel panic - not syncing: VFS: Unable to mount root fs on unknown-block(0,0)\n"},
+			want:    Status{Panic: "VFS: Unable to mount root fs on unknown-block(0,0)"},
+		},
+		{
+			name: "userspace ready",
+			console: []string{
+				"swarmcracker: userspace ready traceparent=00-abc-def-01\n",
+				"swarmcracker: exit status=0\n",
+			},
+			want: Status{Ready: true, Reported: true, Code: 0},
+		},
+		{
+			name: "health changes",
+			console: []string{
+				"swarmcracker: health status=healthy\n",
+				"swarmcracker: health status=unhealthy\r\n",
+			},
+			want: Status{Health: "unhealthy"},
+		},
+		{
+			name:    "garbled health",
+			console: []string{"swarmcracker: health status=starting\n"},
+			want:    Status{},
+		},
+		{
+			name:    "garbled marker",
+			console: []string{"swarmcracker: exit status=abc\n"},
+			want:    Status{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := NewWatcher()
+			for _, p := range tt.console {
+				n, err := w.Write([]byte(p))
+				assert.NoError(t, err)
+				assert.Equal(t, len(p), n)
+			}
+			assert.Equal(t, tt.want, w.Status())
+		})
+	}
+}
+
+func TestStatus_Signal(t *testing.T) {
+	assert.Equal(t, 9, Status{Reported: true, Code: 137}.Signal())
+	assert.Equal(t, 0, Status{Reported: true, Code: 3}.Signal())
+	assert.Equal(t, 0, Status{Code: 137}.Signal())
+}
+
+func TestWatcher_LongLine(t *testing.T) {
+	w := NewWatcher()
+	long := make([]byte, 3*maxLine)
+	for i := range long {
+		long[i] = 'x'
+	}
+	w.Write(long)
+	w.Write([]byte("swarmcracker: exit status=2\n"))
+	assert.Equal(t, Status{Reported: true, Code: 2}, w.Status())
+	assert.LessOrEqual(t, cap(w.line), 4*maxLine)
+}
+
+func TestWatcher_Nil(t *testing.T) {
+	var w *Watcher
+	assert.Equal(t, Status{}, w.Status())
+}
@@ -0,0 +1,359 @@
+// Package warmpool keeps paused microVMs restored from golden snapshots of
+// hot images, so their tasks start without a kernel boot or guest init.
+//
+// A golden snapshot is taken of a VM booted with BootArg: its init wrapper
+// stops before the workload, reports ReadyMarker and waits to be released.
+// Pooled VMs are restored from the snapshot and stay paused until a task
+// claims one. The task's kernel arguments (its network configuration) then
+// reach the guest through the metadata service under ReleaseKey, and the
+// wrapper carries on as if it had booted with them.
+package warmpool
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Label is the service label that sets the size of the warm pool of a
+// service's image, overriding the node's size for the image. "0" turns
+// the pool off.
+const Label = "swarmcracker.warmpool"
+
+// BootArg is the kernel argument that makes the init wrapper wait for a
+// workload instead of starting the image's command.
+const BootArg = "swarmcracker.warm"
+
+// ReadyMarker is written to the serial console by the init wrapper once it
+// waits for a workload; the golden snapshot is taken then.
+const ReadyMarker = "swarmcracker: warm ready"
+
+// ReleaseKey is the metadata store key a claimed VM's release is served
+// under. The guest reads the task's kernel arguments from
+// ReleaseKey/cmdline.
+const ReleaseKey = "warmpool"
+
+// DefaultDir is where nodes keep their golden snapshots.
+const DefaultDir = "/var/lib/firecracker/warmpool"
+
+// retryInterval is how long a pool whose golden snapshot failed stays
+// empty before the snapshot is built again.
+const retryInterval = 5 * time.Minute
+
+// validKey matches the keys of specs, which name their golden snapshot
+// directories.
+var validKey = regexp.MustCompile(`^[0-9a-f]{12}$`)
+
+// Size returns the pool size for an image: the service label if set, else
+// the node's size for the image.
+func Size(sizes map[string]int, image string, labels map[string]string) (int, error) {
+	if v, ok := labels[Label]; ok && v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("label %s: invalid pool size %q", Label, v)
+		}
+		return n, nil
+	}
+	return sizes[image], nil
+}
+
+// Spec is what a golden snapshot captures of a VM. Tasks with equal specs
+// share a pool.
+type Spec struct {
+	Image       string
+	Rootfs      string
+	Kernel      string
+	Initrd      string
+	VCPUs       int
+	MemMiB      int
+	CPUTemplate string
+	Balloon     bool
+	Interfaces  int
+	RateLimit   int // packets per second of each interface; 0 for none
+}
+
+// Key identifies the pool of a spec. It is safe for use in paths and
+// interface names.
+func (s Spec) Key() string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%+v", s)))
+	return hex.EncodeToString(sum[:])[:12]
+}
+
+// VM is a pooled VM, restored and paused.
+type VM struct {
+	ID         string
+	Spec       Spec
+	SocketPath string
+	Taps       []string // host devices of the VM's interfaces, in order
+	Cmd        *exec.Cmd
+}
+
+// Driver creates and destroys the VMs of a pool.
+type Driver interface {
+	// Golden boots a VM from config, waits for its guest to report
+	// ReadyMarker and snapshots it into dir.
+	Golden(ctx context.Context, dir string, config map[string]interface{}) error
+	// Restore starts vm, paused, from the golden snapshot in dir. It sets
+	// the VM's socket, taps and process.
+	Restore(ctx context.Context, dir string, vm *VM) error
+	// Destroy stops a VM that was never claimed and frees its resources.
+	Destroy(vm *VM)
+}
+
+// Metrics records pool claims and sizes. *metrics.Exporter implements it.
+type Metrics interface {
+	ObserveWarmPoolClaim(image string, hit bool)
+	SetWarmPoolReady(image string, ready int)
+}
+
+// Config holds the node's pool settings.
+type Config struct {
+	// Dir holds the golden snapshots.
+	Dir string
+	// GoldenTimeout bounds how long a golden VM may take to report
+	// ReadyMarker.
+	GoldenTimeout time.Duration
+}
+
+// pool is the pool of one spec.
+type pool struct {
+	spec     Spec
+	size     int
+	template map[string]interface{}
+	dir      string // golden snapshot
+
+	golden   bool
+	building bool
+	failedAt time.Time
+	filling  int
+	ready    []*VM
+}
+
+// Pool keeps the pools of all specs in use on the node. Pools are created
+// by the first claim of their spec, which misses; the golden snapshot and
+// the pooled VMs are then built in the background.
+//
+// A nil *Pool is valid and never has a VM.
+type Pool struct {
+	cfg     Config
+	driver  Driver
+	metrics Metrics
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu    sync.Mutex
+	pools map[string]*pool
+	seq   int
+}
+
+// New creates a pool. Golden snapshots left from a previous run are
+// removed, as the images they were taken of may have changed since.
+func New(cfg Config, driver Driver) (*Pool, error) {
+	if cfg.Dir == "" {
+		cfg.Dir = DefaultDir
+	}
+	if cfg.GoldenTimeout <= 0 {
+		cfg.GoldenTimeout = time.Minute
+	}
+	if err := os.MkdirAll(cfg.Dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create warm pool directory: %w", err)
+	}
+	entries, err := os.ReadDir(cfg.Dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read warm pool directory: %w", err)
+	}
+	for _, e := range entries {
+		if e.IsDir() && validKey.MatchString(e.Name()) {
+			os.RemoveAll(filepath.Join(cfg.Dir, e.Name()))
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Pool{
+		cfg:    cfg,
+		driver: driver,
+		ctx:    ctx,
+		cancel: cancel,
+		pools:  make(map[string]*pool),
+	}, nil
+}
+
+// SetMetrics makes the pool record claims and sizes to m.
+func (p *Pool) SetMetrics(m Metrics) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.metrics = m
+}
+
+// Claim takes a VM from the pool of spec, keeping the pool at size VMs.
+// It returns nil on a miss, and for sizes below one. template is the VM
+// config the golden snapshot is booted from, used when the pool is new.
+func (p *Pool) Claim(spec Spec, size int, template map[string]interface{}) *VM {
+	if p == nil || size < 1 {
+		return nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	key := spec.Key()
+	pl, ok := p.pools[key]
+	if !ok {
+		pl = &pool{spec: spec, template: template, dir: filepath.Join(p.cfg.Dir, key)}
+		p.pools[key] = pl
+	}
+	pl.size = size
+
+	var vm *VM
+	if n := len(pl.ready); n > 0 {
+		vm, pl.ready = pl.ready[0], pl.ready[1:]
+	}
+	if p.metrics != nil {
+		p.metrics.ObserveWarmPoolClaim(spec.Image, vm != nil)
+	}
+	p.refill(pl)
+	return vm
+}
+
+// Ready returns the number of VMs waiting in the pool of spec.
+func (p *Pool) Ready(spec Spec) int {
+	if p == nil {
+		return 0
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if pl, ok := p.pools[spec.Key()]; ok {
+		return len(pl.ready)
+	}
+	return 0
+}
+
+// Close stops filling the pools and destroys the VMs in them.
+func (p *Pool) Close() {
+	if p == nil {
+		return
+	}
+	// Cancelled under the lock, so no claim starts another fill
+	p.mu.Lock()
+	p.cancel()
+	p.mu.Unlock()
+	p.wg.Wait()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, pl := range p.pools {
+		for _, vm := range pl.ready {
+			p.driver.Destroy(vm)
+		}
+		pl.ready = nil
+	}
+}
+
+// refill builds the golden snapshot of a pool, or restores VMs until the
+// pool is full. Extra VMs, left after the size went down, are destroyed.
+// p.mu must be held.
+func (p *Pool) refill(pl *pool) {
+	if p.ctx.Err() != nil {
+		return
+	}
+	for len(pl.ready) > pl.size {
+		p.driver.Destroy(pl.ready[len(pl.ready)-1])
+		pl.ready = pl.ready[:len(pl.ready)-1]
+	}
+	if p.metrics != nil {
+		p.metrics.SetWarmPoolReady(pl.spec.Image, len(pl.ready))
+	}
+
+	if !pl.golden {
+		if pl.building || time.Since(pl.failedAt) < retryInterval {
+			return
+		}
+		pl.building = true
+		p.wg.Add(1)
+		go p.build(pl)
+		return
+	}
+
+	for len(pl.ready)+pl.filling < pl.size {
+		pl.filling++
+		p.seq++
+		vm := &VM{ID: fmt.Sprintf("warm-%s-%d", pl.spec.Key(), p.seq), Spec: pl.spec}
+		p.wg.Add(1)
+		go p.restore(pl, vm)
+	}
+}
+
+// build takes the golden snapshot of a pool.
+func (p *Pool) build(pl *pool) {
+	defer p.wg.Done()
+
+	ctx, cancel := context.WithTimeout(p.ctx, p.cfg.GoldenTimeout)
+	defer cancel()
+	start := time.Now()
+	err := p.driver.Golden(ctx, pl.dir, pl.template)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	pl.building = false
+	if err != nil {
+		pl.failedAt = time.Now()
+		os.RemoveAll(pl.dir)
+		log.Warn().Err(err).
+			Str("image", pl.spec.Image).
+			Str("pool", pl.spec.Key()).
+			Msg("Failed to build golden snapshot, tasks of this image boot cold")
+		return
+	}
+	pl.golden = true
+	log.Info().
+		Str("image", pl.spec.Image).
+		Str("pool", pl.spec.Key()).
+		Dur("duration", time.Since(start)).
+		Msg("Golden snapshot built")
+	p.refill(pl)
+}
+
+// restore adds a VM to a pool.
+func (p *Pool) restore(pl *pool, vm *VM) {
+	defer p.wg.Done()
+
+	err := p.driver.Restore(p.ctx, pl.dir, vm)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	pl.filling--
+	if err != nil {
+		// The snapshot no longer restores, e.g. because its rootfs or
+		// kernel changed: take a new one later
+		if pl.golden {
+			pl.golden = false
+			pl.failedAt = time.Now()
+			os.RemoveAll(pl.dir)
+			log.Warn().Err(err).
+				Str("image", pl.spec.Image).
+				Str("pool", pl.spec.Key()).
+				Msg("Failed to restore warm VM, dropping golden snapshot")
+		}
+		return
+	}
+	if p.ctx.Err() != nil {
+		p.driver.Destroy(vm)
+		return
+	}
+	pl.ready = append(pl.ready, vm)
+	p.refill(pl)
+}
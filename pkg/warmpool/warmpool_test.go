@@ -0,0 +1,247 @@
+package warmpool
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSize(t *testing.T) {
+	sizes := map[string]int{"nginx:alpine": 3}
+
+	tests := []struct {
+		name    string
+		image   string
+		labels  map[string]string
+		want    int
+		wantErr bool
+	}{
+		{"node size", "nginx:alpine", nil, 3, false},
+		{"no pool", "redis:7", nil, 0, false},
+		{"label sets size", "redis:7", map[string]string{Label: "2"}, 2, false},
+		{"label turns off", "nginx:alpine", map[string]string{Label: "0"}, 0, false},
+		{"empty label", "nginx:alpine", map[string]string{Label: ""}, 3, false},
+		{"invalid label", "nginx:alpine", map[string]string{Label: "many"}, 0, true},
+		{"negative label", "nginx:alpine", map[string]string{Label: "-1"}, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Size(sizes, tt.image, tt.labels)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestSpec_Key(t *testing.T) {
+	a := Spec{Image: "nginx:alpine", VCPUs: 1, MemMiB: 512, Interfaces: 1}
+	b := a
+	assert.Equal(t, a.Key(), b.Key())
+	assert.Regexp(t, validKey, a.Key())
+
+	b.MemMiB = 1024
+	assert.NotEqual(t, a.Key(), b.Key())
+}
+
+// fakeDriver records the pool's calls. Golden and Restore fail while their
+// error is set.
+type fakeDriver struct {
+	mu         sync.Mutex
+	goldens    int
+	restores   int
+	destroyed  []string
+	goldenErr  error
+	restoreErr error
+}
+
+func (d *fakeDriver) Golden(_ context.Context, dir string, _ map[string]interface{}) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.goldens++
+	if d.goldenErr != nil {
+		return d.goldenErr
+	}
+	return os.MkdirAll(dir, 0755)
+}
+
+func (d *fakeDriver) Restore(_ context.Context, _ string, vm *VM) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.restores++
+	if d.restoreErr != nil {
+		return d.restoreErr
+	}
+	vm.SocketPath = vm.ID + ".sock"
+	return nil
+}
+
+func (d *fakeDriver) Destroy(vm *VM) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.destroyed = append(d.destroyed, vm.ID)
+}
+
+func (d *fakeDriver) counts() (goldens, restores, destroyed int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.goldens, d.restores, len(d.destroyed)
+}
+
+// fakeMetrics records claims per result.
+type fakeMetrics struct {
+	mu     sync.Mutex
+	hits   int
+	misses int
+}
+
+func (m *fakeMetrics) ObserveWarmPoolClaim(_ string, hit bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if hit {
+		m.hits++
+	} else {
+		m.misses++
+	}
+}
+
+func (m *fakeMetrics) SetWarmPoolReady(string, int) {}
+
+func newTestPool(t *testing.T, d *fakeDriver) *Pool {
+	t.Helper()
+	p, err := New(Config{Dir: t.TempDir()}, d)
+	require.NoError(t, err)
+	t.Cleanup(p.Close)
+	return p
+}
+
+func waitReady(t *testing.T, p *Pool, spec Spec, n int) {
+	t.Helper()
+	require.Eventually(t, func() bool { return p.Ready(spec) == n },
+		2*time.Second, 5*time.Millisecond, "pool never had %d VMs", n)
+}
+
+func TestPool_Claim(t *testing.T) {
+	d := &fakeDriver{}
+	m := &fakeMetrics{}
+	p := newTestPool(t, d)
+	p.SetMetrics(m)
+	spec := Spec{Image: "nginx:alpine", VCPUs: 1, MemMiB: 512, Interfaces: 1}
+
+	// The first claim misses and fills the pool
+	assert.Nil(t, p.Claim(spec, 2, map[string]interface{}{}))
+	waitReady(t, p, spec, 2)
+
+	vm := p.Claim(spec, 2, nil)
+	require.NotNil(t, vm)
+	assert.Equal(t, spec, vm.Spec)
+	assert.NotEmpty(t, vm.SocketPath)
+
+	// The claimed VM is replaced, from the same golden snapshot
+	waitReady(t, p, spec, 2)
+	goldens, restores, _ := d.counts()
+	assert.Equal(t, 1, goldens)
+	assert.Equal(t, 3, restores)
+	assert.Equal(t, 1, m.hits)
+	assert.Equal(t, 1, m.misses)
+
+	// A smaller size destroys the extra VMs
+	require.NotNil(t, p.Claim(spec, 4, nil))
+	waitReady(t, p, spec, 4)
+	require.NotNil(t, p.Claim(spec, 1, nil))
+	assert.Equal(t, 1, p.Ready(spec))
+	_, _, destroyed := d.counts()
+	assert.Equal(t, 2, destroyed)
+
+	// Size 0 never claims
+	assert.Nil(t, p.Claim(spec, 0, nil))
+	assert.Equal(t, 3, m.hits)
+}
+
+func TestPool_GoldenFailure(t *testing.T) {
+	d := &fakeDriver{goldenErr: errors.New("guest never got ready")}
+	p := newTestPool(t, d)
+	spec := Spec{Image: "busybox", Interfaces: 1}
+
+	assert.Nil(t, p.Claim(spec, 2, nil))
+	require.Eventually(t, func() bool {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		return !p.pools[spec.Key()].building
+	}, 2*time.Second, 5*time.Millisecond)
+
+	// Not retried before retryInterval
+	assert.Nil(t, p.Claim(spec, 2, nil))
+	goldens, restores, _ := d.counts()
+	assert.Equal(t, 1, goldens)
+	assert.Equal(t, 0, restores)
+}
+
+func TestPool_RestoreFailure(t *testing.T) {
+	d := &fakeDriver{restoreErr: errors.New("rootfs changed")}
+	p := newTestPool(t, d)
+	spec := Spec{Image: "busybox", Interfaces: 1}
+
+	assert.Nil(t, p.Claim(spec, 1, nil))
+	require.Eventually(t, func() bool {
+		_, restores, _ := d.counts()
+		return restores > 0
+	}, 2*time.Second, 5*time.Millisecond)
+
+	// The golden snapshot is dropped
+	require.Eventually(t, func() bool {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		pl := p.pools[spec.Key()]
+		return !pl.golden && pl.filling == 0
+	}, 2*time.Second, 5*time.Millisecond)
+	assert.NoDirExists(t, filepath.Join(p.cfg.Dir, spec.Key()))
+}
+
+func TestPool_Close(t *testing.T) {
+	d := &fakeDriver{}
+	p, err := New(Config{Dir: t.TempDir()}, d)
+	require.NoError(t, err)
+	spec := Spec{Image: "nginx:alpine", Interfaces: 1}
+
+	p.Claim(spec, 3, nil)
+	waitReady(t, p, spec, 3)
+
+	p.Close()
+	_, _, destroyed := d.counts()
+	assert.Equal(t, 3, destroyed)
+	assert.Nil(t, p.Claim(spec, 3, nil))
+	assert.Equal(t, 0, p.Ready(spec))
+}
+
+func TestNew_ClearsGoldenSnapshots(t *testing.T) {
+	dir := t.TempDir()
+	stale := filepath.Join(dir, Spec{Image: "old"}.Key())
+	other := filepath.Join(dir, "keep")
+	require.NoError(t, os.MkdirAll(stale, 0755))
+	require.NoError(t, os.MkdirAll(other, 0755))
+
+	_, err := New(Config{Dir: dir}, &fakeDriver{})
+	require.NoError(t, err)
+	assert.NoDirExists(t, stale)
+	assert.DirExists(t, other)
+}
+
+func TestPool_Nil(t *testing.T) {
+	var p *Pool
+	assert.Nil(t, p.Claim(Spec{}, 1, nil))
+	assert.Equal(t, 0, p.Ready(Spec{}))
+	p.SetMetrics(nil)
+	p.Close()
+}
@@ -8,6 +8,8 @@ import (
 	"os/exec"
 	"path/filepath"
 	"strings"
+
+	"github.com/restuhaqza/swarmcracker/pkg/ext4"
 )
 
 // ImageCache provides pre-built ext4 rootfs images for integration/E2E tests,
@@ -126,21 +128,11 @@ func (c *ImageCache) Warm(imageRef string) error {
 		return fmt.Errorf("export container: %s: %w", string(out), err)
 	}
 
-	// Extract to directory
-	extractDir := filepath.Join(tmpDir, "extract")
-	os.MkdirAll(extractDir, 0755)
-	extract := exec.Command("tar", "-xf", tarPath, "-C", extractDir)
-	if out, err := extract.CombinedOutput(); err != nil {
-		exec.Command(docker, "rm", containerName).Run()
-		return fmt.Errorf("extract tar: %s: %w", string(out), err)
-	}
-
-	// Create ext4
+	// Create ext4 straight from the tar, keeping ownership without root
 	cachePath := c.Path(imageRef)
-	makeExt4 := exec.Command("mkfs.ext4", "-d", extractDir, cachePath, "100M")
-	if out, err := makeExt4.CombinedOutput(); err != nil {
+	if err := buildExt4FromTar(cachePath, tarPath); err != nil {
 		exec.Command(docker, "rm", containerName).Run()
-		return fmt.Errorf("mkfs.ext4: %s: %w", string(out), err)
+		return fmt.Errorf("build ext4: %w", err)
 	}
 
 	// Cleanup
@@ -148,6 +140,26 @@ func (c *ImageCache) Warm(imageRef string) error {
 	return nil
 }
 
+// buildExt4FromTar writes a 100MB ext4 image holding the entries of a tar.
+func buildExt4FromTar(imagePath, tarPath string) error {
+	f, err := os.Open(tarPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	e, err := ext4.Create(imagePath, ext4.Options{Size: 100 << 20, Label: "rootfs"})
+	if err != nil {
+		return err
+	}
+	if err := e.AddTar(f); err != nil {
+		e.Close()
+		os.Remove(imagePath)
+		return err
+	}
+	return e.Close()
+}
+
 // Clean removes old cached images older than the given duration.
 // If maxAge is 0, the default retention is used.
 func (c *ImageCache) Clean(keep int) error {